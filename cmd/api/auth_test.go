@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/auth"
+	"attendance/internal/testdb"
+)
+
+// rotateBody is a /v1/auth/rotate request for refresh.
+func rotateBody(refresh string) string {
+	return fmt.Sprintf(`{"refresh_token":%q}`, refresh)
+}
+
+// Admin tokens are not kept in refresh_tokens, so rotation refuses them
+// outright instead of failing on a missing row.
+func TestRotateRefusesAdminTokens(t *testing.T) {
+	api := newTestAPI(t, unreachableDB, "ADMIN_PASSWORD", "secret")
+	status, body := api.do(t, http.MethodPost, "/v1/admin/login", "", `{"username":"admin","password":"secret"}`)
+	if status != http.StatusOK {
+		t.Fatalf("admin login = %d %v", status, body)
+	}
+	access, refresh := body["access_token"].(string), body["refresh_token"].(string)
+	if status, body := api.do(t, http.MethodPost, "/v1/auth/rotate", access, rotateBody(refresh)); status != http.StatusForbidden {
+		t.Errorf("rotate an admin token = %d %v, want 403", status, body)
+	}
+}
+
+// A device rotates its refresh token once; the old token, an expired one and
+// a revoked one are all refused.
+func TestRotateRefreshToken(t *testing.T) {
+	dbURL := testdb.URL(t)
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := attendance.NewRepository(db, 0)
+	ctx := context.Background()
+
+	api := newTestAPI(t, dbURL)
+	status, body := api.do(t, http.MethodPost, "/v1/devices/register", "", `{"device_id":"kiosk-rotate","name":"Lobby"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("register = %d %v", status, body)
+	}
+	access, refresh := body["access_token"].(string), body["refresh_token"].(string)
+
+	status, body = api.do(t, http.MethodPost, "/v1/auth/rotate", access, rotateBody(refresh))
+	if status != http.StatusOK {
+		t.Fatalf("rotate = %d %v", status, body)
+	}
+	newAccess, newRefresh := body["access_token"].(string), body["refresh_token"].(string)
+	if status, body := api.do(t, http.MethodPost, "/v1/auth/rotate", access, rotateBody(refresh)); status != http.StatusUnauthorized {
+		t.Errorf("rotate the old token again = %d %v, want 401", status, body)
+	}
+
+	// Signed and unexpired, but revoked.
+	if err := repo.RevokeRefreshToken(ctx, newRefresh); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := api.do(t, http.MethodPost, "/v1/auth/rotate", newAccess, rotateBody(newRefresh)); status != http.StatusUnauthorized {
+		t.Errorf("rotate a revoked token = %d %v, want 401", status, body)
+	}
+
+	// Signed and unexpired, but past the expiry on record.
+	stale, err := auth.Issue("kiosk-rotate", "device", api.cfg.JWTIssuer, api.cfg.JWTSigningKey, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveRefreshToken(ctx, "kiosk-rotate", stale.RefreshToken, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := api.do(t, http.MethodPost, "/v1/auth/rotate", stale.AccessToken, rotateBody(stale.RefreshToken)); status != http.StatusUnauthorized {
+		t.Errorf("rotate a token expired on record = %d %v, want 401", status, body)
+	}
+
+	// An expired JWT is refused before the database is asked.
+	expired, err := auth.Issue("kiosk-rotate", "device", api.cfg.JWTIssuer, api.cfg.JWTSigningKey, time.Hour, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := api.do(t, http.MethodPost, "/v1/auth/rotate", expired.AccessToken, rotateBody(expired.RefreshToken)); status != http.StatusUnauthorized {
+		t.Errorf("rotate an expired token = %d %v, want 401", status, body)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"attendance/internal/attendance"
+	"attendance/internal/i18n"
+	"attendance/internal/jobs"
+	"attendance/internal/storage"
+	"attendance/pkg/client"
+)
+
+// newTestClient returns an SDK client for url holding accessToken, if any.
+func newTestClient(t *testing.T, url, accessToken string) *client.Client {
+	t.Helper()
+	var opts []client.Option
+	if accessToken != "" {
+		opts = append(opts, client.WithTokens(client.TokenPair{AccessToken: accessToken, ExpiresAt: time.Now().Add(time.Hour)}))
+	}
+	c, err := client.New(url, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// checkAPIError fails unless err is an *client.Error with status that
+// matches sentinel.
+func checkAPIError(t *testing.T, err error, status int, sentinel error) {
+	t.Helper()
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *client.Error", err)
+	}
+	if apiErr.Status != status {
+		t.Errorf("status = %d, want %d (%v)", apiErr.Status, status, err)
+	}
+	if !errors.Is(err, sentinel) {
+		t.Errorf("err = %v, want it to match %v", err, sentinel)
+	}
+}
+
+// The SDK against the full router, with the database down.
+func TestClientAgainstRouter(t *testing.T) {
+	api := newTestAPI(t, unreachableDB)
+	ctx := context.Background()
+	device := api.token(t, "kiosk-1", "device")
+	admin := api.token(t, "admin", "admin")
+	const eventID = "6f1c2b1e-0d8a-4a55-9a43-0c3f6f0c2a11"
+
+	tests := []struct {
+		name     string
+		token    string
+		call     func(*client.Client) error
+		status   int
+		sentinel error
+	}{
+		{"bad token", "not-a-token", func(c *client.Client) error {
+			_, err := c.GetEvent(ctx, eventID)
+			return err
+		}, http.StatusUnauthorized, client.ErrUnauthorized},
+		{"check-in without fields", device, func(c *client.Client) error {
+			_, err := c.CheckIn(ctx, client.CheckIn{})
+			return err
+		}, http.StatusBadRequest, client.ErrValidation},
+		{"registration without device id", "", func(c *client.Client) error {
+			_, err := c.RegisterDevice(ctx, client.Registration{})
+			return err
+		}, http.StatusBadRequest, client.ErrValidation},
+		{"registration with the database down", "", func(c *client.Client) error {
+			_, err := c.RegisterDevice(ctx, client.Registration{DeviceID: "kiosk-2"})
+			return err
+		}, http.StatusServiceUnavailable, client.ErrUnavailable},
+		{"event with the database down", admin, func(c *client.Client) error {
+			_, err := c.GetEvent(ctx, eventID)
+			return err
+		}, http.StatusServiceUnavailable, client.ErrUnavailable},
+		{"events with the database down", admin, func(c *client.Client) error {
+			_, err := c.ListEvents(ctx, client.EventFilter{})
+			return err
+		}, http.StatusServiceUnavailable, client.ErrUnavailable},
+		{"employees with the database down", admin, func(c *client.Client) error {
+			_, err := c.ListEmployees(ctx)
+			return err
+		}, http.StatusServiceUnavailable, client.ErrUnavailable},
+		{"employee with the database down", admin, func(c *client.Client) error {
+			_, err := c.GetEmployee(ctx, "e-1")
+			return err
+		}, http.StatusServiceUnavailable, client.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newTestClient(t, api.URL, tt.token))
+			checkAPIError(t, err, tt.status, tt.sentinel)
+			var apiErr *client.Error
+			if errors.As(err, &apiErr) && apiErr.Detail == "" {
+				t.Errorf("error without detail: %+v", apiErr)
+			}
+		})
+	}
+
+	// Calls needing a token fail before sending anything.
+	if _, err := newTestClient(t, api.URL, "").GetEvent(ctx, eventID); !errors.Is(err, client.ErrNoTokens) {
+		t.Errorf("GetEvent without tokens = %v, want ErrNoTokens", err)
+	}
+}
+
+func TestClientRateLimited(t *testing.T) {
+	api := newTestAPI(t, unreachableDB, "RATE_LIMIT_PER_MIN", "1")
+	c := newTestClient(t, api.URL, api.token(t, "admin", "admin"))
+	ctx := context.Background()
+	// The first request spends the only token.
+	_, _ = c.ListEvents(ctx, client.EventFilter{})
+	_, err := c.ListEvents(ctx, client.EventFilter{})
+	checkAPIError(t, err, http.StatusTooManyRequests, client.ErrRateLimited)
+}
+
+// Every error the handlers answer with errorStatus and errorBody reaches the
+// SDK as the matching sentinel.
+func TestClientErrorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		err      error
+		status   int
+		sentinel error
+	}{
+		{attendance.ErrValidation, http.StatusBadRequest, client.ErrValidation},
+		{attendance.ErrNotFound, http.StatusNotFound, client.ErrNotFound},
+		{attendance.ErrDuplicate, http.StatusConflict, client.ErrDuplicate},
+		{attendance.ErrInvalidTransition, http.StatusConflict, client.ErrInvalidTransition},
+		{attendance.ErrTokenRevoked, http.StatusUnauthorized, client.ErrTokenRevoked},
+		{attendance.ErrPINRejected, http.StatusUnauthorized, client.ErrPINRejected},
+		{attendance.ErrDeviceDisabled, http.StatusForbidden, client.ErrDeviceDisabled},
+		{attendance.ErrEnrollmentCode, http.StatusForbidden, client.ErrEnrollmentCode},
+		{attendance.ErrSelfApproval, http.StatusForbidden, client.ErrSelfApproval},
+		{attendance.ErrPINLocked, http.StatusForbidden, client.ErrPINLocked},
+		{attendance.ErrTooOld, http.StatusUnprocessableEntity, client.ErrTooOld},
+		{storage.ErrUploadToken, http.StatusUnprocessableEntity, client.ErrUploadToken},
+		{attendance.ErrUnknownUser, http.StatusUnprocessableEntity, client.ErrUnknownUser},
+		{jobs.ErrActive, http.StatusConflict, client.ErrJobActive},
+		{jobs.ErrInvalidTransition, http.StatusConflict, client.ErrJobState},
+		{jobs.ErrNotFound, http.StatusNotFound, client.ErrNotFound},
+		{attendance.ErrStorage, http.StatusServiceUnavailable, client.ErrUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError, client.ErrInternal},
+	}
+	r := gin.New()
+	r.Use(i18n.Middleware())
+	r.GET("/v1/events/:id", func(c *gin.Context) {
+		var i int
+		fmt.Sscan(c.Param("id"), &i)
+		err := fmt.Errorf("handler: %w", tests[i].err)
+		c.JSON(errorStatus(err), errorBody(c, err))
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	c := newTestClient(t, srv.URL, "token")
+
+	for i, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			_, err := c.GetEvent(context.Background(), fmt.Sprint(i))
+			checkAPIError(t, err, tt.status, tt.sentinel)
+			var apiErr *client.Error
+			if errors.As(err, &apiErr) && apiErr.Message == "" {
+				t.Errorf("no localized message for %q", apiErr.Code)
+			}
+		})
+	}
+}
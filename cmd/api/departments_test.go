@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/testdb"
+)
+
+// Department-scoped admin tokens are refused on every admin route that is
+// not limited by department, before the route touches the database. Routes
+// under authGroup resolve the token's departments first and are checked in
+// TestDepartmentScopedTokenReads.
+func TestDepartmentScopedTokenRefusedOnUnscopedRoutes(t *testing.T) {
+	api := newTestAPI(t, unreachableDB)
+	scoped := api.token(t, "dept-admin", "admin", 1)
+
+	routes := []struct{ method, path, body string }{
+		{http.MethodGet, "/v1/admin/audit", ""},
+		{http.MethodGet, "/v1/admin/workers", ""},
+		{http.MethodGet, "/v1/admin/settings", ""},
+		{http.MethodGet, "/v1/admin/users/unknown", ""},
+		{http.MethodGet, "/v1/admin/events/e-1/timeline", ""},
+		{http.MethodGet, "/v1/admin/departments", ""},
+		{http.MethodPost, "/v1/admin/departments", `{"name":"Ops"}`},
+		// A scoped token must not mint itself a wider one.
+		{http.MethodPost, "/v1/admin/departments/tokens", `{"subject":"x","department_ids":[2]}`},
+		{http.MethodPut, "/v1/admin/employees/e-1/department", `{"department_id":2}`},
+		{http.MethodDelete, "/v1/admin/users/e-1/data", ""},
+		{http.MethodPost, "/v1/admin/api-keys", `{"name":"k","scopes":["read"]}`},
+	}
+	for _, rt := range routes {
+		status, body := api.do(t, rt.method, rt.path, scoped, rt.body)
+		if status != http.StatusForbidden {
+			t.Errorf("%s %s with a scoped token = %d %v, want 403", rt.method, rt.path, status, body)
+		}
+	}
+
+	// An unscoped admin passes the same check; the unreachable database
+	// answers instead.
+	unscoped := api.token(t, "admin", "admin")
+	if status, body := api.do(t, http.MethodGet, "/v1/admin/audit", unscoped, ""); status == http.StatusForbidden {
+		t.Fatalf("GET /v1/admin/audit with an unscoped token = 403 %v", body)
+	}
+}
+
+func responseUsers(t *testing.T, body map[string]any, key string) []string {
+	t.Helper()
+	items, ok := body[key].([]any)
+	if !ok {
+		t.Fatalf("response has no %q list: %v", key, body)
+	}
+	users := []string{}
+	for _, it := range items {
+		users = append(users, it.(map[string]any)["user_id"].(string))
+	}
+	slices.Sort(users)
+	return users
+}
+
+// A department-scoped token reads and lists the events of its departments
+// and of the departments below them, and nothing else.
+func TestDepartmentScopedTokenReads(t *testing.T) {
+	dbURL := testdb.URL(t)
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := attendance.NewRepository(db, 0)
+	ctx := context.Background()
+
+	// eng ── backend, and sales beside them.
+	eng, err := repo.CreateDepartment(ctx, attendance.Department{Name: "Engineering"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := repo.CreateDepartment(ctx, attendance.Department{Name: "Backend", ParentID: &eng.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sales, err := repo.CreateDepartment(ctx, attendance.Department{Name: "Sales"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	svc := attendance.NewService(repo, time.Minute)
+	events := map[string]string{}
+	for emp, dept := range map[string]int64{"e-eng": eng.ID, "e-backend": backend.ID, "e-sales": sales.ID} {
+		if err := repo.UpsertEmployee(ctx, emp, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetEmployeeDepartment(ctx, emp, &dept); err != nil {
+			t.Fatal(err)
+		}
+		evt, err := svc.CheckIn(ctx, emp, "kiosk-1", "", "", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[emp] = evt.ID
+	}
+
+	api := newTestAPI(t, dbURL)
+	engToken := api.token(t, "eng-admin", "admin", eng.ID)
+	backendToken := api.token(t, "backend-admin", "admin", backend.ID)
+
+	tests := []struct {
+		name  string
+		token string
+		want  []string
+	}{
+		{"department and its subdepartment", engToken, []string{"e-backend", "e-eng"}},
+		{"subdepartment only", backendToken, []string{"e-backend"}},
+		{"unscoped", api.token(t, "admin", "admin"), []string{"e-backend", "e-eng", "e-sales"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := api.do(t, http.MethodGet, "/v1/events", tt.token, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET /v1/events = %d %v", status, body)
+			}
+			if got := responseUsers(t, body, "events"); !slices.Equal(got, tt.want) {
+				t.Errorf("GET /v1/events users = %v, want %v", got, tt.want)
+			}
+
+			status, body = api.do(t, http.MethodGet, "/v2/events", tt.token, "")
+			if status == http.StatusOK {
+				if got := responseUsers(t, body, "events"); !slices.Equal(got, tt.want) {
+					t.Errorf("GET /v2/events users = %v, want %v", got, tt.want)
+				}
+			}
+
+			for emp, id := range events {
+				status, body := api.do(t, http.MethodGet, "/v1/events/"+id, tt.token, "")
+				want := http.StatusNotFound
+				if slices.Contains(tt.want, emp) {
+					want = http.StatusOK
+				}
+				if status != want {
+					t.Errorf("GET /v1/events/<%s's event> = %d %v, want %d", emp, status, body, want)
+				}
+			}
+
+			// Filtering by a user outside the scope lists nothing.
+			status, body = api.do(t, http.MethodGet, "/v1/events?user_id=e-sales", tt.token, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET /v1/events?user_id=e-sales = %d %v", status, body)
+			}
+			wantSales := []string{}
+			if slices.Contains(tt.want, "e-sales") {
+				wantSales = []string{"e-sales"}
+			}
+			if got := responseUsers(t, body, "events"); !slices.Equal(got, wantSales) {
+				t.Errorf("GET /v1/events?user_id=e-sales users = %v, want %v", got, wantSales)
+			}
+
+			// Device utilization counts only the check-ins in scope.
+			status, body = api.do(t, http.MethodGet, "/v1/reports/devices", tt.token, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET /v1/reports/devices = %d %v", status, body)
+			}
+			devices, _ := body["devices"].([]any)
+			if len(devices) != 1 || devices[0].(map[string]any)["total"] != float64(len(tt.want)) {
+				t.Errorf("GET /v1/reports/devices devices = %v, want kiosk-1 with %d check-ins", devices, len(tt.want))
+			}
+		})
+	}
+
+	// Unscoped routes outside the admin group refuse a scoped token too.
+	for _, rt := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/events/stream"},
+		{http.MethodDelete, "/v1/devices/kiosk-1"},
+	} {
+		if status, body := api.do(t, rt.method, rt.path, engToken, ""); status != http.StatusForbidden {
+			t.Errorf("%s %s with a scoped token = %d %v, want 403", rt.method, rt.path, status, body)
+		}
+	}
+}
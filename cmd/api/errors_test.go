@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"attendance/internal/attendance"
+	"attendance/internal/auth"
+	"attendance/internal/jobs"
+	"attendance/internal/settings"
+	"attendance/internal/storage"
+)
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"validation", attendance.ErrValidation, http.StatusBadRequest, "validation"},
+		{"api key spec", auth.ErrAPIKeySpec, http.StatusBadRequest, "validation"},
+		{"invalid setting", settings.ErrInvalid, http.StatusBadRequest, "validation"},
+		{"duplicate", attendance.ErrDuplicate, http.StatusConflict, "duplicate"},
+		{"invalid transition", attendance.ErrInvalidTransition, http.StatusConflict, "invalid_transition"},
+		{"job active", jobs.ErrActive, http.StatusConflict, "job_active"},
+		{"job state", jobs.ErrInvalidTransition, http.StatusConflict, "job_state"},
+		{"token revoked", attendance.ErrTokenRevoked, http.StatusUnauthorized, "token_revoked"},
+		{"pin rejected", attendance.ErrPINRejected, http.StatusUnauthorized, "pin_rejected"},
+		{"device locked out", attendance.ErrDeviceDisabled, http.StatusForbidden, "device_disabled"},
+		{"pin locked out", attendance.ErrPINLocked, http.StatusForbidden, "pin_locked"},
+		{"enrollment code", attendance.ErrEnrollmentCode, http.StatusForbidden, "enrollment_code"},
+		{"self approval", attendance.ErrSelfApproval, http.StatusForbidden, "self_approval"},
+		{"too old", attendance.ErrTooOld, http.StatusUnprocessableEntity, "too_old"},
+		{"upload token", storage.ErrUploadToken, http.StatusUnprocessableEntity, "upload_token"},
+		{"unknown user", attendance.ErrUnknownUser, http.StatusUnprocessableEntity, "unknown_user"},
+		{"not found", attendance.ErrNotFound, http.StatusNotFound, "not_found"},
+		{"no rows", sql.ErrNoRows, http.StatusNotFound, "not_found"},
+		{"api key not found", auth.ErrAPIKeyNotFound, http.StatusNotFound, "not_found"},
+		{"job not found", jobs.ErrNotFound, http.StatusNotFound, "not_found"},
+		{"storage", attendance.ErrStorage, http.StatusServiceUnavailable, "unavailable"},
+		{"storage timeout", fmt.Errorf("%w: %w", attendance.ErrStorage, context.DeadlineExceeded), http.StatusServiceUnavailable, "unavailable"},
+		{"timeout", context.DeadlineExceeded, http.StatusServiceUnavailable, "unavailable"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "internal"},
+	}
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("handler: %w", tt.err)
+			if got := errorStatus(err); got != tt.status {
+				t.Errorf("errorStatus = %d, want %d", got, tt.status)
+			}
+			body := errorBody(c, err)
+			if body["code"] != tt.code {
+				t.Errorf("code = %v, want %s", body["code"], tt.code)
+			}
+			if body["error"] != err.Error() {
+				t.Errorf("error = %v, want %q", body["error"], err)
+			}
+			if msg := body["message"]; msg == "" || msg == "error."+tt.code {
+				t.Errorf("no localized message for %s: %v", tt.code, msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/testdb"
+)
+
+// An expand value the API does not know is refused before the database is
+// asked, with the standard error envelope.
+func TestListEventsUnknownExpand(t *testing.T) {
+	api := newTestAPI(t, unreachableDB)
+	admin := api.token(t, "admin", "admin")
+	for _, expand := range []string{"bogus", "users", "user,bogus", "user;device", "USER"} {
+		status, body := api.do(t, http.MethodGet, "/v1/events?expand="+url.QueryEscape(expand), admin, "")
+		if status != http.StatusBadRequest || body["code"] != "validation" {
+			t.Errorf("expand=%s = %d %v, want 400 validation", expand, status, body)
+		}
+	}
+	// Known values get past validation to the database, which is down.
+	for _, expand := range []string{"user", "device", " user , device ", "user,"} {
+		if status, body := api.do(t, http.MethodGet, "/v1/events?expand="+url.QueryEscape(expand), admin, ""); status != http.StatusServiceUnavailable {
+			t.Errorf("expand=%s = %d %v, want 503 from the database", expand, status, body)
+		}
+	}
+}
+
+// Without expand an event keeps its lean shape; expand=user and expand=device
+// each add their own object, with nulls for what the records do not have.
+func TestListEventsExpand(t *testing.T) {
+	dbURL := testdb.URL(t)
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := attendance.NewRepository(db, 0)
+	ctx := context.Background()
+
+	eng, err := repo.CreateDepartment(ctx, attendance.Department{Name: "Engineering"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	name := "Ada Lovelace"
+	if err := repo.UpsertEmployee(ctx, "e-ada", &name); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetEmployeeDepartment(ctx, "e-ada", &eng.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetEmployeePhotoURL(ctx, "e-ada", "https://img.example/ada.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	// An employee with nothing but an id.
+	if err := repo.UpsertEmployee(ctx, "e-bare", nil); err != nil {
+		t.Fatal(err)
+	}
+	svc := attendance.NewService(repo, time.Minute)
+	for _, emp := range []string{"e-ada", "e-bare"} {
+		if _, err := svc.CheckIn(ctx, emp, "kiosk-1", "", "", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api := newTestAPI(t, dbURL)
+	admin := api.token(t, "admin", "admin")
+	tests := []struct {
+		expand            string
+		wantUser, wantDev bool
+	}{
+		{"", false, false},
+		{"user", true, false},
+		{"device", false, true},
+		{"user,device", true, true},
+	}
+	for _, tt := range tests {
+		t.Run("expand="+tt.expand, func(t *testing.T) {
+			path := "/v1/events"
+			if tt.expand != "" {
+				path += "?expand=" + tt.expand
+			}
+			status, body := api.do(t, http.MethodGet, path, admin, "")
+			if status != http.StatusOK {
+				t.Fatalf("GET %s = %d %v", path, status, body)
+			}
+			events, _ := body["events"].([]any)
+			if len(events) != 2 {
+				t.Fatalf("GET %s returned %d events, want 2", path, len(events))
+			}
+			for _, e := range events {
+				evt := e.(map[string]any)
+				if evt["id"] == nil || evt["status"] != attendance.StatusPending {
+					t.Errorf("event %v lacks the plain event fields", evt)
+				}
+				user, hasUser := evt["user"].(map[string]any)
+				if _, ok := evt["user"]; ok != tt.wantUser {
+					t.Errorf("%s: user present = %v, want %v", evt["user_id"], ok, tt.wantUser)
+				}
+				if _, ok := evt["device"]; ok != tt.wantDev {
+					t.Errorf("%s: device present = %v, want %v", evt["user_id"], ok, tt.wantDev)
+				}
+				if hasUser {
+					want := map[string]any{"name": nil, "department": nil, "photo_url": nil}
+					if evt["user_id"] == "e-ada" {
+						want = map[string]any{"name": "Ada Lovelace", "department": "Engineering", "photo_url": "https://img.example/ada.jpg"}
+					}
+					for k, v := range want {
+						if got, ok := user[k]; !ok || got != v {
+							t.Errorf("%s: user.%s = %v, want %v", evt["user_id"], k, got, v)
+						}
+					}
+				}
+				if device, ok := evt["device"].(map[string]any); ok && device["name"] != "Lobby" {
+					t.Errorf("%s: device = %v, want name Lobby", evt["user_id"], device)
+				}
+			}
+		})
+	}
+}
+
+// getETag sends GET path with If-None-Match, if given, and returns the
+// status, the ETag and the body.
+func (a *testAPI) getETag(t *testing.T, path, token, ifNoneMatch string) (int, string, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, a.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := a.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header.Get("ETag"), string(body)
+}
+
+// A poller that sends back the list's ETag gets an empty 304 until an event
+// is added or changes status. Status changes come from the worker, which
+// invalidates the cache itself, so the cache is off here.
+func TestListEventsETag(t *testing.T) {
+	dbURL := testdb.URL(t)
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := attendance.NewRepository(db, 0)
+	ctx := context.Background()
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	svc := attendance.NewService(repo, time.Minute)
+	evt, err := svc.CheckIn(ctx, "e-1", "kiosk-1", "", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := newTestAPI(t, dbURL, "CACHE_TTL", "0s")
+	admin := api.token(t, "admin", "admin")
+	const path = "/v1/events?device_id=kiosk-1"
+
+	status, etag, _ := api.getETag(t, path, admin, "")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("GET %s = %d with ETag %q", path, status, etag)
+	}
+	if status, got, body := api.getETag(t, path, admin, etag); status != http.StatusNotModified || got != etag || body != "" {
+		t.Errorf("unchanged list = %d, ETag %q, body %q; want an empty 304", status, got, body)
+	}
+	if status, got, _ := api.getETag(t, path+"&limit=10", admin, etag); status != http.StatusOK || got == etag {
+		t.Errorf("another page = %d with ETag %q, want 200 and its own tag", status, got)
+	}
+
+	if err := repo.UpdateEventStatus(ctx, evt.ID, attendance.StatusProcessed, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	status, updated, body := api.getETag(t, path, admin, etag)
+	if status != http.StatusOK || updated == etag || !strings.Contains(body, `"status":"processed"`) {
+		t.Fatalf("after a status update = %d, ETag %q, body %s; want 200 with the new status", status, updated, body)
+	}
+	if status, _, _ := api.getETag(t, path, admin, updated); status != http.StatusNotModified {
+		t.Errorf("unchanged after the update = %d, want 304", status)
+	}
+
+	if _, err := svc.CheckIn(ctx, "e-2", "kiosk-1", "", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if status, inserted, _ := api.getETag(t, path, admin, updated); status != http.StatusOK || inserted == updated {
+		t.Errorf("after an insert = %d with ETag %q, want 200 and a new tag", status, inserted)
+	}
+}
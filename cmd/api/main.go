@@ -1,35 +1,85 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"attendance/internal/anomaly"
 	"attendance/internal/attendance"
+	"attendance/internal/audit"
 	"attendance/internal/auth"
-	"attendance/internal/cloudinary"
+	"attendance/internal/cache"
 	"attendance/internal/config"
+	"attendance/internal/erasure"
+	"attendance/internal/faceaudit"
 	"attendance/internal/faceclient"
 	"attendance/internal/httpmiddleware"
+	"attendance/internal/i18n"
+	"attendance/internal/imagecheck"
+	"attendance/internal/jobs"
+	"attendance/internal/metrics"
+	"attendance/internal/notify"
+	"attendance/internal/notifybus"
+	"attendance/internal/outbox"
+	"attendance/internal/pdfreport"
+	"attendance/internal/push"
 	"attendance/internal/queue"
+	"attendance/internal/settings"
+	"attendance/internal/spool"
+	"attendance/internal/storage"
 	"attendance/internal/store"
+	"attendance/internal/tlsconfig"
+	"attendance/internal/version"
+	"attendance/internal/webui"
+	"attendance/internal/worker"
+	"attendance/web"
 )
 
 func main() {
-	cfg := config.Load()
+	checkConfig := flag.Bool("check-config", false, "validate and print the resolved configuration, then exit")
+	flag.Parse()
+
+	cfg, loadErr := config.Load()
+	if *checkConfig {
+		fmt.Printf("%+v\n", cfg.Redacted())
+		if err := errors.Join(loadErr, cfg.Validate()); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("config ok")
+		return
+	}
+	log.Printf("api %s", version.Get())
+	log.Printf("effective config: %+v", cfg.Redacted())
+	if err := errors.Join(loadErr, cfg.Validate()); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
 
 	// Set Gin mode based on environment
-	if cfg.Env == "production" || cfg.Env == "prod" {
+	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
@@ -38,84 +88,486 @@ func main() {
 	}
 }
 
+// server is the API's HTTP handler together with the background work that
+// runs alongside it.
+type server struct {
+	handler http.Handler
+	// stopStreams ends the event streams, which would otherwise hold a
+	// shutdown open.
+	stopStreams context.CancelFunc
+	closers     []func()
+}
+
+// Close lets the in-process worker drain and releases what newServer set up,
+// in reverse order.
+func (s *server) Close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
 func runHTTP(cfg config.App) error {
-	db, err := store.NewDB(cfg.DatabaseURL)
+	s, err := newServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Graceful shutdown
+	srv, err := newHTTPServer(context.Background(), cfg, s)
+	if err != nil {
+		s.Close()
+		return err
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
 	if err != nil {
-		log.Printf("warning: db not reachable: %v", err)
+		s.Close()
+		return err
+	}
+
+	// Start server in goroutine
+	go func() {
+		if srv.TLSConfig != nil {
+			log.Printf("Starting server on %s (TLS)", srv.Addr)
+		} else {
+			log.Printf("Starting server on %s", srv.Addr)
+		}
+		if err := serve(srv, ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	// Give outstanding requests 10 seconds to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced shutdown: %v", err)
+	}
+
+	// HTTP is stopped, so nothing new is queued; let the worker drain.
+	s.Close()
+
+	log.Println("Server exited")
+	return nil
+}
+
+// newHTTPServer wraps s in an http.Server for cfg.ListenAddr(). With
+// TLS_CERT_FILE and TLS_KEY_FILE set it terminates TLS itself and reloads the
+// certificate on SIGHUP until ctx is done.
+func newHTTPServer(ctx context.Context, cfg config.App, s *server) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:         cfg.ListenAddr(),
+		Handler:      s.handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: cfg.WriteTimeout(),
+		IdleTimeout:  60 * time.Second,
+	}
+	srv.RegisterOnShutdown(s.stopStreams)
+
+	if cfg.TLSEnabled() {
+		certs, err := tlsconfig.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs.ReloadOnSIGHUP(ctx)
+		srv.TLSConfig = tlsconfig.Server(certs)
+	}
+	return srv, nil
+}
+
+// serve accepts connections on ln until srv is shut down.
+func serve(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		// Certificates come from TLSConfig.GetCertificate.
+		return srv.ServeTLS(ln, "", "")
 	}
+	return srv.Serve(ln)
+}
+
+// newServer connects to the databases and builds the API's router and the
+// collaborators behind it. The caller must Close the server.
+func newServer(cfg config.App) (_ *server, err error) {
+	s := &server{}
 	defer func() {
-		if db != nil {
-			_ = db.Close()
+		if err != nil {
+			s.Close()
 		}
 	}()
 
-	redisClient := store.NewRedis(cfg.RedisAddr)
-	_ = faceclient.New(cfg.FaceServiceURL, cfg.FaceSkip) // used by worker, included for compile check
+	db, err := store.NewDB(cfg.DatabaseURL, store.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.RegisterMetrics(prometheus.DefaultRegisterer, "attendance"); err != nil {
+		log.Printf("warning: db metrics not registered: %v", err)
+	}
+	s.closers = append(s.closers, func() { _ = db.Close() })
 
-	var q queue.Queue
-	if cfg.QueueBackend == "memory" {
-		q = queue.NewInMemory(64)
-	} else {
-		q = queue.NewRedisQueue(redisClient.Client, "attendance:checkins")
+	redisClient, err := store.NewRedis(store.RedisOptions{
+		URL:      cfg.RedisURL,
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// In docker-compose Postgres and Redis may still be starting. With the
+	// check-in spool the API can start while Postgres is still down.
+	dbErr := store.WaitForDB(context.Background(), db, cfg.WaitForDepsTimeout)
+	if dbErr != nil && cfg.CheckinSpoolMax <= 0 {
+		return nil, dbErr
+	}
+	if err := store.WaitForRedis(context.Background(), redisClient, cfg.WaitForDepsTimeout); err != nil {
+		return nil, err
+	}
+	if dbErr != nil {
+		log.Printf("WARNING: starting in degraded mode, check-ins are spooled in Redis: %v", dbErr)
+	}
+
+	face := faceclient.New(cfg.FaceServiceURL, cfg.FaceSkip)
+	// The face service is optional at startup; check-ins wait in the queue.
+	if !face.Skip {
+		go func() {
+			probeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := face.Health(probeCtx); err != nil {
+				log.Printf("face service not reachable yet: %v", err)
+			} else {
+				log.Println("face service reachable")
+			}
+		}()
+	}
+
+	q, err := queue.FromConfig(cfg, redisClient.Client)
+	if err != nil {
+		return nil, err
 	}
 
-	repo := attendance.NewRepository(db.Client)
-	att := attendance.NewService(repo, 5*time.Minute)
+	repo := attendance.NewRepository(db.Client, cfg.DBQueryTimeout)
+	att := attendance.NewService(repo, cfg.DedupWindow)
+	att.Metrics = metrics.Checkins{}
+	att.DeviceLockout = cfg.DeviceLockout
+	att.DedupScope = cfg.DedupScope
+	att.ClockSkewTolerance = cfg.ClockSkewTolerance
+	att.OfflineMaxAge = cfg.OfflineCheckinMaxAge
+	att.RequireEnrollmentCode = cfg.RequireEnrollmentCode
+	att.PINLockAfter = cfg.PINLockAfter
+	att.StrictUsers = cfg.StrictUsers
+	employeeCache := attendance.NewEmployeeCache(repo, 0)
+	att.Users = employeeCache
+	reportLoc := cfg.ReportLocation()
 	ctx := context.Background()
+	settingsProvider := settings.NewProvider(db.Client, cfg.DBQueryTimeout, settings.Defaults(cfg), cfg.SettingsCacheTTL, redisClient.Client)
+	att.DedupWindows = settingsProvider
+	quality := attendance.QualityThresholds{
+		MaxBlur:        cfg.FaceMaxBlur,
+		MinFaceSize:    cfg.FaceMinSize,
+		RequireFrontal: cfg.FaceRequireFrontal,
+	}
+	failures := anomaly.NewTracker(redisClient.Client, cfg.DeviceFailureThreshold, cfg.DeviceFailureWindow)
+	eventCache := cache.NewEvents(repo, redisClient.Client, cfg.CacheTTL)
+	eventCache.ReportTTL = cfg.ReportCacheTTL
+	checkinClaims := worker.NewClaims(redisClient.Client, cfg.CheckinLeaseTTL, cfg.CheckinProcessedTTL)
+	faceAudit := faceaudit.NewRecorder(db.Client, 256)
+	s.closers = append(s.closers, faceAudit.Close)
+	pushSender, err := push.FromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	pusher := push.NewPusher(pushSender, repo, 256)
+	s.closers = append(s.closers, pusher.Close)
+	bus, err := notifybus.FromConfig(cfg, db.Client, redisClient.Client)
+	if err != nil {
+		return nil, err
+	}
+	// Event streams end when the server shuts down rather than holding it
+	// open.
+	streamCtx, stopStreams := context.WithCancel(ctx)
+	s.stopStreams = stopStreams
+	s.closers = append(s.closers, stopStreams)
+	shifts := attendance.NewShiftCache(repo, cfg.ShiftCacheTTL)
+	notifier := notify.NewNotifier(notify.FromConfig(cfg), 64)
+	s.closers = append(s.closers, notifier.Close)
+
+	// Degraded mode: check-ins wait in Redis while Postgres is unreachable
+	checkinSpool := spool.New(redisClient.Client, cfg.CheckinSpoolMax)
+	if dbErr != nil {
+		checkinSpool.MarkDegraded()
+	}
+	spoolCtx, stopSpool := context.WithCancel(ctx)
+	s.closers = append(s.closers, stopSpool)
+	go spool.Drainer{
+		Spool:    checkinSpool,
+		Ping:     db.Client.PingContext,
+		Interval: cfg.CheckinSpoolDrainInterval,
+		Persist: func(ctx context.Context, e spool.Entry) error {
+			evt, err := att.CheckInLate(ctx, attendance.Event{
+				ID: e.ID, UserID: e.UserID, DeviceID: e.DeviceID, Location: e.Location, ImageURL: e.ImageURL, ImageURLs: e.ImageURLs,
+			}, e.ClientTime, e.ReceivedAt)
+			if errors.Is(err, attendance.ErrDuplicate) && evt.ID == e.ID {
+				// Stored by an earlier pass that died before removing it; the
+				// outbox relay covers a publish that may not have happened.
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := q.Publish(ctx, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(evt.ID), Key: evt.ID}); err != nil {
+				log.Printf("queue publish failed, leaving event %s to the outbox relay: %v", evt.ID, err)
+			} else if err := repo.MarkOutboxDispatched(ctx, queue.Checkins, evt.ID); err != nil {
+				log.Printf("outbox mark dispatched failed for %s: %v", evt.ID, err)
+			}
+			eventCache.Invalidate(ctx)
+			return nil
+		},
+	}.Run(spoolCtx)
+
+	// Image storage (nil when not configured), and the signer handing out
+	// expiring image URLs when SIGNED_IMAGE_URLS is on
+	images, err := storage.FromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	imageURLs := storage.SignerFromConfig(cfg, images)
+
+	// Backlog gauges for Prometheus, also feeding the check-in high watermark
+	watermark := queue.NewWatermark(int64(cfg.QueueHighWatermark))
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	s.closers = append(s.closers, stopMonitor)
+	go queue.Monitor(monitorCtx, q, 15*time.Second, watermark.Observe)
+	go settingsProvider.Watch(monitorCtx)
+	if bus != nil {
+		go bus.Run(monitorCtx)
+	}
 
-	// Cloudinary client (nil when not configured)
-	var cdnClient *cloudinary.Client
-	if cfg.CloudinaryCloudName != "" && cfg.CloudinaryAPIKey != "" && cfg.CloudinaryAPISecret != "" {
-		cdnClient = cloudinary.New(cfg.CloudinaryCloudName, cfg.CloudinaryAPIKey, cfg.CloudinaryAPISecret, cfg.CloudinaryFolder)
-		log.Println("Cloudinary configured:", cfg.CloudinaryCloudName)
+	// Face pipeline collaborators, shared by the in-process worker and
+	// SYNC_FACE_PROCESSING
+	workerDeps := worker.Deps{
+		Repo:            repo,
+		Face:            face,
+		Queue:           q,
+		Quality:         quality,
+		MatchThreshold:  cfg.FaceMatchThreshold,
+		Verify:          cfg.VerifyOnCheckin,
+		RequireLiveness: cfg.RequireLiveness,
+		Settings:        settingsProvider,
+		Failures:        failures,
+		Shifts:          shifts,
+		Notifier:        notifier,
+		NotifyTo:        cfg.AdminNotifyEmails,
+		Cache:           eventCache,
+		Claims:          checkinClaims,
+		FaceAudit:       faceAudit,
+		Hooks:           worker.HooksFromConfig(cfg, pusher, bus, repo),
+		ImageURLs:       imageURLs,
+		ReenrollRate:    cfg.ReenrollRate,
+	}
+	jobStore := jobs.NewStore(db.Client, cfg.DBQueryTimeout)
+
+	// Optional in-process worker sharing this process's queue instance
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	s.closers = append(s.closers, stopWorker)
+	workerDone := make(chan struct{})
+	if cfg.RunWorkerInProcess {
+		dispatcher := jobs.NewDispatcher(jobStore, cfg.JobPollInterval, cfg.JobLease)
+		dispatcher.Handle(worker.JobFaceReenroll, worker.Reenroll(workerDeps))
+		workerDeps.Jobs = dispatcher
+		go dispatcher.Run(workerCtx)
+		go func() {
+			defer close(workerDone)
+			if err := worker.Run(workerCtx, workerDeps); err != nil {
+				log.Printf("in-process worker failed: %v", err)
+			}
+		}()
+		if cfg.OutboxRelayInterval > 0 {
+			go outbox.Relay{
+				Repo:      repo,
+				Queue:     q,
+				Interval:  cfg.OutboxRelayInterval,
+				Grace:     cfg.OutboxGrace,
+				BatchSize: cfg.OutboxBatchSize,
+				Retain:    cfg.OutboxRetention,
+			}.Run(workerCtx)
+		}
+		if cfg.ReconcileInterval > 0 {
+			go worker.Reconciler{
+				Repo:       repo,
+				Queue:      q,
+				StaleAfter: cfg.ReconcileStaleAfter,
+				BatchSize:  cfg.ReconcileBatchSize,
+			}.Schedule(workerCtx, cfg.ReconcileInterval)
+		}
+		log.Println("In-process worker enabled")
 	} else {
-		log.Println("Cloudinary not configured (CLOUDINARY_CLOUD_NAME / API_KEY / API_SECRET not set)")
+		close(workerDone)
+	}
+
+	// Client-supplied image URLs are fetched by the face service, so only
+	// our own storage (and configured hosts) may be referenced.
+	imageCheck := imagecheck.FromConfig(cfg)
+	uploadTokens := storage.NewUploadTokens(redisClient.Client, cfg.UploadTokenTTL)
+	if imageURLs != nil {
+		imageCheck.FetchURL = imageURLs.URL
+	}
+	if len(imageCheck.Allowed) == 0 {
+		log.Println("WARNING: no image URL allow-list (image storage unconfigured, IMAGE_URL_ALLOWED_HOSTS empty); any public https URL is accepted")
 	}
 
+	auditLog := audit.NewLogger(db.Client, 256)
+	s.closers = append(s.closers, auditLog.Close)
+
 	r := gin.New()
 
 	// Recovery middleware
 	r.Use(gin.Recovery())
 
+	// Request IDs for log and audit correlation
+	r.Use(httpmiddleware.RequestID())
+
 	// Custom logger
 	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{
 		SkipPaths: []string{"/healthz", "/metrics"},
 	}))
 
 	// CORS middleware
-	r.Use(corsMiddleware())
+	r.Use(httpmiddleware.CORS(httpmiddleware.CORSConfig{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedMethods: cfg.CORSAllowedMethods,
+		AllowedHeaders: cfg.CORSAllowedHeaders,
+		MaxAge:         24 * time.Hour,
+	}))
 
 	// Security headers
-	r.Use(securityHeaders())
+	r.Use(securityHeaders(cfg.TLSEnabled()))
+
+	// Accept-Language negotiation for translated messages
+	r.Use(i18n.Middleware())
 
-	// Rate limiting
-	r.Use(httpmiddleware.NewSimpleTokenBucket(cfg.RateLimitPerMin, cfg.RateLimitPerMin).GinMiddleware())
+	// Rate limiting; scrapes, probes and preflights are exempt
+	r.Use(httpmiddleware.NewSimpleTokenBucket(cfg.RateLimitPerMin, cfg.RateLimitPerMin, httpmiddleware.EvictionOptions{
+		IdleTTL:    cfg.RateLimitIdleTTL,
+		MaxEntries: cfg.RateLimitMaxKeys,
+	}).Exempt(cfg.RateLimitExempt...).GinMiddleware())
 
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	// Request timeouts: a default here, overridden for reads and uploads below
+	r.Use(httpmiddleware.Timeout(cfg.RequestTimeout))
+	reads := httpmiddleware.Timeout(cfg.ReadRequestTimeout)
+	uploads := httpmiddleware.Timeout(cfg.UploadRequestTimeout)
 
-	r.GET("/healthz", func(c *gin.Context) {
+	// Request body caps: a default here, raised for image uploads below
+	r.Use(httpmiddleware.BodyLimit(cfg.MaxBodyBytes))
+	uploadBody := httpmiddleware.BodyLimit(cfg.MaxUploadBytes)
+
+	promHandler := gin.WrapH(promhttp.Handler())
+	r.GET("/metrics", promHandler)
+	r.HEAD("/metrics", promHandler)
+
+	r.GET("/healthz", reads, func(c *gin.Context) {
 		redisHealthy := redisClient.Healthy(c.Request.Context())
-		dbHealthy := db != nil
+		dbHealthy := db.Client.PingContext(c.Request.Context()) == nil
 		status := http.StatusOK
-		if !redisHealthy || !dbHealthy {
+		resp := gin.H{"status": "ok", "redis": redisHealthy, "db": dbHealthy}
+		switch {
+		case !redisHealthy:
+			status = http.StatusServiceUnavailable
+		case !dbHealthy && checkinSpool != nil:
+			// Check-ins are still accepted into the spool.
+			resp["status"] = "degraded"
+			if n, err := checkinSpool.Len(c.Request.Context()); err == nil {
+				resp["spooled_checkins"] = n
+			}
+		case !dbHealthy:
 			status = http.StatusServiceUnavailable
 		}
-		c.JSON(status, gin.H{"status": "ok", "redis": redisHealthy, "db": dbHealthy})
+		// Backends with their own connection (Kafka) are reported separately.
+		if p, ok := q.(queue.Pinger); ok {
+			queueHealthy := p.Ping(c.Request.Context()) == nil
+			resp["queue"] = queueHealthy
+			if !queueHealthy {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		// A memory queue filling up with no consumer in this process means
+		// the worker is not running here; the messages will never be handled.
+		if mq, ok := q.(*queue.InMemory); ok {
+			depth := mq.Depth()
+			resp["queue_depth"] = depth
+			if depth > 0 && mq.Consumers() == 0 {
+				resp["warnings"] = []string{fmt.Sprintf("memory queue holds %d messages but no consumer is attached in this process", depth)}
+			}
+		}
+		c.JSON(status, resp)
+	})
+
+	// Build info, unauthenticated so ops can see which build a pod runs.
+	r.GET("/v1/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, version.Get())
+	})
+
+	// Bearer tokens of deactivated devices, refused until they expire
+	denylist := auth.NewDenylist(redisClient.Client, cfg.AccessTTL)
+	// Wrong PINs per user, throttled before the lockout kicks in
+	pinLimiter := auth.NewPINLimiter(redisClient.Client, cfg.PINMaxFailures, cfg.PINFailureWindow)
+
+	// An employee chooses their own PIN with a one-time link token from
+	// POST /v1/admin/employees/:id/pin-link; the token is the credential.
+	r.POST("/v1/pin-links/:token", func(c *gin.Context) {
+		var req struct {
+			PIN string `json:"pin" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		employeeID, err := repo.RedeemPINLink(c.Request.Context(), c.Param("token"), req.PIN)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if err := pinLimiter.Reset(c.Request.Context(), employeeID); err != nil {
+			log.Printf("PIN limiter reset for %s failed: %v", employeeID, err)
+		}
+		auditLog.Record(c.Request.Context(), employeeID, "employee.pin_set", "employee", employeeID, gin.H{"via": "link"})
+		c.Status(http.StatusNoContent)
 	})
 
 	r.POST("/v1/devices/register", func(c *gin.Context) {
 		var req struct {
 			DeviceID string `json:"device_id" binding:"required"`
+			Name     string `json:"name"`
+			// EnrollmentCode is a one-time code from POST /v1/admin/devices/provision.
+			EnrollmentCode string `json:"enrollment_code"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		if err := att.RegisterDevice(c.Request.Context(), req.DeviceID); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		reprovisioned, err := att.RegisterDevice(c.Request.Context(), req.DeviceID, req.Name, req.EnrollmentCode)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
 			return
 		}
+		if reprovisioned {
+			// Tokens from before the deactivation stay revoked; the new
+			// ones must not be caught by the same denylist entry.
+			if err := denylist.Allow(c.Request.Context(), "device", req.DeviceID); err != nil {
+				log.Printf("device %s: clear denylist failed: %v", req.DeviceID, err)
+			}
+		}
 
 		tokens, err := auth.Issue(req.DeviceID, "device", cfg.JWTIssuer, cfg.JWTSigningKey, cfg.AccessTTL, cfg.RefreshTTL)
 		if err != nil {
@@ -123,7 +575,11 @@ func runHTTP(cfg config.App) error {
 			return
 		}
 
-		_ = repo.SaveRefreshToken(c.Request.Context(), req.DeviceID, tokens.RefreshToken, tokens.RefreshExp)
+		// /v1/auth/rotate only accepts refresh tokens it has on record.
+		if err := repo.SaveRefreshToken(c.Request.Context(), req.DeviceID, tokens.RefreshToken, tokens.RefreshExp); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
 
 		c.JSON(http.StatusCreated, gin.H{
 			"access_token":  tokens.AccessToken,
@@ -132,213 +588,2567 @@ func runHTTP(cfg config.App) error {
 		})
 	})
 
-	// Upload endpoint — uploads a base64 image or multipart file to Cloudinary
-	// Returns the public Cloudinary URL so the caller can use it in /v1/checkins
-	authGroup := r.Group("/v1", auth.DeviceAuth(cfg.JWTSigningKey, cfg.JWTIssuer))
-
-	authGroup.POST("/upload", func(c *gin.Context) {
-		if cdnClient == nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "image storage not configured"})
+	// Upload endpoint — uploads a base64 image or multipart file to the image store
+	// Returns the public URL so the caller can use it in /v1/checkins
+	// Server-to-server callers may send an X-API-Key instead of a bearer token;
+	// keys are limited to reads, or reads and writes, by their scopes.
+	apiKeys := auth.NewAPIKeys(db.Client)
+	authenticate := auth.Authenticate(cfg.JWTSigningKey, cfg.JWTIssuer, apiKeys, denylist)
+	// A department-scoped admin token reads only the employees of its
+	// departments and of the departments below them; the repository applies
+	// the scope carried by the request context.
+	scopeDepartments := func(c *gin.Context) {
+		claims := auth.ClaimsFrom(c)
+		if !claims.DepartmentScoped() {
+			c.Next()
 			return
 		}
+		tree, err := repo.DepartmentTree(c.Request.Context(), claims.DeptIDs)
+		if err != nil {
+			c.AbortWithStatusJSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.Request = c.Request.WithContext(attendance.WithDepartments(c.Request.Context(), tree))
+		c.Next()
+	}
+	authGroup := r.Group("/v1", authenticate, scopeDepartments, auth.MethodScope())
 
-		contentType := c.ContentType()
-		var result *cloudinary.UploadResult
-		var err error
-
-		switch {
-		case strings.Contains(contentType, "multipart/form-data"):
-			// Multipart file upload
-			file, header, ferr := c.Request.FormFile("file")
-			if ferr != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "file field required"})
-				return
-			}
-			defer file.Close()
-			data, ferr := io.ReadAll(file)
-			if ferr != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "read file failed"})
-				return
-			}
-			result, err = cdnClient.UploadBytes(data, header.Filename)
+	authGroup.POST("/upload", uploads, uploadBody, func(c *gin.Context) {
+		if images == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": storage.ErrNotConfigured.Error()})
+			return
+		}
 
-		default:
+		var (
+			data        []byte
+			filename    = "upload.jpg"
+			contentType string
+			ok          bool
+		)
+		if strings.Contains(c.ContentType(), "multipart/form-data") {
+			data, filename, contentType, ok = readMultipartImage(c)
+		} else {
 			// JSON body with base64 data URL
 			var body struct {
 				Data string `json:"data" binding:"required"`
 			}
-			if berr := c.ShouldBindJSON(&body); berr != nil {
+			if err := c.ShouldBindJSON(&body); err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "provide {\"data\": \"<base64 data URL>\"}"})
 				return
 			}
-			result, err = cdnClient.UploadBase64(body.Data)
+			data, contentType, ok = decodeImage(c, body.Data)
+		}
+		if !ok {
+			return
+		}
+
+		// Reject images without a face before paying to store them; the
+		// kiosk reprompts instead of submitting a check-in that cannot match.
+		// An unreachable face service lets the upload through.
+		facesDetected := -1
+		if cfg.UploadRequireFace {
+			n, err := face.DetectFaces(c.Request.Context(), data)
+			switch {
+			case err != nil:
+				log.Printf("upload face check failed: %v", err)
+			case n == 0:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no face detected", "code": "no_face",
+					"faces_detected": 0, "message": i18n.From(c).T("error.no_face")})
+				return
+			default:
+				facesDetected = n
+			}
 		}
 
+		obj, err := images.Upload(c.Request.Context(), data, filename, contentType)
 		if err != nil {
-			log.Printf("cloudinary upload failed: %v", err)
+			log.Printf("image upload failed: %v", err)
 			c.JSON(http.StatusBadGateway, gin.H{"error": "image upload failed"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"url":       result.SecureURL,
-			"public_id": result.PublicID,
-			"width":     result.Width,
-			"height":    result.Height,
-			"bytes":     result.Bytes,
-		})
+		resp := gin.H{
+			"url":          obj.URL,
+			"original_url": obj.OriginalURL,
+			"public_id":    obj.Key,
+			"width":        obj.Width,
+			"height":       obj.Height,
+			"bytes":        obj.Bytes,
+		}
+		if facesDetected >= 0 {
+			resp["faces_detected"] = facesDetected
+		}
+		// The token binds the image to this device for one check-in.
+		token, err := uploadTokens.Issue(c.Request.Context(), auth.ClaimsFrom(c).Subject, obj)
+		switch {
+		case err == nil:
+			resp["upload_token"] = token
+			resp["upload_token_expires_in"] = int(uploadTokens.TTL().Seconds())
+		case cfg.BindUploads:
+			log.Printf("upload token issue failed: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "upload token could not be issued"})
+			return
+		default:
+			log.Printf("upload token issue failed: %v", err)
+		}
+		c.JSON(http.StatusOK, resp)
 	})
 
+	// bindImage resolves the image of a check-in from deviceID. An upload
+	// token is claimed for the URL it was issued for; with BIND_UPLOADS a raw
+	// image_url is refused. bound reports whether the URL came from a token,
+	// which needs no further validation, and then the caller must settle the
+	// token with settleTokens.
+	bindImage := func(ctx context.Context, deviceID, imageURL, token string) (url string, bound bool, err error) {
+		switch {
+		case token != "" && imageURL != "":
+			return "", false, fmt.Errorf("%w: send image_url or upload_token, not both", attendance.ErrValidation)
+		case token != "":
+			url, err := uploadTokens.Claim(ctx, token, deviceID)
+			if err != nil && !errors.Is(err, storage.ErrUploadToken) {
+				return "", false, fmt.Errorf("%w: %v", attendance.ErrStorage, err)
+			}
+			return url, err == nil, err
+		case cfg.BindUploads && imageURL != "":
+			return "", false, fmt.Errorf("%w: image_url is not accepted; send the upload_token from /v1/upload", storage.ErrUploadToken)
+		}
+		return imageURL, false, nil
+	}
+
+	// settleTokens uses up the upload tokens claimed for a check-in once it is
+	// stored, or hands them back when it is refused so the kiosk can retry
+	// with them. It runs detached, so a client hanging up does not strand the
+	// tokens.
+	settleTokens := func(ctx context.Context, tokens []string, stored bool) {
+		if len(tokens) == 0 {
+			return
+		}
+		ctx = context.WithoutCancel(ctx)
+		if stored {
+			if err := uploadTokens.Commit(ctx, tokens...); err != nil {
+				log.Printf("use up upload tokens failed: %v", err)
+			}
+		} else if err := uploadTokens.Release(ctx, tokens...); err != nil {
+			log.Printf("release upload tokens failed: %v", err)
+		}
+	}
+
+	type boundImage struct {
+		url   string
+		bound bool
+		token string
+	}
+	// boundTokens lists the upload tokens claimed for images.
+	boundTokens := func(images []boundImage) []string {
+		var tokens []string
+		for _, img := range images {
+			if img.bound {
+				tokens = append(tokens, img.token)
+			}
+		}
+		return tokens
+	}
+	// bindImages resolves the images of a check-in sent as one image_url or
+	// upload_token, or as lists of up to MaxCheckinImages of either. When one
+	// of them is refused, the tokens claimed before it are handed back.
+	bindImages := func(ctx context.Context, deviceID, imageURL, token string, imageURLs, tokens []string) (_ []boundImage, err error) {
+		n := len(imageURLs) + len(tokens)
+		switch {
+		case n > 0 && (imageURL != "" || token != ""):
+			return nil, fmt.Errorf("%w: send image_url or image_urls, not both", attendance.ErrValidation)
+		case n > attendance.MaxCheckinImages:
+			return nil, fmt.Errorf("%w: a check-in carries at most %d images, got %d", attendance.ErrValidation, attendance.MaxCheckinImages, n)
+		case n == 0:
+			url, bound, err := bindImage(ctx, deviceID, imageURL, token)
+			if err != nil || url == "" {
+				return nil, err
+			}
+			return []boundImage{{url, bound, token}}, nil
+		}
+		images := make([]boundImage, 0, n)
+		defer func() {
+			if err != nil {
+				settleTokens(ctx, boundTokens(images), false)
+			}
+		}()
+		for _, u := range imageURLs {
+			if u == "" {
+				return nil, fmt.Errorf("%w: image_urls holds an empty URL", attendance.ErrValidation)
+			}
+			url, bound, err := bindImage(ctx, deviceID, u, "")
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, boundImage{url, bound, ""})
+		}
+		for _, t := range tokens {
+			if t == "" {
+				return nil, fmt.Errorf("%w: upload_tokens holds an empty token", attendance.ErrValidation)
+			}
+			url, bound, err := bindImage(ctx, deviceID, "", t)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, boundImage{url, bound, t})
+		}
+		return images, nil
+	}
+
+	// announce publishes a stored check-in for live dashboards; the notify
+	// hook announces its final status.
+	announce := func(ctx context.Context, evt attendance.Event) {
+		if bus == nil {
+			return
+		}
+		if err := notifybus.PublishEvent(ctx, bus, notifybus.EventUpdate{
+			ID: evt.ID, Status: evt.Status, UserID: evt.UserID, DeviceID: evt.DeviceID, When: evt.When,
+		}); err != nil {
+			log.Printf("announce event %s failed: %v", evt.ID, err)
+		}
+	}
+
+	// Every client timestamp a device sends is an observation of its clock
+	// skew, which corrects the times of its later check-ins.
+	recordClockSkew := func(ctx context.Context, deviceID string, clientTime, receivedAt time.Time) {
+		if clientTime.IsZero() {
+			return
+		}
+		if err := repo.RecordClockSkew(ctx, deviceID, clientTime.Sub(receivedAt)); err != nil {
+			log.Printf("record clock skew of device %s failed: %v", deviceID, err)
+		}
+	}
+
 	authGroup.POST("/checkins", func(c *gin.Context) {
 		var req struct {
 			UserID   string `json:"user_id" binding:"required"`
 			DeviceID string `json:"device_id" binding:"required"`
 			Location string `json:"location"`
 			ImageURL string `json:"image_url"`
+			// UploadToken, from /v1/upload, stands in for ImageURL; required
+			// instead of it with BIND_UPLOADS.
+			UploadToken string `json:"upload_token"`
+			// ImageURLs or UploadTokens send up to three frames instead of
+			// one; the worker keeps the best.
+			ImageURLs    []string `json:"image_urls"`
+			UploadTokens []string `json:"upload_tokens"`
+			// ClientTimestamp is when the kiosk saw the face; used as the
+			// check-in time when close enough to server time.
+			ClientTimestamp *time.Time `json:"client_timestamp"`
+			// AuthMethod "pin" checks the user in by PIN, without a photo.
+			AuthMethod string `json:"auth_method" binding:"omitempty,oneof=face pin"`
+			PIN        string `json:"pin"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		pinAuth := req.AuthMethod == attendance.AuthMethodPIN
+		if pinAuth {
+			var err error
+			switch {
+			case !cfg.PINCheckin:
+				err = fmt.Errorf("%w: PIN check-in is disabled", attendance.ErrValidation)
+			case req.PIN == "":
+				err = fmt.Errorf("%w: pin is required with auth_method pin", attendance.ErrValidation)
+			case req.ImageURL != "" || req.UploadToken != "" || len(req.ImageURLs) > 0 || len(req.UploadTokens) > 0:
+				err = fmt.Errorf("%w: image_url is not used with auth_method pin", attendance.ErrValidation)
+			}
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+		}
 
 		claimsAny, _ := c.Get("claims")
 		claims, _ := claimsAny.(auth.Claims)
 		if claims.Subject != "" && claims.Subject != req.DeviceID {
-			c.JSON(http.StatusForbidden, gin.H{"error": "device mismatch"})
+			c.JSON(http.StatusForbidden, gin.H{"error": "device mismatch", "code": "device_mismatch",
+				"message": i18n.From(c).T("error.device_mismatch")})
 			return
 		}
 
-		evt, err := att.CheckIn(c.Request.Context(), req.UserID, req.DeviceID, req.Location, req.ImageURL)
+		images, err := bindImages(c.Request.Context(), req.DeviceID, req.ImageURL, req.UploadToken, req.ImageURLs, req.UploadTokens)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(errorStatus(err), errorBody(c, err))
 			return
 		}
-
-		if err := q.Publish(ctx, queue.Message{Type: "checkin", Body: []byte(evt.ID)}); err != nil {
-			log.Printf("queue publish failed: %v", err)
+		// The upload tokens are used up only once the check-in is stored;
+		// every refusal below hands them back for the retry.
+		stored := false
+		defer func() { settleTokens(c.Request.Context(), boundTokens(images), stored) }()
+		var imageURLs []string
+		for _, img := range images {
+			if !img.bound {
+				if err := imageCheck.Check(c.Request.Context(), img.url); err != nil {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "image_rejected",
+						"message": i18n.From(c).T("error.image_rejected")})
+					return
+				}
+			}
+			imageURLs = append(imageURLs, img.url)
+		}
+		if len(imageURLs) > 0 {
+			req.ImageURL = imageURLs[0]
 		}
 
-		c.JSON(http.StatusAccepted, gin.H{"event_id": evt.ID, "when": evt.When, "status": evt.Status})
-	})
+		receivedAt := time.Now()
+		var clientTime time.Time
+		if req.ClientTimestamp != nil {
+			clientTime = *req.ClientTimestamp
+		}
 
-	authGroup.GET("/events", func(c *gin.Context) {
-		deviceID := c.Query("device_id")
-		userID := c.Query("user_id")
-		limit, offset := 50, 0
-		if v := c.Query("limit"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				limit = parsed
+		// PIN check-ins are verified here and stored processed; they are not
+		// spooled, since the PIN cannot be checked without Postgres.
+		if pinAuth {
+			ctx := c.Request.Context()
+			if wait, err := pinLimiter.Blocked(ctx, req.UserID); err != nil {
+				log.Printf("PIN limiter lookup for %s failed: %v", req.UserID, err)
+			} else if wait > 0 {
+				secs := int(math.Ceil(wait.Seconds()))
+				c.Header("Retry-After", strconv.Itoa(secs))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong PINs", "code": "pin_rate_limited",
+					"message": i18n.From(c).T("error.pin_rate_limited"), "retry_after": secs})
+				return
 			}
-		}
-		if v := c.Query("offset"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil {
-				offset = parsed
+			evt, err := att.CheckInWithPIN(ctx, req.UserID, req.DeviceID, req.Location, req.PIN, clientTime)
+			switch {
+			case errors.Is(err, attendance.ErrPINRejected):
+				if err := pinLimiter.Fail(ctx, req.UserID); err != nil {
+					log.Printf("PIN limiter update for %s failed: %v", req.UserID, err)
+				}
+			case err == nil, errors.Is(err, attendance.ErrDuplicate):
+				if err := pinLimiter.Reset(ctx, req.UserID); err != nil {
+					log.Printf("PIN limiter reset for %s failed: %v", req.UserID, err)
+				}
+				recordClockSkew(ctx, req.DeviceID, clientTime, receivedAt)
 			}
-		}
-		events, err := repo.ListEvents(c.Request.Context(), deviceID, userID, limit, offset)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if errors.Is(err, attendance.ErrDuplicate) {
+				body := errorBody(c, err)
+				body["event_id"], body["when"], body["status"], body["duplicate"] = evt.ID, evt.When, evt.Status, true
+				c.JSON(http.StatusConflict, body)
+				return
+			}
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			worker.RecordLateness(ctx, workerDeps, evt)
+			metrics.EventFinalized(evt.Status)
+			// Hooks may be slow (webhooks); the kiosk does not wait for them.
+			go workerDeps.Hooks.Run(context.WithoutCancel(ctx), evt, worker.Outcome{Status: evt.Status})
+			eventCache.Invalidate(ctx)
+			c.JSON(http.StatusOK, gin.H{"event_id": evt.ID, "when": evt.When, "status": evt.Status,
+				"match_score": nil, "auth_method": evt.AuthMethod, "duplicate": false})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"events": events})
-	})
 
-	// List employees
-	authGroup.GET("/employees", func(c *gin.Context) {
-		employees, err := repo.ListEmployees(c.Request.Context())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// Backpressure: refuse new work while the queue is saturated, telling
+		// the kiosk when to retry.
+		refuseCheckin := func(status int, reason, code, msg string) {
+			queue.CountRejection(reason)
+			secs := int(math.Ceil(cfg.QueueRetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(secs))
+			c.JSON(status, gin.H{"error": msg, "code": code, "message": i18n.From(c).T("error." + code), "retry_after": secs})
+		}
+		if watermark.Exceeded() {
+			refuseCheckin(http.StatusTooManyRequests, queue.RejectHighWatermark, "queue_saturated", "check-in queue is backed up")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"employees": employees})
-	})
 
-	// Get single employee
-	authGroup.GET("/employees/:id", func(c *gin.Context) {
-		employeeID := c.Param("id")
-		emp, err := repo.GetEmployee(c.Request.Context(), employeeID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// With Postgres down the check-in is spooled: the client gets the id
+		// the event will be stored under once the database is back.
+		spoolCheckin := func() {
+			entry := spool.Entry{
+				UserID: req.UserID, DeviceID: req.DeviceID, Location: req.Location, ImageURL: req.ImageURL, ClientTime: clientTime,
+			}
+			if len(imageURLs) > 1 {
+				entry.ImageURLs = imageURLs
+			}
+			e, err := checkinSpool.Push(c.Request.Context(), entry)
+			if err != nil {
+				log.Printf("spool check-in for %s failed: %v", req.UserID, err)
+				c.JSON(http.StatusServiceUnavailable, errorBody(c, fmt.Errorf("%w: %v", attendance.ErrStorage, err)))
+				return
+			}
+			stored = true
+			c.JSON(http.StatusAccepted, gin.H{"event_id": e.ID, "when": e.ReceivedAt, "status": attendance.StatusPending,
+				"duplicate": false, "provisional": true})
+		}
+		if checkinSpool.Degraded() {
+			spoolCheckin()
 			return
 		}
-		if emp == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "employee not found"})
+		evt, err := att.CheckInImages(c.Request.Context(), req.UserID, req.DeviceID, req.Location, imageURLs, clientTime)
+		// Only an unreachable database spools; a client that hung up gets
+		// nothing stored on its behalf.
+		if checkinSpool != nil && c.Request.Context().Err() == nil && attendance.IsUnavailable(err) {
+			checkinSpool.MarkDegraded()
+			spoolCheckin()
+			return
+		}
+		if err == nil || errors.Is(err, attendance.ErrDuplicate) {
+			recordClockSkew(c.Request.Context(), req.DeviceID, clientTime, receivedAt)
+		}
+		if errors.Is(err, attendance.ErrDuplicate) {
+			body := errorBody(c, err)
+			body["event_id"], body["when"], body["status"], body["duplicate"] = evt.ID, evt.When, evt.Status, true
+			c.JSON(http.StatusConflict, body)
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
 			return
 		}
-		c.JSON(http.StatusOK, emp)
-	})
-
-	r.StaticFile("/", "web/index.html")
-	r.Static("/static", "web/static")
 
-	// Graceful shutdown
-	srv := &http.Server{
-		Addr:         ":" + cfg.HTTPPort,
-		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		// SYNC_FACE_PROCESSING: answer with the outcome when the face
+		// pipeline finishes in time, else queue the event as usual. A
+		// finished event is not announced as pending: the notify hook has
+		// already announced its final status.
+		if cfg.SyncFaceProcessing && evt.ImageURL != "" {
+			syncCtx, cancel := context.WithTimeout(c.Request.Context(), cfg.SyncFaceTimeout)
+			err := worker.ProcessEvent(syncCtx, workerDeps, evt.ID)
+			cancel()
+			if err != nil {
+				log.Printf("event %s: inline face processing unfinished, queueing: %v", evt.ID, err)
+			} else if done, err := repo.GetEvent(c.Request.Context(), evt.ID); err != nil {
+				log.Printf("event %s: reload after inline processing failed, queueing: %v", evt.ID, err)
+			} else if attendance.IsTerminal(done.Status) {
+				if err := repo.MarkOutboxDispatched(c.Request.Context(), queue.Checkins, evt.ID); err != nil {
+					log.Printf("outbox mark dispatched failed for %s: %v", evt.ID, err)
+				}
+				stored = true
+				c.JSON(http.StatusOK, gin.H{"event_id": done.ID, "when": done.When, "status": done.Status,
+					"match_score": done.MatchScore, "duplicate": false})
+				return
+			}
+		}
+
+		// Fast path. If the publish fails the event is withdrawn and the
+		// client retries, rather than getting a 202 for work that may sit in
+		// the outbox; if the relay got to it first, it stands.
+		if err := queue.PublishDetached(publishContext(c), q, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(evt.ID), Key: evt.ID}, cfg.QueuePublishTimeout); err != nil {
+			log.Printf("queue publish failed for event %s: %v", evt.ID, err)
+			discarded, derr := repo.DiscardPendingCheckin(context.WithoutCancel(c.Request.Context()), evt.ID)
+			if derr != nil {
+				log.Printf("discard unqueued event %s failed, leaving it to the outbox relay: %v", evt.ID, derr)
+			}
+			if discarded {
+				eventCache.Invalidate(c.Request.Context())
+				if errors.Is(err, queue.ErrFull) {
+					refuseCheckin(http.StatusTooManyRequests, queue.RejectFull, "queue_saturated", "check-in queue is full")
+				} else {
+					refuseCheckin(http.StatusServiceUnavailable, queue.RejectPublishFailed, "unavailable", "check-in could not be queued")
+				}
+				return
+			}
+		} else if err := repo.MarkOutboxDispatched(c.Request.Context(), queue.Checkins, evt.ID); err != nil {
+			log.Printf("outbox mark dispatched failed for %s: %v", evt.ID, err)
+		}
+
+		// Announced only now that it stands, so dashboards never show a
+		// check-in that was withdrawn.
+		announce(c.Request.Context(), evt)
+		eventCache.Invalidate(c.Request.Context())
+
+		stored = true
+		c.JSON(http.StatusAccepted, gin.H{"event_id": evt.ID, "when": evt.When, "status": evt.Status, "duplicate": false})
+	})
+
+	// Check-ins a kiosk buffered while offline, sent together once it is back
+	// online. Every item gets its own result, so the kiosk can drop the ones
+	// that were created or were duplicates from its buffer and keep the rest.
+	authGroup.POST("/checkins/batch", func(c *gin.Context) {
+		var req struct {
+			DeviceID string `json:"device_id" binding:"required"`
+			Items    []struct {
+				// ID is the kiosk's own id for the check-in; resending it
+				// returns the event it created the first time.
+				ID              string     `json:"id"`
+				UserID          string     `json:"user_id"`
+				Location        string     `json:"location"`
+				ImageURL        string     `json:"image_url"`
+				UploadToken     string     `json:"upload_token"`
+				ClientTimestamp *time.Time `json:"client_timestamp"`
+			} `json:"items" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Items) == 0 || len(req.Items) > attendance.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("items must hold 1 to %d check-ins", attendance.MaxBatchSize)})
+			return
+		}
+		if claims := auth.ClaimsFrom(c); claims.Subject != "" && claims.Subject != req.DeviceID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "device mismatch", "code": "device_mismatch",
+				"message": i18n.From(c).T("error.device_mismatch")})
+			return
+		}
+		if watermark.Exceeded() {
+			queue.CountRejection(queue.RejectHighWatermark)
+			secs := int(math.Ceil(cfg.QueueRetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(secs))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "check-in queue is backed up", "code": "queue_saturated",
+				"message": i18n.From(c).T("error.queue_saturated"), "retry_after": secs})
+			return
+		}
+
+		// Items with a rejected image_url or upload_token fail here; the rest
+		// go to the service, and pos maps its results back to the request.
+		// tokens holds the upload token each of them claimed, if any; only
+		// the tokens of created events are used up.
+		results := make([]gin.H, len(req.Items))
+		var items []attendance.BatchItem
+		var pos []int
+		var tokens []string
+		var earlier int
+		for i, it := range req.Items {
+			imageURL, bound, err := bindImage(c.Request.Context(), req.DeviceID, it.ImageURL, it.UploadToken)
+			if errors.Is(err, storage.ErrUploadToken) && it.ID != "" && it.UploadToken != "" {
+				// A batch sent again after a lost response finds its tokens
+				// used; items it already stored are duplicates, not errors.
+				prev, perr := repo.EventByClientID(c.Request.Context(), req.DeviceID, it.ID)
+				if perr != nil {
+					err = perr
+				} else if prev != nil {
+					results[i] = gin.H{"id": it.ID, "result": attendance.BatchDuplicate, "event_id": prev.ID,
+						"when": prev.When, "status": prev.Status}
+					earlier++
+					continue
+				}
+			}
+			if err != nil {
+				body := errorBody(c, err)
+				body["id"], body["result"] = it.ID, attendance.BatchError
+				results[i] = body
+				continue
+			}
+			if imageURL != "" && !bound {
+				if err := imageCheck.Check(c.Request.Context(), imageURL); err != nil {
+					results[i] = gin.H{"id": it.ID, "result": attendance.BatchError, "error": err.Error(),
+						"code": "image_rejected", "message": i18n.From(c).T("error.image_rejected")}
+					continue
+				}
+			}
+			item := attendance.BatchItem{ClientID: it.ID, UserID: it.UserID, Location: it.Location, ImageURL: imageURL}
+			if it.ClientTimestamp != nil {
+				item.ClientTime = *it.ClientTimestamp
+			}
+			items = append(items, item)
+			pos = append(pos, i)
+			if bound {
+				tokens = append(tokens, it.UploadToken)
+			} else {
+				tokens = append(tokens, "")
+			}
+		}
+		var stored []attendance.BatchResult
+		if len(items) > 0 {
+			var err error
+			stored, err = att.CheckInBatch(c.Request.Context(), req.DeviceID, items, time.Now())
+			if err != nil {
+				settleTokens(c.Request.Context(), slices.DeleteFunc(tokens, func(t string) bool { return t == "" }), false)
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+		}
+
+		counts := map[string]int{attendance.BatchCreated: 0, attendance.BatchDuplicate: earlier, attendance.BatchError: len(req.Items) - len(items) - earlier}
+		var used, unused []string
+		for j, res := range stored {
+			i := pos[j]
+			counts[res.Result]++
+			if tokens[j] != "" {
+				if res.Result == attendance.BatchCreated {
+					used = append(used, tokens[j])
+				} else {
+					unused = append(unused, tokens[j])
+				}
+			}
+			if res.Err != nil {
+				body := errorBody(c, res.Err)
+				body["id"], body["result"] = req.Items[i].ID, res.Result
+				results[i] = body
+				continue
+			}
+			results[i] = gin.H{"id": req.Items[i].ID, "result": res.Result, "event_id": res.Event.ID,
+				"when": res.Event.When, "status": res.Event.Status}
+			if res.Result != attendance.BatchCreated {
+				continue
+			}
+			// The events are committed with their outbox messages, so a failed
+			// publish is left to the relay rather than failing the item, and
+			// the event is announced either way.
+			id := res.Event.ID
+			if err := queue.PublishDetached(publishContext(c), q, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(id), Key: id}, cfg.QueuePublishTimeout); err != nil {
+				log.Printf("queue publish failed for batched event %s, leaving it to the outbox relay: %v", id, err)
+			} else if err := repo.MarkOutboxDispatched(c.Request.Context(), queue.Checkins, id); err != nil {
+				log.Printf("outbox mark dispatched failed for %s: %v", id, err)
+			}
+			announce(c.Request.Context(), res.Event)
+		}
+		settleTokens(c.Request.Context(), used, true)
+		settleTokens(c.Request.Context(), unused, false)
+		if counts[attendance.BatchCreated] > 0 {
+			eventCache.Invalidate(c.Request.Context())
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results, "created": counts[attendance.BatchCreated],
+			"duplicates": counts[attendance.BatchDuplicate], "errors": counts[attendance.BatchError]})
+	})
+
+	// Late photo or location for a pending check-in, e.g. when the upload
+	// finished after the check-in was submitted over a flaky link.
+	authGroup.PATCH("/checkins/:id", func(c *gin.Context) {
+		var req struct {
+			ImageURL    *string `json:"image_url"`
+			UploadToken *string `json:"upload_token"`
+			Location    *string `json:"location"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ImageURL == nil && req.UploadToken == nil && req.Location == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provide image_url or upload_token, and/or location"})
+			return
+		}
+		// A claimed upload token is used up only if the patch is applied.
+		patched := false
+		if req.ImageURL != nil || req.UploadToken != nil {
+			var rawURL, token string
+			if req.ImageURL != nil {
+				rawURL = *req.ImageURL
+			}
+			if req.UploadToken != nil {
+				token = *req.UploadToken
+			}
+			imageURL, bound, err := bindImage(c.Request.Context(), auth.ClaimsFrom(c).Subject, rawURL, token)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			if bound {
+				defer func() { settleTokens(c.Request.Context(), []string{token}, patched) }()
+			} else if err := imageCheck.Check(c.Request.Context(), imageURL); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			req.ImageURL = &imageURL
+		}
+
+		id := c.Param("id")
+		evt, queued, err := repo.UpdateEventImage(c.Request.Context(), id, auth.ClaimsFrom(c).Subject,
+			attendance.EventPatch{ImageURL: req.ImageURL, Location: req.Location})
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		patched = true
+		if queued {
+			if err := queue.PublishDetached(publishContext(c), q, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(id), Key: id}, cfg.QueuePublishTimeout); err != nil {
+				log.Printf("queue publish failed, leaving event %s to the outbox relay: %v", id, err)
+			} else if err := repo.MarkOutboxDispatched(c.Request.Context(), queue.Checkins, id); err != nil {
+				log.Printf("outbox mark dispatched failed for %s: %v", id, err)
+			}
+		}
+		eventCache.Invalidate(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"event": evt, "queued": queued})
+	})
+
+	// Heartbeat lets kiosks report liveness between check-ins. Heartbeats more
+	// frequent than attendance.HeartbeatInterval are accepted but not stored.
+	// An optional client_time, the kiosk's clock when it sent the heartbeat,
+	// is recorded as an observation of its clock skew.
+	authGroup.POST("/devices/heartbeat", func(c *gin.Context) {
+		receivedAt := time.Now()
+		var req struct {
+			AppVersion string         `json:"app_version"`
+			Metadata   map[string]any `json:"metadata"`
+			ClientTime *time.Time     `json:"client_time"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		deviceID := auth.ClaimsFrom(c).Subject
+		if err := repo.Heartbeat(c.Request.Context(), deviceID, req.AppVersion, req.Metadata); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if req.ClientTime != nil {
+			recordClockSkew(c.Request.Context(), deviceID, *req.ClientTime, receivedAt)
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Push token of a companion app, which is sent each check-in's final
+	// status from this device.
+	authGroup.POST("/devices/push-token", func(c *gin.Context) {
+		var req struct {
+			Token    string `json:"token" binding:"required"`
+			Platform string `json:"platform" binding:"omitempty,oneof=android ios web"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		deviceID := auth.ClaimsFrom(c).Subject
+		if err := repo.SetPushToken(c.Request.Context(), deviceID, req.Token, req.Platform); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Token introspection, so kiosks can see when their token expires.
+	authGroup.GET("/auth/me", reads, func(c *gin.Context) {
+		claims := auth.ClaimsFrom(c)
+		resp := gin.H{"subject": claims.Subject, "role": claims.Role, "issuer": claims.Issuer}
+		if claims.DepartmentScoped() {
+			resp["dept_ids"] = claims.DeptIDs
+		}
+		if claims.IssuedAt != nil {
+			resp["issued_at"] = claims.IssuedAt.Unix()
+		}
+		if claims.ExpiresAt != nil {
+			resp["expires_at"] = claims.ExpiresAt.Unix()
+			resp["expires_in"] = int(time.Until(claims.ExpiresAt.Time).Seconds())
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Rotation before expiry: a live access token plus its refresh token buys
+	// a fresh pair, and the old refresh token is revoked. Only device tokens
+	// are kept in refresh_tokens, so only devices rotate; admin tokens from
+	// /v1/admin/login and /v1/admin/departments/tokens are refused and their
+	// holders sign in or ask for a token again.
+	authGroup.POST("/auth/rotate", func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		claims := auth.ClaimsFrom(c)
+		if claims.Role != "device" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only device tokens can be rotated; sign in again"})
+			return
+		}
+		refresh, err := auth.Parse(req.RefreshToken, cfg.JWTSigningKey, cfg.JWTIssuer)
+		if err != nil || refresh.Subject != claims.Subject || refresh.Role != claims.Role || !slices.Equal(refresh.DeptIDs, claims.DeptIDs) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		tokens, err := auth.IssueScoped(claims.Subject, claims.Role, claims.DeptIDs, cfg.JWTIssuer, cfg.JWTSigningKey, cfg.AccessTTL, cfg.RefreshTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
+			return
+		}
+		if err := repo.RotateRefreshToken(c.Request.Context(), claims.Subject, req.RefreshToken, tokens.RefreshToken, tokens.RefreshExp); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.AccessExp.Unix(),
+		})
+	})
+
+	authGroup.GET("/devices", reads, func(c *gin.Context) {
+		devices, err := repo.ListDevices(c.Request.Context(), cfg.DeviceOfflineAfter, cfg.ClockSkewThreshold)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"devices": devices, "offline_after": cfg.DeviceOfflineAfter.String(),
+			"clock_skew_threshold": cfg.ClockSkewThreshold.String()})
+	})
+
+	// Large list responses are compressed for kiosks on mobile links.
+	compress := httpmiddleware.Compress(cfg.CompressMinBytes)
+
+	// Device utilization: check-ins per device over from..to (inclusive days
+	// in REPORT_TIMEZONE or tz) by hour, day or week, an hour-of-day
+	// histogram and each device's busiest day, shaped for chart libraries.
+	authGroup.GET("/reports/devices", reads, compress, func(c *gin.Context) {
+		loc, err := attendance.LoadZone(c.Query("tz"), reportLoc)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		granularity := c.DefaultQuery("granularity", attendance.GranularityDay)
+		from, to, firstDay, lastDay, err := attendance.ParseUtilizationRange(c.Query("from"), c.Query("to"), granularity, loc, time.Now())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		counts, err := eventCache.DeviceHourlyCounts(cacheContext(c), from, to, loc)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		report := attendance.BuildDeviceUtilization(counts, firstDay, lastDay, granularity)
+		report.Timezone = loc.String()
+		c.JSON(http.StatusOK, report)
+	})
+
+	// Search for support staff: employee name, device id or name, status,
+	// score range and a time range or a moment ("at", +/- "window"), ranked by
+	// how well the names and time match. At least one filter is required.
+	authGroup.GET("/events/search", reads, compress, func(c *gin.Context) {
+		s := attendance.EventSearch{
+			Name:   strings.TrimSpace(c.Query("name")),
+			Device: strings.TrimSpace(c.Query("device")),
+			Status: c.Query("status"),
+		}
+		var err error
+		for _, p := range []struct {
+			name string
+			dst  **float64
+		}{{"min_score", &s.MinScore}, {"max_score", &s.MaxScore}} {
+			if v := c.Query(p.name); v != "" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " must be a number"})
+					return
+				}
+				*p.dst = &f
+			}
+		}
+		if s.From, err = parseTimeParam(c.Query("from")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+		if s.To, err = parseTimeParam(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+		if v := c.Query("at"); v != "" {
+			if s.At, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "at must be RFC3339"})
+				return
+			}
+		}
+		if v := c.Query("window"); v != "" {
+			if s.Window, err = time.ParseDuration(v); err != nil || s.Window <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration such as 30m"})
+				return
+			}
+		}
+		s.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+		s.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		results, err := repo.SearchEvents(c.Request.Context(), s)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		for i := range results {
+			signExpanded(imageURLs, &results[i].ExpandedEvent)
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results, "limit": s.Limit, "offset": s.Offset})
+	})
+
+	// Live event updates as server-sent events: "update" with an
+	// EventUpdate when a check-in is stored or settles, and "resync" when
+	// updates may have been lost and the client should reload. Devices only
+	// see their own check-ins. Clients should poll now and then as well.
+	authGroup.GET("/events/stream", httpmiddleware.Timeout(0), auth.RequireUnscoped(), func(c *gin.Context) {
+		if bus == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "live updates are disabled (NOTIFY_BACKEND=none)"})
+			return
+		}
+		deviceID := c.Query("device_id")
+		if claims := auth.ClaimsFrom(c); claims.Role != "admin" {
+			deviceID = claims.Subject
+		}
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		updates, err := bus.Subscribe(ctx, notifybus.TopicEvents)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("event stream: write deadline not lifted: %v", err)
+		}
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		fmt.Fprint(c.Writer, "retry: 5000\n\n")
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(eventStreamKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-streamCtx.Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			case m, ok := <-updates:
+				if !ok {
+					return
+				}
+				if m.Resync {
+					fmt.Fprint(c.Writer, "event: resync\ndata: {}\n\n")
+					break
+				}
+				if deviceID != "" {
+					var u notifybus.EventUpdate
+					if json.Unmarshal(m.Payload, &u) != nil || u.DeviceID != deviceID {
+						continue
+					}
+				}
+				fmt.Fprintf(c.Writer, "event: update\ndata: %s\n\n", m.Payload)
+			}
+			c.Writer.Flush()
+		}
+	})
+
+	authGroup.GET("/events", reads, compress, func(c *gin.Context) {
+		deviceID := c.Query("device_id")
+		userID := c.Query("user_id")
+		limit, offset := 50, 0
+		if v := c.Query("limit"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil {
+				limit = parsed
+			}
+		}
+		if v := c.Query("offset"); v != "" {
+			if parsed, err := strconv.Atoi(v); err == nil {
+				offset = parsed
+			}
+		}
+		// expand=user,device joins in employee and device display fields
+		if raw := c.Query("expand"); raw != "" {
+			expand, err := attendance.ParseExpand(raw)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			events, err := repo.ListEventsExpanded(c.Request.Context(), deviceID, userID, limit, offset, expand)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			for i := range events {
+				signExpanded(imageURLs, &events[i])
+			}
+			c.JSON(http.StatusOK, gin.H{"events": events})
+			return
+		}
+		// Pollers send If-None-Match; the fingerprint query lets an unchanged
+		// list answer 304 without being loaded.
+		count, lastChange, err := eventCache.EventsFingerprint(cacheContext(c), deviceID, userID)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		// Signed image URLs change when their expiry moves on, and so does the ETag.
+		if httpmiddleware.NotModified(c, httpmiddleware.ETag(deviceID, "|", userID, "|", limit, "|", offset, "|", count, "|",
+			lastChange.UnixNano(), "|", imageURLs.Expiry(time.Now()).Unix())) {
+			return
+		}
+		events, err := eventCache.ListEvents(cacheContext(c), deviceID, userID, limit, offset)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		signEvents(imageURLs, events)
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	})
+
+	// v2 pages with an opaque cursor instead of an offset, so rows are neither
+	// skipped nor repeated while new events arrive.
+	v2 := r.Group("/v2", authenticate, scopeDepartments, auth.MethodScope())
+	v2.GET("/events", reads, compress, func(c *gin.Context) {
+		var after *attendance.EventCursor
+		if raw := c.Query("cursor"); raw != "" {
+			cur, err := attendance.DecodeCursor(raw)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			after = &cur
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		filter := attendance.EventFilter{DeviceID: c.Query("device_id"), UserID: c.Query("user_id"), Status: c.Query("status")}
+		unknown, err := queryBool(c, "unknown_user")
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		filter.UnknownUser = unknown
+		events, next, err := repo.ListEventsAfter(c.Request.Context(), after, filter, limit)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		signEvents(imageURLs, events)
+		resp := gin.H{"events": events, "next_cursor": nil}
+		if next != nil {
+			resp["next_cursor"] = next.Encode()
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Status of many events at once, for kiosks reconciling check-ins they
+	// buffered offline. Devices only see their own events; the ids of others
+	// are reported missing like unknown ones.
+	authGroup.POST("/events/status", reads, func(c *gin.Context) {
+		var req struct {
+			IDs []string `json:"ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.IDs) == 0 || len(req.IDs) > maxStatusIDs {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ids must hold 1 to %d event ids", maxStatusIDs)})
+			return
+		}
+		ids := make([]string, 0, len(req.IDs))
+		seen := make(map[string]bool, len(req.IDs))
+		for _, raw := range req.IDs {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id " + strconv.Quote(raw)})
+				return
+			}
+			if !seen[id.String()] {
+				seen[id.String()] = true
+				ids = append(ids, id.String())
+			}
+		}
+		deviceID := ""
+		if claims := auth.ClaimsFrom(c); claims.Role != "admin" {
+			deviceID = claims.Subject
+			if deviceID == "" {
+				c.JSON(http.StatusForbidden, gin.H{"error": "device token required"})
+				return
+			}
+		}
+		events, err := repo.GetEventsByIDs(c.Request.Context(), ids, deviceID)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		statuses := make(map[string]gin.H, len(events))
+		for _, evt := range events {
+			statuses[evt.ID] = gin.H{"status": evt.Status, "match_score": evt.MatchScore, "occurred_at": evt.When, "failure_reason": evt.FailureReason}
+		}
+		missing := []string{}
+		for _, id := range ids {
+			if _, ok := statuses[id]; !ok {
+				missing = append(missing, id)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"events": statuses, "missing": missing})
+	})
+
+	// Single event with the image quality breakdown, so kiosks can tell the
+	// user how to retake a rejected photo.
+	authGroup.GET("/events/:id", reads, func(c *gin.Context) {
+		evt, err := repo.GetEvent(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+				return
+			}
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		evt.ImageURL = imageURLs.URL(evt.ImageURL)
+		loc := i18n.From(c)
+		issues := quality.Evaluate(evt.Quality)
+		if issues == nil {
+			issues = []attendance.QualityIssue{}
+		}
+		for i := range issues {
+			if key := "quality." + issues[i].Code; loc.Has(key) {
+				issues[i].Hint = loc.T(key)
+			}
+		}
+		corrections, err := repo.ListCorrections(c.Request.Context(), evt.ID)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		resp := gin.H{"event": evt, "status_label": loc.T("status." + evt.Status), "quality": evt.Quality,
+			"quality_issues": issues, "corrections": corrections, "failure_reason": evt.FailureReason}
+		if evt.FailureReason != nil {
+			resp["failure_message"] = loc.T("failure." + *evt.FailureReason)
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// List employees
+	authGroup.GET("/employees", reads, func(c *gin.Context) {
+		employees, err := repo.ListEmployees(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		for i := range employees {
+			employees[i].PhotoURL = signPhoto(imageURLs, employees[i].PhotoURL)
+		}
+		c.JSON(http.StatusOK, gin.H{"employees": employees})
+	})
+
+	// Get single employee
+	authGroup.GET("/employees/:id", reads, func(c *gin.Context) {
+		employeeID := c.Param("id")
+		emp, err := repo.GetEmployee(c.Request.Context(), employeeID)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if emp == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "employee not found"})
+			return
+		}
+		emp.PhotoURL = signPhoto(imageURLs, emp.PhotoURL)
+		c.JSON(http.StatusOK, emp)
+	})
+
+	// Enroll an employee's face: stores the image (multipart "file" or JSON
+	// base64 "data") or takes an existing "image_url", then registers it with
+	// the face service, inline or via the enrollments queue with ?async=true.
+	authGroup.POST("/employees/:id/enroll", auth.RequireUnscoped(), uploads, uploadBody, func(c *gin.Context) {
+		employeeID := c.Param("id")
+		var (
+			imageURL    string
+			name        *string
+			data        []byte
+			filename    = "enroll.jpg"
+			contentType string
+			ok          = true
+		)
+		if strings.Contains(c.ContentType(), "multipart/form-data") {
+			if n := c.PostForm("name"); n != "" {
+				name = &n
+			}
+			data, filename, contentType, ok = readMultipartImage(c)
+		} else {
+			var body struct {
+				ImageURL string `json:"image_url"`
+				Data     string `json:"data"`
+				Name     string `json:"name"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil || (body.ImageURL == "" && body.Data == "") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "provide image_url, data, or a multipart file"})
+				return
+			}
+			if body.Name != "" {
+				name = &body.Name
+			}
+			imageURL = body.ImageURL
+			if imageURL != "" {
+				if err := imageCheck.Check(c.Request.Context(), imageURL); err != nil {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+					return
+				}
+			} else {
+				data, contentType, ok = decodeImage(c, body.Data)
+			}
+		}
+		if !ok {
+			return
+		}
+
+		if data != nil {
+			if images == nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": storage.ErrNotConfigured.Error()})
+				return
+			}
+			obj, err := images.Upload(c.Request.Context(), data, filename, contentType)
+			if err != nil {
+				log.Printf("enrollment image upload failed: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "image upload failed"})
+				return
+			}
+			imageURL = obj.URL
+		}
+
+		if err := repo.UpsertEmployee(c.Request.Context(), employeeID, name); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		employeeCache.Forget(employeeID)
+
+		job := worker.EnrollJob{EmployeeID: employeeID, ImageURL: imageURL}
+		if name != nil {
+			job.Name = *name
+		}
+
+		// Bulk callers pass ?async=true; the job goes to the low-priority
+		// enrollments queue so it never delays check-in processing.
+		if c.Query("async") == "true" {
+			body, _ := json.Marshal(job)
+			if err := queue.PublishDetached(publishContext(c), q, queue.Enrollments, queue.Message{Type: "enroll", Body: body, Key: employeeID}, cfg.QueuePublishTimeout); err != nil {
+				log.Printf("queue publish failed: %v", err)
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "enrollment queue unavailable"})
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{"employee_id": employeeID, "image_url": imageURL, "status": "queued"})
+			return
+		}
+
+		result, err := worker.EnrollFace(c.Request.Context(), repo, face, imageURLs, job)
+		if err != nil {
+			log.Printf("face enroll failed for %s: %v", employeeID, err)
+			if errors.Is(err, worker.ErrFaceEnroll) {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "face enrollment failed"})
+				return
+			}
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if !result.Success {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": result.Message, "quality": result.Quality})
+			return
+		}
+		notifier.NotifyEnrolled(cfg.AdminNotifyEmails, notify.EnrollmentData{
+			EmployeeID: employeeID,
+			Name:       job.Name,
+			PhotoURL:   imageURL,
+			EnrolledAt: time.Now().UTC(),
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"employee_id": employeeID,
+			"enrolled":    true,
+			"image_url":   imageURL,
+			"quality":     result.Quality,
+		})
+	})
+
+	// Admin login issues an admin-role token when ADMIN_PASSWORD is configured.
+	r.POST("/v1/admin/login", func(c *gin.Context) {
+		var req struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if cfg.AdminPassword == "" {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "admin login disabled"})
+			return
+		}
+		userOK := subtle.ConstantTimeCompare([]byte(req.Username), []byte(cfg.AdminUsername)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(req.Password), []byte(cfg.AdminPassword)) == 1
+		if !userOK || !passOK {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return
+		}
+
+		tokens, err := auth.Issue(req.Username, "admin", cfg.JWTIssuer, cfg.JWTSigningKey, cfg.AccessTTL, cfg.RefreshTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
+			return
+		}
+		auditLog.Record(c.Request.Context(), req.Username, "admin.login", "admin", req.Username, gin.H{"ip": c.ClientIP()})
+
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+			"expires_at":    tokens.AccessExp.Unix(),
+		})
+	})
+
+	adminGroup := r.Group("/v1/admin",
+		authenticate,
+		auth.RequireRole("admin"),
+		auth.RequireScope(auth.ScopeAdmin),
+		auth.RequireUnscoped(),
+		audit.Middleware(),
+	)
+	// Admin routes that department-scoped tokens may use, limited to their
+	// departments.
+	deptAdminGroup := r.Group("/v1/admin",
+		authenticate,
+		auth.RequireRole("admin"),
+		auth.RequireScope(auth.ScopeAdmin),
+		scopeDepartments,
+		audit.Middleware(),
+	)
+
+	// Audit trail, filterable by actor, action and date range (RFC3339 or YYYY-MM-DD)
+	adminGroup.GET("/audit", reads, func(c *gin.Context) {
+		f := audit.Filter{Actor: c.Query("actor"), Action: c.Query("action")}
+		var err error
+		if f.From, err = parseTimeParam(c.Query("from")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+		if f.To, err = parseTimeParam(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+		f.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+		f.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+		entries, err := auditLog.List(c.Request.Context(), f)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"entries": entries, "limit": f.Limit, "offset": f.Offset})
+	})
+
+	// GDPR erasure: delete the user's images and gallery entry, then anonymize
+	// their rows so attendance counts stay intact. Repeating it is harmless.
+	eraser := erasure.Eraser{Repo: repo, Images: images, Face: face}
+	adminGroup.DELETE("/users/:id/data", func(c *gin.Context) {
+		userID := c.Param("id")
+		rep, err := eraser.Erase(c.Request.Context(), userID)
+		if errors.Is(err, erasure.ErrIncomplete) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error() + "; no records were changed, retry later"})
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		if rep.ShiftUnassigned {
+			shifts.Invalidate()
+		}
+		if rep.EmployeeAnonymized {
+			employeeCache.Forget(userID)
+		}
+		// The entry names the user so the erasure is on record, but not the
+		// tombstone, which would link the anonymized rows back to them.
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "user.erase", "user", userID, gin.H{
+			"events": rep.EventsAnonymized, "archived_events": rep.ArchivedAnonymized, "images": rep.ImagesDeleted,
+		})
+		c.JSON(http.StatusOK, rep)
+	})
+
+	// Face-service calls the worker made for an event, oldest first, with the
+	// thresholds and scores that decided its status.
+	adminGroup.GET("/events/:id/face-audit", reads, func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id"})
+			return
+		}
+		entries, err := faceAudit.List(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_id": id, "entries": entries})
+	})
+
+	// Everything that happened to an event, oldest first: its creation,
+	// status changes, corrections, face-service calls and webhook deliveries.
+	adminGroup.GET("/events/:id/timeline", reads, func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id"})
+			return
+		}
+		ctx := c.Request.Context()
+		evt, err := repo.GetEvent(ctx, id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		history, err := repo.ListStatusHistory(ctx, id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		corrections, err := repo.ListCorrections(ctx, id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		faceCalls, err := faceAudit.List(ctx, id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		deliveries, err := repo.ListWebhookDeliveries(ctx, id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"event_id": id,
+			"status":   evt.Status,
+			"entries":  attendance.Timeline(evt, history, corrections, faceCalls, deliveries),
+		})
+	})
+
+	// User ids that events carry but no employee has, with how many events
+	// each, so they can be created as employees or corrected.
+	adminGroup.GET("/users/unknown", reads, func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		users, err := repo.ListUnknownUsers(c.Request.Context(), limit, offset)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"users": users, "limit": limit, "offset": offset})
+	})
+
+	// Explicitly reprocess a finished event: reset it to pending and requeue it.
+	adminGroup.POST("/events/:id/reprocess", func(c *gin.Context) {
+		id := c.Param("id")
+		if err := repo.ResetEventStatus(c.Request.Context(), id, auth.ClaimsFrom(c).Subject); err != nil {
+			if errors.Is(err, attendance.ErrInvalidTransition) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if err := checkinClaims.Forget(c.Request.Context(), id); err != nil {
+			// The marker expires after CHECKIN_PROCESSED_TTL; until then the
+			// worker skips the event.
+			log.Printf("reprocess %s: clear processed marker failed: %v", id, err)
+		}
+		if err := queue.PublishDetached(publishContext(c), q, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(id), Key: id}, cfg.QueuePublishTimeout); err != nil {
+			log.Printf("queue publish failed, leaving event %s to the outbox relay: %v", id, err)
+		} else if err := repo.MarkOutboxDispatched(c.Request.Context(), queue.Checkins, id); err != nil {
+			log.Printf("outbox mark dispatched failed for %s: %v", id, err)
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "event.reprocess", "event", id, nil)
+		c.JSON(http.StatusAccepted, gin.H{"event_id": id, "status": attendance.StatusPending})
+	})
+
+	// Queue backlog. A backend outage is reported in the body, not as a 5xx,
+	// so dashboards polling this keep working.
+	adminGroup.GET("/queue/stats", reads, func(c *gin.Context) {
+		st, err := q.QueueStats(c.Request.Context())
+		resp := gin.H{"backend": st.Backend, "depth": st.Depth, "queues": st.Queues, "oldest_age_seconds": nil}
+		if st.OldestAge != nil {
+			resp["oldest_age_seconds"] = st.OldestAge.Seconds()
+		}
+		if err != nil {
+			resp["error"] = err.Error()
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// Workers with a live heartbeat and their builds; version_mismatch is set
+	// when one runs a different version or commit than this API. The mismatch
+	// view lives here because there is no /v1/admin/overview endpoint to put
+	// it in.
+	adminGroup.GET("/workers", reads, func(c *gin.Context) {
+		workers, err := worker.ListWorkers(c.Request.Context(), redisClient.Client)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		api := version.Get()
+		mismatch := false
+		for _, w := range workers {
+			if w.Version != api.Version || w.Commit != api.Commit {
+				mismatch = true
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"api": api, "workers": workers, "version_mismatch": mismatch})
+	})
+
+	// The face model now running and how many enrollments were made with
+	// each; stale counts those that need re-enrolling. An unreachable face
+	// service is reported in the body, like /queue/stats.
+	adminGroup.GET("/face/status", reads, func(c *gin.Context) {
+		counts, err := repo.FaceModelCounts(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		resp := gin.H{"model": nil, "enrollments": counts, "stale": nil}
+		model, err := face.Info(c.Request.Context())
+		if err != nil {
+			resp["error"] = err.Error()
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		stale := 0
+		for _, fc := range counts {
+			if fc.Model == nil || *fc.Model != model.ID() {
+				stale += fc.Employees
+			}
+		}
+		resp["model"] = gin.H{"id": model.ID(), "name": model.Name, "version": model.Version, "loaded": model.Loaded}
+		resp["stale"] = stale
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// wakeJobs tells a worker that job id is queued. If the message is lost,
+	// a dispatcher still finds the job at its next poll.
+	wakeJobs := func(c *gin.Context, id string) {
+		if err := queue.PublishDetached(publishContext(c), q, queue.Enrollments, worker.JobMessage(id), cfg.QueuePublishTimeout); err != nil {
+			log.Printf("queue publish for job %s failed, leaving it to the next poll: %v", id, err)
+		}
+	}
+
+	// Start a job that re-enrolls the stale faces from their stored photos.
+	// Only one runs at a time; starting another returns the active one.
+	adminGroup.POST("/face/reenroll", func(c *gin.Context) {
+		actor := auth.ClaimsFrom(c).Subject
+		job, err := jobStore.Create(c.Request.Context(), jobs.Spec{Type: worker.JobFaceReenroll, CreatedBy: actor, Exclusive: true})
+		if errors.Is(err, jobs.ErrActive) {
+			body := errorBody(c, err)
+			body["job"] = job
+			c.JSON(http.StatusConflict, body)
+			return
+		}
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		wakeJobs(c, job.ID)
+		auditLog.Record(c.Request.Context(), actor, "face.reenroll", "job", job.ID, nil)
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	// Runtime settings with their defaults and bounds.
+	adminGroup.GET("/settings", reads, func(c *gin.Context) {
+		list, err := settingsProvider.List(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"settings": list})
+	})
+
+	// Change runtime settings; a null value resets one to its default. The
+	// API and workers pick the change up without a restart.
+	adminGroup.PUT("/settings", func(c *gin.Context) {
+		var req map[string]json.RawMessage
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx := c.Request.Context()
+		actor := auth.ClaimsFrom(c).Subject
+		changes, err := settingsProvider.Update(ctx, actor, req)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		for _, ch := range changes {
+			auditLog.Record(ctx, actor, "setting.update", "setting", ch.Key, gin.H{"old": ch.Old, "new": ch.New})
+		}
+		list, err := settingsProvider.List(ctx)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"settings": list, "changed": changes})
+	})
+
+	// Jobs, newest first, optionally of one type or status.
+	adminGroup.GET("/jobs", reads, func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		list, err := jobStore.List(c.Request.Context(), jobs.Filter{
+			Type: c.Query("type"), Status: c.Query("status"), Limit: limit, Offset: offset,
+		})
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": list, "limit": limit, "offset": offset})
+	})
+
+	// Jobs report their progress here while the worker runs them.
+	adminGroup.GET("/jobs/:id", reads, func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+			return
+		}
+		job, err := jobStore.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	// Pause, resume or cancel a job. A running job stops within a heartbeat
+	// or at its next progress report; a resumed one is queued again and
+	// continues where it stopped.
+	setJobStatus := func(status, action string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			id := c.Param("id")
+			if _, err := uuid.Parse(id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+				return
+			}
+			job, err := jobStore.SetStatus(c.Request.Context(), id, status)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			if status == jobs.Queued {
+				wakeJobs(c, id)
+			}
+			auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, action, "job", id, gin.H{"type": job.Type})
+			c.JSON(http.StatusOK, job)
+		}
+	}
+	adminGroup.POST("/jobs/:id/pause", setJobStatus(jobs.Paused, "job.pause"))
+	adminGroup.POST("/jobs/:id/resume", setJobStatus(jobs.Queued, "job.resume"))
+	adminGroup.POST("/jobs/:id/cancel", setJobStatus(jobs.Cancelled, "job.cancel"))
+
+	// Correct an event's user, status or time. The original values are kept
+	// in event_corrections and shown on GET /v1/events/:id.
+	adminGroup.PATCH("/events/:id", func(c *gin.Context) {
+		var req struct {
+			UserID     *string    `json:"user_id"`
+			Status     *string    `json:"status"`
+			OccurredAt *time.Time `json:"occurred_at"`
+			Reason     string     `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id := c.Param("id")
+		actor := auth.ClaimsFrom(c).Subject
+		evt, changes, err := repo.CorrectEvent(c.Request.Context(), id, attendance.CorrectionRequest{
+			UserID:     req.UserID,
+			Status:     req.Status,
+			OccurredAt: req.OccurredAt,
+			Reason:     req.Reason,
+			Actor:      actor,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				c.JSON(http.StatusNotFound, gin.H{"error": "event not found"})
+			case errors.Is(err, attendance.ErrInvalidCorrection):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(errorStatus(err), errorBody(c, err))
+			}
+			return
+		}
+		fields := make([]string, 0, len(changes))
+		for _, ch := range changes {
+			fields = append(fields, ch.Field)
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), actor, "event.correct", "event", id, gin.H{"fields": fields, "reason": req.Reason})
+		c.JSON(http.StatusOK, gin.H{"event": evt, "corrections": changes})
+	})
+
+	// Manual attendance, e.g. for a user whose kiosk was broken. The event
+	// waits as awaiting_approval until a second admin reviews it.
+	adminGroup.POST("/events/manual", func(c *gin.Context) {
+		var req struct {
+			UserID        string    `json:"user_id" binding:"required"`
+			DeviceID      string    `json:"device_id" binding:"required"`
+			OccurredAt    time.Time `json:"occurred_at" binding:"required"`
+			Location      string    `json:"location"`
+			Justification string    `json:"justification" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		actor := auth.ClaimsFrom(c).Subject
+		evt, err := repo.CreateManualEvent(c.Request.Context(), attendance.ManualEventRequest{
+			UserID:        req.UserID,
+			DeviceID:      req.DeviceID,
+			OccurredAt:    req.OccurredAt,
+			Location:      req.Location,
+			Justification: req.Justification,
+			RequestedBy:   actor,
+		})
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), actor, "event.manual_create", "event", evt.ID, gin.H{
+			"user_id": evt.UserID, "device_id": evt.DeviceID, "occurred_at": evt.When, "justification": evt.Justification,
+		})
+		c.JSON(http.StatusCreated, evt)
+	})
+
+	// Manual events waiting for a second admin, oldest first.
+	adminGroup.GET("/events/pending-approval", reads, func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		events, err := repo.ListAwaitingApproval(c.Request.Context(), limit, offset)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"events": events, "limit": limit, "offset": offset})
+	})
+
+	// Approve or reject a manual event. The reviewer must not be the admin
+	// who entered it; a rejection needs a reason.
+	reviewManual := func(approve bool) gin.HandlerFunc {
+		action := "event.manual_approve"
+		if !approve {
+			action = "event.manual_reject"
+		}
+		return func(c *gin.Context) {
+			var req struct {
+				Reason string `json:"reason"`
+			}
+			if c.Request.ContentLength != 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+			}
+			id := c.Param("id")
+			if _, err := uuid.Parse(id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event id"})
+				return
+			}
+			actor := auth.ClaimsFrom(c).Subject
+			evt, err := repo.ReviewManualEvent(c.Request.Context(), id, actor, approve, req.Reason)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			eventCache.Invalidate(c.Request.Context())
+			auditLog.Record(c.Request.Context(), actor, action, "event", id, gin.H{
+				"requested_by": evt.RequestedBy, "reason": req.Reason,
+			})
+			c.JSON(http.StatusOK, evt)
+		}
+	}
+	adminGroup.POST("/events/:id/approve", reviewManual(true))
+	adminGroup.POST("/events/:id/reject", reviewManual(false))
+
+	// Alerts raised for devices with repeated failed face matches
+	adminGroup.GET("/device-alerts", reads, func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		alerts, err := repo.ListDeviceAlerts(c.Request.Context(), c.Query("open") == "true", limit)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+	})
+
+	// Deactivate a device, e.g. a replaced kiosk: its refresh tokens are
+	// revoked and its access tokens refused until they expire. Its events are
+	// kept, and the id cannot register again until reprovisioning is allowed.
+	authGroup.DELETE("/devices/:device_id", auth.RequireRole("admin"), auth.RequireScope(auth.ScopeAdmin), auth.RequireUnscoped(), audit.Middleware(),
+		func(c *gin.Context) {
+			id := c.Param("device_id")
+			actor := auth.ClaimsFrom(c).Subject
+			revoked, err := repo.DisableDevice(c.Request.Context(), id, actor)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			if err := denylist.Deny(c.Request.Context(), "device", id); err != nil {
+				// Refresh tokens are revoked; access tokens lapse within ACCESS_TTL.
+				log.Printf("device %s: denylist failed: %v", id, err)
+			}
+			auditLog.Record(c.Request.Context(), actor, "device.disable", "device", id, gin.H{"refresh_tokens_revoked": revoked})
+			c.JSON(http.StatusOK, gin.H{"device_id": id, "disabled": true, "refresh_tokens_revoked": revoked})
+		})
+
+	// Re-enable a device flagged as suspicious: clears the flag, resolves its
+	// alerts and resets the failed-match count.
+	adminGroup.POST("/devices/:id/enable", func(c *gin.Context) {
+		id := c.Param("id")
+		actor := auth.ClaimsFrom(c).Subject
+		if err := repo.EnableDevice(c.Request.Context(), id, actor); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+				return
+			}
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if err := failures.Reset(c.Request.Context(), id); err != nil {
+			log.Printf("device %s: reset failure count failed: %v", id, err)
+		}
+		auditLog.Record(c.Request.Context(), actor, "device.enable", "device", id, nil)
+		c.JSON(http.StatusOK, gin.H{"device_id": id, "suspicious": false})
+	})
+
+	// Allow a deactivated device id to register again, e.g. when its kiosk
+	// is reinstalled rather than replaced.
+	adminGroup.POST("/devices/:id/reprovision", func(c *gin.Context) {
+		id := c.Param("id")
+		if err := repo.AllowReprovision(c.Request.Context(), id); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "device.reprovision_allow", "device", id, nil)
+		c.JSON(http.StatusOK, gin.H{"device_id": id, "reprovision_allowed": true})
+	})
+
+	// Set or clear a device's geofence center, used by the anomaly analysis
+	// when check-ins carry no coordinates of their own.
+	adminGroup.PUT("/devices/:id/position", func(c *gin.Context) {
+		var req struct {
+			Latitude  *float64 `json:"latitude"`
+			Longitude *float64 `json:"longitude"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		id := c.Param("id")
+		if err := repo.SetDevicePosition(c.Request.Context(), id, req.Latitude, req.Longitude); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "device.position", "device", id, gin.H{
+			"latitude": req.Latitude, "longitude": req.Longitude,
+		})
+		c.JSON(http.StatusOK, gin.H{"device_id": id, "latitude": req.Latitude, "longitude": req.Longitude})
+	})
+
+	// Findings of the nightly anomaly analysis, newest first, optionally by
+	// status (open, acknowledged, dismissed) and kind.
+	adminGroup.GET("/anomalies", reads, func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		anomalies, err := repo.ListAnomalies(c.Request.Context(), attendance.AnomalyFilter{
+			Status: c.Query("status"),
+			Kind:   c.Query("kind"),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"anomalies": anomalies, "limit": limit, "offset": offset})
+	})
+
+	// Acknowledge (real, being handled) or dismiss (false alarm) a finding.
+	reviewAnomaly := func(status string) gin.HandlerFunc {
+		action := "anomaly.acknowledge"
+		if status == attendance.AnomalyDismissed {
+			action = "anomaly.dismiss"
+		}
+		return func(c *gin.Context) {
+			id := c.Param("id")
+			if _, err := uuid.Parse(id); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid anomaly id"})
+				return
+			}
+			actor := auth.ClaimsFrom(c).Subject
+			a, err := repo.ReviewAnomaly(c.Request.Context(), id, status, actor)
+			if err != nil {
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+			auditLog.Record(c.Request.Context(), actor, action, "anomaly", id, gin.H{
+				"kind": a.Kind, "user_id": a.UserID, "event_id": a.EventID,
+			})
+			c.JSON(http.StatusOK, a)
+		}
 	}
+	adminGroup.POST("/anomalies/:id/acknowledge", reviewAnomaly(attendance.AnomalyAcknowledged))
+	adminGroup.POST("/anomalies/:id/dismiss", reviewAnomaly(attendance.AnomalyDismissed))
+
+	// API keys for server-to-server integrations. The key is only in the
+	// create and rotate responses.
+	adminGroup.POST("/api-keys", func(c *gin.Context) {
+		var req struct {
+			Name   string   `json:"name" binding:"required"`
+			Role   string   `json:"role"`
+			Scopes []string `json:"scopes"`
+			// ExpiresIn is a Go duration such as "2160h"; empty never expires.
+			ExpiresIn string `json:"expires_in"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		spec := auth.NewAPIKey{Name: req.Name, Role: req.Role, Scopes: req.Scopes, CreatedBy: auth.ClaimsFrom(c).Subject}
+		if spec.Role == "" {
+			spec.Role = "integration"
+		}
+		if len(spec.Scopes) == 0 {
+			spec.Scopes = []string{auth.ScopeRead}
+		}
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a duration such as 2160h"})
+				return
+			}
+			spec.TTL = d
+		}
+		key, err := apiKeys.Create(c.Request.Context(), spec)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), spec.CreatedBy, "apikey.create", "api_key", key.ID,
+			gin.H{"name": key.Name, "role": key.Role, "scopes": key.Scopes})
+		c.JSON(http.StatusCreated, key)
+	})
+
+	adminGroup.GET("/api-keys", reads, func(c *gin.Context) {
+		keys, err := apiKeys.List(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	})
+
+	// Rotation issues a replacement with the same name, role and scopes and
+	// revokes the old key in the same transaction.
+	adminGroup.POST("/api-keys/:id/rotate", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+			return
+		}
+		actor := auth.ClaimsFrom(c).Subject
+		key, err := apiKeys.Rotate(c.Request.Context(), id, actor)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), actor, "apikey.rotate", "api_key", id, gin.H{"replacement": key.ID})
+		c.JSON(http.StatusCreated, key)
+	})
 
-	// Start server in goroutine
-	go func() {
-		log.Printf("Starting server on :%s", cfg.HTTPPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+	adminGroup.DELETE("/api-keys/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+			return
 		}
-	}()
+		if err := apiKeys.Revoke(c.Request.Context(), id); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "apikey.revoke", "api_key", id, nil)
+		c.Status(http.StatusNoContent)
+	})
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("Shutting down server...")
+	// Provision a batch of one-time enrollment codes for new kiosks. The codes
+	// are only shown in this response; the database keeps their hashes.
+	// Set or reset an employee's PIN for PIN check-ins; this also lifts a
+	// lockout.
+	adminGroup.PUT("/employees/:id/pin", func(c *gin.Context) {
+		var req struct {
+			PIN string `json:"pin" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		employeeID := c.Param("id")
+		if err := repo.SetPIN(c.Request.Context(), employeeID, req.PIN); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if err := pinLimiter.Reset(c.Request.Context(), employeeID); err != nil {
+			log.Printf("PIN limiter reset for %s failed: %v", employeeID, err)
+		}
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "employee.pin_set", "employee", employeeID, nil)
+		c.Status(http.StatusNoContent)
+	})
 
-	// Give outstanding requests 10 seconds to complete
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// One-time link token with which the employee sets their own PIN via
+	// POST /v1/pin-links/:token, valid for PIN_LINK_TTL.
+	adminGroup.POST("/employees/:id/pin-link", func(c *gin.Context) {
+		actor := auth.ClaimsFrom(c).Subject
+		link, err := repo.CreatePINLink(c.Request.Context(), c.Param("id"), actor, cfg.PINLinkTTL)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), actor, "employee.pin_link", "employee", link.EmployeeID,
+			map[string]any{"expires_at": link.ExpiresAt})
+		c.JSON(http.StatusCreated, gin.H{"employee_id": link.EmployeeID, "token": link.Token,
+			"path": "/v1/pin-links/" + link.Token, "expires_at": link.ExpiresAt})
+	})
 
-	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server forced shutdown: %v", err)
-	}
+	adminGroup.POST("/devices/provision", func(c *gin.Context) {
+		var req struct {
+			Count int    `json:"count" binding:"required"`
+			Label string `json:"label"`
+			// ExpiresIn is a Go duration such as "72h"; it defaults to a week.
+			ExpiresIn string `json:"expires_in"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ttl := 7 * 24 * time.Hour
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a duration such as 72h"})
+				return
+			}
+			ttl = d
+		}
+		actor := auth.ClaimsFrom(c).Subject
+		batch, err := repo.CreateEnrollmentCodes(c.Request.Context(), req.Count, ttl, req.Label, actor)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		auditLog.Record(c.Request.Context(), actor, "device.provision", "enrollment_batch", batch.BatchID,
+			map[string]any{"count": len(batch.Codes), "label": req.Label, "expires_at": batch.ExpiresAt})
+		c.JSON(http.StatusCreated, batch)
+	})
 
-	log.Println("Server exited")
-	return nil
-}
+	// Shift schedules. Changes invalidate this process's shift cache; workers
+	// pick them up within SHIFT_CACHE_TTL.
+	adminGroup.GET("/shifts", reads, func(c *gin.Context) {
+		list, err := repo.ListShifts(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"shifts": list})
+	})
 
-// CORS middleware for browser requests
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
+	adminGroup.POST("/shifts", func(c *gin.Context) {
+		var req attendance.Shift
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shift, err := repo.CreateShift(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		shifts.Invalidate()
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "shift.create", "shift", strconv.FormatInt(shift.ID, 10), gin.H{"name": shift.Name})
+		c.JSON(http.StatusCreated, shift)
+	})
+
+	adminGroup.GET("/shifts/:id", reads, func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shift id"})
+			return
+		}
+		shift, err := repo.GetShift(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, shift)
+	})
+
+	adminGroup.PUT("/shifts/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shift id"})
+			return
+		}
+		var req attendance.Shift
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = id
+		shift, err := repo.UpdateShift(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
 		}
+		shifts.Invalidate()
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "shift.update", "shift", c.Param("id"), gin.H{"name": shift.Name})
+		c.JSON(http.StatusOK, shift)
+	})
 
-		c.Header("Access-Control-Allow-Origin", origin)
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Max-Age", "86400")
+	adminGroup.DELETE("/shifts/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shift id"})
+			return
+		}
+		if err := repo.DeleteShift(c.Request.Context(), id); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		shifts.Invalidate()
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "shift.delete", "shift", c.Param("id"), nil)
+		c.Status(http.StatusNoContent)
+	})
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+	adminGroup.GET("/shift-assignments", reads, func(c *gin.Context) {
+		list, err := repo.ListShiftAssignments(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{"assignments": list})
+	})
 
-		c.Next()
+	adminGroup.PUT("/users/:id/shift", func(c *gin.Context) {
+		var req struct {
+			ShiftID int64 `json:"shift_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID := c.Param("id")
+		if err := repo.AssignShift(c.Request.Context(), userID, req.ShiftID); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		shifts.Invalidate()
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "shift.assign", "user", userID, gin.H{"shift_id": req.ShiftID})
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "shift_id": req.ShiftID})
+	})
+
+	adminGroup.DELETE("/users/:id/shift", func(c *gin.Context) {
+		userID := c.Param("id")
+		if err := repo.UnassignShift(c.Request.Context(), userID); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		shifts.Invalidate()
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "shift.unassign", "user", userID, nil)
+		c.Status(http.StatusNoContent)
+	})
+
+	adminGroup.GET("/departments", reads, func(c *gin.Context) {
+		list, err := repo.ListDepartments(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"departments": list})
+	})
+
+	adminGroup.POST("/departments", func(c *gin.Context) {
+		var req attendance.Department
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dept, err := repo.CreateDepartment(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "department.create", "department", strconv.FormatInt(dept.ID, 10), gin.H{"name": dept.Name, "parent_id": dept.ParentID})
+		c.JSON(http.StatusCreated, dept)
+	})
+
+	adminGroup.PUT("/departments/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid department id"})
+			return
+		}
+		var req attendance.Department
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.ID = id
+		dept, err := repo.UpdateDepartment(c.Request.Context(), req)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "department.update", "department", c.Param("id"), gin.H{"name": dept.Name, "parent_id": dept.ParentID})
+		c.JSON(http.StatusOK, dept)
+	})
+
+	adminGroup.DELETE("/departments/:id", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid department id"})
+			return
+		}
+		if err := repo.DeleteDepartment(c.Request.Context(), id); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "department.delete", "department", c.Param("id"), nil)
+		c.Status(http.StatusNoContent)
+	})
+
+	adminGroup.PUT("/employees/:id/department", func(c *gin.Context) {
+		var req struct {
+			DepartmentID *int64 `json:"department_id"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		employeeID := c.Param("id")
+		if err := repo.SetEmployeeDepartment(c.Request.Context(), employeeID, req.DepartmentID); err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		eventCache.Invalidate(c.Request.Context())
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "employee.department", "user", employeeID, gin.H{"department_id": req.DepartmentID})
+		c.JSON(http.StatusOK, gin.H{"employee_id": employeeID, "department_id": req.DepartmentID})
+	})
+
+	// Department-scoped admin tokens, e.g. for HR managers: events, employees
+	// and reports are limited to the given departments and those below them,
+	// and admin routes that are not department-aware refuse them.
+	adminGroup.POST("/departments/tokens", func(c *gin.Context) {
+		var req struct {
+			Subject       string  `json:"subject" binding:"required"`
+			DepartmentIDs []int64 `json:"department_ids" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		known, err := repo.DepartmentTree(c.Request.Context(), req.DepartmentIDs)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		for _, id := range req.DepartmentIDs {
+			if !slices.Contains(known, id) {
+				err := fmt.Errorf("%w: department %d", attendance.ErrNotFound, id)
+				c.JSON(errorStatus(err), errorBody(c, err))
+				return
+			}
+		}
+		tokens, err := auth.IssueScoped(req.Subject, "admin", req.DepartmentIDs, cfg.JWTIssuer, cfg.JWTSigningKey, cfg.AccessTTL, cfg.RefreshTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token issue failed"})
+			return
+		}
+		auditLog.Record(c.Request.Context(), auth.ClaimsFrom(c).Subject, "department.token", "admin", req.Subject, gin.H{"department_ids": req.DepartmentIDs})
+		c.JSON(http.StatusCreated, gin.H{
+			"access_token":   tokens.AccessToken,
+			"refresh_token":  tokens.RefreshToken,
+			"expires_at":     tokens.AccessExp.Unix(),
+			"department_ids": req.DepartmentIDs,
+		})
+	})
+
+	// reportDay reads the day of a daily report from the date and tz query
+	// params; it defaults to today in REPORT_TIMEZONE.
+	reportDay := func(c *gin.Context) (loc *time.Location, from, to time.Time, err error) {
+		if loc, err = attendance.LoadZone(c.Query("tz"), reportLoc); err != nil {
+			return nil, from, to, err
+		}
+		from, to = attendance.DayBounds(time.Now(), loc)
+		if v := c.Query("date"); v != "" {
+			from, to, err = attendance.ParseDay(v, loc)
+		}
+		return loc, from, to, err
+	}
+
+	// Daily attendance per user with lateness and early departure. Days are
+	// bucketed in the report timezone, not in UTC.
+	deptAdminGroup.GET("/reports/daily", reads, func(c *gin.Context) {
+		loc, from, to, err := reportDay(c)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		unknown, err := queryBool(c, "unknown_user")
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		report, err := eventCache.DailyReport(cacheContext(c), from, to)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		if unknown != nil {
+			report = slices.DeleteFunc(report, func(d attendance.DailyAttendance) bool { return d.UnknownUser != *unknown })
+		}
+		if err := shifts.Annotate(c.Request.Context(), report); err != nil {
+			log.Printf("daily report: load shifts failed: %v", err)
+		}
+		for i := range report {
+			report[i].FirstCheckIn = report[i].FirstCheckIn.In(loc)
+			report[i].LastCheckIn = report[i].LastCheckIn.In(loc)
+		}
+		labels := gin.H{}
+		for _, col := range reportColumns {
+			labels[col] = i18n.From(c).T("report." + col)
+		}
+		c.JSON(http.StatusOK, gin.H{"date": from.Format(time.DateOnly), "timezone": loc.String(), "labels": labels, "users": report})
+	})
+
+	// Printable sheet of every employee for a day, with check-in times,
+	// status and a signature column. Labels follow Accept-Language when
+	// REPORT_FONT_PATH provides the glyphs, and are English otherwise.
+	authGroup.GET("/reports/daily.pdf", auth.RequireRole("admin"), auth.RequireScope(auth.ScopeAdmin), reads, func(c *gin.Context) {
+		loc, from, to, err := reportDay(c)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		report, err := eventCache.DailyReport(cacheContext(c), from, to)
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		employees, err := repo.ListEmployees(c.Request.Context())
+		if err != nil {
+			c.JSON(errorStatus(err), errorBody(c, err))
+			return
+		}
+		labels := i18n.From(c)
+		if cfg.ReportFontPath == "" {
+			labels = i18n.New(i18n.Default)
+		}
+		date := from.Format(time.DateOnly)
+		var buf bytes.Buffer
+		if err := pdfreport.Render(&buf, pdfreport.Sheet{
+			Organization: cfg.ReportOrganization,
+			LogoPath:     cfg.ReportLogoPath,
+			FontPath:     cfg.ReportFontPath,
+			Date:         date,
+			Timezone:     loc.String(),
+			GeneratedAt:  time.Now().In(loc),
+			Rows:         pdfreport.Roster(employees, report, loc),
+		}, labels.T); err != nil {
+			log.Printf("daily sheet %s: render failed: %v", date, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "report rendering failed"})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="attendance-%s.pdf"`, date))
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	})
+
+	webFS, webSource := web.Embedded, "embedded"
+	if webFS == nil {
+		webFS, webSource = os.DirFS(cfg.WebDir), cfg.WebDir
+	}
+	if err := webui.Check(webFS); err != nil {
+		log.Printf("dashboard: %v in %s", err, webSource)
+	}
+	dashboard := webui.New(webFS, "/v1/", "/v2/", "/metrics", "/healthz")
+	r.GET("/", dashboard.Index)
+	r.HEAD("/", dashboard.Index)
+	r.GET("/static/*filepath", dashboard.Static)
+	r.HEAD("/static/*filepath", dashboard.Static)
+	r.NoRoute(dashboard.NoRoute)
+
+	s.handler = r
+	// Runs first on Close: HTTP is stopped by then, so nothing new is
+	// queued, and the worker finishes what it holds.
+	s.closers = append(s.closers, func() {
+		stopWorker()
+		<-workerDone
+	})
+	return s, nil
+}
+
+// readMultipartImage reads the "file" field of a multipart form. It writes a
+// 4xx/5xx response and returns false on failure.
+func readMultipartImage(c *gin.Context) ([]byte, string, string, bool) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file field required"})
+		return nil, "", "", false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "read file failed"})
+		return nil, "", "", false
+	}
+	return data, header.Filename, header.Header.Get("Content-Type"), true
+}
+
+// decodeImage decodes a base64 data URL, writing a 400 and returning false when invalid.
+func decodeImage(c *gin.Context, encoded string) ([]byte, string, bool) {
+	data, contentType, err := storage.DecodeDataURL(encoded)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base64 image data"})
+		return nil, "", false
+	}
+	return data, contentType, true
+}
+
+// parseTimeParam accepts RFC3339 timestamps or YYYY-MM-DD dates; empty yields the zero time.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
 	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// cacheContext returns the request context, marked to skip the event cache
+// when the client sent Cache-Control: no-cache.
+func cacheContext(c *gin.Context) context.Context {
+	if strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache") {
+		return cache.Bypass(c.Request.Context())
+	}
+	return c.Request.Context()
+}
+
+// errorStatus maps attendance domain errors to HTTP statuses. Database
+// outages and timeouts are 503 so clients retry; anything unclassified is a 500.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, attendance.ErrValidation), errors.Is(err, auth.ErrAPIKeySpec), errors.Is(err, settings.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, attendance.ErrDuplicate), errors.Is(err, attendance.ErrInvalidTransition),
+		errors.Is(err, jobs.ErrActive), errors.Is(err, jobs.ErrInvalidTransition):
+		return http.StatusConflict
+	case errors.Is(err, attendance.ErrTokenRevoked), errors.Is(err, attendance.ErrPINRejected):
+		return http.StatusUnauthorized
+	case errors.Is(err, attendance.ErrDeviceDisabled), errors.Is(err, attendance.ErrEnrollmentCode),
+		errors.Is(err, attendance.ErrSelfApproval), errors.Is(err, attendance.ErrPINLocked):
+		return http.StatusForbidden
+	case errors.Is(err, attendance.ErrTooOld), errors.Is(err, storage.ErrUploadToken), errors.Is(err, attendance.ErrUnknownUser):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, attendance.ErrNotFound), errors.Is(err, sql.ErrNoRows), errors.Is(err, auth.ErrAPIKeyNotFound),
+		errors.Is(err, jobs.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, attendance.ErrStorage), attendance.IsTimeout(err):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// signEvents replaces the events' image URLs with signed ones; a nil signer
+// leaves them as stored.
+func signEvents(s *storage.Signer, events []attendance.Event) {
+	for i := range events {
+		events[i].ImageURL = s.URL(events[i].ImageURL)
+	}
+}
+
+// signExpanded signs an expanded event's image and its employee photo.
+func signExpanded(s *storage.Signer, e *attendance.ExpandedEvent) {
+	e.ImageURL = s.URL(e.ImageURL)
+	if e.User != nil {
+		e.User.PhotoURL = signPhoto(s, e.User.PhotoURL)
+	}
+}
+
+// signPhoto returns a signed copy of an optional photo URL.
+func signPhoto(s *storage.Signer, photoURL *string) *string {
+	if photoURL == nil {
+		return nil
+	}
+	signed := s.URL(*photoURL)
+	return &signed
+}
+
+// eventStreamKeepAlive is how often an idle event stream gets a comment, so
+// proxies do not time it out.
+const eventStreamKeepAlive = 25 * time.Second
+
+// maxStatusIDs is how many events one POST /v1/events/status may ask about.
+const maxStatusIDs = 200
+
+// reportColumns are the daily report fields given translated labels.
+var reportColumns = []string{"user_id", "first_check_in", "last_check_in", "check_ins", "shift", "late_minutes", "early_departure_minutes"}
+
+// queryBool parses the optional boolean query parameter name; nil when it is
+// absent.
+func queryBool(c *gin.Context, name string) (*bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be true or false", attendance.ErrValidation, name)
+	}
+	return &v, nil
+}
+
+// errorCode is the stable code for err, also the key of its translated message.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, attendance.ErrDuplicate):
+		return "duplicate"
+	case errors.Is(err, attendance.ErrInvalidTransition):
+		return "invalid_transition"
+	case errors.Is(err, attendance.ErrDeviceDisabled):
+		return "device_disabled"
+	case errors.Is(err, attendance.ErrEnrollmentCode):
+		return "enrollment_code"
+	case errors.Is(err, attendance.ErrTokenRevoked):
+		return "token_revoked"
+	case errors.Is(err, attendance.ErrSelfApproval):
+		return "self_approval"
+	case errors.Is(err, attendance.ErrPINRejected):
+		return "pin_rejected"
+	case errors.Is(err, attendance.ErrPINLocked):
+		return "pin_locked"
+	case errors.Is(err, attendance.ErrTooOld):
+		return "too_old"
+	case errors.Is(err, storage.ErrUploadToken):
+		return "upload_token"
+	case errors.Is(err, attendance.ErrUnknownUser):
+		return "unknown_user"
+	case errors.Is(err, jobs.ErrActive):
+		return "job_active"
+	case errors.Is(err, jobs.ErrInvalidTransition):
+		return "job_state"
+	}
+	switch errorStatus(err) {
+	case http.StatusBadRequest:
+		return "validation"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	return "internal"
+}
+
+// publishContext is the request's context carrying its request id and
+// incoming trace context, for queue.PublishDetached to put in the message.
+func publishContext(c *gin.Context) context.Context {
+	ctx := queue.WithMetadata(c.Request.Context(), queue.MetaRequestID, c.GetString("request_id"))
+	return queue.WithMetadata(ctx, queue.MetaTraceParent, c.GetHeader("traceparent"))
+}
+
+// errorBody is the error response: the error itself, its code, and a message
+// for people in the request's language.
+func errorBody(c *gin.Context, err error) gin.H {
+	code := errorCode(err)
+	return gin.H{"error": err.Error(), "code": code, "message": i18n.From(c).T("error." + code)}
 }
 
-// Security headers middleware
-func securityHeaders() gin.HandlerFunc {
+// Security headers middleware. HSTS is sent in release mode or whenever this
+// server terminates TLS itself.
+func securityHeaders(tlsEnabled bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("X-Content-Type-Options", "nosniff")
 		c.Header("X-Frame-Options", "DENY")
 		c.Header("X-XSS-Protection", "1; mode=block")
 		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
 
-		// Only add HSTS in production
-		if gin.Mode() == gin.ReleaseMode {
+		if tlsEnabled || gin.Mode() == gin.ReleaseMode {
 			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 		}
 
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// A report's day and zone are checked before the database is asked, so a
+// bad tz or date is a 400 even with the database down.
+func TestReportsRejectBadDays(t *testing.T) {
+	api := newTestAPI(t, unreachableDB)
+	admin := api.token(t, "admin", "admin")
+	tests := []struct {
+		path  string
+		query url.Values
+	}{
+		{"/v1/admin/reports/daily", url.Values{"tz": {"Mars/Olympus"}}},
+		{"/v1/admin/reports/daily", url.Values{"date": {"2024-02-30"}}},
+		{"/v1/admin/reports/daily", url.Values{"date": {"03/10/2024"}, "tz": {"America/New_York"}}},
+		{"/v1/reports/daily.pdf", url.Values{"tz": {"Mars/Olympus"}}},
+		{"/v1/reports/devices", url.Values{"tz": {"Mars/Olympus"}}},
+		{"/v1/reports/devices", url.Values{"from": {"2024-03-11"}, "to": {"2024-03-09"}}},
+		{"/v1/reports/devices", url.Values{"from": {"2024-13-01"}, "tz": {"Asia/Kolkata"}}},
+	}
+	for _, tt := range tests {
+		path := tt.path + "?" + tt.query.Encode()
+		status, body := api.do(t, http.MethodGet, path, admin, "")
+		if status != http.StatusBadRequest || body["code"] != "validation" {
+			t.Errorf("GET %s = %d %v, want 400 validation", path, status, body)
+		}
+	}
+	// A good day and zone get as far as the database.
+	for _, path := range []string{
+		"/v1/admin/reports/daily?date=2024-03-10&tz=America%2FNew_York",
+		"/v1/reports/devices?from=2024-03-09&to=2024-03-11&tz=America%2FNew_York&granularity=hour",
+	} {
+		if status, body := api.do(t, http.MethodGet, path, admin, ""); status != http.StatusServiceUnavailable {
+			t.Errorf("GET %s = %d %v, want 503 from the database", path, status, body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowUpstream answers health checks at once and holds every other request
+// until the caller hangs up, reporting each hang-up on aborted.
+func slowUpstream(t *testing.T) (*httptest.Server, <-chan string) {
+	t.Helper()
+	aborted := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			io.WriteString(w, `{"status":"ok"}`)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			aborted <- r.URL.Path
+		case <-time.After(30 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, aborted
+}
+
+// jpegDataURL is a small image as the JSON upload body carries it.
+func jpegDataURL(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// An upload stuck on a slow image store or face service is answered with a
+// 504 at UPLOAD_REQUEST_TIMEOUT, and the upstream call is abandoned rather
+// than left running after the client has its answer.
+func TestUploadTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      func(upstream string) []string
+		wantPath string
+	}{
+		{"image store", func(upstream string) []string {
+			return []string{"FACE_SKIP", "true"}
+		}, "/attendance/"},
+		{"face service", func(upstream string) []string {
+			return []string{"FACE_SKIP", "false", "FACE_SERVICE_URL", upstream, "UPLOAD_REQUIRE_FACE", "true"}
+		}, "/detect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, aborted := slowUpstream(t)
+			env := append([]string{
+				"UPLOAD_REQUEST_TIMEOUT", "300ms",
+				"IMAGE_STORAGE", "s3",
+				"S3_BUCKET", "attendance",
+				"S3_ENDPOINT", upstream.URL,
+				"S3_USE_PATH_STYLE", "true",
+				"S3_ACCESS_KEY_ID", "test-key",
+				"S3_SECRET_ACCESS_KEY", "test-secret",
+			}, tt.env(upstream.URL)...)
+			api := newTestAPI(t, unreachableDB, env...)
+			body, _ := json.Marshal(map[string]string{"data": jpegDataURL(t)})
+
+			start := time.Now()
+			status, resp := api.do(t, http.MethodPost, "/v1/upload", api.token(t, "kiosk-1", "admin"), string(body))
+			elapsed := time.Since(start)
+			if status != http.StatusGatewayTimeout || resp["code"] != "timeout" || resp["message"] == nil {
+				t.Fatalf("upload = %d %v, want 504 with code timeout", status, resp)
+			}
+			if elapsed > 5*time.Second {
+				t.Errorf("504 after %s, want it at the 300ms deadline", elapsed)
+			}
+			select {
+			case path := <-aborted:
+				if !strings.HasPrefix(path, tt.wantPath) {
+					t.Errorf("aborted call to %s, want %s...", path, tt.wantPath)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the upstream call was still running after the 504")
+			}
+		})
+	}
+}
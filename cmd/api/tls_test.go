@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned writes a certificate for 127.0.0.1 and its key to dir and
+// returns the file paths and the parsed certificate.
+func selfSigned(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "attendance test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// With TLS_CERT_FILE and TLS_KEY_FILE set the server terminates TLS on
+// HTTP_LISTEN_ADDR itself, and sends HSTS outside release mode too.
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, cert := selfSigned(t, t.TempDir())
+	s, cfg := newTestServer(t, unreachableDB,
+		"HTTP_LISTEN_ADDR", "127.0.0.1:0",
+		"TLS_CERT_FILE", certFile,
+		"TLS_KEY_FILE", keyFile,
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, err := newHTTPServer(ctx, cfg, s)
+	if err != nil {
+		t.Fatalf("newHTTPServer: %v", err)
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- serve(srv, ln) }()
+	defer func() {
+		srv.Shutdown(context.Background())
+		if err := <-done; err != http.ErrServerClosed {
+			t.Errorf("serve = %v, want ErrServerClosed", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+	base := "https://" + ln.Addr().String()
+	resp, err := client.Get(base + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz over TLS: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Fatalf("connection state %+v, want TLS 1.2 or later", resp.TLS)
+	}
+	if got := resp.TLS.PeerCertificates[0]; !got.Equal(cert) {
+		t.Errorf("served certificate %s, want the configured one", got.Subject)
+	}
+	if hsts := resp.Header.Get("Strict-Transport-Security"); hsts == "" {
+		t.Error("no Strict-Transport-Security header over TLS in test mode")
+	}
+
+	// Plain HTTP on the TLS port is refused.
+	plain, err := http.Get("http://" + ln.Addr().String() + "/healthz")
+	if err == nil {
+		plain.Body.Close()
+		if plain.StatusCode != http.StatusBadRequest {
+			t.Errorf("plain HTTP = %d, want 400", plain.StatusCode)
+		}
+	}
+
+	// Protocols older than TLS 1.2 are refused.
+	old := &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS11}
+	if conn, err := tls.Dial("tcp", ln.Addr().String(), old); err == nil {
+		conn.Close()
+		t.Error("TLS 1.1 handshake succeeded")
+	}
+}
+
+// An unreadable key pair fails at startup rather than on the first handshake.
+func TestServeTLSBadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _, _ := selfSigned(t, dir)
+	s, cfg := newTestServer(t, unreachableDB,
+		"HTTP_LISTEN_ADDR", "127.0.0.1:0",
+		"TLS_CERT_FILE", certFile,
+		"TLS_KEY_FILE", filepath.Join(dir, "missing.key"),
+	)
+	if _, err := newHTTPServer(context.Background(), cfg, s); err == nil {
+		t.Fatal("newHTTPServer succeeded without a key")
+	}
+}
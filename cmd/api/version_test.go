@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// /v1/version needs no token and reports the "dev" defaults of a build
+// without -ldflags; /metrics exports the same build.
+func TestVersion(t *testing.T) {
+	api := newTestAPI(t, unreachableDB)
+	status, body := api.do(t, http.MethodGet, "/v1/version", "", "")
+	if status != http.StatusOK {
+		t.Fatalf("GET /v1/version = %d %v", status, body)
+	}
+	want := map[string]any{"version": "dev", "commit": "dev", "build_time": "dev", "go_version": runtime.Version()}
+	if len(body) != len(want) {
+		t.Errorf("body = %v, want exactly the keys of %v", body, want)
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("%s = %v, want %q", k, body[k], v)
+		}
+	}
+
+	resp, err := api.Client().Get(api.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scrape, _ := io.ReadAll(resp.Body)
+	line := `build_info{commit="dev",go_version="` + runtime.Version() + `",version="dev"} 1`
+	if !strings.Contains(string(scrape), line) {
+		t.Errorf("/metrics is missing %s", line)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/config"
+	"attendance/internal/store"
+)
+
+// csvColumns is the expected column order; a header row with these names is skipped.
+var csvColumns = []string{"user_id", "device_id", "occurred_at", "location", "status"}
+
+// Importer backfills attendance_events from a legacy CSV export.
+//
+//	importer [-dry-run] [-batch 1000] file.csv
+func main() {
+	dryRun := flag.Bool("dry-run", false, "validate the file without writing to the database")
+	batchSize := flag.Int("batch", attendance.ImportBatchSize, "rows per INSERT transaction")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] file.csv\n\ncolumns: %s\n\n", os.Args[0], strings.Join(csvColumns, ","))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *batchSize <= 0 || *batchSize > attendance.ImportBatchSize {
+		log.Fatalf("-batch must be between 1 and %d", attendance.ImportBatchSize)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("open csv: %v", err)
+	}
+	defer f.Close()
+
+	var repo *attendance.Repository
+	if !*dryRun {
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("invalid config: %v", err)
+		}
+		db, err := store.NewDB(cfg.DatabaseURL, store.PoolOptions{MaxOpenConns: 2, MaxIdleConns: 1})
+		if err != nil {
+			log.Fatalf("db connect failed: %v", err)
+		}
+		defer db.Close()
+		if err := store.WaitForDB(context.Background(), db, 0); err != nil {
+			log.Fatalf("db connect failed: %v", err)
+		}
+		// Batches are large; allow more than the API's per-query timeout.
+		repo = attendance.NewRepository(db.Client, time.Minute)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sum, err := importCSV(ctx, f, repo, *batchSize)
+	inserted := "inserted"
+	if *dryRun {
+		inserted = "valid"
+	}
+	fmt.Fprintf(os.Stderr, "read %d rows: %d %s, %d duplicates skipped, %d rejected\n",
+		sum.read, sum.inserted, inserted, sum.flushed-sum.inserted, len(sum.rejected))
+	for _, rej := range sum.rejected {
+		fmt.Fprintf(os.Stderr, "  line %d: %s\n", rej.line, rej.reason)
+	}
+	if err != nil {
+		log.Fatalf("import stopped: %v", err)
+	}
+	if *dryRun {
+		fmt.Fprintln(os.Stderr, "dry run: nothing written")
+	}
+}
+
+type rejection struct {
+	line   int
+	reason string
+}
+
+type summary struct {
+	read, valid int
+	flushed     int // valid rows sent to the database
+	inserted    int
+	rejected    []rejection
+}
+
+// importCSV validates rows and inserts them in batches, one transaction per
+// batch, so an interrupted import can simply be re-run. A nil repo only validates.
+func importCSV(ctx context.Context, r io.Reader, repo *attendance.Repository, batchSize int) (summary, error) {
+	var sum summary
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	batch := make([]attendance.Event, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if repo == nil {
+			sum.flushed += len(batch)
+			sum.inserted += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		n, err := repo.ImportEvents(ctx, batch)
+		if err != nil {
+			return err
+		}
+		sum.flushed += len(batch)
+		sum.inserted += n
+		batch = batch[:0]
+		fmt.Fprintf(os.Stderr, "imported %d/%d valid rows\n", sum.inserted, sum.valid)
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return sum, err
+			}
+			sum.read++
+			sum.rejected = append(sum.rejected, rejection{perr.Line, perr.Err.Error()})
+			continue
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), csvColumns[0]) {
+			continue // header
+		}
+		sum.read++
+		evt, err := parseRow(record)
+		if err != nil {
+			sum.rejected = append(sum.rejected, rejection{line, err.Error()})
+			continue
+		}
+		sum.valid++
+		batch = append(batch, evt)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return sum, err
+			}
+		}
+	}
+	return sum, flush()
+}
+
+// parseRow validates one CSV record. Location is optional; an empty status
+// defaults to processed, since legacy punches were all accepted.
+func parseRow(record []string) (attendance.Event, error) {
+	if len(record) < 3 || len(record) > len(csvColumns) {
+		return attendance.Event{}, fmt.Errorf("expected 3 to %d columns, got %d", len(csvColumns), len(record))
+	}
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	evt := attendance.Event{
+		UserID:   field(0),
+		DeviceID: field(1),
+		Location: field(3),
+		Status:   field(4),
+	}
+	if evt.UserID == "" {
+		return evt, errors.New("user_id is empty")
+	}
+	if evt.DeviceID == "" {
+		return evt, errors.New("device_id is empty")
+	}
+	when, err := time.Parse(time.RFC3339, field(2))
+	if err != nil {
+		return evt, fmt.Errorf("occurred_at %q is not RFC3339", field(2))
+	}
+	if when.After(time.Now().Add(time.Minute)) {
+		return evt, fmt.Errorf("occurred_at %s is in the future", field(2))
+	}
+	evt.When = when.UTC()
+	if evt.Status == "" {
+		evt.Status = attendance.StatusProcessed
+	}
+	if !attendance.IsTerminal(evt.Status) {
+		return evt, fmt.Errorf("status %q is not a final status", evt.Status)
+	}
+	return evt, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/testdb"
+)
+
+const fixture = "testdata/history.csv"
+
+// fixtureRejections are the fixture's invalid lines and why they fail.
+var fixtureRejections = []rejection{
+	{6, "user_id is empty"},
+	{7, "device_id is empty"},
+	{8, `occurred_at "02/03/2024 09:00" is not RFC3339`},
+	{9, "occurred_at 2099-01-01T09:00:00Z is in the future"},
+	{10, `status "pending" is not a final status`},
+	{11, "expected 3 to 5 columns, got 2"},
+	{12, "expected 3 to 5 columns, got 6"},
+	{15, `bare " in non-quoted-field`},
+}
+
+func importFixture(t *testing.T, repo *attendance.Repository, batchSize int) summary {
+	t.Helper()
+	f, err := os.Open(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sum, err := importCSV(context.Background(), f, repo, batchSize)
+	if err != nil {
+		t.Fatalf("importCSV: %v", err)
+	}
+	return sum
+}
+
+func TestImportCSVDryRun(t *testing.T) {
+	sum := importFixture(t, nil, 2)
+	if sum.read != 15 || sum.valid != 7 || sum.inserted != 7 {
+		t.Errorf("read %d, valid %d, inserted %d; want 15, 7, 7", sum.read, sum.valid, sum.inserted)
+	}
+	if !slices.Equal(sum.rejected, fixtureRejections) {
+		t.Errorf("rejected %v\nwant %v", sum.rejected, fixtureRejections)
+	}
+}
+
+// The fixture loads in batches smaller than the file; its repeated row and
+// a second run of the whole file are skipped as duplicates.
+func TestImportCSV(t *testing.T) {
+	db := testdb.Open(t)
+	repo := attendance.NewRepository(db, 0)
+	ctx := context.Background()
+	if err := repo.UpsertEmployee(ctx, "emp-1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := importFixture(t, repo, 2)
+	if sum.valid != 7 || sum.flushed != 7 || sum.inserted != 6 {
+		t.Errorf("valid %d, flushed %d, inserted %d; want 7, 7, 6", sum.valid, sum.flushed, sum.inserted)
+	}
+	if !slices.Equal(sum.rejected, fixtureRejections) {
+		t.Errorf("rejected %v\nwant %v", sum.rejected, fixtureRejections)
+	}
+
+	type row struct {
+		user, device, status, location string
+		when                           time.Time
+		unknown                        bool
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, device_id, status, COALESCE(location, ''), occurred_at, unknown_user
+		FROM attendance_events ORDER BY occurred_at, user_id
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.user, &r.device, &r.status, &r.location, &r.when, &r.unknown); err != nil {
+			t.Fatal(err)
+		}
+		r.when = r.when.UTC()
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		when, _ := time.Parse(time.RFC3339, s)
+		return when
+	}
+	want := []row{
+		// 09:02 in India is 03:32 UTC; an empty status is processed.
+		{"emp-2", "legacy-1", attendance.StatusProcessed, "", at("2024-03-01T03:32:00Z"), true},
+		{"emp-1", "legacy-1", attendance.StatusProcessed, "Main gate", at("2024-03-01T08:59:00Z"), false},
+		{"emp-1", "legacy-2", attendance.StatusProcessed, "Back door", at("2024-03-01T17:30:00Z"), false},
+		{"emp-3", "legacy-2", attendance.StatusUnmatched, "Lobby, east wing", at("2024-03-02T09:05:00Z"), true},
+		{"emp-4", "legacy-2", attendance.StatusFailed, "", at("2024-03-02T09:06:00Z"), true},
+		{"emp-5", "legacy-3", attendance.StatusRejected, "", at("2024-03-03T08:00:00Z"), true},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("imported rows:\n%v\nwant\n%v", got, want)
+	}
+
+	var devices []string
+	drows, err := db.QueryContext(ctx, `SELECT device_id FROM devices ORDER BY device_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drows.Close()
+	for drows.Next() {
+		var d string
+		if err := drows.Scan(&d); err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, d)
+	}
+	if want := []string{"legacy-1", "legacy-2", "legacy-3"}; !slices.Equal(devices, want) {
+		t.Errorf("devices %v, want %v created", devices, want)
+	}
+
+	// Re-running an interrupted or finished import adds nothing.
+	again := importFixture(t, repo, 1000)
+	if again.flushed != 7 || again.inserted != 0 {
+		t.Errorf("second run flushed %d, inserted %d; want 7, 0", again.flushed, again.inserted)
+	}
+}
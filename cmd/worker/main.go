@@ -2,22 +2,63 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"attendance/internal/anomaly"
 	"attendance/internal/attendance"
+	"attendance/internal/cache"
 	"attendance/internal/config"
+	"attendance/internal/faceaudit"
 	"attendance/internal/faceclient"
+	"attendance/internal/jobs"
+	"attendance/internal/notify"
+	"attendance/internal/notifybus"
+	"attendance/internal/outbox"
+	"attendance/internal/push"
 	"attendance/internal/queue"
+	"attendance/internal/retention"
+	"attendance/internal/settings"
+	"attendance/internal/storage"
 	"attendance/internal/store"
+	"attendance/internal/version"
+	"attendance/internal/worker"
 )
 
 // Worker consumes queue messages, calls face service, and updates events.
 func main() {
-	cfg := config.Load()
+	checkConfig := flag.Bool("check-config", false, "validate and print the resolved configuration, then exit")
+	runRetention := flag.Bool("retention", false, "run one retention pass (purge old images, archive old events), then exit")
+	dryRun := flag.Bool("dry-run", false, "with -retention, only report what would be removed")
+	runAnalyze := flag.Bool("analyze", false, "analyze one day's check-ins for anomalies, then exit")
+	analyzeDay := flag.String("day", "", "with -analyze, the day (YYYY-MM-DD) to analyze; default yesterday")
+	flag.Parse()
+
+	cfg, loadErr := config.Load()
+	if *checkConfig {
+		fmt.Printf("%+v\n", cfg.Redacted())
+		if err := errors.Join(loadErr, cfg.Validate()); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("config ok")
+		return
+	}
+	log.Printf("worker %s", version.Get())
+	log.Printf("effective config: %+v", cfg.Redacted())
+	if err := errors.Join(loadErr, cfg.Validate()); err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -30,72 +71,195 @@ func main() {
 		cancel()
 	}()
 
-	db, err := store.NewDB(cfg.DatabaseURL)
+	db, err := store.NewDB(cfg.DatabaseURL, store.PoolOptions{
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnMaxLifetime,
+	})
 	if err != nil {
-		log.Fatalf("db connect failed: %v", err)
+		log.Fatalf("db config invalid: %v", err)
 	}
 	defer db.Close()
+	if err := store.WaitForDB(ctx, db, cfg.WaitForDepsTimeout); err != nil {
+		log.Fatalf("db connect failed: %v", err)
+	}
+
+	repo := attendance.NewRepository(db.Client, cfg.DBQueryTimeout)
+	images, err := storage.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("image storage config invalid: %v", err)
+	}
+	faceAudit := faceaudit.NewRecorder(db.Client, 256)
+	defer faceAudit.Close()
+	retentionJob := retention.Job{
+		Repo:               repo,
+		Images:             images,
+		ImageRetention:     cfg.ImageRetention,
+		EventRetention:     cfg.EventRetention,
+		FaceAudit:          faceAudit,
+		FaceAuditRetention: cfg.FaceAuditRetention,
+		BatchSize:          cfg.RetentionBatchSize,
+		Pause:              cfg.RetentionBatchPause,
+		DryRun:             *dryRun,
+	}
+	if *runRetention {
+		if _, err := retentionJob.Run(ctx); err != nil {
+			log.Fatalf("retention failed: %v", err)
+		}
+		return
+	}
 
-	redisClient := store.NewRedis(cfg.RedisAddr)
+	face := faceclient.New(cfg.FaceServiceURL, cfg.FaceSkip)
+	analyzer := anomaly.Analyzer{
+		Repo:           repo,
+		Images:         storage.SignerFromConfig(cfg, images),
+		MaxSpeedKmh:    cfg.AnomalyMaxSpeedKmh,
+		MinDistanceKm:  cfg.AnomalyMinDistanceKm,
+		MatchThreshold: cfg.FaceMatchThreshold,
+		Location:       cfg.ReportLocation(),
+	}
+	if cfg.AnomalyFaceSearch {
+		analyzer.Face = face
+	}
+	if *runAnalyze {
+		day := time.Now().In(analyzer.Location).AddDate(0, 0, -1)
+		if *analyzeDay != "" {
+			from, _, err := attendance.ParseDay(*analyzeDay, analyzer.Location)
+			if err != nil {
+				log.Fatalf("invalid -day: %v", err)
+			}
+			day = from
+		}
+		if _, err := analyzer.Run(ctx, day); err != nil {
+			log.Fatalf("anomaly analysis failed: %v", err)
+		}
+		return
+	}
 
-	var q queue.Queue
+	// The memory queue only exists inside the API process; a standalone
+	// worker would wait on an empty queue of its own forever.
 	if cfg.QueueBackend == "memory" {
-		q = queue.NewInMemory(64)
-	} else {
-		q = queue.NewRedisQueue(redisClient.Client, "attendance:checkins")
+		log.Fatal("QUEUE_BACKEND=memory cannot be consumed by a separate worker; set RUN_WORKER_INPROCESS=true on the API instead")
 	}
 
-	repo := attendance.NewRepository(db.Client)
-	face := faceclient.New(cfg.FaceServiceURL, cfg.FaceSkip)
+	redisClient, err := store.NewRedis(store.RedisOptions{
+		URL:      cfg.RedisURL,
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+	if err != nil {
+		log.Fatalf("redis config invalid: %v", err)
+	}
+	if err := store.WaitForRedis(ctx, redisClient, cfg.WaitForDepsTimeout); err != nil {
+		log.Fatalf("redis connect failed: %v", err)
+	}
 
-	// Check face service health on startup
-	if !cfg.FaceSkip {
-		if err := face.Health(ctx); err != nil {
-			log.Printf("WARNING: Face service not available: %v", err)
-			log.Println("Worker will retry face processing when events arrive")
-		} else {
-			log.Println("Face service connected")
-		}
+	// Expose worker metrics (consumption rate, queue depth) for scraping
+	if cfg.WorkerMetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(cfg.WorkerMetricsAddr, mux); err != nil {
+				log.Printf("metrics listener stopped: %v", err)
+			}
+		}()
 	}
 
-	messages, err := q.Consume(ctx)
+	q, err := queue.FromConfig(cfg, redisClient.Client)
 	if err != nil {
-		log.Fatalf("queue consume init failed: %v", err)
+		log.Fatalf("queue config invalid: %v", err)
 	}
 
-	log.Println("worker started, waiting for messages...")
-	for msg := range messages {
-		if msg.Type != "checkin" {
-			continue
-		}
+	go queue.Monitor(ctx, q, 15*time.Second)
 
-		id := string(msg.Body)
-		log.Printf("processing event %s", id)
+	workerName := cfg.QueueConsumerName
+	if workerName == "" {
+		workerName = queue.DefaultConsumerName()
+	}
+	go worker.Heartbeat(ctx, redisClient.Client, workerName)
 
-		evt, err := repo.GetEvent(ctx, id)
-		if err != nil {
-			log.Printf("fetch event %s failed: %v", id, err)
-			continue
-		}
+	jobStore := jobs.NewStore(db.Client, cfg.DBQueryTimeout)
+	dispatcher := jobs.NewDispatcher(jobStore, cfg.JobPollInterval, cfg.JobLease)
+	dispatcher.Handle(retention.JobType, retentionJob.Handle)
+	if cfg.RetentionInterval > 0 {
+		go retention.Schedule(ctx, jobStore, dispatcher, cfg.RetentionInterval)
+	}
 
-		// Call face service to get embedding and score
-		result, err := face.EmbedWithScore(ctx, evt.ImageURL)
-		if err != nil {
-			log.Printf("face embed failed for %s: %v", id, err)
-			_ = repo.UpdateEventStatus(ctx, id, "failed", nil)
-			continue
-		}
+	if cfg.OutboxRelayInterval > 0 {
+		go outbox.Relay{
+			Repo:      repo,
+			Queue:     q,
+			Interval:  cfg.OutboxRelayInterval,
+			Grace:     cfg.OutboxGrace,
+			BatchSize: cfg.OutboxBatchSize,
+			Retain:    cfg.OutboxRetention,
+		}.Run(ctx)
+	}
 
-		// Use actual detection confidence from face service
-		score := result.Score
-		log.Printf("event %s: detected %d face(s), confidence: %.2f", id, result.FacesDetected, score)
+	if cfg.ReconcileInterval > 0 {
+		go worker.Reconciler{
+			Repo:       repo,
+			Queue:      q,
+			StaleAfter: cfg.ReconcileStaleAfter,
+			BatchSize:  cfg.ReconcileBatchSize,
+		}.Schedule(ctx, cfg.ReconcileInterval)
+	}
 
-		// Mark as processed with the face detection score
-		_ = repo.UpdateEventStatus(ctx, id, "processed", &score)
-		log.Printf("event %s processed successfully", id)
+	notifier := notify.NewNotifier(notify.FromConfig(cfg), 64)
+	defer notifier.Close()
+	if cfg.AbsenceReportAt != "" && len(cfg.AdminNotifyEmails) > 0 {
+		go notify.AbsenceReport{Repo: repo, Notifier: notifier, To: cfg.AdminNotifyEmails, Location: cfg.ReportLocation()}.Schedule(ctx, cfg.AbsenceReportAt)
+	}
+
+	if cfg.AnomalyAnalyzeAt != "" {
+		go analyzer.Schedule(ctx, cfg.AnomalyAnalyzeAt)
+	}
+
+	pushSender, err := push.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("push config invalid: %v", err)
+	}
+	pusher := push.NewPusher(pushSender, repo, 256)
+	defer pusher.Close()
+	// The worker only publishes, so the bus needs no Run.
+	bus, err := notifybus.FromConfig(cfg, db.Client, redisClient.Client)
+	if err != nil {
+		log.Fatalf("notify config invalid: %v", err)
+	}
 
-		time.Sleep(10 * time.Millisecond) // Small delay between processing
+	settingsProvider := settings.NewProvider(db.Client, cfg.DBQueryTimeout, settings.Defaults(cfg), cfg.SettingsCacheTTL, redisClient.Client)
+	go settingsProvider.Watch(ctx)
+
+	deps := worker.Deps{
+		Repo:  repo,
+		Face:  face,
+		Queue: q,
+		Quality: attendance.QualityThresholds{
+			MaxBlur:        cfg.FaceMaxBlur,
+			MinFaceSize:    cfg.FaceMinSize,
+			RequireFrontal: cfg.FaceRequireFrontal,
+		},
+		MatchThreshold:  cfg.FaceMatchThreshold,
+		Verify:          cfg.VerifyOnCheckin,
+		RequireLiveness: cfg.RequireLiveness,
+		Settings:        settingsProvider,
+		Failures:        anomaly.NewTracker(redisClient.Client, cfg.DeviceFailureThreshold, cfg.DeviceFailureWindow),
+		Shifts:          attendance.NewShiftCache(repo, cfg.ShiftCacheTTL),
+		Notifier:        notifier,
+		NotifyTo:        cfg.AdminNotifyEmails,
+		Cache:           cache.NewEvents(repo, redisClient.Client, cfg.CacheTTL),
+		Claims:          worker.NewClaims(redisClient.Client, cfg.CheckinLeaseTTL, cfg.CheckinProcessedTTL),
+		FaceAudit:       faceAudit,
+		Hooks:           worker.HooksFromConfig(cfg, pusher, bus, repo),
+		ImageURLs:       storage.SignerFromConfig(cfg, images),
+		ReenrollRate:    cfg.ReenrollRate,
+		Jobs:            dispatcher,
 	}
+	dispatcher.Handle(worker.JobFaceReenroll, worker.Reenroll(deps))
+	go dispatcher.Run(ctx)
 
-	log.Println("worker stopped")
+	if err := worker.Run(ctx, deps); err != nil {
+		log.Fatalf("worker failed: %v", err)
+	}
 }
@@ -41,6 +41,9 @@ QUALITY_THRESHOLD = float(os.getenv("QUALITY_THRESHOLD", "0.3"))
 DETECTION_SIZE = int(os.getenv("DETECTION_SIZE", "640"))
 USE_GPU = os.getenv("USE_GPU", "false").lower() == "true"
 REDIS_URL = os.getenv("REDIS_URL", "")
+# Embedding model pack. Changing it makes existing enrollments incomparable;
+# the API reports enrollments made with another model for re-enrollment.
+MODEL_NAME = os.getenv("MODEL_NAME", "buffalo_l")
 
 # Model loading (lazy initialization)
 face_model = None
@@ -74,7 +77,7 @@ def get_face_model():
             from insightface.app import FaceAnalysis
             providers = ['CUDAExecutionProvider', 'CPUExecutionProvider'] if USE_GPU else ['CPUExecutionProvider']
             face_model = FaceAnalysis(
-                name='buffalo_l',  # High accuracy model (300MB)
+                name=MODEL_NAME,  # buffalo_l: high accuracy model (300MB)
                 providers=providers,
                 allowed_modules=['detection', 'recognition', 'genderage']
             )
@@ -86,6 +89,15 @@ def get_face_model():
     return face_model
 
 
+def model_version() -> str:
+    """Version of the library that produced the embeddings, empty for mock."""
+    try:
+        import insightface
+        return insightface.__version__
+    except ImportError:
+        return ""
+
+
 # ============ Pydantic Models ============
 
 class FaceQuality(BaseModel):
@@ -209,6 +221,15 @@ class IdentifyResponse(BaseModel):
     liveness: Optional[dict] = None
 
 
+class DetectRequest(BaseModel):
+    """Request for counting faces in uploaded image bytes."""
+    image_data: str = Field(..., description="Base64 encoded image (data:image/jpeg;base64,... or raw base64)")
+
+
+class DetectResponse(BaseModel):
+    faces_detected: int
+
+
 # ============ Helper Functions ============
 
 def download_image(url: str) -> Image.Image:
@@ -560,7 +581,8 @@ async def health():
     return {
         "status": "ok",
         "model_loaded": model is not None and model != "mock",
-        "model_name": "buffalo_l" if model and model != "mock" else "mock",
+        "model_name": MODEL_NAME if model and model != "mock" else "mock",
+        "model_version": model_version() if model and model != "mock" else "",
         "gpu_enabled": USE_GPU,
         "redis_connected": r is not None,
         "gallery_size": gallery_count,
@@ -891,6 +913,22 @@ async def batch_embed(request: BatchEmbedRequest):
     return BatchEmbedResponse(results=results)
 
 
+@app.post("/detect", response_model=DetectResponse)
+async def detect(request: DetectRequest):
+    """
+    Count faces in an image without embedding them.
+
+    Cheap pre-check for uploads, so images without a face are rejected
+    before a check-in is submitted.
+    """
+    image = parse_base64_image(request.image_data)
+    model = get_face_model()
+    if model == "mock":
+        return DetectResponse(faces_detected=1)
+    faces = model.get(np.array(image))
+    return DetectResponse(faces_detected=len(faces))
+
+
 @app.post("/analyze")
 async def analyze(image_url: str):
     """
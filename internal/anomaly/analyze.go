@@ -0,0 +1,237 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/storage"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var anomaliesFoundTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anomalies_found_total",
+	Help: "New findings stored by the nightly anomaly analysis, by kind.",
+}, []string{"kind"})
+
+// earthRadiusKm is the mean Earth radius used by Haversine.
+const earthRadiusKm = 6371.0
+
+// Position is a point in decimal degrees.
+type Position struct {
+	Lat float64
+	Lng float64
+}
+
+// Haversine returns the great-circle distance between a and b in kilometres.
+func Haversine(a, b Position) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * rad
+	dLng := (b.Lng - a.Lng) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ParsePosition reads a "lat,lng" location as kiosks with GPS send it. Free
+// text locations ("Main gate") report false.
+func ParsePosition(s string) (Position, bool) {
+	latStr, lngStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return Position{}, false
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lng, err2 := strconv.ParseFloat(strings.TrimSpace(lngStr), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return Position{}, false
+	}
+	return Position{Lat: lat, Lng: lng}, true
+}
+
+// position returns where a check-in happened: the coordinates it carries, or
+// else its device's geofence center.
+func position(e attendance.AnalysisEvent) (Position, bool) {
+	if p, ok := ParsePosition(e.Location); ok {
+		return p, true
+	}
+	if e.DeviceLat != nil && e.DeviceLng != nil {
+		return Position{Lat: *e.DeviceLat, Lng: *e.DeviceLng}, true
+	}
+	return Position{}, false
+}
+
+// ImpossibleTravel flags each check-in that lies more than minDistanceKm from
+// the same user's previous located check-in and would have needed a speed
+// above maxSpeedKmh to reach. Events must be ordered by user and time, as
+// Repository.AnalysisEvents returns them; events without a position are
+// skipped.
+func ImpossibleTravel(events []attendance.AnalysisEvent, maxSpeedKmh, minDistanceKm float64) []attendance.Anomaly {
+	var found []attendance.Anomaly
+	var prev *attendance.AnalysisEvent
+	var prevPos Position
+	for i := range events {
+		e := &events[i]
+		pos, ok := position(*e)
+		if !ok {
+			continue
+		}
+		if prev != nil && prev.UserID == e.UserID {
+			km := Haversine(prevPos, pos)
+			hours := e.When.Sub(prev.When).Hours()
+			if km > minDistanceKm {
+				speed := math.Inf(1)
+				if hours > 0 {
+					speed = km / hours
+				}
+				if speed > maxSpeedKmh {
+					other := prev.ID
+					details := map[string]any{
+						"distance_km":    math.Round(km*10) / 10,
+						"elapsed_s":      int64(e.When.Sub(prev.When).Seconds()),
+						"from_device_id": prev.DeviceID,
+						"to_device_id":   e.DeviceID,
+					}
+					if !math.IsInf(speed, 0) {
+						details["speed_kmh"] = math.Round(speed)
+					}
+					found = append(found, attendance.Anomaly{
+						Kind:         attendance.AnomalyImpossibleTravel,
+						UserID:       e.UserID,
+						EventID:      e.ID,
+						OtherEventID: &other,
+						Details:      details,
+					})
+				}
+			}
+		}
+		prev, prevPos = e, pos
+	}
+	return found
+}
+
+// Analyzer looks for anomalies in a day's processed check-ins.
+type Analyzer struct {
+	Repo *attendance.Repository
+	// Face searches each check-in image in the enrolled gallery; nil or a
+	// client in skip mode disables the face mismatch check.
+	Face *faceclient.Client
+	// Images signs stored image URLs before they go to the face service; nil
+	// passes them as stored.
+	Images *storage.Signer
+	// MaxSpeedKmh and MinDistanceKm bound plausible travel between check-ins.
+	MaxSpeedKmh   float64
+	MinDistanceKm float64
+	// MatchThreshold is the minimum similarity for a search match to count.
+	MatchThreshold float64
+	// Location defines the calendar days analyzed; nil is UTC.
+	Location *time.Location
+}
+
+func (a Analyzer) location() *time.Location {
+	if a.Location == nil {
+		return time.UTC
+	}
+	return a.Location
+}
+
+// Run analyzes the day containing day and stores new findings. Re-running a
+// day does not duplicate them.
+func (a Analyzer) Run(ctx context.Context, day time.Time) (int, error) {
+	from, to := attendance.DayBounds(day, a.location())
+	events, err := a.Repo.AnalysisEvents(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	found := ImpossibleTravel(events, a.MaxSpeedKmh, a.MinDistanceKm)
+	mismatches, err := a.faceMismatches(ctx, events)
+	if err != nil {
+		return 0, err
+	}
+	found = append(found, mismatches...)
+
+	stored, err := a.Repo.InsertAnomalies(ctx, found)
+	if err != nil {
+		return 0, err
+	}
+	counted := map[string]int{}
+	for _, f := range found {
+		counted[f.Kind]++
+	}
+	for kind, n := range counted {
+		anomaliesFoundTotal.WithLabelValues(kind).Add(float64(n))
+	}
+	log.Printf("anomaly: analyzed %d check-ins on %s, %d findings (%d new)",
+		len(events), from.Format(time.DateOnly), len(found), stored)
+	return stored, nil
+}
+
+// faceMismatches searches each check-in image in the gallery and flags those
+// whose best match is another user. Images the service cannot read are
+// skipped; an unreachable service aborts the run.
+func (a Analyzer) faceMismatches(ctx context.Context, events []attendance.AnalysisEvent) ([]attendance.Anomaly, error) {
+	if a.Face == nil || a.Face.Skip {
+		return nil, nil
+	}
+	var found []attendance.Anomaly
+	for _, e := range events {
+		if e.ImageURL == "" {
+			continue
+		}
+		res, err := a.Face.Search(ctx, a.Images.URL(e.ImageURL), 1, a.MatchThreshold)
+		if faceclient.IsUnavailable(err) || ctx.Err() != nil {
+			return nil, fmt.Errorf("face search: %w", err)
+		}
+		if err != nil {
+			log.Printf("anomaly: face search for event %s failed: %v", e.ID, err)
+			continue
+		}
+		if len(res.Matches) == 0 || res.Matches[0].UserID == e.UserID {
+			continue
+		}
+		top := res.Matches[0]
+		found = append(found, attendance.Anomaly{
+			Kind:        attendance.AnomalyFaceMismatch,
+			UserID:      e.UserID,
+			EventID:     e.ID,
+			OtherUserID: &top.UserID,
+			Details: map[string]any{
+				"similarity": top.Similarity,
+				"device_id":  e.DeviceID,
+			},
+		})
+	}
+	return found, nil
+}
+
+// Schedule analyzes the previous day every day at the wall-clock time at
+// ("HH:MM") in the analyzer's location until ctx is cancelled.
+func (a Analyzer) Schedule(ctx context.Context, at string) error {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return fmt.Errorf("invalid analysis time %q: %w", at, err)
+	}
+	loc := a.location()
+	for {
+		now := time.Now().In(loc)
+		next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+		if _, err := a.Run(ctx, next.AddDate(0, 0, -1)); err != nil && ctx.Err() == nil {
+			log.Printf("anomaly: analysis failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+)
+
+var (
+	mumbai = Position{Lat: 19.0760, Lng: 72.8777}
+	delhi  = Position{Lat: 28.6139, Lng: 77.2090}
+	london = Position{Lat: 51.5074, Lng: -0.1278}
+	paris  = Position{Lat: 48.8566, Lng: 2.3522}
+)
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Position
+		want float64
+	}{
+		{"same point", mumbai, mumbai, 0},
+		{"London to Paris", london, paris, 343.6},
+		{"Mumbai to Delhi", mumbai, delhi, 1148.1},
+		{"quarter of the equator", Position{0, 0}, Position{0, 90}, math.Pi / 2 * earthRadiusKm},
+		{"antipodes", Position{90, 0}, Position{-90, 0}, math.Pi * earthRadiusKm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Haversine(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("Haversine = %.2f km, want %.1f", got, tt.want)
+			}
+			if back := Haversine(tt.b, tt.a); math.Abs(back-got) > 1e-9 {
+				t.Errorf("Haversine is not symmetric: %v and %v", got, back)
+			}
+		})
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   Position
+		wantOK bool
+	}{
+		{"19.0760,72.8777", mumbai, true},
+		{" -33.8688 , 151.2093 ", Position{-33.8688, 151.2093}, true},
+		{"90,-180", Position{90, -180}, true},
+		{"Main gate", Position{}, false},
+		{"Gate 2, Building B", Position{}, false},
+		{"19.0760", Position{}, false},
+		{"91,0", Position{}, false},
+		{"0,180.5", Position{}, false},
+		{"", Position{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParsePosition(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParsePosition(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// checkIn is a synthetic check-in by user at a "lat,lng" location, minutes
+// after 09:00 UTC on a fixed day.
+func checkIn(id, user, device string, minutes int, location string) attendance.AnalysisEvent {
+	return attendance.AnalysisEvent{
+		ID:       id,
+		UserID:   user,
+		DeviceID: device,
+		When:     time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute),
+		Location: location,
+	}
+}
+
+func TestImpossibleTravel(t *testing.T) {
+	delhiLat, delhiLng := delhi.Lat, delhi.Lng
+	atDelhiKiosk := checkIn("e2", "u1", "kiosk-delhi", 30, "Reception")
+	atDelhiKiosk.DeviceLat, atDelhiKiosk.DeviceLng = &delhiLat, &delhiLng
+
+	tests := []struct {
+		name   string
+		events []attendance.AnalysisEvent
+		want   [][2]string // flagged {event, earlier event}
+	}{
+		{"Mumbai then Delhi in half an hour", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "kiosk-delhi", 30, "28.6139,77.2090"),
+		}, [][2]string{{"e2", "e1"}}},
+		{"Mumbai then Delhi by a two hour flight", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "kiosk-delhi", 120, "28.6139,77.2090"),
+		}, nil},
+		{"two gates closer than the minimum distance", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "gate-1", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "gate-2", 0, "19.0900,72.8777"),
+		}, nil},
+		{"two cities at the same instant", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "kiosk-delhi", 0, "28.6139,77.2090"),
+		}, [][2]string{{"e2", "e1"}}},
+		{"different users are not compared", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u2", "kiosk-delhi", 5, "28.6139,77.2090"),
+		}, nil},
+		{"unlocated check-ins are skipped", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "kiosk-lobby", 10, "Lobby"),
+			checkIn("e3", "u1", "kiosk-delhi", 20, "28.6139,77.2090"),
+		}, [][2]string{{"e3", "e1"}}},
+		{"the device geofence stands in for a free text location", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			atDelhiKiosk,
+		}, [][2]string{{"e2", "e1"}}},
+		{"each leg is compared with the one before", []attendance.AnalysisEvent{
+			checkIn("e1", "u1", "kiosk-mumbai", 0, "19.0760,72.8777"),
+			checkIn("e2", "u1", "kiosk-delhi", 30, "28.6139,77.2090"),
+			checkIn("e3", "u1", "kiosk-delhi", 40, "28.6139,77.2090"),
+			checkIn("e4", "u1", "kiosk-mumbai", 60, "19.0760,72.8777"),
+		}, [][2]string{{"e2", "e1"}, {"e4", "e3"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := ImpossibleTravel(tt.events, 900, 50)
+			var got [][2]string
+			for _, f := range found {
+				if f.Kind != attendance.AnomalyImpossibleTravel || f.OtherEventID == nil {
+					t.Fatalf("finding %+v", f)
+				}
+				got = append(got, [2]string{f.EventID, *f.OtherEventID})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("flagged %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("flagged %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestImpossibleTravelDetails(t *testing.T) {
+	found := ImpossibleTravel([]attendance.AnalysisEvent{
+		checkIn("e1", "u1", "kiosk-london", 0, "51.5074,-0.1278"),
+		checkIn("e2", "u1", "kiosk-paris", 60, "48.8566,2.3522"),
+		checkIn("e3", "u1", "kiosk-london", 60, "51.5074,-0.1278"),
+	}, 300, 50)
+	if len(found) != 2 {
+		t.Fatalf("%d findings, want 2", len(found))
+	}
+	f := found[0]
+	if f.UserID != "u1" || f.EventID != "e2" {
+		t.Errorf("finding %+v", f)
+	}
+	want := map[string]any{
+		"distance_km":    343.6,
+		"elapsed_s":      int64(3600),
+		"from_device_id": "kiosk-london",
+		"to_device_id":   "kiosk-paris",
+		"speed_kmh":      344.0,
+	}
+	for k, v := range want {
+		if f.Details[k] != v {
+			t.Errorf("details[%s] = %v (%T), want %v", k, f.Details[k], f.Details[k], v)
+		}
+	}
+	// Without elapsed time the speed is unbounded and left out of the details.
+	if _, ok := found[1].Details["speed_kmh"]; ok || found[1].Details["elapsed_s"] != int64(0) {
+		t.Errorf("same-instant details = %v, want elapsed_s 0 and no speed_kmh", found[1].Details)
+	}
+}
+
+// newFaceService answers /search with the matches listed for each image
+// URL; unknown images get a 422 as the service gives for unreadable ones.
+func newFaceService(t *testing.T, matches map[string][]faceclient.SearchMatch) *faceclient.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ImageURL string `json:"image_url"`
+		}
+		if r.URL.Path != "/search" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.NotFound(w, r)
+			return
+		}
+		m, ok := matches[req.ImageURL]
+		if !ok {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{"detail": "could not read image"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"matches": m, "faces_detected": 1})
+	}))
+	t.Cleanup(srv.Close)
+	return faceclient.New(srv.URL, false)
+}
+
+// A check-in whose face best matches someone else is flagged against that
+// user; own matches, no matches, missing and unreadable images are not.
+func TestFaceMismatches(t *testing.T) {
+	face := newFaceService(t, map[string][]faceclient.SearchMatch{
+		"https://img.example/own.jpg":      {{UserID: "u1", Similarity: 0.91}},
+		"https://img.example/borrowed.jpg": {{UserID: "u2", Similarity: 0.88}, {UserID: "u1", Similarity: 0.52}},
+		"https://img.example/stranger.jpg": {},
+	})
+	event := func(id, image string) attendance.AnalysisEvent {
+		e := checkIn(id, "u1", "kiosk-1", 0, "")
+		e.ImageURL = image
+		return e
+	}
+	events := []attendance.AnalysisEvent{
+		event("e1", "https://img.example/own.jpg"),
+		event("e2", "https://img.example/borrowed.jpg"),
+		event("e3", "https://img.example/stranger.jpg"),
+		event("e4", "https://img.example/blurred.jpg"),
+		event("e5", ""),
+	}
+
+	found, err := Analyzer{Face: face}.faceMismatches(context.Background(), events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("%d findings %+v, want 1", len(found), found)
+	}
+	f := found[0]
+	if f.Kind != attendance.AnomalyFaceMismatch || f.UserID != "u1" || f.EventID != "e2" || f.OtherUserID == nil || *f.OtherUserID != "u2" {
+		t.Errorf("finding %+v", f)
+	}
+	if f.Details["similarity"] != 0.88 || f.Details["device_id"] != "kiosk-1" {
+		t.Errorf("details = %v", f.Details)
+	}
+
+	for name, a := range map[string]Analyzer{
+		"no face client": {},
+		"skip mode":      {Face: faceclient.New("http://127.0.0.1:1", true)},
+	} {
+		if found, err := a.faceMismatches(context.Background(), events); found != nil || err != nil {
+			t.Errorf("%s: faceMismatches = %v, %v; want the check disabled", name, found, err)
+		}
+	}
+}
+
+// An unreachable face service aborts the run instead of reporting a clean
+// day.
+func TestFaceMismatchesServiceDown(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	e := checkIn("e1", "u1", "kiosk-1", 0, "")
+	e.ImageURL = "https://img.example/own.jpg"
+
+	found, err := Analyzer{Face: faceclient.New(srv.URL, false)}.faceMismatches(context.Background(), []attendance.AnalysisEvent{e})
+	if err == nil || !faceclient.IsUnavailable(err) || found != nil {
+		t.Errorf("faceMismatches = %v, %v; want an unavailable error", found, err)
+	}
+}
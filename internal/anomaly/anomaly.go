@@ -0,0 +1,82 @@
+// Package anomaly tracks repeated failed face matches per device so that a
+// kiosk being probed with the wrong faces can be flagged for review.
+package anomaly
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	failedMatchesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "device_failed_matches_total",
+		Help: "Check-ins that ended unmatched or failed, counted toward device lockout.",
+	})
+	flaggedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "device_suspicious_flags_total",
+		Help: "Times a device crossed the failed-match threshold.",
+	})
+)
+
+// keyPrefix namespaces the per-device failure counters in Redis.
+const keyPrefix = "attendance:failures:"
+
+// Tracker counts consecutive failed matches per device in Redis. A counter
+// expires Window after the first failure, so only failures within one window
+// add up; a successful match resets it.
+type Tracker struct {
+	client    *redis.Client
+	threshold int64
+	window    time.Duration
+}
+
+// NewTracker returns a tracker that flags a device after threshold failures
+// within window. It returns nil when threshold is not positive, which
+// disables tracking; a nil *Tracker is safe to use.
+func NewTracker(client *redis.Client, threshold int, window time.Duration) *Tracker {
+	if threshold <= 0 || client == nil {
+		return nil
+	}
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	return &Tracker{client: client, threshold: int64(threshold), window: window}
+}
+
+// RecordFailure counts a failed match for deviceID. It returns the current
+// count and whether this failure reached the threshold; that happens once per
+// streak, so callers can raise a single alert.
+func (t *Tracker) RecordFailure(ctx context.Context, deviceID string) (int64, bool, error) {
+	if t == nil {
+		return 0, false, nil
+	}
+	failedMatchesTotal.Inc()
+	key := keyPrefix + deviceID
+	n, err := t.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if n == 1 {
+		if err := t.client.Expire(ctx, key, t.window).Err(); err != nil {
+			return n, false, err
+		}
+	}
+	crossed := n == t.threshold
+	if crossed {
+		flaggedTotal.Inc()
+	}
+	return n, crossed, nil
+}
+
+// Reset clears the failure count for deviceID after a successful match or an
+// admin re-enable.
+func (t *Tracker) Reset(ctx context.Context, deviceID string) error {
+	if t == nil {
+		return nil
+	}
+	return t.client.Del(ctx, keyPrefix+deviceID).Err()
+}
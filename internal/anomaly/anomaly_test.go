@@ -0,0 +1,123 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestTracker(t *testing.T, threshold int, window time.Duration) (*Tracker, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewTracker(client, threshold, window), mr
+}
+
+// fail records a failure on deviceID and returns the count and whether it
+// crossed the threshold.
+func fail(t *testing.T, tr *Tracker, deviceID string) (int64, bool) {
+	t.Helper()
+	n, crossed, err := tr.RecordFailure(context.Background(), deviceID)
+	if err != nil {
+		t.Fatalf("RecordFailure(%s): %v", deviceID, err)
+	}
+	return n, crossed
+}
+
+func TestTrackerFlagsOncePerStreak(t *testing.T) {
+	tr, _ := newTestTracker(t, 3, time.Minute)
+	failed, flagged := testutil.ToFloat64(failedMatchesTotal), testutil.ToFloat64(flaggedTotal)
+
+	for i, wantCrossed := range []bool{false, false, true, false, false} {
+		n, crossed := fail(t, tr, "kiosk-1")
+		if n != int64(i+1) || crossed != wantCrossed {
+			t.Errorf("failure %d = %d, crossed %v; want %d, %v", i+1, n, crossed, i+1, wantCrossed)
+		}
+	}
+	if got := testutil.ToFloat64(failedMatchesTotal) - failed; got != 5 {
+		t.Errorf("device_failed_matches_total grew by %v, want 5", got)
+	}
+	if got := testutil.ToFloat64(flaggedTotal) - flagged; got != 1 {
+		t.Errorf("device_suspicious_flags_total grew by %v, want 1", got)
+	}
+}
+
+func TestTrackerResetOnMatch(t *testing.T) {
+	tr, mr := newTestTracker(t, 3, time.Minute)
+	fail(t, tr, "kiosk-1")
+	fail(t, tr, "kiosk-1")
+	if err := tr.Reset(context.Background(), "kiosk-1"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if mr.Exists(keyPrefix + "kiosk-1") {
+		t.Error("counter kept after Reset")
+	}
+	// The streak starts over, so it takes the full threshold again.
+	for i := range 2 {
+		if _, crossed := fail(t, tr, "kiosk-1"); crossed {
+			t.Fatalf("failure %d after the reset crossed the threshold", i+1)
+		}
+	}
+	if _, crossed := fail(t, tr, "kiosk-1"); !crossed {
+		t.Error("third failure after the reset did not cross the threshold")
+	}
+}
+
+func TestTrackerWindow(t *testing.T) {
+	tr, mr := newTestTracker(t, 3, 10*time.Minute)
+	fail(t, tr, "kiosk-1")
+	fail(t, tr, "kiosk-1")
+	// Later failures do not extend the window of the first.
+	mr.FastForward(9 * time.Minute)
+	if ttl := mr.TTL(keyPrefix + "kiosk-1"); ttl != time.Minute {
+		t.Errorf("counter expires in %v, want the window measured from the first failure", ttl)
+	}
+	mr.FastForward(2 * time.Minute)
+	if n, crossed := fail(t, tr, "kiosk-1"); n != 1 || crossed {
+		t.Errorf("failure after the window = %d, crossed %v; want a new streak", n, crossed)
+	}
+}
+
+func TestTrackerPerDevice(t *testing.T) {
+	tr, _ := newTestTracker(t, 2, time.Minute)
+	fail(t, tr, "kiosk-1")
+	if n, crossed := fail(t, tr, "kiosk-2"); n != 1 || crossed {
+		t.Errorf("kiosk-2 = %d, crossed %v; want its own count", n, crossed)
+	}
+	if _, crossed := fail(t, tr, "kiosk-1"); !crossed {
+		t.Error("kiosk-1 did not cross at its second failure")
+	}
+}
+
+func TestTrackerDisabled(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	for _, tr := range []*Tracker{NewTracker(client, 0, time.Minute), NewTracker(nil, 3, time.Minute)} {
+		if tr != nil {
+			t.Fatalf("NewTracker = %+v, want nil", tr)
+		}
+		if n, crossed, err := tr.RecordFailure(context.Background(), "kiosk-1"); n != 0 || crossed || err != nil {
+			t.Errorf("nil RecordFailure = %d, %v, %v", n, crossed, err)
+		}
+		if err := tr.Reset(context.Background(), "kiosk-1"); err != nil {
+			t.Errorf("nil Reset = %v", err)
+		}
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("disabled tracker wrote %v", keys)
+	}
+}
+
+func TestTrackerRedisDown(t *testing.T) {
+	tr, mr := newTestTracker(t, 3, time.Minute)
+	mr.Close()
+	if _, crossed, err := tr.RecordFailure(context.Background(), "kiosk-1"); err == nil || crossed {
+		t.Errorf("RecordFailure with Redis down = crossed %v, %v; want an error", crossed, err)
+	}
+}
@@ -0,0 +1,229 @@
+package attendance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Anomaly kinds found by the nightly analysis.
+const (
+	// AnomalyImpossibleTravel flags a check-in too far from the user's
+	// previous one to have been reached in the time between them.
+	AnomalyImpossibleTravel = "impossible_travel"
+	// AnomalyFaceMismatch flags a check-in whose face best matches another
+	// enrolled user.
+	AnomalyFaceMismatch = "face_mismatch"
+)
+
+// Anomaly review statuses. A finding starts open; an admin acknowledges it
+// (real, being handled) or dismisses it (false alarm).
+const (
+	AnomalyOpen         = "open"
+	AnomalyAcknowledged = "acknowledged"
+	AnomalyDismissed    = "dismissed"
+)
+
+// Anomaly is a suspicious check-in found by the analysis.
+type Anomaly struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	UserID string `json:"user_id"`
+	// EventID is the flagged check-in; OtherEventID is the earlier check-in
+	// it conflicts with, for impossible travel.
+	EventID      string  `json:"event_id"`
+	OtherEventID *string `json:"other_event_id,omitempty"`
+	// OtherUserID is the user the face matched, for face mismatches.
+	OtherUserID *string        `json:"other_user_id,omitempty"`
+	Details     map[string]any `json:"details,omitempty"`
+	Status      string         `json:"status"`
+	ReviewedBy  *string        `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time     `json:"reviewed_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// AnalysisEvent is a processed check-in as the anomaly analysis sees it.
+type AnalysisEvent struct {
+	ID       string
+	UserID   string
+	DeviceID string
+	When     time.Time
+	Location string
+	ImageURL string
+	// DeviceLat and DeviceLng are the device's geofence center, if set.
+	DeviceLat *float64
+	DeviceLng *float64
+}
+
+// AnalysisEvents returns processed events in [from, to), by user and time.
+func (r *Repository) AnalysisEvents(ctx context.Context, from, to time.Time) ([]AnalysisEvent, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.id, e.user_id, e.device_id, e.occurred_at, COALESCE(e.location, ''), COALESCE(e.image_url, ''),
+		       d.latitude, d.longitude
+		FROM attendance_events e
+		LEFT JOIN devices d ON d.device_id = e.device_id
+		WHERE e.status = 'processed' AND e.occurred_at >= $1 AND e.occurred_at < $2
+		ORDER BY e.user_id, e.occurred_at, e.id
+	`, from, to)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	var events []AnalysisEvent
+	for rows.Next() {
+		var e AnalysisEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.DeviceID, &e.When, &e.Location, &e.ImageURL, &e.DeviceLat, &e.DeviceLng); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, storageErr(rows.Err())
+}
+
+// InsertAnomalies stores findings, skipping events already flagged for the
+// same kind so re-running the analysis is harmless. It returns how many
+// were new.
+func (r *Repository) InsertAnomalies(ctx context.Context, found []Anomaly) (int, error) {
+	if len(found) == 0 {
+		return 0, nil
+	}
+	args := make([]any, 0, len(found)*6)
+	rows := make([]string, 0, len(found))
+	for _, a := range found {
+		details, err := json.Marshal(a.Details)
+		if err != nil {
+			return 0, err
+		}
+		n := len(args)
+		rows = append(rows, "($"+itoa(n+1)+", $"+itoa(n+2)+", $"+itoa(n+3)+", $"+itoa(n+4)+", $"+itoa(n+5)+", $"+itoa(n+6)+")")
+		args = append(args, a.Kind, a.UserID, a.EventID, a.OtherEventID, a.OtherUserID, details)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO anomalies (kind, user_id, event_id, other_event_id, other_user_id, details)
+		VALUES `+strings.Join(rows, ", ")+`
+		ON CONFLICT (kind, event_id) DO NOTHING
+	`, args...)
+	if err != nil {
+		return 0, storageErr(err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// AnomalyFilter narrows ListAnomalies; empty fields match everything.
+type AnomalyFilter struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+const anomalyColumns = `id, kind, user_id, event_id, other_event_id, other_user_id, details, status, reviewed_by, reviewed_at, created_at`
+
+func scanAnomaly(row scanner) (Anomaly, error) {
+	var a Anomaly
+	var details []byte
+	if err := row.Scan(&a.ID, &a.Kind, &a.UserID, &a.EventID, &a.OtherEventID, &a.OtherUserID, &details,
+		&a.Status, &a.ReviewedBy, &a.ReviewedAt, &a.CreatedAt); err != nil {
+		return Anomaly{}, err
+	}
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &a.Details); err != nil {
+			return Anomaly{}, fmt.Errorf("decode details of anomaly %s: %w", a.ID, err)
+		}
+	}
+	return a, nil
+}
+
+// ListAnomalies returns findings newest first.
+func (r *Repository) ListAnomalies(ctx context.Context, f AnomalyFilter) ([]Anomaly, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+anomalyColumns+`
+		FROM anomalies
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, f.Status, f.Kind, f.Limit, f.Offset)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	res := []Anomaly{}
+	for rows.Next() {
+		a, err := scanAnomaly(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, storageErr(rows.Err())
+}
+
+// ReviewAnomaly moves an open finding to acknowledged or dismissed; an
+// acknowledged one may still be dismissed. Other changes are
+// ErrInvalidTransition.
+func (r *Repository) ReviewAnomaly(ctx context.Context, id, status, actor string) (Anomaly, error) {
+	var from []string
+	switch status {
+	case AnomalyAcknowledged:
+		from = []string{AnomalyOpen}
+	case AnomalyDismissed:
+		from = []string{AnomalyOpen, AnomalyAcknowledged}
+	default:
+		return Anomaly{}, fmt.Errorf("%w: unknown anomaly status %q", ErrValidation, status)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	a, err := scanAnomaly(r.db.QueryRowContext(ctx, `
+		UPDATE anomalies SET status = $2, reviewed_by = $3, reviewed_at = NOW()
+		WHERE id = $1 AND status = ANY($4)
+		RETURNING `+anomalyColumns, id, status, actor, from))
+	if err == nil {
+		return a, nil
+	}
+	if !errors.Is(storageErr(err), ErrNotFound) {
+		return Anomaly{}, storageErr(err)
+	}
+	var current string
+	err = r.db.QueryRowContext(ctx, `SELECT status FROM anomalies WHERE id = $1`, id).Scan(&current)
+	if err != nil {
+		return Anomaly{}, storageErr(err)
+	}
+	return Anomaly{}, fmt.Errorf("%w: anomaly %s is %s", ErrInvalidTransition, id, current)
+}
+
+// SetDevicePosition sets or, with nil coordinates, clears a device's
+// geofence center.
+func (r *Repository) SetDevicePosition(ctx context.Context, deviceID string, lat, lng *float64) error {
+	if (lat == nil) != (lng == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be given together", ErrValidation)
+	}
+	if lat != nil && (*lat < -90 || *lat > 90 || *lng < -180 || *lng > 180) {
+		return fmt.Errorf("%w: coordinates out of range", ErrValidation)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `UPDATE devices SET latitude = $2, longitude = $3 WHERE device_id = $1`, deviceID, lat, lng)
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: device %s", ErrNotFound, deviceID))
+}
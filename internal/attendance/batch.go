@@ -0,0 +1,249 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxBatchSize is the number of check-ins CheckInBatch accepts per call.
+const MaxBatchSize = 100
+
+// maxClientIDLen bounds the kiosk-generated id of a batched check-in.
+const maxClientIDLen = 64
+
+// Outcomes of one check-in of a batch.
+const (
+	BatchCreated   = "created"
+	BatchDuplicate = "duplicate"
+	BatchError     = "error"
+)
+
+// BatchItem is one check-in a kiosk buffered while offline.
+type BatchItem struct {
+	// ClientID is the kiosk's own id for the check-in. Sending the same id
+	// from the same device again returns the event created the first time.
+	ClientID   string
+	UserID     string
+	Location   string
+	ImageURL   string
+	ClientTime time.Time
+}
+
+// BatchResult is the outcome of one BatchItem: the event it created
+// (BatchCreated), the earlier event it duplicates (BatchDuplicate), or the
+// error that rejected it (BatchError).
+type BatchResult struct {
+	Result string
+	Event  Event
+	Err    error
+}
+
+// CheckInBatch records check-ins deviceID buffered while offline, in one
+// transaction. Each item is validated and deduplicated on its own, and the
+// results come back in the order of items. Unlike CheckIn, the client
+// timestamp, corrected by the device's known clock skew, is always the event
+// time: an item whose timestamp is more than
+// OfflineMaxAge before receivedAt is rejected with ErrTooOld, and one more
+// than ClockSkewTolerance after it with ErrValidation. The returned error is
+// for failures of the whole batch, such as a locked device or an unreachable
+// database; nothing is stored then.
+func (s *Service) CheckInBatch(ctx context.Context, deviceID string, items []BatchItem, receivedAt time.Time) ([]BatchResult, error) {
+	if deviceID == "" {
+		return nil, fmt.Errorf("%w: device required", ErrValidation)
+	}
+	if len(items) == 0 || len(items) > MaxBatchSize {
+		return nil, fmt.Errorf("%w: a batch holds 1 to %d check-ins, got %d", ErrValidation, MaxBatchSize, len(items))
+	}
+	if s.DeviceLockout {
+		if flagged, err := s.repo.IsDeviceSuspicious(ctx, deviceID); err != nil {
+			return nil, storageErr(err)
+		} else if flagged {
+			return nil, fmt.Errorf("%w: device %s is locked after repeated failed matches; an admin must re-enable it", ErrDeviceDisabled, deviceID)
+		}
+	}
+	dedupDevice := deviceID
+	if s.DedupScope == DedupScopeUser {
+		dedupDevice = ""
+	}
+	skew, err := s.repo.DeviceClockSkew(ctx, deviceID)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+
+	results := make([]BatchResult, len(items))
+	var evts []Event
+	var pos []int
+	for i, item := range items {
+		if skew.Known() && !item.ClientTime.IsZero() {
+			item.ClientTime = item.ClientTime.Add(-skew.Offset)
+		}
+		if err := s.validateBatchItem(item, receivedAt); err != nil {
+			results[i] = BatchResult{Result: BatchError, Err: err}
+			continue
+		}
+		unknown, err := s.checkUser(ctx, item.UserID)
+		if errors.Is(err, ErrUnknownUser) {
+			results[i] = BatchResult{Result: BatchError, Err: err}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		clientID := item.ClientID
+		evts = append(evts, Event{
+			UserID: item.UserID, DeviceID: deviceID, Location: item.Location, ImageURL: item.ImageURL,
+			When: item.ClientTime.UTC(), Status: StatusPending, ClientID: &clientID, UnknownUser: unknown,
+		})
+		pos = append(pos, i)
+	}
+	if len(evts) == 0 {
+		return results, nil
+	}
+	stored, err := s.repo.CheckInBatchTx(ctx, evts, dedupDevice, s.window(ctx))
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	for j, res := range stored {
+		results[pos[j]] = res
+	}
+	for _, res := range results {
+		switch res.Result {
+		case BatchCreated:
+			s.countCheckin(nil)
+		case BatchDuplicate:
+			s.countCheckin(ErrDuplicate)
+		default:
+			s.countCheckin(res.Err)
+		}
+	}
+	return results, nil
+}
+
+// validateBatchItem checks one item of a batch received at receivedAt.
+func (s *Service) validateBatchItem(item BatchItem, receivedAt time.Time) error {
+	switch {
+	case item.ClientID == "":
+		return fmt.Errorf("%w: id required", ErrValidation)
+	case len(item.ClientID) > maxClientIDLen:
+		return fmt.Errorf("%w: id longer than %d characters", ErrValidation, maxClientIDLen)
+	case item.UserID == "":
+		return fmt.Errorf("%w: user required", ErrValidation)
+	case item.ClientTime.IsZero():
+		return fmt.Errorf("%w: client_timestamp required", ErrValidation)
+	case s.OfflineMaxAge > 0 && receivedAt.Sub(item.ClientTime) > s.OfflineMaxAge:
+		return fmt.Errorf("%w: taken at %s, more than %s ago", ErrTooOld, item.ClientTime.UTC().Format(time.RFC3339), s.OfflineMaxAge)
+	case item.ClientTime.Sub(receivedAt) > s.ClockSkewTolerance:
+		return fmt.Errorf("%w: client_timestamp %s is in the future", ErrValidation, item.ClientTime.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckInBatchTx writes evts in one transaction, each unless an event with
+// the same device and ClientID exists or the user already has an event
+// within window of its time (on dedupDevice, or any device when it is
+// empty). It takes the same advisory locks as CheckInTx, all up front and in
+// a fixed order, so it serializes with single check-ins and other batches.
+// An event the database rejects, say for an unregistered device, fails on
+// its own; any other error fails the batch.
+func (r *Repository) CheckInBatchTx(ctx context.Context, evts []Event, dedupDevice string, window time.Duration) ([]BatchResult, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	keys := make([]string, 0, len(evts))
+	seen := make(map[string]bool, len(evts))
+	for _, evt := range evts {
+		if key := "checkin:" + evt.UserID + "/" + dedupDevice; !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BatchResult, len(evts))
+	for i, evt := range evts {
+		// A savepoint per event lets one rejected insert fail alone instead
+		// of aborting the transaction.
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+		res, err := checkInBatchItem(ctx, tx, evt, dedupDevice, window)
+		if err != nil {
+			if _, rerr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch_item`); rerr != nil {
+				return nil, rerr
+			}
+			switch {
+			case isForeignKeyViolation(err):
+				err = fmt.Errorf("%w: device %s is not registered", ErrValidation, evt.DeviceID)
+			case isUniqueViolation(err):
+				err = fmt.Errorf("%w: user %s already has an event at %s", ErrDuplicate, evt.UserID, evt.When.Format(time.RFC3339))
+			default:
+				return nil, err
+			}
+			res = BatchResult{Result: BatchError, Err: err}
+		}
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT batch_item`); err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkInBatchItem deduplicates and writes one event of a batch inside tx.
+func checkInBatchItem(ctx context.Context, tx *sql.Tx, evt Event, dedupDevice string, window time.Duration) (BatchResult, error) {
+	if evt.ClientID != nil {
+		prev, err := scanRecentEvent(tx.QueryRowContext(ctx, `
+			SELECT `+eventColumns+`
+			FROM attendance_events WHERE device_id = $1 AND client_id = $2
+		`, evt.DeviceID, *evt.ClientID))
+		if err != nil {
+			return BatchResult{}, err
+		}
+		if prev != nil {
+			return BatchResult{Result: BatchDuplicate, Event: *prev}, nil
+		}
+	}
+	if window > 0 {
+		recent, err := scanRecentEvent(tx.QueryRowContext(ctx, recentEventQuery, evt.UserID, dedupDevice, window.Seconds(), evt.When))
+		if err != nil {
+			return BatchResult{}, err
+		}
+		if recent != nil {
+			return BatchResult{Result: BatchDuplicate, Event: *recent}, nil
+		}
+	}
+	inserted, err := insertEvent(ctx, tx, evt)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	return BatchResult{Result: BatchCreated, Event: inserted}, nil
+}
+
+// EventByClientID returns the event a device created in a batch under
+// clientID, or nil when there is none.
+func (r *Repository) EventByClientID(ctx context.Context, deviceID, clientID string) (*Event, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	evt, err := scanRecentEvent(r.db.QueryRowContext(ctx, `
+		SELECT `+eventColumns+`
+		FROM attendance_events WHERE device_id = $1 AND client_id = $2
+	`, deviceID, clientID))
+	return evt, storageErr(err)
+}
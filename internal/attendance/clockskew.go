@@ -0,0 +1,94 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// skewWeight is the weight of a new observation in a device's rolling
+// average clock skew. Until a device has 1/skewWeight observations the
+// average is their plain mean, so the first few are not drowned out.
+const skewWeight = 0.2
+
+// minSkewSamples is how many observations a device's skew needs before it
+// corrects the device's check-in times; one reading may be a slow upload.
+const minSkewSamples = 3
+
+// ClockSkew is a device's observed clock error: how far its clock runs ahead
+// of server time (behind when negative), averaged over Samples observations.
+type ClockSkew struct {
+	Offset  time.Duration
+	Samples int
+}
+
+// Known reports whether the skew rests on enough observations to correct
+// client timestamps with.
+func (k ClockSkew) Known() bool {
+	return k.Samples >= minSkewSamples
+}
+
+// correctTime removes a device's known skew from a client timestamp and
+// returns it when it lands within tolerance of receivedAt, and receivedAt
+// otherwise. A zero clientTime or tolerance always gives receivedAt. Times
+// are returned in UTC.
+func correctTime(clientTime, receivedAt time.Time, skew ClockSkew, tolerance time.Duration) time.Time {
+	receivedAt = receivedAt.UTC()
+	if clientTime.IsZero() || tolerance <= 0 {
+		return receivedAt
+	}
+	if skew.Known() {
+		clientTime = clientTime.Add(-skew.Offset)
+	}
+	if d := receivedAt.Sub(clientTime); d > tolerance || d < -tolerance {
+		return receivedAt
+	}
+	return clientTime.UTC()
+}
+
+// SkewExceeds reports whether an observed offset is beyond threshold in
+// either direction; a zero threshold never flags.
+func SkewExceeds(offset, threshold time.Duration) bool {
+	return threshold > 0 && (offset > threshold || offset < -threshold)
+}
+
+// DeviceClockSkew returns the stored clock skew of a device; an unknown
+// device has none.
+func (r *Repository) DeviceClockSkew(ctx context.Context, deviceID string) (ClockSkew, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var (
+		seconds sql.NullFloat64
+		skew    ClockSkew
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT clock_skew_seconds, clock_skew_samples FROM devices WHERE device_id = $1
+	`, deviceID).Scan(&seconds, &skew.Samples)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ClockSkew{}, nil
+	}
+	if err != nil {
+		return ClockSkew{}, err
+	}
+	skew.Offset = time.Duration(seconds.Float64 * float64(time.Second))
+	return skew, nil
+}
+
+// RecordClockSkew folds one observation of how far a device's clock is ahead
+// of server time into its rolling average: the plain mean of the first
+// observations, then an exponential average weighted skewWeight. It is a
+// single UPDATE so concurrent observations are not lost.
+func (r *Repository) RecordClockSkew(ctx context.Context, deviceID string, observed time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE devices SET
+			clock_skew_seconds = COALESCE(clock_skew_seconds, 0)
+				+ GREATEST($3, 1.0 / (clock_skew_samples + 1)) * ($2 - COALESCE(clock_skew_seconds, 0)),
+			clock_skew_samples = clock_skew_samples + 1,
+			clock_skew_at = NOW()
+		WHERE device_id = $1
+	`, deviceID, observed.Seconds(), skewWeight)
+	return err
+}
@@ -0,0 +1,145 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCorrection is returned when a correction is malformed: no reason,
+// an unknown status, or nothing actually changing.
+var ErrInvalidCorrection = fmt.Errorf("%w: invalid correction", ErrValidation)
+
+// CorrectionRequest describes an admin edit of an event. Nil fields are left unchanged.
+type CorrectionRequest struct {
+	UserID     *string
+	Status     *string
+	OccurredAt *time.Time
+	Reason     string
+	Actor      string
+}
+
+// Correction is one field changed on an event, with the value it replaced.
+type Correction struct {
+	ID        string    `json:"id"`
+	EventID   string    `json:"event_id"`
+	Field     string    `json:"field"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CorrectEvent applies an admin correction and records the original values in
+// event_corrections, and a status change in the status history too. The
+// writes share one transaction, so a failure leaves the event untouched. It returns sql.ErrNoRows if the event does not exist.
+func (r *Repository) CorrectEvent(ctx context.Context, id string, req CorrectionRequest) (Event, []Correction, error) {
+	if req.Reason == "" {
+		return Event{}, nil, fmt.Errorf("%w: reason is required", ErrInvalidCorrection)
+	}
+	if req.Status != nil && *req.Status != StatusPending && !IsTerminal(*req.Status) {
+		return Event{}, nil, fmt.Errorf("%w: unknown status %q", ErrInvalidCorrection, *req.Status)
+	}
+	if req.UserID != nil && *req.UserID == "" {
+		return Event{}, nil, fmt.Errorf("%w: user_id cannot be empty", ErrInvalidCorrection)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Event{}, nil, err
+	}
+	defer tx.Rollback()
+
+	evt, err := scanEvent(tx.QueryRowContext(ctx, `SELECT `+eventColumns+` FROM attendance_events WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return Event{}, nil, storageErr(err)
+	}
+
+	if evt.Status == StatusAwaitingApproval {
+		return Event{}, nil, fmt.Errorf("%w: event %s is awaiting approval; approve or reject it instead", ErrInvalidTransition, id)
+	}
+
+	var changes []Correction
+	change := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, Correction{Field: field, OldValue: &from, NewValue: &to})
+		}
+	}
+	if req.UserID != nil {
+		change("user_id", evt.UserID, *req.UserID)
+		evt.UserID = *req.UserID
+	}
+	if req.Status != nil {
+		change("status", evt.Status, *req.Status)
+		if evt.Status != *req.Status {
+			// The reason explained the old status only.
+			evt.FailureReason = nil
+		}
+		evt.Status = *req.Status
+	}
+	if req.OccurredAt != nil {
+		change("occurred_at", evt.When.UTC().Format(time.RFC3339Nano), req.OccurredAt.UTC().Format(time.RFC3339Nano))
+		evt.When = *req.OccurredAt
+	}
+	if len(changes) == 0 {
+		return Event{}, nil, fmt.Errorf("%w: nothing changes", ErrInvalidCorrection)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE attendance_events
+		SET user_id = $2, status = $3, occurred_at = $4,
+			failure_reason = CASE WHEN status = $3 THEN failure_reason END
+		WHERE id = $1
+	`, id, evt.UserID, evt.Status, evt.When); err != nil {
+		return Event{}, nil, err
+	}
+	for i := range changes {
+		c := &changes[i]
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO event_corrections (event_id, field, old_value, new_value, reason, actor)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, id, c.Field, c.OldValue, c.NewValue, req.Reason, req.Actor).Scan(&c.ID, &c.CreatedAt)
+		if err != nil {
+			return Event{}, nil, fmt.Errorf("record correction of %s: %w", c.Field, err)
+		}
+		c.EventID, c.Reason, c.Actor = id, req.Reason, req.Actor
+		if c.Field == "status" {
+			if err := recordStatusChange(ctx, tx, id, *c.OldValue, *c.NewValue, req.Actor); err != nil {
+				return Event{}, nil, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Event{}, nil, err
+	}
+	return evt, changes, nil
+}
+
+// ListCorrections returns the corrections applied to an event, oldest first.
+func (r *Repository) ListCorrections(ctx context.Context, eventID string) ([]Correction, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_id, field, old_value, new_value, reason, actor, created_at
+		FROM event_corrections
+		WHERE event_id = $1
+		ORDER BY created_at, id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Correction{}
+	for rows.Next() {
+		var c Correction
+		if err := rows.Scan(&c.ID, &c.EventID, &c.Field, &c.OldValue, &c.NewValue, &c.Reason, &c.Actor, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,156 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// correctAll moves an event to emp-2, marks it failed and sets its time, so
+// every write CorrectEvent can make is needed.
+func correctAll(at time.Time) CorrectionRequest {
+	user, status := "emp-2", StatusFailed
+	return CorrectionRequest{UserID: &user, Status: &status, OccurredAt: &at, Reason: "wrong match", Actor: "admin"}
+}
+
+// A correction is one transaction: whichever of its writes fails, it is
+// rolled back and nothing is reported as changed.
+func TestCorrectEventRollsBack(t *testing.T) {
+	boom := errors.New("connection reset")
+	earlier := time.Now().Add(-time.Hour)
+	for _, failAt := range []string{"update", "user_id", "status", "history", "occurred_at", "commit"} {
+		t.Run(failAt, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxValues{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			repo := NewRepository(db, 0)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT .+ FROM attendance_events WHERE id = \$1 FOR UPDATE`).WithArgs("evt-1").
+				WillReturnRows(recentRow("evt-1", "emp-1", "kiosk-1", earlier))
+		steps:
+			for _, step := range []string{"update", "user_id", "status", "history", "occurred_at", "commit"} {
+				fail := step == failAt
+				switch step {
+				case "update":
+					e := mock.ExpectExec(`UPDATE attendance_events`).WithArgs("evt-1", "emp-2", StatusFailed, sqlmock.AnyArg())
+					if fail {
+						e.WillReturnError(boom)
+					} else {
+						e.WillReturnResult(sqlmock.NewResult(0, 1))
+					}
+				case "history":
+					e := mock.ExpectExec(`INSERT INTO event_status_history`).WithArgs("evt-1", StatusProcessed, StatusFailed, "admin")
+					if fail {
+						e.WillReturnError(boom)
+					} else {
+						e.WillReturnResult(sqlmock.NewResult(0, 1))
+					}
+				case "commit":
+					// A failed commit ends the transaction by itself.
+					e := mock.ExpectCommit()
+					if fail {
+						e.WillReturnError(boom)
+					}
+					break steps
+				default:
+					e := mock.ExpectQuery(`INSERT INTO event_corrections`).
+						WithArgs("evt-1", step, sqlmock.AnyArg(), sqlmock.AnyArg(), "wrong match", "admin")
+					if fail {
+						e.WillReturnError(boom)
+					} else {
+						e.WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow("corr-"+step, time.Now()))
+					}
+				}
+				if fail {
+					mock.ExpectRollback()
+					break
+				}
+			}
+
+			evt, changes, err := repo.CorrectEvent(context.Background(), "evt-1", correctAll(time.Now()))
+			if !errors.Is(err, boom) {
+				t.Errorf("CorrectEvent error = %v, want %v", err, boom)
+			}
+			if evt.ID != "" || changes != nil {
+				t.Errorf("CorrectEvent = %+v, %v after a failure; want nothing", evt, changes)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// A correction whose last write fails in the database leaves the event, its
+// corrections and its status history as they were.
+func TestCorrectEventPartialFailure(t *testing.T) {
+	repo := testRepo(t)
+	registerDevice(t, repo, "kiosk-1")
+	addEmployee(t, repo, "emp-1")
+	addEmployee(t, repo, "emp-2")
+	ctx := context.Background()
+
+	evt, err := NewService(repo, time.Minute).CheckIn(ctx, "emp-1", "kiosk-1", "", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateEventStatus(ctx, evt.ID, StatusProcessed, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	before, err := repo.GetEvent(ctx, evt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := repo.ListStatusHistory(ctx, evt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The occurred_at correction is recorded last, after the event row, the
+	// other corrections and the status history were written.
+	if _, err := repo.db.ExecContext(ctx, `
+		CREATE FUNCTION refuse_occurred_at() RETURNS trigger LANGUAGE plpgsql AS $$
+		BEGIN
+			IF NEW.field = 'occurred_at' THEN
+				RAISE EXCEPTION 'occurred_at corrections refused';
+			END IF;
+			RETURN NEW;
+		END $$;
+		CREATE TRIGGER refuse_occurred_at BEFORE INSERT ON event_corrections
+			FOR EACH ROW EXECUTE FUNCTION refuse_occurred_at();
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := repo.CorrectEvent(ctx, evt.ID, correctAll(before.When.Add(-time.Hour))); err == nil {
+		t.Fatal("CorrectEvent succeeded with the last write refused")
+	}
+
+	after, err := repo.GetEvent(ctx, evt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.UserID != before.UserID || after.Status != before.Status || !after.When.Equal(before.When) {
+		t.Errorf("event is %s/%s at %v after the failed correction, want %s/%s at %v",
+			after.UserID, after.Status, after.When, before.UserID, before.Status, before.When)
+	}
+	if corrections, err := repo.ListCorrections(ctx, evt.ID); err != nil || len(corrections) != 0 {
+		t.Errorf("corrections = %v, %v; want none", corrections, err)
+	}
+	if got, err := repo.ListStatusHistory(ctx, evt.ID); err != nil || len(got) != len(history) {
+		t.Errorf("status history has %d rows, %v; want %d", len(got), err, len(history))
+	}
+
+	// Once the write goes through the same correction applies in full.
+	if _, err := repo.db.ExecContext(ctx, `DROP TRIGGER refuse_occurred_at ON event_corrections`); err != nil {
+		t.Fatal(err)
+	}
+	if _, changes, err := repo.CorrectEvent(ctx, evt.ID, correctAll(before.When.Add(-time.Hour))); err != nil || len(changes) != 3 {
+		t.Fatalf("CorrectEvent = %v, %v; want three changes", changes, err)
+	}
+}
@@ -0,0 +1,130 @@
+package attendance
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxPageSize caps the limit of a keyset page.
+const MaxPageSize = 500
+
+// EventCursor is the position after the last event of a page, in the
+// (occurred_at DESC, id DESC) order used by ListEventsAfter.
+type EventCursor struct {
+	OccurredAt time.Time
+	ID         string
+}
+
+// Encode returns the opaque string form handed to clients.
+func (c EventCursor) Encode() string {
+	raw := c.OccurredAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (EventCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("%w: malformed cursor", ErrValidation)
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if _, err := uuid.Parse(id); !ok || err != nil {
+		return EventCursor{}, fmt.Errorf("%w: malformed cursor", ErrValidation)
+	}
+	when, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return EventCursor{}, fmt.Errorf("%w: malformed cursor", ErrValidation)
+	}
+	return EventCursor{OccurredAt: when, ID: id}, nil
+}
+
+// EventFilter narrows an event listing.
+type EventFilter struct {
+	DeviceID string
+	UserID   string
+	Status   string
+	// UnknownUser, when set, keeps only events that are (true) or are not
+	// (false) flagged as checked in by an unknown user.
+	UnknownUser *bool
+}
+
+// ListEventsAfter returns up to limit events older than after (newest first;
+// nil starts at the newest) and the cursor for the next page, which is nil
+// on the last page. Ordering on (occurred_at, id) keeps pages stable while
+// new events are inserted.
+func (r *Repository) ListEventsAfter(ctx context.Context, after *EventCursor, f EventFilter, limit int) ([]Event, *EventCursor, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	args := []any{}
+	clauses := []string{}
+	if f.DeviceID != "" {
+		args = append(args, f.DeviceID)
+		clauses = append(clauses, "device_id = $"+itoa(len(args)))
+	}
+	if f.UserID != "" {
+		args = append(args, f.UserID)
+		clauses = append(clauses, "user_id = $"+itoa(len(args)))
+	}
+	if f.Status != "" {
+		if !IsKnownStatus(f.Status) {
+			return nil, nil, fmt.Errorf("%w: unknown status %q", ErrValidation, f.Status)
+		}
+		args = append(args, f.Status)
+		clauses = append(clauses, "status = $"+itoa(len(args)))
+	}
+	if f.UnknownUser != nil {
+		args = append(args, *f.UnknownUser)
+		clauses = append(clauses, "unknown_user = $"+itoa(len(args)))
+	}
+	if _, ok := DepartmentScope(ctx); ok {
+		scope, scopeArg := scopeFilter(ctx, "user_id", len(args)+1)
+		args = append(args, scopeArg)
+		clauses = append(clauses, scope)
+	}
+	if after != nil {
+		args = append(args, after.OccurredAt, after.ID)
+		clauses = append(clauses, "(occurred_at, id) < ($"+itoa(len(args)-1)+", $"+itoa(len(args))+"::uuid)")
+	}
+	query := `SELECT ` + eventColumns + ` FROM attendance_events`
+	if len(clauses) > 0 {
+		query += " WHERE " + joinClauses(clauses, " AND ")
+	}
+	// One extra row tells whether another page exists.
+	args = append(args, limit+1)
+	query += " ORDER BY occurred_at DESC, id DESC LIMIT $" + itoa(len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, storageErr(err)
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, evt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, storageErr(err)
+	}
+	if len(events) <= limit {
+		return events, nil, nil
+	}
+	events = events[:limit]
+	last := events[limit-1]
+	return events, &EventCursor{OccurredAt: last.When, ID: last.ID}, nil
+}
@@ -0,0 +1,143 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventCursorRoundTrip(t *testing.T) {
+	c := EventCursor{
+		OccurredAt: time.Date(2026, 3, 1, 8, 59, 59, 123456000, time.FixedZone("CET", 3600)),
+		ID:         "6f1c2b1e-0d8a-4a55-9a43-0c3f6f0c2a11",
+	}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.OccurredAt.Equal(c.OccurredAt) || got.ID != c.ID {
+		t.Fatalf("DecodeCursor(Encode(%v)) = %v", c, got)
+	}
+	for _, bad := range []string{"", "!!!", "bm90IGEgY3Vyc29y", EventCursor{OccurredAt: c.OccurredAt, ID: "x"}.Encode()} {
+		if _, err := DecodeCursor(bad); !errors.Is(err, ErrValidation) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrValidation", bad, err)
+		}
+	}
+}
+
+const walkEvents = 500
+
+// seedWalkEvents stores walkEvents events, ten at each of fifty instants, and
+// returns their ids.
+func seedWalkEvents(t *testing.T, repo *Repository) map[string]bool {
+	t.Helper()
+	registerDevice(t, repo, "kiosk-1")
+	rows, err := repo.db.QueryContext(context.Background(), `
+		INSERT INTO attendance_events (user_id, device_id, occurred_at, status)
+		SELECT 'emp-' || i, 'kiosk-1', $1::timestamptz - (i / 10) * interval '1 minute', 'processed'
+		FROM generate_series(0, $2 - 1) i
+		RETURNING id
+	`, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), walkEvents)
+	if err != nil {
+		t.Fatalf("seed events: %v", err)
+	}
+	defer rows.Close()
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil || len(ids) != walkEvents {
+		t.Fatalf("seeded %d events, %v", len(ids), err)
+	}
+	return ids
+}
+
+// checkWalk fails unless pages hold every seeded event exactly once, newest
+// first.
+func checkWalk(t *testing.T, seeded map[string]bool, pages [][]Event) {
+	t.Helper()
+	seen := map[string]bool{}
+	var prev *Event
+	for p, page := range pages {
+		for i := range page {
+			e := page[i]
+			if !seeded[e.ID] {
+				t.Fatalf("page %d: unknown event %s", p, e.ID)
+			}
+			if seen[e.ID] {
+				t.Fatalf("page %d: event %s listed twice", p, e.ID)
+			}
+			seen[e.ID] = true
+			if prev != nil && (e.When.After(prev.When) || (e.When.Equal(prev.When) && e.ID > prev.ID)) {
+				t.Fatalf("page %d: %s (%s) listed after %s (%s)", p, e.ID, e.When, prev.ID, prev.When)
+			}
+			prev = &page[i]
+		}
+	}
+	if len(seen) != len(seeded) {
+		t.Fatalf("walk listed %d of %d events", len(seen), len(seeded))
+	}
+}
+
+func TestListEventsAfterWalk(t *testing.T) {
+	repo := testRepo(t)
+	seeded := seedWalkEvents(t, repo)
+
+	// Page sizes that do and do not divide the ten events per instant.
+	for _, limit := range []int{1, 7, 10, 64, MaxPageSize, MaxPageSize + 1} {
+		var pages [][]Event
+		var after *EventCursor
+		for {
+			page, next, err := repo.ListEventsAfter(context.Background(), after, EventFilter{}, limit)
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+			pages = append(pages, page)
+			if next == nil {
+				break
+			}
+			// Clients only ever hold the encoded cursor.
+			c, err := DecodeCursor(next.Encode())
+			if err != nil {
+				t.Fatal(err)
+			}
+			after = &c
+			if len(pages) > walkEvents {
+				t.Fatalf("limit %d: walk does not end", limit)
+			}
+		}
+		checkWalk(t, seeded, pages)
+	}
+}
+
+func TestListEventsExpandedWalk(t *testing.T) {
+	repo := testRepo(t)
+	seeded := seedWalkEvents(t, repo)
+
+	for _, limit := range []int{7, 10, 64} {
+		var pages [][]Event
+		for offset := 0; ; offset += limit {
+			page, err := repo.ListEventsExpanded(context.Background(), "", "", limit, offset, Expand{User: true, Device: true})
+			if err != nil {
+				t.Fatalf("limit %d offset %d: %v", limit, offset, err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			events := make([]Event, len(page))
+			for i, ee := range page {
+				if ee.Device == nil || ee.Device.Name == nil || *ee.Device.Name != "kiosk-1" {
+					t.Fatalf("event %s: device not expanded: %+v", ee.ID, ee.Device)
+				}
+				events[i] = ee.Event
+			}
+			pages = append(pages, events)
+		}
+		checkWalk(t, seeded, pages)
+	}
+}
@@ -0,0 +1,94 @@
+package attendance
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// pgxValues passes text arrays through to sqlmock the way the pgx driver
+// accepts them, and converts everything else like database/sql does.
+type pgxValues struct{}
+
+func (pgxValues) ConvertValue(v any) (driver.Value, error) {
+	if a, ok := v.([]string); ok {
+		return a, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// recentRow is an earlier processed check-in of userID on deviceID, in
+// eventColumns order.
+func recentRow(id, userID, deviceID string, at time.Time) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"id", "user_id", "device_id", "occurred_at", "location", "image_url", "status", "match_score", "created_at", "quality",
+		"late_minutes", "auth_method", "face_model", "model_mismatch", "client_id", "image_urls", "image_scores", "unknown_user", "failure_reason",
+	}).AddRow(id, userID, deviceID, at, "", "", StatusProcessed, nil, at, nil, nil, AuthMethodFace, nil, false, nil, nil, nil, false, nil)
+}
+
+// The dedup scope decides which earlier check-ins a new one is checked
+// against: the same user on the same device, or the same user anywhere. The
+// per-user lock follows the scope too, so check-ins on two devices only
+// serialize when they can be duplicates of each other.
+func TestCheckInDedupScope(t *testing.T) {
+	earlier := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name       string
+		scope      string
+		device     string
+		dedupArg   string // device the recent-event query is limited to
+		recentOn   string // device of the earlier event the database finds, "" for none
+		wantDupe   bool
+		wantLockOn string
+	}{
+		{"device scope, same device", DedupScopeDevice, "kiosk-1", "kiosk-1", "kiosk-1", true, "checkin:emp-1/kiosk-1"},
+		{"device scope, other device", DedupScopeDevice, "kiosk-2", "kiosk-2", "", false, "checkin:emp-1/kiosk-2"},
+		{"default scope is the device", "", "kiosk-2", "kiosk-2", "", false, "checkin:emp-1/kiosk-2"},
+		{"user scope, same device", DedupScopeUser, "kiosk-1", "", "kiosk-1", true, "checkin:emp-1/"},
+		{"user scope, other device", DedupScopeUser, "kiosk-2", "", "kiosk-1", true, "checkin:emp-1/"},
+		{"user scope, nothing recent", DedupScopeUser, "kiosk-2", "", "", false, "checkin:emp-1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxValues{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			s := NewService(NewRepository(db, 0), 5*time.Minute)
+			s.DedupScope = tt.scope
+			s.Users = nil
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`pg_advisory_xact_lock`).WithArgs(tt.wantLockOn).WillReturnResult(sqlmock.NewResult(0, 0))
+			recent := mock.ExpectQuery(`SELECT .+ FROM attendance_events\s+WHERE user_id = \$1 AND \(\$2 = '' OR device_id = \$2\)`).
+				WithArgs("emp-1", tt.dedupArg, (5 * time.Minute).Seconds(), sqlmock.AnyArg())
+			if tt.recentOn != "" {
+				recent.WillReturnRows(recentRow("evt-earlier", "emp-1", tt.recentOn, earlier))
+				mock.ExpectRollback()
+			} else {
+				recent.WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`INSERT INTO attendance_events`).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+				mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			}
+
+			evt, err := s.CheckIn(context.Background(), "emp-1", tt.device, "", "", time.Time{})
+			if tt.wantDupe {
+				if !errors.Is(err, ErrDuplicate) || evt.ID != "evt-earlier" || evt.DeviceID != tt.recentOn {
+					t.Errorf("CheckIn = %s on %s, %v; want ErrDuplicate of evt-earlier", evt.ID, evt.DeviceID, err)
+				}
+			} else if err != nil || evt.ID == "" || evt.DeviceID != tt.device || evt.Status != StatusPending {
+				t.Errorf("CheckIn = %+v, %v; want a new pending event on %s", evt, err, tt.device)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Department groups employees. Departments form a tree through ParentID; a
+// scope on a department covers the departments below it too.
+type Department struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const departmentColumns = `id, name, parent_id, created_at, updated_at`
+
+func scanDepartment(row scanner) (Department, error) {
+	var d Department
+	err := row.Scan(&d.ID, &d.Name, &d.ParentID, &d.CreatedAt, &d.UpdatedAt)
+	return d, err
+}
+
+type deptScopeKey struct{}
+
+// WithDepartments returns a context whose event, employee and report reads
+// only see employees of the given departments. ids must already include the
+// departments below them; see DepartmentTree. An empty ids sees nothing.
+func WithDepartments(ctx context.Context, ids []int64) context.Context {
+	if ids == nil {
+		ids = []int64{}
+	}
+	return context.WithValue(ctx, deptScopeKey{}, ids)
+}
+
+// DepartmentScope returns the departments ctx is limited to; ok is false
+// when it is not limited.
+func DepartmentScope(ctx context.Context) (ids []int64, ok bool) {
+	ids, ok = ctx.Value(deptScopeKey{}).([]int64)
+	return ids, ok
+}
+
+// scopeFilter returns a condition limiting userCol, an employee id column, to
+// the department scope of ctx, reading its argument from placeholder $n, and
+// that argument. An unscoped ctx passes NULL, which matches every row.
+func scopeFilter(ctx context.Context, userCol string, n int) (string, any) {
+	p := "$" + itoa(n) + "::bigint[]"
+	clause := "(" + p + " IS NULL OR " + userCol + " IN (SELECT employee_id FROM employees WHERE department_id = ANY(" + p + ")))"
+	if ids, ok := DepartmentScope(ctx); ok {
+		return clause, ids
+	}
+	return clause, nil
+}
+
+// DepartmentTree returns ids and every department below them. Unknown ids
+// are dropped.
+func (r *Repository) DepartmentTree(ctx context.Context, ids []int64) ([]int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id FROM departments WHERE id = ANY($1::bigint[])
+			UNION
+			SELECT d.id FROM departments d JOIN tree t ON d.parent_id = t.id
+		)
+		SELECT id FROM tree ORDER BY id
+	`, ids)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	tree := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tree = append(tree, id)
+	}
+	return tree, storageErr(rows.Err())
+}
+
+// ListDepartments returns all departments by name.
+func (r *Repository) ListDepartments(ctx context.Context) ([]Department, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+departmentColumns+` FROM departments ORDER BY name`)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	depts := []Department{}
+	for rows.Next() {
+		d, err := scanDepartment(rows)
+		if err != nil {
+			return nil, err
+		}
+		depts = append(depts, d)
+	}
+	return depts, storageErr(rows.Err())
+}
+
+// CreateDepartment stores a new department.
+func (r *Repository) CreateDepartment(ctx context.Context, d Department) (Department, error) {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" {
+		return Department{}, fmt.Errorf("%w: department name required", ErrValidation)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	created, err := scanDepartment(r.db.QueryRowContext(ctx, `
+		INSERT INTO departments (name, parent_id) VALUES ($1, $2)
+		RETURNING `+departmentColumns, d.Name, d.ParentID))
+	return created, departmentErr(err, d.ParentID)
+}
+
+// UpdateDepartment renames or moves a department. A parent below the
+// department itself would make a cycle and is refused.
+func (r *Repository) UpdateDepartment(ctx context.Context, d Department) (Department, error) {
+	d.Name = strings.TrimSpace(d.Name)
+	if d.Name == "" {
+		return Department{}, fmt.Errorf("%w: department name required", ErrValidation)
+	}
+	if d.ParentID != nil {
+		below, err := r.DepartmentTree(ctx, []int64{d.ID})
+		if err != nil {
+			return Department{}, err
+		}
+		for _, id := range below {
+			if id == *d.ParentID {
+				return Department{}, fmt.Errorf("%w: department %d cannot be placed under itself or its own subdepartment", ErrValidation, d.ID)
+			}
+		}
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	updated, err := scanDepartment(r.db.QueryRowContext(ctx, `
+		UPDATE departments SET name = $2, parent_id = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+departmentColumns, d.ID, d.Name, d.ParentID))
+	return updated, departmentErr(err, d.ParentID)
+}
+
+// DeleteDepartment removes a department without subdepartments. Its
+// employees are left without a department.
+func (r *Repository) DeleteDepartment(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `DELETE FROM departments WHERE id = $1`, id)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: department %d has subdepartments", ErrValidation, id)
+	}
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: department %d", ErrNotFound, id))
+}
+
+// SetEmployeeDepartment moves an employee to a department, or out of any
+// with a nil deptID.
+func (r *Repository) SetEmployeeDepartment(ctx context.Context, employeeID string, deptID *int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE employees SET department_id = $2, updated_at = NOW() WHERE employee_id = $1
+	`, employeeID, deptID)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: department %d", ErrNotFound, *deptID)
+	}
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: employee %s", ErrNotFound, employeeID))
+}
+
+// departmentErr reports a taken name as ErrDuplicate and an unknown parent as
+// ErrNotFound.
+func departmentErr(err error, parentID *int64) error {
+	switch {
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: a department with this name exists", ErrDuplicate)
+	case isForeignKeyViolation(err) && parentID != nil:
+		return fmt.Errorf("%w: parent department %d", ErrNotFound, *parentID)
+	}
+	return storageErr(err)
+}
@@ -0,0 +1,192 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScopeFilter(t *testing.T) {
+	const want = "($3::bigint[] IS NULL OR e.user_id IN (SELECT employee_id FROM employees WHERE department_id = ANY($3::bigint[])))"
+	ctx := context.Background()
+
+	clause, arg := scopeFilter(ctx, "e.user_id", 3)
+	if clause != want {
+		t.Fatalf("clause = %s, want %s", clause, want)
+	}
+	if arg != nil {
+		t.Fatalf("unscoped arg = %v, want nil", arg)
+	}
+
+	_, arg = scopeFilter(WithDepartments(ctx, []int64{4, 7}), "e.user_id", 3)
+	if ids, ok := arg.([]int64); !ok || !slices.Equal(ids, []int64{4, 7}) {
+		t.Fatalf("scoped arg = %#v, want [4 7]", arg)
+	}
+
+	// A scope without departments sees nothing rather than everything.
+	_, arg = scopeFilter(WithDepartments(ctx, nil), "e.user_id", 3)
+	if ids, ok := arg.([]int64); !ok || ids == nil || len(ids) != 0 {
+		t.Fatalf("empty scope arg = %#v, want an empty, non-nil slice", arg)
+	}
+}
+
+// deptFixture is a department tree with one employee and one event in each
+// department, plus an employee without a department:
+//
+//	eng ── backend ── db
+//	sales
+type deptFixture struct {
+	eng, backend, db, sales Department
+	// events maps employee ids to their event ids.
+	events map[string]string
+}
+
+func newDeptFixture(t *testing.T, repo *Repository) deptFixture {
+	t.Helper()
+	ctx := context.Background()
+	create := func(name string, parent *Department) Department {
+		d := Department{Name: name}
+		if parent != nil {
+			d.ParentID = &parent.ID
+		}
+		created, err := repo.CreateDepartment(ctx, d)
+		if err != nil {
+			t.Fatalf("create department %s: %v", name, err)
+		}
+		return created
+	}
+	var f deptFixture
+	f.eng = create("Engineering", nil)
+	f.backend = create("Backend", &f.eng)
+	f.db = create("Databases", &f.backend)
+	f.sales = create("Sales", nil)
+
+	registerDevice(t, repo, "kiosk-1")
+	s := NewService(repo, time.Minute)
+	f.events = map[string]string{}
+	for emp, dept := range map[string]*Department{
+		"e-eng": &f.eng, "e-backend": &f.backend, "e-db": &f.db, "e-sales": &f.sales, "e-none": nil,
+	} {
+		addEmployee(t, repo, emp)
+		if dept != nil {
+			if err := repo.SetEmployeeDepartment(ctx, emp, &dept.ID); err != nil {
+				t.Fatalf("assign %s: %v", emp, err)
+			}
+		}
+		evt, err := s.CheckIn(ctx, emp, "kiosk-1", "", "", time.Time{})
+		if err != nil {
+			t.Fatalf("check in %s: %v", emp, err)
+		}
+		f.events[emp] = evt.ID
+	}
+	return f
+}
+
+func eventUsers(events []Event) []string {
+	users := make([]string, 0, len(events))
+	for _, e := range events {
+		users = append(users, e.UserID)
+	}
+	slices.Sort(users)
+	return users
+}
+
+func TestDepartmentTree(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	f := newDeptFixture(t, repo)
+
+	tests := []struct {
+		name string
+		ids  []int64
+		want []int64
+	}{
+		{"root with subdepartments", []int64{f.eng.ID}, []int64{f.eng.ID, f.backend.ID, f.db.ID}},
+		{"middle of the tree", []int64{f.backend.ID}, []int64{f.backend.ID, f.db.ID}},
+		{"leaf", []int64{f.db.ID}, []int64{f.db.ID}},
+		{"two roots", []int64{f.sales.ID, f.db.ID}, []int64{f.db.ID, f.sales.ID}},
+		{"unknown id dropped", []int64{f.sales.ID, 999999}, []int64{f.sales.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.DepartmentTree(ctx, tt.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Fatalf("DepartmentTree(%v) = %v, want %v", tt.ids, got, want)
+			}
+		})
+	}
+}
+
+func TestDepartmentScopedReads(t *testing.T) {
+	repo := testRepo(t)
+	f := newDeptFixture(t, repo)
+
+	tests := []struct {
+		name  string
+		depts []int64
+		want  []string
+	}{
+		{"department with subdepartments", []int64{f.eng.ID}, []string{"e-backend", "e-db", "e-eng"}},
+		{"subdepartment", []int64{f.backend.ID}, []string{"e-backend", "e-db"}},
+		{"other branch", []int64{f.sales.ID}, []string{"e-sales"}},
+		{"no departments", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := repo.DepartmentTree(context.Background(), tt.depts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := WithDepartments(context.Background(), tree)
+
+			events, err := repo.ListEvents(ctx, "", "", 100, 0)
+			if err != nil {
+				t.Fatalf("ListEvents: %v", err)
+			}
+			if got := eventUsers(events); !slices.Equal(got, tt.want) {
+				t.Errorf("ListEvents users = %v, want %v", got, tt.want)
+			}
+
+			page, _, err := repo.ListEventsAfter(ctx, nil, EventFilter{}, 100)
+			if err != nil {
+				t.Fatalf("ListEventsAfter: %v", err)
+			}
+			if got := eventUsers(page); !slices.Equal(got, tt.want) {
+				t.Errorf("ListEventsAfter users = %v, want %v", got, tt.want)
+			}
+
+			// Asking for a user outside the scope by name finds nothing.
+			events, err = repo.ListEvents(ctx, "", "e-none", 100, 0)
+			if err != nil || len(events) != 0 {
+				t.Errorf("ListEvents of e-none = %d events, %v; want none", len(events), err)
+			}
+
+			for emp, id := range f.events {
+				_, err := repo.GetEvent(ctx, id)
+				visible := slices.Contains(tt.want, emp)
+				switch {
+				case visible && err != nil:
+					t.Errorf("GetEvent of %s: %v", emp, err)
+				case !visible && !errors.Is(err, ErrNotFound):
+					t.Errorf("GetEvent of %s outside the scope: err = %v, want ErrNotFound", emp, err)
+				}
+			}
+		})
+	}
+
+	// Unscoped reads see everyone, the employee without a department too.
+	events, err := repo.ListEvents(context.Background(), "", "", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := eventUsers(events), []string{"e-backend", "e-db", "e-eng", "e-none", "e-sales"}; !slices.Equal(got, want) {
+		t.Fatalf("unscoped ListEvents users = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,334 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HeartbeatInterval is the minimum spacing between stored heartbeats per
+// device; more frequent ones are accepted but not written.
+const HeartbeatInterval = 30 * time.Second
+
+// Device is a registered kiosk with its last reported state.
+type Device struct {
+	DeviceID   string          `json:"device_id"`
+	Name       *string         `json:"name,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	LastSeenAt *time.Time      `json:"last_seen_at,omitempty"`
+	AppVersion *string         `json:"app_version,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	Online     bool            `json:"online"`
+	// Suspicious is set after repeated failed face matches until an admin
+	// re-enables the device.
+	Suspicious   bool       `json:"suspicious"`
+	SuspiciousAt *time.Time `json:"suspicious_at,omitempty"`
+	// Latitude and Longitude are the device's geofence center, if set.
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// DisabledAt is set once the device is deactivated; ReprovisionAllowed
+	// lets a deactivated device id register again.
+	DisabledAt         *time.Time `json:"disabled_at,omitempty"`
+	ReprovisionAllowed bool       `json:"reprovision_allowed"`
+	// ClockSkewSeconds is how far ahead of server time the device's clock
+	// runs on average (behind when negative); ClockSkewed is set when that
+	// is beyond the configured threshold.
+	ClockSkewSeconds *float64   `json:"clock_skew_seconds,omitempty"`
+	ClockSkewAt      *time.Time `json:"clock_skew_at,omitempty"`
+	ClockSkewed      bool       `json:"clock_skewed"`
+}
+
+// AlertRepeatedFailures is the device_alerts kind raised when a device
+// reaches the failed-match threshold.
+const AlertRepeatedFailures = "repeated_failed_matches"
+
+// DeviceAlert is an anomaly raised for a device.
+type DeviceAlert struct {
+	ID         int64      `json:"id"`
+	DeviceID   string     `json:"device_id"`
+	Kind       string     `json:"kind"`
+	Failures   int        `json:"failures"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *string    `json:"resolved_by,omitempty"`
+}
+
+// Heartbeat records that a device is alive along with its app version and
+// free-form metadata (battery, storage). It is a single UPDATE that is a no-op
+// when the previous heartbeat is younger than HeartbeatInterval.
+func (r *Repository) Heartbeat(ctx context.Context, deviceID, appVersion string, metadata map[string]any) error {
+	var meta []byte
+	if len(metadata) > 0 {
+		var err error
+		if meta, err = json.Marshal(metadata); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE devices
+		SET last_seen_at = NOW(),
+		    app_version = COALESCE(NULLIF($2, ''), app_version),
+		    metadata = COALESCE($3, metadata)
+		WHERE device_id = $1
+		  AND (last_seen_at IS NULL OR last_seen_at < NOW() - make_interval(secs => $4))
+	`, deviceID, appVersion, meta, HeartbeatInterval.Seconds())
+	return err
+}
+
+// ListDevices returns all devices; a device is online when its last heartbeat
+// is within offlineAfter, and clock-skewed when its known skew is beyond
+// skewThreshold (0 flags none).
+func (r *Repository) ListDevices(ctx context.Context, offlineAfter, skewThreshold time.Duration) ([]Device, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT device_id, name, created_at, last_seen_at, app_version, metadata, suspicious_at, latitude, longitude,
+		       disabled_at, reprovision_allowed, clock_skew_seconds, clock_skew_samples, clock_skew_at
+		FROM devices
+		ORDER BY device_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var devices []Device
+	for rows.Next() {
+		var d Device
+		var meta []byte
+		var skew ClockSkew
+		if err := rows.Scan(&d.DeviceID, &d.Name, &d.CreatedAt, &d.LastSeenAt, &d.AppVersion, &meta, &d.SuspiciousAt, &d.Latitude, &d.Longitude,
+			&d.DisabledAt, &d.ReprovisionAllowed, &d.ClockSkewSeconds, &skew.Samples, &d.ClockSkewAt); err != nil {
+			return nil, err
+		}
+		if d.ClockSkewSeconds != nil {
+			skew.Offset = time.Duration(*d.ClockSkewSeconds * float64(time.Second))
+			d.ClockSkewed = skew.Known() && SkewExceeds(skew.Offset, skewThreshold)
+		}
+		if len(meta) > 0 {
+			d.Metadata = meta
+		}
+		d.Online = d.LastSeenAt != nil && now.Sub(*d.LastSeenAt) <= offlineAfter
+		d.Suspicious = d.SuspiciousAt != nil
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// FlagDeviceSuspicious marks a device suspicious and raises an alert with the
+// failure count. A device that is already flagged gets no second alert.
+func (r *Repository) FlagDeviceSuspicious(ctx context.Context, deviceID string, failures int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE devices SET suspicious_at = NOW()
+		WHERE device_id = $1 AND suspicious_at IS NULL
+	`, deviceID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO device_alerts (device_id, kind, failures) VALUES ($1, $2, $3)
+	`, deviceID, AlertRepeatedFailures, failures); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsDeviceSuspicious reports whether a device is currently flagged.
+func (r *Repository) IsDeviceSuspicious(ctx context.Context, deviceID string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var flagged bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT suspicious_at IS NOT NULL FROM devices WHERE device_id = $1
+	`, deviceID).Scan(&flagged)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return flagged, err
+}
+
+// EnableDevice clears the suspicious flag and resolves the device's open
+// alerts. It returns sql.ErrNoRows if the device does not exist.
+func (r *Repository) EnableDevice(ctx context.Context, deviceID, actor string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE devices SET suspicious_at = NULL WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res, sql.ErrNoRows); err != nil {
+		return storageErr(err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE device_alerts SET resolved_at = NOW(), resolved_by = $2
+		WHERE device_id = $1 AND resolved_at IS NULL
+	`, deviceID, actor); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableDevice deactivates a device, e.g. a replaced kiosk, and revokes
+// all its refresh tokens in one transaction, returning how many were live.
+// Its events are kept. Disabling a disabled device revokes any tokens left
+// and withdraws a reprovisioning allowance.
+func (r *Repository) DisableDevice(ctx context.Context, deviceID, actor string) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE devices SET
+			disabled_at = COALESCE(disabled_at, NOW()),
+			disabled_by = COALESCE(disabled_by, $2),
+			reprovision_allowed = FALSE
+		WHERE device_id = $1
+	`, deviceID, actor)
+	if err != nil {
+		return 0, storageErr(err)
+	}
+	if err := requireRow(res, fmt.Errorf("%w: device %s", ErrNotFound, deviceID)); err != nil {
+		return 0, err
+	}
+	res, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked = TRUE
+		WHERE device_id = $1 AND NOT revoked AND expires_at > NOW()
+	`, deviceID)
+	if err != nil {
+		return 0, storageErr(err)
+	}
+	revoked, _ := res.RowsAffected()
+	return revoked, storageErr(tx.Commit())
+}
+
+// AllowReprovision lets a deactivated device id register again, once. An
+// active device is ErrInvalidTransition.
+func (r *Repository) AllowReprovision(ctx context.Context, deviceID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var disabled bool
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE devices SET reprovision_allowed = disabled_at IS NOT NULL
+		WHERE device_id = $1
+		RETURNING disabled_at IS NOT NULL
+	`, deviceID).Scan(&disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: device %s", ErrNotFound, deviceID)
+	}
+	if err != nil {
+		return storageErr(err)
+	}
+	if !disabled {
+		return fmt.Errorf("%w: device %s is active; deactivate it first", ErrInvalidTransition, deviceID)
+	}
+	return nil
+}
+
+// ListDeviceAlerts returns alerts newest first, optionally only unresolved ones.
+func (r *Repository) ListDeviceAlerts(ctx context.Context, openOnly bool, limit int) ([]DeviceAlert, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, device_id, kind, failures, created_at, resolved_at, resolved_by
+		FROM device_alerts
+		WHERE NOT $1 OR resolved_at IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, openOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := []DeviceAlert{}
+	for rows.Next() {
+		var a DeviceAlert
+		if err := rows.Scan(&a.ID, &a.DeviceID, &a.Kind, &a.Failures, &a.CreatedAt, &a.ResolvedAt, &a.ResolvedBy); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// MaxPushTokenLength bounds the push tokens devices may register.
+const MaxPushTokenLength = 4096
+
+// SetPushToken registers a push token for a device. A token already
+// registered to another device moves to this one.
+func (r *Repository) SetPushToken(ctx context.Context, deviceID, token, platform string) error {
+	if token == "" || len(token) > MaxPushTokenLength {
+		return fmt.Errorf("%w: token must be 1 to %d characters", ErrValidation, MaxPushTokenLength)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO device_push_tokens (token, device_id, platform)
+		VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (token) DO UPDATE SET
+			device_id = EXCLUDED.device_id,
+			platform = EXCLUDED.platform,
+			updated_at = NOW()
+	`, token, deviceID, platform)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: device %s", ErrNotFound, deviceID)
+	}
+	return storageErr(err)
+}
+
+// DevicePushTokens returns the push tokens registered for a device.
+func (r *Repository) DevicePushTokens(ctx context.Context, deviceID string) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT token FROM device_push_tokens WHERE device_id = $1`, deviceID)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	var tokens []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeletePushToken removes a token the push service no longer accepts.
+func (r *Repository) DeletePushToken(ctx context.Context, token string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `DELETE FROM device_push_tokens WHERE token = $1`, token)
+	return storageErr(err)
+}
@@ -0,0 +1,103 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"attendance/internal/vectors"
+)
+
+// EmbeddingMatch is an employee returned by SearchEmbeddings, closest first.
+type EmbeddingMatch struct {
+	EmployeeID string  `json:"employee_id"`
+	Distance   float64 `json:"distance"`
+}
+
+// floatArray adapts a []float32 destination to scan a Postgres REAL[] column.
+func floatArray(dst *[]float32) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(dst)
+}
+
+// textArray adapts a []string destination to scan a nullable Postgres TEXT[] column.
+func textArray(dst *[]string) sql.Scanner {
+	return pgtype.NewMap().SQLScanner(dst)
+}
+
+// SetEmployeeEmbedding stores the face embedding captured at enrollment.
+func (r *Repository) SetEmployeeEmbedding(ctx context.Context, employeeID string, embedding []float32) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE employees SET face_embedding = $2, updated_at = NOW()
+		WHERE employee_id = $1
+	`, employeeID, embedding)
+	return err
+}
+
+// EmployeeEmbedding returns the enrolled embedding for an employee, or nil if
+// the employee does not exist or has none stored.
+func (r *Repository) EmployeeEmbedding(ctx context.Context, employeeID string) ([]float32, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var emb []float32
+	err := r.db.QueryRowContext(ctx, `SELECT face_embedding FROM employees WHERE employee_id = $1`, employeeID).Scan(floatArray(&emb))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return emb, err
+}
+
+// SetEventEmbedding caches the check-in embedding so a retry does not need the
+// face service to compute it again.
+func (r *Repository) SetEventEmbedding(ctx context.Context, id string, embedding []float32) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `UPDATE attendance_events SET embedding = $2 WHERE id = $1`, id, embedding)
+	return err
+}
+
+// EventEmbedding returns the cached check-in embedding, or nil if none is stored.
+func (r *Repository) EventEmbedding(ctx context.Context, id string) ([]float32, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var emb []float32
+	err := r.db.QueryRowContext(ctx, `SELECT embedding FROM attendance_events WHERE id = $1`, id).Scan(floatArray(&emb))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return emb, err
+}
+
+// SearchEmbeddings returns the topK enrolled employees nearest to embedding by
+// L2 distance. It requires the pgvector extension; without it the query fails.
+func (r *Repository) SearchEmbeddings(ctx context.Context, embedding []float32, topK int) ([]EmbeddingMatch, error) {
+	if topK <= 0 {
+		topK = 5
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT employee_id, face_embedding::vector <-> $1::vector AS distance
+		FROM employees
+		WHERE face_embedding IS NOT NULL AND cardinality(face_embedding) = $2
+		ORDER BY distance
+		LIMIT $3
+	`, vectors.Literal(embedding), len(embedding), topK)
+	if err != nil {
+		return nil, fmt.Errorf("vector search (is pgvector installed?): %w", err)
+	}
+	defer rows.Close()
+	var res []EmbeddingMatch
+	for rows.Next() {
+		var m EmbeddingMatch
+		if err := rows.Scan(&m.EmployeeID, &m.Distance); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
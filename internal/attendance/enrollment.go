@@ -0,0 +1,156 @@
+package attendance
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxEnrollmentCodes caps how many codes one provisioning batch may create.
+const MaxEnrollmentCodes = 500
+
+// codeAlphabet is Crockford's base32, which leaves out I, L, O and U so codes
+// read aloud or typed on a kiosk are not mistaken for one another.
+const codeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// codeLength is the number of symbols in a code (60 bits), shown in groups of four.
+const codeLength = 12
+
+// EnrollmentBatch is a set of one-time codes created together. Codes holds
+// the plaintext codes and is only filled in when the batch is created.
+type EnrollmentBatch struct {
+	BatchID   string    `json:"batch_id"`
+	Label     string    `json:"label,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Codes     []string  `json:"codes"`
+}
+
+// newEnrollmentCode returns a random code formatted as XXXX-XXXX-XXXX.
+func newEnrollmentCode() (string, error) {
+	buf := make([]byte, codeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, v := range buf {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		// 256 is a multiple of 32, so the modulo is unbiased.
+		b.WriteByte(codeAlphabet[int(v)%len(codeAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// hashEnrollmentCode normalizes a code as typed (case, dashes, spaces) and
+// returns the hash it is stored under.
+func hashEnrollmentCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateEnrollmentCodes generates n one-time codes valid for ttl and stores
+// their hashes under a new batch id. The plaintext codes are returned only here.
+func (r *Repository) CreateEnrollmentCodes(ctx context.Context, n int, ttl time.Duration, label, createdBy string) (EnrollmentBatch, error) {
+	if n <= 0 || n > MaxEnrollmentCodes {
+		return EnrollmentBatch{}, fmt.Errorf("%w: count must be between 1 and %d", ErrValidation, MaxEnrollmentCodes)
+	}
+	if ttl <= 0 {
+		return EnrollmentBatch{}, fmt.Errorf("%w: expiry must be positive", ErrValidation)
+	}
+	batch := EnrollmentBatch{
+		BatchID:   uuid.NewString(),
+		Label:     label,
+		ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Second),
+		Codes:     make([]string, 0, n),
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return EnrollmentBatch{}, storageErr(err)
+	}
+	defer tx.Rollback()
+	for len(batch.Codes) < n {
+		code, err := newEnrollmentCode()
+		if err != nil {
+			return EnrollmentBatch{}, err
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO enrollment_codes (code_hash, batch_id, label, created_by, expires_at)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5)
+			ON CONFLICT (code_hash) DO NOTHING
+		`, hashEnrollmentCode(code), batch.BatchID, label, createdBy, batch.ExpiresAt)
+		if err != nil {
+			return EnrollmentBatch{}, storageErr(err)
+		}
+		// A collision with an existing code is skipped and a new one drawn.
+		if rows, _ := res.RowsAffected(); rows == 1 {
+			batch.Codes = append(batch.Codes, code)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return EnrollmentBatch{}, storageErr(err)
+	}
+	return batch, nil
+}
+
+// RegisterDeviceWithCode consumes an unused, unexpired enrollment code and
+// registers the device as RegisterDevice does in the same transaction,
+// recording the code and batch on the device row. A code that is unknown,
+// used or expired returns ErrEnrollmentCode and changes nothing, as does a
+// device that may not register.
+func (r *Repository) RegisterDeviceWithCode(ctx context.Context, deviceID, name, code string) (reprovisioned bool, err error) {
+	if deviceID == "" {
+		return false, fmt.Errorf("%w: device id required", ErrValidation)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	var codeID, batchID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE enrollment_codes
+		SET used_at = NOW(), used_by_device = $2
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, batch_id
+	`, hashEnrollmentCode(code), deviceID).Scan(&codeID, &batchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("%w: code is invalid, already used or expired", ErrEnrollmentCode)
+	}
+	if err != nil {
+		return false, storageErr(err)
+	}
+	if reprovisioned, err = claimDevice(ctx, tx, deviceID, name, codeID, batchID); err != nil {
+		return false, err
+	}
+	return reprovisioned, storageErr(tx.Commit())
+}
+
+// DeviceExists reports whether deviceID is registered.
+func (r *Repository) DeviceExists(ctx context.Context, deviceID string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM devices WHERE device_id = $1)`, deviceID).Scan(&exists)
+	return exists, storageErr(err)
+}
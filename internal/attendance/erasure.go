@@ -0,0 +1,149 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErasureReport counts what erasing a user's data changed. Erasing a user
+// with nothing left to erase reports zeros.
+type ErasureReport struct {
+	UserID string `json:"user_id"`
+	// Tombstone replaces the user id on the anonymized rows; empty when
+	// nothing was found.
+	Tombstone          string `json:"tombstone,omitempty"`
+	EmployeeAnonymized bool   `json:"employee_anonymized"`
+	EventsAnonymized   int64  `json:"events_anonymized"`
+	ArchivedAnonymized int64  `json:"archived_events_anonymized"`
+	CorrectionsUpdated int64  `json:"corrections_updated"`
+	FaceAuditDeleted   int64  `json:"face_audit_deleted"`
+	AnomaliesDeleted   int64  `json:"anomalies_deleted"`
+	ShiftUnassigned    bool   `json:"shift_unassigned"`
+	ImagesDeleted      int    `json:"images_deleted"`
+	GalleryDeleted     bool   `json:"gallery_deleted"`
+}
+
+// UserImageURLs returns every stored image of a user: check-in images,
+// including archived ones, and the enrollment photo.
+func (r *Repository) UserImageURLs(ctx context.Context, userID string) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT image_url FROM attendance_events
+		WHERE user_id = $1 AND image_url IS NOT NULL AND image_url <> ''
+		UNION
+		SELECT unnest(image_urls) FROM attendance_events
+		WHERE user_id = $1 AND image_urls IS NOT NULL
+		UNION
+		SELECT event->>'image_url' FROM attendance_events_archive
+		WHERE event->>'user_id' = $1 AND COALESCE(event->>'image_url', '') <> ''
+		UNION
+		SELECT jsonb_array_elements_text(event->'image_urls') FROM attendance_events_archive
+		WHERE event->>'user_id' = $1 AND jsonb_typeof(event->'image_urls') = 'array'
+		UNION
+		SELECT photo_url FROM employees
+		WHERE employee_id = $1 AND photo_url IS NOT NULL AND photo_url <> ''
+	`, userID)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, storageErr(rows.Err())
+}
+
+// AnonymizeUser removes a user's personal data in one transaction while
+// keeping their events countable: events keep their device, time, status and
+// score but move to a random tombstone id and lose image, location and
+// embedding. The employee row keeps its department under the tombstone and
+// loses name, email, photo and embedding. Face audit rows of the events, which
+// hold image URLs, and anomaly findings naming the user are deleted, and the
+// shift assignment is dropped. Images
+// must be deleted from storage before, since the URLs are gone afterwards.
+func (r *Repository) AnonymizeUser(ctx context.Context, userID string) (ErasureReport, error) {
+	rep := ErasureReport{UserID: userID}
+	if userID == "" {
+		return rep, fmt.Errorf("%w: user id required", ErrValidation)
+	}
+	tombstone := "erased-" + uuid.NewString()
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return rep, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	var employees, shifts, pinLinks int64
+	steps := []struct {
+		dst   *int64
+		query string
+		args  []any
+	}{
+		{&rep.FaceAuditDeleted, `
+			DELETE FROM face_audit
+			WHERE event_id IN (SELECT id FROM attendance_events WHERE user_id = $1)
+		`, []any{userID}},
+		{&rep.AnomaliesDeleted, `
+			DELETE FROM anomalies WHERE user_id = $1 OR other_user_id = $1
+		`, []any{userID}},
+		{&rep.CorrectionsUpdated, `
+			UPDATE event_corrections SET
+				old_value = CASE WHEN old_value = $1 THEN $2 ELSE old_value END,
+				new_value = CASE WHEN new_value = $1 THEN $2 ELSE new_value END
+			WHERE field = 'user_id' AND (old_value = $1 OR new_value = $1)
+		`, []any{userID, tombstone}},
+		{&rep.EventsAnonymized, `
+			UPDATE attendance_events
+			SET user_id = $2, image_url = NULL, image_urls = NULL, location = NULL, embedding = NULL
+			WHERE user_id = $1
+		`, []any{userID, tombstone}},
+		{&rep.ArchivedAnonymized, `
+			UPDATE attendance_events_archive SET
+				event = (event - 'image_url' - 'image_urls' - 'location' - 'embedding') || jsonb_build_object('user_id', $2::text),
+				corrections = (
+					SELECT jsonb_agg(CASE WHEN c->>'field' = 'user_id' THEN c || jsonb_build_object(
+						'old_value', CASE WHEN c->>'old_value' = $1 THEN $2 ELSE c->>'old_value' END,
+						'new_value', CASE WHEN c->>'new_value' = $1 THEN $2 ELSE c->>'new_value' END
+					) ELSE c END)
+					FROM jsonb_array_elements(corrections) c
+				)
+			WHERE event->>'user_id' = $1
+		`, []any{userID, tombstone}},
+		{&shifts, `DELETE FROM user_shifts WHERE user_id = $1`, []any{userID}},
+		{&pinLinks, `DELETE FROM pin_links WHERE employee_id = $1`, []any{userID}},
+		{&employees, `
+			UPDATE employees SET
+				employee_id = $2, name = NULL, email = NULL, photo_url = NULL,
+				face_embedding = NULL, face_enrolled = FALSE, enrolled_at = NULL,
+				pin_hash = NULL, pin_failed_attempts = 0, pin_locked_at = NULL, updated_at = NOW()
+			WHERE employee_id = $1
+		`, []any{userID, tombstone}},
+	}
+	for _, s := range steps {
+		res, err := tx.ExecContext(ctx, s.query, s.args...)
+		if err != nil {
+			return ErasureReport{UserID: userID}, storageErr(err)
+		}
+		*s.dst, _ = res.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return ErasureReport{UserID: userID}, storageErr(err)
+	}
+	rep.EmployeeAnonymized = employees > 0
+	rep.ShiftUnassigned = shifts > 0
+	if rep.EmployeeAnonymized || rep.EventsAnonymized > 0 || rep.ArchivedAnonymized > 0 || rep.CorrectionsUpdated > 0 {
+		rep.Tombstone = tombstone
+	}
+	return rep, nil
+}
@@ -0,0 +1,75 @@
+package attendance
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Domain errors returned (wrapped with %w) by the service and repository.
+// Handlers map them to HTTP statuses; match them with errors.Is.
+var (
+	// ErrValidation means the request itself is invalid.
+	ErrValidation = errors.New("validation failed")
+	// ErrDuplicate means an equivalent record already exists, e.g. a check-in
+	// inside the dedup window.
+	ErrDuplicate = errors.New("duplicate")
+	// ErrDeviceDisabled means the device is locked out and may not check in.
+	ErrDeviceDisabled = errors.New("device disabled")
+	// ErrEnrollmentCode means a device registration lacked a required
+	// enrollment code or presented one that is unknown, used or expired.
+	ErrEnrollmentCode = errors.New("enrollment code rejected")
+	// ErrNotFound means the addressed record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrTokenRevoked means a refresh token is unknown, revoked or expired.
+	ErrTokenRevoked = errors.New("refresh token revoked or expired")
+	// ErrSelfApproval means an admin tried to review a manual event they
+	// entered themselves.
+	ErrSelfApproval = errors.New("manual events must be reviewed by another admin")
+	// ErrPINRejected means a PIN check-in named a user without a PIN or gave
+	// the wrong one.
+	ErrPINRejected = errors.New("PIN rejected")
+	// ErrPINLocked means the user's PIN is locked after repeated wrong
+	// attempts until a new one is set.
+	ErrPINLocked = errors.New("PIN locked")
+	// ErrTooOld means an offline check-in was submitted too long after it
+	// happened to be accepted.
+	ErrTooOld = errors.New("check-in too old")
+	// ErrUnknownUser means a check-in named a user who is not an employee
+	// while strict user checking is on.
+	ErrUnknownUser = errors.New("unknown user")
+	// ErrStorage means the database could not be reached or did not answer in time.
+	ErrStorage = errors.New("storage unavailable")
+)
+
+// storageErr classifies a database error: sql.ErrNoRows also matches
+// ErrNotFound, and failures that never got an answer from Postgres
+// (connection errors, timeouts) match ErrStorage. Errors reported by the
+// server itself are returned unchanged.
+func storageErr(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	case errors.As(err, &pgErr), errors.Is(err, ErrStorage):
+		return err
+	default:
+		return fmt.Errorf("%w: %w", ErrStorage, err)
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign_key_violation.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,38 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsUnavailable(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection refused", storageErr(refused), true},
+		{"bad connection", storageErr(driver.ErrBadConn), true},
+		{"connection closed", storageErr(sql.ErrConnDone), true},
+		{"query timeout", storageErr(context.DeadlineExceeded), true},
+		{"caller cancelled", storageErr(context.Canceled), false},
+		{"cancelled during a dial", storageErr(fmt.Errorf("%w: %w", context.Canceled, refused)), false},
+		{"server error", storageErr(&pgconn.PgError{Code: "23505"}), false},
+		{"not found", storageErr(sql.ErrNoRows), false},
+		{"validation", ErrValidation, false},
+	}
+	for _, tt := range tests {
+		if got := IsUnavailable(tt.err); got != tt.want {
+			t.Errorf("%s: IsUnavailable(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
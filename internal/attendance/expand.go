@@ -0,0 +1,74 @@
+package attendance
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownExpand is returned by ParseExpand for an unsupported expand value.
+var ErrUnknownExpand = fmt.Errorf("%w: unknown expand value", ErrValidation)
+
+// Expand selects related records to include with listed events.
+type Expand struct {
+	User   bool
+	Device bool
+}
+
+// ParseExpand parses a comma-separated expand parameter ("user", "device").
+// An empty string expands nothing.
+func ParseExpand(raw string) (Expand, error) {
+	var e Expand
+	for _, part := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(part) {
+		case "":
+		case "user":
+			e.User = true
+		case "device":
+			e.Device = true
+		default:
+			return Expand{}, fmt.Errorf("%w: %q (want user, device)", ErrUnknownExpand, part)
+		}
+	}
+	return e, nil
+}
+
+// EventUser is the employee behind an event's user_id. Fields are nil when
+// the user has no employee record.
+type EventUser struct {
+	Name       *string `json:"name"`
+	Department *string `json:"department"`
+	PhotoURL   *string `json:"photo_url"`
+}
+
+// EventDevice is the device an event was recorded on.
+type EventDevice struct {
+	Name *string `json:"name"`
+}
+
+// ExpandedEvent is an Event with the related records requested via Expand.
+// Without expansion it marshals exactly like Event.
+type ExpandedEvent struct {
+	Event
+	User   *EventUser   `json:"user,omitempty"`
+	Device *EventDevice `json:"device,omitempty"`
+}
+
+// qualifiedEventColumns returns eventColumns prefixed with a table alias.
+func qualifiedEventColumns(alias string) string {
+	cols := strings.Split(eventColumns, ", ")
+	for i, c := range cols {
+		cols[i] = alias + "." + c
+	}
+	return strings.Join(cols, ", ")
+}
+
+// extraScanner appends extra destinations to every Scan, so scanEvent can
+// read a row that carries joined columns after eventColumns.
+type extraScanner struct {
+	scanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
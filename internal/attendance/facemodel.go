@@ -0,0 +1,123 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// FaceModelCount is how many enrolled employees were enrolled with Model. A
+// nil Model counts enrollments made before models were recorded.
+type FaceModelCount struct {
+	Model     *string `json:"model"`
+	Employees int     `json:"employees"`
+}
+
+// SetEmployeeFaceModel records the face-service model an employee was
+// enrolled with.
+func (r *Repository) SetEmployeeFaceModel(ctx context.Context, employeeID, model string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE employees SET face_model = $2, updated_at = NOW()
+		WHERE employee_id = $1
+	`, employeeID, model)
+	return err
+}
+
+// EmployeeFaceModel returns the model an employee was enrolled with, or ""
+// if the employee does not exist or none was recorded.
+func (r *Repository) EmployeeFaceModel(ctx context.Context, employeeID string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var model sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT face_model FROM employees WHERE employee_id = $1`, employeeID).Scan(&model)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return model.String, err
+}
+
+// SetEventFaceModel records the model a check-in was processed under and
+// whether it differs from the user's enrollment.
+func (r *Repository) SetEventFaceModel(ctx context.Context, id, model string, mismatch bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE attendance_events SET face_model = $2, model_mismatch = $3 WHERE id = $1
+	`, id, model, mismatch)
+	return err
+}
+
+// FaceModelCounts counts enrolled employees by the model they were enrolled
+// with, largest group first.
+func (r *Repository) FaceModelCounts(ctx context.Context) ([]FaceModelCount, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT face_model, COUNT(*) FROM employees
+		WHERE face_enrolled
+		GROUP BY face_model
+		ORDER BY COUNT(*) DESC, face_model
+	`)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	counts := []FaceModelCount{}
+	for rows.Next() {
+		var fc FaceModelCount
+		if err := rows.Scan(&fc.Model, &fc.Employees); err != nil {
+			return nil, storageErr(err)
+		}
+		counts = append(counts, fc)
+	}
+	return counts, storageErr(rows.Err())
+}
+
+// ReenrollCandidate is an enrolled employee whose face must be enrolled
+// again under the current model.
+type ReenrollCandidate struct {
+	EmployeeID string
+	Name       *string
+	PhotoURL   *string
+}
+
+// ReenrollCandidates returns up to limit enrolled employees not enrolled
+// with model, in employee_id order after the given one.
+func (r *Repository) ReenrollCandidates(ctx context.Context, model, after string, limit int) ([]ReenrollCandidate, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT employee_id, name, photo_url FROM employees
+		WHERE face_enrolled AND face_model IS DISTINCT FROM $1 AND employee_id > $2
+		ORDER BY employee_id
+		LIMIT $3
+	`, model, after, limit)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	var out []ReenrollCandidate
+	for rows.Next() {
+		var c ReenrollCandidate
+		if err := rows.Scan(&c.EmployeeID, &c.Name, &c.PhotoURL); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, storageErr(rows.Err())
+}
+
+// CountReenrollCandidates counts what ReenrollCandidates would return
+// without a limit.
+func (r *Repository) CountReenrollCandidates(ctx context.Context, model, after string) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM employees
+		WHERE face_enrolled AND face_model IS DISTINCT FROM $1 AND employee_id > $2
+	`, model, after).Scan(&n)
+	return n, storageErr(err)
+}
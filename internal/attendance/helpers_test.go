@@ -0,0 +1,31 @@
+package attendance
+
+import (
+	"context"
+	"testing"
+
+	"attendance/internal/testdb"
+)
+
+// testRepo returns a repository over a freshly migrated database, or skips
+// the test when none is configured.
+func testRepo(t *testing.T) *Repository {
+	t.Helper()
+	return NewRepository(testdb.Open(t), 0)
+}
+
+// registerDevice registers deviceID, which check-ins must name.
+func registerDevice(t *testing.T, repo *Repository, deviceID string) {
+	t.Helper()
+	if _, err := repo.RegisterDevice(context.Background(), deviceID, deviceID); err != nil {
+		t.Fatalf("register device %s: %v", deviceID, err)
+	}
+}
+
+// addEmployee creates an employee.
+func addEmployee(t *testing.T, repo *Repository, employeeID string) {
+	t.Helper()
+	if err := repo.UpsertEmployee(context.Background(), employeeID, nil); err != nil {
+		t.Fatalf("add employee %s: %v", employeeID, err)
+	}
+}
@@ -0,0 +1,61 @@
+package attendance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MaxCheckinImages is how many images one check-in may carry.
+const MaxCheckinImages = 3
+
+// ImageScore is how one image of a multi-image check-in fared in the worker.
+type ImageScore struct {
+	// Index is the image's position in the check-in's ImageURLs.
+	Index   int      `json:"index"`
+	Quality *float64 `json:"quality,omitempty"`
+	// QualityOK is whether the image passed the quality thresholds.
+	QualityOK  bool     `json:"quality_ok"`
+	Similarity *float64 `json:"similarity,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ImageScores records the images of a multi-image check-in and which one the
+// worker picked.
+type ImageScores struct {
+	Winner int          `json:"winner"`
+	Images []ImageScore `json:"images"`
+}
+
+// CheckInImages is CheckIn with up to MaxCheckinImages frames of the same
+// face. The first is the event's image until the worker picks the best one.
+func (s *Service) CheckInImages(ctx context.Context, userID, deviceID, location string, imageURLs []string, clientTime time.Time) (Event, error) {
+	evt := Event{UserID: userID, DeviceID: deviceID, Location: location}
+	switch {
+	case len(imageURLs) > MaxCheckinImages:
+		err := fmt.Errorf("%w: a check-in carries at most %d images, got %d", ErrValidation, MaxCheckinImages, len(imageURLs))
+		s.countCheckin(err)
+		return Event{}, err
+	case len(imageURLs) == 1:
+		evt.ImageURL = imageURLs[0]
+	case len(imageURLs) > 1:
+		evt.ImageURL, evt.ImageURLs = imageURLs[0], imageURLs
+	}
+	return s.checkIn(ctx, evt, clientTime, time.Now())
+}
+
+// SetEventImageChoice makes url, picked from a multi-image check-in, the
+// event's image and stores how every image scored.
+func (r *Repository) SetEventImageChoice(ctx context.Context, id, url string, scores ImageScores) error {
+	data, err := json.Marshal(scores)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE attendance_events SET image_url = $2, image_scores = $3 WHERE id = $1
+	`, id, url, data)
+	return err
+}
@@ -0,0 +1,69 @@
+package attendance
+
+import (
+	"context"
+	"strings"
+)
+
+// ImportBatchSize is the number of rows ImportEvents accepts per call; it
+// keeps a multi-row INSERT well below Postgres' 65535 parameter limit.
+const ImportBatchSize = 1000
+
+// ImportEvents bulk-inserts historical events in one transaction, creating
+// any devices they reference. Events already present under the natural key
+// (user_id, device_id, occurred_at) are skipped. It returns how many rows
+// were inserted. Events need UserID, DeviceID, When and Status set.
+func (r *Repository) ImportEvents(ctx context.Context, events []Event) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	devices := make(map[string]bool)
+	var deviceArgs []any
+	var devicePlaceholders []string
+	for _, evt := range events {
+		if !devices[evt.DeviceID] {
+			devices[evt.DeviceID] = true
+			deviceArgs = append(deviceArgs, evt.DeviceID)
+			devicePlaceholders = append(devicePlaceholders, "($"+itoa(len(deviceArgs))+")")
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO devices (device_id) VALUES `+strings.Join(devicePlaceholders, ", ")+`
+		ON CONFLICT (device_id) DO NOTHING
+	`, deviceArgs...); err != nil {
+		return 0, err
+	}
+
+	args := make([]any, 0, len(events)*5)
+	rows := make([]string, 0, len(events))
+	for _, evt := range events {
+		n := len(args)
+		rows = append(rows, "($"+itoa(n+1)+", $"+itoa(n+2)+", $"+itoa(n+3)+", NULLIF($"+itoa(n+4)+", ''), $"+itoa(n+5)+
+			", NOT EXISTS (SELECT 1 FROM employees WHERE employee_id = $"+itoa(n+1)+"))")
+		args = append(args, evt.UserID, evt.DeviceID, evt.When, evt.Location, evt.Status)
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO attendance_events (user_id, device_id, occurred_at, location, status, unknown_user)
+		VALUES `+strings.Join(rows, ", ")+`
+		ON CONFLICT (user_id, device_id, occurred_at) DO NOTHING
+	`, args...)
+	if err != nil {
+		return 0, err
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(inserted), nil
+}
@@ -0,0 +1,177 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ManualEventRequest describes an attendance record an admin enters by hand,
+// for example when the user's kiosk was broken.
+type ManualEventRequest struct {
+	UserID        string
+	DeviceID      string
+	OccurredAt    time.Time
+	Location      string
+	Justification string
+	// RequestedBy is the admin entering the record; another admin must
+	// approve it.
+	RequestedBy string
+}
+
+// ManualEvent is a manually entered event with its approval state.
+type ManualEvent struct {
+	Event
+	Justification   string     `json:"justification"`
+	RequestedBy     string     `json:"requested_by"`
+	ReviewedBy      *string    `json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	RejectionReason *string    `json:"rejection_reason"`
+}
+
+// manualColumns follows eventColumns in the queries scanManualEvent reads.
+const manualColumns = `justification, requested_by, reviewed_by, reviewed_at, rejection_reason`
+
+func scanManualEvent(row scanner) (ManualEvent, error) {
+	var m ManualEvent
+	evt, err := scanEvent(extraScanner{row, []any{
+		&m.Justification, &m.RequestedBy, &m.ReviewedBy, &m.ReviewedAt, &m.RejectionReason,
+	}})
+	if err != nil {
+		return ManualEvent{}, err
+	}
+	m.Event = evt
+	return m, nil
+}
+
+// CreateManualEvent stores a manual record awaiting approval. It is not
+// queued for face processing and does not count as attendance until
+// ReviewManualEvent approves it.
+func (r *Repository) CreateManualEvent(ctx context.Context, req ManualEventRequest) (ManualEvent, error) {
+	req.Justification = strings.TrimSpace(req.Justification)
+	switch {
+	case req.UserID == "" || req.DeviceID == "":
+		return ManualEvent{}, fmt.Errorf("%w: user_id and device_id are required", ErrValidation)
+	case req.OccurredAt.IsZero():
+		return ManualEvent{}, fmt.Errorf("%w: occurred_at is required", ErrValidation)
+	case req.OccurredAt.After(time.Now().Add(time.Minute)):
+		return ManualEvent{}, fmt.Errorf("%w: occurred_at is in the future", ErrValidation)
+	case req.Justification == "":
+		return ManualEvent{}, fmt.Errorf("%w: justification is required", ErrValidation)
+	case req.RequestedBy == "":
+		return ManualEvent{}, fmt.Errorf("%w: requesting admin unknown", ErrValidation)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	m, err := scanManualEvent(r.db.QueryRowContext(ctx, `
+		INSERT INTO attendance_events (user_id, device_id, occurred_at, location, status, justification, requested_by, unknown_user)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, NOT EXISTS (SELECT 1 FROM employees WHERE employee_id = $1))
+		RETURNING `+eventColumns+`, `+manualColumns,
+		req.UserID, req.DeviceID, req.OccurredAt, req.Location, StatusAwaitingApproval, req.Justification, req.RequestedBy))
+	switch {
+	case isForeignKeyViolation(err):
+		return ManualEvent{}, fmt.Errorf("%w: device %s is not registered", ErrValidation, req.DeviceID)
+	case isUniqueViolation(err):
+		return ManualEvent{}, fmt.Errorf("%w: user %s already has an event on device %s at %s",
+			ErrDuplicate, req.UserID, req.DeviceID, req.OccurredAt.UTC().Format(time.RFC3339))
+	}
+	return m, storageErr(err)
+}
+
+// ReviewManualEvent approves (to processed) or rejects (to rejected) a manual
+// event awaiting approval. The reviewer must differ from the admin who
+// entered it, and a rejection needs a reason. An event that is not awaiting
+// approval is reported as ErrInvalidTransition.
+func (r *Repository) ReviewManualEvent(ctx context.Context, id, reviewer string, approve bool, reason string) (ManualEvent, error) {
+	to := StatusProcessed
+	if !approve {
+		to = StatusRejected
+	}
+	reason = strings.TrimSpace(reason)
+	if reviewer == "" {
+		return ManualEvent{}, fmt.Errorf("%w: reviewing admin unknown", ErrValidation)
+	}
+	if !approve && reason == "" {
+		return ManualEvent{}, fmt.Errorf("%w: reason is required", ErrValidation)
+	}
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ManualEvent{}, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	var status, requestedBy string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, COALESCE(requested_by, '') FROM attendance_events WHERE id = $1 FOR UPDATE
+	`, id).Scan(&status, &requestedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ManualEvent{}, fmt.Errorf("%w: event %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return ManualEvent{}, storageErr(err)
+	}
+	if !CanReview(status, to) {
+		return ManualEvent{}, fmt.Errorf("%w: event %s is %s, not %s", ErrInvalidTransition, id, status, StatusAwaitingApproval)
+	}
+	if requestedBy == reviewer {
+		return ManualEvent{}, fmt.Errorf("%w: %s entered event %s", ErrSelfApproval, reviewer, id)
+	}
+
+	m, err := scanManualEvent(tx.QueryRowContext(ctx, `
+		UPDATE attendance_events
+		SET status = $2, reviewed_by = $3, reviewed_at = NOW(), rejection_reason = NULLIF($4, '')
+		WHERE id = $1
+		RETURNING `+eventColumns+`, `+manualColumns, id, to, reviewer, reason))
+	if err != nil {
+		return ManualEvent{}, storageErr(err)
+	}
+	if err := recordStatusChange(ctx, tx, id, status, to, reviewer); err != nil {
+		return ManualEvent{}, storageErr(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return ManualEvent{}, storageErr(err)
+	}
+	return m, nil
+}
+
+// ListAwaitingApproval returns manual events waiting for review, oldest first.
+func (r *Repository) ListAwaitingApproval(ctx context.Context, limit, offset int) ([]ManualEvent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+eventColumns+`, `+manualColumns+`
+		FROM attendance_events
+		WHERE status = $1
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3
+	`, StatusAwaitingApproval, limit, offset)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	res := []ManualEvent{}
+	for rows.Next() {
+		m, err := scanManualEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, storageErr(rows.Err())
+}
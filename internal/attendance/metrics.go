@@ -0,0 +1,38 @@
+package attendance
+
+import "errors"
+
+// Check-in results reported to Metrics.
+const (
+	CheckinCreated      = "created"
+	CheckinDeduplicated = "deduplicated"
+	CheckinRejected     = "rejected"
+)
+
+// Metrics receives the result of every check-in the service handles. The
+// service counts through it rather than a Prometheus registry of its own, so
+// it can run without one.
+type Metrics interface {
+	CheckinResult(result string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) CheckinResult(string) {}
+
+// countCheckin reports a check-in that ended in err. Storage failures and
+// timeouts are not an answer about the check-in and are not counted.
+func (s *Service) countCheckin(err error) {
+	if s.Metrics == nil {
+		return
+	}
+	switch {
+	case err == nil:
+		s.Metrics.CheckinResult(CheckinCreated)
+	case errors.Is(err, ErrDuplicate):
+		s.Metrics.CheckinResult(CheckinDeduplicated)
+	case errors.Is(err, ErrStorage), IsTimeout(err):
+	default:
+		s.Metrics.CheckinResult(CheckinRejected)
+	}
+}
@@ -0,0 +1,157 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"attendance/internal/queue"
+)
+
+// OutboxMessage is a queue message stored in the outbox table. It is written
+// in the same transaction as the change it announces, so a crash between the
+// commit and the publish cannot lose it.
+type OutboxMessage struct {
+	ID        int64
+	Queue     string
+	Type      string
+	Key       string
+	Body      []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// checkinOutbox is the message that hands a pending event to the worker.
+func checkinOutbox(eventID string) OutboxMessage {
+	return OutboxMessage{Queue: queue.Checkins, Type: "checkin", Key: eventID, Body: []byte(eventID)}
+}
+
+func insertOutbox(ctx context.Context, tx *sql.Tx, m OutboxMessage) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (queue, type, msg_key, body) VALUES ($1, $2, $3, $4)
+	`, m.Queue, m.Type, m.Key, m.Body)
+	return err
+}
+
+// MarkOutboxDispatched records that the pending message with key on
+// queueName was published directly, so the relay does not send it again.
+func (r *Repository) MarkOutboxDispatched(ctx context.Context, queueName, key string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox SET dispatched_at = NOW()
+		WHERE queue = $1 AND msg_key = $2 AND dispatched_at IS NULL
+	`, queueName, key)
+	return err
+}
+
+// DiscardPendingCheckin deletes a pending event together with its outbox
+// row, for a check-in the API could not queue and asks the client to retry.
+// It returns false, deleting nothing, once the event has moved on or the
+// relay has already dispatched the row, since the worker will then handle it.
+func (r *Repository) DiscardPendingCheckin(ctx context.Context, eventID string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM outbox WHERE queue = $1 AND msg_key = $2 AND dispatched_at IS NULL
+	`, queue.Checkins, eventID)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	res, err = tx.ExecContext(ctx, `DELETE FROM attendance_events WHERE id = $1 AND status = $2`, eventID, StatusPending)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	return true, storageErr(tx.Commit())
+}
+
+// DispatchOutbox publishes up to limit undispatched messages created more
+// than minAge ago, oldest first, and marks them dispatched. Rows locked by
+// another relay are skipped. It stops at the first publish error, recording
+// it on that row, and returns how many messages were sent.
+func (r *Repository) DispatchOutbox(ctx context.Context, minAge time.Duration, limit int, publish func(context.Context, OutboxMessage) error) (int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, queue, type, msg_key, body, attempts, created_at FROM outbox
+		WHERE dispatched_at IS NULL AND created_at < NOW() - make_interval(secs => $1)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, minAge.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+	var batch []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Queue, &m.Type, &m.Key, &m.Body, &m.Attempts, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var publishErr error
+	for _, m := range batch {
+		if publishErr = publish(ctx, m); publishErr != nil {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1
+			`, m.ID, publishErr.Error()); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET dispatched_at = NOW() WHERE id = $1`, m.ID); err != nil {
+			return 0, err
+		}
+		sent++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return sent, publishErr
+}
+
+// OutboxBacklog returns the number of messages not yet dispatched.
+func (r *Repository) OutboxBacklog(ctx context.Context) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var n int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox WHERE dispatched_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// PurgeOutbox deletes messages dispatched before cutoff.
+func (r *Repository) PurgeOutbox(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE dispatched_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
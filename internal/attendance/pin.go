@@ -0,0 +1,215 @@
+package attendance
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Check-in authentication methods, stored on each event.
+const (
+	// AuthMethodFace is a check-in whose photo the worker matches.
+	AuthMethodFace = "face"
+	// AuthMethodPIN is a photo-less check-in verified by the employee's PIN.
+	AuthMethodPIN = "pin"
+)
+
+// PIN length bounds, in digits.
+const (
+	MinPINLength = 4
+	MaxPINLength = 8
+)
+
+// ValidatePIN checks that pin is 4 to 8 digits.
+func ValidatePIN(pin string) error {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength {
+		return fmt.Errorf("%w: PIN must be %d to %d digits", ErrValidation, MinPINLength, MaxPINLength)
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: PIN must be %d to %d digits", ErrValidation, MinPINLength, MaxPINLength)
+		}
+	}
+	return nil
+}
+
+// setPIN stores the bcrypt hash of pin for employeeID and clears any lockout.
+func setPIN(ctx context.Context, ex execer, employeeID, pin string) error {
+	if err := ValidatePIN(pin); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := ex.ExecContext(ctx, `
+		UPDATE employees
+		SET pin_hash = $2, pin_failed_attempts = 0, pin_locked_at = NULL, updated_at = NOW()
+		WHERE employee_id = $1
+	`, employeeID, string(hash))
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: employee %s", ErrNotFound, employeeID))
+}
+
+// execer is the part of *sql.DB and *sql.Tx that setPIN needs.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// SetPIN sets or replaces an employee's PIN, which also lifts a lockout.
+func (r *Repository) SetPIN(ctx context.Context, employeeID, pin string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return setPIN(ctx, r.db, employeeID, pin)
+}
+
+// VerifyPIN checks pin against the employee's PIN. A wrong PIN counts toward
+// the lockout, which lockAfter consecutive wrong PINs trigger (0 never
+// locks); the right one resets the count. Unknown users and users without a
+// PIN get ErrPINRejected, like a wrong PIN, and a locked PIN gets
+// ErrPINLocked even when it is right.
+func (r *Repository) VerifyPIN(ctx context.Context, employeeID, pin string, lockAfter int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var (
+		hash     sql.NullString
+		failures int
+		lockedAt *time.Time
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT pin_hash, pin_failed_attempts, pin_locked_at FROM employees WHERE employee_id = $1
+	`, employeeID).Scan(&hash, &failures, &lockedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrPINRejected
+	case err != nil:
+		return storageErr(err)
+	case !hash.Valid:
+		return ErrPINRejected
+	case lockedAt != nil:
+		return ErrPINLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash.String), []byte(pin)) == nil {
+		if failures > 0 {
+			if _, err := r.db.ExecContext(ctx, `UPDATE employees SET pin_failed_attempts = 0 WHERE employee_id = $1`, employeeID); err != nil {
+				return storageErr(err)
+			}
+		}
+		return nil
+	}
+	err = r.db.QueryRowContext(ctx, `
+		UPDATE employees SET
+			pin_failed_attempts = pin_failed_attempts + 1,
+			pin_locked_at = CASE WHEN $2 > 0 AND pin_failed_attempts + 1 >= $2 THEN NOW() END
+		WHERE employee_id = $1
+		RETURNING pin_locked_at
+	`, employeeID, lockAfter).Scan(&lockedAt)
+	if err != nil {
+		return storageErr(err)
+	}
+	if lockedAt != nil {
+		return fmt.Errorf("%w: too many wrong PINs", ErrPINLocked)
+	}
+	return ErrPINRejected
+}
+
+// PINLink is a one-time link for an employee to choose their own PIN. Token
+// is only filled in when the link is created.
+type PINLink struct {
+	EmployeeID string    `json:"employee_id"`
+	Token      string    `json:"token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func hashPINLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePINLink creates a link valid for ttl that lets employeeID set a PIN
+// once. Earlier unused links for the employee stay valid until they expire.
+func (r *Repository) CreatePINLink(ctx context.Context, employeeID, createdBy string, ttl time.Duration) (PINLink, error) {
+	if ttl <= 0 {
+		return PINLink{}, fmt.Errorf("%w: expiry must be positive", ErrValidation)
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return PINLink{}, err
+	}
+	link := PINLink{
+		EmployeeID: employeeID,
+		Token:      base64.RawURLEncoding.EncodeToString(buf),
+		ExpiresAt:  time.Now().UTC().Add(ttl).Truncate(time.Second),
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO pin_links (token_hash, employee_id, created_by, expires_at) VALUES ($1, $2, $3, $4)
+	`, hashPINLinkToken(link.Token), employeeID, createdBy, link.ExpiresAt)
+	if isForeignKeyViolation(err) {
+		return PINLink{}, fmt.Errorf("%w: employee %s", ErrNotFound, employeeID)
+	}
+	if err != nil {
+		return PINLink{}, storageErr(err)
+	}
+	return link, nil
+}
+
+// RedeemPINLink sets the PIN of the link's employee and uses the link up. An
+// unknown, used or expired token gets ErrNotFound. It returns the employee id.
+func (r *Repository) RedeemPINLink(ctx context.Context, token, pin string) (string, error) {
+	if err := ValidatePIN(pin); err != nil {
+		return "", err
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", storageErr(err)
+	}
+	defer tx.Rollback()
+	var employeeID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE pin_links SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING employee_id
+	`, hashPINLinkToken(token)).Scan(&employeeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: PIN link is unknown, used or expired", ErrNotFound)
+	}
+	if err != nil {
+		return "", storageErr(err)
+	}
+	if err := setPIN(ctx, tx, employeeID, pin); err != nil {
+		return "", err
+	}
+	return employeeID, storageErr(tx.Commit())
+}
+
+// CheckInWithPIN records a photo-less check-in after verifying the user's
+// PIN. The event is stored processed, without a match score, and is not
+// queued for the worker.
+func (s *Service) CheckInWithPIN(ctx context.Context, userID, deviceID, location, pin string, clientTime time.Time) (Event, error) {
+	if userID == "" || deviceID == "" {
+		err := fmt.Errorf("%w: user and device required", ErrValidation)
+		s.countCheckin(err)
+		return Event{}, err
+	}
+	if err := s.repo.VerifyPIN(ctx, userID, pin, s.PINLockAfter); err != nil {
+		s.countCheckin(err)
+		return Event{}, err
+	}
+	evt := Event{UserID: userID, DeviceID: deviceID, Location: location, Status: StatusProcessed, AuthMethod: AuthMethodPIN}
+	return s.checkIn(ctx, evt, clientTime, time.Now())
+}
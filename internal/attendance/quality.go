@@ -0,0 +1,34 @@
+package attendance
+
+import "attendance/internal/faceclient"
+
+// QualityThresholds decide when a check-in image is too poor to trust.
+type QualityThresholds struct {
+	MaxBlur        float64
+	MinFaceSize    int
+	RequireFrontal bool
+}
+
+// QualityIssue is a failed quality rule with a hint the kiosk can show.
+type QualityIssue struct {
+	Code string `json:"code"`
+	Hint string `json:"hint"`
+}
+
+// Evaluate returns the rules q fails; nil quality passes since there is nothing to judge.
+func (t QualityThresholds) Evaluate(q *faceclient.FaceQuality) []QualityIssue {
+	if q == nil {
+		return nil
+	}
+	var issues []QualityIssue
+	if t.MaxBlur > 0 && q.Blur > t.MaxBlur {
+		issues = append(issues, QualityIssue{Code: "blurry", Hint: "hold still and make sure the camera is in focus"})
+	}
+	if t.MinFaceSize > 0 && q.FaceSize < t.MinFaceSize {
+		issues = append(issues, QualityIssue{Code: "too_small", Hint: "move closer to the camera"})
+	}
+	if t.RequireFrontal && !q.IsFrontal {
+		issues = append(issues, QualityIssue{Code: "not_frontal", Hint: "look straight at the camera"})
+	}
+	return issues
+}
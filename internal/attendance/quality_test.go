@@ -0,0 +1,46 @@
+package attendance
+
+import (
+	"slices"
+	"testing"
+
+	"attendance/internal/faceclient"
+)
+
+func TestQualityThresholdsEvaluate(t *testing.T) {
+	strict := QualityThresholds{MaxBlur: 0.5, MinFaceSize: 80, RequireFrontal: true}
+	good := faceclient.FaceQuality{Blur: 0.1, FaceSize: 120, IsFrontal: true}
+	with := func(f func(q *faceclient.FaceQuality)) *faceclient.FaceQuality {
+		q := good
+		f(&q)
+		return &q
+	}
+	tests := []struct {
+		name       string
+		thresholds QualityThresholds
+		quality    *faceclient.FaceQuality
+		want       []string
+	}{
+		{"nothing reported", strict, nil, nil},
+		{"good", strict, &good, nil},
+		{"blurry", strict, with(func(q *faceclient.FaceQuality) { q.Blur = 0.51 }), []string{"blurry"}},
+		{"blur at the limit", strict, with(func(q *faceclient.FaceQuality) { q.Blur = 0.5 }), nil},
+		{"too small", strict, with(func(q *faceclient.FaceQuality) { q.FaceSize = 79 }), []string{"too_small"}},
+		{"size at the limit", strict, with(func(q *faceclient.FaceQuality) { q.FaceSize = 80 }), nil},
+		{"not frontal", strict, with(func(q *faceclient.FaceQuality) { q.IsFrontal = false }), []string{"not_frontal"}},
+		{"everything wrong", strict, &faceclient.FaceQuality{Blur: 0.9, FaceSize: 10}, []string{"blurry", "too_small", "not_frontal"}},
+		{"no thresholds", QualityThresholds{}, &faceclient.FaceQuality{Blur: 0.9, FaceSize: 10}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, issue := range tt.thresholds.Evaluate(tt.quality) {
+			if issue.Hint == "" {
+				t.Errorf("%s: issue %s has no hint", tt.name, issue.Code)
+			}
+			got = append(got, issue.Code)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Evaluate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,62 +3,218 @@ package attendance
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"attendance/internal/faceclient"
 )
 
 // Repository persists attendance data in Postgres.
 type Repository struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewRepository creates a repo. Every call is bounded by queryTimeout;
+// a non-positive value defaults to 3s.
+func NewRepository(db *sql.DB, queryTimeout time.Duration) *Repository {
+	if queryTimeout <= 0 {
+		queryTimeout = 3 * time.Second
+	}
+	return &Repository{db: db, queryTimeout: queryTimeout}
 }
 
-// NewRepository creates a repo.
-func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// eventColumns is the column list scanEvent expects, in order.
+const eventColumns = `id, user_id, device_id, occurred_at, location, image_url, status, match_score, created_at, quality, late_minutes, auth_method, face_model, model_mismatch, client_id, image_urls, image_scores, unknown_user, failure_reason`
+
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-// UpsertDevice ensures a device record exists.
-func (r *Repository) UpsertDevice(ctx context.Context, deviceID string) error {
+// scanEvent reads a row selected with eventColumns.
+func scanEvent(row scanner) (Event, error) {
+	var evt Event
+	var quality, scores []byte
+	if err := row.Scan(&evt.ID, &evt.UserID, &evt.DeviceID, &evt.When, &evt.Location, &evt.ImageURL, &evt.Status, &evt.MatchScore, &evt.CreatedAt, &quality, &evt.LateMinutes, &evt.AuthMethod, &evt.FaceModel, &evt.ModelMismatch, &evt.ClientID, textArray(&evt.ImageURLs), &scores, &evt.UnknownUser, &evt.FailureReason); err != nil {
+		return Event{}, err
+	}
+	if len(quality) > 0 {
+		evt.Quality = &faceclient.FaceQuality{}
+		if err := json.Unmarshal(quality, evt.Quality); err != nil {
+			return Event{}, fmt.Errorf("decode quality for event %s: %w", evt.ID, err)
+		}
+	}
+	if len(scores) > 0 {
+		evt.ImageScores = &ImageScores{}
+		if err := json.Unmarshal(scores, evt.ImageScores); err != nil {
+			return Event{}, fmt.Errorf("decode image scores for event %s: %w", evt.ID, err)
+		}
+	}
+	return evt, nil
+}
+
+// withTimeout derives a context bounded by the repository query timeout.
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+// IsTimeout reports whether err was caused by a query or connection timeout,
+// so callers can answer 503 instead of 500.
+func IsTimeout(err error) bool {
+	return err != nil && (errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err))
+}
+
+// IsUnavailable reports whether err means Postgres could not be reached or
+// did not answer in time: a connection error or a timeout. A cancelled
+// context is the caller giving up, not the database failing, and is not.
+func IsUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	return IsTimeout(err) || errors.As(err, &connErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RegisterDevice creates a device record, or reactivates a deactivated one
+// an admin allowed to be reprovisioned; reprovisioned reports the latter. An
+// active device is ErrDuplicate and a deactivated one not allowed back is
+// ErrDeviceDisabled.
+func (r *Repository) RegisterDevice(ctx context.Context, deviceID, name string) (reprovisioned bool, err error) {
 	if deviceID == "" {
-		return errors.New("device id required")
+		return false, fmt.Errorf("%w: device id required", ErrValidation)
 	}
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO devices (device_id)
-		VALUES ($1)
-		ON CONFLICT (device_id) DO NOTHING
-	`, deviceID)
-	return err
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	defer tx.Rollback()
+	if reprovisioned, err = claimDevice(ctx, tx, deviceID, name, "", ""); err != nil {
+		return false, err
+	}
+	return reprovisioned, storageErr(tx.Commit())
+}
+
+// claimDevice inserts or reactivates deviceID inside tx as RegisterDevice
+// describes, recording the enrollment code and batch when given.
+func claimDevice(ctx context.Context, tx *sql.Tx, deviceID, name, codeID, batchID string) (bool, error) {
+	var disabled, allowed bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT disabled_at IS NOT NULL, reprovision_allowed FROM devices WHERE device_id = $1 FOR UPDATE
+	`, deviceID).Scan(&disabled, &allowed)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO devices (device_id, name, enrollment_code_id, enrollment_batch_id)
+			VALUES ($1, NULLIF($2, ''), NULLIF($3, '')::uuid, NULLIF($4, '')::uuid)
+			ON CONFLICT (device_id) DO NOTHING
+		`, deviceID, name, codeID, batchID)
+		if err != nil {
+			return false, storageErr(err)
+		}
+		// A concurrent registration of the same id won.
+		return false, requireRow(res, fmt.Errorf("%w: device %s is already registered", ErrDuplicate, deviceID))
+	case err != nil:
+		return false, storageErr(err)
+	case !disabled:
+		return false, fmt.Errorf("%w: device %s is already registered", ErrDuplicate, deviceID)
+	case !allowed:
+		return false, fmt.Errorf("%w: device %s was deactivated; an admin must allow reprovisioning", ErrDeviceDisabled, deviceID)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE devices SET
+			disabled_at = NULL, disabled_by = NULL, reprovision_allowed = FALSE,
+			name = COALESCE(NULLIF($2, ''), name),
+			enrollment_code_id = COALESCE(NULLIF($3, '')::uuid, enrollment_code_id),
+			enrollment_batch_id = COALESCE(NULLIF($4, '')::uuid, enrollment_batch_id)
+		WHERE device_id = $1
+	`, deviceID, name, codeID, batchID)
+	return true, storageErr(err)
 }
 
 // SaveRefreshToken stores a refresh token for rotation checks.
 func (r *Repository) SaveRefreshToken(ctx context.Context, deviceID, token string, expiresAt time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	_, err := r.db.ExecContext(ctx, `
 		INSERT INTO refresh_tokens (device_id, token, expires_at)
 		VALUES ($1, $2, $3)
 	`, deviceID, token, expiresAt)
-	return err
+	return storageErr(err)
 }
 
 // RevokeRefreshToken marks a token revoked.
 func (r *Repository) RevokeRefreshToken(ctx context.Context, token string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	_, err := r.db.ExecContext(ctx, `UPDATE refresh_tokens SET revoked = TRUE WHERE token = $1`, token)
 	return err
 }
 
-// RecentEvent returns a recent event within the provided window.
+// RotateRefreshToken revokes oldToken and stores newToken in its place, in
+// one transaction. oldToken must belong to deviceID and be live; otherwise
+// nothing changes and ErrTokenRevoked is returned. Concurrent rotations of
+// the same token serialize on its row, so only one of them succeeds.
+func (r *Repository) RotateRefreshToken(ctx context.Context, deviceID, oldToken, newToken string, expiresAt time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return storageErr(err)
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked = TRUE
+		WHERE token = $1 AND device_id = $2 AND NOT revoked AND expires_at > NOW()
+	`, oldToken, deviceID)
+	if err != nil {
+		return storageErr(err)
+	}
+	if err := requireRow(res, ErrTokenRevoked); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (device_id, token, expires_at)
+		VALUES ($1, $2, $3)
+	`, deviceID, newToken, expiresAt); err != nil {
+		return storageErr(err)
+	}
+	return storageErr(tx.Commit())
+}
+
+// RecentEvent returns a recent event within the provided window. An empty
+// deviceID matches the user's events on any device.
 func (r *Repository) RecentEvent(ctx context.Context, userID, deviceID string, window time.Duration) (*Event, error) {
-	row := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, device_id, occurred_at, location, image_url, status, match_score, created_at
-		FROM attendance_events
-		WHERE user_id = $1 AND device_id = $2 AND occurred_at >= NOW() - ($3 * interval '1 second')
-		ORDER BY occurred_at DESC
-		LIMIT 1
-	`, userID, deviceID, window.Seconds())
-	var evt Event
-	if err := row.Scan(&evt.ID, &evt.UserID, &evt.DeviceID, &evt.When, &evt.Location, &evt.ImageURL, &evt.Status, &evt.MatchScore, &evt.CreatedAt); err != nil {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return scanRecentEvent(r.db.QueryRowContext(ctx, recentEventQuery, userID, deviceID, window.Seconds(), time.Now()))
+}
+
+// recentEventQuery selects a user's latest event within $3 seconds either
+// side of $4, on device $2 or on any device when $2 is empty.
+const recentEventQuery = `
+	SELECT ` + eventColumns + `
+	FROM attendance_events
+	WHERE user_id = $1 AND ($2 = '' OR device_id = $2)
+		AND occurred_at BETWEEN $4::timestamptz - ($3 * interval '1 second') AND $4::timestamptz + ($3 * interval '1 second')
+	ORDER BY occurred_at DESC
+	LIMIT 1
+`
+
+func scanRecentEvent(row scanner) (*Event, error) {
+	evt, err := scanEvent(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -67,8 +223,29 @@ func (r *Repository) RecentEvent(ctx context.Context, userID, deviceID string, w
 	return &evt, nil
 }
 
-// InsertEvent writes a new event.
+// InsertEvent writes a new event. A pending event is written together with
+// its check-in outbox message, so the worker hears about it even if the
+// caller's own publish never happens.
 func (r *Repository) InsertEvent(ctx context.Context, evt Event) (Event, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Event{}, err
+	}
+	defer tx.Rollback()
+	if evt, err = insertEvent(ctx, tx, evt); err != nil {
+		return Event{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Event{}, err
+	}
+	return evt, nil
+}
+
+// insertEvent writes evt, and the check-in outbox message when it is
+// pending, inside tx.
+func insertEvent(ctx context.Context, tx *sql.Tx, evt Event) (Event, error) {
 	if evt.ID == "" {
 		evt.ID = uuid.NewString()
 	}
@@ -76,81 +253,372 @@ func (r *Repository) InsertEvent(ctx context.Context, evt Event) (Event, error)
 		evt.When = time.Now().UTC()
 	}
 	if evt.Status == "" {
-		evt.Status = "pending"
+		evt.Status = StatusPending
 	}
-	row := r.db.QueryRowContext(ctx, `
-		INSERT INTO attendance_events (id, user_id, device_id, occurred_at, location, image_url, status, match_score)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	if evt.AuthMethod == "" {
+		evt.AuthMethod = AuthMethodFace
+	}
+	row := tx.QueryRowContext(ctx, `
+		INSERT INTO attendance_events (id, user_id, device_id, occurred_at, location, image_url, status, match_score, auth_method, client_id, image_urls, unknown_user)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 		RETURNING created_at
-	`, evt.ID, evt.UserID, evt.DeviceID, evt.When, evt.Location, evt.ImageURL, evt.Status, evt.MatchScore)
+	`, evt.ID, evt.UserID, evt.DeviceID, evt.When, evt.Location, evt.ImageURL, evt.Status, evt.MatchScore, evt.AuthMethod, evt.ClientID, evt.ImageURLs, evt.UnknownUser)
 	if err := row.Scan(&evt.CreatedAt); err != nil {
 		return Event{}, err
 	}
+	if evt.Status == StatusPending {
+		if err := insertOutbox(ctx, tx, checkinOutbox(evt.ID)); err != nil {
+			return Event{}, err
+		}
+	}
 	return evt, nil
 }
 
+// CheckInTx writes evt unless the user already has an event within window of
+// evt.When, checking and inserting in one transaction. A transaction-scoped advisory
+// lock on the user (and on dedupDevice, when set) serializes concurrent
+// check-ins, so of several simultaneous requests exactly one inserts and the
+// rest see its event. An empty dedupDevice deduplicates across devices. When
+// an earlier event is found it is returned as recent and nothing is written.
+func (r *Repository) CheckInTx(ctx context.Context, evt Event, dedupDevice string, window time.Duration) (inserted Event, recent *Event, err error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Event{}, nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`,
+		"checkin:"+evt.UserID+"/"+dedupDevice); err != nil {
+		return Event{}, nil, err
+	}
+	if window > 0 {
+		when := evt.When
+		if when.IsZero() {
+			when = time.Now()
+		}
+		recent, err = scanRecentEvent(tx.QueryRowContext(ctx, recentEventQuery, evt.UserID, dedupDevice, window.Seconds(), when))
+		if err != nil || recent != nil {
+			return Event{}, recent, err
+		}
+	}
+	if inserted, err = insertEvent(ctx, tx, evt); err != nil {
+		return Event{}, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Event{}, nil, err
+	}
+	return inserted, nil, nil
+}
+
 // GetEvent returns a single event by id.
 func (r *Repository) GetEvent(ctx context.Context, id string) (Event, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	scope, scopeArg := scopeFilter(ctx, "user_id", 2)
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, device_id, occurred_at, location, image_url, status, match_score, created_at
-		FROM attendance_events WHERE id = $1
-	`, id)
-	var evt Event
-	if err := row.Scan(&evt.ID, &evt.UserID, &evt.DeviceID, &evt.When, &evt.Location, &evt.ImageURL, &evt.Status, &evt.MatchScore, &evt.CreatedAt); err != nil {
-		return Event{}, err
+		SELECT `+eventColumns+`
+		FROM attendance_events WHERE id = $1 AND `+scope, id, scopeArg)
+	evt, err := scanEvent(row)
+	return evt, storageErr(err)
+}
+
+// GetEventsByIDs returns the events with the given ids, in the order of ids.
+// A non-empty deviceID restricts them to that device's events. Ids without a
+// matching event are left out.
+func (r *Repository) GetEventsByIDs(ctx context.Context, ids []string, deviceID string) ([]Event, error) {
+	if len(ids) == 0 {
+		return nil, nil
 	}
-	return evt, nil
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	scope, scopeArg := scopeFilter(ctx, "user_id", 3)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+eventColumns+`
+		FROM attendance_events
+		WHERE id = ANY($1::text[]::uuid[]) AND ($2 = '' OR device_id = $2) AND `+scope+`
+		ORDER BY array_position($1::text[], id::text)
+	`, ids, deviceID, scopeArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		evt, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, rows.Err()
 }
 
-// UpdateEventStatus updates status and score after processing.
-func (r *Repository) UpdateEventStatus(ctx context.Context, id, status string, score *float64) error {
-	_, err := r.db.ExecContext(ctx, `
+// UpdateEventStatus moves a pending event to a terminal status and records the
+// score and failure reason, if any. It returns ErrInvalidTransition when the
+// event is no longer pending, so a delayed duplicate message cannot overwrite
+// an earlier outcome. The change is recorded in the event's status history as
+// made by the worker.
+func (r *Repository) UpdateEventStatus(ctx context.Context, id, status string, score *float64, reason string) error {
+	if !CanTransition(StatusPending, status) {
+		return fmt.Errorf("%w: pending -> %s", ErrInvalidTransition, status)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
 		UPDATE attendance_events
-		SET status = $2, match_score = COALESCE($3, match_score)
-		WHERE id = $1
-	`, id, status, score)
+		SET status = $2, match_score = COALESCE($3, match_score), failure_reason = NULLIF($4, '')
+		WHERE id = $1 AND status = 'pending'
+	`, id, status, score, reason)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res, fmt.Errorf("%w: event %s is not pending", ErrInvalidTransition, id)); err != nil {
+		return err
+	}
+	if err := recordStatusChange(ctx, tx, id, StatusPending, status, ActorWorker); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetEventQuality stores the face quality metrics reported for an event's image.
+func (r *Repository) SetEventQuality(ctx context.Context, id string, quality *faceclient.FaceQuality) error {
+	if quality == nil {
+		return nil
+	}
+	data, err := json.Marshal(quality)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err = r.db.ExecContext(ctx, `UPDATE attendance_events SET quality = $2 WHERE id = $1`, id, data)
 	return err
 }
 
+// ResetEventStatus sends a finished event back to pending for an explicit
+// admin reprocess, queueing it through the outbox and recording actor in the
+// status history. It returns ErrInvalidTransition if the event is already
+// pending or missing.
+func (r *Repository) ResetEventStatus(ctx context.Context, id, actor string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var old string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE attendance_events e
+		SET status = 'pending', failure_reason = NULL
+		FROM (SELECT id, status FROM attendance_events WHERE id = $1 FOR UPDATE) prev
+		WHERE e.id = prev.id AND prev.status NOT IN ('pending', 'awaiting_approval')
+		RETURNING prev.status
+	`, id).Scan(&old)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: event %s is pending, awaiting approval or does not exist", ErrInvalidTransition, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := recordStatusChange(ctx, tx, id, old, StatusPending, actor); err != nil {
+		return err
+	}
+	if err := insertOutbox(ctx, tx, checkinOutbox(id)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EventPatch holds the fields a device may change on its pending check-in;
+// nil leaves a field as it is.
+type EventPatch struct {
+	ImageURL *string
+	Location *string
+}
+
+// UpdateEventImage applies p to a pending event submitted by deviceID. An
+// event of another device is reported as ErrNotFound and one that is no
+// longer pending as ErrInvalidTransition. When the patch gives a previously
+// image-less event its image, the event is queued through the outbox and
+// queued is true.
+func (r *Repository) UpdateEventImage(ctx context.Context, id, deviceID string, p EventPatch) (evt Event, queued bool, err error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Event{}, false, storageErr(err)
+	}
+	defer tx.Rollback()
+
+	var owner, status, prevImage string
+	err = tx.QueryRowContext(ctx, `
+		SELECT device_id, status, COALESCE(image_url, '')
+		FROM attendance_events WHERE id = $1
+	`, id).Scan(&owner, &status, &prevImage)
+	if err != nil || owner != deviceID {
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			return Event{}, false, fmt.Errorf("%w: event %s", ErrNotFound, id)
+		}
+		return Event{}, false, storageErr(err)
+	}
+	if status != StatusPending {
+		return Event{}, false, fmt.Errorf("%w: event %s is already %s", ErrInvalidTransition, id, status)
+	}
+
+	// The status check is repeated here in case the worker finished the event
+	// since it was read.
+	evt, err = scanEvent(tx.QueryRowContext(ctx, `
+		UPDATE attendance_events
+		SET image_url = COALESCE($2, image_url), location = COALESCE($3, location),
+			image_urls = CASE WHEN $2 IS NULL THEN image_urls END
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+eventColumns, id, p.ImageURL, p.Location))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Event{}, false, fmt.Errorf("%w: event %s is no longer pending", ErrInvalidTransition, id)
+	}
+	if err != nil {
+		return Event{}, false, storageErr(err)
+	}
+	if prevImage == "" && evt.ImageURL != "" {
+		if err := insertOutbox(ctx, tx, checkinOutbox(id)); err != nil {
+			return Event{}, false, storageErr(err)
+		}
+		queued = true
+	}
+	if err := tx.Commit(); err != nil {
+		return Event{}, false, storageErr(err)
+	}
+	return evt, queued, nil
+}
+
+// requireRow returns errNone when the statement affected no rows.
+func requireRow(res sql.Result, errNone error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNone
+	}
+	return nil
+}
+
+// EventsFingerprint summarises the events matching the filters: how many
+// there are and when one was last inserted or updated. It changes whenever
+// a list over the same filters could, and costs far less than the list.
+func (r *Repository) EventsFingerprint(ctx context.Context, deviceID, userID string) (int64, time.Time, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var (
+		count int64
+		last  sql.NullTime
+	)
+	scope, scopeArg := scopeFilter(ctx, "user_id", 3)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), MAX(GREATEST(created_at, updated_at))
+		FROM attendance_events
+		WHERE ($1 = '' OR device_id = $1) AND ($2 = '' OR user_id = $2) AND `+scope,
+		deviceID, userID, scopeArg).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, storageErr(err)
+	}
+	return count, last.Time, nil
+}
+
 // ListEvents returns events with basic filters.
 func (r *Repository) ListEvents(ctx context.Context, deviceID, userID string, limit, offset int) ([]Event, error) {
+	expanded, err := r.ListEventsExpanded(ctx, deviceID, userID, limit, offset, Expand{})
+	if err != nil {
+		return nil, err
+	}
+	var res []Event
+	for _, e := range expanded {
+		res = append(res, e.Event)
+	}
+	return res, nil
+}
+
+// ListEventsExpanded is ListEvents with the related employee and device
+// joined in as requested by expand, in the same single query.
+func (r *Repository) ListEventsExpanded(ctx context.Context, deviceID, userID string, limit, offset int, expand Expand) ([]ExpandedEvent, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	if limit <= 0 {
 		limit = 50
 	}
 	if offset < 0 {
 		offset = 0
 	}
-	query := `SELECT id, user_id, device_id, occurred_at, location, image_url, status, match_score, created_at FROM attendance_events`
+	query := `SELECT ` + qualifiedEventColumns("e")
+	if expand.User {
+		query += `, emp.name, dept.name, emp.photo_url`
+	}
+	if expand.Device {
+		query += `, d.name`
+	}
+	query += ` FROM attendance_events e`
+	if expand.User {
+		query += ` LEFT JOIN employees emp ON emp.employee_id = e.user_id LEFT JOIN departments dept ON dept.id = emp.department_id`
+	}
+	if expand.Device {
+		query += ` LEFT JOIN devices d ON d.device_id = e.device_id`
+	}
 	args := []any{}
 	clauses := []string{}
 	if deviceID != "" {
-		clauses = append(clauses, "device_id = $"+itoa(len(args)+1))
+		clauses = append(clauses, "e.device_id = $"+itoa(len(args)+1))
 		args = append(args, deviceID)
 	}
 	if userID != "" {
-		clauses = append(clauses, "user_id = $"+itoa(len(args)+1))
+		clauses = append(clauses, "e.user_id = $"+itoa(len(args)+1))
 		args = append(args, userID)
 	}
+	if _, ok := DepartmentScope(ctx); ok {
+		scope, scopeArg := scopeFilter(ctx, "e.user_id", len(args)+1)
+		clauses = append(clauses, scope)
+		args = append(args, scopeArg)
+	}
 	if len(clauses) > 0 {
 		query += " WHERE " + joinClauses(clauses, " AND ")
 	}
-	query += " ORDER BY occurred_at DESC LIMIT $" + itoa(len(args)+1) + " OFFSET $" + itoa(len(args)+2)
+	// The id breaks ties between events at the same instant, or pages could
+	// repeat some of them and skip others.
+	query += " ORDER BY e.occurred_at DESC, e.id DESC LIMIT $" + itoa(len(args)+1) + " OFFSET $" + itoa(len(args)+2)
 	args = append(args, limit, offset)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, storageErr(err)
 	}
 	defer rows.Close()
-	var res []Event
+	var res []ExpandedEvent
 	for rows.Next() {
-		var evt Event
-		if err := rows.Scan(&evt.ID, &evt.UserID, &evt.DeviceID, &evt.When, &evt.Location, &evt.ImageURL, &evt.Status, &evt.MatchScore, &evt.CreatedAt); err != nil {
+		var ee ExpandedEvent
+		var extra []any
+		if expand.User {
+			ee.User = &EventUser{}
+			extra = append(extra, &ee.User.Name, &ee.User.Department, &ee.User.PhotoURL)
+		}
+		if expand.Device {
+			ee.Device = &EventDevice{}
+			extra = append(extra, &ee.Device.Name)
+		}
+		evt, err := scanEvent(extraScanner{rows, extra})
+		if err != nil {
 			return nil, err
 		}
-		res = append(res, evt)
+		ee.Event = evt
+		res = append(res, ee)
 	}
-	return res, rows.Err()
+	return res, storageErr(rows.Err())
 }
 
 func itoa(i int) string { return fmt.Sprintf("%d", i) }
@@ -172,65 +640,107 @@ type Employee struct {
 	EmployeeID   string     `json:"employee_id"`
 	Name         *string    `json:"name,omitempty"`
 	Email        *string    `json:"email,omitempty"`
+	DepartmentID *int64     `json:"department_id,omitempty"`
 	Department   *string    `json:"department,omitempty"`
 	FaceEnrolled bool       `json:"face_enrolled"`
 	EnrolledAt   *time.Time `json:"enrolled_at,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
+	PhotoURL     *string    `json:"photo_url,omitempty"`
+	// FaceModel is the face-service model the face was enrolled with.
+	FaceModel *string   `json:"face_model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// employeeColumns is the column list scanEmployee expects, read from
+// employees e joined with departments dept.
+const employeeColumns = `e.id, e.employee_id, e.name, e.email, e.department_id, dept.name, e.face_enrolled, e.enrolled_at, e.photo_url, e.face_model, e.created_at`
+
+func scanEmployee(row scanner) (Employee, error) {
+	var e Employee
+	err := row.Scan(&e.ID, &e.EmployeeID, &e.Name, &e.Email, &e.DepartmentID, &e.Department, &e.FaceEnrolled, &e.EnrolledAt, &e.PhotoURL, &e.FaceModel, &e.CreatedAt)
+	return e, err
 }
 
-// ListEmployees returns all employees.
+// employeesInScope limits employees e to the department scope of ctx, with
+// its argument read from $1.
+const employeesInScope = `($1::bigint[] IS NULL OR e.department_id = ANY($1::bigint[]))`
+
+func employeeScopeArg(ctx context.Context) any {
+	if ids, ok := DepartmentScope(ctx); ok {
+		return ids
+	}
+	return nil
+}
+
+// ListEmployees returns all employees in the department scope of ctx.
 func (r *Repository) ListEmployees(ctx context.Context) ([]Employee, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, employee_id, name, email, department, face_enrolled, enrolled_at, created_at
-		FROM employees
-		ORDER BY employee_id
-	`)
+		SELECT `+employeeColumns+`
+		FROM employees e LEFT JOIN departments dept ON dept.id = e.department_id
+		WHERE `+employeesInScope+`
+		ORDER BY e.employee_id
+	`, employeeScopeArg(ctx))
 	if err != nil {
-		return nil, err
+		return nil, storageErr(err)
 	}
 	defer rows.Close()
 
 	var employees []Employee
 	for rows.Next() {
-		var e Employee
-		if err := rows.Scan(&e.ID, &e.EmployeeID, &e.Name, &e.Email, &e.Department, &e.FaceEnrolled, &e.EnrolledAt, &e.CreatedAt); err != nil {
+		e, err := scanEmployee(rows)
+		if err != nil {
 			return nil, err
 		}
 		employees = append(employees, e)
 	}
-	return employees, rows.Err()
+	return employees, storageErr(rows.Err())
 }
 
-// GetEmployee returns a single employee by employee_id.
+// GetEmployee returns a single employee by employee_id, or nil when there is
+// none in the department scope of ctx.
 func (r *Repository) GetEmployee(ctx context.Context, employeeID string) (*Employee, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	row := r.db.QueryRowContext(ctx, `
-		SELECT id, employee_id, name, email, department, face_enrolled, enrolled_at, created_at
-		FROM employees WHERE employee_id = $1
-	`, employeeID)
-	var e Employee
-	if err := row.Scan(&e.ID, &e.EmployeeID, &e.Name, &e.Email, &e.Department, &e.FaceEnrolled, &e.EnrolledAt, &e.CreatedAt); err != nil {
+		SELECT `+employeeColumns+`
+		FROM employees e LEFT JOIN departments dept ON dept.id = e.department_id
+		WHERE `+employeesInScope+` AND e.employee_id = $2
+	`, employeeScopeArg(ctx), employeeID)
+	e, err := scanEmployee(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
-		return nil, err
+		return nil, storageErr(err)
 	}
 	return &e, nil
 }
 
-// UpsertEmployee creates or updates an employee.
+// UpsertEmployee creates or updates an employee. Events already stored for
+// the id lose their unknown_user flag.
 func (r *Repository) UpsertEmployee(ctx context.Context, employeeID string, name *string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO employees (employee_id, name)
-		VALUES ($1, $2)
-		ON CONFLICT (employee_id) DO UPDATE SET
-			name = COALESCE(EXCLUDED.name, employees.name),
-			updated_at = NOW()
+		WITH emp AS (
+			INSERT INTO employees (employee_id, name)
+			VALUES ($1, $2)
+			ON CONFLICT (employee_id) DO UPDATE SET
+				name = COALESCE(EXCLUDED.name, employees.name),
+				updated_at = NOW()
+			RETURNING employee_id
+		)
+		UPDATE attendance_events SET unknown_user = FALSE
+		WHERE unknown_user AND user_id IN (SELECT employee_id FROM emp)
 	`, employeeID, name)
 	return err
 }
 
 // SetEmployeeFaceEnrolled marks an employee as face-enrolled.
 func (r *Repository) SetEmployeeFaceEnrolled(ctx context.Context, employeeID string, enrolled bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var enrolledAt interface{} = nil
 	if enrolled {
 		enrolledAt = time.Now().UTC()
@@ -242,3 +752,50 @@ func (r *Repository) SetEmployeeFaceEnrolled(ctx context.Context, employeeID str
 	`, employeeID, enrolled, enrolledAt)
 	return err
 }
+
+// SetEmployeePhotoURL records the image an employee was enrolled with.
+func (r *Repository) SetEmployeePhotoURL(ctx context.Context, employeeID, photoURL string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE employees SET photo_url = $2, updated_at = NOW() WHERE employee_id = $1
+	`, employeeID, photoURL)
+	return err
+}
+
+// ListStaleEvents claims up to limit events in status created more than
+// olderThan ago and not requeued within olderThan, oldest first, and returns
+// their ids. Claimed rows are stamped with requeued_at in the same statement
+// and locked rows are skipped, so concurrent callers get disjoint ids. Events
+// without an image are left alone; they wait for the device to attach one.
+func (r *Repository) ListStaleEvents(ctx context.Context, status string, olderThan time.Duration, limit int) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE attendance_events SET requeued_at = NOW()
+		WHERE id IN (
+			SELECT id FROM attendance_events
+			WHERE status = $1
+			  AND image_url <> ''
+			  AND created_at < NOW() - make_interval(secs => $2)
+			  AND (requeued_at IS NULL OR requeued_at < NOW() - make_interval(secs => $2))
+			ORDER BY created_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, status, olderThan.Seconds(), limit)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, storageErr(rows.Err())
+}
@@ -0,0 +1,105 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DailyAttendance is one user's processed check-ins over a day.
+type DailyAttendance struct {
+	UserID       string    `json:"user_id"`
+	FirstCheckIn time.Time `json:"first_check_in"`
+	LastCheckIn  time.Time `json:"last_check_in"`
+	CheckIns     int       `json:"check_ins"`
+	Shift        *string   `json:"shift,omitempty"`
+	// LateMinutes is the lateness of the first check-in that fell inside the shift.
+	LateMinutes *int `json:"late_minutes"`
+	// EarlyDepartureMinutes is how long before the shift end the last
+	// check-in was; only set when there are at least two check-ins.
+	EarlyDepartureMinutes *int `json:"early_departure_minutes"`
+	// UnknownUser is set when the user's check-ins were flagged as made by
+	// a user who is not an employee.
+	UnknownUser bool `json:"unknown_user"`
+}
+
+// DayBounds returns the start of the calendar day containing t in loc and the
+// start of the next one. A day across a DST change is 23 or 25 hours long.
+func DayBounds(t time.Time, loc *time.Location) (from, to time.Time) {
+	t = t.In(loc)
+	from = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	return from, from.AddDate(0, 0, 1)
+}
+
+// ParseDay parses a YYYY-MM-DD date as a calendar day in loc.
+func ParseDay(s string, loc *time.Location) (from, to time.Time, err error) {
+	day, err := time.ParseInLocation(time.DateOnly, s, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrValidation)
+	}
+	from, to = DayBounds(day, loc)
+	return from, to, nil
+}
+
+// LoadZone resolves an IANA zone name from a request; empty yields fallback.
+func LoadZone(name string, fallback *time.Location) (*time.Location, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrValidation, name)
+	}
+	return loc, nil
+}
+
+// DailyReport returns per-user attendance for processed events in [from, to).
+func (r *Repository) DailyReport(ctx context.Context, from, to time.Time) ([]DailyAttendance, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	scope, scopeArg := scopeFilter(ctx, "user_id", 3)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, MIN(occurred_at), MAX(occurred_at), COUNT(*),
+		       (ARRAY_AGG(late_minutes ORDER BY occurred_at) FILTER (WHERE late_minutes IS NOT NULL))[1],
+		       BOOL_OR(unknown_user)
+		FROM attendance_events
+		WHERE status = 'processed' AND occurred_at >= $1 AND occurred_at < $2 AND `+scope+`
+		GROUP BY user_id
+		ORDER BY user_id
+	`, from, to, scopeArg)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	report := []DailyAttendance{}
+	for rows.Next() {
+		var d DailyAttendance
+		if err := rows.Scan(&d.UserID, &d.FirstCheckIn, &d.LastCheckIn, &d.CheckIns, &d.LateMinutes, &d.UnknownUser); err != nil {
+			return nil, err
+		}
+		report = append(report, d)
+	}
+	return report, storageErr(rows.Err())
+}
+
+// Annotate fills in each row's shift name and early departure.
+func (c *ShiftCache) Annotate(ctx context.Context, report []DailyAttendance) error {
+	for i := range report {
+		d := &report[i]
+		shift, ok, err := c.ForUser(ctx, d.UserID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		d.Shift = &shift.Name
+		if d.CheckIns < 2 {
+			continue
+		}
+		if early, ok := shift.EarlyDeparture(d.LastCheckIn); ok && early > 0 {
+			d.EarlyDepartureMinutes = &early
+		}
+	}
+	return nil
+}
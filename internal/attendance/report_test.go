@@ -0,0 +1,184 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func mustZone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// A report day is the calendar day of the report's zone: 00:30 in India is
+// still the previous day in UTC, and days across a DST change are 23 or 25
+// hours long.
+func TestDayBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		at       string
+		zone     string
+		from, to string
+	}{
+		{"UTC", "2024-03-14T19:00:00Z", "UTC", "2024-03-14T00:00:00Z", "2024-03-15T00:00:00Z"},
+		{"just after midnight in India", "2024-03-14T19:00:00Z", "Asia/Kolkata", "2024-03-14T18:30:00Z", "2024-03-15T18:30:00Z"},
+		{"just before midnight in India", "2024-03-14T18:00:00Z", "Asia/Kolkata", "2024-03-13T18:30:00Z", "2024-03-14T18:30:00Z"},
+		{"DST starts in New York", "2024-03-10T12:00:00Z", "America/New_York", "2024-03-10T05:00:00Z", "2024-03-11T04:00:00Z"},
+		{"DST ends in New York", "2024-11-03T12:00:00Z", "America/New_York", "2024-11-03T04:00:00Z", "2024-11-04T05:00:00Z"},
+		{"ahead of UTC across its date", "2024-03-14T23:30:00Z", "Pacific/Auckland", "2024-03-14T11:00:00Z", "2024-03-15T11:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := DayBounds(utc(tt.at), mustZone(t, tt.zone))
+			if !from.Equal(utc(tt.from)) || !to.Equal(utc(tt.to)) {
+				t.Errorf("DayBounds(%s) = %v - %v, want %s - %s", tt.at, from.UTC(), to.UTC(), tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	newYork := mustZone(t, "America/New_York")
+	from, to, err := ParseDay("2024-11-03", newYork)
+	if err != nil || !from.Equal(utc("2024-11-03T04:00:00Z")) || !to.Equal(utc("2024-11-04T05:00:00Z")) {
+		t.Errorf("ParseDay = %v - %v, %v", from.UTC(), to.UTC(), err)
+	}
+	for _, bad := range []string{"", "2024-3-1", "2024-02-30", "03/11/2024", "2024-11-03T00:00:00Z"} {
+		if _, _, err := ParseDay(bad, newYork); !errors.Is(err, ErrValidation) {
+			t.Errorf("ParseDay(%q) error = %v, want ErrValidation", bad, err)
+		}
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	fallback := mustZone(t, "Asia/Kolkata")
+	if loc, err := LoadZone("", fallback); err != nil || loc != fallback {
+		t.Errorf("LoadZone(\"\") = %v, %v; want the fallback", loc, err)
+	}
+	if loc, err := LoadZone("Europe/London", fallback); err != nil || loc.String() != "Europe/London" {
+		t.Errorf("LoadZone(Europe/London) = %v, %v", loc, err)
+	}
+	for _, bad := range []string{"Mars/Olympus", "IST+5:30", "../etc/passwd"} {
+		if _, err := LoadZone(bad, fallback); !errors.Is(err, ErrValidation) {
+			t.Errorf("LoadZone(%q) error = %v, want ErrValidation", bad, err)
+		}
+	}
+}
+
+// Utilization ranges are whole local days; the query bounds follow the
+// zone's offsets on each end, while the chart days stay wall-clock dates.
+func TestParseUtilizationRange(t *testing.T) {
+	newYork := mustZone(t, "America/New_York")
+	kolkata := mustZone(t, "Asia/Kolkata")
+	tests := []struct {
+		name                      string
+		from, to, granularity     string
+		loc                       *time.Location
+		now                       string
+		wantFrom, wantTo          string
+		wantFirstDay, wantLastDay string
+		wantErr                   bool
+	}{
+		{"across DST", "2024-03-09", "2024-03-11", GranularityHour, newYork, "2024-03-20T12:00:00Z",
+			"2024-03-09T05:00:00Z", "2024-03-12T04:00:00Z", "2024-03-09", "2024-03-11", false},
+		{"default week ends today in the zone", "", "", GranularityDay, kolkata, "2024-03-14T19:00:00Z",
+			"2024-03-08T18:30:00Z", "2024-03-15T18:30:00Z", "2024-03-09", "2024-03-15", false},
+		{"single day", "2024-11-03", "2024-11-03", GranularityDay, newYork, "2024-11-10T12:00:00Z",
+			"2024-11-03T04:00:00Z", "2024-11-04T05:00:00Z", "2024-11-03", "2024-11-03", false},
+		{"from after to", "2024-03-11", "2024-03-09", GranularityDay, newYork, "2024-03-20T12:00:00Z", "", "", "", "", true},
+		{"too many hours", "2024-01-01", "2024-02-15", GranularityHour, newYork, "2024-03-20T12:00:00Z", "", "", "", "", true},
+		{"unknown granularity", "", "", "month", newYork, "2024-03-20T12:00:00Z", "", "", "", "", true},
+		{"bad date", "2024-13-01", "", GranularityDay, newYork, "2024-03-20T12:00:00Z", "", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, firstDay, lastDay, err := ParseUtilizationRange(tt.from, tt.to, tt.granularity, tt.loc, utc(tt.now))
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidation) {
+					t.Errorf("error = %v, want ErrValidation", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !from.Equal(utc(tt.wantFrom)) || !to.Equal(utc(tt.wantTo)) {
+				t.Errorf("bounds = %v - %v, want %s - %s", from.UTC(), to.UTC(), tt.wantFrom, tt.wantTo)
+			}
+			if got := firstDay.Format(time.DateOnly); got != tt.wantFirstDay {
+				t.Errorf("first day = %s, want %s", got, tt.wantFirstDay)
+			}
+			if got := lastDay.Format(time.DateOnly); got != tt.wantLastDay {
+				t.Errorf("last day = %s, want %s", got, tt.wantLastDay)
+			}
+		})
+	}
+}
+
+// Reports count a check-in on the day and hour its zone's clock showed, so
+// one made at 00:30 in India is on the Indian day it was made, and hours on
+// the day DST starts skip from 01:00 to 03:00.
+func TestReportBucketsByTimezone(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	at := func(user, device, when string) Event {
+		return Event{UserID: user, DeviceID: device, When: utc(when), Status: StatusProcessed}
+	}
+	if _, err := repo.ImportEvents(ctx, []Event{
+		at("emp-late", "kiosk-in", "2024-03-14T18:00:00Z"),  // 23:30 IST on the 14th
+		at("emp-early", "kiosk-in", "2024-03-14T19:00:00Z"), // 00:30 IST on the 15th
+		at("emp-1", "kiosk-ny", "2024-03-10T06:30:00Z"),     // 01:30 EST
+		at("emp-2", "kiosk-ny", "2024-03-10T07:30:00Z"),     // 03:30 EDT
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	kolkata := mustZone(t, "Asia/Kolkata")
+	users := func(from, to time.Time) []string {
+		t.Helper()
+		report, err := repo.DailyReport(ctx, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, d := range report {
+			ids = append(ids, d.UserID)
+		}
+		return ids
+	}
+	from, to, _ := ParseDay("2024-03-15", kolkata)
+	if got := users(from, to); !slices.Equal(got, []string{"emp-early"}) {
+		t.Errorf("15 March in India = %v, want [emp-early]", got)
+	}
+	from, to, _ = ParseDay("2024-03-14", kolkata)
+	if got := users(from, to); !slices.Equal(got, []string{"emp-late"}) {
+		t.Errorf("14 March in India = %v, want [emp-late]", got)
+	}
+	from, to, _ = ParseDay("2024-03-14", time.UTC)
+	if got := users(from, to); !slices.Equal(got, []string{"emp-early", "emp-late"}) {
+		t.Errorf("14 March in UTC = %v, want both", got)
+	}
+
+	newYork := mustZone(t, "America/New_York")
+	from, to, _ = ParseDay("2024-03-10", newYork)
+	counts, err := repo.DeviceHourlyCounts(ctx, from, to, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hours []string
+	for _, c := range counts {
+		if c.DeviceID == "kiosk-ny" {
+			hours = append(hours, c.Hour.Format("15:04"))
+		}
+	}
+	if want := []string{"01:00", "03:00"}; !slices.Equal(hours, want) {
+		t.Errorf("wall-clock hours on the day DST starts = %v, want %v", hours, want)
+	}
+}
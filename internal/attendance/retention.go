@@ -0,0 +1,108 @@
+package attendance
+
+import (
+	"context"
+	"time"
+)
+
+// EventImage is an event's stored image, as selected for retention.
+type EventImage struct {
+	EventID  string
+	ImageURL string
+	// ImageURLs are all images of a multi-image check-in, ImageURL among them.
+	ImageURLs []string
+}
+
+// EventImagesBefore returns up to limit events older than cutoff that still
+// reference an image, oldest first.
+func (r *Repository) EventImagesBefore(ctx context.Context, cutoff time.Time, limit int) ([]EventImage, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(image_url, ''), image_urls FROM attendance_events
+		WHERE occurred_at < $1 AND (image_url <> '' OR image_urls IS NOT NULL)
+		ORDER BY occurred_at
+		LIMIT $2
+	`, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []EventImage
+	for rows.Next() {
+		var img EventImage
+		if err := rows.Scan(&img.EventID, &img.ImageURL, textArray(&img.ImageURLs)); err != nil {
+			return nil, err
+		}
+		res = append(res, img)
+	}
+	return res, rows.Err()
+}
+
+// ClearEventImages removes the image references from the given events.
+func (r *Repository) ClearEventImages(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE attendance_events SET image_url = NULL, image_urls = NULL WHERE id = ANY($1::text[]::uuid[])
+	`, ids)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ArchiveEventsBefore moves up to limit events older than cutoff, with their
+// corrections, into attendance_events_archive in one statement. Rows locked
+// by other transactions are skipped until the next batch, and an event that
+// is already archived is just deleted, so re-running is safe.
+func (r *Repository) ArchiveEventsBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `
+		WITH moved AS (
+			DELETE FROM attendance_events
+			WHERE id IN (
+				SELECT id FROM attendance_events
+				WHERE occurred_at < $1
+				ORDER BY occurred_at
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		INSERT INTO attendance_events_archive (id, occurred_at, event, corrections)
+		SELECT m.id, m.occurred_at, to_jsonb(m),
+		       (SELECT jsonb_agg(to_jsonb(c) ORDER BY c.created_at) FROM event_corrections c WHERE c.event_id = m.id)
+		FROM moved m
+		ON CONFLICT (id) DO NOTHING
+	`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RetentionCounts reports how many events a retention run would touch.
+type RetentionCounts struct {
+	Images int64
+	Events int64
+}
+
+// CountRetention counts events with images older than imageCutoff and events
+// older than eventCutoff, for dry runs.
+func (r *Repository) CountRetention(ctx context.Context, imageCutoff, eventCutoff time.Time) (RetentionCounts, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var c RetentionCounts
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE occurred_at < $1 AND (image_url <> '' OR image_urls IS NOT NULL)),
+			COUNT(*) FILTER (WHERE occurred_at < $2)
+		FROM attendance_events
+	`, imageCutoff, eventCutoff).Scan(&c.Images, &c.Events)
+	return c, err
+}
@@ -0,0 +1,150 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultSearchWindow is how far either side of EventSearch.At events are
+// matched when no window is given.
+const DefaultSearchWindow = 30 * time.Minute
+
+// EventSearch combines filters for SearchEvents. Zero values are ignored, but
+// at least one filter must be set.
+type EventSearch struct {
+	// Name matches employee names containing it, ignoring case.
+	Name string
+	// Device matches the device id exactly or device names containing it.
+	Device   string
+	Status   string
+	MinScore *float64
+	MaxScore *float64
+	// From and To bound occurred_at (To exclusive).
+	From, To time.Time
+	// At searches Window either side of a moment and ranks closer events higher.
+	At     time.Time
+	Window time.Duration
+	Limit  int
+	Offset int
+}
+
+// SearchResult is an event found by SearchEvents with its employee and
+// device. Rank orders results: it sums the name and device similarity (0-1
+// each, pg_trgm) and, with At, how close the event is to it (0-1).
+type SearchResult struct {
+	ExpandedEvent
+	Rank float64 `json:"rank"`
+}
+
+func (s EventSearch) empty() bool {
+	return s.Name == "" && s.Device == "" && s.Status == "" && s.MinScore == nil && s.MaxScore == nil &&
+		s.From.IsZero() && s.To.IsZero() && s.At.IsZero()
+}
+
+// likePattern returns a pattern matching s anywhere, with LIKE wildcards in s escaped.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// SearchEvents finds events matching all of the given filters, best ranked
+// first and newest first among equals. A search without any filter is
+// rejected rather than scanning every event.
+func (r *Repository) SearchEvents(ctx context.Context, s EventSearch) ([]SearchResult, error) {
+	if s.empty() {
+		return nil, fmt.Errorf("%w: at least one search filter is required", ErrValidation)
+	}
+	if s.MinScore != nil && s.MaxScore != nil && *s.MinScore > *s.MaxScore {
+		return nil, fmt.Errorf("%w: min_score must not exceed max_score", ErrValidation)
+	}
+	if s.Limit <= 0 {
+		s.Limit = 50
+	}
+	if s.Limit > MaxPageSize {
+		s.Limit = MaxPageSize
+	}
+	if s.Offset < 0 {
+		s.Offset = 0
+	}
+
+	args := []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + itoa(len(args))
+	}
+	var clauses, rank []string
+	if s.Name != "" {
+		p := arg(s.Name)
+		clauses = append(clauses, "emp.name ILIKE "+arg(likePattern(s.Name)))
+		rank = append(rank, "similarity(emp.name, "+p+")")
+	}
+	if s.Device != "" {
+		p := arg(s.Device)
+		clauses = append(clauses, "(e.device_id = "+p+" OR d.name ILIKE "+arg(likePattern(s.Device))+")")
+		rank = append(rank, "CASE WHEN e.device_id = "+p+" THEN 1 ELSE COALESCE(similarity(d.name, "+p+"), 0) END")
+	}
+	if s.Status != "" {
+		clauses = append(clauses, "e.status = "+arg(s.Status))
+	}
+	if s.MinScore != nil {
+		clauses = append(clauses, "e.match_score >= "+arg(*s.MinScore))
+	}
+	if s.MaxScore != nil {
+		clauses = append(clauses, "e.match_score <= "+arg(*s.MaxScore))
+	}
+	if !s.From.IsZero() {
+		clauses = append(clauses, "e.occurred_at >= "+arg(s.From))
+	}
+	if !s.To.IsZero() {
+		clauses = append(clauses, "e.occurred_at < "+arg(s.To))
+	}
+	if !s.At.IsZero() {
+		if s.Window <= 0 {
+			s.Window = DefaultSearchWindow
+		}
+		at, window := arg(s.At), arg(s.Window.Seconds())
+		clauses = append(clauses, "e.occurred_at BETWEEN "+at+"::timestamptz - make_interval(secs => "+window+") AND "+
+			at+"::timestamptz + make_interval(secs => "+window+")")
+		rank = append(rank, "1 - ABS(EXTRACT(EPOCH FROM e.occurred_at - "+at+"::timestamptz)) / "+window)
+	}
+	if _, ok := DepartmentScope(ctx); ok {
+		scope, scopeArg := scopeFilter(ctx, "e.user_id", len(args)+1)
+		args = append(args, scopeArg)
+		clauses = append(clauses, scope)
+	}
+	rankExpr := "0"
+	if len(rank) > 0 {
+		rankExpr = strings.Join(rank, " + ")
+	}
+
+	query := `SELECT ` + qualifiedEventColumns("e") + `, emp.name, dept.name, emp.photo_url, d.name, (` + rankExpr + `)::float8 AS rank
+		FROM attendance_events e
+		LEFT JOIN employees emp ON emp.employee_id = e.user_id
+		LEFT JOIN departments dept ON dept.id = emp.department_id
+		LEFT JOIN devices d ON d.device_id = e.device_id
+		WHERE ` + joinClauses(clauses, " AND ") + `
+		ORDER BY rank DESC, e.occurred_at DESC, e.id DESC
+		LIMIT ` + arg(s.Limit) + ` OFFSET ` + arg(s.Offset)
+
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	res := []SearchResult{}
+	for rows.Next() {
+		sr := SearchResult{ExpandedEvent: ExpandedEvent{User: &EventUser{}, Device: &EventDevice{}}}
+		evt, err := scanEvent(extraScanner{rows, []any{
+			&sr.User.Name, &sr.User.Department, &sr.User.PhotoURL, &sr.Device.Name, &sr.Rank,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		sr.Event = evt
+		res = append(res, sr)
+	}
+	return res, storageErr(rows.Err())
+}
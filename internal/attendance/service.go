@@ -2,8 +2,10 @@ package attendance
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"time"
+
+	"attendance/internal/faceclient"
 )
 
 // Event represents a recorded attendance event.
@@ -17,12 +19,73 @@ type Event struct {
 	Status     string
 	MatchScore *float64
 	CreatedAt  time.Time
+	Quality    *faceclient.FaceQuality
+	// LateMinutes is how late the check-in was for the user's shift; nil when
+	// the user has no shift or the check-in falls outside it.
+	LateMinutes *int
+	// AuthMethod is AuthMethodFace or AuthMethodPIN; empty is stored as face.
+	AuthMethod string
+	// FaceModel is the face-service model the check-in was processed under;
+	// ModelMismatch is set when the user was enrolled under another one.
+	FaceModel     *string
+	ModelMismatch bool
+	// ClientID is the kiosk's own id for a check-in submitted in an offline
+	// batch, unique per device.
+	ClientID *string
+	// ImageURLs holds every image of a check-in sent with several; ImageURL
+	// is the one the worker picked. They are unsigned and not sent to clients.
+	ImageURLs   []string `json:"-"`
+	ImageScores *ImageScores
+	// UnknownUser is set when no employee had UserID at check-in time.
+	UnknownUser bool
+	// FailureReason is one of the Failure constants when processing did not
+	// check the event in and the cause is known.
+	FailureReason *string
+}
+
+// Dedup scopes: a check-in is a duplicate of a recent event by the same user
+// on the same device, or on any device.
+const (
+	DedupScopeDevice = "device"
+	DedupScopeUser   = "user"
+)
+
+// DedupWindowSource supplies the dedup window at check-in time, so it can
+// change while the service runs.
+type DedupWindowSource interface {
+	DedupWindow(ctx context.Context) time.Duration
 }
 
 // Service coordinates attendance checks and deduplication.
 type Service struct {
 	repo        *Repository
 	dedupWindow time.Duration
+	// DedupWindows, when set, overrides the window given to NewService.
+	DedupWindows DedupWindowSource
+	// DeviceLockout rejects check-ins from devices flagged as suspicious.
+	DeviceLockout bool
+	// DedupScope is DedupScopeDevice (the default) or DedupScopeUser.
+	DedupScope string
+	// ClockSkewTolerance is how far a client timestamp, corrected by the
+	// device's known clock skew, may be from server time to be used as the
+	// check-in time; 0 always uses server time.
+	ClockSkewTolerance time.Duration
+	// OfflineMaxAge is how long after it happened a check-in may arrive in
+	// an offline batch; 0 accepts any age.
+	OfflineMaxAge time.Duration
+	// RequireEnrollmentCode makes new devices present a one-time enrollment
+	// code to register; devices already registered may register again without.
+	RequireEnrollmentCode bool
+	// PINLockAfter is how many consecutive wrong PINs lock a user's PIN; 0
+	// never locks.
+	PINLockAfter int
+	// Metrics counts check-in results; NewService sets a no-op.
+	Metrics Metrics
+	// Users tells which user ids are employees; NewService sets an
+	// EmployeeCache. Check-ins of other users are flagged UnknownUser, or
+	// rejected with ErrUnknownUser when StrictUsers is set.
+	Users       UserDirectory
+	StrictUsers bool
 }
 
 // NewService creates a service backed by a repository.
@@ -30,35 +93,109 @@ func NewService(repo *Repository, dedupWindow time.Duration) *Service {
 	if dedupWindow <= 0 {
 		dedupWindow = 5 * time.Minute
 	}
-	return &Service{repo: repo, dedupWindow: dedupWindow}
+	return &Service{repo: repo, dedupWindow: dedupWindow, Metrics: nopMetrics{}, Users: NewEmployeeCache(repo, 0)}
+}
+
+// window returns the dedup window in effect.
+func (s *Service) window(ctx context.Context) time.Duration {
+	if s.DedupWindows != nil {
+		return s.DedupWindows.DedupWindow(ctx)
+	}
+	return s.dedupWindow
 }
 
-// RegisterDevice validates and persists device metadata.
-func (s *Service) RegisterDevice(ctx context.Context, deviceID string) error {
+// RegisterDevice validates and persists device metadata. A non-empty code is
+// consumed as the device's enrollment code; without one, an unknown device is
+// rejected when RequireEnrollmentCode is set. A device id already in use is
+// ErrDuplicate unless the device was deactivated and an admin allowed it to
+// be reprovisioned, which reprovisioned reports.
+func (s *Service) RegisterDevice(ctx context.Context, deviceID, name, code string) (reprovisioned bool, err error) {
 	if deviceID == "" {
-		return errors.New("device id required")
+		return false, fmt.Errorf("%w: device id required", ErrValidation)
+	}
+	if code != "" {
+		return s.repo.RegisterDeviceWithCode(ctx, deviceID, name, code)
 	}
-	return s.repo.UpsertDevice(ctx, deviceID)
+	if s.RequireEnrollmentCode {
+		exists, err := s.repo.DeviceExists(ctx, deviceID)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return false, fmt.Errorf("%w: new devices must register with an enrollment code", ErrEnrollmentCode)
+		}
+	}
+	return s.repo.RegisterDevice(ctx, deviceID, name)
+}
+
+// CheckIn records a new attendance event with deduplication. A check-in
+// inside the dedup window (per device or per user, see DedupScope) returns
+// the earlier event together with ErrDuplicate. clientTime, when set,
+// corrected by the device's known clock skew and within ClockSkewTolerance
+// of server time, becomes the event time.
+func (s *Service) CheckIn(ctx context.Context, userID, deviceID, location, imageURL string, clientTime time.Time) (Event, error) {
+	return s.checkIn(ctx, Event{UserID: userID, DeviceID: deviceID, Location: location, ImageURL: imageURL}, clientTime, time.Now())
 }
 
-// CheckIn records a new attendance event with deduplication.
-func (s *Service) CheckIn(ctx context.Context, userID, deviceID, location, imageURL string) (Event, error) {
+// CheckInLate records a check-in the server received at receivedAt but could
+// not store then, such as one spooled while the database was down. evt.ID,
+// when set, becomes the event id, so an id already handed to the client
+// stays valid. The dedup window is measured around the event time rather
+// than now. If the event was already stored under evt.ID, it comes back with
+// ErrDuplicate like any other duplicate.
+func (s *Service) CheckInLate(ctx context.Context, evt Event, clientTime, receivedAt time.Time) (Event, error) {
+	return s.checkIn(ctx, evt, clientTime, receivedAt)
+}
+
+func (s *Service) checkIn(ctx context.Context, evt Event, clientTime, receivedAt time.Time) (Event, error) {
+	evt, err := s.insertCheckin(ctx, evt, clientTime, receivedAt)
+	s.countCheckin(err)
+	return evt, err
+}
+
+func (s *Service) insertCheckin(ctx context.Context, evt Event, clientTime, receivedAt time.Time) (Event, error) {
+	userID, deviceID := evt.UserID, evt.DeviceID
 	if userID == "" || deviceID == "" {
-		return Event{}, errors.New("user and device required")
+		return Event{}, fmt.Errorf("%w: user and device required", ErrValidation)
+	}
+	if s.DeviceLockout {
+		if flagged, err := s.repo.IsDeviceSuspicious(ctx, deviceID); err != nil {
+			return Event{}, storageErr(err)
+		} else if flagged {
+			return Event{}, fmt.Errorf("%w: device %s is locked after repeated failed matches; an admin must re-enable it", ErrDeviceDisabled, deviceID)
+		}
 	}
-	if recent, err := s.repo.RecentEvent(ctx, userID, deviceID, s.dedupWindow); err != nil {
+	unknown, err := s.checkUser(ctx, userID)
+	if err != nil {
 		return Event{}, err
-	} else if recent != nil {
-		return *recent, nil
 	}
-
-	evt := Event{
-		UserID:   userID,
-		DeviceID: deviceID,
-		When:     time.Now().UTC(),
-		Location: location,
-		ImageURL: imageURL,
-		Status:   "pending",
+	evt.UnknownUser = unknown
+	dedupDevice := deviceID
+	if s.DedupScope == DedupScopeUser {
+		dedupDevice = ""
+	}
+	var skew ClockSkew
+	if !clientTime.IsZero() && s.ClockSkewTolerance > 0 {
+		var err error
+		if skew, err = s.repo.DeviceClockSkew(ctx, deviceID); err != nil {
+			return Event{}, storageErr(err)
+		}
+	}
+	evt.When = correctTime(clientTime, receivedAt, skew, s.ClockSkewTolerance)
+	if evt.Status == "" {
+		evt.Status = StatusPending
+	}
+	// The dedup check and the insert share a transaction and a per-user lock,
+	// so simultaneous requests cannot both pass the check.
+	evt, recent, err := s.repo.CheckInTx(ctx, evt, dedupDevice, s.window(ctx))
+	if isForeignKeyViolation(err) {
+		return Event{}, fmt.Errorf("%w: device %s is not registered", ErrValidation, deviceID)
+	}
+	if err != nil {
+		return Event{}, storageErr(err)
+	}
+	if recent != nil {
+		return *recent, fmt.Errorf("%w: user %s already checked in at %s", ErrDuplicate, userID, recent.When.UTC().Format(time.RFC3339))
 	}
-	return s.repo.InsertEvent(ctx, evt)
+	return evt, nil
 }
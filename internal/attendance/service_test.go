@@ -0,0 +1,120 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrentCheckIns sends n simultaneous check-ins of userID, the i-th from
+// device(i), and returns their events and errors.
+func concurrentCheckIns(s *Service, n int, userID string, device func(i int) string) ([]Event, []error) {
+	events := make([]Event, n)
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			events[i], errs[i] = s.CheckIn(context.Background(), userID, device(i), "", "", time.Time{})
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return events, errs
+}
+
+// checkOneCreated fails unless exactly one check-in created an event and all
+// others were duplicates of it, and the user has exactly one stored event.
+func checkOneCreated(t *testing.T, repo *Repository, userID string, events []Event, errs []error) {
+	t.Helper()
+	var created []string
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			created = append(created, events[i].ID)
+		case !errors.Is(err, ErrDuplicate):
+			t.Fatalf("check-in %d: %v", i, err)
+		}
+	}
+	if len(created) != 1 {
+		t.Fatalf("%d check-ins created events %v, want exactly 1", len(created), created)
+	}
+	for i, err := range errs {
+		if err != nil && events[i].ID != created[0] {
+			t.Errorf("duplicate %d reports event %q, want %q", i, events[i].ID, created[0])
+		}
+	}
+	stored, err := repo.ListEvents(context.Background(), "", userID, 100, 0)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("%d events stored for %s, want 1", len(stored), userID)
+	}
+}
+
+func TestCheckInConcurrentCreatesOneEvent(t *testing.T) {
+	repo := testRepo(t)
+	registerDevice(t, repo, "kiosk-1")
+	addEmployee(t, repo, "emp-1")
+	s := NewService(repo, 5*time.Minute)
+
+	events, errs := concurrentCheckIns(s, 20, "emp-1", func(int) string { return "kiosk-1" })
+	checkOneCreated(t, repo, "emp-1", events, errs)
+}
+
+func TestCheckInConcurrentAcrossDevicesUserScope(t *testing.T) {
+	repo := testRepo(t)
+	const devices = 4
+	for i := range devices {
+		registerDevice(t, repo, fmt.Sprintf("kiosk-%d", i))
+	}
+	addEmployee(t, repo, "emp-1")
+	s := NewService(repo, 5*time.Minute)
+	s.DedupScope = DedupScopeUser
+
+	events, errs := concurrentCheckIns(s, 20, "emp-1", func(i int) string { return fmt.Sprintf("kiosk-%d", i%devices) })
+	checkOneCreated(t, repo, "emp-1", events, errs)
+}
+
+func TestCheckInDedupScopeAcrossDevices(t *testing.T) {
+	for _, tt := range []struct {
+		scope    string
+		wantDupe bool
+	}{
+		{DedupScopeDevice, false},
+		{DedupScopeUser, true},
+	} {
+		t.Run(tt.scope, func(t *testing.T) {
+			repo := testRepo(t)
+			registerDevice(t, repo, "kiosk-1")
+			registerDevice(t, repo, "kiosk-2")
+			addEmployee(t, repo, "emp-1")
+			s := NewService(repo, 5*time.Minute)
+			s.DedupScope = tt.scope
+			ctx := context.Background()
+
+			first, err := s.CheckIn(ctx, "emp-1", "kiosk-1", "", "", time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CheckIn(ctx, "emp-1", "kiosk-1", "", "", time.Time{}); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("second check-in on the same device = %v, want ErrDuplicate", err)
+			}
+			evt, err := s.CheckIn(ctx, "emp-1", "kiosk-2", "", "", time.Time{})
+			if tt.wantDupe {
+				if !errors.Is(err, ErrDuplicate) || evt.ID != first.ID {
+					t.Errorf("check-in on another device = %s, %v; want ErrDuplicate of %s", evt.ID, err, first.ID)
+				}
+			} else if err != nil {
+				t.Errorf("check-in on another device = %v, want a new event", err)
+			}
+		})
+	}
+}
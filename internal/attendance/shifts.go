@@ -0,0 +1,395 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShiftArrivalWindow is how long before a shift starts a check-in still
+// counts toward that shift (as on time).
+const ShiftArrivalWindow = 2 * time.Hour
+
+// shiftClock is the format of Shift.Start and Shift.End.
+const shiftClock = "15:04"
+
+// weekdayNames are the accepted values of Shift.Days, indexed by time.Weekday.
+var weekdayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Shift is a recurring work schedule. Start and End are wall-clock times
+// ("HH:MM") in Timezone; an End before Start means the shift ends the next day.
+type Shift struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Start     string    `json:"start"`
+	End       string    `json:"end"`
+	Days      []string  `json:"days"`
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	loc *time.Location
+}
+
+// ShiftAssignment links a user to a shift.
+type ShiftAssignment struct {
+	UserID     string    `json:"user_id"`
+	ShiftID    int64     `json:"shift_id"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+// Validate checks the shift's fields and normalises Days to lower case.
+func (s *Shift) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("%w: shift name required", ErrValidation)
+	}
+	start, err := time.Parse(shiftClock, s.Start)
+	if err != nil {
+		return fmt.Errorf("%w: start must be HH:MM", ErrValidation)
+	}
+	end, err := time.Parse(shiftClock, s.End)
+	if err != nil {
+		return fmt.Errorf("%w: end must be HH:MM", ErrValidation)
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("%w: start and end must differ", ErrValidation)
+	}
+	if len(s.Days) == 0 {
+		return fmt.Errorf("%w: at least one day required", ErrValidation)
+	}
+	for i, d := range s.Days {
+		s.Days[i] = strings.ToLower(strings.TrimSpace(d))
+		if weekdayIndex(s.Days[i]) < 0 {
+			return fmt.Errorf("%w: unknown day %q (use sun..sat)", ErrValidation, d)
+		}
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if s.loc, err = time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrValidation, s.Timezone)
+	}
+	return nil
+}
+
+func weekdayIndex(name string) int {
+	for i, n := range weekdayNames {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func daysMask(days []string) int16 {
+	var mask int16
+	for _, d := range days {
+		if i := weekdayIndex(d); i >= 0 {
+			mask |= 1 << i
+		}
+	}
+	return mask
+}
+
+func daysFromMask(mask int16) []string {
+	days := []string{}
+	for i, n := range weekdayNames {
+		if mask&(1<<i) != 0 {
+			days = append(days, n)
+		}
+	}
+	return days
+}
+
+func (s Shift) location() (*time.Location, error) {
+	if s.loc != nil {
+		return s.loc, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+// Occurrence returns the start and end of the occurrence of the shift that t
+// belongs to: t is no earlier than ShiftArrivalWindow before the start and
+// before the end. ok is false on days off and outside every occurrence.
+// Boundaries are computed from wall-clock times, so a shift keeps its local
+// start time across DST changes; a start that falls in a skipped hour is
+// moved forward by the gap, and one in a repeated hour is the first of the
+// two.
+func (s Shift) Occurrence(t time.Time) (start, end time.Time, ok bool) {
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	sc, err1 := time.Parse(shiftClock, s.Start)
+	ec, err2 := time.Parse(shiftClock, s.End)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	local := t.In(loc)
+	mask := daysMask(s.Days)
+	// An overnight occurrence may have started the previous day, and the
+	// arrival window may reach back from tomorrow's start past midnight.
+	for _, offset := range []int{-1, 0, 1} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 12, 0, 0, 0, loc)
+		if mask&(1<<int(day.Weekday())) == 0 {
+			continue
+		}
+		start = wallClock(day, 0, sc)
+		end = wallClock(day, 0, ec)
+		if !end.After(start) {
+			end = wallClock(day, 1, ec)
+		}
+		if !t.Before(start.Add(-ShiftArrivalWindow)) && t.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// wallClock returns the instant, days after day, at which the clock in day's
+// location reads clock's hour and minute. time.Date resolves a time in a
+// skipped hour with the offset from after the change, which lands before the
+// gap; such a time is moved past the gap instead.
+func wallClock(day time.Time, days int, clock time.Time) time.Time {
+	y, m, d := day.Date()
+	t := time.Date(y, m, d+days, clock.Hour(), clock.Minute(), 0, 0, day.Location())
+	if t.Hour() == clock.Hour() && t.Minute() == clock.Minute() {
+		return t
+	}
+	_, before := t.Zone()
+	return time.Date(y, m, d+days, clock.Hour(), clock.Minute(), 0, 0, time.UTC).
+		Add(-time.Duration(before) * time.Second).In(day.Location())
+}
+
+// Lateness returns how many whole minutes after the shift start t falls (0
+// when on time). ok is false when t is outside every occurrence.
+func (s Shift) Lateness(t time.Time) (int, bool) {
+	start, _, ok := s.Occurrence(t)
+	if !ok {
+		return 0, false
+	}
+	if late := t.Sub(start); late > 0 {
+		return int(late / time.Minute), true
+	}
+	return 0, true
+}
+
+// EarlyDeparture returns how many whole minutes before the shift end t falls,
+// for a last check-in of the day. ok is false when t is outside every occurrence.
+func (s Shift) EarlyDeparture(t time.Time) (int, bool) {
+	_, end, ok := s.Occurrence(t)
+	if !ok {
+		return 0, false
+	}
+	return int(end.Sub(t) / time.Minute), true
+}
+
+const shiftColumns = `id, name, start_time, end_time, days, timezone, created_at, updated_at`
+
+func scanShift(row scanner) (Shift, error) {
+	var s Shift
+	var mask int16
+	if err := row.Scan(&s.ID, &s.Name, &s.Start, &s.End, &mask, &s.Timezone, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return Shift{}, err
+	}
+	s.Days = daysFromMask(mask)
+	return s, nil
+}
+
+// ListShifts returns all shifts by name.
+func (r *Repository) ListShifts(ctx context.Context) ([]Shift, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT `+shiftColumns+` FROM shifts ORDER BY name`)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	shifts := []Shift{}
+	for rows.Next() {
+		s, err := scanShift(rows)
+		if err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, s)
+	}
+	return shifts, storageErr(rows.Err())
+}
+
+// GetShift returns one shift.
+func (r *Repository) GetShift(ctx context.Context, id int64) (Shift, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	s, err := scanShift(r.db.QueryRowContext(ctx, `SELECT `+shiftColumns+` FROM shifts WHERE id = $1`, id))
+	return s, storageErr(err)
+}
+
+// CreateShift validates and stores a new shift.
+func (r *Repository) CreateShift(ctx context.Context, s Shift) (Shift, error) {
+	if err := s.Validate(); err != nil {
+		return Shift{}, err
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	created, err := scanShift(r.db.QueryRowContext(ctx, `
+		INSERT INTO shifts (name, start_time, end_time, days, timezone)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+shiftColumns, s.Name, s.Start, s.End, daysMask(s.Days), s.Timezone))
+	return created, shiftErr(err)
+}
+
+// UpdateShift validates and replaces an existing shift.
+func (r *Repository) UpdateShift(ctx context.Context, s Shift) (Shift, error) {
+	if err := s.Validate(); err != nil {
+		return Shift{}, err
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	updated, err := scanShift(r.db.QueryRowContext(ctx, `
+		UPDATE shifts
+		SET name = $2, start_time = $3, end_time = $4, days = $5, timezone = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+shiftColumns, s.ID, s.Name, s.Start, s.End, daysMask(s.Days), s.Timezone))
+	return updated, shiftErr(err)
+}
+
+// DeleteShift removes a shift and its assignments.
+func (r *Repository) DeleteShift(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `DELETE FROM shifts WHERE id = $1`, id)
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: shift %d", ErrNotFound, id))
+}
+
+// shiftErr reports a taken shift name as ErrDuplicate.
+func shiftErr(err error) error {
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: a shift with this name exists", ErrDuplicate)
+	}
+	return storageErr(err)
+}
+
+// ListShiftAssignments returns every user's shift.
+func (r *Repository) ListShiftAssignments(ctx context.Context) ([]ShiftAssignment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id, shift_id, assigned_at FROM user_shifts ORDER BY user_id`)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	assignments := []ShiftAssignment{}
+	for rows.Next() {
+		var a ShiftAssignment
+		if err := rows.Scan(&a.UserID, &a.ShiftID, &a.AssignedAt); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, storageErr(rows.Err())
+}
+
+// AssignShift puts a user on a shift, replacing any previous assignment.
+func (r *Repository) AssignShift(ctx context.Context, userID string, shiftID int64) error {
+	if userID == "" {
+		return fmt.Errorf("%w: user id required", ErrValidation)
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_shifts (user_id, shift_id) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET shift_id = EXCLUDED.shift_id, assigned_at = NOW()
+	`, userID, shiftID)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: shift %d", ErrNotFound, shiftID)
+	}
+	return storageErr(err)
+}
+
+// UnassignShift removes a user's shift.
+func (r *Repository) UnassignShift(ctx context.Context, userID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.db.ExecContext(ctx, `DELETE FROM user_shifts WHERE user_id = $1`, userID)
+	if err != nil {
+		return storageErr(err)
+	}
+	return requireRow(res, fmt.Errorf("%w: user %s has no shift", ErrNotFound, userID))
+}
+
+// SetEventLateness stores how late an event was relative to the user's shift.
+func (r *Repository) SetEventLateness(ctx context.Context, id string, minutes int) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `UPDATE attendance_events SET late_minutes = $2 WHERE id = $1`, id, minutes)
+	return err
+}
+
+// ShiftCache keeps all shifts and assignments in memory. It reloads them
+// after ttl, or on the next lookup after Invalidate, which the process that
+// changes shifts calls; other processes see changes within ttl.
+type ShiftCache struct {
+	repo *Repository
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	byUser   map[string]Shift
+}
+
+// NewShiftCache creates a cache; a non-positive ttl defaults to one minute.
+func NewShiftCache(repo *Repository, ttl time.Duration) *ShiftCache {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &ShiftCache{repo: repo, ttl: ttl}
+}
+
+// ForUser returns the user's shift, or ok=false if they have none.
+func (c *ShiftCache) ForUser(ctx context.Context, userID string) (Shift, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byUser == nil || time.Since(c.loadedAt) > c.ttl {
+		if err := c.load(ctx); err != nil {
+			return Shift{}, false, err
+		}
+	}
+	s, ok := c.byUser[userID]
+	return s, ok, nil
+}
+
+// Invalidate drops the cached data.
+func (c *ShiftCache) Invalidate() {
+	c.mu.Lock()
+	c.byUser = nil
+	c.mu.Unlock()
+}
+
+func (c *ShiftCache) load(ctx context.Context) error {
+	shifts, err := c.repo.ListShifts(ctx)
+	if err != nil {
+		return err
+	}
+	assignments, err := c.repo.ListShiftAssignments(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]Shift, len(shifts))
+	for _, s := range shifts {
+		if s.loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("shift %d: %w", s.ID, err)
+		}
+		byID[s.ID] = s
+	}
+	byUser := make(map[string]Shift, len(assignments))
+	for _, a := range assignments {
+		byUser[a.UserID] = byID[a.ShiftID]
+	}
+	c.byUser, c.loadedAt = byUser, time.Now()
+	return nil
+}
@@ -0,0 +1,105 @@
+package attendance
+
+import (
+	"testing"
+	"time"
+)
+
+var everyDay = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func testShift(t *testing.T, start, end, tz string, days ...string) Shift {
+	t.Helper()
+	if len(days) == 0 {
+		days = everyDay
+	}
+	s := Shift{Name: start + "-" + end, Start: start, End: end, Days: days, Timezone: tz}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("shift %s %s: %v", s.Name, tz, err)
+	}
+	return s
+}
+
+// Lateness is measured against the shift's wall-clock start in its own
+// timezone, so it does not jump by an hour when DST starts or ends. In 2024
+// New York moved to EDT on 10 March and back to EST on 3 November, and
+// London to BST on 31 March.
+func TestShiftLatenessAcrossDST(t *testing.T) {
+	newYork := testShift(t, "09:00", "17:00", "America/New_York")
+	night := testShift(t, "22:00", "06:00", "America/New_York")
+	skipped := testShift(t, "02:30", "10:00", "America/New_York", "sun")
+	repeated := testShift(t, "01:30", "09:00", "America/New_York", "sun")
+	london := testShift(t, "09:00", "17:00", "Europe/London")
+	kolkata := testShift(t, "06:00", "14:00", "Asia/Kolkata", "mon", "tue", "wed", "thu", "fri")
+
+	tests := []struct {
+		name     string
+		shift    Shift
+		at       string
+		wantLate int
+		wantOK   bool
+	}{
+		{"day before DST starts", newYork, "2024-03-09T14:10:00Z", 10, true},     // 09:10 EST
+		{"day DST starts", newYork, "2024-03-10T13:10:00Z", 10, true},            // 09:10 EDT
+		{"day DST ends", newYork, "2024-11-03T14:05:00Z", 5, true},               // 09:05 EST
+		{"early on the day DST ends", newYork, "2024-11-03T13:55:00Z", 0, true},  // 08:55 EST
+		{"overnight into DST", night, "2024-03-10T03:30:00Z", 30, true},          // 22:30 EST
+		{"overnight out of DST", night, "2024-11-03T02:30:00Z", 30, true},        // 22:30 EDT
+		{"start in the skipped hour", skipped, "2024-03-10T07:40:00Z", 10, true}, // 03:40 EDT
+		{"right after the skipped hour", skipped, "2024-03-10T07:00:00Z", 0, true},
+		{"start in the repeated hour", repeated, "2024-11-03T06:30:00Z", 60, true},    // the second 01:30
+		{"arrival window across the change", london, "2024-03-31T06:30:00Z", 0, true}, // 07:30 BST
+		{"before the arrival window", london, "2024-03-31T05:59:00Z", 0, false},       // 06:59 BST
+		{"late after the change", london, "2024-03-31T08:01:00Z", 1, true},            // 09:01 BST
+		{"weekday of the shift's zone", kolkata, "2024-03-10T23:45:00Z", 0, true},     // Monday 05:15 IST
+		{"day off in the shift's zone", kolkata, "2024-03-15T23:45:00Z", 0, false},    // Saturday 05:15 IST
+		{"late across the UTC date", kolkata, "2024-03-11T00:40:00Z", 10, true},       // Monday 06:10 IST
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			late, ok := tt.shift.Lateness(utc(tt.at))
+			if late != tt.wantLate || ok != tt.wantOK {
+				t.Errorf("Lateness(%s) = %d, %v; want %d, %v", tt.at, late, ok, tt.wantLate, tt.wantOK)
+			}
+		})
+	}
+}
+
+// An overnight shift is an hour shorter across the spring change and an hour
+// longer across the autumn one, and a boundary in a skipped hour is moved
+// past the gap.
+func TestShiftOccurrenceAcrossDST(t *testing.T) {
+	night := testShift(t, "22:00", "06:00", "America/New_York")
+	endsInGap := testShift(t, "20:00", "02:30", "America/New_York", "sat")
+
+	tests := []struct {
+		name                string
+		shift               Shift
+		at                  string
+		wantStart, wantEnd  string
+		wantEarlyDepartures int
+	}{
+		{"spring night", night, "2024-03-10T09:00:00Z", "2024-03-10T03:00:00Z", "2024-03-10T10:00:00Z", 60},
+		{"autumn night", night, "2024-11-03T10:00:00Z", "2024-11-03T02:00:00Z", "2024-11-03T11:00:00Z", 60},
+		{"end in the skipped hour", endsInGap, "2024-03-10T07:00:00Z", "2024-03-10T01:00:00Z", "2024-03-10T07:30:00Z", 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, ok := tt.shift.Occurrence(utc(tt.at))
+			if !ok || !start.Equal(utc(tt.wantStart)) || !end.Equal(utc(tt.wantEnd)) {
+				t.Errorf("Occurrence(%s) = %v - %v, %v; want %s - %s",
+					tt.at, start.UTC(), end.UTC(), ok, tt.wantStart, tt.wantEnd)
+			}
+			if early, ok := tt.shift.EarlyDeparture(utc(tt.at)); !ok || early != tt.wantEarlyDepartures {
+				t.Errorf("EarlyDeparture(%s) = %d, %v; want %d", tt.at, early, ok, tt.wantEarlyDepartures)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package attendance
+
+import "errors"
+
+// Event statuses. An event starts pending and moves to exactly one terminal
+// status; only an explicit admin reprocess may send it back to pending.
+// Manually entered events skip face processing: they start awaiting approval
+// and a second admin moves them to processed or rejected.
+const (
+	StatusPending       = "pending"
+	StatusProcessed     = "processed"
+	StatusFailed        = "failed"
+	StatusRejectedSpoof = "rejected_spoof"
+	StatusUnmatched     = "unmatched"
+	StatusPoorQuality   = "poor_quality"
+	// StatusDegraded means the face service was unreachable and no cached
+	// embedding was available; an admin reprocess retries it.
+	StatusDegraded = "degraded"
+	// StatusMismatch means verification against the claimed user failed
+	// (VERIFY_ON_CHECKIN); the similarity is kept as the match score.
+	StatusMismatch = "mismatch"
+	// StatusUnenrolled means the claimed user has no enrolled face to verify
+	// against; these events wait for admin review.
+	StatusUnenrolled = "unenrolled"
+	// StatusAwaitingApproval marks a manual event no admin has reviewed yet.
+	StatusAwaitingApproval = "awaiting_approval"
+	// StatusRejected marks a manual event a reviewing admin turned down.
+	StatusRejected = "rejected"
+)
+
+// Failure reasons say why face processing did not check an event in, so a
+// kiosk can tell the user what to do about it. They are stored with events
+// the worker leaves failed, degraded, poor_quality, rejected_spoof, unmatched
+// or mismatch; a failure nobody could categorize has none.
+const (
+	FailureNoFace             = "no_face"
+	FailureMultipleFaces      = "multiple_faces"
+	FailureLowQuality         = "low_quality"
+	FailureServiceUnavailable = "service_unavailable"
+	FailureTimeout            = "timeout"
+	FailureSpoof              = "spoof"
+	FailureMismatch           = "mismatch"
+)
+
+// ErrInvalidTransition is returned when a status change is not allowed from
+// the event's current status (for example a late duplicate message trying to
+// overwrite a processed event).
+var ErrInvalidTransition = errors.New("invalid event status transition")
+
+var terminalStatuses = map[string]bool{
+	StatusProcessed:     true,
+	StatusFailed:        true,
+	StatusRejectedSpoof: true,
+	StatusUnmatched:     true,
+	StatusPoorQuality:   true,
+	StatusDegraded:      true,
+	StatusMismatch:      true,
+	StatusUnenrolled:    true,
+	StatusRejected:      true,
+}
+
+// IsTerminal reports whether status is a final processing outcome.
+func IsTerminal(status string) bool {
+	return terminalStatuses[status]
+}
+
+// IsKnownStatus reports whether status is pending, awaiting approval or a
+// terminal status.
+func IsKnownStatus(status string) bool {
+	return status == StatusPending || status == StatusAwaitingApproval || IsTerminal(status)
+}
+
+// CanTransition reports whether the worker may move an event from one status
+// to another. Resetting to pending is reserved for ResetEventStatus.
+func CanTransition(from, to string) bool {
+	return from == StatusPending && IsTerminal(to)
+}
+
+// CanReview reports whether an admin review may move a manual event from one
+// status to another: only approval to processed or rejection.
+func CanReview(from, to string) bool {
+	return from == StatusAwaitingApproval && (to == StatusProcessed || to == StatusRejected)
+}
@@ -0,0 +1,162 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var allStatuses = []string{
+	StatusPending,
+	StatusAwaitingApproval,
+	StatusProcessed,
+	StatusFailed,
+	StatusRejectedSpoof,
+	StatusUnmatched,
+	StatusPoorQuality,
+	StatusDegraded,
+	StatusMismatch,
+	StatusUnenrolled,
+	StatusRejected,
+}
+
+func TestCanTransition(t *testing.T) {
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := from == StatusPending && to != StatusPending && to != StatusAwaitingApproval
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	if CanTransition(StatusPending, "bogus") {
+		t.Error("CanTransition to an unknown status = true")
+	}
+}
+
+func TestCanReview(t *testing.T) {
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := from == StatusAwaitingApproval && (to == StatusProcessed || to == StatusRejected)
+			if got := CanReview(from, to); got != want {
+				t.Errorf("CanReview(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+// TestUpdateEventStatusTransitions tries every from -> to pair against the
+// database: only pending -> terminal moves the event and adds a history
+// row; every other pair leaves both alone.
+func TestUpdateEventStatusTransitions(t *testing.T) {
+	repo := testRepo(t)
+	registerDevice(t, repo, "kiosk-1")
+	s := NewService(repo, time.Minute)
+	ctx := context.Background()
+
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			userID := "emp-" + from + "-" + to
+			t.Run(from+"->"+to, func(t *testing.T) {
+				addEmployee(t, repo, userID)
+				evt, err := s.CheckIn(ctx, userID, "kiosk-1", "", "", time.Time{})
+				if err != nil {
+					t.Fatalf("check in: %v", err)
+				}
+				if _, err := repo.db.ExecContext(ctx, `UPDATE attendance_events SET status = $2 WHERE id = $1`, evt.ID, from); err != nil {
+					t.Fatalf("set status %s: %v", from, err)
+				}
+				before, err := repo.ListStatusHistory(ctx, evt.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = repo.UpdateEventStatus(ctx, evt.ID, to, nil, "")
+				allowed := CanTransition(from, to)
+				switch {
+				case allowed && err != nil:
+					t.Fatalf("UpdateEventStatus: %v", err)
+				case !allowed && !errors.Is(err, ErrInvalidTransition):
+					t.Fatalf("UpdateEventStatus: err = %v, want ErrInvalidTransition", err)
+				}
+
+				got, err := repo.GetEvent(ctx, evt.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantStatus := from
+				if allowed {
+					wantStatus = to
+				}
+				if got.Status != wantStatus {
+					t.Errorf("status = %s, want %s", got.Status, wantStatus)
+				}
+
+				after, err := repo.ListStatusHistory(ctx, evt.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !allowed {
+					if len(after) != len(before) {
+						t.Errorf("refused change added history %v", after[len(before):])
+					}
+					return
+				}
+				if len(after) != len(before)+1 {
+					t.Fatalf("history has %d rows after the change, want %d", len(after), len(before)+1)
+				}
+				last := after[len(after)-1]
+				if last.OldStatus != from || last.NewStatus != to || last.Actor != ActorWorker {
+					t.Errorf("history row = %s -> %s by %s, want %s -> %s by %s",
+						last.OldStatus, last.NewStatus, last.Actor, from, to, ActorWorker)
+				}
+			})
+		}
+	}
+}
+
+// The list fingerprint moves when an event's status changes, not only when
+// one is inserted, and only for the filters the event matches.
+func TestEventsFingerprint(t *testing.T) {
+	repo := testRepo(t)
+	registerDevice(t, repo, "kiosk-1")
+	registerDevice(t, repo, "kiosk-2")
+	s := NewService(repo, time.Minute)
+	ctx := context.Background()
+
+	fingerprint := func(deviceID string) (int64, time.Time) {
+		t.Helper()
+		count, last, err := repo.EventsFingerprint(ctx, deviceID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count, last
+	}
+	if count, last := fingerprint(""); count != 0 || !last.IsZero() {
+		t.Errorf("empty table fingerprint = %d, %v", count, last)
+	}
+	evt, err := s.CheckIn(ctx, "emp-1", "kiosk-1", "", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CheckIn(ctx, "emp-2", "kiosk-2", "", "", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	count, inserted := fingerprint("kiosk-1")
+	otherCount, other := fingerprint("kiosk-2")
+	if count != 1 || otherCount != 1 {
+		t.Fatalf("counts per device = %d, %d; want 1, 1", count, otherCount)
+	}
+
+	if err := repo.UpdateEventStatus(ctx, evt.ID, StatusProcessed, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	count, updated := fingerprint("kiosk-1")
+	if count != 1 || !updated.After(inserted) {
+		t.Errorf("after a status update: %d, %v; want 1 and later than %v", count, updated, inserted)
+	}
+	if otherCount, last := fingerprint("kiosk-2"); otherCount != 1 || !last.Equal(other) {
+		t.Errorf("another device's fingerprint moved: %d, %v; want 1, %v", otherCount, last, other)
+	}
+}
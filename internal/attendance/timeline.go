@@ -0,0 +1,196 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"time"
+
+	"attendance/internal/faceaudit"
+)
+
+// ActorWorker is the status-history actor of changes made by the worker.
+const ActorWorker = "worker"
+
+// StatusChange is one status an event moved to, and who moved it.
+type StatusChange struct {
+	ID        int64     `json:"id"`
+	EventID   string    `json:"event_id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// recordStatusChange adds a status-history row inside tx, so the row exists
+// exactly when the change it records does.
+func recordStatusChange(ctx context.Context, tx *sql.Tx, eventID, from, to, actor string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO event_status_history (event_id, old_status, new_status, actor)
+		VALUES ($1, $2, $3, $4)
+	`, eventID, from, to, actor)
+	return err
+}
+
+// ListStatusHistory returns the status changes of an event, oldest first.
+func (r *Repository) ListStatusHistory(ctx context.Context, eventID string) ([]StatusChange, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_id, old_status, new_status, actor, created_at
+		FROM event_status_history
+		WHERE event_id = $1
+		ORDER BY created_at, id
+	`, eventID)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	res := []StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.ID, &c.EventID, &c.OldStatus, &c.NewStatus, &c.Actor, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, storageErr(rows.Err())
+}
+
+// WebhookDelivery is one attempt to deliver an event to the webhook.
+// StatusCode is nil when no answer came back; Error says why the attempt
+// failed.
+type WebhookDelivery struct {
+	ID         int64         `json:"id"`
+	EventID    string        `json:"event_id"`
+	URL        string        `json:"url"`
+	StatusCode *int          `json:"status_code"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"-"`
+	CreatedAt  time.Time     `json:"created_at"`
+}
+
+// MarshalJSON reports the duration in milliseconds, like face audit entries.
+func (d WebhookDelivery) MarshalJSON() ([]byte, error) {
+	type delivery WebhookDelivery
+	return json.Marshal(struct {
+		delivery
+		DurationMS float64 `json:"duration_ms"`
+	}{delivery(d), float64(d.Duration.Microseconds()) / 1000})
+}
+
+// RecordWebhookDelivery stores a delivery attempt. The URL is stored without
+// its query and credentials, which may hold secrets.
+func (r *Repository) RecordWebhookDelivery(ctx context.Context, d WebhookDelivery) error {
+	if u, err := url.Parse(d.URL); err == nil {
+		u.User, u.RawQuery, u.Fragment = nil, "", ""
+		d.URL = u.String()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (event_id, url, status_code, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)
+	`, d.EventID, d.URL, d.StatusCode, d.Error, float64(d.Duration.Microseconds())/1000, d.CreatedAt)
+	return storageErr(err)
+}
+
+// ListWebhookDeliveries returns the webhook delivery attempts of an event,
+// oldest first.
+func (r *Repository) ListWebhookDeliveries(ctx context.Context, eventID string) ([]WebhookDelivery, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_id, url, status_code, COALESCE(error, ''), duration_ms, created_at
+		FROM webhook_deliveries
+		WHERE event_id = $1
+		ORDER BY created_at, id
+	`, eventID)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	res := []WebhookDelivery{}
+	for rows.Next() {
+		var (
+			d  WebhookDelivery
+			ms float64
+		)
+		if err := rows.Scan(&d.ID, &d.EventID, &d.URL, &d.StatusCode, &d.Error, &ms, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		d.Duration = time.Duration(ms * float64(time.Millisecond))
+		res = append(res, d)
+	}
+	return res, storageErr(rows.Err())
+}
+
+// Timeline entry types.
+const (
+	TimelineCreated    = "created"
+	TimelineStatus     = "status"
+	TimelineCorrection = "correction"
+	TimelineFaceCall   = "face_call"
+	TimelineWebhook    = "webhook"
+)
+
+// TimelineEntry is one thing that happened to an event. Data is the record
+// behind it: the event's user, device, time and first status for "created",
+// a StatusChange, a Correction, a face audit entry or a WebhookDelivery.
+type TimelineEntry struct {
+	Type  string    `json:"type"`
+	At    time.Time `json:"at"`
+	Actor string    `json:"actor,omitempty"`
+	Data  any       `json:"data"`
+}
+
+// timelineCreation is the data of the "created" entry.
+type timelineCreation struct {
+	UserID     string    `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Status     string    `json:"status"`
+	AuthMethod string    `json:"auth_method"`
+}
+
+// Timeline merges the records of an event into one list, oldest first.
+// Entries at the same instant keep the order creation, status changes,
+// corrections, face calls, webhook deliveries. The created entry reports the
+// status the event started in, which is the first change's old status when it
+// has since changed.
+func Timeline(evt Event, history []StatusChange, corrections []Correction, faceCalls []faceaudit.Entry, deliveries []WebhookDelivery) []TimelineEntry {
+	initial := evt.Status
+	if len(history) > 0 {
+		initial = history[0].OldStatus
+	}
+	entries := make([]TimelineEntry, 0, 1+len(history)+len(corrections)+len(faceCalls)+len(deliveries))
+	entries = append(entries, TimelineEntry{
+		Type:  TimelineCreated,
+		At:    evt.CreatedAt,
+		Actor: evt.DeviceID,
+		Data: timelineCreation{
+			UserID: evt.UserID, DeviceID: evt.DeviceID, OccurredAt: evt.When, Status: initial, AuthMethod: evt.AuthMethod,
+		},
+	})
+	for _, h := range history {
+		entries = append(entries, TimelineEntry{Type: TimelineStatus, At: h.CreatedAt, Actor: h.Actor, Data: h})
+	}
+	for _, c := range corrections {
+		entries = append(entries, TimelineEntry{Type: TimelineCorrection, At: c.CreatedAt, Actor: c.Actor, Data: c})
+	}
+	for _, f := range faceCalls {
+		entries = append(entries, TimelineEntry{Type: TimelineFaceCall, At: f.CreatedAt, Actor: ActorWorker, Data: f})
+	}
+	for _, d := range deliveries {
+		entries = append(entries, TimelineEntry{Type: TimelineWebhook, At: d.CreatedAt, Actor: ActorWorker, Data: d})
+	}
+	slices.SortStableFunc(entries, func(a, b TimelineEntry) int {
+		return a.At.Compare(b.At)
+	})
+	return entries
+}
@@ -0,0 +1,206 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// UserDirectory tells whether a user id names an employee.
+type UserDirectory interface {
+	Exists(ctx context.Context, userID string) (bool, error)
+}
+
+// employeeSource is where an EmployeeCache looks employees up; the
+// Repository in production.
+type employeeSource interface {
+	EmployeeIDs(ctx context.Context) (map[string]struct{}, error)
+	EmployeeExists(ctx context.Context, employeeID string) (bool, error)
+}
+
+// EmployeeCache is a UserDirectory that keeps every employee id in memory
+// and reloads them after ttl. An id it does not hold is looked up in the
+// database, so employees created since the last load are found at once.
+// Lookups hold no lock while they query: concurrent reloads share one query,
+// and a hit only takes a read lock.
+type EmployeeCache struct {
+	src  employeeSource
+	ttl  time.Duration
+	load singleflight.Group
+
+	mu       sync.RWMutex
+	loadedAt time.Time
+	ids      map[string]struct{}
+	// gen counts Forget calls; a query that started before one does not
+	// store its answer, which may predate the change.
+	gen uint64
+}
+
+// NewEmployeeCache creates a cache; a non-positive ttl defaults to one minute.
+func NewEmployeeCache(repo *Repository, ttl time.Duration) *EmployeeCache {
+	return newEmployeeCache(repo, ttl)
+}
+
+func newEmployeeCache(src employeeSource, ttl time.Duration) *EmployeeCache {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &EmployeeCache{src: src, ttl: ttl}
+}
+
+// Exists reports whether userID is an employee id.
+func (c *EmployeeCache) Exists(ctx context.Context, userID string) (bool, error) {
+	c.mu.RLock()
+	gen := c.gen
+	fresh := c.ids != nil && time.Since(c.loadedAt) <= c.ttl
+	_, ok := c.ids[userID]
+	c.mu.RUnlock()
+	if !fresh {
+		if err := c.reload(ctx); err != nil {
+			return false, err
+		}
+		c.mu.RLock()
+		_, ok = c.ids[userID]
+		gen = c.gen
+		c.mu.RUnlock()
+	}
+	if ok {
+		return true, nil
+	}
+	ok, err := c.src.EmployeeExists(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		c.mu.Lock()
+		if c.ids != nil && c.gen == gen {
+			c.ids[userID] = struct{}{}
+		}
+		c.mu.Unlock()
+	}
+	return ok, nil
+}
+
+// reload loads the employee ids, once for all callers waiting on it. The
+// query outlives a caller that gives up, since the others still wait on it.
+func (c *EmployeeCache) reload(ctx context.Context) error {
+	_, err, _ := c.load.Do("ids", func() (any, error) {
+		c.mu.RLock()
+		gen := c.gen
+		c.mu.RUnlock()
+		ids, err := c.src.EmployeeIDs(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.gen == gen {
+			c.ids, c.loadedAt = ids, time.Now()
+		}
+		c.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+// Forget drops what the cache knows about userID, to be called when an
+// employee is created or erased. Other API instances notice within ttl.
+func (c *EmployeeCache) Forget(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.ids, userID)
+}
+
+// checkUser reports whether userID names no employee. Under StrictUsers such
+// a user is rejected with ErrUnknownUser instead.
+func (s *Service) checkUser(ctx context.Context, userID string) (unknown bool, err error) {
+	if s.Users == nil {
+		return false, nil
+	}
+	ok, err := s.Users.Exists(ctx, userID)
+	if err != nil {
+		return false, storageErr(err)
+	}
+	if !ok && s.StrictUsers {
+		return false, fmt.Errorf("%w: %s is not an employee", ErrUnknownUser, userID)
+	}
+	return !ok, nil
+}
+
+// EmployeeIDs returns the ids of all employees.
+func (r *Repository) EmployeeIDs(ctx context.Context) (map[string]struct{}, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `SELECT employee_id FROM employees`)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	ids := map[string]struct{}{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = struct{}{}
+	}
+	return ids, storageErr(rows.Err())
+}
+
+// EmployeeExists reports whether employeeID is an employee id.
+func (r *Repository) EmployeeExists(ctx context.Context, employeeID string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var ok bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM employees WHERE employee_id = $1)`, employeeID).Scan(&ok)
+	return ok, storageErr(err)
+}
+
+// UnknownUser is a user id that events carry but no employee has.
+type UnknownUser struct {
+	UserID    string    `json:"user_id"`
+	Events    int       `json:"events"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// ListUnknownUsers returns the user ids of events without an employee row,
+// most events first. It looks at the employees as they are now, not at the
+// events' unknown_user flags.
+func (r *Repository) ListUnknownUsers(ctx context.Context, limit, offset int) ([]UnknownUser, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT ev.user_id, COUNT(*), MIN(ev.occurred_at), MAX(ev.occurred_at)
+		FROM attendance_events ev
+		WHERE NOT EXISTS (SELECT 1 FROM employees e WHERE e.employee_id = ev.user_id)
+		GROUP BY ev.user_id
+		ORDER BY COUNT(*) DESC, ev.user_id
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	users := []UnknownUser{}
+	for rows.Next() {
+		var u UnknownUser
+		if err := rows.Scan(&u.UserID, &u.Events, &u.FirstSeen, &u.LastSeen); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, storageErr(rows.Err())
+}
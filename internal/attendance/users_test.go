@@ -0,0 +1,333 @@
+package attendance
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeEmployees is an employeeSource over a set of ids. When release is set,
+// reads take their answer and then block on it, like a query whose answer is
+// on its way while the table changes.
+type fakeEmployees struct {
+	mu      sync.Mutex
+	ids     map[string]struct{}
+	release chan struct{}
+	err     error
+
+	loads   atomic.Int32
+	lookups atomic.Int32
+}
+
+func newFakeEmployees(ids ...string) *fakeEmployees {
+	f := &fakeEmployees{ids: map[string]struct{}{}}
+	for _, id := range ids {
+		f.ids[id] = struct{}{}
+	}
+	return f
+}
+
+func (f *fakeEmployees) set(id string, exists bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if exists {
+		f.ids[id] = struct{}{}
+	} else {
+		delete(f.ids, id)
+	}
+}
+
+func (f *fakeEmployees) EmployeeIDs(ctx context.Context) (map[string]struct{}, error) {
+	f.mu.Lock()
+	ids := make(map[string]struct{}, len(f.ids))
+	for id := range f.ids {
+		ids[id] = struct{}{}
+	}
+	err := f.err
+	f.mu.Unlock()
+	f.loads.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (f *fakeEmployees) EmployeeExists(ctx context.Context, employeeID string) (bool, error) {
+	f.mu.Lock()
+	_, ok := f.ids[employeeID]
+	err := f.err
+	f.mu.Unlock()
+	f.lookups.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	return ok, err
+}
+
+func mustExist(t *testing.T, c *EmployeeCache, userID string, want bool) {
+	t.Helper()
+	got, err := c.Exists(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Exists(%q): %v", userID, err)
+	}
+	if got != want {
+		t.Fatalf("Exists(%q) = %v, want %v", userID, got, want)
+	}
+}
+
+func TestEmployeeCacheLoadsOnceAndCachesHits(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	c := newEmployeeCache(src, time.Hour)
+
+	mustExist(t, c, "emp-1", true)
+	mustExist(t, c, "emp-1", true)
+	if n := src.loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+	if n := src.lookups.Load(); n != 0 {
+		t.Fatalf("lookups = %d, want 0 for cached ids", n)
+	}
+
+	// An employee created after the load is found by the miss lookup and
+	// then cached.
+	src.set("emp-2", true)
+	mustExist(t, c, "emp-2", true)
+	mustExist(t, c, "emp-2", true)
+	if n := src.lookups.Load(); n != 1 {
+		t.Fatalf("lookups = %d, want 1", n)
+	}
+
+	// Unknown ids are not cached: each one is looked up again.
+	mustExist(t, c, "ghost", false)
+	mustExist(t, c, "ghost", false)
+	if n := src.lookups.Load(); n != 3 {
+		t.Fatalf("lookups = %d, want 3", n)
+	}
+}
+
+func TestEmployeeCacheReloadsAfterTTL(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	c := newEmployeeCache(src, time.Hour)
+	mustExist(t, c, "emp-1", true)
+
+	c.mu.Lock()
+	c.loadedAt = time.Now().Add(-2 * time.Hour)
+	c.mu.Unlock()
+	src.set("emp-1", false)
+	mustExist(t, c, "emp-1", false)
+	if n := src.loads.Load(); n != 2 {
+		t.Fatalf("loads = %d, want 2", n)
+	}
+}
+
+func TestEmployeeCacheSharesOneReload(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	src.release = make(chan struct{})
+	c := newEmployeeCache(src, time.Hour)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := c.Exists(context.Background(), "emp-1")
+			if err == nil && !ok {
+				err = errors.New("emp-1 not found")
+			}
+			errs <- err
+		}()
+	}
+	// Let the callers pile up behind the first load before it answers.
+	for src.loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(src.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := src.loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1 shared by %d callers", n, callers)
+	}
+}
+
+// A slow miss lookup must not hold up lookups of cached ids.
+func TestEmployeeCacheMissDoesNotBlockHits(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	c := newEmployeeCache(src, time.Hour)
+	mustExist(t, c, "emp-1", true)
+
+	src.release = make(chan struct{})
+	missDone := make(chan struct{})
+	go func() {
+		defer close(missDone)
+		c.Exists(context.Background(), "ghost")
+	}()
+	defer func() {
+		close(src.release)
+		<-missDone
+	}()
+	for src.lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	hit := make(chan bool)
+	go func() {
+		ok, _ := c.Exists(context.Background(), "emp-1")
+		hit <- ok
+	}()
+	select {
+	case ok := <-hit:
+		if !ok {
+			t.Fatal("cached employee not found")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached lookup waited for a miss lookup")
+	}
+}
+
+func TestEmployeeCacheForget(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	c := newEmployeeCache(src, time.Hour)
+	mustExist(t, c, "emp-1", true)
+
+	// Erased: the cached id is dropped and the database has the last word.
+	src.set("emp-1", false)
+	c.Forget("emp-1")
+	mustExist(t, c, "emp-1", false)
+
+	// Created again: found at once.
+	src.set("emp-1", true)
+	c.Forget("emp-1")
+	mustExist(t, c, "emp-1", true)
+}
+
+// A lookup that started before Forget does not put its stale answer back.
+func TestEmployeeCacheForgetDuringLookup(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	c := newEmployeeCache(src, time.Hour)
+	mustExist(t, c, "ghost", false)
+
+	src.set("emp-2", true)
+	src.release = make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		ok, _ := c.Exists(context.Background(), "emp-2")
+		done <- ok
+	}()
+	for src.lookups.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	src.set("emp-2", false)
+	c.Forget("emp-2")
+	close(src.release)
+	if !<-done {
+		t.Fatal("lookup before the erasure did not find emp-2")
+	}
+
+	src.release = nil
+	mustExist(t, c, "emp-2", false)
+}
+
+func TestEmployeeCacheLoadError(t *testing.T) {
+	src := newFakeEmployees("emp-1")
+	src.err = errors.New("connection refused")
+	c := newEmployeeCache(src, time.Hour)
+	if _, err := c.Exists(context.Background(), "emp-1"); err == nil {
+		t.Fatal("Exists succeeded with the employee source down")
+	}
+	src.err = nil
+	mustExist(t, c, "emp-1", true)
+}
+
+// staticUsers is a UserDirectory over a fixed set of ids.
+type staticUsers map[string]bool
+
+func (u staticUsers) Exists(ctx context.Context, userID string) (bool, error) {
+	if u == nil {
+		return false, errors.New("directory down")
+	}
+	return u[userID], nil
+}
+
+func TestCheckUser(t *testing.T) {
+	users := staticUsers{"emp-1": true}
+	tests := []struct {
+		name        string
+		users       UserDirectory
+		strict      bool
+		userID      string
+		wantUnknown bool
+		wantErr     error
+	}{
+		{name: "flag mode, employee", users: users, userID: "emp-1"},
+		{name: "flag mode, unknown user", users: users, userID: "ghost", wantUnknown: true},
+		{name: "reject mode, employee", users: users, strict: true, userID: "emp-1"},
+		{name: "reject mode, unknown user", users: users, strict: true, userID: "ghost", wantErr: ErrUnknownUser},
+		{name: "no directory", userID: "ghost"},
+		{name: "no directory, reject mode", strict: true, userID: "ghost"},
+		{name: "directory down", users: staticUsers(nil), userID: "emp-1", wantErr: ErrStorage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{Users: tt.users, StrictUsers: tt.strict}
+			unknown, err := s.checkUser(context.Background(), tt.userID)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("checkUser err = %v, want %v", err, tt.wantErr)
+			}
+			if unknown != tt.wantUnknown {
+				t.Fatalf("checkUser unknown = %v, want %v", unknown, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestCheckInUnknownUserModes(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	registerDevice(t, repo, "kiosk-1")
+	addEmployee(t, repo, "emp-1")
+
+	t.Run("flag", func(t *testing.T) {
+		s := NewService(repo, time.Minute)
+		evt, err := s.CheckIn(ctx, "emp-1", "kiosk-1", "", "", time.Time{})
+		if err != nil || evt.UnknownUser {
+			t.Fatalf("employee check-in = unknown %v, %v; want a known user", evt.UnknownUser, err)
+		}
+		evt, err = s.CheckIn(ctx, "ghost-flag", "kiosk-1", "", "", time.Time{})
+		if err != nil {
+			t.Fatalf("unknown user check-in: %v", err)
+		}
+		if !evt.UnknownUser {
+			t.Fatal("unknown user check-in not flagged")
+		}
+		stored, err := repo.GetEvent(ctx, evt.ID)
+		if err != nil || !stored.UnknownUser {
+			t.Fatalf("stored event unknown_user = %v, %v; want true", stored.UnknownUser, err)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		s := NewService(repo, time.Minute)
+		s.StrictUsers = true
+		if _, err := s.CheckIn(ctx, "ghost-strict", "kiosk-1", "", "", time.Time{}); !errors.Is(err, ErrUnknownUser) {
+			t.Fatalf("unknown user check-in err = %v, want ErrUnknownUser", err)
+		}
+		events, err := repo.ListEvents(ctx, "", "ghost-strict", 10, 0)
+		if err != nil || len(events) != 0 {
+			t.Fatalf("events stored for a rejected user = %d, %v; want 0", len(events), err)
+		}
+	})
+}
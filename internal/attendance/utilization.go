@@ -0,0 +1,236 @@
+package attendance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Utilization report granularities.
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+	GranularityWeek = "week"
+)
+
+// MaxUtilizationDays bounds a utilization report's range; hourly reports are
+// limited to MaxHourlyUtilizationDays so charts stay readable.
+const (
+	MaxUtilizationDays       = 366
+	MaxHourlyUtilizationDays = 31
+)
+
+// DeviceHourCount is a device's processed check-ins in one hour. Hour is the
+// wall-clock start of the hour in the report's time zone, stored as UTC.
+type DeviceHourCount struct {
+	DeviceID string
+	Hour     time.Time
+	Count    int
+}
+
+// DeviceHourlyCounts counts processed check-ins per device and wall-clock hour
+// in loc over [from, to), counting only the employees in the department scope
+// of ctx.
+func (r *Repository) DeviceHourlyCounts(ctx context.Context, from, to time.Time, loc *time.Location) ([]DeviceHourCount, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	scope, scopeArg := scopeFilter(ctx, "user_id", 4)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT device_id, date_trunc('hour', occurred_at AT TIME ZONE $3) AS hour, COUNT(*)
+		FROM attendance_events
+		WHERE status = 'processed' AND occurred_at >= $1 AND occurred_at < $2 AND `+scope+`
+		GROUP BY device_id, hour
+		ORDER BY device_id, hour
+	`, from, to, loc.String(), scopeArg)
+	if err != nil {
+		return nil, storageErr(err)
+	}
+	defer rows.Close()
+	counts := []DeviceHourCount{}
+	for rows.Next() {
+		var c DeviceHourCount
+		if err := rows.Scan(&c.DeviceID, &c.Hour, &c.Count); err != nil {
+			return nil, err
+		}
+		c.Hour = c.Hour.UTC()
+		counts = append(counts, c)
+	}
+	return counts, storageErr(rows.Err())
+}
+
+// ChartSeries is one device's values, aligned with the chart's labels.
+type ChartSeries struct {
+	DeviceID string `json:"device_id"`
+	Data     []int  `json:"data"`
+}
+
+// Chart is a labels-plus-series shape chart libraries take directly.
+type Chart struct {
+	Labels []string      `json:"labels"`
+	Series []ChartSeries `json:"series"`
+}
+
+// DeviceUsage summarizes one device over the report range.
+type DeviceUsage struct {
+	DeviceID string `json:"device_id"`
+	Total    int    `json:"total"`
+	// BusiestDay is the local date with the most check-ins, earliest on ties.
+	BusiestDay      string `json:"busiest_day"`
+	BusiestDayCount int    `json:"busiest_day_count"`
+	// PeakHour is the hour of day (0-23) with the most check-ins.
+	PeakHour      int `json:"peak_hour"`
+	PeakHourCount int `json:"peak_hour_count"`
+}
+
+// DeviceUtilization is the device utilization report: check-ins over time
+// per device, an hour-of-day histogram, and per-device summaries busiest
+// first.
+type DeviceUtilization struct {
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	Timezone    string        `json:"timezone,omitempty"`
+	Granularity string        `json:"granularity"`
+	Timeline    Chart         `json:"timeline"`
+	HourOfDay   Chart         `json:"hour_of_day"`
+	Devices     []DeviceUsage `json:"devices"`
+}
+
+// bucketStart truncates a wall-clock time to the start of its bucket; weeks
+// start on Monday.
+func bucketStart(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return t.Truncate(time.Hour)
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func bucketNext(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return t.Add(time.Hour)
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func bucketLabel(t time.Time, granularity string) string {
+	if granularity == GranularityHour {
+		return t.Format("2006-01-02T15:00")
+	}
+	return t.Format(time.DateOnly)
+}
+
+// BuildDeviceUtilization turns hourly counts into the report for the local
+// days firstDay through lastDay (wall-clock midnights, as UTC). Every bucket
+// in the range gets a label, with zeros where nothing happened.
+func BuildDeviceUtilization(counts []DeviceHourCount, firstDay, lastDay time.Time, granularity string) DeviceUtilization {
+	rep := DeviceUtilization{
+		From:        firstDay.Format(time.DateOnly),
+		To:          lastDay.Format(time.DateOnly),
+		Granularity: granularity,
+		Devices:     []DeviceUsage{},
+	}
+
+	index := map[string]int{}
+	end := lastDay.AddDate(0, 0, 1)
+	for b := bucketStart(firstDay, granularity); b.Before(end); b = bucketNext(b, granularity) {
+		index[bucketLabel(b, granularity)] = len(rep.Timeline.Labels)
+		rep.Timeline.Labels = append(rep.Timeline.Labels, bucketLabel(b, granularity))
+	}
+	for h := 0; h < 24; h++ {
+		rep.HourOfDay.Labels = append(rep.HourOfDay.Labels, fmt.Sprintf("%02d", h))
+	}
+	rep.Timeline.Series = []ChartSeries{}
+	rep.HourOfDay.Series = []ChartSeries{}
+
+	type acc struct {
+		timeline []int
+		hours    []int
+		days     map[string]int
+		total    int
+	}
+	devices := map[string]*acc{}
+	var order []string
+	for _, c := range counts {
+		a, ok := devices[c.DeviceID]
+		if !ok {
+			a = &acc{timeline: make([]int, len(rep.Timeline.Labels)), hours: make([]int, 24), days: map[string]int{}}
+			devices[c.DeviceID] = a
+			order = append(order, c.DeviceID)
+		}
+		if i, ok := index[bucketLabel(bucketStart(c.Hour, granularity), granularity)]; ok {
+			a.timeline[i] += c.Count
+		}
+		a.hours[c.Hour.Hour()] += c.Count
+		a.days[c.Hour.Format(time.DateOnly)] += c.Count
+		a.total += c.Count
+	}
+	sort.Strings(order)
+
+	for _, id := range order {
+		a := devices[id]
+		rep.Timeline.Series = append(rep.Timeline.Series, ChartSeries{DeviceID: id, Data: a.timeline})
+		rep.HourOfDay.Series = append(rep.HourOfDay.Series, ChartSeries{DeviceID: id, Data: a.hours})
+		u := DeviceUsage{DeviceID: id, Total: a.total}
+		for day, n := range a.days {
+			if n > u.BusiestDayCount || (n == u.BusiestDayCount && day < u.BusiestDay) {
+				u.BusiestDay, u.BusiestDayCount = day, n
+			}
+		}
+		for h, n := range a.hours {
+			if n > u.PeakHourCount {
+				u.PeakHour, u.PeakHourCount = h, n
+			}
+		}
+		rep.Devices = append(rep.Devices, u)
+	}
+	sort.SliceStable(rep.Devices, func(i, j int) bool { return rep.Devices[i].Total > rep.Devices[j].Total })
+	return rep
+}
+
+// ParseUtilizationRange parses a report's from and to dates (YYYY-MM-DD,
+// both inclusive) in loc and checks granularity against the range length.
+// Empty dates default to the seven days ending today. It returns the query
+// bounds and the first and last days as wall-clock midnights.
+func ParseUtilizationRange(fromStr, toStr, granularity string, loc *time.Location, now time.Time) (from, to, firstDay, lastDay time.Time, err error) {
+	switch granularity {
+	case GranularityHour, GranularityDay, GranularityWeek:
+	default:
+		return from, to, firstDay, lastDay, fmt.Errorf("%w: granularity must be hour, day or week", ErrValidation)
+	}
+	today, _ := DayBounds(now, loc)
+	start, end := today.AddDate(0, 0, -6), today
+	if fromStr != "" {
+		if start, _, err = ParseDay(fromStr, loc); err != nil {
+			return from, to, firstDay, lastDay, err
+		}
+	}
+	if toStr != "" {
+		if end, _, err = ParseDay(toStr, loc); err != nil {
+			return from, to, firstDay, lastDay, err
+		}
+	}
+	firstDay = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	lastDay = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(lastDay.Sub(firstDay).Hours()/24) + 1
+	limit := MaxUtilizationDays
+	if granularity == GranularityHour {
+		limit = MaxHourlyUtilizationDays
+	}
+	switch {
+	case days < 1:
+		return from, to, firstDay, lastDay, fmt.Errorf("%w: from is after to", ErrValidation)
+	case days > limit:
+		return from, to, firstDay, lastDay, fmt.Errorf("%w: at most %d days with granularity %s", ErrValidation, limit, granularity)
+	}
+	_, to = DayBounds(end, loc)
+	return start, to, firstDay, lastDay, nil
+}
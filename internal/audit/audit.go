@@ -0,0 +1,194 @@
+// Package audit records administrative actions without slowing down the request path.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var droppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "audit_entries_dropped_total",
+	Help: "Audit entries dropped because the write buffer was full.",
+})
+
+// Entry is a single audited action.
+type Entry struct {
+	ID         string         `json:"id"`
+	Actor      string         `json:"actor"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetID   string         `json:"target_id"`
+	Detail     map[string]any `json:"detail,omitempty"`
+	IP         string         `json:"ip"`
+	RequestID  string         `json:"request_id"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// Filter narrows List results. Zero values are ignored.
+type Filter struct {
+	Actor  string
+	Action string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// Logger writes audit entries asynchronously through a bounded buffer.
+type Logger struct {
+	db      *sql.DB
+	entries chan Entry
+	wg      sync.WaitGroup
+}
+
+// NewLogger starts the background writer. buffer bounds the number of pending entries.
+func NewLogger(db *sql.DB, buffer int) *Logger {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	l := &Logger{db: db, entries: make(chan Entry, buffer)}
+	l.wg.Add(1)
+	go l.run()
+	return l
+}
+
+// Record queues an audit entry. It never blocks or fails the caller; when the
+// buffer is full the entry is dropped and counted.
+func (l *Logger) Record(ctx context.Context, actor, action, targetType, targetID string, detail map[string]any) {
+	if l == nil {
+		return
+	}
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	e := Entry{
+		Actor:      actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     detail,
+		IP:         info.ip,
+		RequestID:  info.requestID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	select {
+	case l.entries <- e:
+	default:
+		droppedTotal.Inc()
+		log.Printf("audit: buffer full, dropped %s by %s on %s/%s", action, actor, targetType, targetID)
+	}
+}
+
+// Close stops accepting entries and waits for pending ones to be written.
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	close(l.entries)
+	l.wg.Wait()
+}
+
+func (l *Logger) run() {
+	defer l.wg.Done()
+	for e := range l.entries {
+		if err := l.write(e); err != nil {
+			log.Printf("audit: write %s by %s failed: %v", e.Action, e.Actor, err)
+		}
+	}
+}
+
+func (l *Logger) write(e Entry) error {
+	var detail []byte
+	if e.Detail != nil {
+		b, err := json.Marshal(e.Detail)
+		if err != nil {
+			return err
+		}
+		detail = b
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, action, target_type, target_id, detail, ip, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.Actor, e.Action, e.TargetType, e.TargetID, detail, e.IP, e.RequestID, e.CreatedAt)
+	return err
+}
+
+// List returns audit entries matching the filter, newest first.
+func (l *Logger) List(ctx context.Context, f Filter) ([]Entry, error) {
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	query := `SELECT id, actor, action, target_type, target_id, detail, ip, request_id, created_at FROM audit_log`
+	var clauses []string
+	var args []any
+	add := func(clause string, v any) {
+		args = append(args, v)
+		clauses = append(clauses, fmt.Sprintf(clause, len(args)))
+	}
+	if f.Actor != "" {
+		add("actor = $%d", f.Actor)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := l.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var detail []byte
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &detail, &e.IP, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(detail) > 0 {
+			_ = json.Unmarshal(detail, &e.Detail)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+type requestInfoKey struct{}
+
+type requestInfo struct {
+	ip        string
+	requestID string
+}
+
+// Middleware attaches the client IP and request id to the request context so
+// Record can capture them.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := requestInfo{ip: c.ClientIP(), requestID: c.GetString("request_id")}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestInfoKey{}, info))
+		c.Next()
+	}
+}
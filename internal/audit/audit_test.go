@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"attendance/internal/httpmiddleware"
+	"attendance/internal/testdb"
+)
+
+// An entry recorded during a request carries the client IP and request id.
+func TestRecordCapturesRequest(t *testing.T) {
+	l := &Logger{entries: make(chan Entry, 1)} // no writer; entries stay queued
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.DELETE("/devices/:id", httpmiddleware.RequestID(), Middleware(), func(c *gin.Context) {
+		l.Record(c.Request.Context(), "admin-1", "device.delete", "device", c.Param("id"), map[string]any{"reason": "stolen"})
+		c.Status(http.StatusNoContent)
+	})
+	req := httptest.NewRequest(http.MethodDelete, "/devices/kiosk-1", nil)
+	req.RemoteAddr = "203.0.113.7:51000"
+	req.Header.Set(httpmiddleware.RequestIDHeader, "req-42")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case e := <-l.entries:
+		if e.Actor != "admin-1" || e.Action != "device.delete" || e.TargetType != "device" || e.TargetID != "kiosk-1" ||
+			e.IP != "203.0.113.7" || e.RequestID != "req-42" || e.Detail["reason"] != "stolen" || time.Since(e.CreatedAt) > time.Minute {
+			t.Errorf("entry = %+v", e)
+		}
+	default:
+		t.Fatal("nothing recorded")
+	}
+}
+
+// Record never blocks: past the buffer, entries are dropped and counted.
+func TestRecordDropsWhenFull(t *testing.T) {
+	l := &Logger{entries: make(chan Entry, 1)}
+	dropped := testutil.ToFloat64(droppedTotal)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 3 {
+			l.Record(context.Background(), "admin-1", "settings.update", "setting", "x", nil)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record blocked on a full buffer")
+	}
+	if d := testutil.ToFloat64(droppedTotal) - dropped; d != 2 {
+		t.Errorf("dropped counter rose by %v, want 2", d)
+	}
+
+	var nilLogger *Logger
+	nilLogger.Record(context.Background(), "admin-1", "settings.update", "setting", "x", nil)
+	nilLogger.Close()
+}
+
+// A failed write is logged and the writer goes on with the next entry;
+// Close waits for every queued entry.
+func TestLoggerWrites(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	insert := regexp.QuoteMeta("INSERT INTO audit_log")
+	mock.ExpectExec(insert).
+		WithArgs("admin-1", "device.delete", "device", "kiosk-1", []byte(`{"reason":"stolen"}`), "", "", sqlmock.AnyArg()).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec(insert).
+		WithArgs("admin-1", "device.update", "device", "kiosk-2", sqlmock.AnyArg(), "", "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	l := NewLogger(db, 4)
+	l.Record(context.Background(), "admin-1", "device.delete", "device", "kiosk-1", map[string]any{"reason": "stolen"})
+	l.Record(context.Background(), "admin-1", "device.update", "device", "kiosk-2", nil)
+	l.Close()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListBuildsFilters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	from := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	at := from.Add(9 * time.Hour)
+	cols := []string{"id", "actor", "action", "target_type", "target_id", "detail", "ip", "request_id", "created_at"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log WHERE actor = $1 AND action = $2 AND created_at >= $3 AND created_at < $4 ORDER BY created_at DESC LIMIT $5 OFFSET $6")).
+		WithArgs("admin-1", "device.delete", from, from.AddDate(0, 0, 1), 50, 0).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow("a-1", "admin-1", "device.delete", "device", "kiosk-1", []byte(`{"reason":"stolen"}`), "203.0.113.7", "req-42", at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log ORDER BY created_at DESC LIMIT $1 OFFSET $2")).
+		WithArgs(10, 0).
+		WillReturnRows(sqlmock.NewRows(cols))
+
+	l := &Logger{db: db}
+	entries, err := l.List(context.Background(), Filter{Actor: "admin-1", Action: "device.delete", From: from, To: from.AddDate(0, 0, 1), Limit: 1000, Offset: -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "a-1" || entries[0].Detail["reason"] != "stolen" || !entries[0].CreatedAt.Equal(at) {
+		t.Errorf("entries = %+v", entries)
+	}
+	entries, err = l.List(context.Background(), Filter{Limit: 10})
+	if err != nil || entries == nil || len(entries) != 0 {
+		t.Errorf("List without matches = %#v, %v; want an empty list", entries, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoggerRoundTrip(t *testing.T) {
+	db := testdb.Open(t)
+	l := NewLogger(db, 8)
+	ctx := context.Background()
+	for _, e := range []Entry{
+		{Actor: "admin-1", Action: "device.delete", TargetType: "device", TargetID: "kiosk-1", Detail: map[string]any{"reason": "stolen"}},
+		{Actor: "admin-2", Action: "device.delete", TargetType: "device", TargetID: "kiosk-2"},
+		{Actor: "admin-1", Action: "settings.update", TargetType: "setting", TargetID: "dedup_window", Detail: map[string]any{"value": "2m"}},
+	} {
+		l.Record(ctx, e.Actor, e.Action, e.TargetType, e.TargetID, e.Detail)
+		time.Sleep(time.Millisecond) // apart in Postgres' microsecond timestamps
+	}
+	l.Close()
+
+	all, err := l.List(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Action != "settings.update" || all[2].TargetID != "kiosk-1" {
+		t.Fatalf("entries = %+v, want all three newest first", all)
+	}
+	if all[0].Detail["value"] != "2m" || all[1].Detail != nil || all[0].ID == "" {
+		t.Errorf("entries = %+v", all)
+	}
+
+	tests := []struct {
+		name string
+		f    Filter
+		want []string
+	}{
+		{"by actor", Filter{Actor: "admin-1"}, []string{"dedup_window", "kiosk-1"}},
+		{"by action", Filter{Action: "device.delete"}, []string{"kiosk-2", "kiosk-1"}},
+		{"page", Filter{Limit: 1, Offset: 1}, []string{"kiosk-2"}},
+		{"from", Filter{From: all[0].CreatedAt}, []string{"dedup_window"}},
+		{"to", Filter{To: all[2].CreatedAt}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.List(ctx, tt.f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.TargetID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("targets %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("targets %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
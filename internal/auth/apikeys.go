@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// API key scopes. admin includes write, and write includes read.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// keyPrefix marks API keys so they are recognisable in configs and logs.
+const keyPrefix = "ak_"
+
+var (
+	// ErrInvalidAPIKey means the key is unknown, revoked or expired.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyNotFound means no key has the given id.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrAPIKeySpec means a key was requested with an unknown role or scope.
+	ErrAPIKeySpec = errors.New("invalid api key spec")
+)
+
+// apiKeyRoles are the roles a key may carry.
+var apiKeyRoles = []string{"admin", "integration"}
+
+// APIKey describes a key. The key itself is only returned by Create and
+// Rotate; the table keeps its SHA-256 hash.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Role       string     `json:"role"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Key is the plaintext key, set only when the key is created.
+	Key string `json:"key,omitempty"`
+}
+
+// NewAPIKey is what Create needs to issue a key.
+type NewAPIKey struct {
+	Name   string
+	Role   string
+	Scopes []string
+	// TTL is how long the key is valid; 0 never expires.
+	TTL       time.Duration
+	CreatedBy string
+}
+
+// APIKeys stores API keys for server-to-server callers.
+type APIKeys struct {
+	db *sql.DB
+	// touchEvery limits how often last_used_at is written for a busy key.
+	touchEvery time.Duration
+}
+
+// NewAPIKeys returns the key store backed by db.
+func NewAPIKeys(db *sql.DB) *APIKeys {
+	return &APIKeys{db: db, touchEvery: time.Minute}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return keyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func validateSpec(k NewAPIKey) error {
+	if k.Name == "" {
+		return fmt.Errorf("%w: name required", ErrAPIKeySpec)
+	}
+	if !slices.Contains(apiKeyRoles, k.Role) {
+		return fmt.Errorf("%w: role must be one of %v", ErrAPIKeySpec, apiKeyRoles)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope required", ErrAPIKeySpec)
+	}
+	for _, s := range k.Scopes {
+		if s != ScopeRead && s != ScopeWrite && s != ScopeAdmin {
+			return fmt.Errorf("%w: unknown scope %q", ErrAPIKeySpec, s)
+		}
+	}
+	if slices.Contains(k.Scopes, ScopeAdmin) && k.Role != "admin" {
+		return fmt.Errorf("%w: the admin scope needs the admin role", ErrAPIKeySpec)
+	}
+	if k.TTL < 0 {
+		return fmt.Errorf("%w: expiry must not be negative", ErrAPIKeySpec)
+	}
+	return nil
+}
+
+type execQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertAPIKey(ctx context.Context, q execQuerier, k NewAPIKey) (APIKey, error) {
+	key, err := generateAPIKey()
+	if err != nil {
+		return APIKey{}, err
+	}
+	out := APIKey{
+		Name:      k.Name,
+		Prefix:    key[:len(keyPrefix)+6],
+		Role:      k.Role,
+		Scopes:    k.Scopes,
+		CreatedBy: k.CreatedBy,
+		Key:       key,
+	}
+	var expires *time.Time
+	if k.TTL > 0 {
+		t := time.Now().UTC().Add(k.TTL)
+		expires = &t
+	}
+	err = q.QueryRowContext(ctx, `
+		INSERT INTO api_keys (key_hash, prefix, name, role, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+		RETURNING id, created_at, expires_at
+	`, hashAPIKey(key), out.Prefix, k.Name, k.Role, k.Scopes, k.CreatedBy, expires).Scan(&out.ID, &out.CreatedAt, &out.ExpiresAt)
+	return out, err
+}
+
+// Create issues a key. The returned APIKey carries the plaintext Key, which
+// cannot be recovered later.
+func (s *APIKeys) Create(ctx context.Context, k NewAPIKey) (APIKey, error) {
+	if err := validateSpec(k); err != nil {
+		return APIKey{}, err
+	}
+	return insertAPIKey(ctx, s.db, k)
+}
+
+// List returns all keys, newest first.
+func (s *APIKeys) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, prefix, role, scopes, COALESCE(created_by, ''), created_at, expires_at, last_used_at, revoked_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	m := pgtype.NewMap()
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, m.SQLScanner(&k.Scopes), &k.CreatedBy,
+			&k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke disables a key. Revoking a revoked key is a no-op.
+func (s *APIKeys) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Rotate issues a new key with the same name, role and scopes as key id, and
+// with its lifetime if it had one, then revokes id. Both happen in one
+// transaction, so the caller never ends up with neither or both.
+func (s *APIKeys) Rotate(ctx context.Context, id, actor string) (APIKey, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return APIKey{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		spec    = NewAPIKey{CreatedBy: actor}
+		created time.Time
+		expires *time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING name, role, scopes, created_at, expires_at
+	`, id).Scan(&spec.Name, &spec.Role, pgtype.NewMap().SQLScanner(&spec.Scopes), &created, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, fmt.Errorf("%w: %s (or already revoked)", ErrAPIKeyNotFound, id)
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	if expires != nil {
+		spec.TTL = expires.Sub(created)
+	}
+	k, err := insertAPIKey(ctx, tx, spec)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET rotated_to = $2 WHERE id = $1`, id, k.ID); err != nil {
+		return APIKey{}, err
+	}
+	return k, tx.Commit()
+}
+
+// VerifyAPIKey returns the claims of an active key. Unknown, revoked and
+// expired keys all return ErrInvalidAPIKey.
+func (s *APIKeys) VerifyAPIKey(ctx context.Context, key string) (Claims, error) {
+	var (
+		id, name, role string
+		scopes         []string
+		lastUsed       *time.Time
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, role, scopes, last_used_at FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+	`, hashAPIKey(key)).Scan(&id, &name, &role, pgtype.NewMap().SQLScanner(&scopes), &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Claims{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Claims{}, err
+	}
+	if lastUsed == nil || time.Since(*lastUsed) > s.touchEvery {
+		// Best effort: a failed write only leaves last_used_at stale.
+		_, _ = s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`, id)
+	}
+	c := Claims{Subject: "apikey:" + name, Role: role, Scopes: scopes, apiKey: true}
+	c.ID = id
+	return c, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"attendance/internal/testdb"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		scopes []string
+		apiKey bool
+		scope  string
+		want   bool
+	}{
+		{nil, false, ScopeAdmin, true},
+		{[]string{ScopeRead}, true, ScopeRead, true},
+		{[]string{ScopeRead}, true, ScopeWrite, false},
+		{[]string{ScopeWrite}, true, ScopeRead, true},
+		{[]string{ScopeWrite}, true, ScopeAdmin, false},
+		{[]string{ScopeAdmin}, true, ScopeWrite, true},
+		{[]string{ScopeAdmin}, true, ScopeRead, true},
+		{nil, true, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		c := Claims{Scopes: tt.scopes, apiKey: tt.apiKey}
+		if got := c.HasScope(tt.scope); got != tt.want {
+			t.Errorf("%v (api key %v) HasScope(%s) = %v, want %v", tt.scopes, tt.apiKey, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	valid := NewAPIKey{Name: "payroll", Role: "integration", Scopes: []string{ScopeRead}}
+	tests := []struct {
+		name    string
+		change  func(*NewAPIKey)
+		wantErr string
+	}{
+		{"valid", func(*NewAPIKey) {}, ""},
+		{"admin key", func(k *NewAPIKey) { k.Role, k.Scopes = "admin", []string{ScopeAdmin} }, ""},
+		{"no name", func(k *NewAPIKey) { k.Name = "" }, "name required"},
+		{"device role", func(k *NewAPIKey) { k.Role = "device" }, "role must be one of"},
+		{"no scopes", func(k *NewAPIKey) { k.Scopes = nil }, "at least one scope"},
+		{"unknown scope", func(k *NewAPIKey) { k.Scopes = []string{"delete"} }, `unknown scope "delete"`},
+		{"admin scope without the role", func(k *NewAPIKey) { k.Scopes = []string{ScopeAdmin} }, "needs the admin role"},
+		{"negative expiry", func(k *NewAPIKey) { k.TTL = -time.Hour }, "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := valid
+			tt.change(&k)
+			err := validateSpec(k)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSpec = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAPIKeySpec) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSpec = %v, want ErrAPIKeySpec saying %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	a, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := generateAPIKey()
+	if !strings.HasPrefix(a, keyPrefix) || len(a) != len(keyPrefix)+43 || a == b {
+		t.Errorf("generated %q and %q", a, b)
+	}
+	if hashAPIKey(a) == hashAPIKey(b) || len(hashAPIKey(a)) != 64 {
+		t.Errorf("hashes %s, %s", hashAPIKey(a), hashAPIKey(b))
+	}
+}
+
+// A key verifies until it is revoked, rotated or expired; rotation hands
+// out a key with the same name, role, scopes and lifetime.
+func TestAPIKeysLifecycle(t *testing.T) {
+	s := NewAPIKeys(testdb.Open(t))
+	ctx := context.Background()
+
+	k, err := s.Create(ctx, NewAPIKey{Name: "payroll", Role: "integration", Scopes: []string{ScopeRead, ScopeWrite}, TTL: 24 * time.Hour, CreatedBy: "admin-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.ID == "" || !strings.HasPrefix(k.Key, k.Prefix) || k.ExpiresAt == nil {
+		t.Fatalf("created %+v", k)
+	}
+	c, err := s.VerifyAPIKey(ctx, k.Key)
+	if err != nil || c.Subject != "apikey:payroll" || c.Role != "integration" || c.ID != k.ID || !c.HasScope(ScopeWrite) || c.HasScope(ScopeAdmin) {
+		t.Fatalf("VerifyAPIKey = %+v, %v", c, err)
+	}
+	if _, err := s.VerifyAPIKey(ctx, k.Key+"x"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("VerifyAPIKey of another key = %v, want ErrInvalidAPIKey", err)
+	}
+
+	rotated, err := s.Rotate(ctx, k.ID, "admin-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Key == k.Key || rotated.Name != "payroll" || rotated.ExpiresAt == nil || rotated.ExpiresAt.Sub(*k.ExpiresAt) < 0 {
+		t.Errorf("rotated to %+v", rotated)
+	}
+	if _, err := s.VerifyAPIKey(ctx, k.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("rotated-out key verifies: %v", err)
+	}
+	if _, err := s.Rotate(ctx, k.ID, "admin-2"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("second Rotate = %v, want ErrAPIKeyNotFound", err)
+	}
+	if _, err := s.VerifyAPIKey(ctx, rotated.Key); err != nil {
+		t.Errorf("rotated key: %v", err)
+	}
+
+	if err := s.Revoke(ctx, rotated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, rotated.ID); err != nil {
+		t.Errorf("second Revoke = %v, want a no-op", err)
+	}
+	if _, err := s.VerifyAPIKey(ctx, rotated.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key verifies: %v", err)
+	}
+	if err := s.Revoke(ctx, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("Revoke of an unknown id = %v", err)
+	}
+
+	keys, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != rotated.ID || keys[0].RevokedAt == nil || keys[1].CreatedBy != "admin-1" || keys[0].Key != "" || len(keys[1].Scopes) != 2 {
+		t.Errorf("listed %+v", keys)
+	}
+}
+
+func TestAPIKeysExpire(t *testing.T) {
+	s := NewAPIKeys(testdb.Open(t))
+	ctx := context.Background()
+	k, err := s.Create(ctx, NewAPIKey{Name: "short", Role: "integration", Scopes: []string{ScopeRead}, TTL: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := s.VerifyAPIKey(ctx, k.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expired key verifies: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const denylistPrefix = "attendance:auth:denied:"
+
+// Denylist blocks every bearer token of a subject before it expires, such as
+// a deactivated kiosk's. An entry only has to outlive the access tokens
+// issued before it, so it expires after the access TTL; refresh tokens are
+// revoked in the database instead.
+type Denylist struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewDenylist returns a denylist stored in client whose entries last ttl. It
+// returns nil when client is nil or ttl is not positive; a nil *Denylist is
+// safe to use and denies nothing.
+func NewDenylist(client *redis.Client, ttl time.Duration) *Denylist {
+	if client == nil || ttl <= 0 {
+		return nil
+	}
+	return &Denylist{client: client, ttl: ttl}
+}
+
+func denylistKey(role, subject string) string {
+	return denylistPrefix + role + ":" + subject
+}
+
+// Deny blocks the tokens of subject with role.
+func (d *Denylist) Deny(ctx context.Context, role, subject string) error {
+	if d == nil {
+		return nil
+	}
+	return d.client.Set(ctx, denylistKey(role, subject), time.Now().UTC().Format(time.RFC3339), d.ttl).Err()
+}
+
+// Allow lifts a block, e.g. when a deactivated device is provisioned again
+// and gets new tokens.
+func (d *Denylist) Allow(ctx context.Context, role, subject string) error {
+	if d == nil {
+		return nil
+	}
+	return d.client.Del(ctx, denylistKey(role, subject)).Err()
+}
+
+// Denied reports whether the tokens of subject with role are blocked.
+func (d *Denylist) Denied(ctx context.Context, role, subject string) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	n, err := d.client.Exists(ctx, denylistKey(role, subject)).Result()
+	return n > 0, err
+}
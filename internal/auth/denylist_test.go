@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
+
+// A denied subject is blocked for its role only, until Allow or the access
+// TTL runs out.
+func TestDenylist(t *testing.T) {
+	client, mr := newTestRedis(t)
+	d := NewDenylist(client, 15*time.Minute)
+	ctx := context.Background()
+	denied := func(role, subject string) bool {
+		t.Helper()
+		ok, err := d.Denied(ctx, role, subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if err := d.Deny(ctx, "device", "kiosk-1"); err != nil {
+		t.Fatal(err)
+	}
+	if !denied("device", "kiosk-1") || denied("admin", "kiosk-1") || denied("device", "kiosk-2") {
+		t.Error("deny did not block exactly device kiosk-1")
+	}
+	if err := d.Allow(ctx, "device", "kiosk-1"); err != nil {
+		t.Fatal(err)
+	}
+	if denied("device", "kiosk-1") {
+		t.Error("still denied after Allow")
+	}
+
+	d.Deny(ctx, "device", "kiosk-1")
+	mr.FastForward(15 * time.Minute)
+	if denied("device", "kiosk-1") {
+		t.Error("still denied after the access TTL")
+	}
+}
+
+func TestDenylistDisabled(t *testing.T) {
+	client, _ := newTestRedis(t)
+	for name, d := range map[string]*Denylist{
+		"no client": NewDenylist(nil, time.Minute),
+		"zero TTL":  NewDenylist(client, 0),
+	} {
+		if d != nil {
+			t.Errorf("%s: NewDenylist = %v, want nil", name, d)
+		}
+		if err := d.Deny(context.Background(), "device", "kiosk-1"); err != nil {
+			t.Errorf("%s: Deny = %v", name, err)
+		}
+		if ok, err := d.Denied(context.Background(), "device", "kiosk-1"); ok || err != nil {
+			t.Errorf("%s: Denied = %v, %v", name, ok, err)
+		}
+	}
+}
+
+// Tokens of a denied subject are refused; when Redis is down they are let
+// through rather than locking everyone out.
+func TestAuthenticateDenied(t *testing.T) {
+	client, mr := newTestRedis(t)
+	d := NewDenylist(client, time.Hour)
+	d.Deny(context.Background(), "device", "kiosk-1")
+	auth := Authenticate(testKey, testIssuer, nil, d)
+
+	if rec := serve(http.MethodGet, bearer(t, "kiosk-1", "device"), auth); rec.Code != http.StatusUnauthorized {
+		t.Errorf("denied token = %d, want 401", rec.Code)
+	}
+	if rec := serve(http.MethodGet, bearer(t, "kiosk-2", "device"), auth); rec.Code != http.StatusOK {
+		t.Errorf("other token = %d, want 200", rec.Code)
+	}
+	mr.Close()
+	if rec := serve(http.MethodGet, bearer(t, "kiosk-1", "device"), auth); rec.Code != http.StatusOK {
+		t.Errorf("token with the denylist down = %d, want 200", rec.Code)
+	}
+}
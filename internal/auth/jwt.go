@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 // TokenPair holds access and refresh tokens.
@@ -15,37 +16,80 @@ type TokenPair struct {
 	RefreshExp   time.Time
 }
 
-// Claims represents JWT payload.
+// Claims represents JWT payload. Requests authenticated with an API key get
+// the same structure, with the key's scopes.
 type Claims struct {
 	Subject string `json:"sub"`
 	Role    string `json:"role"`
+	// Scopes limit what an API key may do; tokens carry none and are limited
+	// by role alone.
+	Scopes []string `json:"scopes,omitempty"`
+	// DeptIDs limit an admin token to the employees of these departments and
+	// the departments below them; admin tokens without any are unlimited.
+	DeptIDs []int64 `json:"dept_ids,omitempty"`
 	jwt.RegisteredClaims
+
+	apiKey bool
+}
+
+// HasScope reports whether the claims allow scope. Tokens allow every scope;
+// an API key allows the scopes it was given, where admin implies write and
+// write implies read.
+func (c Claims) HasScope(scope string) bool {
+	if !c.apiKey {
+		return true
+	}
+	for _, s := range c.Scopes {
+		switch {
+		case s == scope,
+			s == ScopeAdmin,
+			s == ScopeWrite && scope == ScopeRead:
+			return true
+		}
+	}
+	return false
+}
+
+// DepartmentScoped reports whether the claims are limited to some departments.
+func (c Claims) DepartmentScoped() bool {
+	return len(c.DeptIDs) > 0
 }
 
 // Issue issues signed access and refresh tokens.
 func Issue(subject, role, issuer, key string, accessTTL, refreshTTL time.Duration) (TokenPair, error) {
+	return IssueScoped(subject, role, nil, issuer, key, accessTTL, refreshTTL)
+}
+
+// IssueScoped is Issue for tokens limited to the departments deptIDs; nil
+// deptIDs issues unlimited tokens.
+func IssueScoped(subject, role string, deptIDs []int64, issuer, key string, accessTTL, refreshTTL time.Duration) (TokenPair, error) {
 	accessExp := time.Now().Add(accessTTL)
 	refreshExp := time.Now().Add(refreshTTL)
 
 	accessClaims := Claims{
 		Subject: subject,
 		Role:    role,
+		DeptIDs: deptIDs,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    issuer,
 			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(accessExp),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.NewString(),
 		},
 	}
 
 	refreshClaims := Claims{
 		Subject: subject,
 		Role:    role,
+		DeptIDs: deptIDs,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    issuer,
 			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(refreshExp),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			// A unique id keeps tokens issued within the same second distinct.
+			ID: uuid.NewString(),
 		},
 	}
 
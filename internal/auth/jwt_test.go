@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIssueScopedRoundTrip(t *testing.T) {
+	pair, err := IssueScoped("hr-admin", "admin", []int64{4, 7}, testIssuer, testKey, time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"access": pair.AccessToken, "refresh": pair.RefreshToken} {
+		c, err := Parse(token, testKey, testIssuer)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Subject != "hr-admin" || c.Role != "admin" || !slices.Equal(c.DeptIDs, []int64{4, 7}) || !c.DepartmentScoped() || c.ID == "" {
+			t.Errorf("%s claims = %+v", name, c)
+		}
+	}
+	if !pair.RefreshExp.After(pair.AccessExp) {
+		t.Errorf("refresh expires %s, access %s", pair.RefreshExp, pair.AccessExp)
+	}
+
+	again, _ := Issue("hr-admin", "admin", testIssuer, testKey, time.Hour, 24*time.Hour)
+	if again.AccessToken == pair.AccessToken {
+		t.Error("tokens issued in the same second are equal")
+	}
+	if c, _ := Parse(again.AccessToken, testKey, testIssuer); c.DepartmentScoped() || c.DeptIDs != nil {
+		t.Errorf("unscoped token has departments %v", c.DeptIDs)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	sign := func(method jwt.SigningMethod, key any, exp time.Time, issuer string) string {
+		token, err := jwt.NewWithClaims(method, Claims{Subject: "kiosk-1", Role: "device", RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: issuer, ExpiresAt: jwt.NewNumericDate(exp),
+		}}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	later := time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other key", sign(jwt.SigningMethodHS256, []byte("other-key"), later, testIssuer)},
+		{"other issuer", sign(jwt.SigningMethodHS256, []byte(testKey), later, "someone-else")},
+		{"expired", sign(jwt.SigningMethodHS256, []byte(testKey), time.Now().Add(-time.Minute), testIssuer)},
+		{"HS512", sign(jwt.SigningMethodHS512, []byte(testKey), later, testIssuer)},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, later, testIssuer)},
+		{"garbage", "not.a.token"},
+	}
+	for _, tt := range tests {
+		if c, err := Parse(tt.token, testKey, testIssuer); err == nil {
+			t.Errorf("%s: Parse = %+v, want an error", tt.name, c)
+		}
+	}
+	if _, err := Parse(sign(jwt.SigningMethodHS256, []byte(testKey), later, "someone-else"), testKey, ""); err != nil {
+		t.Errorf("Parse without an issuer to check: %v", err)
+	}
+}
+
+func TestRequireRoleAndUnscoped(t *testing.T) {
+	scoped, err := IssueScoped("hr-admin", "admin", []int64{4}, testIssuer, testKey, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopedHeader := map[string]string{"Authorization": "Bearer " + scoped.AccessToken}
+	authn := Authenticate(testKey, testIssuer, nil, nil)
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		handlers []gin.HandlerFunc
+		want     int
+	}{
+		{"admin on an admin route", bearer(t, "root", "admin"), []gin.HandlerFunc{RequireRole("admin")}, http.StatusOK},
+		{"device on an admin route", bearer(t, "kiosk-1", "device"), []gin.HandlerFunc{RequireRole("admin")}, http.StatusForbidden},
+		{"device among several roles", bearer(t, "kiosk-1", "device"), []gin.HandlerFunc{RequireRole("admin", "device")}, http.StatusOK},
+		{"unscoped admin", bearer(t, "root", "admin"), []gin.HandlerFunc{RequireRole("admin"), RequireUnscoped()}, http.StatusOK},
+		{"department admin on an unscoped route", scopedHeader, []gin.HandlerFunc{RequireRole("admin"), RequireUnscoped()}, http.StatusForbidden},
+		{"department admin on a scoped route", scopedHeader, []gin.HandlerFunc{RequireRole("admin")}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := serve(http.MethodGet, tt.headers, append([]gin.HandlerFunc{authn}, tt.handlers...)...); rec.Code != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
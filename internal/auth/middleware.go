@@ -1,15 +1,47 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// KeyVerifier resolves an API key to claims; APIKeys implements it.
+type KeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (Claims, error)
+}
+
 // DeviceAuth enforces bearer JWT tokens signed with HS256.
 func DeviceAuth(signingKey, issuer string) gin.HandlerFunc {
+	return Authenticate(signingKey, issuer, nil, nil)
+}
+
+// Authenticate accepts either an X-API-Key header, checked against keys, or a
+// bearer JWT signed with HS256. Both leave Claims for ClaimsFrom. A nil keys
+// accepts bearer tokens only. Tokens of subjects on deny are rejected; a
+// denylist lookup that fails lets the token through.
+func Authenticate(signingKey, issuer string, keys KeyVerifier, deny *Denylist) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" && keys != nil {
+			claims, err := keys.VerifyAPIKey(c.Request.Context(), key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+				return
+			}
+			if err != nil {
+				log.Printf("api key lookup failed: %v", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "api key lookup failed"})
+				return
+			}
+			c.Set("claims", claims)
+			c.Next()
+			return
+		}
+
 		authz := c.GetHeader("Authorization")
 		if authz == "" || !strings.HasPrefix(strings.ToLower(authz), "bearer ") {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
@@ -21,7 +53,71 @@ func DeviceAuth(signingKey, issuer string) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
+		if denied, err := deny.Denied(c.Request.Context(), claims.Role, claims.Subject); err != nil {
+			log.Printf("denylist lookup failed: %v", err)
+		} else if denied {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
 		c.Set("claims", claims)
 		c.Next()
 	}
 }
+
+// ClaimsFrom returns the claims stored by DeviceAuth, or zero claims when absent.
+func ClaimsFrom(c *gin.Context) Claims {
+	claimsAny, _ := c.Get("claims")
+	claims, _ := claimsAny.(Claims)
+	return claims
+}
+
+// RequireRole rejects tokens whose role is not one of roles. It must run after DeviceAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := ClaimsFrom(c).Role
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+	}
+}
+
+// RequireUnscoped rejects department-scoped tokens, for routes that are not
+// limited by department. It must run after Authenticate.
+func RequireUnscoped() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ClaimsFrom(c).DepartmentScoped() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to department-scoped tokens"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects API keys without scope. It must run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ClaimsFrom(c).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api key lacks the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// MethodScope requires the read scope for GET, HEAD and OPTIONS and the
+// write scope for everything else. It must run after Authenticate.
+func MethodScope() gin.HandlerFunc {
+	read, write := RequireScope(ScopeRead), RequireScope(ScopeWrite)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			read(c)
+		default:
+			write(c)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testKey    = "test-signing-key"
+	testIssuer = "attendance-test"
+)
+
+// fakeKeys accepts the API keys in its map and fails lookups with err.
+type fakeKeys struct {
+	keys map[string]Claims
+	err  error
+}
+
+func (f fakeKeys) VerifyAPIKey(_ context.Context, key string) (Claims, error) {
+	if f.err != nil {
+		return Claims{}, f.err
+	}
+	c, ok := f.keys[key]
+	if !ok {
+		return Claims{}, ErrInvalidAPIKey
+	}
+	c.apiKey = true
+	return c, nil
+}
+
+// serve sends method / with headers through handlers and an OK handler that
+// echoes the subject it was given.
+func serve(method string, headers map[string]string, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Handle(method, "/", append(handlers, func(c *gin.Context) {
+		c.String(http.StatusOK, ClaimsFrom(c).Subject)
+	})...)
+	req := httptest.NewRequest(method, "/", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// bearer issues an access token for subject with role and returns the
+// Authorization header carrying it.
+func bearer(t *testing.T, subject, role string) map[string]string {
+	t.Helper()
+	pair, err := Issue(subject, role, testIssuer, testKey, time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{"Authorization": "Bearer " + pair.AccessToken}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys := fakeKeys{keys: map[string]Claims{"ak_good": {Subject: "apikey:payroll", Role: "integration", Scopes: []string{ScopeRead}}}}
+	token := bearer(t, "kiosk-1", "device")
+	tests := []struct {
+		name        string
+		keys        KeyVerifier
+		headers     map[string]string
+		wantStatus  int
+		wantSubject string
+	}{
+		{"bearer token", keys, token, http.StatusOK, "kiosk-1"},
+		{"lower-case scheme", keys, map[string]string{"Authorization": strings.Replace(token["Authorization"], "Bearer", "bearer", 1)}, http.StatusOK, "kiosk-1"},
+		{"no credentials", keys, nil, http.StatusUnauthorized, ""},
+		{"basic auth", keys, map[string]string{"Authorization": "Basic a2lvc2s6cGlu"}, http.StatusUnauthorized, ""},
+		{"bad token", keys, map[string]string{"Authorization": "Bearer not.a.token"}, http.StatusUnauthorized, ""},
+		{"api key", keys, map[string]string{"X-API-Key": "ak_good"}, http.StatusOK, "apikey:payroll"},
+		{"unknown api key", keys, map[string]string{"X-API-Key": "ak_bad"}, http.StatusUnauthorized, ""},
+		{"api key lookup fails", fakeKeys{err: errors.New("connection refused")}, map[string]string{"X-API-Key": "ak_good"}, http.StatusServiceUnavailable, ""},
+		{"api key without a key store", nil, map[string]string{"X-API-Key": "ak_good"}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(http.MethodGet, tt.headers, Authenticate(testKey, testIssuer, tt.keys, nil))
+			if rec.Code != tt.wantStatus || (tt.wantStatus == http.StatusOK && rec.Body.String() != tt.wantSubject) {
+				t.Errorf("got %d %s, want %d %s", rec.Code, rec.Body, tt.wantStatus, tt.wantSubject)
+			}
+		})
+	}
+}
+
+// API keys are held to their scopes by method; tokens are not.
+func TestMethodScope(t *testing.T) {
+	keys := fakeKeys{keys: map[string]Claims{
+		"ak_read":  {Subject: "apikey:reader", Role: "integration", Scopes: []string{ScopeRead}},
+		"ak_write": {Subject: "apikey:writer", Role: "integration", Scopes: []string{ScopeWrite}},
+	}}
+	tests := []struct {
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{http.MethodGet, map[string]string{"X-API-Key": "ak_read"}, http.StatusOK},
+		{http.MethodHead, map[string]string{"X-API-Key": "ak_read"}, http.StatusOK},
+		{http.MethodPost, map[string]string{"X-API-Key": "ak_read"}, http.StatusForbidden},
+		{http.MethodDelete, map[string]string{"X-API-Key": "ak_read"}, http.StatusForbidden},
+		{http.MethodGet, map[string]string{"X-API-Key": "ak_write"}, http.StatusOK},
+		{http.MethodPost, map[string]string{"X-API-Key": "ak_write"}, http.StatusOK},
+		{http.MethodPost, bearer(t, "kiosk-1", "device"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serve(tt.method, tt.headers, Authenticate(testKey, testIssuer, keys, nil), MethodScope())
+		if rec.Code != tt.want {
+			t.Errorf("%s with %v = %d, want %d", tt.method, tt.headers, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const pinFailuresPrefix = "attendance:auth:pin-failures:"
+
+// PINLimiter throttles PIN check-ins per user: after max wrong PINs within
+// window, further attempts are refused until the window runs out. It slows
+// guessing down; the lockout stored with the employee stops it.
+type PINLimiter struct {
+	client *redis.Client
+	max    int64
+	window time.Duration
+}
+
+// NewPINLimiter returns a limiter allowing max wrong PINs per window. It
+// returns nil when client is nil or max is not positive; a nil *PINLimiter
+// is safe to use and limits nothing.
+func NewPINLimiter(client *redis.Client, max int, window time.Duration) *PINLimiter {
+	if client == nil || max <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+	return &PINLimiter{client: client, max: int64(max), window: window}
+}
+
+// Blocked reports how long userID must wait before the next PIN attempt;
+// zero means the attempt may go ahead.
+func (l *PINLimiter) Blocked(ctx context.Context, userID string) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+	key := pinFailuresPrefix + userID
+	n, err := l.client.Get(ctx, key).Int64()
+	if err == redis.Nil || (err == nil && n < l.max) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := l.client.TTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		return l.window, err
+	}
+	return ttl, nil
+}
+
+// Fail counts a wrong PIN for userID; the window starts at the first one.
+func (l *PINLimiter) Fail(ctx context.Context, userID string) error {
+	if l == nil {
+		return nil
+	}
+	key := pinFailuresPrefix + userID
+	n, err := l.client.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return l.client.Expire(ctx, key, l.window).Err()
+	}
+	return nil
+}
+
+// Reset clears userID's wrong PINs after a correct one or a new PIN.
+func (l *PINLimiter) Reset(ctx context.Context, userID string) error {
+	if l == nil {
+		return nil
+	}
+	return l.client.Del(ctx, pinFailuresPrefix+userID).Err()
+}
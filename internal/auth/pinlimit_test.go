@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// After max wrong PINs within the window further attempts wait out the rest
+// of it; other users are unaffected, and a correct PIN clears the count.
+func TestPINLimiter(t *testing.T) {
+	client, mr := newTestRedis(t)
+	l := NewPINLimiter(client, 3, 10*time.Minute)
+	ctx := context.Background()
+	blocked := func(user string) time.Duration {
+		t.Helper()
+		d, err := l.Blocked(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	for i := range 3 {
+		if d := blocked("e-1"); d != 0 {
+			t.Fatalf("blocked for %s after %d wrong PINs", d, i)
+		}
+		mr.FastForward(time.Minute)
+		if err := l.Fail(ctx, "e-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The window started at the first failure, two minutes ago.
+	if d := blocked("e-1"); d != 8*time.Minute {
+		t.Errorf("blocked for %s, want the 8m left of the window", d)
+	}
+	if d := blocked("e-2"); d != 0 {
+		t.Errorf("another user is blocked for %s", d)
+	}
+	mr.FastForward(8 * time.Minute)
+	if d := blocked("e-1"); d != 0 {
+		t.Errorf("blocked for %s after the window", d)
+	}
+
+	for range 3 {
+		l.Fail(ctx, "e-1")
+	}
+	if err := l.Reset(ctx, "e-1"); err != nil {
+		t.Fatal(err)
+	}
+	if d := blocked("e-1"); d != 0 {
+		t.Errorf("blocked for %s after Reset", d)
+	}
+}
+
+func TestPINLimiterDisabled(t *testing.T) {
+	client, _ := newTestRedis(t)
+	if l := NewPINLimiter(client, 0, time.Minute); l != nil {
+		t.Errorf("NewPINLimiter with no maximum = %v, want nil", l)
+	}
+	var l *PINLimiter
+	for range 10 {
+		if err := l.Fail(context.Background(), "e-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, err := l.Blocked(context.Background(), "e-1"); d != 0 || err != nil {
+		t.Errorf("nil limiter Blocked = %s, %v", d, err)
+	}
+	if l := NewPINLimiter(client, 3, 0); l.window != 10*time.Minute {
+		t.Errorf("default window = %s", l.window)
+	}
+}
@@ -0,0 +1,182 @@
+// Package cache keeps short-lived copies of hot event reads in Redis so that
+// polling dashboards do not reach Postgres on every request.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+)
+
+var lookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_lookups_total",
+	Help: "Event cache lookups, by result (hit, miss, bypass).",
+}, []string{"result"})
+
+const (
+	keyPrefix  = "attendance:cache:events:"
+	versionKey = keyPrefix + "version"
+	// backoff is how long the cache stays off after a Redis error.
+	backoff = 5 * time.Second
+)
+
+// EventReader is the part of the repository the cache fronts.
+type EventReader interface {
+	EventsFingerprint(ctx context.Context, deviceID, userID string) (int64, time.Time, error)
+	ListEvents(ctx context.Context, deviceID, userID string, limit, offset int) ([]attendance.Event, error)
+	DailyReport(ctx context.Context, from, to time.Time) ([]attendance.DailyAttendance, error)
+	DeviceHourlyCounts(ctx context.Context, from, to time.Time, loc *time.Location) ([]attendance.DeviceHourCount, error)
+}
+
+// Events is a read-through cache around an EventReader. Entries live for the
+// TTL and are keyed under a version counter; Invalidate bumps the counter,
+// which orphans every cached entry at once instead of deleting keys.
+type Events struct {
+	next   EventReader
+	client *redis.Client
+	ttl    time.Duration
+	// ReportTTL is how long utilization reports are cached. They are not
+	// versioned, so they may lag new check-ins by up to ReportTTL instead of
+	// being dropped on each one; zero caches them like everything else.
+	ReportTTL time.Duration
+	// downUntil is when, in unix nanoseconds, to try Redis again after an error.
+	downUntil atomic.Int64
+}
+
+// NewEvents wraps next. A nil client or non-positive ttl disables caching and
+// every call goes straight to next.
+func NewEvents(next EventReader, client *redis.Client, ttl time.Duration) *Events {
+	if ttl <= 0 {
+		client = nil
+	}
+	return &Events{next: next, client: client, ttl: ttl}
+}
+
+type bypassKey struct{}
+
+// Bypass returns a context whose reads skip the cache, for requests sent with
+// Cache-Control: no-cache. Fresh results are still stored.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// EventsFingerprint caches Repository.EventsFingerprint.
+func (e *Events) EventsFingerprint(ctx context.Context, deviceID, userID string) (int64, time.Time, error) {
+	type fingerprint struct {
+		Count int64
+		Last  time.Time
+	}
+	fp, err := through(ctx, e, fmt.Sprintf("fp:%q:%q", deviceID, userID), func() (fingerprint, error) {
+		count, last, err := e.next.EventsFingerprint(ctx, deviceID, userID)
+		return fingerprint{count, last}, err
+	})
+	return fp.Count, fp.Last, err
+}
+
+// ListEvents caches Repository.ListEvents.
+func (e *Events) ListEvents(ctx context.Context, deviceID, userID string, limit, offset int) ([]attendance.Event, error) {
+	return through(ctx, e, fmt.Sprintf("list:%q:%q:%d:%d", deviceID, userID, limit, offset), func() ([]attendance.Event, error) {
+		return e.next.ListEvents(ctx, deviceID, userID, limit, offset)
+	})
+}
+
+// DailyReport caches Repository.DailyReport.
+func (e *Events) DailyReport(ctx context.Context, from, to time.Time) ([]attendance.DailyAttendance, error) {
+	return through(ctx, e, fmt.Sprintf("daily:%d:%d", from.UnixNano(), to.UnixNano()), func() ([]attendance.DailyAttendance, error) {
+		return e.next.DailyReport(ctx, from, to)
+	})
+}
+
+// DeviceHourlyCounts caches Repository.DeviceHourlyCounts.
+func (e *Events) DeviceHourlyCounts(ctx context.Context, from, to time.Time, loc *time.Location) ([]attendance.DeviceHourCount, error) {
+	name := fmt.Sprintf("devicehours:%d:%d:%q", from.UnixNano(), to.UnixNano(), loc.String())
+	load := func() ([]attendance.DeviceHourCount, error) {
+		return e.next.DeviceHourlyCounts(ctx, from, to, loc)
+	}
+	if e.ReportTTL <= 0 {
+		return through(ctx, e, name, load)
+	}
+	if !e.enabled() {
+		return load()
+	}
+	return stored(ctx, e, keyPrefix+"report:"+name, e.ReportTTL, load)
+}
+
+// Invalidate drops every cached entry by bumping the version. Call it after
+// events are inserted or change. A nil *Events is a no-op.
+func (e *Events) Invalidate(ctx context.Context) {
+	if e == nil || !e.enabled() {
+		return
+	}
+	if err := e.client.Incr(ctx, versionKey).Err(); err != nil {
+		e.fail("invalidate", err)
+	}
+}
+
+func (e *Events) enabled() bool {
+	return e.client != nil && time.Now().UnixNano() >= e.downUntil.Load()
+}
+
+// fail turns the cache off for a while so an unhealthy Redis adds no latency.
+func (e *Events) fail(op string, err error) {
+	if e.downUntil.Swap(time.Now().Add(backoff).UnixNano()) < time.Now().UnixNano() {
+		log.Printf("cache: %s failed, bypassing Redis for %s: %v", op, backoff, err)
+	}
+}
+
+// through returns the cached value for name under the current version, or
+// loads it and stores it for the TTL. Redis errors fall back to load.
+func through[T any](ctx context.Context, e *Events, name string, load func() (T, error)) (T, error) {
+	if !e.enabled() {
+		return load()
+	}
+	version, err := e.client.Get(ctx, versionKey).Int64()
+	if err != nil && err != redis.Nil {
+		e.fail("read version", err)
+		return load()
+	}
+	return stored(ctx, e, fmt.Sprintf("%s%d:%s", keyPrefix, version, name), e.ttl, load)
+}
+
+// stored returns the value cached at key, or loads it and stores it for ttl.
+// Redis errors fall back to load.
+func stored[T any](ctx context.Context, e *Events, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	// Reads limited to some departments see other rows than unlimited ones.
+	if ids, ok := attendance.DepartmentScope(ctx); ok {
+		key += fmt.Sprintf(":dept:%v", ids)
+	}
+	if bypass, _ := ctx.Value(bypassKey{}).(bool); bypass {
+		lookupsTotal.WithLabelValues("bypass").Inc()
+	} else if raw, err := e.client.Get(ctx, key).Bytes(); err == nil {
+		var v T
+		if json.Unmarshal(raw, &v) == nil {
+			lookupsTotal.WithLabelValues("hit").Inc()
+			return v, nil
+		}
+	} else if err != redis.Nil {
+		e.fail("get", err)
+		return load()
+	} else {
+		lookupsTotal.WithLabelValues("miss").Inc()
+	}
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	if raw, err := json.Marshal(v); err == nil {
+		if err := e.client.Set(ctx, key, raw, ttl).Err(); err != nil {
+			e.fail("set", err)
+		}
+	}
+	return v, nil
+}
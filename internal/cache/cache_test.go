@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+)
+
+// countingReader is an EventReader that counts its calls and answers with
+// the current generation, so a stale cached answer shows.
+type countingReader struct {
+	calls      int
+	generation int
+	err        error
+}
+
+func (r *countingReader) EventsFingerprint(context.Context, string, string) (int64, time.Time, error) {
+	r.calls++
+	return int64(r.generation), time.Unix(int64(r.generation), 0).UTC(), r.err
+}
+
+func (r *countingReader) ListEvents(_ context.Context, deviceID, userID string, _, _ int) ([]attendance.Event, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return []attendance.Event{{ID: fmt.Sprintf("ev-%d", r.generation), DeviceID: deviceID, UserID: userID}}, nil
+}
+
+func (r *countingReader) DailyReport(context.Context, time.Time, time.Time) ([]attendance.DailyAttendance, error) {
+	r.calls++
+	return []attendance.DailyAttendance{{UserID: "e-1", CheckIns: r.generation}}, r.err
+}
+
+func (r *countingReader) DeviceHourlyCounts(context.Context, time.Time, time.Time, *time.Location) ([]attendance.DeviceHourCount, error) {
+	r.calls++
+	return []attendance.DeviceHourCount{{DeviceID: "kiosk-1", Count: r.generation}}, r.err
+}
+
+func newTestEvents(t *testing.T, ttl time.Duration) (*Events, *countingReader, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	r := &countingReader{generation: 1}
+	return NewEvents(r, client, ttl), r, mr
+}
+
+func lookups(result string) float64 {
+	return testutil.ToFloat64(lookupsTotal.WithLabelValues(result))
+}
+
+// list reads kiosk-1's events and returns the id of the first.
+func list(t *testing.T, ctx context.Context, e *Events) string {
+	t.Helper()
+	events, err := e.ListEvents(ctx, "kiosk-1", "", 50, 0)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("ListEvents = %v, %v", events, err)
+	}
+	return events[0].ID
+}
+
+// A repeated read is served from Redis until Invalidate orphans it.
+func TestEventsCachesUntilInvalidated(t *testing.T) {
+	e, r, _ := newTestEvents(t, time.Minute)
+	ctx := context.Background()
+	hits, misses := lookups("hit"), lookups("miss")
+
+	if got := list(t, ctx, e); got != "ev-1" || r.calls != 1 {
+		t.Fatalf("first read = %s after %d calls", got, r.calls)
+	}
+	r.generation = 2
+	if got := list(t, ctx, e); got != "ev-1" || r.calls != 1 {
+		t.Errorf("second read = %s after %d calls, want the cached ev-1", got, r.calls)
+	}
+	if _, err := e.ListEvents(ctx, "kiosk-2", "", 50, 0); err != nil || r.calls != 2 {
+		t.Errorf("other arguments shared an entry: %d calls, %v", r.calls, err)
+	}
+
+	e.Invalidate(ctx)
+	if got := list(t, ctx, e); got != "ev-2" || r.calls != 3 {
+		t.Errorf("read after Invalidate = %s after %d calls, want ev-2 from the reader", got, r.calls)
+	}
+	if h, m := lookups("hit")-hits, lookups("miss")-misses; h != 1 || m != 3 {
+		t.Errorf("%v hits, %v misses; want 1, 3", h, m)
+	}
+}
+
+func TestEventsExpire(t *testing.T) {
+	e, r, mr := newTestEvents(t, time.Minute)
+	ctx := context.Background()
+	from := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	for range 2 {
+		if _, err := e.DailyReport(ctx, from, from.AddDate(0, 0, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.calls != 1 {
+		t.Fatalf("%d calls before expiry, want 1", r.calls)
+	}
+	mr.FastForward(time.Minute)
+	r.generation = 2
+	report, err := e.DailyReport(ctx, from, from.AddDate(0, 0, 1))
+	if err != nil || r.calls != 2 || report[0].CheckIns != 2 {
+		t.Errorf("read after the TTL = %+v, %v after %d calls; want a fresh one", report, err, r.calls)
+	}
+}
+
+func TestEventsFingerprintRoundTrips(t *testing.T) {
+	e, r, _ := newTestEvents(t, time.Minute)
+	r.generation = 7
+	for range 2 {
+		count, last, err := e.EventsFingerprint(context.Background(), "kiosk-1", "e-1")
+		if err != nil || count != 7 || !last.Equal(time.Unix(7, 0)) {
+			t.Fatalf("EventsFingerprint = %d, %v, %v", count, last, err)
+		}
+	}
+	if r.calls != 1 {
+		t.Errorf("%d calls, want 1", r.calls)
+	}
+}
+
+// A bypassing read goes to the reader and refreshes the entry for others.
+func TestEventsBypass(t *testing.T) {
+	e, r, _ := newTestEvents(t, time.Minute)
+	ctx := context.Background()
+	bypasses := lookups("bypass")
+	list(t, ctx, e)
+	r.generation = 2
+	if got := list(t, Bypass(ctx), e); got != "ev-2" || r.calls != 2 {
+		t.Errorf("bypassing read = %s after %d calls", got, r.calls)
+	}
+	if got := list(t, ctx, e); got != "ev-2" || r.calls != 2 {
+		t.Errorf("read after the bypass = %s after %d calls, want the refreshed entry", got, r.calls)
+	}
+	if d := lookups("bypass") - bypasses; d != 1 {
+		t.Errorf("bypass counter rose by %v, want 1", d)
+	}
+}
+
+// Reads limited to departments are cached apart from unlimited ones.
+func TestEventsDepartmentScope(t *testing.T) {
+	e, r, _ := newTestEvents(t, time.Minute)
+	ctx := context.Background()
+	list(t, ctx, e)
+	list(t, attendance.WithDepartments(ctx, []int64{1, 2}), e)
+	list(t, attendance.WithDepartments(ctx, []int64{3}), e)
+	list(t, attendance.WithDepartments(ctx, []int64{1, 2}), e)
+	if r.calls != 3 {
+		t.Errorf("%d calls, want one per scope", r.calls)
+	}
+}
+
+func TestEventsErrorsAreNotCached(t *testing.T) {
+	e, r, _ := newTestEvents(t, time.Minute)
+	r.err = errors.New("connection refused")
+	if _, err := e.ListEvents(context.Background(), "kiosk-1", "", 50, 0); !errors.Is(err, r.err) {
+		t.Fatalf("ListEvents error = %v", err)
+	}
+	r.err = nil
+	list(t, context.Background(), e)
+	if r.calls != 2 {
+		t.Errorf("%d calls, want the failed read retried", r.calls)
+	}
+}
+
+// With a ReportTTL, utilization reports outlive Invalidate until it passes.
+func TestEventsReportTTL(t *testing.T) {
+	e, r, mr := newTestEvents(t, time.Minute)
+	e.ReportTTL = 10 * time.Minute
+	ctx := context.Background()
+	from := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	read := func() int {
+		counts, err := e.DeviceHourlyCounts(ctx, from, from.AddDate(0, 0, 1), time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts[0].Count
+	}
+	read()
+	r.generation = 2
+	e.Invalidate(ctx)
+	mr.FastForward(5 * time.Minute)
+	if got := read(); got != 1 || r.calls != 1 {
+		t.Errorf("report within ReportTTL = %d after %d calls, want the cached 1", got, r.calls)
+	}
+	mr.FastForward(5 * time.Minute)
+	if got := read(); got != 2 || r.calls != 2 {
+		t.Errorf("report after ReportTTL = %d after %d calls, want a fresh 2", got, r.calls)
+	}
+}
+
+func TestEventsDisabled(t *testing.T) {
+	for name, e := range map[string]func(EventReader) *Events{
+		"no client": func(r EventReader) *Events { return NewEvents(r, nil, time.Minute) },
+		"zero TTL": func(r EventReader) *Events {
+			return NewEvents(r, redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}), 0)
+		},
+	} {
+		r := &countingReader{generation: 1}
+		events := e(r)
+		list(t, context.Background(), events)
+		list(t, context.Background(), events)
+		events.Invalidate(context.Background())
+		if r.calls != 2 {
+			t.Errorf("%s: %d calls, want every read to reach the reader", name, r.calls)
+		}
+	}
+	var nilEvents *Events
+	nilEvents.Invalidate(context.Background())
+}
+
+// When Redis fails, reads fall through to the reader without an error and
+// the cache stays off for a while rather than paying for every failure.
+func TestEventsRedisDown(t *testing.T) {
+	e, r, mr := newTestEvents(t, time.Minute)
+	mr.Close()
+	if got := list(t, context.Background(), e); got != "ev-1" || r.calls != 1 {
+		t.Fatalf("read with Redis down = %s after %d calls", got, r.calls)
+	}
+	if e.enabled() {
+		t.Error("cache still enabled after a Redis error")
+	}
+	e.downUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	if !e.enabled() {
+		t.Error("cache still disabled after the backoff")
+	}
+}
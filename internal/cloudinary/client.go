@@ -2,12 +2,14 @@ package cloudinary
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,16 +23,34 @@ type Client struct {
 	APISecret string
 	Folder    string
 	HTTP      *http.Client
+	// MaxRetries is how many times an upload is retried after a network error or 5xx.
+	MaxRetries int
+	// RetryBackoff is the initial delay between retries; it doubles on each attempt.
+	RetryBackoff time.Duration
+	// MaxDim caps the width/height of the eager derived image; 0 disables it.
+	MaxDim int
+	// Quality is the Cloudinary quality setting for the derived image ("auto", "80", ...).
+	Quality string
+	// Type is the delivery type of uploads: "upload" (public, the default) or
+	// "authenticated", which is only served through signed URLs.
+	Type string
 }
 
+// DefaultTimeout bounds one upload or destroy request when New's caller does
+// not set a timeout of its own.
+const DefaultTimeout = 30 * time.Second
+
 // New creates a Cloudinary client.
 func New(cloudName, apiKey, apiSecret, folder string) *Client {
 	return &Client{
-		CloudName: cloudName,
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		Folder:    folder,
-		HTTP:      &http.Client{Timeout: 30 * time.Second},
+		CloudName:    cloudName,
+		APIKey:       apiKey,
+		APISecret:    apiSecret,
+		Folder:       folder,
+		HTTP:         &http.Client{Timeout: DefaultTimeout},
+		MaxRetries:   2,
+		RetryBackoff: 500 * time.Millisecond,
+		Quality:      "auto",
 	}
 }
 
@@ -43,13 +63,92 @@ type UploadResult struct {
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
 	Bytes     int    `json:"bytes"`
+	Eager     []struct {
+		SecureURL      string `json:"secure_url"`
+		Transformation string `json:"transformation"`
+	} `json:"eager"`
+	// TransformedURL is the size-capped derived image, or SecureURL when no
+	// transformation is configured.
+	TransformedURL string `json:"-"`
 }
 
 // UploadBase64 uploads a base64 data URL image to Cloudinary.
 // data should be a full data URL like "data:image/jpeg;base64,..."
-// or just raw base64 — both are accepted.
-func (c *Client) UploadBase64(data string) (*UploadResult, error) {
+// or just raw base64 — both are accepted. The upload, including retries, is
+// abandoned when ctx is done.
+func (c *Client) UploadBase64(ctx context.Context, data string) (*UploadResult, error) {
 	// Cloudinary accepts data URIs directly via the "file" param
+	return c.upload(ctx, func(w *multipart.Writer) error {
+		return w.WriteField("file", data)
+	})
+}
+
+// UploadBytes uploads raw image bytes to Cloudinary. The upload, including
+// retries, is abandoned when ctx is done.
+func (c *Client) UploadBytes(ctx context.Context, data []byte, filename string) (*UploadResult, error) {
+	return c.upload(ctx, func(w *multipart.Writer) error {
+		part, err := w.CreateFormFile("file", filename)
+		if err != nil {
+			return fmt.Errorf("cloudinary: create form file failed: %w", err)
+		}
+		if _, err := io.Copy(part, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("cloudinary: write file failed: %w", err)
+		}
+		return nil
+	})
+}
+
+// deliveryType returns Type, defaulting to "upload".
+func (c *Client) deliveryType() string {
+	if c.Type == "" {
+		return "upload"
+	}
+	return c.Type
+}
+
+// transformation returns the eager transformation string, or "" when disabled.
+func (c *Client) transformation() string {
+	if c.MaxDim <= 0 {
+		return ""
+	}
+	parts := []string{"c_limit", "w_" + strconv.Itoa(c.MaxDim), "h_" + strconv.Itoa(c.MaxDim)}
+	if c.Quality != "" {
+		parts = append(parts, "q_"+c.Quality)
+	}
+	parts = append(parts, "f_jpg")
+	return strings.Join(parts, ",")
+}
+
+// upload performs a signed upload, retrying with exponential backoff on
+// network errors and 5xx responses. writeFile adds the "file" field. It
+// stops retrying, and returns ctx's error, once ctx is done.
+func (c *Client) upload(ctx context.Context, writeFile func(w *multipart.Writer) error) (*UploadResult, error) {
+	backoff := c.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("cloudinary: %w (last error: %v)", ctx.Err(), lastErr)
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+		result, retry, err := c.uploadOnce(ctx, writeFile)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) uploadOnce(ctx context.Context, writeFile func(w *multipart.Writer) error) (*UploadResult, bool, error) {
 	params := map[string]string{
 		"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
 		"api_key":   c.APIKey,
@@ -57,7 +156,12 @@ func (c *Client) UploadBase64(data string) (*UploadResult, error) {
 	if c.Folder != "" {
 		params["folder"] = c.Folder
 	}
-
+	if c.Type != "" {
+		params["type"] = c.Type
+	}
+	if t := c.transformation(); t != "" {
+		params["eager"] = t
+	}
 	params["signature"] = c.sign(params)
 
 	// Build multipart form
@@ -67,84 +171,191 @@ func (c *Client) UploadBase64(data string) (*UploadResult, error) {
 	for k, v := range params {
 		_ = w.WriteField(k, v)
 	}
-	_ = w.WriteField("file", data)
+	if err := writeFile(w); err != nil {
+		return nil, false, err
+	}
 	w.Close()
 
-	url := fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/upload", c.CloudName)
-	req, err := http.NewRequest(http.MethodPost, url, &buf)
+	endpoint := fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/upload", c.CloudName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &buf)
 	if err != nil {
-		return nil, fmt.Errorf("cloudinary: create request failed: %w", err)
+		return nil, false, fmt.Errorf("cloudinary: create request failed: %w", err)
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
 
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("cloudinary: request failed: %w", err)
+		return nil, true, fmt.Errorf("cloudinary: request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("cloudinary: upload failed (%d): %s", resp.StatusCode, string(body))
+		return nil, resp.StatusCode >= 500, fmt.Errorf("cloudinary: upload failed (%d): %s", resp.StatusCode, string(body))
 	}
 
 	var result UploadResult
 	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("cloudinary: decode response failed: %w", err)
+		return nil, false, fmt.Errorf("cloudinary: decode response failed: %w", err)
+	}
+	result.TransformedURL = result.SecureURL
+	if len(result.Eager) > 0 && result.Eager[0].SecureURL != "" {
+		result.TransformedURL = result.Eager[0].SecureURL
 	}
-	return &result, nil
+	return &result, false, nil
 }
 
-// UploadBytes uploads raw image bytes to Cloudinary.
-func (c *Client) UploadBytes(data []byte, filename string) (*UploadResult, error) {
+// Destroy deletes an uploaded image by public id. A missing asset is not an
+// error. With an authenticated Type, images uploaded publicly before the
+// switch are found and deleted too.
+func (c *Client) Destroy(publicID string) error {
+	result, err := c.destroy(publicID, c.deliveryType())
+	if err == nil && result == "not found" && c.deliveryType() != "upload" {
+		_, err = c.destroy(publicID, "upload")
+	}
+	return err
+}
+
+// destroy deletes the image of one delivery type and returns Cloudinary's result.
+func (c *Client) destroy(publicID, deliveryType string) (string, error) {
 	params := map[string]string{
+		"public_id": publicID,
+		"type":      deliveryType,
 		"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
 		"api_key":   c.APIKey,
 	}
-	if c.Folder != "" {
-		params["folder"] = c.Folder
-	}
 	params["signature"] = c.sign(params)
 
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-
+	form := url.Values{}
 	for k, v := range params {
-		_ = w.WriteField(k, v)
+		form.Set(k, v)
 	}
-
-	part, err := w.CreateFormFile("file", filename)
+	endpoint := fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/destroy", c.CloudName)
+	resp, err := c.HTTP.PostForm(endpoint, form)
 	if err != nil {
-		return nil, fmt.Errorf("cloudinary: create form file failed: %w", err)
+		return "", fmt.Errorf("cloudinary: destroy request failed: %w", err)
 	}
-	if _, err := io.Copy(part, bytes.NewReader(data)); err != nil {
-		return nil, fmt.Errorf("cloudinary: write file failed: %w", err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("cloudinary: destroy failed (%d): %s", resp.StatusCode, string(body))
 	}
-	w.Close()
+	var out struct {
+		Result string `json:"result"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("cloudinary: decode response failed: %w", err)
+	}
+	if out.Result != "ok" && out.Result != "not found" {
+		return "", fmt.Errorf("cloudinary: destroy %s: %s", publicID, out.Result)
+	}
+	return out.Result, nil
+}
 
-	url := fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/upload", c.CloudName)
-	req, err := http.NewRequest(http.MethodPost, url, &buf)
-	if err != nil {
-		return nil, fmt.Errorf("cloudinary: create request failed: %w", err)
+// DeliveryURL returns the HTTPS URL of an uploaded image. Authenticated
+// images are not served from it without a signature; see SignedURL.
+func (c *Client) DeliveryURL(publicID string) string {
+	return fmt.Sprintf("https://res.cloudinary.com/%s/image/%s/%s", c.CloudName, c.deliveryType(), publicID)
+}
+
+// PublicIDFromURL extracts the public id from a delivery URL of this cloud,
+// skipping any signature, transformation and version segments and the file
+// extension. It reports false for URLs that do not belong to this cloud.
+func (c *Client) PublicIDFromURL(rawURL string) (string, bool) {
+	_, id, _, ok := c.parseDeliveryURL(rawURL)
+	return id, ok
+}
+
+// parseDeliveryURL splits a delivery URL of this cloud into its delivery
+// type, public id and file extension (empty when there is none).
+func (c *Client) parseDeliveryURL(rawURL string) (deliveryType, publicID, format string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host != "res.cloudinary.com" {
+		return "", "", "", false
 	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	rest, ok := strings.CutPrefix(u.Path, "/"+c.CloudName+"/image/")
+	if !ok {
+		return "", "", "", false
+	}
+	deliveryType, rest, _ = strings.Cut(rest, "/")
+	switch deliveryType {
+	case "upload", "authenticated", "private":
+	default:
+		return "", "", "", false
+	}
+	segments := strings.Split(rest, "/")
+	if len(segments) > 1 && isSignature(segments[0]) {
+		segments = segments[1:]
+	}
+	for len(segments) > 1 && (isTransformation(segments[0]) || isVersion(segments[0])) {
+		segments = segments[1:]
+	}
+	id := strings.Join(segments, "/")
+	if dot := strings.LastIndex(id, "."); dot > strings.LastIndex(id, "/") {
+		id, format = id[:dot], id[dot+1:]
+	}
+	return deliveryType, id, format, id != ""
+}
 
-	resp, err := c.HTTP.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("cloudinary: request failed: %w", err)
+// SignedURL returns a URL serving the image with the client's delivery type
+// as JPEG until ttl from now. It goes through Cloudinary's download API,
+// which checks the API signature and expires_at, so it works for
+// authenticated images and stops working once it expires.
+func (c *Client) SignedURL(publicID string, ttl time.Duration) string {
+	return c.signedURL(c.deliveryType(), publicID, "jpg", time.Now(), time.Now().Add(ttl))
+}
+
+// SignDeliveryURL returns a signed URL, valid until expires, for a delivery
+// URL of this cloud, keeping its delivery type and format. It reports false
+// for URLs of other hosts or clouds.
+func (c *Client) SignDeliveryURL(rawURL string, expires time.Time) (string, bool) {
+	deliveryType, id, format, ok := c.parseDeliveryURL(rawURL)
+	if !ok {
+		return "", false
 	}
-	defer resp.Body.Close()
+	if format == "" {
+		format = "jpg"
+	}
+	return c.signedURL(deliveryType, id, format, time.Now(), expires), true
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("cloudinary: upload failed (%d): %s", resp.StatusCode, string(body))
+func (c *Client) signedURL(deliveryType, publicID, format string, now, expires time.Time) string {
+	params := map[string]string{
+		"public_id":  publicID,
+		"format":     format,
+		"type":       deliveryType,
+		"timestamp":  strconv.FormatInt(now.Unix(), 10),
+		"expires_at": strconv.FormatInt(expires.Unix(), 10),
+		"api_key":    c.APIKey,
 	}
+	params["signature"] = c.sign(params)
+	q := url.Values{}
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	return fmt.Sprintf("https://api.cloudinary.com/v1_1/%s/image/download?%s", c.CloudName, q.Encode())
+}
 
-	var result UploadResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("cloudinary: decode response failed: %w", err)
+// isSignature reports whether a path segment is a delivery signature such
+// as "s--Ab3dEf_g--".
+func isSignature(seg string) bool {
+	return len(seg) > 5 && strings.HasPrefix(seg, "s--") && strings.HasSuffix(seg, "--")
+}
+
+// isTransformation reports whether a path segment looks like a transformation
+// such as "q_auto" or "c_limit,w_800".
+func isTransformation(seg string) bool {
+	return len(seg) > 2 && seg[1] == '_' && seg[0] >= 'a' && seg[0] <= 'z'
+}
+
+// isVersion reports whether a path segment is a version such as "v1712345678".
+func isVersion(seg string) bool {
+	if len(seg) < 2 || seg[0] != 'v' {
+		return false
 	}
-	return &result, nil
+	_, err := strconv.ParseUint(seg[1:], 10, 64)
+	return err == nil
 }
 
 // sign computes the Cloudinary API signature from the given params.
@@ -0,0 +1,112 @@
+package cloudinary
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// redirect sends every request to srv instead of api.cloudinary.com.
+type redirect struct{ srv *httptest.Server }
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(r.srv.URL)
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return r.srv.Client().Transport.RoundTrip(req)
+}
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := New("demo", "key", "secret", "faces")
+	c.HTTP = &http.Client{Transport: redirect{srv}}
+	c.RetryBackoff = time.Millisecond
+	return c
+}
+
+// A slow upstream does not hold the upload past its context: the request is
+// aborted at the deadline and not retried.
+func TestUploadStopsAtDeadline(t *testing.T) {
+	var requests atomic.Int32
+	aborted := make(chan struct{}, 3)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(io.Discard, r.Body) // until the body is read the server cannot see a hang-up
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.UploadBytes(ctx, []byte("jpeg"), "face.jpg")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UploadBytes error = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("UploadBytes returned after %s", elapsed)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the upstream request was not aborted")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d upload requests, want 1", n)
+	}
+}
+
+// Server errors are retried with backoff until one succeeds or the retries
+// run out; client errors are not retried.
+func TestUploadRetries(t *testing.T) {
+	var requests, failures atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/v1_1/demo/image/upload" || r.FormValue("signature") == "" || r.FormValue("folder") != "faces" {
+			http.Error(w, `{"error":{"message":"bad request"}}`, http.StatusBadRequest)
+			return
+		}
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"public_id":"faces/abc","secure_url":"https://res.cloudinary.com/demo/image/upload/v1/faces/abc.jpg",
+			"eager":[{"secure_url":"https://res.cloudinary.com/demo/image/upload/c_limit,w_800/v1/faces/abc.jpg"}]}`)
+	})
+	tests := []struct {
+		name         string
+		folder       string
+		failures     int32
+		wantRequests int32
+		wantErr      bool
+	}{
+		{"succeeds on the last retry", "faces", 2, 3, false},
+		{"retries run out", "faces", 3, 3, true},
+		{"client error", "", 0, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			failures.Store(tt.failures)
+			c.Folder = tt.folder
+			res, err := c.UploadBytes(context.Background(), []byte("jpeg"), "face.jpg")
+			if (err != nil) != tt.wantErr || requests.Load() != tt.wantRequests {
+				t.Fatalf("UploadBytes error = %v after %d requests; want error %v after %d", err, requests.Load(), tt.wantErr, tt.wantRequests)
+			}
+			if err == nil && (res.PublicID != "faces/abc" || res.TransformedURL != "https://res.cloudinary.com/demo/image/upload/c_limit,w_800/v1/faces/abc.jpg") {
+				t.Errorf("UploadBytes = %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package erasure removes a user's personal data on request (GDPR erasure)
+// while keeping their attendance countable for reports.
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/storage"
+)
+
+// ErrIncomplete means an image or the gallery entry could not be deleted.
+// The database is left untouched so the erasure can simply be retried.
+var ErrIncomplete = errors.New("erasure incomplete")
+
+// Eraser deletes a user's images and face enrollment and then anonymizes
+// their rows.
+type Eraser struct {
+	Repo *attendance.Repository
+	// Images deletes stored images; nil only unlinks them.
+	Images storage.ImageStore
+	Face   *faceclient.Client
+}
+
+// Erase removes userID's personal data. Images and the gallery entry go
+// first, since the image URLs and user id are needed to find them; any
+// failure there stops before the database changes. Running it again for the
+// same user is safe and reports nothing left to erase.
+func (e Eraser) Erase(ctx context.Context, userID string) (attendance.ErasureReport, error) {
+	rep := attendance.ErasureReport{UserID: userID}
+	if userID == "" {
+		return rep, fmt.Errorf("%w: user id required", attendance.ErrValidation)
+	}
+
+	urls, err := e.Repo.UserImageURLs(ctx, userID)
+	if err != nil {
+		return rep, err
+	}
+	deleted := 0
+	for _, u := range urls {
+		ok, err := e.deleteImage(ctx, u)
+		if err != nil {
+			return rep, fmt.Errorf("%w: delete image: %v", ErrIncomplete, err)
+		}
+		if ok {
+			deleted++
+		}
+	}
+
+	if e.Face != nil {
+		if err := e.Face.DeleteEnrollment(ctx, userID); err != nil {
+			return rep, fmt.Errorf("%w: delete face enrollment: %v", ErrIncomplete, err)
+		}
+	}
+
+	rep, err = e.Repo.AnonymizeUser(ctx, userID)
+	if err != nil {
+		return rep, err
+	}
+	rep.ImagesDeleted = deleted
+	rep.GalleryDeleted = e.Face != nil
+	log.Printf("erasure: user data anonymized as %s: %d events, %d archived events, %d images",
+		rep.Tombstone, rep.EventsAnonymized, rep.ArchivedAnonymized, rep.ImagesDeleted)
+	return rep, nil
+}
+
+// deleteImage removes an image from the store. URLs the store did not issue
+// (or no store at all) have nothing to delete.
+func (e Eraser) deleteImage(ctx context.Context, rawURL string) (bool, error) {
+	if e.Images == nil {
+		return false, nil
+	}
+	key, ok := e.Images.KeyForURL(rawURL)
+	if !ok {
+		return false, nil
+	}
+	return true, e.Images.Delete(ctx, key)
+}
@@ -0,0 +1,95 @@
+package faceaudit
+
+import (
+	"context"
+	"time"
+
+	"attendance/internal/faceclient"
+)
+
+// Client wraps the face client for one event and records each call it makes.
+// Recording only queues an entry, so the wrapper adds no round trips.
+type Client struct {
+	face    *faceclient.Client
+	rec     *Recorder
+	eventID string
+	// threshold is the worker's match threshold, recorded with every call
+	// whose result it is applied to.
+	threshold float64
+}
+
+// Wrap returns face calls for eventID that are recorded in rec. With a nil
+// rec the calls go straight through.
+func Wrap(face *faceclient.Client, rec *Recorder, eventID string, threshold float64) *Client {
+	return &Client{face: face, rec: rec, eventID: eventID, threshold: threshold}
+}
+
+// EmbedWithScore calls faceclient.Client.EmbedWithScore.
+func (c *Client) EmbedWithScore(ctx context.Context, imageURL string) (*faceclient.EmbedResult, error) {
+	start := time.Now()
+	res, err := c.face.EmbedWithScore(ctx, imageURL)
+	e := c.entry("embed", "/embed", start, err)
+	e.Request = map[string]any{"image_url": imageURL}
+	if res != nil {
+		e.Response = map[string]any{
+			"faces_detected": res.FacesDetected,
+			"score":          res.Score,
+			"embedding_dims": len(res.Embedding),
+			"quality":        res.Quality,
+		}
+	}
+	c.rec.Record(e)
+	return res, err
+}
+
+// Verify calls faceclient.Client.Verify.
+func (c *Client) Verify(ctx context.Context, userID, imageURL string) (*faceclient.VerifyResult, error) {
+	start := time.Now()
+	res, err := c.face.Verify(ctx, userID, imageURL)
+	e := c.entry("verify", "/verify", start, err)
+	e.userID = userID
+	e.Request = map[string]any{"user_id": userID, "image_url": imageURL, "threshold": c.threshold}
+	if res != nil {
+		e.Response = map[string]any{
+			"verified":          res.Verified,
+			"similarity":        res.Similarity,
+			"service_threshold": res.Threshold,
+			"quality":           res.Quality,
+		}
+	}
+	c.rec.Record(e)
+	return res, err
+}
+
+// Liveness calls faceclient.Client.Liveness.
+func (c *Client) Liveness(ctx context.Context, imageURL string) (*faceclient.LivenessResult, error) {
+	start := time.Now()
+	res, err := c.face.Liveness(ctx, imageURL)
+	e := c.entry("liveness", "/liveness", start, err)
+	e.Request = map[string]any{"image_url": imageURL}
+	if res != nil {
+		e.Response = map[string]any{"is_live": res.IsLive, "confidence": res.Confidence}
+	}
+	c.rec.Record(e)
+	return res, err
+}
+
+// Compared records a comparison the worker made itself between the check-in
+// embedding and the user's enrolled one. A non-nil err is the reason it failed.
+func (c *Client) Compared(userID string, similarity float64, took time.Duration, err error) {
+	e := c.entry("compare", "local", time.Now().Add(-took), err)
+	e.userID = userID
+	e.Request = map[string]any{"user_id": userID, "threshold": c.threshold}
+	if err == nil {
+		e.Response = map[string]any{"similarity": similarity, "matched": similarity >= c.threshold}
+	}
+	c.rec.Record(e)
+}
+
+func (c *Client) entry(op, endpoint string, start time.Time, err error) Entry {
+	e := Entry{EventID: c.eventID, Operation: op, Endpoint: endpoint, Duration: time.Since(start)}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
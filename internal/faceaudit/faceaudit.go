@@ -0,0 +1,186 @@
+// Package faceaudit records every face-service call the worker makes for a
+// check-in, so a disputed match can be traced to the endpoint, inputs and
+// scores that decided it.
+package faceaudit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var droppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "face_audit_entries_dropped_total",
+	Help: "Face audit entries dropped because the write buffer was full.",
+})
+
+// Entry is one face-service call made while processing an event.
+type Entry struct {
+	ID        int64  `json:"id"`
+	EventID   string `json:"event_id"`
+	Operation string `json:"operation"`
+	// Endpoint is the face-service path called, or "local" for a comparison
+	// the worker computed itself.
+	Endpoint string         `json:"endpoint"`
+	Request  map[string]any `json:"request,omitempty"`
+	Response map[string]any `json:"response,omitempty"`
+	Duration time.Duration  `json:"-"`
+	Error    string         `json:"error,omitempty"`
+	// GalleryEnrolledAt is when the claimed user's face was last enrolled, so
+	// a match can be tied to the gallery entry it was made against.
+	GalleryEnrolledAt *time.Time `json:"gallery_enrolled_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+
+	userID string
+}
+
+// MarshalJSON reports the duration in milliseconds.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type entry Entry
+	return json.Marshal(struct {
+		entry
+		DurationMS float64 `json:"duration_ms"`
+	}{entry(e), float64(e.Duration.Microseconds()) / 1000})
+}
+
+// Recorder writes entries asynchronously through a bounded buffer, like the
+// admin audit log, so auditing never slows down or fails a check-in. A nil
+// *Recorder records nothing.
+type Recorder struct {
+	db      *sql.DB
+	entries chan Entry
+	wg      sync.WaitGroup
+}
+
+// NewRecorder starts the background writer. buffer bounds the number of pending entries.
+func NewRecorder(db *sql.DB, buffer int) *Recorder {
+	if buffer <= 0 {
+		buffer = 256
+	}
+	r := &Recorder{db: db, entries: make(chan Entry, buffer)}
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+// Record queues e. It never blocks; when the buffer is full the entry is
+// dropped and counted.
+func (r *Recorder) Record(e Entry) {
+	if r == nil {
+		return
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	select {
+	case r.entries <- e:
+	default:
+		droppedTotal.Inc()
+		log.Printf("face audit: buffer full, dropped %s for event %s", e.Operation, e.EventID)
+	}
+}
+
+// Close stops accepting entries and waits for pending ones to be written.
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	close(r.entries)
+	r.wg.Wait()
+}
+
+func (r *Recorder) run() {
+	defer r.wg.Done()
+	for e := range r.entries {
+		if err := r.write(e); err != nil {
+			log.Printf("face audit: write %s for event %s failed: %v", e.Operation, e.EventID, err)
+		}
+	}
+}
+
+func (r *Recorder) write(e Entry) error {
+	req, err := marshalSummary(e.Request)
+	if err != nil {
+		return err
+	}
+	resp, err := marshalSummary(e.Response)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The gallery version is looked up here rather than on the check-in path.
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO face_audit (event_id, operation, endpoint, request, response, duration_ms, error, gallery_enrolled_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''),
+		        (SELECT enrolled_at FROM employees WHERE employee_id = NULLIF($8, '')), $9)
+	`, e.EventID, e.Operation, e.Endpoint, req, resp, float64(e.Duration.Microseconds())/1000, e.Error, e.userID, e.CreatedAt)
+	return err
+}
+
+func marshalSummary(m map[string]any) ([]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+// List returns the entries recorded for an event, oldest first.
+func (r *Recorder) List(ctx context.Context, eventID string) ([]Entry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, event_id, operation, endpoint, request, response, duration_ms, COALESCE(error, ''), gallery_enrolled_at, created_at
+		FROM face_audit
+		WHERE event_id = $1
+		ORDER BY created_at, id
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var (
+			e         Entry
+			req, resp []byte
+			ms        float64
+		)
+		if err := rows.Scan(&e.ID, &e.EventID, &e.Operation, &e.Endpoint, &req, &resp, &ms, &e.Error, &e.GalleryEnrolledAt, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(req) > 0 {
+			_ = json.Unmarshal(req, &e.Request)
+		}
+		if len(resp) > 0 {
+			_ = json.Unmarshal(resp, &e.Response)
+		}
+		e.Duration = time.Duration(ms * float64(time.Millisecond))
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// PurgeBefore deletes up to limit entries older than cutoff and returns how
+// many were removed.
+func (r *Recorder) PurgeBefore(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM face_audit
+		WHERE id IN (SELECT id FROM face_audit WHERE created_at < $1 ORDER BY created_at LIMIT $2)
+	`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountBefore counts entries older than cutoff, for retention dry runs.
+func (r *Recorder) CountBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	var n int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM face_audit WHERE created_at < $1`, cutoff).Scan(&n)
+	return n, err
+}
@@ -3,10 +3,14 @@ package faceclient
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 )
 
@@ -76,11 +80,38 @@ type LivenessResult struct {
 	Checks     map[string]interface{}
 }
 
+// ModelInfo identifies the embedding model the face service runs.
+// Embeddings from different models cannot be compared.
+type ModelInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Loaded  bool   `json:"loaded"`
+}
+
+// ID is the model's name and version as stored with enrollments and
+// check-ins, e.g. "buffalo_l@0.7.3".
+func (m ModelInfo) ID() string {
+	if m.Version == "" {
+		return m.Name
+	}
+	return m.Name + "@" + m.Version
+}
+
+// mockModel is what Info reports when the face service is skipped.
+var mockModel = ModelInfo{Name: "mock", Loaded: true}
+
+// modelCacheTTL is how long Model reuses the last Info.
+const modelCacheTTL = time.Minute
+
 // Client calls the face recognition microservice.
 type Client struct {
 	BaseURL string
 	HTTP    *http.Client
 	Skip    bool
+
+	modelMu sync.Mutex
+	model   *ModelInfo
+	modelAt time.Time
 }
 
 // New creates a client with configurable timeout.
@@ -94,6 +125,49 @@ func New(baseURL string, skip bool) *Client {
 	}
 }
 
+// ErrNotEnrolled is returned by Verify when the user has no enrolled face.
+var ErrNotEnrolled = errors.New("face not enrolled")
+
+// ErrNoFace is returned by EmbedWithScore when the face service found no face
+// in the image but answered without an error.
+var ErrNoFace = errors.New("no face detected in image")
+
+// ServiceError is a non-2xx answer from the face service. Detail is the
+// "detail" of its JSON body, which is how the service explains a rejected
+// image (e.g. "No face detected in image"), or the raw body otherwise.
+type ServiceError struct {
+	StatusCode int
+	Status     string
+	Detail     string
+}
+
+func (e *ServiceError) Error() string {
+	return "face service error " + e.Status + ": " + e.Detail
+}
+
+// serviceError reads the body of a non-2xx resp into a *ServiceError.
+func serviceError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &ServiceError{StatusCode: resp.StatusCode, Status: resp.Status, Detail: string(body)}
+	var out struct {
+		Detail any `json:"detail"`
+	}
+	if json.Unmarshal(body, &out) == nil {
+		if detail, ok := out.Detail.(string); ok {
+			e.Detail = detail
+		}
+	}
+	return e
+}
+
+// IsUnavailable reports whether err means the face service could not be
+// reached at all (connection refused, DNS failure, timeout), as opposed to the
+// service rejecting the image.
+func IsUnavailable(err error) bool {
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
 // Embed requests an embedding for an image URL (legacy method for compatibility).
 func (c *Client) Embed(ctx context.Context, imageURL string) ([]float32, error) {
 	result, err := c.EmbedWithScore(ctx, imageURL)
@@ -139,8 +213,7 @@ func (c *Client) EmbedWithScore(ctx context.Context, imageURL string) (*EmbedRes
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out struct {
@@ -153,7 +226,7 @@ func (c *Client) EmbedWithScore(ctx context.Context, imageURL string) (*EmbedRes
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 	if len(out.Embedding) == 0 {
-		return nil, fmt.Errorf("no face detected in image")
+		return nil, ErrNoFace
 	}
 
 	return &EmbedResult{
@@ -192,8 +265,7 @@ func (c *Client) Compare(ctx context.Context, imageURL1, imageURL2 string) (*Com
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out CompareResult
@@ -228,6 +300,91 @@ func (c *Client) Health(ctx context.Context) error {
 	return nil
 }
 
+// Info asks the face service which embedding model it runs, refreshing
+// what Model returns.
+func (c *Client) Info(ctx context.Context) (*ModelInfo, error) {
+	m, err := c.fetchInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.modelMu.Lock()
+	c.model, c.modelAt = m, time.Now()
+	c.modelMu.Unlock()
+	return m, nil
+}
+
+// Model is Info cached for a minute, for callers that need the model on
+// every check-in. An error is returned, and nothing cached, when the face
+// service cannot be asked.
+func (c *Client) Model(ctx context.Context) (*ModelInfo, error) {
+	c.modelMu.Lock()
+	m, at := c.model, c.modelAt
+	c.modelMu.Unlock()
+	if m != nil && time.Since(at) < modelCacheTTL {
+		return m, nil
+	}
+	return c.Info(ctx)
+}
+
+func (c *Client) fetchInfo(ctx context.Context) (*ModelInfo, error) {
+	if c.Skip {
+		m := mockModel
+		return &m, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/health", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("face service unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("face service unhealthy: %s", resp.Status)
+	}
+
+	var out struct {
+		ModelName    string `json:"model_name"`
+		ModelVersion string `json:"model_version"`
+		ModelLoaded  bool   `json:"model_loaded"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &ModelInfo{Name: out.ModelName, Version: out.ModelVersion, Loaded: out.ModelLoaded}, nil
+}
+
+// DeleteEnrollment removes a user's face from the gallery. A user who is not
+// enrolled is not an error, so erasure can be repeated.
+func (c *Client) DeleteEnrollment(ctx context.Context, userID string) error {
+	if c.Skip {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.BaseURL+"/enroll/"+url.PathEscape(userID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("face service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return serviceError(resp)
+	}
+	return nil
+}
+
 // Enroll enrolls a face into the recognition gallery for 1:N search.
 func (c *Client) Enroll(ctx context.Context, userID, imageURL, name string, metadata map[string]interface{}) (*EnrollResult, error) {
 	if c.Skip {
@@ -264,8 +421,7 @@ func (c *Client) Enroll(ctx context.Context, userID, imageURL, name string, meta
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out struct {
@@ -318,8 +474,7 @@ func (c *Client) Search(ctx context.Context, imageURL string, topK int, threshol
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out struct {
@@ -339,6 +494,7 @@ func (c *Client) Search(ctx context.Context, imageURL string, topK int, threshol
 }
 
 // Verify performs 1:1 face verification against a specific enrolled user.
+// It returns ErrNotEnrolled when the service has no face for userID.
 func (c *Client) Verify(ctx context.Context, userID, imageURL string) (*VerifyResult, error) {
 	if c.Skip {
 		return &VerifyResult{
@@ -366,9 +522,11 @@ func (c *Client) Verify(ctx context.Context, userID, imageURL string) (*VerifyRe
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotEnrolled, userID)
+	}
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out struct {
@@ -391,6 +549,39 @@ func (c *Client) Verify(ctx context.Context, userID, imageURL string) (*VerifyRe
 	}, nil
 }
 
+// DetectFaces counts the faces in image bytes without embedding them. It is
+// cheaper than EmbedWithScore and needs no stored URL.
+func (c *Client) DetectFaces(ctx context.Context, data []byte) (int, error) {
+	if c.Skip {
+		return 1, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"image_data": base64.StdEncoding.EncodeToString(data)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/detect", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("face service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return 0, serviceError(resp)
+	}
+
+	var out struct {
+		FacesDetected int `json:"faces_detected"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return out.FacesDetected, nil
+}
+
 // Liveness checks if the face image is from a live person (anti-spoofing).
 func (c *Client) Liveness(ctx context.Context, imageURL string) (*LivenessResult, error) {
 	if c.Skip {
@@ -415,8 +606,7 @@ func (c *Client) Liveness(ctx context.Context, imageURL string) (*LivenessResult
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %s: %s", resp.Status, string(bodyBytes))
+		return nil, serviceError(resp)
 	}
 
 	var out struct {
@@ -0,0 +1,142 @@
+package httpmiddleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var bodyTooLargeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_request_body_too_large_total",
+	Help: "Requests answered with 413 because their body exceeded the route's limit.",
+}, []string{"route"})
+
+const bodyLimitKey = "httpmiddleware.bodylimit"
+
+// bodyLimitState is shared by the BodyLimit middlewares of one request so the
+// innermost one (route or group) replaces the limit set further out.
+type bodyLimitState struct {
+	body     io.ReadCloser // the original request body
+	limit    int64
+	exceeded bool
+}
+
+// BodyLimit caps the request body at n bytes; 0 removes the cap. Applied
+// globally it sets the default, and applied again on a group or route it
+// overrides that default, larger or smaller. The body is read through
+// http.MaxBytesReader, and once a read crosses the cap, or the declared
+// Content-Length is over it, whatever the handler answers (typically a bind
+// error) is replaced by a 413.
+func BodyLimit(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(bodyLimitKey); ok {
+			v.(*bodyLimitState).install(c, n)
+			c.Next()
+			return
+		}
+
+		st := &bodyLimitState{body: c.Request.Body}
+		c.Set(bodyLimitKey, st)
+		st.install(c, n)
+		w := &limitWriter{ResponseWriter: c.Writer, state: st}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if st.exceeded && !w.ResponseWriter.Written() {
+			st.abort(c)
+		}
+	}
+}
+
+// install replaces any earlier limit on the request body with n.
+func (s *bodyLimitState) install(c *gin.Context, n int64) {
+	s.limit = n
+	if s.body == nil || s.body == http.NoBody {
+		return
+	}
+	if n <= 0 {
+		c.Request.Body = s.body
+		return
+	}
+	c.Request.Body = &limitReader{
+		ReadCloser: http.MaxBytesReader(c.Writer, s.body, n),
+		state:      s,
+		declared:   c.Request.ContentLength,
+	}
+}
+
+func (s *bodyLimitState) abort(c *gin.Context) {
+	bodyTooLargeTotal.WithLabelValues(c.FullPath()).Inc()
+	h := c.Writer.Header()
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	h.Del("ETag")
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("request body exceeds %d bytes", s.limit),
+	})
+}
+
+// limitReader records that the body crossed the limit. A body whose declared
+// Content-Length is already over the limit fails on the first read, without
+// reading any of it.
+type limitReader struct {
+	io.ReadCloser
+	state    *bodyLimitState
+	declared int64
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.declared > r.state.limit {
+		r.state.exceeded = true
+		return 0, &http.MaxBytesError{Limit: r.state.limit}
+	}
+	n, err := r.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		r.state.exceeded = true
+	}
+	return n, err
+}
+
+// limitWriter drops the handler's response once the body limit was crossed,
+// so BodyLimit can answer 413 instead.
+type limitWriter struct {
+	gin.ResponseWriter
+	state *bodyLimitState
+}
+
+func (w *limitWriter) dropped() bool {
+	return !w.ResponseWriter.Written() && w.state.exceeded
+}
+
+func (w *limitWriter) WriteHeader(code int) {
+	if !w.dropped() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *limitWriter) WriteHeaderNow() {
+	if !w.dropped() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.dropped() {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *limitWriter) WriteString(s string) (int, error) {
+	if w.dropped() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,161 @@
+package httpmiddleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compress returns a middleware that gzip- or deflate-encodes responses the
+// client accepts compressed. Bodies shorter than minSize are sent as is, as
+// are content types that are already compressed and event streams, which
+// must reach the client as they are flushed.
+func Compress(minSize int) gin.HandlerFunc {
+	if minSize <= 0 {
+		minSize = 1024
+	}
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = w
+		defer func() {
+			w.finish()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks gzip, then deflate, from an Accept-Encoding header.
+// A coding with q=0 is refused, and "*" stands only for codings that were not.
+func negotiateEncoding(header string) string {
+	accepted, refused := map[string]bool{}, map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				refused[name] = true
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	for _, enc := range []string{"gzip", "deflate"} {
+		if accepted[enc] || (accepted["*"] && !refused[enc]) {
+			return enc
+		}
+	}
+	return ""
+}
+
+// incompressible reports whether a response of this type should pass through.
+func incompressible(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	for _, prefix := range []string{"image/", "video/", "audio/", "text/event-stream",
+		"application/zip", "application/gzip", "application/x-gzip", "application/octet-stream",
+		"application/pdf", "application/vnd.openxmlformats"} {
+		if strings.HasPrefix(ct, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers the start of a body until it knows whether the
+// response is worth compressing, then either encodes or passes it through.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     bytes.Buffer
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if w.skip() {
+			w.decide(false)
+		} else {
+			w.buf.Write(p)
+			if w.buf.Len() >= w.minSize {
+				w.decide(true)
+			}
+			return len(p), nil
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what has been written so far; a streaming response is
+// committed to compression only if it already reached minSize.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(!w.skip() && w.buf.Len() >= w.minSize)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// skip reports whether the response must not be compressed.
+func (w *compressWriter) skip() bool {
+	h := w.Header()
+	status := w.Status()
+	return h.Get("Content-Encoding") != "" || incompressible(h.Get("Content-Type")) ||
+		status == http.StatusNoContent || status == http.StatusNotModified || status < 200
+}
+
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "gzip" {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.enc, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	if w.buf.Len() > 0 {
+		data := w.buf.Bytes()
+		w.buf = bytes.Buffer{}
+		if w.enc != nil {
+			w.enc.Write(data)
+		} else {
+			w.ResponseWriter.Write(data)
+		}
+	}
+}
+
+// finish writes out a body that stayed below minSize and closes the encoder.
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
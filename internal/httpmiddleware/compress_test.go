@@ -0,0 +1,57 @@
+package httpmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"br, deflate;q=0.5", "deflate"},
+		{"*", "gzip"},
+		{"gzip;q=0", ""},
+		{"gzip;q=0, deflate", "deflate"},
+		{"gzip;q=0, *", "deflate"},
+		{"*, gzip;q=0", "deflate"},
+		{"gzip;q=0, deflate;q=0, *", ""},
+		{"*;q=0", ""},
+		{"*;q=0, deflate", "deflate"},
+		{"gzip;q=0.0, *", "deflate"},
+		{"gzip;q=0.001", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressHonoursRefusedGzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Compress(16))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("attendance ", 100))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0, *")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got != "deflate" {
+		t.Fatalf("Content-Encoding = %q, want deflate", got)
+	}
+}
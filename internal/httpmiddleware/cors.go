@@ -0,0 +1,119 @@
+package httpmiddleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig controls which browser origins may call the API.
+type CORSConfig struct {
+	// AllowedOrigins holds exact origins ("https://app.example.com"), wildcard
+	// subdomain patterns ("https://*.example.com") or "*" for any origin.
+	// With "*" credentials are never allowed.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+// CORS returns a middleware that only answers cross-origin requests from allowed origins.
+func CORS(cfg CORSConfig) gin.HandlerFunc {
+	allowAny := false
+	exact := make(map[string]bool)
+	var patterns [][2]string // prefix, suffix around the "*"
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		switch {
+		case o == "":
+		case o == "*":
+			allowAny = true
+		case strings.Contains(o, "*."):
+			i := strings.Index(o, "*.")
+			patterns = append(patterns, [2]string{o[:i], o[i+1:]})
+		default:
+			exact[strings.ToLower(o)] = true
+		}
+	}
+
+	methods := make(map[string]bool)
+	for _, m := range cfg.AllowedMethods {
+		methods[strings.ToUpper(strings.TrimSpace(m))] = true
+	}
+	headers := make(map[string]bool)
+	for _, h := range cfg.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(strings.TrimSpace(h))] = true
+	}
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	originAllowed := func(origin string) bool {
+		lower := strings.ToLower(origin)
+		if exact[lower] {
+			return true
+		}
+		for _, p := range patterns {
+			if strings.HasPrefix(lower, p[0]) && strings.HasSuffix(lower, p[1]) {
+				sub := lower[len(p[0]) : len(lower)-len(p[1])]
+				if sub != "" && !strings.ContainsAny(sub, "/:") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		origin := c.Request.Header.Get("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.Request.Header.Get("Access-Control-Request-Method") != ""
+
+		matched := originAllowed(origin)
+		if !matched && !allowAny {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if matched && !allowAny {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+		} else {
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
+
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		if !methods[strings.ToUpper(c.Request.Header.Get("Access-Control-Request-Method"))] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		for _, h := range strings.Split(c.Request.Header.Get("Access-Control-Request-Headers"), ",") {
+			h = strings.TrimSpace(h)
+			if h != "" && !headers[http.CanonicalHeaderKey(h)] {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+
+		c.Header("Access-Control-Allow-Methods", allowMethods)
+		c.Header("Access-Control-Allow-Headers", allowHeaders)
+		c.Header("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,94 @@
+package httpmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	listed := CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com/", "https://*.example.org"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         10 * time.Minute,
+	}
+	// "*" never allows credentials, even for an origin it also lists.
+	anyOrigin := listed
+	anyOrigin.AllowedOrigins = []string{"*", "https://app.example.com"}
+
+	tests := []struct {
+		name        string
+		cfg         CORSConfig
+		method      string
+		origin      string
+		reqMethod   string // Access-Control-Request-Method; set makes a preflight
+		reqHeaders  string
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   bool
+		wantMethods string
+	}{
+		{"no origin", listed, http.MethodGet, "", "", "", http.StatusOK, "", false, ""},
+		{"exact origin", listed, http.MethodGet, "https://app.example.com", "", "", http.StatusOK, "https://app.example.com", true, ""},
+		{"exact origin in another case", listed, http.MethodGet, "https://APP.example.com", "", "", http.StatusOK, "https://APP.example.com", true, ""},
+		{"unlisted origin", listed, http.MethodGet, "https://evil.example.net", "", "", http.StatusOK, "", false, ""},
+		{"other scheme", listed, http.MethodGet, "http://app.example.com", "", "", http.StatusOK, "", false, ""},
+		{"wildcard subdomain", listed, http.MethodGet, "https://hr.example.org", "", "", http.StatusOK, "https://hr.example.org", true, ""},
+		{"wildcard nested subdomain", listed, http.MethodGet, "https://a.b.example.org", "", "", http.StatusOK, "https://a.b.example.org", true, ""},
+		{"wildcard apex", listed, http.MethodGet, "https://example.org", "", "", http.StatusOK, "", false, ""},
+		{"wildcard lookalike", listed, http.MethodGet, "https://evilexample.org", "", "", http.StatusOK, "", false, ""},
+		{"wildcard with a port", listed, http.MethodGet, "https://hr.example.org:8443", "", "", http.StatusOK, "", false, ""},
+		{"preflight", listed, http.MethodOptions, "https://hr.example.org", "POST", "content-type, authorization", http.StatusNoContent, "https://hr.example.org", true, "GET, POST"},
+		{"preflight from an unlisted origin", listed, http.MethodOptions, "https://evil.example.net", "GET", "", http.StatusForbidden, "", false, ""},
+		{"preflight for a method not allowed", listed, http.MethodOptions, "https://app.example.com", "DELETE", "", http.StatusForbidden, "https://app.example.com", true, ""},
+		{"preflight for a header not allowed", listed, http.MethodOptions, "https://app.example.com", "GET", "X-Debug", http.StatusForbidden, "https://app.example.com", true, ""},
+		{"any origin", anyOrigin, http.MethodGet, "https://evil.example.net", "", "", http.StatusOK, "*", false, ""},
+		{"any origin drops credentials for a listed one", anyOrigin, http.MethodGet, "https://app.example.com", "", "", http.StatusOK, "*", false, ""},
+		{"any origin preflight", anyOrigin, http.MethodOptions, "https://evil.example.net", "GET", "", http.StatusNoContent, "*", false, "GET, POST"},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(CORS(tt.cfg))
+			r.Any("/v1/events", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "/v1/events", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			if tt.reqHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			h := w.Header()
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCreds)
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if tt.wantMethods != "" && h.Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", h.Get("Access-Control-Max-Age"))
+			}
+			if wantVary := tt.origin != ""; (h.Get("Vary") == "Origin") != wantVary {
+				t.Errorf("Vary = %q, want Origin only on cross-origin requests", h.Get("Vary"))
+			}
+		})
+	}
+}
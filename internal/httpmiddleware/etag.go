@@ -0,0 +1,44 @@
+package httpmiddleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag derives a strong entity tag from the parts that determine a response.
+func ETag(parts ...any) string {
+	h := sha256.Sum256([]byte(fmt.Sprint(parts...)))
+	return `"` + hex.EncodeToString(h[:12]) + `"`
+}
+
+// NotModified sets the ETag header and, when the request's If-None-Match
+// matches it, answers 304 and returns true so the handler can stop.
+func NotModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
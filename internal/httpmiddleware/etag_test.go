@@ -0,0 +1,67 @@
+package httpmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestETag(t *testing.T) {
+	a := ETag("kiosk-1", "|", "", "|", 50, "|", 0, "|", 3)
+	if a != ETag("kiosk-1", "|", "", "|", 50, "|", 0, "|", 3) {
+		t.Error("ETag differs for the same parts")
+	}
+	if a == ETag("kiosk-1", "|", "", "|", 50, "|", 0, "|", 4) {
+		t.Error("ETag is the same for different parts")
+	}
+	if len(a) != 26 || a[0] != '"' || a[len(a)-1] != '"' {
+		t.Errorf("ETag = %s, want a quoted strong tag", a)
+	}
+}
+
+// NotModified always sends the tag; it answers 304 with no body and stops
+// the handler only on a match.
+func TestNotModified(t *testing.T) {
+	const etag = `"abc123"`
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{"no header", "", http.StatusOK},
+		{"match", etag, http.StatusNotModified},
+		{"weak match", "W/" + etag, http.StatusNotModified},
+		{"match in a list", `"old", ` + etag, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"miss", `"old"`, http.StatusOK},
+		{"unquoted", "abc123", http.StatusOK},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := false
+			r := gin.New()
+			r.GET("/v1/events", func(c *gin.Context) {
+				if NotModified(c, etag) {
+					return
+				}
+				loaded = true
+				c.JSON(http.StatusOK, gin.H{"events": []string{}})
+			})
+			req := httptest.NewRequest(http.MethodGet, "/v1/events", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus || rec.Header().Get("ETag") != etag {
+				t.Errorf("status %d, ETag %q; want %d, %s", rec.Code, rec.Header().Get("ETag"), tt.wantStatus, etag)
+			}
+			if hit := tt.wantStatus == http.StatusNotModified; loaded == hit || hit && rec.Body.Len() != 0 {
+				t.Errorf("loaded = %v, body %q", loaded, rec.Body)
+			}
+		})
+	}
+}
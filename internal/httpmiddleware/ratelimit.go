@@ -1,41 +1,127 @@
 package httpmiddleware
 
 import (
+	"container/list"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+var bucketsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "ratelimit_buckets",
+	Help: "Number of client buckets currently tracked by the in-memory rate limiter.",
+})
+
+// EvictionOptions bounds the memory used by SimpleTokenBucket.
+type EvictionOptions struct {
+	// IdleTTL removes buckets not seen for this long. Defaults to 10 minutes.
+	IdleTTL time.Duration
+	// MaxEntries caps the number of tracked clients; the least recently seen
+	// bucket is evicted when exceeded. Defaults to 100000.
+	MaxEntries int
+}
+
 // SimpleTokenBucket is an in-memory rate limiter; for prod swap to Redis.
 type SimpleTokenBucket struct {
-	capacity int
-	rate     int
-	mu       sync.Mutex
-	state    map[string]*bucket
+	capacity   int
+	rate       int
+	idleTTL    time.Duration
+	maxEntries int
+	now        func() time.Time
+	mu         sync.Mutex
+	state      map[string]*list.Element
+	lru        *list.List // front = most recently seen
+	exempt     []exemption
+}
+
+// exemption matches requests that bypass the limiter. An empty field
+// matches anything.
+type exemption struct {
+	method string
+	path   string
 }
 
 type bucket struct {
+	key    string
 	tokens int
-	last   time.Time
+	last   time.Time // last refill
+	seen   time.Time // last access
 }
 
 // NewSimpleTokenBucket creates limiter with capacity tokens and rate per minute.
-func NewSimpleTokenBucket(capacity, perMinute int) *SimpleTokenBucket {
+func NewSimpleTokenBucket(capacity, perMinute int, eviction EvictionOptions) *SimpleTokenBucket {
 	if capacity <= 0 {
 		capacity = perMinute
 	}
+	if eviction.IdleTTL <= 0 {
+		eviction.IdleTTL = 10 * time.Minute
+	}
+	if eviction.MaxEntries <= 0 {
+		eviction.MaxEntries = 100000
+	}
 	return &SimpleTokenBucket{
-		capacity: capacity,
-		rate:     perMinute,
-		state:    make(map[string]*bucket),
+		capacity:   capacity,
+		rate:       perMinute,
+		idleTTL:    eviction.IdleTTL,
+		maxEntries: eviction.MaxEntries,
+		now:        time.Now,
+		state:      make(map[string]*list.Element),
+		lru:        list.New(),
 	}
 }
 
+// Exempt makes matching requests bypass the limiter without spending a
+// token, so scrapers and probes do not eat into their host's budget. A rule
+// is a path ("/metrics"), a method ("OPTIONS") or both ("HEAD /metrics").
+// Paths match exactly, or by prefix when they end in "/*".
+func (l *SimpleTokenBucket) Exempt(rules ...string) *SimpleTokenBucket {
+	for _, r := range rules {
+		var e exemption
+		for _, f := range strings.Fields(r) {
+			if strings.HasPrefix(f, "/") {
+				e.path = f
+			} else {
+				e.method = strings.ToUpper(f)
+			}
+		}
+		if e != (exemption{}) {
+			l.exempt = append(l.exempt, e)
+		}
+	}
+	return l
+}
+
+func (l *SimpleTokenBucket) exempted(r *http.Request) bool {
+	for _, e := range l.exempt {
+		if e.method != "" && e.method != r.Method {
+			continue
+		}
+		if e.path != "" {
+			if prefix, ok := strings.CutSuffix(e.path, "/*"); ok {
+				if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+					continue
+				}
+			} else if r.URL.Path != e.path {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
 // GinMiddleware returns gin handler enforcing per-IP limits.
 func (l *SimpleTokenBucket) GinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if l.exempted(c.Request) {
+			c.Next()
+			return
+		}
 		ip := c.ClientIP()
 		if ip == "" {
 			ip = "unknown"
@@ -48,24 +134,43 @@ func (l *SimpleTokenBucket) GinMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Len returns the number of tracked buckets.
+func (l *SimpleTokenBucket) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.state)
+}
+
 func (l *SimpleTokenBucket) allow(key string) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	b, ok := l.state[key]
-	now := time.Now()
+	now := l.now()
+	l.evictLocked(now)
+
+	el, ok := l.state[key]
 	if !ok {
-		b = &bucket{tokens: l.capacity - 1, last: now}
-		l.state[key] = b
+		b := &bucket{key: key, tokens: l.capacity - 1, last: now, seen: now}
+		l.state[key] = l.lru.PushFront(b)
+		for len(l.state) > l.maxEntries {
+			l.removeLocked(l.lru.Back())
+		}
+		bucketsGauge.Set(float64(len(l.state)))
 		return true
 	}
+	l.lru.MoveToFront(el)
+	b := el.Value.(*bucket)
+	b.seen = now
 	elapsed := now.Sub(b.last).Minutes()
 	refill := int(elapsed * float64(l.rate))
 	if refill > 0 {
 		b.tokens += refill
-		if b.tokens > l.capacity {
+		// Only the time the whole tokens took is used up, so a client
+		// polling faster than the rate still gets its share.
+		b.last = b.last.Add(time.Duration(refill) * time.Minute / time.Duration(l.rate))
+		if b.tokens >= l.capacity {
 			b.tokens = l.capacity
+			b.last = now
 		}
-		b.last = now
 	}
 	if b.tokens <= 0 {
 		return false
@@ -73,3 +178,23 @@ func (l *SimpleTokenBucket) allow(key string) bool {
 	b.tokens--
 	return true
 }
+
+// evictLocked drops buckets idle longer than idleTTL, oldest first.
+func (l *SimpleTokenBucket) evictLocked(now time.Time) {
+	evicted := false
+	for el := l.lru.Back(); el != nil; el = l.lru.Back() {
+		if now.Sub(el.Value.(*bucket).seen) < l.idleTTL {
+			break
+		}
+		l.removeLocked(el)
+		evicted = true
+	}
+	if evicted {
+		bucketsGauge.Set(float64(len(l.state)))
+	}
+}
+
+func (l *SimpleTokenBucket) removeLocked(el *list.Element) {
+	l.lru.Remove(el)
+	delete(l.state, el.Value.(*bucket).key)
+}
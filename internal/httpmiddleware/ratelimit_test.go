@@ -0,0 +1,138 @@
+package httpmiddleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for SimpleTokenBucket.now.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newTestLimiter returns a limiter reading the time from a fake clock.
+func newTestLimiter(capacity, perMinute int, eviction EvictionOptions) (*SimpleTokenBucket, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	l := NewSimpleTokenBucket(capacity, perMinute, eviction)
+	l.now = clock.now
+	return l, clock
+}
+
+// allowed counts how many of n requests from key are let through.
+func allowed(l *SimpleTokenBucket, key string, n int) int {
+	ok := 0
+	for range n {
+		if l.allow(key) {
+			ok++
+		}
+	}
+	return ok
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	// 10 tokens, refilled at 60 a minute: one a second.
+	type step struct {
+		wait time.Duration
+		try  int
+		want int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"burst up to capacity", []step{{0, 15, 10}}},
+		{"nothing back within the second", []step{{0, 10, 10}, {999 * time.Millisecond, 1, 0}}},
+		{"one token per second", []step{{0, 10, 10}, {time.Second, 2, 1}, {3 * time.Second, 5, 3}}},
+		{"fractions carry over", []step{{0, 10, 10}, {1500 * time.Millisecond, 1, 1}, {500 * time.Millisecond, 1, 1}}},
+		{"polling faster than the rate", []step{
+			{0, 10, 10},
+			{400 * time.Millisecond, 1, 0}, {400 * time.Millisecond, 1, 0}, {400 * time.Millisecond, 1, 1},
+			{400 * time.Millisecond, 1, 0}, {400 * time.Millisecond, 1, 1},
+		}},
+		{"refill caps at capacity", []step{{0, 10, 10}, {time.Hour, 15, 10}}},
+		{"full bucket does not bank idle time", []step{{time.Minute, 0, 0}, {0, 11, 10}, {500 * time.Millisecond, 1, 0}}},
+		{"window refills completely", []step{{0, 10, 10}, {10 * time.Second, 11, 10}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, clock := newTestLimiter(10, 60, EvictionOptions{IdleTTL: 24 * time.Hour})
+			for i, s := range tt.steps {
+				clock.advance(s.wait)
+				if got := allowed(l, "10.0.0.1", s.try); got != s.want {
+					t.Fatalf("step %d: %d of %d allowed, want %d", i, got, s.try, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitKeysAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter(2, 60, EvictionOptions{})
+	if got := allowed(l, "a", 3); got != 2 {
+		t.Fatalf("a: %d allowed, want 2", got)
+	}
+	if got := allowed(l, "b", 3); got != 2 {
+		t.Fatalf("b: %d allowed after a was limited, want 2", got)
+	}
+}
+
+func TestRateLimitLRUEviction(t *testing.T) {
+	const maxKeys = 10000
+	l, clock := newTestLimiter(1, 1, EvictionOptions{IdleTTL: time.Hour, MaxEntries: maxKeys})
+	key := func(i int) string { return fmt.Sprintf("10.0.%d.%d", i/256, i%256) }
+
+	for i := range maxKeys {
+		clock.advance(time.Millisecond)
+		if !l.allow(key(i)) {
+			t.Fatalf("first request of %s refused", key(i))
+		}
+	}
+	if l.Len() != maxKeys {
+		t.Fatalf("Len = %d, want %d", l.Len(), maxKeys)
+	}
+	// Touching the oldest key makes key(1) the least recently seen.
+	clock.advance(time.Millisecond)
+	if l.allow(key(0)) {
+		t.Fatalf("%s allowed a second request", key(0))
+	}
+
+	clock.advance(time.Millisecond)
+	if !l.allow("new") {
+		t.Fatal("new key refused")
+	}
+	if l.Len() != maxKeys {
+		t.Fatalf("Len after overflow = %d, want %d", l.Len(), maxKeys)
+	}
+	if _, ok := l.state[key(1)]; ok {
+		t.Errorf("%s, the least recently seen key, was not evicted", key(1))
+	}
+	// The recently seen key kept its empty bucket.
+	if l.allow(key(0)) {
+		t.Errorf("%s was evicted instead: its request was allowed", key(0))
+	}
+	// An evicted key starts over with a full bucket.
+	if !l.allow(key(1)) {
+		t.Errorf("evicted %s refused", key(1))
+	}
+	if l.Len() != maxKeys {
+		t.Fatalf("Len = %d, want %d", l.Len(), maxKeys)
+	}
+}
+
+func TestRateLimitIdleEviction(t *testing.T) {
+	l, clock := newTestLimiter(1, 1, EvictionOptions{IdleTTL: time.Minute})
+	for i := range 100 {
+		l.allow(fmt.Sprint("idle-", i))
+	}
+	clock.advance(30 * time.Second)
+	l.allow("recent")
+	clock.advance(30 * time.Second)
+	// The next request drops the buckets idle for the full TTL.
+	l.allow("recent")
+	if l.Len() != 1 {
+		t.Fatalf("Len = %d, want only the recently seen bucket", l.Len())
+	}
+}
@@ -0,0 +1,23 @@
+package httpmiddleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the per-request correlation id.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID propagates an incoming X-Request-ID or generates one, exposing it
+// as the "request_id" gin key and echoing it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
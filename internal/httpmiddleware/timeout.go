@@ -0,0 +1,132 @@
+package httpmiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/i18n"
+)
+
+var timeoutsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_request_timeouts_total",
+	Help: "Requests answered with 504 because they exceeded their timeout.",
+}, []string{"route"})
+
+const timeoutKey = "httpmiddleware.timeout"
+
+// timeoutState is shared by the Timeout middlewares of one request so the
+// innermost one (route or group) replaces the deadline set further out.
+type timeoutState struct {
+	base   context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *timeoutState) reset(d time.Duration) {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if d > 0 {
+		s.ctx, s.cancel = context.WithTimeout(s.base, d)
+	} else {
+		s.ctx, s.cancel = context.WithCancel(s.base)
+	}
+}
+
+func (s *timeoutState) expired() bool {
+	return errors.Is(s.ctx.Err(), context.DeadlineExceeded)
+}
+
+// Timeout bounds the request context to d; 0 removes the bound. Applied
+// globally it sets the default, and applied again on a group or route it
+// overrides that default, longer or shorter. Handlers run on the request
+// goroutine and must pass c.Request.Context() downstream so their work stops
+// at the deadline. Once it has passed, anything the handler has not yet sent
+// is discarded and the client gets a 504 error with code "timeout".
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, ok := c.Get(timeoutKey); ok {
+			st := v.(*timeoutState)
+			st.reset(d)
+			c.Request = c.Request.WithContext(st.ctx)
+			c.Next()
+			return
+		}
+
+		st := &timeoutState{base: c.Request.Context()}
+		st.reset(d)
+		defer st.cancel()
+		c.Set(timeoutKey, st)
+		c.Request = c.Request.WithContext(st.ctx)
+
+		w := &timeoutWriter{ResponseWriter: c.Writer, state: st}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if !w.ResponseWriter.Written() && st.expired() {
+			timeoutsTotal.WithLabelValues(c.FullPath()).Inc()
+			h := c.Writer.Header()
+			h.Del("Content-Encoding")
+			h.Del("Content-Length")
+			h.Del("ETag")
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+				"error": "request timed out", "code": "timeout", "message": i18n.From(c).T("error.timeout"),
+			})
+		}
+	}
+}
+
+// timeoutWriter drops a response the handler starts after its deadline.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	state *timeoutState
+}
+
+func (w *timeoutWriter) late() bool {
+	return !w.ResponseWriter.Written() && w.state.expired()
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	if !w.late() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	if !w.late() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	if w.late() {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.late() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timeoutWriter) Flush() {
+	if !w.late() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift
+// the write deadline of a stream.
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
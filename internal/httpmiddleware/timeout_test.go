@@ -0,0 +1,128 @@
+package httpmiddleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"attendance/internal/i18n"
+)
+
+// slowHandler stands in for a handler waiting on a slow upstream: it answers
+// after d unless the request context ends first. exited is closed when it
+// returns.
+func slowHandler(d time.Duration, exited chan struct{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer close(exited)
+		select {
+		case <-time.After(d):
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		case <-c.Request.Context().Done():
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": c.Request.Context().Err().Error()})
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	const short, long = 50 * time.Millisecond, 2 * time.Second
+	tests := []struct {
+		name       string
+		global     time.Duration
+		route      []gin.HandlerFunc
+		work       time.Duration
+		wantStatus int
+	}{
+		{"within the default", long, nil, 0, http.StatusOK},
+		{"past the default", short, nil, long, http.StatusGatewayTimeout},
+		{"route allows longer", short, []gin.HandlerFunc{Timeout(long)}, 200 * time.Millisecond, http.StatusOK},
+		{"route allows less", long, []gin.HandlerFunc{Timeout(short)}, long, http.StatusGatewayTimeout},
+		{"innermost wins", long, []gin.HandlerFunc{Timeout(short), Timeout(long)}, 200 * time.Millisecond, http.StatusOK},
+		{"route without a bound", short, []gin.HandlerFunc{Timeout(0)}, 200 * time.Millisecond, http.StatusOK},
+	}
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exited := make(chan struct{})
+			r := gin.New()
+			r.Use(i18n.Middleware(), Timeout(tt.global))
+			r.GET("/v1/upload", append(tt.route, slowHandler(tt.work, exited))...)
+			before := testutil.ToFloat64(timeoutsTotal.WithLabelValues("/v1/upload"))
+
+			start := time.Now()
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v1/upload", nil)
+			req.Header.Set("Accept-Language", "hi")
+			r.ServeHTTP(rec, req)
+			elapsed := time.Since(start)
+
+			// The response is only written once the handler has returned.
+			select {
+			case <-exited:
+			default:
+				t.Fatal("responded while the handler was still running")
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d %s, want %d", rec.Code, rec.Body, tt.wantStatus)
+			}
+			timedOut := testutil.ToFloat64(timeoutsTotal.WithLabelValues("/v1/upload")) - before
+			if tt.wantStatus != http.StatusGatewayTimeout {
+				if timedOut != 0 {
+					t.Errorf("timeouts counter rose by %v", timedOut)
+				}
+				return
+			}
+			if elapsed > long/2 {
+				t.Errorf("504 after %s; the handler did not stop at the deadline", elapsed)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != "timeout" || body["error"] != "request timed out" || body["message"] != i18n.New("hi").T("error.timeout") {
+				t.Errorf("body = %v, want the error envelope in Hindi", body)
+			}
+			if timedOut != 1 {
+				t.Errorf("timeouts counter rose by %v, want 1", timedOut)
+			}
+		})
+	}
+}
+
+// A handler that ignores its context and answers late has its response
+// replaced, headers included; one that answered in time keeps it.
+func TestTimeoutLateResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Timeout(20 * time.Millisecond))
+	r.GET("/late", func(c *gin.Context) {
+		time.Sleep(100 * time.Millisecond)
+		c.Header("ETag", `"late"`)
+		c.JSON(http.StatusOK, gin.H{"events": []string{}})
+	})
+	r.GET("/early", func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+		c.Writer.WriteHeaderNow()
+		<-c.Request.Context().Done()
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/late", nil))
+	if rec.Code != http.StatusGatewayTimeout || rec.Header().Get("ETag") != "" {
+		t.Errorf("late = %d with ETag %q, want 504 without one", rec.Code, rec.Header().Get("ETag"))
+	}
+	var body map[string]string
+	if json.Unmarshal(rec.Body.Bytes(), &body) != nil || body["code"] != "timeout" || body["message"] != i18n.New(i18n.Default).T("error.timeout") {
+		t.Errorf("late body = %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/early", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("early = %d, want the 202 it sent before the deadline", rec.Code)
+	}
+}
@@ -0,0 +1,153 @@
+// Package i18n translates user-facing API messages and report labels. The
+// catalogs are embedded; a key missing from a language falls back to English,
+// and a key missing from English is returned as is.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default is the language used when the client asks for none we have.
+const Default = "en"
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps a language to its messages by key.
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]string {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		data, err := localeFS.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		msgs := map[string]string{}
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			panic(fmt.Sprintf("i18n: parse %s: %v", f.Name(), err))
+		}
+		out[strings.TrimSuffix(f.Name(), ".json")] = msgs
+	}
+	if _, ok := out[Default]; !ok {
+		panic("i18n: no " + Default + " catalog")
+	}
+	return out
+}
+
+// Languages returns the languages with a catalog, sorted.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Negotiate picks the best language from an Accept-Language header by
+// quality. "ta-IN" matches the ta catalog; q=0 excludes a language. Without a
+// match it returns Default.
+func Negotiate(acceptLanguage string) string {
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		choices = append(choices, choice{base, q})
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, c := range choices {
+		if c.q <= 0 {
+			break
+		}
+		if _, ok := catalogs[c.lang]; ok {
+			return c.lang
+		}
+	}
+	return Default
+}
+
+// Localizer translates messages into one language.
+type Localizer struct {
+	lang string
+}
+
+// New returns a localizer for lang, or for Default when there is no catalog for it.
+func New(lang string) Localizer {
+	if _, ok := catalogs[lang]; !ok {
+		lang = Default
+	}
+	return Localizer{lang: lang}
+}
+
+// Lang returns the language messages are translated into.
+func (l Localizer) Lang() string {
+	if l.lang == "" {
+		return Default
+	}
+	return l.lang
+}
+
+// Has reports whether key is in the English catalog, which every key must be.
+func (l Localizer) Has(key string) bool {
+	_, ok := catalogs[Default][key]
+	return ok
+}
+
+// T returns the message for key, formatted with args when given.
+func (l Localizer) T(key string, args ...any) string {
+	msg, ok := catalogs[l.Lang()][key]
+	if !ok {
+		if msg, ok = catalogs[Default][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// Middleware negotiates the language from Accept-Language, stores the
+// localizer for From and answers with Content-Language.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l := New(Negotiate(c.GetHeader("Accept-Language")))
+		c.Set("localizer", l)
+		c.Header("Content-Language", l.Lang())
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		c.Next()
+	}
+}
+
+// From returns the localizer stored by Middleware, or an English one.
+func From(c *gin.Context) Localizer {
+	v, _ := c.Get("localizer")
+	l, _ := v.(Localizer)
+	return l
+}
@@ -0,0 +1,43 @@
+package imagecheck
+
+import (
+	"net/url"
+	"strings"
+
+	"attendance/internal/config"
+)
+
+// FromConfig allows the configured image store (the Cloudinary cloud or the
+// S3 bucket and its public base URL) plus IMAGE_URL_ALLOWED_HOSTS.
+func FromConfig(cfg config.App) *Checker {
+	var rules []Rule
+	switch cfg.ImageStorage {
+	case "cloudinary", "":
+		if cfg.CloudinaryCloudName != "" {
+			rules = append(rules, Rule{Host: "res.cloudinary.com", PathPrefix: "/" + cfg.CloudinaryCloudName + "/"})
+		}
+	case "s3":
+		if cfg.S3Bucket != "" {
+			rules = append(rules,
+				Rule{Host: cfg.S3Bucket + ".s3.amazonaws.com"},
+				Rule{Host: cfg.S3Bucket + ".s3." + cfg.S3Region + ".amazonaws.com"},
+				Rule{Host: "s3." + cfg.S3Region + ".amazonaws.com", PathPrefix: "/" + cfg.S3Bucket + "/"},
+			)
+		}
+		for _, raw := range []string{cfg.S3Endpoint, cfg.S3PublicBaseURL} {
+			if u, err := url.Parse(raw); err == nil && u.Host != "" {
+				prefix := ""
+				if raw == cfg.S3Endpoint {
+					prefix = "/" + cfg.S3Bucket + "/"
+				}
+				rules = append(rules, Rule{Host: u.Hostname(), PathPrefix: prefix})
+			}
+		}
+	}
+	for _, h := range cfg.ImageURLAllowedHosts {
+		if h = strings.TrimSpace(h); h != "" {
+			rules = append(rules, Rule{Host: h})
+		}
+	}
+	return New(rules, cfg.ImageURLVerify, cfg.ImageURLMaxBytes)
+}
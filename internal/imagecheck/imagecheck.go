@@ -0,0 +1,175 @@
+// Package imagecheck validates image URLs submitted by clients before anything
+// fetches them: only https URLs on allow-listed hosts are accepted, and an
+// optional HEAD request confirms the image exists and is not too large.
+package imagecheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrInvalid is returned (wrapped) for every URL that is rejected.
+var ErrInvalid = errors.New("invalid image url")
+
+// maxRedirects bounds redirects followed by the HEAD check.
+const maxRedirects = 3
+
+// Rule allows URLs on Host whose path starts with PathPrefix. A Host of the
+// form "*.example.com" matches any subdomain of example.com.
+type Rule struct {
+	Host       string
+	PathPrefix string
+}
+
+// Checker validates image URLs. The zero value only enforces the scheme and
+// host form; with no rules any public host is accepted.
+type Checker struct {
+	Allowed []Rule
+	// Verify issues a HEAD request to confirm the URL is an image no larger
+	// than MaxBytes. Private and loopback addresses are never dialed.
+	Verify   bool
+	MaxBytes int64
+	// FetchURL maps an allowed URL to the URL the HEAD check requests, such
+	// as a signed URL for a private image; nil requests the URL itself.
+	FetchURL func(string) string
+
+	client *http.Client
+}
+
+// New creates a checker.
+func New(allowed []Rule, verify bool, maxBytes int64) *Checker {
+	c := &Checker{Allowed: allowed, Verify: verify, MaxBytes: maxBytes}
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refusePrivate}
+	c.client = &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 5 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("%w: too many redirects", ErrInvalid)
+			}
+			return c.checkURL(req.URL)
+		},
+	}
+	return c
+}
+
+// Check validates rawURL and, when Verify is set, that it serves an image.
+func (c *Checker) Check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := c.checkURL(u); err != nil {
+		return err
+	}
+	if !c.Verify {
+		return nil
+	}
+	if c.FetchURL != nil {
+		return c.head(ctx, c.FetchURL(u.String()))
+	}
+	return c.head(ctx, u.String())
+}
+
+func (c *Checker) checkURL(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: must use https", ErrInvalid)
+	}
+	if u.User != nil || u.Opaque != "" {
+		return fmt.Errorf("%w: credentials and opaque URLs are not allowed", ErrInvalid)
+	}
+	if p := u.Port(); p != "" && p != "443" {
+		return fmt.Errorf("%w: port %s is not allowed", ErrInvalid, p)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrInvalid)
+	}
+	if net.ParseIP(host) != nil || numericHost(host) {
+		return fmt.Errorf("%w: IP address hosts are not allowed", ErrInvalid)
+	}
+	if !strings.Contains(host, ".") {
+		return fmt.Errorf("%w: host %s is not a public name", ErrInvalid, host)
+	}
+	if len(c.Allowed) == 0 {
+		return nil
+	}
+	clean := path.Clean("/" + u.Path)
+	for _, r := range c.Allowed {
+		if hostMatches(r.Host, host) && strings.HasPrefix(clean, r.PathPrefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s%s is not an allowed image location", ErrInvalid, host, clean)
+}
+
+// numericHost reports hosts like "2130706433" or "0x7f.1" that some resolvers
+// turn into IP addresses.
+func numericHost(host string) bool {
+	last := host[strings.LastIndex(host, ".")+1:]
+	if last == "" {
+		return false
+	}
+	for _, r := range strings.TrimPrefix(last, "0x") {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return strings.HasPrefix(last, "0x") || strings.Trim(last, "0123456789") == ""
+}
+
+func hostMatches(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+func (c *Checker) head(ctx context.Context, rawURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrInvalid) {
+			return err
+		}
+		return fmt.Errorf("%w: image could not be fetched: %v", ErrInvalid, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: image returned status %d", ErrInvalid, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "image/") {
+		return fmt.Errorf("%w: content type %q is not an image", ErrInvalid, ct)
+	}
+	if c.MaxBytes > 0 && resp.ContentLength > c.MaxBytes {
+		return fmt.Errorf("%w: image is %d bytes, limit is %d", ErrInvalid, resp.ContentLength, c.MaxBytes)
+	}
+	return nil
+}
+
+// refusePrivate stops the HEAD check from dialing internal addresses, even
+// when an allowed name resolves to one.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: refusing to connect to %s", ErrInvalid, host)
+	}
+	return nil
+}
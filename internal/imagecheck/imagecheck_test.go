@@ -0,0 +1,213 @@
+package imagecheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	c := New(nil, false, 0)
+	tests := []struct {
+		url  string
+		want string // substring of the error; "" means accepted
+	}{
+		{"https://images.example.com/a.jpg", ""},
+		{"http://images.example.com/a.jpg", "must use https"},
+		{"https://images.example.com:8443/a.jpg", "port 8443"},
+		{"https://user:pw@images.example.com/a.jpg", "credentials"},
+		{"https:///a.jpg", "missing host"},
+		// Loopback
+		{"https://127.0.0.1/a.jpg", "IP address hosts"},
+		{"https://127.1/a.jpg", "IP address hosts"},
+		{"https://[::1]/a.jpg", "IP address hosts"},
+		{"https://localhost/a.jpg", "not a public name"},
+		{"https://2130706433/a.jpg", "IP address hosts"},
+		{"https://0x7f.1/a.jpg", "IP address hosts"},
+		// Link-local and cloud metadata
+		{"https://169.254.169.254/latest/meta-data/", "IP address hosts"},
+		{"https://[fe80::1]/a.jpg", "IP address hosts"},
+		{"https://metadata/computeMetadata/v1/", "not a public name"},
+		// Private ranges
+		{"https://10.0.0.5/a.jpg", "IP address hosts"},
+		{"https://172.16.0.1/a.jpg", "IP address hosts"},
+		{"https://192.168.1.10/a.jpg", "IP address hosts"},
+		{"https://[fd00::1]/a.jpg", "IP address hosts"},
+		{"https://0.0.0.0/a.jpg", "IP address hosts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := c.Check(context.Background(), tt.url)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Check = %v, want accepted", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Check = %v, want ErrInvalid mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedRules(t *testing.T) {
+	c := New([]Rule{
+		{Host: "res.cloudinary.com", PathPrefix: "/acme/"},
+		{Host: "*.cdn.example.com"},
+	}, false, 0)
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://res.cloudinary.com/acme/image/upload/a.jpg", true},
+		{"https://res.cloudinary.com/other/image/upload/a.jpg", false},
+		{"https://res.cloudinary.com/acme/../other/a.jpg", false},
+		{"https://eu.cdn.example.com/a.jpg", true},
+		{"https://cdn.example.com/a.jpg", false},
+		{"https://evil-cdn.example.com/a.jpg", false},
+	}
+	for _, tt := range tests {
+		if err := c.Check(context.Background(), tt.url); (err == nil) != tt.ok {
+			t.Errorf("Check(%s) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestRefusePrivate(t *testing.T) {
+	tests := []struct {
+		addr    string
+		refused bool
+	}{
+		{"127.0.0.1:443", true},
+		{"127.8.8.8:443", true},
+		{"[::1]:443", true},
+		{"169.254.169.254:443", true},
+		{"[fe80::1]:443", true},
+		{"10.0.0.5:443", true},
+		{"172.31.255.1:443", true},
+		{"192.168.1.10:443", true},
+		{"[fd00::1]:443", true},
+		{"0.0.0.0:443", true},
+		{"[::]:443", true},
+		{"224.0.0.1:443", true},
+		{"[::ffff:127.0.0.1]:443", true},
+		{"[::ffff:10.0.0.5]:443", true},
+		{"93.184.216.34:443", false},
+		{"172.32.0.1:443", false},
+		{"[2606:2800:220:1::1]:443", false},
+	}
+	for _, tt := range tests {
+		err := refusePrivate("tcp", tt.addr, nil)
+		if refused := err != nil; refused != tt.refused {
+			t.Errorf("refusePrivate(%s) = %v, want refused %v", tt.addr, err, tt.refused)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("refusePrivate(%s) = %v, want ErrInvalid", tt.addr, err)
+		}
+	}
+}
+
+// newVerifyingChecker returns a checker with Verify set whose names resolve
+// through hosts instead of DNS. The name "example.com" stands in for a public
+// image host and reaches srv; every other name goes through the checker's own
+// dialer with the address hosts gives it, as if DNS had answered that.
+func newVerifyingChecker(t *testing.T, srv *httptest.Server, hosts map[string]string) *Checker {
+	t.Helper()
+	c := New(nil, true, 1<<20)
+	tr := c.client.Transport.(*http.Transport)
+	tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	guarded := tr.DialContext
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if host == "example.com" {
+			var d net.Dialer
+			return d.DialContext(ctx, network, srv.Listener.Addr().String())
+		}
+		ip, ok := hosts[host]
+		if !ok {
+			return nil, fmt.Errorf("no such host %s", host)
+		}
+		return guarded(ctx, network, net.JoinHostPort(ip, port))
+	}
+	return c
+}
+
+func TestVerifyRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+	}))
+	defer srv.Close()
+	c := newVerifyingChecker(t, srv, map[string]string{
+		"localtest.example.net": "127.0.0.1",
+		"metadata.example.net":  "169.254.169.254",
+		"intranet.example.net":  "10.0.0.5",
+		"nas.example.net":       "192.168.1.10",
+		"v6.example.net":        "::1",
+		"mapped.example.net":    "::ffff:172.16.0.1",
+	})
+
+	if err := c.Check(context.Background(), "https://example.com/a.jpg"); err != nil {
+		t.Fatalf("public image refused: %v", err)
+	}
+
+	tests := []struct {
+		name, url, want string
+	}{
+		{"name resolving to loopback", "https://localtest.example.net/a.jpg", "refusing to connect to 127.0.0.1"},
+		{"name resolving to metadata", "https://metadata.example.net/latest/meta-data/", "refusing to connect to 169.254.169.254"},
+		{"name resolving to 10/8", "https://intranet.example.net/a.jpg", "refusing to connect to 10.0.0.5"},
+		{"name resolving to 192.168/16", "https://nas.example.net/a.jpg", "refusing to connect to 192.168.1.10"},
+		{"name resolving to IPv6 loopback", "https://v6.example.net/a.jpg", "refusing to connect to ::1"},
+		{"name resolving to IPv4-mapped private", "https://mapped.example.net/a.jpg", "refusing to connect"},
+		{"redirect to metadata IP", "https://example.com/a.jpg?to=https://169.254.169.254/latest/meta-data/", "IP address hosts"},
+		{"redirect to private IP", "https://example.com/a.jpg?to=https://10.0.0.5/a.jpg", "IP address hosts"},
+		{"redirect to localhost", "https://example.com/a.jpg?to=https://localhost/a.jpg", "not a public name"},
+		{"redirect to http", "https://example.com/a.jpg?to=http://example.com/a.jpg", "must use https"},
+		{"redirect to name resolving to private", "https://example.com/a.jpg?to=https://intranet.example.net/a.jpg", "refusing to connect to 10.0.0.5"},
+		{"redirect to name resolving to metadata", "https://example.com/a.jpg?to=https://metadata.example.net/latest/meta-data/", "refusing to connect to 169.254.169.254"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Check(context.Background(), tt.url)
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Check = %v, want ErrInvalid mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyFollowsBoundedRedirects(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loop" {
+			http.Redirect(w, r, "https://example.com/loop", http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "https://example.com/a.jpg", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+	}))
+	defer srv.Close()
+	c := newVerifyingChecker(t, srv, nil)
+
+	if err := c.Check(context.Background(), "https://example.com/moved"); err != nil {
+		t.Fatalf("public redirect refused: %v", err)
+	}
+	if err := c.Check(context.Background(), "https://example.com/loop"); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "too many redirects") {
+		t.Fatalf("redirect loop = %v, want too many redirects", err)
+	}
+}
@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	finishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_finished_total",
+		Help: "Jobs run by the dispatcher, by type and outcome (completed, failed, stopped, interrupted, lease_lost).",
+	}, []string{"type", "outcome"})
+	recoveredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "jobs_recovered_total",
+		Help: "Running jobs without a heartbeat that were queued again.",
+	})
+)
+
+// Handler runs one job. It reads its parameters and any progress from a
+// previous attempt from run.Job, reports progress with run.Progress, and
+// returns nil once the work is done. ctx is cancelled when an admin pauses
+// or cancels the job and when the worker shuts down.
+type Handler func(ctx context.Context, run *Run) error
+
+// Run is a job being run by a dispatcher.
+type Run struct {
+	Job
+	store *Store
+}
+
+// Progress stores run's Total, Done, Failed and ResumeAfter. It returns
+// ErrStopped once the job was paused or cancelled, and ErrLeaseLost once it
+// was queued again after its lease expired; the handler should return
+// either.
+func (r *Run) Progress(ctx context.Context) error {
+	status, err := r.store.progress(ctx, r.Job)
+	if err != nil {
+		return err
+	}
+	if status != Running {
+		return ErrStopped
+	}
+	return nil
+}
+
+// SetResult records v as the job's result when it finishes.
+func (r *Run) SetResult(v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.Result = raw
+	return nil
+}
+
+// Dispatcher claims queued jobs and runs them one at a time. Several
+// dispatchers, in one process or many, share the table safely.
+type Dispatcher struct {
+	store *Store
+	// poll is how often the table is checked for queued jobs when nothing
+	// woke the dispatcher; lease how long a running job may go without a
+	// heartbeat before it counts as abandoned and is queued again.
+	poll     time.Duration
+	lease    time.Duration
+	handlers map[string]Handler
+	wake     chan struct{}
+	mu       sync.Mutex
+}
+
+// NewDispatcher returns a dispatcher with no handlers. A non-positive lease
+// defaults to five minutes.
+func NewDispatcher(store *Store, poll, lease time.Duration) *Dispatcher {
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+	return &Dispatcher{
+		store:    store,
+		poll:     poll,
+		lease:    lease,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle registers h for jobs of jobType. Call it before Run.
+func (d *Dispatcher) Handle(jobType string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[jobType] = h
+}
+
+// Wake makes the dispatcher look for queued jobs now instead of at its next
+// poll. A nil dispatcher ignores it.
+func (d *Dispatcher) Wake() {
+	if d == nil {
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) types() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	types := make([]string, 0, len(d.handlers))
+	for t := range d.handlers {
+		types = append(types, t)
+	}
+	return types
+}
+
+// Run recovers abandoned jobs and runs queued ones until ctx is cancelled.
+// A job interrupted by shutdown is queued again to continue elsewhere.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.poll)
+	defer ticker.Stop()
+	for {
+		if n, err := d.store.recover(ctx, d.lease); err != nil && ctx.Err() == nil {
+			log.Printf("jobs: recover failed: %v", err)
+		} else if n > 0 {
+			recoveredTotal.Add(float64(n))
+			log.Printf("jobs: queued %d abandoned jobs again", n)
+		}
+		for ctx.Err() == nil {
+			job, err := d.store.claimNext(ctx, d.types())
+			if errors.Is(err, ErrNotFound) {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("jobs: claim failed: %v", err)
+				}
+				break
+			}
+			d.run(ctx, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs one claimed job to its end, beating its heartbeat meanwhile.
+func (d *Dispatcher) run(ctx context.Context, job Job) {
+	d.mu.Lock()
+	h := d.handlers[job.Type]
+	d.mu.Unlock()
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go d.beat(runCtx, job, cancel)
+
+	log.Printf("job %s (%s) started", job.ID, job.Type)
+	run := &Run{Job: job, store: d.store}
+	err := h(runCtx, run)
+	// Final writes must not fail because the run's context was cancelled.
+	bg := context.WithoutCancel(ctx)
+	outcome := Completed
+	switch {
+	case errors.Is(err, ErrLeaseLost) || errors.Is(context.Cause(runCtx), ErrLeaseLost):
+		// Whoever claimed it since resumes from the last stored progress;
+		// anything this attempt did after that is done again.
+		outcome = "lease_lost"
+		log.Printf("job %s lost its lease after %d done, %d failed; leaving it to the next attempt", job.ID, run.Done, run.Failed)
+	case errors.Is(err, ErrStopped) || errors.Is(context.Cause(runCtx), ErrStopped):
+		outcome = "stopped"
+		log.Printf("job %s stopped by an admin after %d done, %d failed", job.ID, run.Done, run.Failed)
+		if perr := run.Progress(bg); perr != nil && !errors.Is(perr, ErrStopped) {
+			log.Printf("job %s: store progress failed: %v", job.ID, perr)
+		}
+	case err != nil && ctx.Err() != nil:
+		outcome = "interrupted"
+		log.Printf("job %s interrupted by shutdown after %d done, %d failed", job.ID, run.Done, run.Failed)
+		if perr := run.Progress(bg); perr != nil && !errors.Is(perr, ErrStopped) {
+			log.Printf("job %s: store progress failed: %v", job.ID, perr)
+		}
+		if rerr := d.store.requeue(bg, job); rerr != nil {
+			log.Printf("job %s: requeue failed, it is recovered after its lease: %v", job.ID, rerr)
+		}
+	case err != nil:
+		outcome = Failed
+		log.Printf("job %s failed: %v", job.ID, err)
+		if ferr := d.store.finish(bg, run.Job, Failed, err.Error()); ferr != nil {
+			log.Printf("job %s: store failure failed: %v", job.ID, ferr)
+		}
+	default:
+		log.Printf("job %s completed: %d done, %d failed", job.ID, run.Done, run.Failed)
+		if ferr := d.store.finish(bg, run.Job, Completed, ""); ferr != nil {
+			log.Printf("job %s: store completion failed: %v", job.ID, ferr)
+		}
+	}
+	finishedTotal.WithLabelValues(job.Type, outcome).Inc()
+}
+
+// beat refreshes the job's heartbeat a few times per lease, so a handler
+// stuck in one long step is not mistaken for abandoned, and cancels the
+// run once the job is no longer running or no longer its attempt's.
+func (d *Dispatcher) beat(ctx context.Context, job Job, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(d.lease / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		status, err := d.store.heartbeat(ctx, job)
+		if errors.Is(err, ErrLeaseLost) {
+			cancel(ErrLeaseLost)
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("job %s: heartbeat failed: %v", job.ID, err)
+			}
+			continue
+		}
+		if status != Running {
+			cancel(ErrStopped)
+			return
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Package jobs tracks long-running admin work such as face re-enrollment and
+// retention passes. A job is a row in the jobs table; the worker's Dispatcher
+// claims queued jobs and runs the Handler registered for their type, which
+// reports progress the API serves at GET /v1/admin/jobs/:id.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses. A job is queued until a dispatcher claims it and running until
+// it completes or fails. An admin may pause a queued or running job, resume
+// a paused or failed one (it is queued again and continues where it
+// stopped), or cancel any job that has not finished.
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Paused    = "paused"
+	Completed = "completed"
+	Failed    = "failed"
+	Cancelled = "cancelled"
+)
+
+// transitions lists, for each status an admin can set, the statuses a job
+// may be in beforehand.
+var transitions = map[string][]string{
+	Paused:    {Queued, Running},
+	Queued:    {Paused, Failed},
+	Cancelled: {Queued, Running, Paused, Failed},
+}
+
+var (
+	// ErrNotFound means the job does not exist.
+	ErrNotFound = errors.New("job not found")
+	// ErrActive means an exclusive job of the same type is already queued,
+	// running or paused.
+	ErrActive = errors.New("job already active")
+	// ErrInvalidTransition means the job's status does not allow the change.
+	ErrInvalidTransition = errors.New("invalid job status transition")
+	// ErrStopped is returned by Run.Progress once an admin has paused or
+	// cancelled the job; the handler should return it.
+	ErrStopped = errors.New("job stopped")
+	// ErrLeaseLost is returned by Run.Progress once the job went without a
+	// heartbeat for its lease and was queued again, possibly for another
+	// dispatcher; the handler should return it.
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// Job is a long-running task and its progress.
+type Job struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Status string          `json:"status"`
+	Params json.RawMessage `json:"params"`
+	// Total is the number of items the job expects to handle; Done and
+	// Failed count those it has.
+	Total  int `json:"total"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	// ResumeAfter is the key of the last item handled, where a resumed job
+	// continues.
+	ResumeAfter string `json:"resume_after,omitempty"`
+	// Result is what the handler reported when the job finished.
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       *string         `json:"error,omitempty"`
+	CreatedBy   string          `json:"created_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	HeartbeatAt *time.Time      `json:"heartbeat_at,omitempty"`
+	// Attempt counts the times a dispatcher claimed the job.
+	Attempt int `json:"attempt"`
+}
+
+// Spec describes a job to create.
+type Spec struct {
+	Type      string
+	Params    any
+	CreatedBy string
+	// Exclusive refuses the job with ErrActive while another of its type is
+	// queued, running or paused.
+	Exclusive bool
+}
+
+// Filter selects jobs for List; empty fields match everything.
+type Filter struct {
+	Type   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+const columns = `id, type, status, params, total, done, failed, resume_after, result, error, created_by, created_at, started_at, finished_at, heartbeat_at, attempt`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scan(row scanner) (Job, error) {
+	var j Job
+	var result []byte
+	err := row.Scan(&j.ID, &j.Type, &j.Status, &j.Params, &j.Total, &j.Done, &j.Failed, &j.ResumeAfter,
+		&result, &j.Error, &j.CreatedBy, &j.CreatedAt, &j.StartedAt, &j.FinishedAt, &j.HeartbeatAt, &j.Attempt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if len(result) > 0 {
+		j.Result = result
+	}
+	return j, err
+}
+
+// Store reads and writes the jobs table.
+type Store struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewStore returns a store whose calls are bounded by queryTimeout; a
+// non-positive value defaults to 3s.
+func NewStore(db *sql.DB, queryTimeout time.Duration) *Store {
+	if queryTimeout <= 0 {
+		queryTimeout = 3 * time.Second
+	}
+	return &Store{db: db, queryTimeout: queryTimeout}
+}
+
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+// Create stores a queued job. For an exclusive spec with a job of its type
+// already active, it returns that job and ErrActive.
+func (s *Store) Create(ctx context.Context, spec Spec) (Job, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Job{}, err
+	}
+	defer tx.Rollback()
+	job, err := s.CreateTx(ctx, tx, spec)
+	if err != nil {
+		return job, err
+	}
+	return job, tx.Commit()
+}
+
+// CreateTx is Create inside the caller's transaction, so a job can be
+// queued together with the writes that call for it; it only runs once tx
+// commits.
+func (s *Store) CreateTx(ctx context.Context, tx *sql.Tx, spec Spec) (Job, error) {
+	if spec.Type == "" {
+		return Job{}, errors.New("job type required")
+	}
+	params, err := json.Marshal(spec.Params)
+	if err != nil {
+		return Job{}, fmt.Errorf("encode job params: %w", err)
+	}
+	if spec.Params == nil {
+		params = []byte("{}")
+	}
+	if spec.Exclusive {
+		// Serializes creation per type, so two callers cannot both start one.
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, "job:"+spec.Type); err != nil {
+			return Job{}, err
+		}
+		active, err := scan(tx.QueryRowContext(ctx, `
+			SELECT `+columns+` FROM jobs
+			WHERE type = $1 AND status IN ('queued', 'running', 'paused')
+			ORDER BY created_at LIMIT 1
+		`, spec.Type))
+		if err == nil {
+			return active, fmt.Errorf("%w: a %s job is already %s", ErrActive, spec.Type, active.Status)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return Job{}, err
+		}
+	}
+	return scan(tx.QueryRowContext(ctx, `
+		INSERT INTO jobs (type, params, created_by) VALUES ($1, $2, $3)
+		RETURNING `+columns, spec.Type, params, spec.CreatedBy))
+}
+
+// Get returns a job; an unknown id is ErrNotFound.
+func (s *Store) Get(ctx context.Context, id string) (Job, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return scan(s.db.QueryRowContext(ctx, `SELECT `+columns+` FROM jobs WHERE id = $1`, id))
+}
+
+// List returns jobs newest first, at most 500 at a time.
+func (s *Store) List(ctx context.Context, f Filter) ([]Job, error) {
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+columns+` FROM jobs
+		WHERE ($1 = '' OR type = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, f.Type, f.Status, f.Limit, f.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []Job{}
+	for rows.Next() {
+		j, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// SetStatus pauses (Paused), resumes (Queued) or cancels (Cancelled) a job.
+// A change not allowed from the job's current status is ErrInvalidTransition.
+func (s *Store) SetStatus(ctx context.Context, id, status string) (Job, error) {
+	from, ok := transitions[status]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: unknown job status %q", ErrInvalidTransition, status)
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	job, err := scan(s.db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = $2,
+			finished_at = CASE WHEN $2 = 'cancelled' THEN NOW() END
+		WHERE id = $1 AND status = ANY($3)
+		RETURNING `+columns, id, status, from))
+	if !errors.Is(err, ErrNotFound) {
+		return job, err
+	}
+	var current string
+	err = s.db.QueryRowContext(ctx, `SELECT status FROM jobs WHERE id = $1`, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return Job{}, fmt.Errorf("%w: job %s is %s", ErrInvalidTransition, id, current)
+}
+
+// claimNext marks the oldest queued job of one of types running under a new
+// attempt and returns it, or ErrNotFound when none is waiting. SKIP LOCKED
+// lets several dispatchers claim different jobs at once.
+func (s *Store) claimNext(ctx context.Context, types []string) (Job, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return scan(s.db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = 'running', started_at = COALESCE(started_at, NOW()),
+			heartbeat_at = NOW(), error = NULL, attempt = attempt + 1
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND type = ANY($1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+columns, types))
+}
+
+// recover queues running jobs without a heartbeat for lease again, returning
+// how many. Their dispatcher died; another continues from their progress.
+func (s *Store) recover(ctx context.Context, lease time.Duration) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'queued'
+		WHERE status = 'running' AND heartbeat_at < NOW() - make_interval(secs => $1)
+	`, lease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// requeue puts a running job back in the queue, e.g. at shutdown.
+func (s *Store) requeue(ctx context.Context, j Job) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = 'queued' WHERE id = $1 AND status = 'running' AND attempt = $2`, j.ID, j.Attempt)
+	return err
+}
+
+// heartbeat refreshes a running job's heartbeat and returns its status. It
+// returns ErrLeaseLost once the job was queued again after attempt.
+func (s *Store) heartbeat(ctx context.Context, j Job) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var status string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE jobs SET heartbeat_at = CASE WHEN status = 'running' THEN NOW() ELSE heartbeat_at END
+		WHERE id = $1 AND attempt = $2
+		RETURNING status
+	`, j.ID, j.Attempt).Scan(&status)
+	return leaseStatus(status, err)
+}
+
+// progress stores a job's counters and refreshes its heartbeat, returning
+// its status. Like heartbeat it returns ErrLeaseLost, without storing
+// anything, once another attempt may have the job.
+func (s *Store) progress(ctx context.Context, j Job) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	var status string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE jobs SET
+			total = $2, done = $3, failed = $4, resume_after = $5,
+			heartbeat_at = CASE WHEN status = 'running' THEN NOW() ELSE heartbeat_at END
+		WHERE id = $1 AND attempt = $6 AND status <> 'queued'
+		RETURNING status
+	`, j.ID, j.Total, j.Done, j.Failed, j.ResumeAfter, j.Attempt).Scan(&status)
+	return leaseStatus(status, err)
+}
+
+// leaseStatus maps the status a run's attempt reads back to ErrLeaseLost
+// when the attempt no longer holds the job: another attempt claimed it (no
+// row), or recovery queued it again and one is about to. Admins never queue
+// a running job, so Queued always means the latter.
+func leaseStatus(status string, err error) (string, error) {
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && status == Queued) {
+		return "", ErrLeaseLost
+	}
+	return status, err
+}
+
+// finish moves a running job to Completed or Failed with its final
+// counters and result. A job paused or cancelled meanwhile keeps its status,
+// and one claimed again since j's attempt is left to the new attempt.
+func (s *Store) finish(ctx context.Context, j Job, status, msg string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET status = $2, error = NULLIF($3, ''), finished_at = NOW(),
+			total = $4, done = $5, failed = $6, resume_after = $7, result = $8
+		WHERE id = $1 AND status = 'running' AND attempt = $9
+	`, j.ID, status, msg, j.Total, j.Done, j.Failed, j.ResumeAfter, nullJSON(j.Result), j.Attempt)
+	return err
+}
+
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
@@ -0,0 +1,163 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"attendance/internal/testdb"
+)
+
+// expireLease makes job id look abandoned and has recovery queue it again.
+func expireLease(t *testing.T, s *Store, id string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.db.ExecContext(ctx, `UPDATE jobs SET heartbeat_at = NOW() - interval '1 hour' WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.recover(ctx, time.Minute)
+	if err != nil || n != 1 {
+		t.Fatalf("recover = %d, %v; want 1 job queued again", n, err)
+	}
+}
+
+// A job whose lease expires while its dispatcher is stalled is run to the
+// end by another dispatcher, and the stalled one stops without touching it.
+func TestExpiredLeaseReclaimedOnce(t *testing.T) {
+	s := NewStore(testdb.Open(t), 0)
+	ctx := context.Background()
+	job, err := s.Create(ctx, Spec{Type: "reindex", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first dispatcher claims the job and stalls in its handler. Its
+	// lease is long enough that its own heartbeat never runs here.
+	stalled := NewDispatcher(s, time.Hour, time.Hour)
+	started, proceed := make(chan struct{}), make(chan struct{})
+	var stalledErr error
+	stalled.Handle("reindex", func(ctx context.Context, run *Run) error {
+		close(started)
+		<-proceed
+		run.Done = 99
+		stalledErr = run.Progress(ctx)
+		return stalledErr
+	})
+	first, err := s.claimNext(ctx, stalled.types())
+	if err != nil || first.Attempt != 1 {
+		t.Fatalf("first claim = attempt %d, %v", first.Attempt, err)
+	}
+	stalledDone := make(chan struct{})
+	go func() {
+		defer close(stalledDone)
+		stalled.run(ctx, first)
+	}()
+	<-started
+
+	expireLease(t, s, job.ID)
+	// Queued again but not yet reclaimed: the stalled attempt is already out.
+	if _, err := s.heartbeat(ctx, first); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("heartbeat of the expired attempt = %v, want ErrLeaseLost", err)
+	}
+
+	// A second dispatcher reclaims it and runs it to completion.
+	var runs atomic.Int32
+	other := NewDispatcher(s, time.Hour, time.Hour)
+	other.Handle("reindex", func(ctx context.Context, run *Run) error {
+		runs.Add(1)
+		run.Total, run.Done = 3, 3
+		if err := run.Progress(ctx); err != nil {
+			return err
+		}
+		return run.SetResult(map[string]int{"reindexed": 3})
+	})
+	second, err := s.claimNext(ctx, other.types())
+	if err != nil || second.ID != job.ID || second.Attempt != 2 {
+		t.Fatalf("second claim = %s attempt %d, %v", second.ID, second.Attempt, err)
+	}
+	other.run(ctx, second)
+
+	// The stalled dispatcher wakes up, finds its lease gone and stops.
+	close(proceed)
+	<-stalledDone
+	if !errors.Is(stalledErr, ErrLeaseLost) {
+		t.Fatalf("stalled Progress = %v, want ErrLeaseLost", stalledErr)
+	}
+	// Nor can it finish the job afterwards.
+	first.Done = 99
+	if err := s.finish(ctx, first, Failed, "late"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs.Load() != 1 {
+		t.Errorf("second dispatcher ran the job %d times, want 1", runs.Load())
+	}
+	if got.Status != Completed || got.Done != 3 || got.Error != nil || string(got.Result) != `{"reindexed": 3}` {
+		t.Errorf("job = %s done %d error %v result %s; want completed by the second attempt",
+			got.Status, got.Done, got.Error, got.Result)
+	}
+	// Nothing is left to claim.
+	if _, err := s.claimNext(ctx, []string{"reindex"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("claim after completion = %v, want ErrNotFound", err)
+	}
+}
+
+// The heartbeat of a stalled run cancels it once its lease is gone.
+func TestHeartbeatCancelsExpiredRun(t *testing.T) {
+	s := NewStore(testdb.Open(t), 0)
+	ctx := context.Background()
+	job, err := s.Create(ctx, Spec{Type: "reindex", CreatedBy: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(s, time.Hour, 100*time.Millisecond)
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	d.Handle("reindex", func(ctx context.Context, run *Run) error {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	claimed, err := s.claimNext(ctx, d.types())
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.run(ctx, claimed)
+	}()
+	<-started
+	// Another dispatcher has taken over. The job is queued directly, since
+	// this run's heartbeat would keep recovery from seeing it as abandoned.
+	if _, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = 'queued' WHERE id = $1`, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.claimNext(ctx, d.types()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-cause:
+		if !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("run cancelled with %v, want ErrLeaseLost", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled run was not cancelled")
+	}
+	<-done
+	got, err := s.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != Running || got.Attempt != 2 {
+		t.Fatalf("job = %s attempt %d, want running under attempt 2", got.Status, got.Attempt)
+	}
+}
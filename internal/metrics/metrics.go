@@ -0,0 +1,65 @@
+// Package metrics holds the Prometheus metrics of the check-in pipeline that
+// both the API and the worker report to: check-in results, terminal statuses
+// and face scores.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+)
+
+var checkinsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "checkins_total",
+	Help: "Check-ins handled, by result (created, deduplicated, rejected).",
+}, []string{"result"})
+
+var eventsFinalizedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_finalized_total",
+	Help: "Events settled in a terminal status, by status.",
+}, []string{"status"})
+
+var faceMatchScore = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "face_match_score",
+	Help:    "Similarity of check-in faces to the enrolled face.",
+	Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+})
+
+var faceQualityScore = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "face_quality_score",
+	Help:    "Overall quality score of check-in face images.",
+	Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+})
+
+func init() {
+	// Export every result from the start, so rates work before the first one.
+	for _, r := range []string{attendance.CheckinCreated, attendance.CheckinDeduplicated, attendance.CheckinRejected} {
+		checkinsTotal.WithLabelValues(r)
+	}
+}
+
+// Checkins implements attendance.Metrics.
+type Checkins struct{}
+
+// CheckinResult counts a check-in result.
+func (Checkins) CheckinResult(result string) {
+	checkinsTotal.WithLabelValues(result).Inc()
+}
+
+// EventFinalized counts an event settled in status; other statuses are ignored.
+func EventFinalized(status string) {
+	if attendance.IsTerminal(status) {
+		eventsFinalizedTotal.WithLabelValues(status).Inc()
+	}
+}
+
+// ObserveMatchScore records the similarity of a compared face.
+func ObserveMatchScore(similarity float64) {
+	faceMatchScore.Observe(similarity)
+}
+
+// ObserveQualityScore records the quality score of a face image.
+func ObserveQualityScore(score float64) {
+	faceQualityScore.Observe(score)
+}
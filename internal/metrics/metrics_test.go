@@ -0,0 +1,164 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/metrics"
+	"attendance/internal/testdb"
+	"attendance/internal/worker"
+)
+
+// lookup returns the value of the series name{labels} in the default
+// registry: the counter value, or the observation count of a histogram.
+func lookup(t *testing.T, name string, labels ...string) (float64, bool) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if !hasLabels(m, labels) {
+				continue
+			}
+			if f.GetType() == dto.MetricType_HISTOGRAM {
+				return float64(m.GetHistogram().GetSampleCount()), true
+			}
+			return m.GetCounter().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// sample is lookup for a series that must exist.
+func sample(t *testing.T, name string, labels ...string) float64 {
+	t.Helper()
+	v, ok := lookup(t, name, labels...)
+	if !ok {
+		t.Fatalf("no series %s%q", name, labels)
+	}
+	return v
+}
+
+// hasLabels reports whether m carries the label name/value pairs in labels.
+func hasLabels(m *dto.Metric, labels []string) bool {
+	for i := 0; i+1 < len(labels); i += 2 {
+		found := false
+		for _, l := range m.GetLabel() {
+			if l.GetName() == labels[i] && l.GetValue() == labels[i+1] {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCheckinResultsExportedFromStart(t *testing.T) {
+	// A scrape of /metrics lists every result, even before the first check-in.
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, r := range []string{attendance.CheckinCreated, attendance.CheckinDeduplicated, attendance.CheckinRejected} {
+		if want := `checkins_total{result="` + r + `"}`; !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("scrape is missing %s", want)
+		}
+	}
+}
+
+func TestCollectors(t *testing.T) {
+	rejected := sample(t, "checkins_total", "result", attendance.CheckinRejected)
+	// A check-in refused before it reaches the database.
+	svc := attendance.NewService(nil, time.Minute)
+	svc.Metrics = metrics.Checkins{}
+	if _, err := svc.CheckIn(context.Background(), "", "kiosk-1", "", "", time.Time{}); err == nil {
+		t.Fatal("check-in without a user was accepted")
+	}
+	if got := sample(t, "checkins_total", "result", attendance.CheckinRejected); got != rejected+1 {
+		t.Errorf("checkins_total{rejected} = %v, want %v", got, rejected+1)
+	}
+
+	metrics.EventFinalized(attendance.StatusUnmatched)
+	metrics.EventFinalized(attendance.StatusPending)
+	if got := sample(t, "events_finalized_total", "status", attendance.StatusUnmatched); got < 1 {
+		t.Errorf("events_finalized_total{unmatched} = %v, want at least 1", got)
+	}
+	if _, ok := lookup(t, "events_finalized_total", "status", attendance.StatusPending); ok {
+		t.Errorf("non-terminal status %s counted as finalized", attendance.StatusPending)
+	}
+
+	match, quality := sample(t, "face_match_score"), sample(t, "face_quality_score")
+	metrics.ObserveMatchScore(0.7)
+	metrics.ObserveQualityScore(0.9)
+	if got := sample(t, "face_match_score"); got != match+1 {
+		t.Errorf("face_match_score count = %v, want %v", got, match+1)
+	}
+	if got := sample(t, "face_quality_score"); got != quality+1 {
+		t.Errorf("face_quality_score count = %v, want %v", got, quality+1)
+	}
+}
+
+// The registry after a check-in, its duplicate and the worker processing it.
+func TestScrapeAfterCheckInAndProcess(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ctx := context.Background()
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpsertEmployee(ctx, "emp-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The fake face service embeds every image as this vector.
+	if err := repo.SetEmployeeEmbedding(ctx, "emp-1", []float32{0.1, 0.2, 0.3}); err != nil {
+		t.Fatal(err)
+	}
+
+	created := sample(t, "checkins_total", "result", attendance.CheckinCreated)
+	deduplicated := sample(t, "checkins_total", "result", attendance.CheckinDeduplicated)
+	processed, _ := lookup(t, "events_finalized_total", "status", attendance.StatusProcessed)
+	match, quality := sample(t, "face_match_score"), sample(t, "face_quality_score")
+
+	svc := attendance.NewService(repo, time.Minute)
+	svc.Metrics = metrics.Checkins{}
+	evt, err := svc.CheckIn(ctx, "emp-1", "kiosk-1", "", "https://img.example/a.jpg", time.Time{})
+	if err != nil {
+		t.Fatalf("check in: %v", err)
+	}
+	if _, err := svc.CheckIn(ctx, "emp-1", "kiosk-1", "", "https://img.example/b.jpg", time.Time{}); err == nil {
+		t.Fatal("second check-in within the dedup window was accepted")
+	}
+	d := worker.Deps{Repo: repo, Face: faceclient.New("", true), MatchThreshold: 0.5}
+	if err := worker.ProcessEvent(ctx, d, evt.ID); err != nil {
+		t.Fatalf("ProcessEvent: %v", err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"checkins_total", []string{"result", attendance.CheckinCreated}, created + 1},
+		{"checkins_total", []string{"result", attendance.CheckinDeduplicated}, deduplicated + 1},
+		{"events_finalized_total", []string{"status", attendance.StatusProcessed}, processed + 1},
+		{"face_match_score", nil, match + 1},
+		{"face_quality_score", nil, quality + 1},
+	} {
+		if got := sample(t, c.name, c.labels...); got != c.want {
+			t.Errorf("%s%q = %v, want %v", c.name, c.labels, got, c.want)
+		}
+	}
+}
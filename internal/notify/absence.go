@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"attendance/internal/attendance"
+)
+
+// AbsenceReport emails the employees without a processed check-in on a day.
+type AbsenceReport struct {
+	Repo     *attendance.Repository
+	Notifier *Notifier
+	To       []string
+	// Location defines the report's calendar days and send time; nil is UTC.
+	Location *time.Location
+}
+
+func (a AbsenceReport) location() *time.Location {
+	if a.Location == nil {
+		return time.UTC
+	}
+	return a.Location
+}
+
+// Send composes and queues the report for the day containing day.
+func (a AbsenceReport) Send(ctx context.Context, day time.Time) error {
+	from, to := attendance.DayBounds(day, a.location())
+	present, err := a.Repo.DailyReport(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	employees, err := a.Repo.ListEmployees(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(present))
+	for _, p := range present {
+		seen[p.UserID] = true
+	}
+	data := AbsenceReportData{Date: from.Format(time.DateOnly), Total: len(employees)}
+	for _, e := range employees {
+		if !seen[e.EmployeeID] {
+			data.Absent = append(data.Absent, e)
+		}
+	}
+	msg, err := AbsenceReportMessage(a.To, data)
+	if err != nil {
+		return err
+	}
+	a.Notifier.Enqueue(msg)
+	log.Printf("notify: absence report for %s queued (%d of %d absent)", data.Date, len(data.Absent), data.Total)
+	return nil
+}
+
+// Schedule sends the report every day at the wall-clock time at ("HH:MM") in
+// the report's location until ctx is cancelled.
+func (a AbsenceReport) Schedule(ctx context.Context, at string) error {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return fmt.Errorf("invalid report time %q: %w", at, err)
+	}
+	loc := a.location()
+	for {
+		now := time.Now().In(loc)
+		next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+		if err := a.Send(ctx, next); err != nil && ctx.Err() == nil {
+			log.Printf("notify: absence report failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/testdb"
+)
+
+// The absence report lists the employees without a processed check-in on
+// the report's calendar day and mails it to every admin address.
+func TestAbsenceReportSend(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ctx := context.Background()
+	name := "Ada Lovelace"
+	for _, e := range []struct {
+		id   string
+		name *string
+	}{{"e-1", &name}, {"e-2", nil}, {"e-3", nil}} {
+		if err := repo.UpsertEmployee(ctx, e.id, e.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(user, when string) attendance.Event {
+		ts, _ := time.Parse(time.RFC3339, when)
+		return attendance.Event{UserID: user, DeviceID: "kiosk-1", When: ts, Status: attendance.StatusProcessed}
+	}
+	if _, err := repo.ImportEvents(ctx, []attendance.Event{
+		at("e-2", "2024-03-14T19:00:00Z"), // 00:30 on the 15th in India
+		at("e-3", "2024-03-14T18:00:00Z"), // 23:30 on the 14th
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newFakeSMTP(t, "", "")
+	n := newTestNotifier(srv.mailer(), 8)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := AbsenceReport{Repo: repo, Notifier: n, To: []string{"hr@example.com", "ceo@example.com"}, Location: kolkata}
+	day, _ := time.Parse(time.RFC3339, "2024-03-15T12:00:00+05:30")
+	if err := report.Send(ctx, day); err != nil {
+		t.Fatal(err)
+	}
+	n.Close()
+
+	_, got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(got))
+	}
+	if !slices.Equal(got[0].to, report.To) {
+		t.Errorf("delivered to %v, want %v", got[0].to, report.To)
+	}
+	_, subject, body := parse(t, got[0])
+	if subject != "Absence report 2024-03-15: 2 absent" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"2 of 3 employees", "<td>e-1</td><td>Ada Lovelace</td>", "<td>e-3</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "<td>e-2</td>") {
+		t.Errorf("e-2 checked in but is listed absent:\n%s", body)
+	}
+}
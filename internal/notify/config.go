@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"log"
+
+	"attendance/internal/config"
+)
+
+// FromConfig returns an SMTP mailer when SMTP_HOST is set and a LogMailer otherwise.
+func FromConfig(cfg config.App) Mailer {
+	if cfg.SMTPHost == "" {
+		log.Println("SMTP not configured; notification emails are logged only")
+		return LogMailer{}
+	}
+	return SMTPMailer{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}
+}
@@ -0,0 +1,208 @@
+// Package notify sends HR email (enrollment confirmations, the daily absence
+// report) in the background so the request path never waits on SMTP.
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var sentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "notify_emails_total",
+	Help: "Emails handed to the mailer, by outcome (sent, failed, dropped).",
+}, []string{"outcome"})
+
+// Message is a rendered email.
+type Message struct {
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// Mailer delivers a message.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer writes messages to the log instead of sending them; it is used
+// when SMTP is not configured.
+type LogMailer struct{}
+
+// Send logs the recipients and subject.
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("notify: (no SMTP configured) to=%s subject=%q", strings.Join(msg.To, ","), msg.Subject)
+	return nil
+}
+
+// SMTPMailer sends through an SMTP server, upgrading to TLS with STARTTLS
+// when the server offers it. Auth is skipped when Username is empty.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers msg as a single HTML email to all recipients.
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return nil
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(m.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(msg.To, ", "))
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.HTML, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// Notifier sends messages from a bounded buffer on a background goroutine,
+// retrying failed sends with backoff.
+type Notifier struct {
+	mailer   Mailer
+	messages chan Message
+	attempts int
+	backoff  time.Duration
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewNotifier starts the background sender. buffer bounds the pending messages.
+func NewNotifier(m Mailer, buffer int) *Notifier {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	n := &Notifier{mailer: m, messages: make(chan Message, buffer), attempts: 3, backoff: 2 * time.Second}
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+// Enqueue queues msg. It never blocks; when the buffer is full or the
+// notifier is closed the message is dropped and counted.
+func (n *Notifier) Enqueue(msg Message) {
+	if n == nil || len(msg.To) == 0 {
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		sentTotal.WithLabelValues("dropped").Inc()
+		log.Printf("notify: closed, dropped %q", msg.Subject)
+		return
+	}
+	select {
+	case n.messages <- msg:
+	default:
+		sentTotal.WithLabelValues("dropped").Inc()
+		log.Printf("notify: buffer full, dropped %q", msg.Subject)
+	}
+}
+
+// Close stops accepting messages and waits for pending ones to be sent.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.messages)
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for msg := range n.messages {
+		if err := n.send(msg); err != nil {
+			sentTotal.WithLabelValues("failed").Inc()
+			log.Printf("notify: send %q failed after %d attempts: %v", msg.Subject, n.attempts, err)
+			continue
+		}
+		sentTotal.WithLabelValues("sent").Inc()
+	}
+}
+
+func (n *Notifier) send(msg Message) error {
+	var err error
+	for attempt := 0; attempt < n.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.backoff << (attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = n.mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
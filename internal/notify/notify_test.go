@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/mail"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"attendance/internal/attendance"
+)
+
+// parse reads a delivered message, decoding its subject.
+func parse(t *testing.T, d delivery) (*mail.Message, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(d.data))
+	if err != nil {
+		t.Fatalf("delivered message does not parse: %v\n%s", err, d.data)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg, subject, string(body)
+}
+
+func sent(outcome string) float64 {
+	return testutil.ToFloat64(sentTotal.WithLabelValues(outcome))
+}
+
+// newTestNotifier returns a notifier that retries without waiting.
+func newTestNotifier(m Mailer, buffer int) *Notifier {
+	n := NewNotifier(m, buffer)
+	n.backoff = time.Millisecond
+	return n
+}
+
+func TestSMTPMailerDelivers(t *testing.T) {
+	srv := newFakeSMTP(t, "hr-bot", "s3cret")
+	msg, err := EnrollmentMessage([]string{"hr@example.com", "ops@example.com"}, EnrollmentData{
+		EmployeeID: "e-42",
+		Name:       "Zoë <O'Brien>",
+		PhotoURL:   "https://img.example/e-42.jpg",
+		EnrolledAt: time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.mailer().Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	_, got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(got))
+	}
+	d := got[0]
+	if d.from != "attendance@example.com" || !slices.Equal(d.to, []string{"hr@example.com", "ops@example.com"}) {
+		t.Errorf("envelope from %s to %v", d.from, d.to)
+	}
+	m, subject, body := parse(t, d)
+	if subject != "Employee enrolled: Zoë <O'Brien>" {
+		t.Errorf("subject = %q", subject)
+	}
+	if ct := m.Header.Get("Content-Type"); ct != "text/html; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if to := m.Header.Get("To"); to != "hr@example.com, ops@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	for _, want := range []string{
+		"Zoë &lt;O&#39;Brien&gt; (e-42) was enrolled for face check-in on 2024-03-15 09:30 UTC.",
+		`<a href="https://img.example/e-42.jpg">Enrollment photo</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestSMTPMailerBadCredentials(t *testing.T) {
+	srv := newFakeSMTP(t, "hr-bot", "s3cret")
+	m := srv.mailer()
+	m.Password = "wrong"
+	msg := Message{To: []string{"hr@example.com"}, Subject: "hello", HTML: "<p>hi</p>"}
+	if err := m.Send(context.Background(), msg); err == nil {
+		t.Fatal("Send with a wrong password succeeded")
+	}
+	if _, got := srv.received(); len(got) != 0 {
+		t.Errorf("%d messages delivered without auth", len(got))
+	}
+}
+
+// A header cannot be injected through the subject.
+func TestSMTPMailerSubjectOnOneLine(t *testing.T) {
+	srv := newFakeSMTP(t, "", "")
+	msg := Message{To: []string{"hr@example.com"}, Subject: "Report\r\nBcc: evil@example.com", HTML: "<p>hi</p>"}
+	if err := srv.mailer().Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	_, got := srv.received()
+	if len(got) != 1 {
+		t.Fatalf("%d messages delivered, want 1", len(got))
+	}
+	m, subject, _ := parse(t, got[0])
+	if m.Header.Get("Bcc") != "" || subject != "Report  Bcc: evil@example.com" {
+		t.Errorf("subject = %q, Bcc = %q", subject, m.Header.Get("Bcc"))
+	}
+}
+
+// A temporary SMTP failure is retried; a message that fails every attempt
+// is counted and dropped without holding up the next one.
+func TestNotifierRetries(t *testing.T) {
+	srv := newFakeSMTP(t, "", "")
+	sentBefore, failedBefore := sent("sent"), sent("failed")
+
+	srv.failNext(2)
+	n := newTestNotifier(srv.mailer(), 8)
+	n.NotifyEnrolled([]string{"hr@example.com"}, EnrollmentData{EmployeeID: "e-1", EnrolledAt: time.Now()})
+	n.Close()
+	tries, got := srv.received()
+	if tries != 3 || len(got) != 1 {
+		t.Fatalf("%d MAIL attempts, %d delivered; want 3, 1", tries, len(got))
+	}
+	if _, subject, _ := parse(t, got[0]); subject != "Employee enrolled: e-1" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	srv.failNext(3)
+	n = newTestNotifier(srv.mailer(), 8)
+	n.Enqueue(Message{To: []string{"hr@example.com"}, Subject: "lost", HTML: "<p>lost</p>"})
+	n.Enqueue(Message{To: []string{"hr@example.com"}, Subject: "next", HTML: "<p>next</p>"})
+	n.Close()
+	tries, got = srv.received()
+	if tries != 7 || len(got) != 2 {
+		t.Fatalf("%d MAIL attempts, %d delivered; want 7, 2", tries, len(got))
+	}
+	if _, subject, _ := parse(t, got[1]); subject != "next" {
+		t.Errorf("delivered %q after the failed message, want next", subject)
+	}
+	if d := sent("sent") - sentBefore; d != 2 {
+		t.Errorf("sent counter rose by %v, want 2", d)
+	}
+	if d := sent("failed") - failedBefore; d != 1 {
+		t.Errorf("failed counter rose by %v, want 1", d)
+	}
+}
+
+// blockingMailer holds every send until release is closed.
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(ctx context.Context, _ Message) error {
+	select {
+	case <-m.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue returns at once while the mailer is stuck, dropping what does not
+// fit in the buffer, and after Close.
+func TestEnqueueNeverBlocks(t *testing.T) {
+	m := blockingMailer{release: make(chan struct{})}
+	n := newTestNotifier(m, 2)
+	sentBefore, droppedBefore := sent("sent"), sent("dropped")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 10 {
+			n.Enqueue(Message{To: []string{"hr@example.com"}, Subject: "report"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enqueue blocked on a stuck mailer")
+	}
+	close(m.release)
+	n.Close()
+	n.Enqueue(Message{To: []string{"hr@example.com"}, Subject: "late"})
+
+	delivered, dropped := sent("sent")-sentBefore, sent("dropped")-droppedBefore
+	if delivered < 2 || delivered > 3 || delivered+dropped != 11 {
+		t.Errorf("sent %v, dropped %v; want the buffer (plus one in flight) sent and the rest dropped", delivered, dropped)
+	}
+}
+
+func TestAbsenceReportMessage(t *testing.T) {
+	name, dept := "Ada & Co", "R&D"
+	msg, err := AbsenceReportMessage([]string{"hr@example.com"}, AbsenceReportData{
+		Date:   "2024-03-15",
+		Total:  3,
+		Absent: []attendance.Employee{{EmployeeID: "e-1", Name: &name, Department: &dept}, {EmployeeID: "e-3"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Absence report 2024-03-15: 2 absent" {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+	for _, want := range []string{
+		"Absence report for 2024-03-15: 2 of 3 employees have no check-in.",
+		"<tr><td>e-1</td><td>Ada &amp; Co</td><td>R&amp;D</td></tr>",
+		"<tr><td>e-3</td><td></td><td></td></tr>",
+	} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("body lacks %q:\n%s", want, msg.HTML)
+		}
+	}
+
+	msg, err = AbsenceReportMessage(nil, AbsenceReportData{Date: "2024-03-16", Total: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<table") {
+		t.Errorf("report with nobody absent has a table:\n%s", msg.HTML)
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// delivery is one message accepted by fakeSMTP.
+type delivery struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP is an SMTP server on an ephemeral port that speaks enough of the
+// protocol for net/smtp: EHLO, AUTH PLAIN when credentials are set, MAIL,
+// RCPT, DATA, RSET and QUIT. It does not offer STARTTLS.
+type fakeSMTP struct {
+	ln                 net.Listener
+	username, password string
+
+	mu sync.Mutex
+	// failMail answers that many MAIL commands with a temporary failure.
+	failMail   int
+	mailTries  int
+	deliveries []delivery
+}
+
+func newFakeSMTP(t *testing.T, username, password string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, username: username, password: password}
+	var wg sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+	})
+	return s
+}
+
+// mailer returns an SMTPMailer pointed at the server.
+func (s *fakeSMTP) mailer() SMTPMailer {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return SMTPMailer{Host: "127.0.0.1", Port: addr.Port, Username: s.username, Password: s.password, From: "attendance@example.com"}
+}
+
+func (s *fakeSMTP) failNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failMail = n
+}
+
+func (s *fakeSMTP) received() (tries int, deliveries []delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mailTries, append([]delivery(nil), s.deliveries...)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	authed := s.username == ""
+	var cur delivery
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if s.username != "" {
+				tp.PrintfLine("250-fake")
+				tp.PrintfLine("250 AUTH PLAIN")
+			} else {
+				tp.PrintfLine("250 fake")
+			}
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			creds, err := base64.StdEncoding.DecodeString(resp)
+			if mech != "PLAIN" || err != nil || string(creds) != "\x00"+s.username+"\x00"+s.password {
+				tp.PrintfLine("535 authentication failed")
+				continue
+			}
+			authed = true
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			if !authed {
+				tp.PrintfLine("530 authentication required")
+				continue
+			}
+			s.mu.Lock()
+			s.mailTries++
+			fail := s.failMail > 0
+			if fail {
+				s.failMail--
+			}
+			s.mu.Unlock()
+			if fail {
+				tp.PrintfLine("451 try again later")
+				continue
+			}
+			cur = delivery{from: address(arg)}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			cur.to = append(cur.to, address(arg))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			cur.data = string(data)
+			s.mu.Lock()
+			s.deliveries = append(s.deliveries, cur)
+			s.mu.Unlock()
+			cur = delivery{}
+			tp.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			cur = delivery{}
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// address takes the mailbox out of "FROM:<a@b>" or "TO:<a@b>".
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, "<")
+	addr, _, _ = strings.Cut(addr, ">")
+	return addr
+}
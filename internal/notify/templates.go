@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"time"
+
+	"attendance/internal/attendance"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// EnrollmentData fills the enrollment confirmation.
+type EnrollmentData struct {
+	EmployeeID string
+	Name       string
+	PhotoURL   string
+	EnrolledAt time.Time
+}
+
+// AbsenceReportData fills the daily absence report.
+type AbsenceReportData struct {
+	Date   string
+	Total  int
+	Absent []attendance.Employee
+}
+
+// EnrollmentMessage renders the confirmation sent when an employee is enrolled.
+func EnrollmentMessage(to []string, d EnrollmentData) (Message, error) {
+	subject := "Employee enrolled: " + d.EmployeeID
+	if d.Name != "" {
+		subject = "Employee enrolled: " + d.Name
+	}
+	return render(to, subject, "enrollment.html", d)
+}
+
+// AbsenceReportMessage renders the daily list of employees without a check-in.
+func AbsenceReportMessage(to []string, d AbsenceReportData) (Message, error) {
+	return render(to, fmt.Sprintf("Absence report %s: %d absent", d.Date, len(d.Absent)), "absence_report.html", d)
+}
+
+func render(to []string, subject, name string, data any) (Message, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return Message{}, fmt.Errorf("render %s: %w", name, err)
+	}
+	return Message{To: to, Subject: subject, HTML: buf.String()}, nil
+}
+
+// NotifyEnrolled queues an enrollment confirmation; render errors are logged.
+func (n *Notifier) NotifyEnrolled(to []string, d EnrollmentData) {
+	if n == nil || len(to) == 0 {
+		return
+	}
+	msg, err := EnrollmentMessage(to, d)
+	if err != nil {
+		log.Printf("notify: %v", err)
+		return
+	}
+	n.Enqueue(msg)
+}
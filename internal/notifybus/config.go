@@ -0,0 +1,25 @@
+package notifybus
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/config"
+)
+
+// FromConfig returns the bus selected by NOTIFY_BACKEND, listening on
+// TopicEvents, or nil for "none".
+func FromConfig(cfg config.App, db *sql.DB, redisClient *redis.Client) (Bus, error) {
+	switch cfg.NotifyBackend {
+	case "redis", "":
+		return NewRedis(redisClient, TopicEvents), nil
+	case "postgres":
+		return NewPostgres(cfg.DatabaseURL, db, cfg.DBQueryTimeout, TopicEvents), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown NOTIFY_BACKEND %q", cfg.NotifyBackend)
+	}
+}
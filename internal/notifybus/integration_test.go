@@ -0,0 +1,194 @@
+//go:build integration
+
+// Both backends run the same tests: Redis on miniredis, Postgres on the
+// database TEST_DATABASE_URL names, skipped without it:
+//
+//	TEST_DATABASE_URL=postgres://... go test -tags integration ./internal/notifybus
+//
+// Every test listens on a topic of its own.
+package notifybus
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/testdb"
+)
+
+// testTopic is a topic no other test listens on.
+func testTopic() string {
+	return fmt.Sprintf("it_%d", time.Now().UnixNano())
+}
+
+// run starts bus.Run until the test ends.
+func run(t *testing.T, bus Bus) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// publishUntilDelivered publishes payload on topic until it arrives on ch,
+// skipping Resyncs, for while the listener is (re)connecting.
+func publishUntilDelivered(t *testing.T, bus Bus, topic string, ch <-chan Message, payload string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := bus.Publish(context.Background(), topic, []byte(payload)); err != nil {
+			t.Logf("publish: %v", err)
+		}
+		for wait := time.After(100 * time.Millisecond); ; {
+			select {
+			case m := <-ch:
+				if string(m.Payload) == payload {
+					return
+				}
+				continue
+			case <-wait:
+			}
+			break
+		}
+	}
+	t.Fatalf("%q was never delivered", payload)
+}
+
+// drain discards whatever is waiting on ch.
+func drain(ch <-chan Message) {
+	for {
+		select {
+		case <-ch:
+		case <-time.After(100 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// testBus runs the Bus contract against bus listening on topic. drop cuts
+// its listening connection; backend labels the reconnects counter.
+func testBus(t *testing.T, bus Bus, topic, backend string, drop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := bus.Subscribe(ctx, "not_"+topic); !errors.Is(err, ErrUnknownTopic) {
+		t.Errorf("Subscribe to another topic: %v, want ErrUnknownTopic", err)
+	}
+	first, err := bus.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subCtx, unsubscribe := context.WithCancel(ctx)
+	second, err := bus.Subscribe(subCtx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, bus)
+	publishUntilDelivered(t, bus, topic, first, "ready")
+	drain(first)
+	drain(second)
+
+	t.Run("delivers to every subscriber", func(t *testing.T) {
+		score := 0.93
+		want := EventUpdate{ID: "ev-1", Status: "checked_in", UserID: "e-42", DeviceID: "kiosk-1",
+			When: time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC), MatchScore: &score}
+		payload, _ := json.Marshal(want)
+		if err := bus.Publish(ctx, topic, payload); err != nil {
+			t.Fatal(err)
+		}
+		for _, ch := range []<-chan Message{first, second} {
+			m := next(t, ch)
+			var got EventUpdate
+			if m.Topic != topic || m.Resync || json.Unmarshal(m.Payload, &got) != nil {
+				t.Fatalf("got %+v", m)
+			}
+			if got.ID != want.ID || got.Status != want.Status || !got.When.Equal(want.When) || got.MatchScore == nil || *got.MatchScore != score {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		}
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		unsubscribe()
+		for range second {
+		}
+		if err := bus.Publish(ctx, topic, []byte("after")); err != nil {
+			t.Fatal(err)
+		}
+		if m := next(t, first); string(m.Payload) != "after" {
+			t.Errorf("got %+v", m)
+		}
+	})
+
+	t.Run("resyncs after a reconnect", func(t *testing.T) {
+		reconnects := testutil.ToFloat64(reconnectsTotal.WithLabelValues(backend))
+		drop()
+		// Whatever is published while the listener is away is lost; the
+		// subscriber hears of it through a Resync once it is back.
+		deadline := time.After(30 * time.Second)
+		for resynced := false; !resynced; {
+			select {
+			case m := <-first:
+				resynced = m.Resync
+			case <-deadline:
+				t.Fatal("no Resync after the connection dropped")
+			}
+		}
+		publishUntilDelivered(t, bus, topic, first, "back")
+		if d := testutil.ToFloat64(reconnectsTotal.WithLabelValues(backend)) - reconnects; d != 1 {
+			t.Errorf("reconnects counter rose by %v, want 1", d)
+		}
+	})
+}
+
+func TestRedisBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	topic := testTopic()
+	bus := NewRedis(client, topic)
+
+	testBus(t, bus, topic, "redis", func() {
+		mr.Close()
+		if err := mr.Restart(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPostgresBus(t *testing.T) {
+	dsn := testdb.URL(t)
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	topic := testTopic()
+	bus := NewPostgres(dsn, db, 5*time.Second, topic)
+
+	if err := bus.Publish(context.Background(), topic, []byte(strings.Repeat("x", maxNotifyPayload+1))); err == nil {
+		t.Error("Publish of an oversized payload succeeded")
+	}
+	testBus(t, bus, topic, "postgres", func() {
+		var n int
+		err := db.QueryRow(`SELECT count(pg_terminate_backend(pid)) FROM pg_stat_activity
+			WHERE query = 'LISTEN ' || quote_ident($1)`, topic).Scan(&n)
+		if err != nil || n != 1 {
+			t.Fatalf("terminated %d listeners: %v", n, err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+// Package notifybus carries small change notifications between the API and
+// workers, so dashboards can follow check-ins as they happen. Redis pub/sub
+// and Postgres LISTEN/NOTIFY implement the same Bus; deployments without
+// Redis use the latter.
+//
+// Notifications are best effort. One sent while a listener is reconnecting,
+// or to a subscriber that has fallen behind, is lost; the subscriber gets a
+// Resync message instead and should reload what it shows. Clients should
+// also poll now and then rather than rely on the stream alone.
+package notifybus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// TopicEvents carries an EventUpdate whenever a check-in is stored or
+// settles. Topics double as Postgres channel names.
+const TopicEvents = "attendance_events"
+
+// subscriberBuffer is how many messages may wait for a subscriber; past
+// that, messages to it are dropped and it is sent a Resync.
+const subscriberBuffer = 64
+
+// Reconnection backoff of the listeners.
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// ErrUnknownTopic is returned by Subscribe for a topic the bus does not
+// listen on.
+var ErrUnknownTopic = errors.New("notifybus: unknown topic")
+
+var (
+	droppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifybus_dropped_total",
+		Help: "Notifications dropped because a subscriber was not keeping up.",
+	}, []string{"topic"})
+	reconnectsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifybus_reconnects_total",
+		Help: "Times a notification listener lost its connection and reconnected.",
+	}, []string{"backend"})
+)
+
+// Message is a notification received on a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	// Resync is set on a message without payload that stands in for
+	// notifications that may have been lost.
+	Resync bool
+}
+
+// Bus publishes notifications and fans them out to subscribers in this
+// process.
+type Bus interface {
+	// Publish sends payload to every subscriber of topic, in any process.
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns a channel of the messages on topic, which is closed
+	// once ctx is done.
+	Subscribe(ctx context.Context, topic string) (<-chan Message, error)
+	// Run receives notifications for the subscribers until ctx is done,
+	// reconnecting with backoff when the connection drops. A process that
+	// only publishes does not need it.
+	Run(ctx context.Context)
+}
+
+// EventUpdate is the payload of TopicEvents.
+type EventUpdate struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	UserID     string    `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	When       time.Time `json:"when"`
+	MatchScore *float64  `json:"match_score,omitempty"`
+	// FailureReason is set when the event did not check in for a known
+	// reason, e.g. "no_face" or "timeout".
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// PublishEvent sends u on TopicEvents.
+func PublishEvent(ctx context.Context, bus Bus, u EventUpdate) error {
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return bus.Publish(ctx, TopicEvents, payload)
+}
+
+// fanout hands received messages to the subscribers of a fixed set of
+// topics without ever blocking the listener.
+type fanout struct {
+	mu   sync.Mutex
+	subs map[string]map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch chan Message
+	// missed is set once a message to the subscriber was dropped, until it
+	// has been sent a Resync.
+	missed bool
+}
+
+func newFanout(topics []string) *fanout {
+	f := &fanout{subs: make(map[string]map[*subscriber]struct{}, len(topics))}
+	for _, t := range topics {
+		f.subs[t] = map[*subscriber]struct{}{}
+	}
+	return f
+}
+
+func (f *fanout) subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subs, ok := f.subs[topic]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTopic, topic)
+	}
+	s := &subscriber{ch: make(chan Message, subscriberBuffer)}
+	subs[s] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(subs, s)
+		close(s.ch)
+		f.mu.Unlock()
+	}()
+	return s.ch, nil
+}
+
+// deliver passes m to the subscribers of its topic. One whose buffer is
+// full loses m and gets a Resync ahead of its next message.
+func (f *fanout) deliver(m Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs[m.Topic] {
+		if s.missed {
+			select {
+			case s.ch <- Message{Topic: m.Topic, Resync: true}:
+				s.missed = false
+			default:
+				droppedTotal.WithLabelValues(m.Topic).Inc()
+				continue
+			}
+		}
+		select {
+		case s.ch <- m:
+		default:
+			s.missed = true
+			droppedTotal.WithLabelValues(m.Topic).Inc()
+		}
+	}
+}
+
+// resync tells every subscriber that notifications may have been lost,
+// after the listener reconnected.
+func (f *fanout) resync() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for topic, subs := range f.subs {
+		for s := range subs {
+			select {
+			case s.ch <- Message{Topic: topic, Resync: true}:
+				s.missed = false
+			default:
+				s.missed = true
+			}
+		}
+	}
+}
+
+// sleep waits d or until ctx is done, reporting whether ctx is still live.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// nextBackoff doubles d up to maxBackoff.
+func nextBackoff(d time.Duration) time.Duration {
+	if d *= 2; d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,141 @@
+package notifybus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// next returns the message waiting on ch, failing the test if there is none.
+func next(t *testing.T, ch <-chan Message) Message {
+	t.Helper()
+	select {
+	case m, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message")
+	}
+	return Message{}
+}
+
+// empty fails the test if a message is waiting on ch.
+func empty(t *testing.T, ch <-chan Message) {
+	t.Helper()
+	select {
+	case m := <-ch:
+		t.Fatalf("unexpected message %+v", m)
+	default:
+	}
+}
+
+func TestFanoutDelivers(t *testing.T) {
+	f := newFanout([]string{"a", "b"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a1, _ := f.subscribe(ctx, "a")
+	a2, _ := f.subscribe(ctx, "a")
+	b, _ := f.subscribe(ctx, "b")
+	if _, err := f.subscribe(ctx, "c"); !errors.Is(err, ErrUnknownTopic) {
+		t.Errorf("subscribe to an unknown topic: %v, want ErrUnknownTopic", err)
+	}
+
+	f.deliver(Message{Topic: "a", Payload: []byte("1")})
+	for _, ch := range []<-chan Message{a1, a2} {
+		if m := next(t, ch); m.Topic != "a" || string(m.Payload) != "1" || m.Resync {
+			t.Errorf("got %+v", m)
+		}
+	}
+	empty(t, b)
+
+	f.resync()
+	for _, ch := range []<-chan Message{a1, a2, b} {
+		if m := next(t, ch); !m.Resync || m.Payload != nil {
+			t.Errorf("got %+v, want a Resync", m)
+		}
+	}
+}
+
+// Cancelling a subscription's context closes its channel and stops delivery
+// to it, without affecting the others.
+func TestFanoutUnsubscribe(t *testing.T) {
+	f := newFanout([]string{"a"})
+	ctx, cancel := context.WithCancel(context.Background())
+	gone, _ := f.subscribe(ctx, "a")
+	stays, _ := f.subscribe(context.Background(), "a")
+	cancel()
+	select {
+	case _, ok := <-gone:
+		if ok {
+			t.Fatal("message on a cancelled subscription")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled subscription was not closed")
+	}
+	f.deliver(Message{Topic: "a", Payload: []byte("1")})
+	if m := next(t, stays); string(m.Payload) != "1" {
+		t.Errorf("got %+v", m)
+	}
+}
+
+// A subscriber that falls behind loses what does not fit in its buffer and
+// is told so with a Resync ahead of the next message that fits, while the
+// others get everything.
+func TestFanoutSlowSubscriber(t *testing.T) {
+	f := newFanout([]string{"a"})
+	slow, _ := f.subscribe(context.Background(), "a")
+	fast, _ := f.subscribe(context.Background(), "a")
+	dropped := testutil.ToFloat64(droppedTotal.WithLabelValues("a"))
+
+	for i := range subscriberBuffer + 3 {
+		f.deliver(Message{Topic: "a", Payload: []byte(fmt.Sprint(i))})
+		if m := next(t, fast); string(m.Payload) != fmt.Sprint(i) {
+			t.Fatalf("fast subscriber got %+v, want %d", m, i)
+		}
+	}
+	if d := testutil.ToFloat64(droppedTotal.WithLabelValues("a")) - dropped; d != 3 {
+		t.Errorf("dropped counter rose by %v, want 3", d)
+	}
+	for i := range subscriberBuffer {
+		if m := next(t, slow); string(m.Payload) != fmt.Sprint(i) {
+			t.Fatalf("slow subscriber got %+v, want %d", m, i)
+		}
+	}
+	empty(t, slow)
+
+	f.deliver(Message{Topic: "a", Payload: []byte("later")})
+	if m := next(t, slow); !m.Resync {
+		t.Errorf("got %+v, want a Resync first", m)
+	}
+	if m := next(t, slow); string(m.Payload) != "later" {
+		t.Errorf("got %+v, want the next message", m)
+	}
+	next(t, fast)
+
+	// Once caught up it gets no further Resync.
+	f.deliver(Message{Topic: "a", Payload: []byte("again")})
+	if m := next(t, slow); m.Resync || string(m.Payload) != "again" {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	d := minBackoff
+	var got []time.Duration
+	for range 8 {
+		d = nextBackoff(d)
+		got = append(got, d)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, maxBackoff, maxBackoff, maxBackoff}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("backoff steps %v, want %v", got, want)
+		}
+	}
+}
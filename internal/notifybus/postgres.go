@@ -0,0 +1,104 @@
+package notifybus
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxNotifyPayload is the largest payload Postgres NOTIFY accepts.
+const maxNotifyPayload = 7999
+
+// Postgres is a Bus over LISTEN/NOTIFY. Notifications are sent through the
+// shared pool; receiving needs a connection of its own, which Run opens
+// with pgx directly since database/sql cannot wait for notifications.
+type Postgres struct {
+	dsn     string
+	db      *sql.DB
+	timeout time.Duration
+	topics  []string
+	fan     *fanout
+}
+
+// NewPostgres returns a bus that publishes through db, each NOTIFY bounded
+// by queryTimeout, and listens on topics over its own connection to dsn.
+func NewPostgres(dsn string, db *sql.DB, queryTimeout time.Duration, topics ...string) *Postgres {
+	return &Postgres{dsn: dsn, db: db, timeout: queryTimeout, topics: topics, fan: newFanout(topics)}
+}
+
+// Publish implements Bus. A notification sent inside a transaction would be
+// delivered on commit; this one is sent on its own.
+func (b *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("notifybus: %d-byte payload exceeds the NOTIFY limit", len(payload))
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	_, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, topic, string(payload))
+	return err
+}
+
+// Subscribe implements Bus.
+func (b *Postgres) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	return b.fan.subscribe(ctx, topic)
+}
+
+// Run implements Bus. Whenever the listening connection is lost it
+// reconnects with backoff, and once listening again resyncs subscribers for
+// whatever was sent in between.
+func (b *Postgres) Run(ctx context.Context) {
+	backoff := minBackoff
+	for connected := false; ctx.Err() == nil; {
+		conn, err := b.listen(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("notifybus: postgres listen failed, retrying in %s: %v", backoff, err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minBackoff
+		if connected {
+			reconnectsTotal.WithLabelValues("postgres").Inc()
+			b.fan.resync()
+		}
+		connected = true
+
+		for {
+			n, err := conn.WaitForNotification(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("notifybus: postgres listener lost its connection: %v", err)
+				}
+				break
+			}
+			b.fan.deliver(Message{Topic: n.Channel, Payload: []byte(n.Payload)})
+		}
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		conn.Close(closeCtx)
+		cancel()
+	}
+}
+
+// listen opens a connection and LISTENs on every topic.
+func (b *Postgres) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range b.topics {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{t}.Sanitize()); err != nil {
+			conn.Close(context.Background())
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,81 @@
+package notifybus
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Bus over Redis pub/sub. Topics are prefixed to keep them apart
+// from other channels.
+type Redis struct {
+	client *redis.Client
+	topics []string
+	fan    *fanout
+}
+
+const redisPrefix = "attendance:notify:"
+
+// NewRedis returns a bus on client that listens on topics.
+func NewRedis(client *redis.Client, topics ...string) *Redis {
+	return &Redis{client: client, topics: topics, fan: newFanout(topics)}
+}
+
+// Publish implements Bus.
+func (b *Redis) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, redisPrefix+topic, payload).Err()
+}
+
+// Subscribe implements Bus.
+func (b *Redis) Subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	return b.fan.subscribe(ctx, topic)
+}
+
+// Run implements Bus. go-redis reconnects and subscribes again on its own;
+// every subscription confirmation after the first round marks a reconnect,
+// after which subscribers are resynced.
+func (b *Redis) Run(ctx context.Context) {
+	channels := make([]string, len(b.topics))
+	for i, t := range b.topics {
+		channels[i] = redisPrefix + t
+	}
+	ps := b.client.Subscribe(ctx, channels...)
+	// Receive does not return when ctx is done while it waits for a message;
+	// closing the subscription does.
+	stop := context.AfterFunc(ctx, func() { ps.Close() })
+	defer func() {
+		if stop() {
+			ps.Close()
+		}
+	}()
+
+	confirmed, backoff := 0, minBackoff
+	for {
+		msg, err := ps.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("notifybus: redis receive failed, retrying in %s: %v", backoff, err)
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = minBackoff
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			if m.Kind != "subscribe" {
+				continue
+			}
+			if confirmed++; confirmed > len(channels) {
+				reconnectsTotal.WithLabelValues("redis").Inc()
+				b.fan.resync()
+			}
+		case *redis.Message:
+			b.fan.deliver(Message{Topic: m.Channel[len(redisPrefix):], Payload: []byte(m.Payload)})
+		}
+	}
+}
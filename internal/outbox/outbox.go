@@ -0,0 +1,103 @@
+// Package outbox relays messages from the outbox table to the queue. The API
+// still publishes check-ins directly; the relay only picks up messages that
+// publish did not confirm within Grace, e.g. because the queue was down or
+// the process died between the commit and the publish. Consumers skip events
+// that are no longer pending, so a message sent twice is harmless.
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+	"attendance/internal/queue"
+)
+
+var (
+	dispatched = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_dispatched_total",
+		Help: "Outbox messages published by the relay.",
+	})
+	publishErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_publish_errors_total",
+		Help: "Relay attempts to publish an outbox message that failed.",
+	})
+	backlog = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "outbox_pending",
+		Help: "Outbox messages not yet dispatched.",
+	})
+)
+
+// Relay polls the outbox and publishes what it finds.
+type Relay struct {
+	Repo  *attendance.Repository
+	Queue queue.Queue
+	// Interval between polls; a full batch is followed by another poll at once.
+	Interval time.Duration
+	// Grace is how long a message is left for the direct publish to confirm.
+	Grace     time.Duration
+	BatchSize int
+	// Retain is how long dispatched rows are kept; 0 keeps them forever.
+	Retain time.Duration
+}
+
+// Run polls until ctx is cancelled.
+func (r Relay) Run(ctx context.Context) {
+	if r.BatchSize <= 0 {
+		r.BatchSize = 100
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		r.drain(ctx)
+		if r.Retain > 0 && time.Since(lastPurge) > time.Hour {
+			if n, err := r.Repo.PurgeOutbox(ctx, time.Now().Add(-r.Retain)); err != nil {
+				log.Printf("outbox purge failed: %v", err)
+			} else if n > 0 {
+				log.Printf("outbox: purged %d dispatched messages", n)
+			}
+			lastPurge = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain dispatches batches until one comes back short or fails.
+func (r Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := r.Repo.DispatchOutbox(ctx, r.Grace, r.BatchSize, r.publish)
+		dispatched.Add(float64(n))
+		if n > 0 {
+			log.Printf("outbox: relayed %d messages", n)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("outbox relay failed: %v", err)
+			}
+			break
+		}
+		if n < r.BatchSize {
+			break
+		}
+	}
+	if n, err := r.Repo.OutboxBacklog(ctx); err == nil {
+		backlog.Set(float64(n))
+	}
+}
+
+func (r Relay) publish(ctx context.Context, m attendance.OutboxMessage) error {
+	err := r.Queue.Publish(ctx, m.Queue, queue.Message{Type: m.Type, Body: m.Body, Key: m.Key})
+	if err != nil {
+		publishErrors.Inc()
+	}
+	return err
+}
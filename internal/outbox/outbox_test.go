@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/queue"
+	"attendance/internal/testdb"
+)
+
+// recorder is a queue that remembers what was published. fail, when set,
+// decides per message whether the publish fails; after runs once a message
+// has been accepted, to simulate a crash right after the publish.
+type recorder struct {
+	queue.Queue
+
+	mu    sync.Mutex
+	sent  []string
+	fail  func(key string) error
+	after func()
+}
+
+func (r *recorder) Publish(ctx context.Context, name string, msg queue.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil {
+		if err := r.fail(msg.Key); err != nil {
+			return err
+		}
+	}
+	r.sent = append(r.sent, msg.Key)
+	if r.after != nil {
+		r.after()
+	}
+	return nil
+}
+
+func (r *recorder) keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.sent)
+}
+
+// checkIns stores n check-ins whose direct publish never happened, as if the
+// API died right after the commit, and returns their event ids in order.
+func checkIns(t *testing.T, repo *attendance.Repository, n int) []string {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	svc := attendance.NewService(repo, time.Minute)
+	var ids []string
+	for i := range n {
+		user := fmt.Sprintf("emp-%d", i)
+		if err := repo.UpsertEmployee(ctx, user, nil); err != nil {
+			t.Fatal(err)
+		}
+		evt, err := svc.CheckIn(ctx, user, "kiosk-1", "", "", time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, evt.ID)
+	}
+	return ids
+}
+
+func backlogOf(t *testing.T, repo *attendance.Repository) int64 {
+	t.Helper()
+	n, err := repo.OutboxBacklog(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// Check-ins committed by an API that died before publishing are picked up
+// once their grace period is over, and only then.
+func TestRelayRecoversUnpublishedCheckins(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ids := checkIns(t, repo, 3)
+	q := &recorder{}
+
+	Relay{Repo: repo, Queue: q, Grace: time.Hour, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); len(got) != 0 {
+		t.Fatalf("relayed %v inside the grace period", got)
+	}
+
+	Relay{Repo: repo, Queue: q, BatchSize: 2}.drain(context.Background())
+	if got := q.keys(); !slices.Equal(got, ids) {
+		t.Errorf("relayed %v, want %v oldest first", got, ids)
+	}
+	if n := backlogOf(t, repo); n != 0 {
+		t.Errorf("backlog %d after the relay, want 0", n)
+	}
+	// Nothing is sent twice once it is marked dispatched.
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); len(got) != len(ids) {
+		t.Errorf("second pass relayed %v again", got[len(ids):])
+	}
+}
+
+// A message the API did publish and mark is left alone.
+func TestRelaySkipsDispatched(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ids := checkIns(t, repo, 2)
+	if err := repo.MarkOutboxDispatched(context.Background(), queue.Checkins, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	q := &recorder{}
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); !slices.Equal(got, ids[1:]) {
+		t.Errorf("relayed %v, want only %v", got, ids[1:])
+	}
+}
+
+// With the queue down the relay stops at the first failure and keeps the
+// rest; the next pass after the queue is back sends what is left.
+func TestRelayQueueDown(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ids := checkIns(t, repo, 3)
+	down := errors.New("queue unreachable")
+	q := &recorder{fail: func(key string) error {
+		if key == ids[1] {
+			return down
+		}
+		return nil
+	}}
+
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); !slices.Equal(got, ids[:1]) {
+		t.Fatalf("relayed %v with the queue failing, want %v", got, ids[:1])
+	}
+	if n := backlogOf(t, repo); n != 2 {
+		t.Fatalf("backlog %d, want the failed message and the one after it", n)
+	}
+
+	q.fail = nil
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); !slices.Equal(got, ids) {
+		t.Errorf("relayed %v after the queue came back, want %v", got, ids)
+	}
+	if n := backlogOf(t, repo); n != 0 {
+		t.Errorf("backlog %d, want 0", n)
+	}
+}
+
+// A relay that dies after publishing but before its transaction commits
+// leaves the rows undispatched; the next relay sends them again. Consumers
+// skip events that are no longer pending, so at-least-once is enough.
+func TestRelayCrashBeforeCommit(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ids := checkIns(t, repo, 2)
+
+	ctx, crash := context.WithCancel(context.Background())
+	q := &recorder{after: crash}
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(ctx)
+	if n := backlogOf(t, repo); n != 2 {
+		t.Fatalf("backlog %d after the crash, want both messages kept", n)
+	}
+
+	q.after = nil
+	Relay{Repo: repo, Queue: q, BatchSize: 10}.drain(context.Background())
+	if got := q.keys(); !slices.Equal(got[len(got)-2:], ids) {
+		t.Errorf("relayed %v, want %v resent after the crash", got, ids)
+	}
+	if n := backlogOf(t, repo); n != 0 {
+		t.Errorf("backlog %d, want 0", n)
+	}
+}
+
+// Two relays polling at once split the backlog between them.
+func TestRelaysShareBacklog(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ids := checkIns(t, repo, 20)
+	q := &recorder{}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Relay{Repo: repo, Queue: q, BatchSize: 3}.drain(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	got := q.keys()
+	slices.Sort(got)
+	want := slices.Clone(ids)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("relayed %d messages %v, want each of the %d once", len(got), got, len(ids))
+	}
+}
@@ -0,0 +1,201 @@
+// Package pdfreport renders printable daily attendance sheets: one row per
+// employee with their check-in times, status and room for a signature.
+package pdfreport
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"attendance/internal/attendance"
+)
+
+// Statuses of a row.
+const (
+	StatusPresent = "present"
+	StatusLate    = "late"
+	StatusAbsent  = "absent"
+)
+
+// Row is one person on the sheet.
+type Row struct {
+	UserID string
+	Name   string
+	// FirstCheckIn and LastCheckIn are nil for someone absent.
+	FirstCheckIn *time.Time
+	LastCheckIn  *time.Time
+	Status       string
+}
+
+// Sheet is the content of one daily sheet.
+type Sheet struct {
+	Organization string
+	// LogoPath is a PNG or JPEG shown beside the organization name; empty
+	// shows none.
+	LogoPath string
+	// FontPath is a TrueType font with the glyphs of the labels and names.
+	// Empty uses Helvetica, which only covers Western European text.
+	FontPath    string
+	Date        string
+	Timezone    string
+	GeneratedAt time.Time
+	Rows        []Row
+}
+
+// Translate looks up a label, such as i18n.Localizer.T.
+type Translate func(key string, args ...any) string
+
+// Roster lists every employee, present or not, followed by anyone in the
+// report who is not an employee, ordered by user id. Check-in times are
+// shown in loc; a first check-in with late minutes makes the row late.
+func Roster(employees []attendance.Employee, report []attendance.DailyAttendance, loc *time.Location) []Row {
+	byUser := make(map[string]attendance.DailyAttendance, len(report))
+	for _, d := range report {
+		byUser[d.UserID] = d
+	}
+	rows := make([]Row, 0, len(employees))
+	listed := make(map[string]bool, len(employees))
+	add := func(userID, name string) {
+		listed[userID] = true
+		row := Row{UserID: userID, Name: name, Status: StatusAbsent}
+		if d, ok := byUser[userID]; ok {
+			first, last := d.FirstCheckIn.In(loc), d.LastCheckIn.In(loc)
+			row.FirstCheckIn, row.LastCheckIn, row.Status = &first, &last, StatusPresent
+			if d.LateMinutes != nil && *d.LateMinutes > 0 {
+				row.Status = StatusLate
+			}
+		}
+		rows = append(rows, row)
+	}
+	for _, e := range employees {
+		name := ""
+		if e.Name != nil {
+			name = *e.Name
+		}
+		add(e.EmployeeID, name)
+	}
+	for _, d := range report {
+		if !listed[d.UserID] {
+			add(d.UserID, "")
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].UserID < rows[j].UserID })
+	return rows
+}
+
+// column is a table column: its label key and width in millimetres.
+type column struct {
+	label string
+	width float64
+}
+
+var columns = []column{
+	{"#", 10},
+	{"report.user_id", 28},
+	{"report.name", 46},
+	{"report.first_check_in", 22},
+	{"report.last_check_in", 22},
+	{"report.status", 18},
+	{"report.signature", 34},
+}
+
+const (
+	margin    = 15.0
+	rowHeight = 9.0
+)
+
+// Render writes the sheet as an A4 PDF. Rows that do not fit on a page
+// continue on the next, under the same headers.
+func Render(w io.Writer, s Sheet, t Translate) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+5)
+	pdf.AliasNbPages("")
+
+	family, text := "Helvetica", pdf.UnicodeTranslatorFromDescriptor("")
+	if s.FontPath != "" {
+		family, text = "body", func(s string) string { return s }
+		pdf.AddUTF8Font(family, "", s.FontPath)
+		pdf.AddUTF8Font(family, "B", s.FontPath)
+	}
+	if err := pdf.Error(); err != nil {
+		return fmt.Errorf("load font: %w", err)
+	}
+
+	pdf.SetHeaderFunc(func() {
+		top := pdf.GetY()
+		left := margin
+		if s.LogoPath != "" {
+			pdf.ImageOptions(s.LogoPath, margin, top, 0, 16, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+			left += 22
+		}
+		pdf.SetXY(left, top)
+		pdf.SetFont(family, "B", 15)
+		pdf.CellFormat(0, 8, text(s.Organization), "", 1, "L", false, 0, "")
+		pdf.SetX(left)
+		pdf.SetFont(family, "", 10)
+		pdf.CellFormat(0, 6, text(fmt.Sprintf("%s  |  %s (%s)", t("report.title"), s.Date, s.Timezone)), "", 1, "L", false, 0, "")
+		pdf.SetY(top + 20)
+
+		pdf.SetFont(family, "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for _, col := range columns {
+			label := col.label
+			if strings.HasPrefix(label, "report.") {
+				label = t(label)
+			}
+			pdf.CellFormat(col.width, 8, text(label), "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont(family, "", 9)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin)
+		pdf.SetFont(family, "", 8)
+		pdf.CellFormat(0, 5, text(t("report.generated", s.GeneratedAt.Format("2006-01-02 15:04 MST"))), "", 0, "L", false, 0, "")
+		pdf.SetX(margin)
+		pdf.CellFormat(0, 5, text(t("report.page", pdf.PageNo(), "{nb}")), "", 0, "R", false, 0, "")
+	})
+
+	pdf.AddPage()
+	if len(s.Rows) == 0 {
+		pdf.CellFormat(0, rowHeight, text(t("report.empty")), "1", 1, "C", false, 0, "")
+	}
+	for i, r := range s.Rows {
+		cells := []string{
+			fmt.Sprint(i + 1), r.UserID, r.Name,
+			clock(r.FirstCheckIn), clock(r.LastCheckIn), t("report." + r.Status), "",
+		}
+		for j, col := range columns {
+			pdf.CellFormat(col.width, rowHeight, fit(pdf, text, cells[j], col.width), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	return pdf.Output(w)
+}
+
+// clock formats a check-in time as HH:MM, or a dash for none.
+func clock(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("15:04")
+}
+
+// fit encodes s with text, shortened with an ellipsis until it fits in a
+// cell width wide.
+func fit(pdf *fpdf.Fpdf, text func(string) string, s string, width float64) string {
+	const padding = 2
+	if out := text(s); pdf.GetStringWidth(out) <= width-padding {
+		return out
+	}
+	r := []rune(s)
+	for len(r) > 0 && pdf.GetStringWidth(text(string(r)+"...")) > width-padding {
+		r = r[:len(r)-1]
+	}
+	return text(string(r) + "...")
+}
@@ -0,0 +1,186 @@
+package pdfreport
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+
+	"attendance/internal/attendance"
+	"attendance/internal/i18n"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden from the current output")
+
+// pageTexts renders s in English and returns the text of each page.
+func pageTexts(t *testing.T, s Sheet) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Render(&buf, s, i18n.New("en").T); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("output is not a PDF: %.20q", buf.Bytes())
+	}
+	r, err := pdf.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := make([]string, r.NumPage())
+	for i := range pages {
+		var b strings.Builder
+		for _, text := range r.Page(i + 1).Content().Text {
+			b.WriteString(text.S)
+		}
+		pages[i] = b.String()
+	}
+	return pages
+}
+
+// golden compares got with testdata/name, or rewrites it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("text differs from %s (run with -update if the change is intended):\n%s", path, got)
+	}
+}
+
+// testLogo writes a small PNG logo.
+func testLogo(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "logo.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testSheet(rows []Row) Sheet {
+	return Sheet{
+		Organization: "Springfield Elementary",
+		Date:         "2024-03-15",
+		Timezone:     "Asia/Kolkata",
+		GeneratedAt:  time.Date(2024, 3, 16, 8, 0, 0, 0, time.UTC),
+		Rows:         rows,
+	}
+}
+
+// A roster longer than a page continues on further pages, each with the
+// organization, date and column headers, and numbered out of the total.
+func TestRenderPaginates(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	rows := make([]Row, 60)
+	for i := range rows {
+		first := time.Date(2024, 3, 15, 9, i%60, 0, 0, loc)
+		last := first.Add(8 * time.Hour)
+		rows[i] = Row{UserID: fmt.Sprintf("s-%03d", i+1), Name: fmt.Sprintf("Student %d", i+1),
+			FirstCheckIn: &first, LastCheckIn: &last, Status: StatusPresent}
+	}
+	rows[1].Status = StatusLate
+	rows[2] = Row{UserID: "s-003", Name: "Student 3", Status: StatusAbsent}
+	rows[3].Name = "Maximiliana Bartholomew-Featherstonehaugh"
+	s := testSheet(rows)
+	s.LogoPath = testLogo(t)
+
+	pages := pageTexts(t, s)
+	if len(pages) != 3 {
+		t.Fatalf("%d pages, want 3", len(pages))
+	}
+	for i, page := range pages {
+		for _, want := range []string{
+			"Springfield Elementary",
+			"Daily attendance sheet  |  2024-03-15 (Asia/Kolkata)",
+			"UserNameFirst check-inLast check-inStatusSignature",
+			fmt.Sprintf("Page %d of 3", i+1),
+			"Generated 2024-03-16 08:00 UTC",
+		} {
+			if !strings.Contains(page, want) {
+				t.Errorf("page %d lacks %q:\n%s", i+1, want, page)
+			}
+		}
+	}
+	for _, want := range []string{
+		"1s-001Student 109:0017:00Present",
+		"2s-002Student 209:0117:01Late",
+		"3s-003Student 3--Absent",
+		"4s-004Maximiliana Bartholomew-Fe...09:03",
+	} {
+		if !strings.Contains(pages[0], want) {
+			t.Errorf("page 1 lacks %q:\n%s", want, pages[0])
+		}
+	}
+	if !strings.Contains(pages[2], "60s-060Student 60") || strings.Contains(pages[2], "s-001") {
+		t.Errorf("page 3 does not end the roster:\n%s", pages[2])
+	}
+	golden(t, "sheet.golden", strings.Join(pages, "\n\f\n"))
+}
+
+func TestRenderEmpty(t *testing.T) {
+	pages := pageTexts(t, testSheet(nil))
+	if len(pages) != 1 || !strings.Contains(pages[0], "No employees") || !strings.Contains(pages[0], "Page 1 of 1") {
+		t.Errorf("pages = %q, want one saying there are no employees", pages)
+	}
+}
+
+func TestRenderBadFont(t *testing.T) {
+	s := testSheet(nil)
+	s.FontPath = filepath.Join(t.TempDir(), "missing.ttf")
+	if err := Render(&bytes.Buffer{}, s, i18n.New("en").T); err == nil {
+		t.Error("Render with a missing font succeeded")
+	}
+}
+
+func TestRoster(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Kolkata")
+	ada, late := "Ada", 12
+	at := time.Date(2024, 3, 15, 3, 30, 0, 0, time.UTC) // 09:00 in Kolkata
+	rows := Roster(
+		[]attendance.Employee{{EmployeeID: "e-2"}, {EmployeeID: "e-1", Name: &ada}, {EmployeeID: "e-3"}},
+		[]attendance.DailyAttendance{
+			{UserID: "e-1", FirstCheckIn: at, LastCheckIn: at.Add(8 * time.Hour)},
+			{UserID: "e-3", FirstCheckIn: at.Add(12 * time.Minute), LastCheckIn: at.Add(time.Hour), LateMinutes: &late},
+			{UserID: "visitor", FirstCheckIn: at, LastCheckIn: at},
+		}, loc)
+
+	want := []struct{ user, name, first, last, status string }{
+		{"e-1", "Ada", "09:00", "17:00", StatusPresent},
+		{"e-2", "", "-", "-", StatusAbsent},
+		{"e-3", "", "09:12", "10:00", StatusLate},
+		{"visitor", "", "09:00", "09:00", StatusPresent},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.UserID != w.user || r.Name != w.name || clock(r.FirstCheckIn) != w.first || clock(r.LastCheckIn) != w.last || r.Status != w.status {
+			t.Errorf("row %d = %s %q %s %s %s, want %+v", i, r.UserID, r.Name, clock(r.FirstCheckIn), clock(r.LastCheckIn), r.Status, w)
+		}
+	}
+}
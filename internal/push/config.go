@@ -0,0 +1,28 @@
+package push
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"attendance/internal/config"
+)
+
+// FromConfig returns an FCM sender when FCM_SERVICE_ACCOUNT_FILE is set and
+// Disabled otherwise.
+func FromConfig(cfg config.App) (Sender, error) {
+	if cfg.FCMServiceAccountFile == "" {
+		log.Println("FCM not configured; check-in results are not pushed to devices")
+		return Disabled{}, nil
+	}
+	key, err := os.ReadFile(cfg.FCMServiceAccountFile)
+	if err != nil {
+		return nil, fmt.Errorf("fcm: read service account: %w", err)
+	}
+	fcm, err := NewFCM(key, cfg.FCMProjectID)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("FCM push configured for project", fcm.projectID)
+	return fcm, nil
+}
@@ -0,0 +1,190 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmEndpoint = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+)
+
+// serviceAccount is the part of a Google service account key file FCM needs.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// FCM sends through the Firebase Cloud Messaging HTTP v1 API, authenticating
+// with a service account. Access tokens are cached until shortly before they
+// expire.
+type FCM struct {
+	HTTP *http.Client
+
+	projectID string
+	account   serviceAccount
+	endpoint  string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewFCM parses a service account key file. projectID overrides the key's
+// own project when set.
+func NewFCM(serviceAccountJSON []byte, projectID string) (*FCM, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("fcm: parse service account: %w", err)
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("fcm: service account needs client_email and private_key")
+	}
+	if projectID == "" {
+		projectID = sa.ProjectID
+	}
+	if projectID == "" {
+		return nil, errors.New("fcm: project id missing from config and service account")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &FCM{
+		HTTP:      &http.Client{Timeout: 10 * time.Second},
+		projectID: projectID,
+		account:   sa,
+		endpoint:  fmt.Sprintf(fcmEndpoint, url.PathEscape(projectID)),
+	}, nil
+}
+
+// Send delivers msg as a data message. An unknown or expired token returns
+// ErrUnregistered and other client errors ErrRejected; throttling and server
+// errors are returned as is, for the caller to retry.
+func (f *FCM) Send(ctx context.Context, msg Message) error {
+	token, err := f.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]any{
+		"message": map[string]any{
+			"token":   msg.Token,
+			"data":    msg.Data(),
+			"android": map[string]any{"priority": "high"},
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	var out struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(raw, &out)
+	detail := out.Error.Status
+	for _, d := range out.Error.Details {
+		if d.ErrorCode != "" {
+			detail = d.ErrorCode
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		// The cached token may have been revoked; fetch a new one next time.
+		f.mu.Lock()
+		f.token = ""
+		f.mu.Unlock()
+		return fmt.Errorf("fcm: %s: %s", resp.Status, out.Error.Message)
+	case detail == "UNREGISTERED" || resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrUnregistered, out.Error.Message)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("fcm: %s: %s", resp.Status, out.Error.Message)
+	default:
+		return fmt.Errorf("%w: %s %s: %s", ErrRejected, resp.Status, detail, out.Error.Message)
+	}
+}
+
+// accessToken returns a cached OAuth2 token or exchanges a signed JWT
+// assertion for a new one.
+func (f *FCM) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Until(f.expiry) > time.Minute {
+		return f.token, nil
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(f.account.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("fcm: parse private key: %w", err)
+	}
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   f.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("fcm: sign assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fcm: token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return "", fmt.Errorf("fcm: token request: %s: %s", resp.Status, raw)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("fcm: decode token: %w", err)
+	}
+	f.token = out.AccessToken
+	f.expiry = now.Add(time.Duration(out.ExpiresIn) * time.Second)
+	return f.token, nil
+}
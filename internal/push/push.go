@@ -0,0 +1,204 @@
+// Package push tells devices when their check-ins finish processing, so
+// companion apps need not poll GET /v1/events/:id. Sends happen in the
+// background and are retried; without a configured sender nothing is sent.
+package push
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var sentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "push_notifications_total",
+	Help: "Push notifications for check-in results, by outcome (sent, failed, dropped, unregistered).",
+}, []string{"outcome"})
+
+// ErrUnregistered means the push token is no longer valid; it is deleted
+// rather than retried.
+var ErrUnregistered = errors.New("push token unregistered")
+
+// ErrRejected means the push service refused the message for a reason a
+// retry will not fix.
+var ErrRejected = errors.New("push message rejected")
+
+// Message is a check-in result for one device token.
+type Message struct {
+	Token   string
+	EventID string
+	Status  string
+}
+
+// Data is the payload delivered to the app.
+func (m Message) Data() map[string]string {
+	return map[string]string{
+		"type":     "checkin_result",
+		"event_id": m.EventID,
+		"status":   m.Status,
+	}
+}
+
+// Sender delivers a message to a device token.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Disabled sends nothing; it is used when no push service is configured.
+type Disabled struct{}
+
+// Send does nothing.
+func (Disabled) Send(context.Context, Message) error { return nil }
+
+// Fake records messages instead of sending them, for tests. Err, when set,
+// is returned from every Send.
+type Fake struct {
+	Err error
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+// Send records msg.
+func (f *Fake) Send(_ context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+	return f.Err
+}
+
+// Sent returns the messages passed to Send so far.
+func (f *Fake) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
+
+// TokenStore looks up and prunes the push tokens registered for devices.
+type TokenStore interface {
+	DevicePushTokens(ctx context.Context, deviceID string) ([]string, error)
+	DeletePushToken(ctx context.Context, token string) error
+}
+
+type result struct {
+	deviceID, eventID, status string
+}
+
+// Pusher sends check-in results from a bounded buffer on a background
+// goroutine, retrying failed sends with backoff. A nil *Pusher does nothing.
+type Pusher struct {
+	sender   Sender
+	tokens   TokenStore
+	results  chan result
+	attempts int
+	backoff  time.Duration
+	wg       sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPusher starts the background sender. buffer bounds the pending results.
+// It returns nil for a nil or Disabled sender, so nothing is looked up or sent.
+func NewPusher(s Sender, tokens TokenStore, buffer int) *Pusher {
+	if s == nil || s == (Disabled{}) {
+		return nil
+	}
+	if buffer <= 0 {
+		buffer = 256
+	}
+	p := &Pusher{sender: s, tokens: tokens, results: make(chan result, buffer), attempts: 3, backoff: time.Second}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+// Notify queues the result of eventID for the device's tokens. It never
+// blocks; when the buffer is full or the pusher is closed it is dropped.
+func (p *Pusher) Notify(deviceID, eventID, status string) {
+	if p == nil || deviceID == "" {
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		sentTotal.WithLabelValues("dropped").Inc()
+		return
+	}
+	select {
+	case p.results <- result{deviceID: deviceID, eventID: eventID, status: status}:
+	default:
+		sentTotal.WithLabelValues("dropped").Inc()
+		log.Printf("push: buffer full, dropped event %s for device %s", eventID, deviceID)
+	}
+}
+
+// Close stops accepting results and waits for pending ones to be sent.
+func (p *Pusher) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.results)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Pusher) run() {
+	defer p.wg.Done()
+	for r := range p.results {
+		p.deliver(r)
+	}
+}
+
+func (p *Pusher) deliver(r result) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	tokens, err := p.tokens.DevicePushTokens(ctx, r.deviceID)
+	cancel()
+	if err != nil {
+		sentTotal.WithLabelValues("failed").Inc()
+		log.Printf("push: load tokens for device %s failed: %v", r.deviceID, err)
+		return
+	}
+	for _, token := range tokens {
+		msg := Message{Token: token, EventID: r.eventID, Status: r.status}
+		err := p.send(msg)
+		switch {
+		case err == nil:
+			sentTotal.WithLabelValues("sent").Inc()
+		case errors.Is(err, ErrUnregistered):
+			sentTotal.WithLabelValues("unregistered").Inc()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := p.tokens.DeletePushToken(ctx, token); err != nil {
+				log.Printf("push: delete unregistered token of device %s failed: %v", r.deviceID, err)
+			}
+			cancel()
+		default:
+			sentTotal.WithLabelValues("failed").Inc()
+			log.Printf("push: event %s to device %s failed: %v", r.eventID, r.deviceID, err)
+		}
+	}
+}
+
+func (p *Pusher) send(msg Message) error {
+	var err error
+	for attempt := 0; attempt < p.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff << (attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = p.sender.Send(ctx, msg)
+		cancel()
+		if err == nil || errors.Is(err, ErrUnregistered) || errors.Is(err, ErrRejected) {
+			return err
+		}
+	}
+	return err
+}
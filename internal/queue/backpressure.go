@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrFull is returned by Publish when a bounded queue has no room left.
+var ErrFull = errors.New("queue full")
+
+// Reasons a check-in is refused under backpressure, the label values of
+// checkin_backpressure_total.
+const (
+	RejectHighWatermark = "high_watermark"
+	RejectFull          = "full"
+	RejectPublishFailed = "publish_failed"
+)
+
+var backpressureRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "checkin_backpressure_total",
+	Help: "Check-ins refused because the queue was over its high watermark, full, or failed to publish.",
+}, []string{"reason"})
+
+// CountRejection counts a check-in refused for reason.
+func CountRejection(reason string) {
+	backpressureRejections.WithLabelValues(reason).Inc()
+}
+
+// Watermark remembers the backlog from the stats Monitor samples, so the
+// API can shed load without asking the backend on every request.
+type Watermark struct {
+	high  int64
+	depth atomic.Int64
+}
+
+// NewWatermark returns a watermark at high messages across all queues, or
+// nil when high is not positive; a nil *Watermark is never exceeded.
+func NewWatermark(high int64) *Watermark {
+	if high <= 0 {
+		return nil
+	}
+	return &Watermark{high: high}
+}
+
+// Observe records the latest stats; pass it to Monitor.
+func (w *Watermark) Observe(st Stats) {
+	if w != nil {
+		w.depth.Store(st.Depth)
+	}
+}
+
+// Exceeded reports whether the last observed depth is above the watermark.
+func (w *Watermark) Exceeded() bool {
+	return w != nil && w.depth.Load() > w.high
+}
@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/config"
+)
+
+// FromConfig selects the queue backend from QUEUE_BACKEND: redis-streams or
+// redis-list (both using redisClient), memory, or kafka. "redis", the old
+// name of the list backend, still selects it.
+func FromConfig(cfg config.App, redisClient *redis.Client) (Queue, error) {
+	switch cfg.QueueBackend {
+	case "memory":
+		return NewInMemory(64), nil
+	case "redis-streams", "":
+		return NewStreamQueue(redisClient, StreamOptions{
+			Group:             cfg.QueueConsumerGroup,
+			Consumer:          cfg.QueueConsumerName,
+			VisibilityTimeout: cfg.QueueVisibilityTimeout,
+			MaxLen:            int64(cfg.QueueStreamMaxLen),
+		}, Priority...), nil
+	case "redis-list", "redis":
+		return NewRedisQueue(redisClient, Priority...), nil
+	case "kafka":
+		return NewKafkaQueue(KafkaOptions{
+			Brokers:     cfg.KafkaBrokers,
+			TopicPrefix: cfg.KafkaTopicPrefix,
+			GroupID:     cfg.KafkaGroupID,
+		}, Priority...)
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_BACKEND %q", cfg.QueueBackend)
+	}
+}
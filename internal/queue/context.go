@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Metadata keys set by the API on published messages.
+const (
+	// MetaRequestID is the X-Request-ID of the request that published.
+	MetaRequestID = "request_id"
+	// MetaTraceParent is the W3C traceparent header of that request.
+	MetaTraceParent = "traceparent"
+)
+
+type metadataKey struct{}
+
+// WithMetadata returns a copy of ctx that stamps key=value on messages
+// published through PublishDetached. Empty values are ignored.
+func WithMetadata(ctx context.Context, key, value string) context.Context {
+	if value == "" {
+		return ctx
+	}
+	prev := MetadataFrom(ctx)
+	md := make(map[string]string, len(prev)+1)
+	for k, v := range prev {
+		md[k] = v
+	}
+	md[key] = value
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFrom returns the metadata set on ctx; callers must not modify it.
+func MetadataFrom(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// MessageContext returns ctx carrying a delivered message's metadata, so
+// work it triggers can log or republish with the same request id.
+func MessageContext(ctx context.Context, msg Message) context.Context {
+	for k, v := range msg.Metadata {
+		ctx = WithMetadata(ctx, k, v)
+	}
+	return ctx
+}
+
+// Detach returns a context with ctx's values but not its cancellation,
+// bounded by timeout instead. A request handler uses it for work that must
+// finish after the client has hung up.
+func Detach(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+// PublishDetached publishes msg with ctx's metadata added, under a context
+// detached from ctx's cancellation and bounded by timeout. Metadata already
+// on msg wins.
+func PublishDetached(ctx context.Context, q Queue, queue string, msg Message, timeout time.Duration) error {
+	if md := MetadataFrom(ctx); len(md) > 0 {
+		merged := make(map[string]string, len(md)+len(msg.Metadata))
+		for k, v := range md {
+			merged[k] = v
+		}
+		for k, v := range msg.Metadata {
+			merged[k] = v
+		}
+		msg.Metadata = merged
+	}
+	ctx, cancel := Detach(ctx, timeout)
+	defer cancel()
+	return q.Publish(ctx, queue, msg)
+}
@@ -0,0 +1,323 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaOptions configures the Kafka backend.
+type KafkaOptions struct {
+	Brokers []string
+	// TopicPrefix is prepended to each queue's topic name.
+	TopicPrefix string
+	// GroupID is the consumer group shared by all workers.
+	GroupID string
+	// MaxAttempts is how often a nacked message is delivered before it is
+	// committed and dropped; defaults to 3.
+	MaxAttempts int
+}
+
+// KafkaQueue publishes each named queue to its own topic and consumes them
+// through a consumer group, so several workers share the partitions. Offsets
+// are committed only once a message is acked (or has used up its attempts).
+type KafkaQueue struct {
+	opts   KafkaOptions
+	writer *kafka.Writer
+	client *kafka.Client
+	queues []string
+}
+
+// kafkaMessage is the JSON value written to Kafka.
+type kafkaMessage struct {
+	Type        string            `json:"type"`
+	Body        string            `json:"body"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	PublishedAt time.Time         `json:"published_at"`
+}
+
+// NewKafkaQueue builds a Kafka-backed queue. queues are the queues reported
+// by QueueStats; they default to Priority.
+func NewKafkaQueue(opts KafkaOptions, queues ...string) (*KafkaQueue, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("kafka: at least one broker required")
+	}
+	for _, b := range opts.Brokers {
+		if _, _, err := net.SplitHostPort(b); err != nil {
+			return nil, fmt.Errorf("kafka: invalid broker %q: %w", b, err)
+		}
+	}
+	if opts.GroupID == "" {
+		opts.GroupID = "attendance-workers"
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if len(queues) == 0 {
+		queues = Priority
+	}
+	addr := kafka.TCP(opts.Brokers...)
+	return &KafkaQueue{
+		opts: opts,
+		writer: &kafka.Writer{
+			Addr:                   addr,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+			BatchTimeout:           10 * time.Millisecond,
+		},
+		client: &kafka.Client{Addr: addr, Timeout: 5 * time.Second},
+		queues: queues,
+	}, nil
+}
+
+// topic maps a queue name to a valid Kafka topic ("attendance:checkins"
+// becomes "attendance.checkins").
+func (q *KafkaQueue) topic(queue string) string {
+	return q.opts.TopicPrefix + strings.ReplaceAll(queue, ":", ".")
+}
+
+// Publish writes msg as JSON, keyed by msg.Key.
+func (q *KafkaQueue) Publish(ctx context.Context, queue string, msg Message) error {
+	value, err := json.Marshal(kafkaMessage{Type: msg.Type, Body: string(msg.Body), Metadata: msg.Metadata, PublishedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	km := kafka.Message{Topic: q.topic(queue), Value: value}
+	if msg.Key != "" {
+		km.Key = []byte(msg.Key)
+	}
+	return q.writer.WriteMessages(ctx, km)
+}
+
+// Ping checks that a broker answers a metadata request.
+func (q *KafkaQueue) Ping(ctx context.Context) error {
+	_, err := q.client.Metadata(ctx, &kafka.MetadataRequest{})
+	return err
+}
+
+// Close flushes pending writes.
+func (q *KafkaQueue) Close() error {
+	return q.writer.Close()
+}
+
+// QueueStats reports the consumer group's lag per topic as the depth.
+func (q *KafkaQueue) QueueStats(ctx context.Context) (Stats, error) {
+	st := Stats{Backend: "kafka", Queues: make(map[string]int64)}
+	for _, name := range q.queues {
+		lag, err := q.lag(ctx, q.topic(name))
+		if err != nil {
+			return st, err
+		}
+		st.Queues[name] = lag
+		st.Depth += lag
+	}
+	return st, nil
+}
+
+// lag sums, over the topic's partitions, the messages after the group's
+// committed offset (or after the earliest retained one if nothing is committed).
+func (q *KafkaQueue) lag(ctx context.Context, topic string) (int64, error) {
+	meta, err := q.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return 0, err
+	}
+	var partitions []int
+	var requests []kafka.OffsetRequest
+	for _, t := range meta.Topics {
+		if t.Name != topic || t.Error != nil {
+			continue
+		}
+		for _, p := range t.Partitions {
+			partitions = append(partitions, p.ID)
+			requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+		}
+	}
+	if len(partitions) == 0 {
+		return 0, nil // topic not created yet
+	}
+	offsets, err := q.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return 0, err
+	}
+	committed, err := q.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: q.opts.GroupID, Topics: map[string][]int{topic: partitions}})
+	if err != nil {
+		return 0, err
+	}
+	if committed.Error != nil {
+		return 0, committed.Error
+	}
+	done := make(map[int]int64)
+	for _, p := range committed.Topics[topic] {
+		done[p.Partition] = p.CommittedOffset
+	}
+	var lag int64
+	for _, p := range offsets.Topics[topic] {
+		if p.Error != nil {
+			return 0, p.Error
+		}
+		from := p.FirstOffset
+		if c, ok := done[p.Partition]; ok && c > from {
+			from = c
+		}
+		if p.LastOffset > from {
+			lag += p.LastOffset - from
+		}
+	}
+	return lag, nil
+}
+
+// Consume reads every queue's topic in the consumer group and delivers
+// messages one at a time per topic, preferring earlier queues. Each message
+// must be acked or nacked; the next message of that topic is fetched only
+// afterwards. On ctx cancellation unacked messages are left uncommitted and
+// are redelivered to the group.
+func (q *KafkaQueue) Consume(ctx context.Context, queues ...string) (<-chan Message, error) {
+	if len(queues) == 0 {
+		queues = Priority
+	}
+	ins := make([]chan Message, len(queues))
+	cases := make([]reflect.SelectCase, len(queues))
+	for i, name := range queues {
+		ins[i] = make(chan Message)
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ins[i])}
+		go q.consumeTopic(ctx, name, ins[i])
+	}
+
+	out := make(chan Message)
+	go func() {
+		defer close(out)
+		open := len(queues)
+		for open > 0 {
+			// Prefer a waiting message from the highest-priority queue.
+			delivered := false
+			for i, in := range ins {
+				if in == nil {
+					continue
+				}
+				select {
+				case msg, ok := <-in:
+					if !ok {
+						ins[i], cases[i].Chan = nil, reflect.Value{}
+						open--
+						continue
+					}
+					out <- msg
+					delivered = true
+				default:
+				}
+				if delivered {
+					break
+				}
+			}
+			if delivered || open == 0 {
+				continue
+			}
+			chosen, v, ok := reflect.Select(cases)
+			if !ok {
+				ins[chosen], cases[chosen].Chan = nil, reflect.Value{}
+				open--
+				continue
+			}
+			out <- v.Interface().(Message)
+		}
+	}()
+	return out, nil
+}
+
+// consumeTopic fetches from one topic until ctx is cancelled, redelivering a
+// nacked message up to MaxAttempts times before committing past it.
+func (q *KafkaQueue) consumeTopic(ctx context.Context, queue string, out chan<- Message) {
+	defer close(out)
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: q.opts.Brokers,
+		GroupID: q.opts.GroupID,
+		Topic:   q.topic(queue),
+		MaxWait: time.Second,
+	})
+	defer r.Close()
+
+	for {
+		km, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("kafka: fetch from %s failed: %v", q.topic(queue), err)
+			if sleepCtx(ctx, time.Second) != nil {
+				return
+			}
+			continue
+		}
+
+		var value kafkaMessage
+		if err := json.Unmarshal(km.Value, &value); err != nil {
+			log.Printf("kafka: skipping undecodable message at %s/%d@%d: %v", km.Topic, km.Partition, km.Offset, err)
+			q.commit(ctx, r, km)
+			continue
+		}
+		msg := Message{Type: value.Type, Body: []byte(value.Body), Key: string(km.Key), Metadata: value.Metadata, Queue: queue}
+
+		for attempt := 1; ; attempt++ {
+			settled := make(chan bool, 1)
+			msg.settle = func(_ context.Context, ok bool) error {
+				select {
+				case settled <- ok:
+				default: // already settled
+				}
+				return nil
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+			// Stopping while a message is unsettled leaves it uncommitted and
+			// closes the reader, so the group hands it to another worker.
+			var ok bool
+			select {
+			case ok = <-settled:
+			case <-ctx.Done():
+				return
+			}
+			if ok {
+				break
+			}
+			if attempt >= q.opts.MaxAttempts {
+				log.Printf("kafka: dropping %s message at %s/%d@%d after %d attempts", msg.Type, km.Topic, km.Partition, km.Offset, attempt)
+				break
+			}
+			if sleepCtx(ctx, time.Duration(attempt)*time.Second) != nil {
+				return
+			}
+		}
+		q.commit(ctx, r, km)
+	}
+}
+
+// commit records the offset even during shutdown, so a processed message is
+// not redelivered after a restart.
+func (q *KafkaQueue) commit(ctx context.Context, r *kafka.Reader, km kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := r.CommitMessages(ctx, km); err != nil {
+		log.Printf("kafka: commit %s/%d@%d failed: %v", km.Topic, km.Partition, km.Offset, err)
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
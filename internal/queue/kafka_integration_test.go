@@ -0,0 +1,240 @@
+//go:build integration
+
+// The Kafka backend runs against a real broker:
+//
+//	docker compose -f deploy/docker-compose.yml --profile kafka up -d kafka
+//	TEST_KAFKA_BROKERS=localhost:9092 go test -tags integration ./internal/queue
+//
+// Every test uses topics and a consumer group of its own.
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestKafka returns a Kafka queue with a fresh topic prefix and group,
+// or skips the test when TEST_KAFKA_BROKERS is unset.
+func newTestKafka(t *testing.T, opts KafkaOptions) *KafkaQueue {
+	t.Helper()
+	brokers := os.Getenv("TEST_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("TEST_KAFKA_BROKERS is not set")
+	}
+	opts.Brokers = strings.Split(brokers, ",")
+	if opts.TopicPrefix == "" {
+		id := fmt.Sprintf("it-%d", time.Now().UnixNano())
+		opts.TopicPrefix, opts.GroupID = id+".", id
+	}
+	q, err := NewKafkaQueue(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// consume starts a consumer stopped when the test ends, or earlier by the
+// returned function, which waits for the consumer to close.
+func consume(t *testing.T, q *KafkaQueue, queues ...string) (<-chan Message, func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, err := q.Consume(ctx, queues...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		cancel()
+		for range msgs {
+		}
+	}
+	t.Cleanup(stop)
+	return msgs, stop
+}
+
+// next waits for a delivery; joining a consumer group takes a few seconds.
+func next(t *testing.T, msgs <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			t.Fatal("consumer closed")
+		}
+		return msg
+	case <-time.After(30 * time.Second):
+		t.Fatal("no message delivered")
+	}
+	return Message{}
+}
+
+func publish(t *testing.T, q *KafkaQueue, queue, key, body string) {
+	t.Helper()
+	if err := q.Publish(context.Background(), queue, Message{Type: "checkin", Key: key, Body: []byte(body)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func ack(t *testing.T, msg Message) {
+	t.Helper()
+	if err := msg.Ack(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// awaitDepth polls QueueStats until the group's lag is want.
+func awaitDepth(t *testing.T, q *KafkaQueue, want int64) {
+	t.Helper()
+	var st Stats
+	for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+		var err error
+		if st, err = q.QueueStats(context.Background()); err == nil && st.Depth == want {
+			return
+		}
+	}
+	t.Fatalf("QueueStats = %+v, want depth %d", st, want)
+}
+
+func TestKafkaRoundTrip(t *testing.T) {
+	q := newTestKafka(t, KafkaOptions{})
+	if err := q.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	want := Message{Type: "checkin", Key: "evt-1", Body: []byte(`{"event_id":"evt-1"}`), Metadata: map[string]string{MetaRequestID: "req-1"}}
+	if err := q.Publish(context.Background(), Checkins, want); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	awaitDepth(t, q, 1)
+
+	msgs, _ := consume(t, q)
+	got := next(t, msgs)
+	if got.Type != want.Type || got.Key != want.Key || string(got.Body) != string(want.Body) ||
+		got.Metadata[MetaRequestID] != "req-1" || got.Queue != Checkins {
+		t.Errorf("delivered %+v, want %+v from %s", got, want, Checkins)
+	}
+	ack(t, got)
+	awaitDepth(t, q, 0)
+}
+
+// A message that was delivered but not acked when its consumer stopped goes
+// to the next consumer in the group; once acked it is not seen again.
+func TestKafkaCommitsOnlyAfterAck(t *testing.T) {
+	q := newTestKafka(t, KafkaOptions{})
+	publish(t, q, Checkins, "evt-1", "first")
+	publish(t, q, Checkins, "evt-1", "second")
+
+	msgs, stop := consume(t, q, Checkins)
+	if got := next(t, msgs); string(got.Body) != "first" {
+		t.Fatalf("delivered %q, want first", got.Body)
+	}
+	stop() // crash before the ack
+
+	msgs, stop = consume(t, q, Checkins)
+	for _, want := range []string{"first", "second"} {
+		got := next(t, msgs)
+		if string(got.Body) != want {
+			t.Fatalf("delivered %q after the restart, want %q", got.Body, want)
+		}
+		ack(t, got)
+	}
+	awaitDepth(t, q, 0)
+	stop()
+
+	msgs, _ = consume(t, q, Checkins)
+	publish(t, q, Checkins, "evt-2", "third")
+	if got := next(t, msgs); string(got.Body) != "third" {
+		t.Errorf("delivered %q, want only the new message", got.Body)
+	}
+}
+
+// A nacked message is redelivered until it has used its attempts, then
+// committed so it cannot block the partition.
+func TestKafkaNackRedelivers(t *testing.T) {
+	q := newTestKafka(t, KafkaOptions{MaxAttempts: 2})
+	publish(t, q, Checkins, "evt-1", "poison")
+	publish(t, q, Checkins, "evt-2", "fine")
+
+	msgs, _ := consume(t, q, Checkins)
+	for attempt := 1; attempt <= 2; attempt++ {
+		got := next(t, msgs)
+		if string(got.Body) != "poison" {
+			t.Fatalf("attempt %d delivered %q, want poison", attempt, got.Body)
+		}
+		if err := got.Nack(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := next(t, msgs)
+	if string(got.Body) != "fine" {
+		t.Fatalf("delivered %q after the attempts ran out, want fine", got.Body)
+	}
+	ack(t, got)
+	awaitDepth(t, q, 0)
+}
+
+// Two workers in one group split a topic's partitions, and between them see
+// every message once.
+func TestKafkaConsumersShareGroup(t *testing.T) {
+	a := newTestKafka(t, KafkaOptions{})
+	b := newTestKafka(t, a.opts)
+	ctx := context.Background()
+	topic := a.topic(Checkins)
+	res, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{{Topic: topic, NumPartitions: 2, ReplicationFactor: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Errors[topic]; err != nil {
+		t.Fatal(err)
+	}
+
+	msgsA, _ := consume(t, a, Checkins)
+	msgsB, _ := consume(t, b, Checkins)
+	// Publish only once both have joined, or the first could take it all.
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(200 * time.Millisecond) {
+		groups, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{a.opts.GroupID}})
+		if err == nil && len(groups.Groups) == 1 && groups.Groups[0].GroupState == "Stable" && len(groups.Groups[0].Members) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("group never had both consumers: %+v, %v", groups, err)
+		}
+	}
+
+	const n = 40
+	for i := range n {
+		publish(t, a, Checkins, fmt.Sprintf("evt-%d", i), fmt.Sprintf("msg-%d", i))
+	}
+	seen := map[string]string{}
+	for len(seen) < n {
+		var msg Message
+		var by string
+		select {
+		case msg = <-msgsA:
+			by = "a"
+		case msg = <-msgsB:
+			by = "b"
+		case <-time.After(30 * time.Second):
+			t.Fatalf("received %d of %d messages", len(seen), n)
+		}
+		if first, dup := seen[string(msg.Body)]; dup {
+			t.Errorf("%s delivered to %s after %s", msg.Body, by, first)
+		}
+		seen[string(msg.Body)] = by
+		ack(t, msg)
+	}
+	per := map[string]int{}
+	for _, by := range seen {
+		per[by]++
+	}
+	if per["a"] == 0 || per["b"] == 0 {
+		t.Errorf("deliveries per consumer %v, want both to take a share", per)
+	}
+	awaitDepth(t, a, 0)
+}
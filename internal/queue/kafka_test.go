@@ -0,0 +1,24 @@
+package queue
+
+import "testing"
+
+func TestNewKafkaQueue(t *testing.T) {
+	for _, brokers := range [][]string{nil, {"localhost"}, {"localhost:9092", "kafka"}} {
+		if _, err := NewKafkaQueue(KafkaOptions{Brokers: brokers}); err == nil {
+			t.Errorf("NewKafkaQueue(%q) succeeded", brokers)
+		}
+	}
+
+	q, err := NewKafkaQueue(KafkaOptions{Brokers: []string{"localhost:9092"}, TopicPrefix: "prod."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.opts.GroupID != "attendance-workers" || q.opts.MaxAttempts != 3 {
+		t.Errorf("defaults = group %q, %d attempts", q.opts.GroupID, q.opts.MaxAttempts)
+	}
+	// Kafka topics cannot contain colons.
+	if got := q.topic(Checkins); got != "prod.attendance.checkins" {
+		t.Errorf("topic(%s) = %q", Checkins, got)
+	}
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	depthGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "queue_depth",
+		Help: "Messages waiting in each work queue.",
+	}, []string{"queue"})
+	oldestAgeGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "queue_oldest_message_age_seconds",
+		Help: "Age of the oldest waiting message; 0 when empty or unknown.",
+	})
+	statsErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "queue_stats_errors_total",
+		Help: "Failed attempts to read queue stats.",
+	})
+)
+
+// Monitor samples q.QueueStats every interval into Prometheus gauges until
+// ctx is cancelled, also handing each sample to observers such as
+// Watermark.Observe. Failures are counted and logged, never fatal.
+func Monitor(ctx context.Context, q Queue, interval time.Duration, observers ...func(Stats)) {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		sample(ctx, q, observers)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func sample(ctx context.Context, q Queue, observers []func(Stats)) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	st, err := q.QueueStats(ctx)
+	if err != nil {
+		statsErrors.Inc()
+		log.Printf("queue stats unavailable: %v", err)
+		return
+	}
+	for name, n := range st.Queues {
+		depthGauge.WithLabelValues(name).Set(float64(n))
+	}
+	if st.OldestAge != nil {
+		oldestAgeGauge.Set(st.OldestAge.Seconds())
+	} else {
+		oldestAgeGauge.Set(0)
+	}
+	for _, observe := range observers {
+		observe(st)
+	}
+}
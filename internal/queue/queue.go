@@ -2,86 +2,293 @@ package queue
 
 import (
 	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// Named queues, highest priority first. Bulk work goes to lower-priority
+// queues so it never delays real-time check-ins.
+const (
+	Checkins    = "attendance:checkins"
+	Enrollments = "attendance:enrollments"
+)
+
+// Priority is the default consumption order for workers.
+var Priority = []string{Checkins, Enrollments}
+
 // Message represents work to be processed.
 type Message struct {
 	Type string
 	Body []byte
+	// Key groups related messages (such as one event's id) onto the same
+	// partition for backends that partition; optional.
+	Key string
+	// Metadata carries request-scoped values such as MetaRequestID from the
+	// publisher to the consumer. The redis-list backend does not keep it.
+	Metadata map[string]string
+	// Queue is the queue the message was consumed from; set on delivery.
+	Queue string
+
+	// settle is set on delivery by backends that track acknowledgements.
+	settle func(ctx context.Context, ok bool) error
+}
+
+// Ack reports that the message was processed and must not be redelivered.
+// Backends without acknowledgements ignore it.
+func (m Message) Ack(ctx context.Context) error {
+	if m.settle == nil {
+		return nil
+	}
+	return m.settle(ctx, true)
+}
+
+// Nack reports that processing failed and the message should be retried.
+// Backends without acknowledgements ignore it.
+func (m Message) Nack(ctx context.Context) error {
+	if m.settle == nil {
+		return nil
+	}
+	return m.settle(ctx, false)
 }
 
 // Queue is the abstraction over different backends.
 type Queue interface {
-	Publish(ctx context.Context, msg Message) error
-	Consume(ctx context.Context) (<-chan Message, error)
+	// Publish enqueues msg on the named queue.
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Consume delivers messages from queues, always preferring an earlier
+	// queue in the list when several have work waiting.
+	Consume(ctx context.Context, queues ...string) (<-chan Message, error)
+	QueueStats(ctx context.Context) (Stats, error)
+}
+
+// Pinger is implemented by backends that hold their own connection, so
+// health checks can report them.
+type Pinger interface {
+	Ping(ctx context.Context) error
 }
 
-// InMemory is a minimal channel-backed queue for dev/testing.
+// Stats is a point-in-time view of the backlog.
+type Stats struct {
+	Backend string `json:"backend"`
+	// Depth is the total across all queues; Queues breaks it down by name.
+	Depth  int64            `json:"depth"`
+	Queues map[string]int64 `json:"queues"`
+	// OldestAge is how long the next message to be consumed has waited.
+	// It is nil when the backend cannot tell or the queue is empty.
+	OldestAge *time.Duration `json:"-"`
+}
+
+// InMemory is a minimal channel-backed queue for dev/testing. Its messages
+// live in one process, so only a worker running in that process (or none in
+// tests) ever sees them.
 type InMemory struct {
+	size int
+
+	mu     sync.Mutex
+	queues map[string]*memQueue
+	// consumers counts Consume loops still delivering.
+	consumers atomic.Int64
+}
+
+// memQueue is one named in-memory queue.
+type memQueue struct {
 	ch chan Message
+
+	mu        sync.Mutex
+	published []time.Time // publish times of buffered messages, oldest first
 }
 
-// NewInMemory creates a bounded in-memory queue.
+// NewInMemory creates bounded in-memory queues of size messages each.
 func NewInMemory(size int) *InMemory {
-	return &InMemory{ch: make(chan Message, size)}
+	return &InMemory{size: size, queues: make(map[string]*memQueue)}
 }
 
-// Publish enqueues a message.
-func (q *InMemory) Publish(ctx context.Context, msg Message) error {
+// named returns the queue called name, creating it on first use.
+func (q *InMemory) named(name string) *memQueue {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	mq, ok := q.queues[name]
+	if !ok {
+		mq = &memQueue{ch: make(chan Message, q.size)}
+		q.queues[name] = mq
+	}
+	return mq
+}
+
+// Publish enqueues a message, returning ErrFull at once when the buffer is
+// full rather than waiting for a consumer.
+func (q *InMemory) Publish(ctx context.Context, queue string, msg Message) error {
+	mq := q.named(queue)
+	// Record the publish time before sending so a consumer never pops a
+	// timestamp that has not been pushed yet.
+	mq.mu.Lock()
+	mq.published = append(mq.published, time.Now())
+	mq.mu.Unlock()
 	select {
-	case q.ch <- msg:
+	case mq.ch <- msg:
 		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+	default:
+		mq.mu.Lock()
+		mq.published = mq.published[:len(mq.published)-1]
+		mq.mu.Unlock()
+		return ErrFull
 	}
 }
 
-// Consume returns a channel for workers.
-func (q *InMemory) Consume(ctx context.Context) (<-chan Message, error) {
+// QueueStats reports buffered message counts and the age of the oldest one.
+func (q *InMemory) QueueStats(ctx context.Context) (Stats, error) {
+	st := Stats{Backend: "memory", Queues: make(map[string]int64)}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for name, mq := range q.queues {
+		n := int64(len(mq.ch))
+		st.Queues[name] = n
+		st.Depth += n
+		mq.mu.Lock()
+		if len(mq.published) > 0 && n > 0 {
+			if age := time.Since(mq.published[0]); st.OldestAge == nil || age > *st.OldestAge {
+				st.OldestAge = &age
+			}
+		}
+		mq.mu.Unlock()
+	}
+	return st, nil
+}
+
+// Depth returns the number of buffered messages across all queues.
+func (q *InMemory) Depth() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var n int64
+	for _, mq := range q.queues {
+		n += int64(len(mq.ch))
+	}
+	return n
+}
+
+// Consumers returns the number of active Consume loops. Messages published
+// while it is zero wait until a consumer attaches or the process exits.
+func (q *InMemory) Consumers() int64 {
+	return q.consumers.Load()
+}
+
+// consumed drops the publish time of the message just received.
+func (mq *memQueue) consumed() {
+	mq.mu.Lock()
+	if len(mq.published) > 0 {
+		mq.published = mq.published[1:]
+	}
+	mq.mu.Unlock()
+}
+
+// Consume returns a channel for workers. When ctx is cancelled, messages
+// already buffered are still delivered before the channel is closed.
+func (q *InMemory) Consume(ctx context.Context, queues ...string) (<-chan Message, error) {
+	if len(queues) == 0 {
+		queues = Priority
+	}
+	mqs := make([]*memQueue, len(queues))
+	cases := make([]reflect.SelectCase, len(queues)+1)
+	for i, name := range queues {
+		mqs[i] = q.named(name)
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(mqs[i].ch)}
+	}
+	cases[len(queues)] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+
+	// next takes a buffered message from the highest-priority non-empty queue.
+	next := func() (Message, bool) {
+		for i, mq := range mqs {
+			select {
+			case msg := <-mq.ch:
+				mq.consumed()
+				msg.Queue = queues[i]
+				return msg, true
+			default:
+			}
+		}
+		return Message{}, false
+	}
+
 	out := make(chan Message)
+	q.consumers.Add(1)
 	go func() {
+		defer q.consumers.Add(-1)
 		defer close(out)
 		for {
-			select {
-			case msg := <-q.ch:
+			if msg, ok := next(); ok {
 				out <- msg
-			case <-ctx.Done():
-				return
+				continue
 			}
+			// Nothing waiting: block until any queue has work or ctx ends.
+			chosen, v, _ := reflect.Select(cases)
+			if chosen == len(queues) {
+				for {
+					msg, ok := next()
+					if !ok {
+						return
+					}
+					out <- msg
+				}
+			}
+			mqs[chosen].consumed()
+			msg := v.Interface().(Message)
+			msg.Queue = queues[chosen]
+			out <- msg
 		}
 	}()
 	return out, nil
 }
 
-// RedisQueue implements a simple Redis list-backed queue.
+// RedisQueue implements a simple Redis list-backed queue (QUEUE_BACKEND=redis-list).
 type RedisQueue struct {
 	client *redis.Client
-	key    string
+	keys   []string
 }
 
-// NewRedisQueue builds a queue using LPUSH/BRPOP semantics.
-func NewRedisQueue(client *redis.Client, key string) *RedisQueue {
-	if key == "" {
-		key = "attendance:queue"
+// NewRedisQueue builds a queue using LPUSH/BRPOP semantics. keys are the
+// lists reported by QueueStats; they default to Priority.
+func NewRedisQueue(client *redis.Client, keys ...string) *RedisQueue {
+	if len(keys) == 0 {
+		keys = Priority
 	}
-	return &RedisQueue{client: client, key: key}
+	return &RedisQueue{client: client, keys: keys}
 }
 
 // Publish enqueues a message.
-func (q *RedisQueue) Publish(ctx context.Context, msg Message) error {
-	return q.client.LPush(ctx, q.key, serialize(msg)).Err()
+func (q *RedisQueue) Publish(ctx context.Context, queue string, msg Message) error {
+	return q.client.LPush(ctx, queue, serialize(msg)).Err()
+}
+
+// QueueStats reports list lengths. Messages carry no enqueue time, so
+// OldestAge is nil; a Redis outage is returned as an error.
+func (q *RedisQueue) QueueStats(ctx context.Context) (Stats, error) {
+	st := Stats{Backend: "redis", Queues: make(map[string]int64)}
+	for _, key := range q.keys {
+		n, err := q.client.LLen(ctx, key).Result()
+		if err != nil {
+			return st, err
+		}
+		st.Queues[key] = n
+		st.Depth += n
+	}
+	return st, nil
 }
 
-// Consume streams messages using BRPOP.
-func (q *RedisQueue) Consume(ctx context.Context) (<-chan Message, error) {
+// Consume streams messages using multi-key BRPOP, which pops from the first
+// non-empty list in the order given.
+func (q *RedisQueue) Consume(ctx context.Context, queues ...string) (<-chan Message, error) {
+	if len(queues) == 0 {
+		queues = Priority
+	}
 	out := make(chan Message)
 	go func() {
 		defer close(out)
 		for {
-			res, err := q.client.BRPop(ctx, 5*time.Second, q.key).Result()
+			res, err := q.client.BRPop(ctx, 5*time.Second, queues...).Result()
 			if err != nil {
 				if err == redis.Nil {
 					continue
@@ -93,6 +300,7 @@ func (q *RedisQueue) Consume(ctx context.Context) (<-chan Message, error) {
 			}
 			if len(res) == 2 {
 				if msg, err := deserialize(res[1]); err == nil {
+					msg.Queue = res[0]
 					out <- msg
 				}
 			}
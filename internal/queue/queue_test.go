@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// receive returns the next delivered message, failing the test if none
+// arrives in time.
+func receive(t *testing.T, msgs <-chan Message) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-msgs:
+		if !ok {
+			t.Fatal("consumer closed")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+	return Message{}
+}
+
+// testPriorityUnderLoad checks that check-ins overtake an enrollment backlog,
+// both one at a time and in a burst from many publishers. A consumer may
+// already hold the next enrollment when check-ins arrive, so at most one
+// enrollment can come ahead of them.
+func testPriorityUnderLoad(t *testing.T, q Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const enrollments, burst, publishers = 200, 100, 8
+
+	for i := range enrollments {
+		if err := q.Publish(ctx, Enrollments, Message{Type: "enroll", Body: fmt.Appendf(nil, "enroll-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, err := q.Consume(ctx, Priority...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	// awaitCheckins reads until want check-ins have come through and
+	// returns how many enrollments were delivered in between.
+	awaitCheckins := func(want int) (overtaken int) {
+		for got := 0; got < want; {
+			msg := receive(t, msgs)
+			seen[msg.Queue]++
+			switch msg.Queue {
+			case Checkins:
+				got++
+			case Enrollments:
+				overtaken++
+			default:
+				t.Fatalf("message %q from queue %q", msg.Body, msg.Queue)
+			}
+		}
+		return overtaken
+	}
+
+	// A check-in published every few enrollments is next in line.
+	for i := range 10 {
+		for range 5 {
+			if msg := receive(t, msgs); msg.Queue != Enrollments {
+				t.Fatalf("got %q from %s with no check-ins waiting", msg.Body, msg.Queue)
+			}
+			seen[Enrollments]++
+		}
+		if err := q.Publish(ctx, Checkins, Message{Type: "checkin", Body: fmt.Appendf(nil, "checkin-%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		if n := awaitCheckins(1); n > 1 {
+			t.Fatalf("check-in %d waited behind %d enrollments", i, n)
+		}
+	}
+
+	// A burst from concurrent publishers all goes ahead of the backlog.
+	var wg sync.WaitGroup
+	for p := range publishers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range burst / publishers {
+				if err := q.Publish(ctx, Checkins, Message{Type: "checkin", Body: fmt.Appendf(nil, "burst-%d-%d", p, i)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := awaitCheckins(burst / publishers * publishers); n > 1 {
+		t.Fatalf("burst of check-ins waited behind %d enrollments", n)
+	}
+
+	// The backlog still drains in full afterwards.
+	for seen[Enrollments] < enrollments {
+		if msg := receive(t, msgs); msg.Queue != Enrollments {
+			t.Fatalf("got %q from %s, want only enrollments left", msg.Body, msg.Queue)
+		}
+		seen[Enrollments]++
+	}
+}
+
+func TestInMemoryPriority(t *testing.T) {
+	testPriorityUnderLoad(t, NewInMemory(1000))
+}
+
+func TestRedisQueuePriority(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	testPriorityUnderLoad(t, NewRedisQueue(client))
+}
+
+// A consumer whose context is already done still delivers what is buffered,
+// in priority order, before its channel closes.
+func TestInMemoryDrainsOnStop(t *testing.T) {
+	q := NewInMemory(10)
+	for _, name := range []string{Enrollments, Enrollments, Checkins} {
+		if err := q.Publish(context.Background(), name, Message{Body: []byte(name)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msgs, err := q.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for msg := range msgs {
+		got = append(got, msg.Queue)
+	}
+	if want := []string{Checkins, Enrollments, Enrollments}; !slices.Equal(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if q.Consumers() != 0 {
+		t.Errorf("%d consumers after the channel closed", q.Consumers())
+	}
+}
+
+func TestInMemoryPublishFull(t *testing.T) {
+	q := NewInMemory(1)
+	ctx := context.Background()
+	if err := q.Publish(ctx, Checkins, Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Publish(ctx, Checkins, Message{}); !errors.Is(err, ErrFull) {
+		t.Fatalf("Publish on a full queue = %v, want ErrFull", err)
+	}
+	// Each named queue has a buffer of its own.
+	if err := q.Publish(ctx, Enrollments, Message{}); err != nil {
+		t.Fatalf("Publish to another queue = %v", err)
+	}
+	st, err := q.QueueStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Depth != 2 || st.Queues[Checkins] != 1 || st.Queues[Enrollments] != 1 || st.OldestAge == nil {
+		t.Errorf("QueueStats = %+v, want one message on each queue", st)
+	}
+}
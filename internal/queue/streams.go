@@ -0,0 +1,415 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StreamOptions configures the Redis Streams backend.
+type StreamOptions struct {
+	// Group is the consumer group shared by all workers.
+	Group string
+	// Consumer names this process within the group; defaults to
+	// hostname-pid.
+	Consumer string
+	// VisibilityTimeout is how long a delivered message may go without
+	// being acked (or kept alive by its consumer) before another consumer
+	// claims it; defaults to 30s.
+	VisibilityTimeout time.Duration
+	// MaxLen caps each stream, approximately; the oldest entries, normally
+	// long acked, are trimmed as new ones are added. Defaults to 100000.
+	MaxLen int64
+	// MaxAttempts is how often a message is delivered before it is acked
+	// and dropped; defaults to 3.
+	MaxAttempts int
+}
+
+// StreamQueue stores each named queue in a Redis stream read through a
+// consumer group, so several workers share the backlog. A delivered message
+// stays pending until acked; if its consumer dies, another one claims it
+// once it has been idle for the visibility timeout.
+type StreamQueue struct {
+	client *redis.Client
+	opts   StreamOptions
+	queues []string
+}
+
+// NewStreamQueue builds a Redis Streams queue. queues are the queues reported
+// by QueueStats; they default to Priority.
+func NewStreamQueue(client *redis.Client, opts StreamOptions, queues ...string) *StreamQueue {
+	if opts.Group == "" {
+		opts.Group = "attendance-workers"
+	}
+	if opts.Consumer == "" {
+		opts.Consumer = DefaultConsumerName()
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = 30 * time.Second
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = 100000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if len(queues) == 0 {
+		queues = Priority
+	}
+	return &StreamQueue{client: client, opts: opts, queues: queues}
+}
+
+// DefaultConsumerName identifies this process as hostname-pid.
+func DefaultConsumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// stream maps a queue name to its stream key. Streams get their own keys so
+// they never collide with the lists of the redis-list backend.
+func stream(queue string) string {
+	return queue + ":stream"
+}
+
+// Publish appends msg to the queue's stream, trimming it to about MaxLen.
+func (q *StreamQueue) Publish(ctx context.Context, queue string, msg Message) error {
+	values := map[string]any{"type": msg.Type, "body": msg.Body, "key": msg.Key}
+	if len(msg.Metadata) > 0 {
+		meta, err := json.Marshal(msg.Metadata)
+		if err != nil {
+			return err
+		}
+		values["meta"] = meta
+	}
+	return q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream(queue),
+		MaxLen: q.opts.MaxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+// ensureGroup creates the consumer group (and stream) if missing. A new
+// group starts at the beginning of the stream, so messages published before
+// the first worker started are not skipped.
+func (q *StreamQueue) ensureGroup(ctx context.Context, queue string) error {
+	err := q.client.XGroupCreateMkStream(ctx, stream(queue), q.opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// QueueStats reports, per queue, the entries not yet delivered to the group
+// plus those delivered but not acked. OldestAge comes from the oldest such
+// entry's id, which holds its publish time.
+func (q *StreamQueue) QueueStats(ctx context.Context) (Stats, error) {
+	st := Stats{Backend: "redis-streams", Queues: make(map[string]int64)}
+	now := time.Now()
+	for _, name := range q.queues {
+		groups, err := q.client.XInfoGroups(ctx, stream(name)).Result()
+		if err != nil && !isNoSuchKey(err) {
+			return st, err
+		}
+		var n int64
+		oldest := ""
+		for _, g := range groups {
+			if g.Name != q.opts.Group {
+				continue
+			}
+			n = g.Pending + max(g.Lag, 0)
+			if oldest, err = q.oldestWaiting(ctx, name, g); err != nil {
+				return st, err
+			}
+		}
+		st.Queues[name] = n
+		st.Depth += n
+		if ms, ok := idTime(oldest); ok {
+			if age := now.Sub(ms); st.OldestAge == nil || age > *st.OldestAge {
+				st.OldestAge = &age
+			}
+		}
+	}
+	return st, nil
+}
+
+// oldestWaiting returns the id of the group's oldest pending entry, or of
+// the next undelivered one when nothing is pending, or "" when neither exists.
+func (q *StreamQueue) oldestWaiting(ctx context.Context, queue string, g redis.XInfoGroup) (string, error) {
+	if g.Pending > 0 {
+		p, err := q.client.XPending(ctx, stream(queue), q.opts.Group).Result()
+		if err != nil {
+			return "", err
+		}
+		return p.Lower, nil
+	}
+	if g.Lag <= 0 {
+		return "", nil
+	}
+	next, err := q.client.XRangeN(ctx, stream(queue), "("+g.LastDeliveredID, "+", 1).Result()
+	if err != nil || len(next) == 0 {
+		return "", err
+	}
+	return next[0].ID, nil
+}
+
+// Consume reads the queues through the consumer group, one message at a
+// time, preferring earlier queues. Every VisibilityTimeout/2 it first claims
+// messages other consumers left pending for longer than VisibilityTimeout.
+// Each message must be acked or nacked before the next is read; while it is
+// outstanding its idle time is reset so it is not claimed from under a slow
+// worker. A nacked message stays pending and is redelivered once idle for
+// the visibility timeout. On ctx cancellation the consumer leaves the group
+// if it holds no pending messages.
+func (q *StreamQueue) Consume(ctx context.Context, queues ...string) (<-chan Message, error) {
+	if len(queues) == 0 {
+		queues = Priority
+	}
+	for _, name := range queues {
+		if err := q.ensureGroup(ctx, name); err != nil {
+			return nil, fmt.Errorf("redis streams: create group on %s: %w", stream(name), err)
+		}
+	}
+	out := make(chan Message)
+	go func() {
+		defer close(out)
+		defer q.leave(ctx, queues)
+		claimEvery := q.opts.VisibilityTimeout / 2
+		var lastClaim time.Time
+		for ctx.Err() == nil {
+			if time.Since(lastClaim) >= claimEvery {
+				lastClaim = time.Now()
+				for _, name := range queues {
+					for _, xm := range q.claim(ctx, name) {
+						if !q.deliver(ctx, name, xm, out) {
+							return
+						}
+					}
+				}
+			}
+			for _, e := range q.read(ctx, queues, min(claimEvery, 5*time.Second)) {
+				if !q.deliver(ctx, e.queue, e.msg, out) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// streamEntry is a message read from a queue's stream.
+type streamEntry struct {
+	queue string
+	msg   redis.XMessage
+}
+
+// read returns the next new message, trying each queue in priority order
+// before blocking on all of them for up to block. The blocking read may
+// return one message per queue; they come back in priority order.
+func (q *StreamQueue) read(ctx context.Context, queues []string, block time.Duration) []streamEntry {
+	for _, name := range queues {
+		if entries := q.readGroup(ctx, []string{name}, -1); len(entries) > 0 {
+			return entries
+		}
+	}
+	return q.readGroup(ctx, queues, block)
+}
+
+// readGroup reads at most one new message from each of the given queues; a
+// negative block does not wait.
+func (q *StreamQueue) readGroup(ctx context.Context, queues []string, block time.Duration) []streamEntry {
+	streams := make([]string, 0, 2*len(queues))
+	for _, name := range queues {
+		streams = append(streams, stream(name))
+	}
+	for range queues {
+		streams = append(streams, ">")
+	}
+	res, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		Streams:  streams,
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+			log.Printf("redis streams: read failed: %v", err)
+			if isNoGroup(err) {
+				for _, name := range queues {
+					_ = q.ensureGroup(ctx, name)
+				}
+			}
+			_ = sleepCtx(ctx, time.Second)
+		}
+		return nil
+	}
+	var entries []streamEntry
+	for _, name := range queues {
+		for _, s := range res {
+			if s.Stream == stream(name) {
+				for _, xm := range s.Messages {
+					entries = append(entries, streamEntry{name, xm})
+				}
+			}
+		}
+	}
+	return entries
+}
+
+// claim takes over messages of queue idle for longer than the visibility
+// timeout, dropping those that have used up their attempts.
+func (q *StreamQueue) claim(ctx context.Context, queue string) []redis.XMessage {
+	msgs, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream(queue),
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		MinIdle:  q.opts.VisibilityTimeout,
+		Start:    "0",
+		Count:    10,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil && !isNoGroup(err) {
+			log.Printf("redis streams: claim on %s failed: %v", stream(queue), err)
+		}
+		return nil
+	}
+	claimed := msgs[:0]
+	for _, xm := range msgs {
+		if xm.Values == nil {
+			// Trimmed from the stream before it was acked.
+			q.ack(ctx, queue, xm.ID)
+			continue
+		}
+		if n := q.deliveries(ctx, queue, xm.ID); n > int64(q.opts.MaxAttempts) {
+			log.Printf("redis streams: dropping %v message %s on %s after %d attempts", xm.Values["type"], xm.ID, stream(queue), n-1)
+			q.ack(ctx, queue, xm.ID)
+			continue
+		}
+		log.Printf("redis streams: claimed message %s on %s", xm.ID, stream(queue))
+		claimed = append(claimed, xm)
+	}
+	return claimed
+}
+
+// deliveries returns how often id has been delivered, counting the claim
+// that just took it.
+func (q *StreamQueue) deliveries(ctx context.Context, queue, id string) int64 {
+	p, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream(queue), Group: q.opts.Group, Start: id, End: id, Count: 1,
+	}).Result()
+	if err != nil || len(p) == 0 {
+		return 0
+	}
+	return p[0].RetryCount
+}
+
+// deliver hands one message to the consumer and waits until it is settled,
+// keeping it claimed meanwhile. It returns false when ctx ended before the
+// message was taken; the message then stays pending for another consumer.
+func (q *StreamQueue) deliver(ctx context.Context, queue string, xm redis.XMessage, out chan<- Message) bool {
+	msg := Message{Queue: queue}
+	msg.Type, _ = xm.Values["type"].(string)
+	body, _ := xm.Values["body"].(string)
+	msg.Body = []byte(body)
+	msg.Key, _ = xm.Values["key"].(string)
+	if meta, ok := xm.Values["meta"].(string); ok {
+		if err := json.Unmarshal([]byte(meta), &msg.Metadata); err != nil {
+			log.Printf("redis streams: ignoring undecodable metadata of %s on %s: %v", xm.ID, stream(queue), err)
+		}
+	}
+
+	settled := make(chan bool, 1)
+	msg.settle = func(_ context.Context, ok bool) error {
+		select {
+		case settled <- ok:
+		default: // already settled
+		}
+		return nil
+	}
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		return false
+	}
+
+	keepAlive := time.NewTicker(q.opts.VisibilityTimeout / 3)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ok := <-settled:
+			if ok {
+				q.ack(ctx, queue, xm.ID)
+			}
+			return true
+		case <-keepAlive.C:
+			// Re-claiming our own message resets its idle time.
+			err := q.client.XClaimJustID(context.WithoutCancel(ctx), &redis.XClaimArgs{
+				Stream: stream(queue), Group: q.opts.Group, Consumer: q.opts.Consumer, Messages: []string{xm.ID},
+			}).Err()
+			if err != nil {
+				log.Printf("redis streams: keep %s claimed failed: %v", xm.ID, err)
+			}
+		}
+	}
+}
+
+// ack acknowledges id even during shutdown, so a processed message is not
+// redelivered.
+func (q *StreamQueue) ack(ctx context.Context, queue, id string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := q.client.XAck(ctx, stream(queue), q.opts.Group, id).Err(); err != nil {
+		log.Printf("redis streams: ack %s on %s failed: %v", id, stream(queue), err)
+	}
+}
+
+// leave removes this consumer from the groups it holds nothing pending in,
+// so restarts do not pile up dead consumer names.
+func (q *StreamQueue) leave(ctx context.Context, queues []string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	for _, name := range queues {
+		p, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream(name), Group: q.opts.Group, Start: "-", End: "+", Count: 1, Consumer: q.opts.Consumer,
+		}).Result()
+		if err != nil || len(p) > 0 {
+			continue
+		}
+		q.client.XGroupDelConsumer(ctx, stream(name), q.opts.Group, q.opts.Consumer)
+	}
+}
+
+// Ping checks that Redis answers.
+func (q *StreamQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+// idTime returns the publish time encoded in a stream entry id.
+func idTime(id string) (time.Time, bool) {
+	ms, _, _ := strings.Cut(id, "-")
+	n, err := strconv.ParseInt(ms, 10, 64)
+	if id == "" || err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(n), true
+}
+
+func isNoSuchKey(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such key")
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
@@ -0,0 +1,270 @@
+// Package retention enforces how long check-in images and attendance events
+// are kept: images are deleted from the image store after ImageRetention,
+// events are moved to attendance_events_archive after EventRetention, and
+// face-service audit rows are deleted after FaceAuditRetention.
+package retention
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceaudit"
+	"attendance/internal/jobs"
+	"attendance/internal/storage"
+)
+
+var (
+	imagesPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_images_purged_total",
+		Help: "Event images deleted and unlinked by the retention job.",
+	})
+	eventsArchived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_events_archived_total",
+		Help: "Events moved to attendance_events_archive by the retention job.",
+	})
+	faceAuditPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_face_audit_purged_total",
+		Help: "Face audit entries deleted by the retention job.",
+	})
+	purgeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_image_delete_errors_total",
+		Help: "Images the retention job could not delete from the image store.",
+	})
+	lastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "retention_last_success_timestamp_seconds",
+		Help: "Unix time of the last retention run that completed without error.",
+	})
+)
+
+// Job runs retention in batches with a pause in between, so no statement
+// holds locks on attendance_events for long.
+type Job struct {
+	Repo *attendance.Repository
+	// Images deletes the stored files; nil only unlinks them from events.
+	Images         storage.ImageStore
+	ImageRetention time.Duration
+	EventRetention time.Duration
+	// FaceAudit holds the face-service audit; nil leaves it alone.
+	FaceAudit          *faceaudit.Recorder
+	FaceAuditRetention time.Duration
+	BatchSize          int
+	Pause              time.Duration
+	// DryRun only logs what would be removed.
+	DryRun bool
+}
+
+// Result summarises one run. In a dry run it holds the counts that would be affected.
+type Result struct {
+	ImagesPurged    int64 `json:"images_purged"`
+	ImageErrors     int64 `json:"image_errors"`
+	EventsArchived  int64 `json:"events_archived"`
+	FaceAuditPurged int64 `json:"face_audit_purged"`
+}
+
+// JobType is the job type of a scheduled retention pass.
+const JobType = "retention"
+
+// Run performs one retention pass. A non-positive retention disables that part.
+func (j Job) Run(ctx context.Context) (Result, error) {
+	if j.BatchSize <= 0 {
+		j.BatchSize = 500
+	}
+	now := time.Now()
+	imageCutoff, eventCutoff := cutoff(now, j.ImageRetention), cutoff(now, j.EventRetention)
+	auditCutoff := cutoff(now, j.FaceAuditRetention)
+
+	if j.DryRun {
+		counts, err := j.Repo.CountRetention(ctx, imageCutoff, eventCutoff)
+		if err != nil {
+			return Result{}, err
+		}
+		log.Printf("retention dry run: %d images older than %s and %d events older than %s would be removed",
+			counts.Images, imageCutoff.Format(time.RFC3339), counts.Events, eventCutoff.Format(time.RFC3339))
+		res := Result{ImagesPurged: counts.Images, EventsArchived: counts.Events}
+		if j.FaceAudit != nil && j.FaceAuditRetention > 0 {
+			if res.FaceAuditPurged, err = j.FaceAudit.CountBefore(ctx, auditCutoff); err != nil {
+				return res, err
+			}
+			log.Printf("retention dry run: %d face audit entries older than %s would be removed",
+				res.FaceAuditPurged, auditCutoff.Format(time.RFC3339))
+		}
+		return res, nil
+	}
+
+	var res Result
+	if j.ImageRetention > 0 {
+		if err := j.purgeImages(ctx, imageCutoff, &res); err != nil {
+			return res, err
+		}
+	}
+	if j.EventRetention > 0 {
+		if err := j.archiveEvents(ctx, eventCutoff, &res); err != nil {
+			return res, err
+		}
+	}
+	if j.FaceAudit != nil && j.FaceAuditRetention > 0 {
+		if err := j.purgeFaceAudit(ctx, auditCutoff, &res); err != nil {
+			return res, err
+		}
+	}
+	lastRun.SetToCurrentTime()
+	log.Printf("retention: %d images purged (%d failed), %d events archived, %d face audit entries purged",
+		res.ImagesPurged, res.ImageErrors, res.EventsArchived, res.FaceAuditPurged)
+	return res, nil
+}
+
+// cutoff returns now minus d, or the zero time (matching nothing) when d is disabled.
+func cutoff(now time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-d)
+}
+
+func (j Job) purgeImages(ctx context.Context, before time.Time, res *Result) error {
+	for {
+		batch, err := j.Repo.EventImagesBefore(ctx, before, j.BatchSize)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		ids := make([]string, 0, len(batch))
+	images:
+		for _, img := range batch {
+			for _, u := range eventImageURLs(img) {
+				if err := j.deleteImage(ctx, u); err != nil {
+					// Keep the reference so the next run retries the delete.
+					log.Printf("retention: delete image of event %s failed: %v", img.EventID, err)
+					purgeErrors.Inc()
+					res.ImageErrors++
+					continue images
+				}
+			}
+			ids = append(ids, img.EventID)
+		}
+		n, err := j.Repo.ClearEventImages(ctx, ids)
+		res.ImagesPurged += n
+		imagesPurged.Add(float64(n))
+		if err != nil {
+			return err
+		}
+		// A batch where every delete failed would be selected again forever.
+		if n == 0 || len(batch) < j.BatchSize {
+			return nil
+		}
+		if err := j.sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// eventImageURLs lists the distinct images of an event: the one it shows and
+// the other frames of a multi-image check-in.
+func eventImageURLs(img attendance.EventImage) []string {
+	urls := img.ImageURLs
+	if img.ImageURL != "" && !slices.Contains(urls, img.ImageURL) {
+		urls = append(urls, img.ImageURL)
+	}
+	return urls
+}
+
+// deleteImage removes an image from the store. URLs the store did not issue
+// (or no store at all) have nothing to delete.
+func (j Job) deleteImage(ctx context.Context, rawURL string) error {
+	if j.Images == nil {
+		return nil
+	}
+	key, ok := j.Images.KeyForURL(rawURL)
+	if !ok {
+		return nil
+	}
+	return j.Images.Delete(ctx, key)
+}
+
+func (j Job) archiveEvents(ctx context.Context, before time.Time, res *Result) error {
+	for {
+		n, err := j.Repo.ArchiveEventsBefore(ctx, before, j.BatchSize)
+		if err != nil {
+			return err
+		}
+		res.EventsArchived += n
+		eventsArchived.Add(float64(n))
+		if n < int64(j.BatchSize) {
+			return nil
+		}
+		if err := j.sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (j Job) purgeFaceAudit(ctx context.Context, before time.Time, res *Result) error {
+	for {
+		n, err := j.FaceAudit.PurgeBefore(ctx, before, j.BatchSize)
+		if err != nil {
+			return err
+		}
+		res.FaceAuditPurged += n
+		faceAuditPurged.Add(float64(n))
+		if n < int64(j.BatchSize) {
+			return nil
+		}
+		if err := j.sleep(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (j Job) sleep(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(j.Pause):
+		return nil
+	}
+}
+
+// Handle runs a pass as a jobs handler. Its Result becomes the job's result;
+// Done counts the rows and images removed and Failed the images that could
+// not be deleted. A pass stopped part way keeps what it removed, and the
+// next one starts over with whatever is still due.
+func (j Job) Handle(ctx context.Context, run *jobs.Run) error {
+	res, err := j.Run(ctx)
+	run.Done = int(res.ImagesPurged + res.EventsArchived + res.FaceAuditPurged)
+	run.Failed = int(res.ImageErrors)
+	run.Total = run.Done + run.Failed
+	if rerr := run.SetResult(res); rerr != nil {
+		log.Printf("retention: encode job result failed: %v", rerr)
+	}
+	return err
+}
+
+// Schedule queues a retention job every interval, starting now, until ctx
+// is cancelled; a dispatcher with Handle registered runs it. No pass is
+// queued while the previous one is still queued, running or paused.
+func Schedule(ctx context.Context, store *jobs.Store, dispatcher *jobs.Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := store.Create(ctx, jobs.Spec{Type: JobType, CreatedBy: "scheduler", Exclusive: true})
+		switch {
+		case errors.Is(err, jobs.ErrActive):
+			log.Printf("retention: previous pass still active, skipping: %v", err)
+		case err != nil && ctx.Err() == nil:
+			log.Printf("retention: queue pass failed: %v", err)
+		case err == nil:
+			dispatcher.Wake()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+	"attendance/internal/config"
+)
+
+// channel is the Redis channel an update is announced on, so every process
+// reloads at once instead of when its cache expires.
+const channel = "attendance:settings:changed"
+
+// Setting is one setting as shown to admins.
+type Setting struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Value       any    `json:"value"`
+	Default     any    `json:"default"`
+	// Overridden is set when Value was set by an admin rather than taken
+	// from config.
+	Overridden bool       `json:"overridden"`
+	Min        any        `json:"min,omitempty"`
+	Max        any        `json:"max,omitempty"`
+	UpdatedBy  *string    `json:"updated_by,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// Change is a setting changed by Update, with its effective value before
+// and after.
+type Change struct {
+	Key string `json:"key"`
+	Old any    `json:"old"`
+	New any    `json:"new"`
+}
+
+// Defaults returns the settings as configured in the environment, which
+// apply until an admin overrides them.
+func Defaults(cfg config.App) Values {
+	return Values{
+		MatchThreshold:  cfg.FaceMatchThreshold,
+		RequireLiveness: cfg.RequireLiveness,
+		DedupWindow:     cfg.DedupWindow,
+		Quality: attendance.QualityThresholds{
+			MaxBlur:        cfg.FaceMaxBlur,
+			MinFaceSize:    cfg.FaceMinSize,
+			RequireFrontal: cfg.FaceRequireFrontal,
+		},
+	}
+}
+
+// Provider serves the effective settings from a copy that is reloaded from
+// the settings table every TTL, or as soon as an update is announced.
+type Provider struct {
+	db       *sql.DB
+	timeout  time.Duration
+	defaults Values
+	ttl      time.Duration
+	// redis carries update announcements; nil leaves other processes to
+	// notice changes when their copy expires.
+	redis *redis.Client
+
+	mu       sync.Mutex
+	values   Values
+	loadedAt time.Time
+}
+
+// NewProvider returns a provider whose settings start out as defaults. A
+// non-positive ttl defaults to 30 seconds.
+func NewProvider(db *sql.DB, queryTimeout time.Duration, defaults Values, ttl time.Duration, client *redis.Client) *Provider {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &Provider{db: db, timeout: queryTimeout, defaults: defaults, ttl: ttl, redis: client, values: defaults}
+}
+
+// Current returns the effective settings. When they cannot be reloaded, the
+// last ones loaded stay in use until the next attempt one TTL later.
+func (p *Provider) Current(ctx context.Context) Values {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.loadedAt) < p.ttl {
+		return p.values
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	values, _, err := p.load(ctx, p.db)
+	p.loadedAt = time.Now()
+	if err != nil {
+		log.Printf("settings: reload failed, keeping the last values: %v", err)
+		return p.values
+	}
+	p.values = values
+	return values
+}
+
+// DedupWindow returns the current dedup window, for attendance.Service.
+func (p *Provider) DedupWindow(ctx context.Context) time.Duration {
+	return p.Current(ctx).DedupWindow
+}
+
+// Invalidate makes the next Current reload the settings.
+func (p *Provider) Invalidate() {
+	p.mu.Lock()
+	p.loadedAt = time.Time{}
+	p.mu.Unlock()
+}
+
+// Watch invalidates the settings whenever another process announces an
+// update, until ctx is cancelled.
+func (p *Provider) Watch(ctx context.Context) {
+	if p.redis == nil {
+		return
+	}
+	sub := p.redis.Subscribe(ctx, channel)
+	defer sub.Close()
+	updates := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+			p.Invalidate()
+		}
+	}
+}
+
+// List returns every setting with its current and default value, read
+// from the database rather than the cached copy.
+func (p *Provider) List(ctx context.Context) ([]Setting, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	values, rows, err := p.load(ctx, p.db)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Setting, 0, len(definitions))
+	for _, def := range definitions {
+		s := Setting{
+			Key: def.key, Type: def.kind, Description: def.description,
+			Value: encode(def.get(values)), Default: encode(def.get(p.defaults)),
+		}
+		if def.kind != KindBool {
+			s.Min, s.Max = def.bound(def.min), def.bound(def.max)
+		}
+		if r, ok := rows[def.key]; ok {
+			s.Overridden, s.UpdatedBy, s.UpdatedAt = true, r.updatedBy, &r.updatedAt
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// Update applies changes, a JSON value per setting key, in one transaction;
+// a null value resets the setting to its default. Nothing is applied when
+// any key or value is invalid (ErrInvalid). It returns the settings whose
+// effective value changed and announces the update to other processes.
+func (p *Provider) Update(ctx context.Context, actor string, changes map[string]json.RawMessage) ([]Change, error) {
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("%w: no settings given", ErrInvalid)
+	}
+	parsed := make(map[string]any, len(changes))
+	for key, raw := range changes {
+		def, ok := lookup(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown setting %q", ErrInvalid, key)
+		}
+		if string(raw) == "null" {
+			parsed[key] = nil
+			continue
+		}
+		v, err := def.parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		parsed[key] = v
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	// Updates are serialized so each sees the values it replaces.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('settings', 0))`); err != nil {
+		return nil, err
+	}
+	before, _, err := p.load(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	after := before
+	var applied []Change
+	for _, def := range definitions {
+		v, ok := parsed[def.key]
+		if !ok {
+			continue
+		}
+		if v == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM settings WHERE key = $1`, def.key)
+			v = def.get(p.defaults)
+		} else {
+			var raw []byte
+			if raw, err = json.Marshal(encode(v)); err != nil {
+				return nil, err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO settings (key, value, updated_by, updated_at)
+				VALUES ($1, $2, $3, NOW())
+				ON CONFLICT (key) DO UPDATE
+				SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+			`, def.key, raw, actor)
+		}
+		if err != nil {
+			return nil, err
+		}
+		def.set(&after, v)
+		if old, cur := encode(def.get(before)), encode(v); old != cur {
+			applied = append(applied, Change{Key: def.key, Old: old, New: cur})
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.values, p.loadedAt = after, time.Now()
+	p.mu.Unlock()
+	if p.redis != nil {
+		if err := p.redis.Publish(context.WithoutCancel(ctx), channel, "").Err(); err != nil {
+			log.Printf("settings: announce update failed, other processes reload within %s: %v", p.ttl, err)
+		}
+	}
+	return applied, nil
+}
+
+// row is a stored override.
+type row struct {
+	updatedBy *string
+	updatedAt time.Time
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// load reads the overrides and applies them to the defaults. A stored value
+// that no longer parses, say after its bounds were tightened, is skipped.
+func (p *Provider) load(ctx context.Context, q querier) (Values, map[string]row, error) {
+	rs, err := q.QueryContext(ctx, `SELECT key, value, updated_by, updated_at FROM settings`)
+	if err != nil {
+		return Values{}, nil, err
+	}
+	defer rs.Close()
+	values := p.defaults
+	rows := make(map[string]row)
+	for rs.Next() {
+		var (
+			key string
+			raw []byte
+			r   row
+		)
+		if err := rs.Scan(&key, &raw, &r.updatedBy, &r.updatedAt); err != nil {
+			return Values{}, nil, err
+		}
+		def, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		v, err := def.parse(raw)
+		if err != nil {
+			log.Printf("settings: ignoring stored %s: %v", key, err)
+			continue
+		}
+		def.set(&values, v)
+		rows[key] = r
+	}
+	return values, rows, rs.Err()
+}
@@ -0,0 +1,206 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/testdb"
+)
+
+var testDefaults = Values{MatchThreshold: 0.6, DedupWindow: 5 * time.Minute}
+
+var selectSettings = regexp.QuoteMeta(`SELECT key, value, updated_by, updated_at FROM settings`)
+
+// stored returns settings rows holding the given overrides.
+func stored(overrides map[string]string) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"key", "value", "updated_by", "updated_at"})
+	for key, value := range overrides {
+		rows.AddRow(key, []byte(value), "admin-1", time.Now())
+	}
+	return rows
+}
+
+// Current serves its copy for a TTL, reloads it after Invalidate, and keeps
+// the last values when a reload fails.
+func TestProviderCurrent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := NewProvider(db, time.Second, testDefaults, time.Hour, nil)
+	ctx := context.Background()
+
+	mock.ExpectQuery(selectSettings).WillReturnRows(stored(map[string]string{
+		MatchThreshold: `0.7`,
+		DedupWindow:    `"2m"`,
+		"retired_key":  `1`,
+		MinFaceSize:    `-5`, // no longer valid; skipped
+	}))
+	v := p.Current(ctx)
+	if v.MatchThreshold != 0.7 || v.DedupWindow != 2*time.Minute || v.Quality.MinFaceSize != 0 {
+		t.Fatalf("Current = %+v", v)
+	}
+	if p.DedupWindow(ctx) != 2*time.Minute {
+		t.Error("second read within the TTL did not use the copy")
+	}
+
+	p.Invalidate()
+	mock.ExpectQuery(selectSettings).WillReturnError(errors.New("connection refused"))
+	if v := p.Current(ctx); v.MatchThreshold != 0.7 {
+		t.Errorf("Current after a failed reload = %+v, want the last values", v)
+	}
+	p.Current(ctx) // a failed reload is not retried before the TTL passes
+
+	p.Invalidate()
+	mock.ExpectQuery(selectSettings).WillReturnRows(stored(nil))
+	if v := p.Current(ctx); v != testDefaults {
+		t.Errorf("Current without overrides = %+v, want the defaults", v)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// invalidated reports whether the next Current will reload.
+func (p *Provider) invalidated() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.loadedAt.IsZero()
+}
+
+// An update announced by another process makes this one reload.
+func TestProviderWatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	p := NewProvider(db, time.Second, testDefaults, time.Hour, client)
+	mock.ExpectQuery(selectSettings).WillReturnRows(stored(nil))
+	p.Current(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Watch(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.invalidated() {
+		if time.Now().After(deadline) {
+			t.Fatal("announced update was not picked up")
+		}
+		mr.Publish(channel, "")
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not return after cancel")
+	}
+}
+
+// Invalid changes are rejected before anything is written.
+func TestUpdateRejectsInvalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	p := NewProvider(db, time.Second, testDefaults, time.Hour, nil)
+	for name, changes := range map[string]map[string]json.RawMessage{
+		"none":        {},
+		"unknown key": {"face_match_treshold": json.RawMessage(`0.7`)},
+		"one invalid": {MatchThreshold: json.RawMessage(`0.7`), DedupWindow: json.RawMessage(`"2 minutes"`)},
+	} {
+		if _, err := p.Update(context.Background(), "admin-1", changes); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: Update error = %v, want ErrInvalid", name, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	db := testdb.Open(t)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	p := NewProvider(db, 5*time.Second, testDefaults, time.Hour, client)
+	other := NewProvider(db, 5*time.Second, testDefaults, time.Hour, nil)
+	ctx := context.Background()
+	other.Current(ctx)
+	announcements := mr.NewSubscriber()
+	announcements.Subscribe(channel)
+
+	changes, err := p.Update(ctx, "admin-1", map[string]json.RawMessage{
+		MatchThreshold:  json.RawMessage(`0.72`),
+		DedupWindow:     json.RawMessage(`"5m"`), // the default already
+		RequireLiveness: json.RawMessage(`true`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{{MatchThreshold, 0.6, 0.72}, {RequireLiveness, false, true}}
+	if len(changes) != len(want) || changes[0] != want[0] || changes[1] != want[1] {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+	if v := p.Current(ctx); v.MatchThreshold != 0.72 || !v.RequireLiveness {
+		t.Errorf("Current after Update = %+v", v)
+	}
+	select {
+	case <-announcements.Messages():
+	case <-time.After(5 * time.Second):
+		t.Error("update was not announced")
+	}
+	other.Invalidate()
+	if v := other.Current(ctx); v.MatchThreshold != 0.72 {
+		t.Errorf("another provider reloaded %+v", v)
+	}
+
+	list, err := p.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byKey := map[string]Setting{}
+	for _, s := range list {
+		byKey[s.Key] = s
+	}
+	if s := byKey[MatchThreshold]; !s.Overridden || s.Value != 0.72 || s.Default != 0.6 || s.UpdatedBy == nil || *s.UpdatedBy != "admin-1" || s.Max != 1.0 {
+		t.Errorf("listed %+v", s)
+	}
+	if s := byKey[DedupWindow]; s.Value != "5m0s" || s.Max != "24h0m0s" {
+		t.Errorf("listed %+v", s)
+	}
+	if s := byKey[MinFaceSize]; s.Overridden || s.UpdatedAt != nil {
+		t.Errorf("listed %+v, want it at the default", s)
+	}
+
+	changes, err = p.Update(ctx, "admin-2", map[string]json.RawMessage{MatchThreshold: json.RawMessage(`null`)})
+	if err != nil || len(changes) != 1 || changes[0] != (Change{MatchThreshold, 0.72, 0.6}) {
+		t.Fatalf("reset = %v, %v", changes, err)
+	}
+	list, err = p.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range list {
+		if s.Key == MatchThreshold && (s.Overridden || s.Value != 0.6) {
+			t.Errorf("listed %+v after the reset", s)
+		}
+	}
+}
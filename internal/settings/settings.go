@@ -0,0 +1,172 @@
+// Package settings holds the tunables admins change at runtime, such as the
+// face match threshold and the dedup window. Values set through the admin API
+// are kept in the settings table and override the defaults from config; the
+// API and worker read them through a Provider, so a change applies without a
+// restart.
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"attendance/internal/attendance"
+)
+
+// ErrInvalid means a setting is unknown or its value has the wrong type or
+// is out of bounds.
+var ErrInvalid = errors.New("invalid setting")
+
+// Keys of the runtime settings.
+const (
+	MatchThreshold  = "face_match_threshold"
+	RequireLiveness = "require_liveness"
+	DedupWindow     = "dedup_window"
+	MaxBlur         = "face_max_blur"
+	MinFaceSize     = "face_min_size"
+	RequireFrontal  = "face_require_frontal"
+)
+
+// Value types. Durations are strings such as "5m".
+const (
+	KindFloat    = "float"
+	KindInt      = "int"
+	KindBool     = "bool"
+	KindDuration = "duration"
+)
+
+// Values are the effective settings.
+type Values struct {
+	// MatchThreshold is the minimum similarity of a check-in to the user's
+	// enrolled face.
+	MatchThreshold float64
+	// RequireLiveness has the worker run the face service's anti-spoofing
+	// check on each check-in image and reject spoofs.
+	RequireLiveness bool
+	// DedupWindow is how close two check-ins of a user may be before the
+	// later one is a duplicate; zero disables deduplication.
+	DedupWindow time.Duration
+	// Quality is the image quality gate.
+	Quality attendance.QualityThresholds
+}
+
+// definition describes one setting: its type, bounds and where it lives in
+// Values. Bounds of durations are in seconds.
+type definition struct {
+	key         string
+	kind        string
+	min, max    float64
+	description string
+	get         func(Values) any
+	set         func(*Values, any)
+}
+
+var definitions = []definition{
+	{
+		key: MatchThreshold, kind: KindFloat, min: 0, max: 1,
+		description: "Minimum similarity of a check-in to the enrolled face",
+		get:         func(v Values) any { return v.MatchThreshold },
+		set:         func(v *Values, x any) { v.MatchThreshold = x.(float64) },
+	},
+	{
+		key: RequireLiveness, kind: KindBool,
+		description: "Reject check-in images that fail the anti-spoofing check",
+		get:         func(v Values) any { return v.RequireLiveness },
+		set:         func(v *Values, x any) { v.RequireLiveness = x.(bool) },
+	},
+	{
+		key: DedupWindow, kind: KindDuration, min: 0, max: 24 * 60 * 60,
+		description: "Check-ins of a user closer together than this are duplicates (0 disables)",
+		get:         func(v Values) any { return v.DedupWindow },
+		set:         func(v *Values, x any) { v.DedupWindow = x.(time.Duration) },
+	},
+	{
+		key: MaxBlur, kind: KindFloat, min: 0, max: 1,
+		description: "Blur score above which an image is too blurry (0 disables)",
+		get:         func(v Values) any { return v.Quality.MaxBlur },
+		set:         func(v *Values, x any) { v.Quality.MaxBlur = x.(float64) },
+	},
+	{
+		key: MinFaceSize, kind: KindInt, min: 0, max: 1 << 20,
+		description: "Smallest face area in pixels (0 disables)",
+		get:         func(v Values) any { return v.Quality.MinFaceSize },
+		set:         func(v *Values, x any) { v.Quality.MinFaceSize = x.(int) },
+	},
+	{
+		key: RequireFrontal, kind: KindBool,
+		description: "Reject faces that do not look straight at the camera",
+		get:         func(v Values) any { return v.Quality.RequireFrontal },
+		set:         func(v *Values, x any) { v.Quality.RequireFrontal = x.(bool) },
+	},
+}
+
+func lookup(key string) (definition, bool) {
+	for _, def := range definitions {
+		if def.key == key {
+			return def, true
+		}
+	}
+	return definition{}, false
+}
+
+// parse decodes and bounds-checks a JSON value for the setting.
+func (def definition) parse(raw json.RawMessage) (any, error) {
+	var (
+		n   float64
+		err error
+		out any
+	)
+	switch def.kind {
+	case KindBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalid, def.key)
+		}
+		return b, nil
+	case KindFloat:
+		if err = json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a number", ErrInvalid, def.key)
+		}
+		out = n
+	case KindInt:
+		if err = json.Unmarshal(raw, &n); err != nil || n != math.Trunc(n) {
+			return nil, fmt.Errorf("%w: %s must be an integer", ErrInvalid, def.key)
+		}
+		out = int(n)
+	case KindDuration:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a duration such as \"5m\"", ErrInvalid, def.key)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be a duration such as \"5m\"", ErrInvalid, def.key)
+		}
+		n, out = d.Seconds(), d
+	}
+	if n < def.min || n > def.max {
+		return nil, fmt.Errorf("%w: %s must be between %v and %v", ErrInvalid, def.key, def.bound(def.min), def.bound(def.max))
+	}
+	return out, nil
+}
+
+// bound returns a bound as a value of the setting's type.
+func (def definition) bound(bound float64) any {
+	switch def.kind {
+	case KindInt:
+		return int(bound)
+	case KindDuration:
+		return (time.Duration(bound) * time.Second).String()
+	}
+	return bound
+}
+
+// encode turns a value from Values into its JSON form, durations as strings.
+func encode(x any) any {
+	if d, ok := x.(time.Duration); ok {
+		return d.String()
+	}
+	return x
+}
@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		key     string
+		raw     string
+		want    any
+		wantErr string
+	}{
+		{MatchThreshold, `0.62`, 0.62, ""},
+		{MatchThreshold, `1`, 1.0, ""},
+		{MatchThreshold, `1.5`, nil, "face_match_threshold must be between 0 and 1"},
+		{MatchThreshold, `"0.6"`, nil, "must be a number"},
+		{RequireLiveness, `true`, true, ""},
+		{RequireLiveness, `"yes"`, nil, "must be true or false"},
+		{DedupWindow, `"90s"`, 90 * time.Second, ""},
+		{DedupWindow, `"0s"`, time.Duration(0), ""},
+		{DedupWindow, `"25h"`, nil, "dedup_window must be between 0s and 24h0m0s"},
+		{DedupWindow, `"-1m"`, nil, "between"},
+		{DedupWindow, `300`, nil, `must be a duration such as "5m"`},
+		{DedupWindow, `"soon"`, nil, `must be a duration such as "5m"`},
+		{MinFaceSize, `4096`, 4096, ""},
+		{MinFaceSize, `40.5`, nil, "must be an integer"},
+		{MinFaceSize, `-1`, nil, "face_min_size must be between 0 and 1048576"},
+		{MaxBlur, `0`, 0.0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.raw, func(t *testing.T) {
+			def, ok := lookup(tt.key)
+			if !ok {
+				t.Fatalf("no definition for %s", tt.key)
+			}
+			got, err := def.parse(json.RawMessage(tt.raw))
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parse = %v, %v; want an ErrInvalid saying %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse = %v (%T), %v; want %v (%T)", got, got, err, tt.want, tt.want)
+			}
+		})
+	}
+}
+
+// Every setting reads and writes its own field of Values.
+func TestDefinitionsRoundTrip(t *testing.T) {
+	seen := map[string]bool{}
+	for _, def := range definitions {
+		if seen[def.key] {
+			t.Errorf("%s defined twice", def.key)
+		}
+		seen[def.key] = true
+		var v Values
+		x := map[string]any{KindFloat: 0.5, KindInt: 7, KindBool: true, KindDuration: time.Minute}[def.kind]
+		def.set(&v, x)
+		if def.get(v) != x {
+			t.Errorf("%s: set %v, got %v", def.key, x, def.get(v))
+		}
+		for _, other := range definitions {
+			if other.key != def.key && other.get(v) != other.get(Values{}) {
+				t.Errorf("setting %s changed %s", def.key, other.key)
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	if got := encode(90 * time.Second); got != "1m30s" {
+		t.Errorf("encode(90s) = %v", got)
+	}
+	if got := encode(0.5); got != 0.5 {
+		t.Errorf("encode(0.5) = %v", got)
+	}
+}
@@ -0,0 +1,246 @@
+// Package spool keeps check-ins in Redis while Postgres is unreachable and
+// stores them once it is back. The client gets the spooled check-in's id
+// straight away; the same id becomes the event id when it is stored.
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+)
+
+var (
+	spooledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "checkin_spool_total",
+		Help: "Check-ins handled by the degraded-mode spool, by outcome (spooled, full, persisted, duplicate, dropped).",
+	}, []string{"outcome"})
+	spoolDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "checkin_spool_depth",
+		Help: "Check-ins waiting in the spool for the database to come back.",
+	})
+)
+
+const (
+	listKey = "attendance:pending_persist"
+	lockKey = "attendance:pending_persist:lock"
+	// lockTTL bounds how long a crashed drainer blocks the others.
+	lockTTL = 30 * time.Second
+	// pingTimeout bounds each database check.
+	pingTimeout = 2 * time.Second
+)
+
+// ErrFull means the spool holds its maximum number of check-ins.
+var ErrFull = errors.New("check-in spool full")
+
+// pushScript appends ARGV[1] unless the list already holds ARGV[2] entries.
+var pushScript = redis.NewScript(`
+if redis.call("LLEN", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("RPUSH", KEYS[1], ARGV[1])
+return 1`)
+
+// releaseScript drops the drain lock only if it still holds our token.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Entry is a check-in accepted while the database was down.
+type Entry struct {
+	ID       string `json:"id"`
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	Location string `json:"location,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	// ImageURLs holds every image of a multi-image check-in; ImageURL is
+	// the first of them.
+	ImageURLs  []string  `json:"image_urls,omitempty"`
+	ClientTime time.Time `json:"client_time,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Spool is a bounded Redis list of check-ins waiting for the database. A nil
+// *Spool is disabled: it never reports degraded and refuses every Push.
+type Spool struct {
+	client *redis.Client
+	max    int64
+	// degraded is set when the database is found unreachable and cleared
+	// when the drainer reaches it again.
+	degraded atomic.Bool
+}
+
+// New returns a spool holding at most max check-ins, or nil when max is not
+// positive, which disables degraded mode.
+func New(client *redis.Client, max int) *Spool {
+	if client == nil || max <= 0 {
+		return nil
+	}
+	return &Spool{client: client, max: int64(max)}
+}
+
+// Degraded reports whether the database was last found unreachable. Check-ins
+// then go straight to the spool instead of waiting for a database timeout.
+func (s *Spool) Degraded() bool {
+	return s != nil && s.degraded.Load()
+}
+
+// MarkDegraded records that the database could not be reached.
+func (s *Spool) MarkDegraded() {
+	if s != nil && !s.degraded.Swap(true) {
+		log.Println("spool: database unreachable, spooling check-ins in Redis")
+	}
+}
+
+// Push spools a check-in and returns it with a fresh id and ReceivedAt.
+func (s *Spool) Push(ctx context.Context, e Entry) (Entry, error) {
+	if s == nil {
+		return e, ErrFull
+	}
+	e.ID = uuid.NewString()
+	if e.ReceivedAt.IsZero() {
+		e.ReceivedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	ok, err := pushScript.Run(ctx, s.client, []string{listKey}, data, s.max).Int()
+	if err != nil {
+		return e, err
+	}
+	if ok == 0 {
+		spooledTotal.WithLabelValues("full").Inc()
+		return e, ErrFull
+	}
+	spooledTotal.WithLabelValues("spooled").Inc()
+	return e, nil
+}
+
+// Len returns the number of spooled check-ins.
+func (s *Spool) Len(ctx context.Context) (int64, error) {
+	if s == nil {
+		return 0, nil
+	}
+	return s.client.LLen(ctx, listKey).Result()
+}
+
+// Drainer stores spooled check-ins once the database answers again. Several
+// API instances may run one; a Redis lock lets one drain at a time.
+type Drainer struct {
+	Spool *Spool
+	// Ping checks the database.
+	Ping func(ctx context.Context) error
+	// Persist stores one check-in. A connection error or timeout (see
+	// attendance.IsUnavailable) keeps the entry for the next pass, as does
+	// any error once the drainer is stopping; any other error drops it.
+	Persist  func(ctx context.Context, e Entry) error
+	Interval time.Duration
+}
+
+// Run drains every Interval until ctx is cancelled.
+func (d Drainer) Run(ctx context.Context) {
+	if d.Spool == nil {
+		return
+	}
+	if d.Interval <= 0 {
+		d.Interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.drain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain checks the database and, when it answers, stores spooled check-ins
+// oldest first until the spool is empty or the database fails again. An
+// entry is removed only after it is stored; if the drainer dies in between,
+// the next pass finds the event already stored under its id.
+func (d Drainer) drain(ctx context.Context) {
+	s := d.Spool
+	if n, err := s.Len(ctx); err == nil {
+		spoolDepth.Set(float64(n))
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	err := d.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil {
+			s.MarkDegraded()
+		}
+		return
+	}
+	if s.degraded.Swap(false) {
+		log.Println("spool: database reachable again")
+	}
+
+	token := uuid.NewString()
+	ok, err := s.client.SetNX(ctx, lockKey, token, lockTTL).Result()
+	if err != nil || !ok {
+		return
+	}
+	defer releaseScript.Run(context.WithoutCancel(ctx), s.client, []string{lockKey}, token)
+
+	stored := 0
+	for ctx.Err() == nil {
+		raw, err := s.client.LIndex(ctx, listKey, 0).Result()
+		if errors.Is(err, redis.Nil) {
+			break
+		}
+		if err != nil {
+			log.Printf("spool: read failed: %v", err)
+			break
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			log.Printf("spool: dropping unreadable entry %q: %v", raw, err)
+			spooledTotal.WithLabelValues("dropped").Inc()
+		} else if err := d.Persist(ctx, e); err != nil {
+			if ctx.Err() != nil {
+				// Stopping, not failing: the entry waits for the next drainer.
+				return
+			}
+			if attendance.IsUnavailable(err) {
+				log.Printf("spool: database failed again, %d check-ins stored this pass: %v", stored, err)
+				s.MarkDegraded()
+				return
+			}
+			outcome := "dropped"
+			if errors.Is(err, attendance.ErrDuplicate) {
+				outcome = "duplicate"
+			}
+			log.Printf("spool: dropping check-in %s for %s: %v", e.ID, e.UserID, err)
+			spooledTotal.WithLabelValues(outcome).Inc()
+		} else {
+			stored++
+			spooledTotal.WithLabelValues("persisted").Inc()
+		}
+		// Only our pass removes entries while it holds the lock, so the head
+		// is still the entry just handled.
+		if err := s.client.LPop(ctx, listKey).Err(); err != nil {
+			log.Printf("spool: remove failed: %v", err)
+			break
+		}
+		s.client.Expire(ctx, lockKey, lockTTL)
+	}
+	if stored > 0 {
+		log.Printf("spool: stored %d spooled check-ins", stored)
+	}
+}
@@ -0,0 +1,135 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+)
+
+func newSpool(t *testing.T, max int) *Spool {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, max)
+}
+
+func ping(context.Context) error { return nil }
+
+func TestPushFull(t *testing.T) {
+	s := newSpool(t, 2)
+	ctx := context.Background()
+	for i := range 2 {
+		if _, err := s.Push(ctx, Entry{UserID: fmt.Sprint("u-", i), DeviceID: "kiosk-1"}); err != nil {
+			t.Fatalf("push %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.Push(ctx, Entry{UserID: "u-3", DeviceID: "kiosk-1"}); !errors.Is(err, ErrFull) {
+		t.Errorf("push past the limit = %v, want ErrFull", err)
+	}
+	if n, _ := s.Len(ctx); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+	var disabled *Spool
+	if _, err := disabled.Push(ctx, Entry{}); !errors.Is(err, ErrFull) || disabled.Degraded() {
+		t.Errorf("nil spool: Push = %v, degraded %v; want ErrFull and not degraded", err, disabled.Degraded())
+	}
+}
+
+// Every image of a multi-image check-in survives the round trip.
+func TestDrainKeepsEveryImage(t *testing.T) {
+	s := newSpool(t, 10)
+	ctx := context.Background()
+	images := []string{"https://img/1.jpg", "https://img/2.jpg", "https://img/3.jpg"}
+	pushed, err := s.Push(ctx, Entry{UserID: "u-1", DeviceID: "kiosk-1", ImageURL: images[0], ImageURLs: images})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Entry
+	s.MarkDegraded()
+	Drainer{Spool: s, Ping: ping, Persist: func(_ context.Context, e Entry) error {
+		got = append(got, e)
+		return nil
+	}}.drain(ctx)
+
+	if len(got) != 1 || got[0].ID != pushed.ID || fmt.Sprint(got[0].ImageURLs) != fmt.Sprint(images) {
+		t.Fatalf("persisted %+v, want %s with %v", got, pushed.ID, images)
+	}
+	if n, _ := s.Len(ctx); n != 0 || s.Degraded() {
+		t.Errorf("after the drain: %d entries, degraded %v; want an empty, healthy spool", n, s.Degraded())
+	}
+}
+
+func TestDrainPersistErrors(t *testing.T) {
+	refused := fmt.Errorf("%w: %w", attendance.ErrStorage, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+	tests := []struct {
+		name         string
+		err          error
+		cancel       bool // the drainer is stopped during Persist
+		wantLeft     int64
+		wantDegraded bool
+	}{
+		{"database unreachable", refused, false, 2, true},
+		{"query timeout", fmt.Errorf("%w: %w", attendance.ErrStorage, context.DeadlineExceeded), false, 2, true},
+		{"drainer stopped", fmt.Errorf("%w: %w", attendance.ErrStorage, context.Canceled), true, 2, false},
+		{"rejected check-in", fmt.Errorf("%w: unknown device", attendance.ErrValidation), false, 0, false},
+		{"already stored", attendance.ErrDuplicate, false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSpool(t, 10)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for _, user := range []string{"u-1", "u-2"} {
+				if _, err := s.Push(ctx, Entry{UserID: user, DeviceID: "kiosk-1"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var persisted []string
+			Drainer{Spool: s, Ping: ping, Persist: func(_ context.Context, e Entry) error {
+				persisted = append(persisted, e.UserID)
+				if e.UserID != "u-1" {
+					return nil
+				}
+				if tt.cancel {
+					cancel()
+				}
+				return tt.err
+			}}.drain(ctx)
+
+			if n, _ := s.Len(context.Background()); n != tt.wantLeft {
+				t.Errorf("%d entries left, want %d (persist calls %v)", n, tt.wantLeft, persisted)
+			}
+			if s.Degraded() != tt.wantDegraded {
+				t.Errorf("degraded = %v, want %v", s.Degraded(), tt.wantDegraded)
+			}
+		})
+	}
+}
+
+// A drainer stopped while it pings does not take the database for down.
+func TestDrainStoppedDuringPing(t *testing.T) {
+	s := newSpool(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	Drainer{Spool: s, Ping: func(context.Context) error {
+		cancel()
+		return context.Canceled
+	}, Persist: func(context.Context, Entry) error { return nil }}.drain(ctx)
+	if s.Degraded() {
+		t.Error("degraded after a cancelled ping")
+	}
+
+	Drainer{Spool: s, Ping: func(context.Context) error {
+		return errors.New("dial tcp: connection refused")
+	}}.drain(context.Background())
+	if !s.Degraded() {
+		t.Error("not degraded after a failed ping")
+	}
+}
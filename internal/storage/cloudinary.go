@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"attendance/internal/cloudinary"
+)
+
+// Cloudinary adapts the Cloudinary client to ImageStore.
+type Cloudinary struct {
+	Client *cloudinary.Client
+}
+
+// NewCloudinary wraps an existing Cloudinary client.
+func NewCloudinary(client *cloudinary.Client) *Cloudinary {
+	return &Cloudinary{Client: client}
+}
+
+// Upload stores the image and returns the size-capped derived URL. The
+// request is aborted as soon as ctx is done.
+func (s *Cloudinary) Upload(ctx context.Context, data []byte, filename, contentType string) (*Object, error) {
+	res, err := s.Client.UploadBytes(ctx, data, filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		Key:         res.PublicID,
+		URL:         res.TransformedURL,
+		OriginalURL: res.SecureURL,
+		Width:       res.Width,
+		Height:      res.Height,
+		Bytes:       res.Bytes,
+	}, nil
+}
+
+// Delete removes the asset identified by its public id.
+func (s *Cloudinary) Delete(ctx context.Context, key string) error {
+	return s.Client.Destroy(key)
+}
+
+// URL returns the delivery URL for a public id.
+func (s *Cloudinary) URL(ctx context.Context, key string) (string, error) {
+	return s.Client.DeliveryURL(key), nil
+}
+
+// KeyForURL returns the public id of a delivery URL from this cloud.
+func (s *Cloudinary) KeyForURL(rawURL string) (string, bool) {
+	return s.Client.PublicIDFromURL(rawURL)
+}
+
+// SignURL returns a download URL for a delivery URL from this cloud that
+// stops working at expires.
+func (s *Cloudinary) SignURL(rawURL string, expires time.Time) (string, bool) {
+	return s.Client.SignDeliveryURL(rawURL, expires)
+}
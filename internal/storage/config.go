@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+
+	"attendance/internal/cloudinary"
+	"attendance/internal/config"
+)
+
+// FromConfig selects the image backend from IMAGE_STORAGE. It returns a nil
+// store when the selected backend is "none" or Cloudinary is not configured.
+// With SIGNED_IMAGE_URLS, Cloudinary uploads are authenticated.
+func FromConfig(cfg config.App) (ImageStore, error) {
+	switch cfg.ImageStorage {
+	case "none":
+		log.Println("Image storage disabled (IMAGE_STORAGE=none)")
+		return nil, nil
+	case "s3":
+		s3, err := NewS3(S3Options{
+			Bucket:          cfg.S3Bucket,
+			Prefix:          cfg.S3Prefix,
+			Region:          cfg.S3Region,
+			Endpoint:        cfg.S3Endpoint,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UsePathStyle:    cfg.S3UsePathStyle,
+			PublicBaseURL:   cfg.S3PublicBaseURL,
+			PresignTTL:      cfg.S3PresignTTL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Println("S3 image storage configured:", cfg.S3Bucket)
+		return s3, nil
+	case "cloudinary", "":
+		if cfg.CloudinaryCloudName == "" || cfg.CloudinaryAPIKey == "" || cfg.CloudinaryAPISecret == "" {
+			log.Println("Cloudinary not configured (CLOUDINARY_CLOUD_NAME / API_KEY / API_SECRET not set)")
+			return nil, nil
+		}
+		cdnClient := cloudinary.New(cfg.CloudinaryCloudName, cfg.CloudinaryAPIKey, cfg.CloudinaryAPISecret, cfg.CloudinaryFolder)
+		cdnClient.MaxDim = cfg.CloudinaryMaxDim
+		cdnClient.Quality = cfg.CloudinaryQuality
+		cdnClient.MaxRetries = cfg.CloudinaryRetries
+		cdnClient.HTTP.Timeout = cfg.CloudinaryTimeout
+		if cfg.SignedImageURLs {
+			cdnClient.Type = "authenticated"
+		}
+		log.Println("Cloudinary configured:", cfg.CloudinaryCloudName)
+		return NewCloudinary(cdnClient), nil
+	default:
+		return nil, fmt.Errorf("unknown IMAGE_STORAGE %q", cfg.ImageStorage)
+	}
+}
+
+// SignerFromConfig returns the Signer for images when SIGNED_IMAGE_URLS is
+// on, and nil otherwise.
+func SignerFromConfig(cfg config.App, images ImageStore) *Signer {
+	if !cfg.SignedImageURLs || images == nil {
+		return nil
+	}
+	return NewSigner(images, cfg.SignedImageURLTTL)
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+)
+
+// S3Options configures an S3-compatible bucket (AWS S3, MinIO, ...).
+type S3Options struct {
+	Bucket          string
+	Prefix          string
+	Region          string
+	Endpoint        string // custom endpoint for MinIO and friends; empty uses AWS
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool
+	// PublicBaseURL, when set, is used to build unsigned URLs (e.g. a CDN or
+	// public-read bucket). Otherwise URLs are presigned for PresignTTL.
+	PublicBaseURL string
+	PresignTTL    time.Duration
+}
+
+// S3 stores images in an S3-compatible bucket.
+type S3 struct {
+	opts    S3Options
+	client  *s3.Client
+	presign *s3.PresignClient
+}
+
+// NewS3 builds an S3 image store. Static credentials are used when provided;
+// without them requests are sent unsigned, which only works for public buckets.
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3: bucket required")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.PresignTTL <= 0 {
+		opts.PresignTTL = 15 * time.Minute
+	}
+	s3opts := s3.Options{
+		Region:       opts.Region,
+		UsePathStyle: opts.UsePathStyle,
+	}
+	if opts.AccessKeyID != "" {
+		s3opts.Credentials = credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, "")
+	}
+	if opts.Endpoint != "" {
+		s3opts.BaseEndpoint = aws.String(opts.Endpoint)
+	}
+	client := s3.New(s3opts)
+	return &S3{opts: opts, client: client, presign: s3.NewPresignClient(client)}, nil
+}
+
+// Upload puts the image under Prefix with a random name and returns its URL.
+func (s *S3) Upload(ctx context.Context, data []byte, filename, contentType string) (*Object, error) {
+	ext := strings.ToLower(path.Ext(filename))
+	if ext == "" {
+		ext = ".jpg"
+	}
+	key := path.Join(s.opts.Prefix, uuid.NewString()+ext)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.opts.Bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: put %s: %w", key, err)
+	}
+	u, err := s.URL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Key: key, URL: u, OriginalURL: u, Bytes: len(data)}, nil
+}
+
+// Delete removes an object; deleting a missing key succeeds.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.opts.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("s3: delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// URL returns a public URL when PublicBaseURL is set, otherwise a presigned GET URL.
+func (s *S3) URL(ctx context.Context, key string) (string, error) {
+	if s.opts.PublicBaseURL != "" {
+		return strings.TrimRight(s.opts.PublicBaseURL, "/") + "/" + key, nil
+	}
+	req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.opts.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.opts.PresignTTL))
+	if err != nil {
+		return "", fmt.Errorf("s3: presign %s: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// KeyForURL returns the object key for a public or presigned URL of this
+// bucket, in either path-style or virtual-hosted form.
+func (s *S3) KeyForURL(rawURL string) (string, bool) {
+	if base := s.opts.PublicBaseURL; base != "" {
+		if key, ok := strings.CutPrefix(rawURL, strings.TrimRight(base, "/")+"/"); ok {
+			key, _, _ = strings.Cut(key, "?")
+			return key, key != ""
+		}
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	p := strings.TrimPrefix(u.Path, "/")
+	if strings.HasPrefix(u.Host, s.opts.Bucket+".") {
+		return p, p != ""
+	}
+	if key, ok := strings.CutPrefix(p, s.opts.Bucket+"/"); ok && key != "" {
+		return key, true
+	}
+	return "", false
+}
+
+// SignURL presigns a GET of the object behind a URL of this bucket, valid
+// until expires.
+func (s *S3) SignURL(rawURL string, expires time.Time) (string, bool) {
+	key, ok := s.KeyForURL(rawURL)
+	if !ok {
+		return "", false
+	}
+	req, err := s.presign.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.opts.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(time.Until(expires)))
+	if err != nil {
+		return "", false
+	}
+	return req.URL, true
+}
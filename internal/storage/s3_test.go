@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+// fakeS3 is a path-style S3 endpoint holding a single bucket. It answers
+// PUT, GET and DELETE of objects and requires every request to be signed,
+// either in the Authorization header or as a presigned query.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	f := &fakeS3{bucket: bucket, objects: map[string]fakeObject{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	signed := strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") ||
+		strings.HasPrefix(r.URL.Query().Get("X-Amz-Credential"), "test-key/")
+	if !signed {
+		s3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Write(obj.data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) object(key string) (fakeObject, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[key]
+	return obj, ok
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
+
+func newTestS3(t *testing.T, endpoint, bucket, publicBaseURL string) *S3 {
+	t.Helper()
+	store, err := NewS3(S3Options{
+		Bucket:          bucket,
+		Prefix:          "faces",
+		Endpoint:        endpoint,
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+		UsePathStyle:    true,
+		PublicBaseURL:   publicBaseURL,
+		PresignTTL:      time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestS3UploadPresigned(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t, "attendance")
+	store := newTestS3(t, srv.URL, "attendance", "")
+	image := []byte("\xff\xd8\xff not really a jpeg")
+
+	obj, err := store.Upload(ctx, image, "Front.JPG", "image/jpeg")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if !strings.HasPrefix(obj.Key, "faces/") || !strings.HasSuffix(obj.Key, ".jpg") || obj.Bytes != len(image) {
+		t.Errorf("Upload = key %q, %d bytes; want faces/<id>.jpg, %d bytes", obj.Key, obj.Bytes, len(image))
+	}
+	stored, ok := fake.object(obj.Key)
+	if !ok || !bytes.Equal(stored.data, image) || stored.contentType != "image/jpeg" {
+		t.Fatalf("stored %q = %q (%s), %v", obj.Key, stored.data, stored.contentType, ok)
+	}
+
+	// The returned URL is presigned and fetches the object as is.
+	if !strings.Contains(obj.URL, "X-Amz-Signature=") || !strings.Contains(obj.URL, "X-Amz-Expires=60") {
+		t.Errorf("URL %q is not presigned for a minute", obj.URL)
+	}
+	resp, err := http.Get(obj.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, image) {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, body)
+	}
+	if key, ok := store.KeyForURL(obj.URL); !ok || key != obj.Key {
+		t.Errorf("KeyForURL = %q, %v; want %q", key, ok, obj.Key)
+	}
+	signed, ok := store.SignURL(obj.URL, time.Now().Add(time.Hour))
+	if !ok || !strings.Contains(signed, "X-Amz-Signature=") {
+		t.Errorf("SignURL = %q, %v", signed, ok)
+	}
+
+	if err := store.Delete(ctx, obj.Key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.object(obj.Key); ok {
+		t.Error("object still stored after Delete")
+	}
+	// Deleting a key that is already gone succeeds.
+	if err := store.Delete(ctx, obj.Key); err != nil {
+		t.Errorf("Delete again: %v", err)
+	}
+}
+
+func TestS3UploadPublicURL(t *testing.T) {
+	_, srv := newFakeS3(t, "attendance")
+	store := newTestS3(t, srv.URL, "attendance", "https://cdn.example.com/")
+
+	obj, err := store.Upload(context.Background(), []byte("png"), "face", "")
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if want := "https://cdn.example.com/" + obj.Key; obj.URL != want || obj.OriginalURL != want {
+		t.Errorf("URL = %q, want %q", obj.URL, want)
+	}
+	if key, ok := store.KeyForURL(obj.URL); !ok || key != obj.Key {
+		t.Errorf("KeyForURL = %q, %v; want %q", key, ok, obj.Key)
+	}
+	if _, ok := store.KeyForURL("https://elsewhere.example.com/" + obj.Key); ok {
+		t.Error("KeyForURL accepted a URL of another host")
+	}
+}
+
+func TestS3UploadMissingBucket(t *testing.T) {
+	fake, srv := newFakeS3(t, "attendance")
+	store := newTestS3(t, srv.URL, "typo", "")
+
+	obj, err := store.Upload(context.Background(), []byte("jpeg"), "face.jpg", "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "NoSuchBucket") {
+		t.Fatalf("Upload = %+v, %v; want NoSuchBucket", obj, err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("stored %d objects after a failed upload", len(fake.objects))
+	}
+}
@@ -0,0 +1,107 @@
+// Package storage abstracts where check-in and enrollment images are kept.
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned by callers when no image store is available.
+var ErrNotConfigured = errors.New("image storage not configured")
+
+// Object describes a stored image.
+type Object struct {
+	// Key identifies the object within the backend (Cloudinary public id, S3 key).
+	Key string
+	// URL is the address downstream consumers (face service, dashboard) should use.
+	URL string
+	// OriginalURL is the unmodified upload when the backend derives a resized copy.
+	OriginalURL string
+	Width       int
+	Height      int
+	Bytes       int
+}
+
+// ImageStore uploads, deletes and resolves images.
+type ImageStore interface {
+	Upload(ctx context.Context, data []byte, filename, contentType string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+	URL(ctx context.Context, key string) (string, error)
+	// KeyForURL maps a URL previously returned by this store back to its key.
+	// It reports false for URLs the store did not produce.
+	KeyForURL(rawURL string) (string, bool)
+}
+
+// URLSigner is implemented by stores that can hand out short-lived signed
+// URLs for images they stored.
+type URLSigner interface {
+	// SignURL returns a URL for rawURL's image valid until expires. It
+	// reports false for URLs the store did not produce.
+	SignURL(rawURL string, expires time.Time) (string, bool)
+}
+
+// Signer replaces stored image URLs with signed ones valid for about TTL. A
+// nil Signer returns URLs unchanged.
+type Signer struct {
+	store URLSigner
+	ttl   time.Duration
+}
+
+// NewSigner returns a Signer for store, or nil when ttl is not positive or
+// the store cannot sign URLs.
+func NewSigner(store ImageStore, ttl time.Duration) *Signer {
+	us, ok := store.(URLSigner)
+	if !ok || ttl <= 0 {
+		return nil
+	}
+	return &Signer{store: us, ttl: ttl}
+}
+
+// Expiry returns when URLs signed at now expire. Expiries are rounded so the
+// same URL is handed out for half the TTL, which lets clients and ETags keep
+// working; a URL is therefore valid for between half the TTL and the TTL.
+// A nil Signer returns the zero time.
+func (s *Signer) Expiry(now time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	step := s.ttl / 2
+	if step <= 0 {
+		step = s.ttl
+	}
+	return now.Truncate(step).Add(s.ttl)
+}
+
+// URL returns a signed URL for rawURL, or rawURL itself when it is empty,
+// foreign to the store, or s is nil.
+func (s *Signer) URL(rawURL string) string {
+	if s == nil || rawURL == "" {
+		return rawURL
+	}
+	if signed, ok := s.store.SignURL(rawURL, s.Expiry(time.Now())); ok {
+		return signed
+	}
+	return rawURL
+}
+
+// DecodeDataURL decodes "data:image/jpeg;base64,..." or bare base64 into bytes
+// and the declared content type (empty for bare base64).
+func DecodeDataURL(s string) ([]byte, string, error) {
+	contentType := ""
+	if strings.HasPrefix(s, "data:") {
+		meta, payload, ok := strings.Cut(s[len("data:"):], ",")
+		if !ok || !strings.HasSuffix(meta, ";base64") {
+			return nil, "", errors.New("invalid data URL")
+		}
+		contentType = strings.TrimSuffix(meta, ";base64")
+		s = payload
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrUploadToken means an upload token is unknown, expired, already used or
+// was issued to another device.
+var ErrUploadToken = errors.New("upload token invalid or already used")
+
+const (
+	uploadTokenPrefix = "attendance:upload-token:"
+	// A claimed token is moved under this prefix until its check-in is
+	// either stored or refused.
+	claimedTokenPrefix = "attendance:upload-token-claimed:"
+)
+
+// claimScript returns the URL bound to a token and moves it aside, in one
+// step, but only for the device it was issued to; otherwise it returns nil
+// and leaves the token alone. The move keeps the token's TTL.
+var claimScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'device') ~= ARGV[1] then
+	return false
+end
+local url = redis.call('HGET', KEYS[1], 'url')
+redis.call('RENAME', KEYS[1], KEYS[2])
+return url
+`)
+
+// releaseScript moves a claimed token back, unless it expired meanwhile.
+var releaseScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('RENAME', KEYS[1], KEYS[2])
+return 1
+`)
+
+// UploadTokens binds uploads to the check-ins that use them: an upload gets
+// a random token naming the stored image and the device that uploaded it,
+// and a check-in presents the token rather than a URL. A token works once
+// and only within its TTL, so an old or borrowed photo cannot be replayed.
+type UploadTokens struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewUploadTokens returns a token store whose tokens live for ttl (10
+// minutes when not positive), or nil when client is nil.
+func NewUploadTokens(client *redis.Client, ttl time.Duration) *UploadTokens {
+	if client == nil {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	return &UploadTokens{client: client, ttl: ttl}
+}
+
+// Issue returns a new token for obj, uploaded by deviceID.
+func (t *UploadTokens) Issue(ctx context.Context, deviceID string, obj *Object) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	key := uploadTokenPrefix + token
+	pipe := t.client.TxPipeline()
+	pipe.HSet(ctx, key, "url", obj.URL, "public_id", obj.Key, "device", deviceID)
+	pipe.Expire(ctx, key, t.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Claim takes token for a check-in and returns the URL of the image it was
+// issued for. It returns ErrUploadToken unless token was issued to deviceID
+// within the TTL and is not used or claimed. A claimed token must be settled:
+// Commit uses it up once the check-in is stored, Release hands it back when
+// the check-in is refused, so the kiosk can retry with it.
+func (t *UploadTokens) Claim(ctx context.Context, token, deviceID string) (string, error) {
+	if t == nil || token == "" {
+		return "", ErrUploadToken
+	}
+	url, err := claimScript.Run(ctx, t.client, []string{uploadTokenPrefix + token, claimedTokenPrefix + token}, deviceID).Text()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrUploadToken
+	}
+	return url, err
+}
+
+// Commit uses up claimed tokens.
+func (t *UploadTokens) Commit(ctx context.Context, tokens ...string) error {
+	if t == nil || len(tokens) == 0 {
+		return nil
+	}
+	keys := make([]string, len(tokens))
+	for i, token := range tokens {
+		keys[i] = claimedTokenPrefix + token
+	}
+	return t.client.Del(ctx, keys...).Err()
+}
+
+// Release hands claimed tokens back for another check-in. A token whose TTL
+// ran out while it was claimed stays gone.
+func (t *UploadTokens) Release(ctx context.Context, tokens ...string) error {
+	if t == nil {
+		return nil
+	}
+	var errs []error
+	for _, token := range tokens {
+		err := releaseScript.Run(ctx, t.client, []string{claimedTokenPrefix + token, uploadTokenPrefix + token}).Err()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TTL is how long a token stays valid.
+func (t *UploadTokens) TTL() time.Duration {
+	return t.ttl
+}
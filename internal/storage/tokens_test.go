@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestTokens(t *testing.T) (*UploadTokens, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewUploadTokens(client, time.Minute), mr
+}
+
+func issueToken(t *testing.T, tokens *UploadTokens, deviceID, url string) string {
+	t.Helper()
+	token, err := tokens.Issue(context.Background(), deviceID, &Object{URL: url, Key: "faces/x"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return token
+}
+
+func TestUploadTokenUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	tokens, _ := newTestTokens(t)
+	token := issueToken(t, tokens, "kiosk-1", "https://img.example/a.jpg")
+
+	url, err := tokens.Claim(ctx, token, "kiosk-1")
+	if err != nil || url != "https://img.example/a.jpg" {
+		t.Fatalf("Claim = %q, %v", url, err)
+	}
+	// A claimed token cannot be claimed again while its check-in runs.
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("second Claim while claimed: err = %v, want ErrUploadToken", err)
+	}
+	if err := tokens.Commit(ctx, token); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("Claim after Commit: err = %v, want ErrUploadToken", err)
+	}
+	// Releasing a used token does not bring it back.
+	if err := tokens.Release(ctx, token); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("Claim after Commit and Release: err = %v, want ErrUploadToken", err)
+	}
+}
+
+func TestUploadTokenWrongDevice(t *testing.T) {
+	ctx := context.Background()
+	tokens, _ := newTestTokens(t)
+	token := issueToken(t, tokens, "kiosk-1", "https://img.example/a.jpg")
+
+	if _, err := tokens.Claim(ctx, token, "kiosk-2"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("Claim from another device: err = %v, want ErrUploadToken", err)
+	}
+	// The refused claim leaves the token to its own device.
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); err != nil {
+		t.Fatalf("Claim from the issuing device: %v", err)
+	}
+	if _, err := tokens.Claim(ctx, "unknown", "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("Claim of an unknown token: err = %v, want ErrUploadToken", err)
+	}
+}
+
+// A check-in refused with 429 hands its tokens back, and the retry succeeds
+// with the same tokens; the one that finally goes through uses them up.
+func TestUploadTokenRetryAfterRefusal(t *testing.T) {
+	ctx := context.Background()
+	tokens, mr := newTestTokens(t)
+	first := issueToken(t, tokens, "kiosk-1", "https://img.example/1.jpg")
+	second := issueToken(t, tokens, "kiosk-1", "https://img.example/2.jpg")
+
+	for _, token := range []string{first, second} {
+		if _, err := tokens.Claim(ctx, token, "kiosk-1"); err != nil {
+			t.Fatalf("Claim %s: %v", token, err)
+		}
+	}
+	if err := tokens.Release(ctx, first, second); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if ttl := mr.TTL(uploadTokenPrefix + first); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("released token TTL = %s, want its remaining TTL", ttl)
+	}
+
+	for _, token := range []string{first, second} {
+		if _, err := tokens.Claim(ctx, token, "kiosk-1"); err != nil {
+			t.Fatalf("Claim %s on retry: %v", token, err)
+		}
+	}
+	if err := tokens.Commit(ctx, first, second); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	for _, token := range []string{first, second} {
+		if _, err := tokens.Claim(ctx, token, "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+			t.Fatalf("Claim %s after the stored retry: err = %v, want ErrUploadToken", token, err)
+		}
+	}
+}
+
+func TestUploadTokenExpiresWhileClaimed(t *testing.T) {
+	ctx := context.Background()
+	tokens, mr := newTestTokens(t)
+	token := issueToken(t, tokens, "kiosk-1", "https://img.example/a.jpg")
+
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	mr.FastForward(2 * time.Minute)
+	if err := tokens.Release(ctx, token); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := tokens.Claim(ctx, token, "kiosk-1"); !errors.Is(err, ErrUploadToken) {
+		t.Fatalf("Claim of an expired token: err = %v, want ErrUploadToken", err)
+	}
+}
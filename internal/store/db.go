@@ -1,11 +1,12 @@
 package store
 
 import (
-	"context"
 	"database/sql"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 // DB wraps sql.DB for Postgres using pgx.
@@ -13,16 +14,43 @@ type DB struct {
 	Client *sql.DB
 }
 
-// NewDB creates a Postgres connection with sane defaults.
-func NewDB(connString string) (*DB, error) {
+// PoolOptions tunes the database/sql connection pool.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// NewDB creates a Postgres connection pool with the given settings. Zero
+// values fall back to sane defaults. The pool connects lazily; use WaitForDB
+// to check that the database is reachable.
+func NewDB(connString string, opts PoolOptions) (*DB, error) {
+	if opts.MaxOpenConns <= 0 {
+		opts.MaxOpenConns = 10
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = 5
+	}
+	if opts.ConnMaxLifetime <= 0 {
+		opts.ConnMaxLifetime = time.Hour
+	}
 	db, err := sql.Open("pgx", connString)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(time.Hour)
-	return &DB{Client: db}, db.PingContext(context.Background())
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	return &DB{Client: db}, nil
+}
+
+// RegisterMetrics exposes sql.DBStats (open, in-use, idle, wait count/duration)
+// as Prometheus gauges labelled with dbName.
+func (d *DB) RegisterMetrics(reg prometheus.Registerer, dbName string) error {
+	if d == nil || d.Client == nil {
+		return nil
+	}
+	return reg.Register(collectors.NewDBStatsCollector(d.Client, dbName))
 }
 
 // Close closes the underlying connection.
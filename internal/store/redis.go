@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -12,15 +14,36 @@ type Redis struct {
 	Client *redis.Client
 }
 
+// RedisOptions describes how to reach Redis. URL (redis:// or rediss://) takes
+// precedence over Addr; a non-empty Password and a non-nil DB override
+// whatever the URL specifies, so DB 0 can replace a URL's /2.
+type RedisOptions struct {
+	URL      string
+	Addr     string
+	Password string
+	DB       *int
+}
+
 // NewRedis connects to redis with short timeouts.
-func NewRedis(addr string) *Redis {
-	client := redis.NewClient(&redis.Options{
-		Addr:         addr,
-		DialTimeout:  2 * time.Second,
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
-	})
-	return &Redis{Client: client}
+func NewRedis(opts RedisOptions) (*Redis, error) {
+	ro := &redis.Options{Addr: opts.Addr}
+	if opts.URL != "" {
+		parsed, err := redis.ParseURL(opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+		}
+		ro = parsed
+	}
+	if opts.Password != "" {
+		ro.Password = opts.Password
+	}
+	if opts.DB != nil {
+		ro.DB = *opts.DB
+	}
+	ro.DialTimeout = 2 * time.Second
+	ro.ReadTimeout = 1 * time.Second
+	ro.WriteTimeout = 1 * time.Second
+	return &Redis{Client: redis.NewClient(ro)}, nil
 }
 
 // Healthy verifies redis connectivity.
@@ -28,5 +51,18 @@ func (r *Redis) Healthy(ctx context.Context) bool {
 	if r == nil || r.Client == nil {
 		return false
 	}
-	return r.Client.Ping(ctx).Err() == nil
+	err := r.Client.Ping(ctx).Err()
+	if err == nil {
+		return true
+	}
+	if isRedisAuthError(err) {
+		log.Printf("redis auth failed (check REDIS_PASSWORD/REDIS_URL): %v", err)
+	} else {
+		log.Printf("redis unreachable: %v", err)
+	}
+	return false
+}
+
+func isRedisAuthError(err error) bool {
+	return redis.HasErrorPrefix(err, "NOAUTH") || redis.HasErrorPrefix(err, "WRONGPASS")
 }
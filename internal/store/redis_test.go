@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestNewRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("default", "s3cret")
+	url := func(password string, db int) string {
+		return fmt.Sprintf("redis://default:%s@%s/%d", password, mr.Addr(), db)
+	}
+	zero, three := 0, 3
+
+	tests := []struct {
+		name    string
+		opts    RedisOptions
+		healthy bool
+		wantDB  int
+	}{
+		{"url", RedisOptions{URL: url("s3cret", 2)}, true, 2},
+		{"REDIS_DB 0 overrides the url", RedisOptions{URL: url("s3cret", 2), DB: &zero}, true, 0},
+		{"REDIS_DB overrides the url", RedisOptions{URL: url("s3cret", 2), DB: &three}, true, 3},
+		{"password overrides the url", RedisOptions{URL: url("stale", 1), Password: "s3cret"}, true, 1},
+		{"wrong password", RedisOptions{URL: url("wrong", 0)}, false, 0},
+		{"addr and password", RedisOptions{Addr: mr.Addr(), Password: "s3cret", DB: &three}, true, 3},
+		{"addr without a password", RedisOptions{Addr: mr.Addr()}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedis(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Client.Close()
+			ctx := context.Background()
+			if got := r.Healthy(ctx); got != tt.healthy {
+				t.Fatalf("Healthy = %v, want %v", got, tt.healthy)
+			}
+			if !tt.healthy {
+				return
+			}
+			key := "db-probe:" + tt.name
+			if err := r.Client.Set(ctx, key, "x", 0).Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !mr.DB(tt.wantDB).Exists(key) {
+				t.Errorf("key written outside DB %d", tt.wantDB)
+			}
+		})
+	}
+
+	if _, err := NewRedis(RedisOptions{URL: "http://" + mr.Addr()}); err == nil {
+		t.Error("NewRedis with an http:// URL succeeded")
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Backoff bounds between dependency checks at startup.
+const (
+	waitInitialBackoff = 250 * time.Millisecond
+	waitMaxBackoff     = 5 * time.Second
+)
+
+// WaitForDB pings Postgres until it answers or timeout elapses, backing off
+// exponentially between attempts. A non-positive timeout tries once.
+func WaitForDB(ctx context.Context, db *DB, timeout time.Duration) error {
+	return waitFor(ctx, "postgres", timeout, db.Client.PingContext)
+}
+
+// WaitForRedis pings Redis until it answers or timeout elapses, backing off
+// exponentially between attempts. A non-positive timeout tries once.
+func WaitForRedis(ctx context.Context, r *Redis, timeout time.Duration) error {
+	return waitFor(ctx, "redis", timeout, func(ctx context.Context) error {
+		return r.Client.Ping(ctx).Err()
+	})
+}
+
+func waitFor(ctx context.Context, name string, timeout time.Duration, ping func(context.Context) error) error {
+	deadline := time.Now().Add(timeout)
+	backoff := waitInitialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := ping(attemptCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("%s reachable after %d attempts", name, attempt)
+			}
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%s not reachable after %d attempts: %w", name, attempt, err)
+		}
+		wait := min(backoff, remaining)
+		log.Printf("waiting for %s (attempt %d, retrying in %s): %v", name, attempt, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s: %w", name, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, waitMaxBackoff)
+	}
+}
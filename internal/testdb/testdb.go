@@ -0,0 +1,111 @@
+// Package testdb gives tests a Postgres database with every migration
+// applied. Each call gets a schema of its own, dropped when the test ends, so
+// tests can run in parallel against one server. Tests that need it are
+// skipped unless TEST_DATABASE_URL names a database they may create schemas
+// in.
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// EnvURL is the variable holding the test database's connection string.
+const EnvURL = "TEST_DATABASE_URL"
+
+// Open returns a database whose search path starts with a fresh schema
+// holding the migrated tables, or skips the test when EnvURL is unset.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("pgx", URL(t))
+	if err != nil {
+		t.Fatalf("testdb: open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// URL is like Open but returns a connection string, for code that connects
+// by itself.
+func URL(t testing.TB) string {
+	t.Helper()
+	dsn := os.Getenv(EnvURL)
+	if dsn == "" {
+		t.Skipf("%s not set; skipping test that needs Postgres", EnvURL)
+	}
+	ctx := context.Background()
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("testdb: open: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	// Extensions live in public, where every test schema finds them, so the
+	// migrations' CREATE EXTENSION IF NOT EXISTS leave them alone.
+	for _, ext := range []string{`"uuid-ossp"`, "pg_trgm"} {
+		if _, err := admin.ExecContext(ctx, "CREATE EXTENSION IF NOT EXISTS "+ext+" SCHEMA public"); err != nil {
+			t.Fatalf("testdb: create extension %s: %v", ext, err)
+		}
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("testdb: %v", err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("testdb: create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Logf("testdb: drop schema %s: %v", schema, err)
+		}
+	})
+
+	// Unknown connection parameters become session settings.
+	searchPath := schema + ",public"
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", searchPath)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + searchPath
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("testdb: open: %v", err)
+	}
+	defer db.Close()
+	files, err := filepath.Glob(filepath.Join(migrationsDir(), "*.up.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("testdb: no migrations found: %v", err)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		q, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("testdb: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, string(q)); err != nil {
+			t.Fatalf("testdb: apply %s: %v", filepath.Base(f), err)
+		}
+	}
+	return dsn
+}
+
+// migrationsDir is the repository's migrations directory.
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}
@@ -0,0 +1,102 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes a fresh self-signed certificate named cn and its key to
+// certFile and keyFile.
+func writePair(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writePair(t, certFile, keyFile, "first")
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %v", err)
+	}
+	if got := servedName(t, r); got != "first" {
+		t.Fatalf("serving %q, want first", got)
+	}
+
+	// A renewed pair is picked up on reload.
+	writePair(t, certFile, keyFile, "renewed")
+	if got := servedName(t, r); got != "first" {
+		t.Errorf("serving %q before the reload, want first", got)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := servedName(t, r); got != "renewed" {
+		t.Errorf("serving %q after the reload, want renewed", got)
+	}
+
+	// A half-written renewal fails to load and the current pair stays.
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("Reload accepted a broken key")
+	}
+	if got := servedName(t, r); got != "renewed" {
+		t.Errorf("serving %q after a failed reload, want renewed", got)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Fatal("NewCertReloader succeeded without certificate files")
+	}
+}
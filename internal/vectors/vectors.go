@@ -0,0 +1,55 @@
+// Package vectors holds small helpers for comparing face embeddings locally.
+// The worker's 1:1 check of every check-in against the enrolled embedding
+// runs here, on the embedding the face service returned, unless
+// VERIFY_ON_CHECKIN hands the comparison to the face service instead.
+package vectors
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrDimensionMismatch is returned when two embeddings have different lengths.
+var ErrDimensionMismatch = errors.New("embedding dimensions differ")
+
+// ErrZeroVector is returned when an embedding has no magnitude.
+var ErrZeroVector = errors.New("embedding has zero magnitude")
+
+// Cosine returns the cosine similarity of a and b in [-1, 1].
+func Cosine(a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, ErrDimensionMismatch
+	}
+	if len(a) == 0 {
+		return 0, ErrZeroVector
+	}
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0, ErrZeroVector
+	}
+	sim := dot / (math.Sqrt(na) * math.Sqrt(nb))
+	// Guard against rounding pushing the result just outside the range.
+	return math.Max(-1, math.Min(1, sim)), nil
+}
+
+// Literal formats v as a pgvector text literal ("[0.1,0.2,...]").
+func Literal(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package vectors
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []float32
+		want    float64
+		wantErr error
+	}{
+		{"identical", []float32{0.3, -1.2, 4}, []float32{0.3, -1.2, 4}, 1, nil},
+		{"same direction", []float32{1, 2, 3}, []float32{2, 4, 6}, 1, nil},
+		{"opposite", []float32{1, -2}, []float32{-1, 2}, -1, nil},
+		{"orthogonal", []float32{1, 0, 0}, []float32{0, 5, 0}, 0, nil},
+		{"45 degrees", []float32{1, 0}, []float32{1, 1}, math.Sqrt2 / 2, nil},
+		{"empty", []float32{}, []float32{}, 0, ErrZeroVector},
+		{"nil", nil, nil, 0, ErrZeroVector},
+		{"zero norm", []float32{0, 0, 0}, []float32{1, 2, 3}, 0, ErrZeroVector},
+		{"zero norm second", []float32{1, 2, 3}, []float32{0, 0, 0}, 0, ErrZeroVector},
+		{"mismatched dimensions", []float32{1, 2, 3}, []float32{1, 2}, 0, ErrDimensionMismatch},
+		{"one empty", []float32{1}, nil, 0, ErrDimensionMismatch},
+	}
+	for _, tt := range tests {
+		got, err := Cosine(tt.a, tt.b)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Cosine error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("%s: Cosine = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Rounding never pushes a similarity outside [-1, 1].
+func TestCosineClamped(t *testing.T) {
+	v := make([]float32, 512)
+	for i := range v {
+		v[i] = 0.1
+	}
+	if got, err := Cosine(v, v); err != nil || got > 1 {
+		t.Errorf("Cosine(v, v) = %v, %v; want at most 1", got, err)
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		v    []float32
+		want string
+	}{
+		{nil, "[]"},
+		{[]float32{1}, "[1]"},
+		{[]float32{0.1, -2.5, 3e-7}, "[0.1,-2.5,3e-07]"},
+	}
+	for _, tt := range tests {
+		if got := Literal(tt.v); got != tt.want {
+			t.Errorf("Literal(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
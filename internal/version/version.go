@@ -0,0 +1,49 @@
+// Package version reports which build is running. The variables are set at
+// link time, e.g.
+//
+//	go build -ldflags "-X attendance/internal/version.Version=v1.4.0 \
+//	  -X attendance/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X attendance/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// and keep their "dev" defaults in builds without those flags.
+package version
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildTime = "dev"
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's info.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+}
+
+// String is the startup banner line, e.g. "api v1.4.0 (commit abc123,
+// built 2024-05-14T09:00:00Z, go1.23.1)".
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
+
+func init() {
+	promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Always 1; the labels identify the running build.",
+	}, []string{"version", "commit", "go_version"}).WithLabelValues(Version, Commit, runtime.Version()).Set(1)
+}
@@ -0,0 +1,43 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Test binaries are built without -ldflags, so every field keeps its default.
+func TestDevDefaults(t *testing.T) {
+	got := Get()
+	want := Info{Version: "dev", Commit: "dev", BuildTime: "dev", GoVersion: runtime.Version()}
+	if got != want {
+		t.Fatalf("Get() = %+v, want %+v", got, want)
+	}
+	if s, want := got.String(), "dev (commit dev, built dev, "+runtime.Version()+")"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestInfoJSON(t *testing.T) {
+	b, err := json.Marshal(Info{Version: "v1.4.0", Commit: "abc123", BuildTime: "2024-05-14T09:00:00Z", GoVersion: "go1.23.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"version":"v1.4.0","commit":"abc123","build_time":"2024-05-14T09:00:00Z","go_version":"go1.23.1"}`
+	if string(b) != want {
+		t.Errorf("JSON = %s, want %s", b, want)
+	}
+}
+
+func TestBuildInfoScraped(t *testing.T) {
+	rec := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `build_info{commit="dev",go_version="` + runtime.Version() + `",version="dev"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("scrape is missing %s", want)
+	}
+}
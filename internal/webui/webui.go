@@ -0,0 +1,162 @@
+// Package webui serves the dashboard: index.html for the root and for any
+// client-side route, and the files under static/ with cache headers.
+package webui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	indexFile = "index.html"
+	staticDir = "static"
+
+	// immutableCache is sent for assets whose URL changes with their content.
+	immutableCache = "public, max-age=31536000, immutable"
+	// revalidateCache makes browsers check the ETag before reusing a file.
+	revalidateCache = "no-cache"
+)
+
+// hashedName matches file names fingerprinted by a build step, such as
+// app.3f9a1c0d.js.
+var hashedName = regexp.MustCompile(`\.[0-9a-f]{8,}\.[A-Za-z0-9]+$`)
+
+// Handler serves files from an fs.FS laid out like the web directory.
+type Handler struct {
+	fsys        fs.FS
+	apiPrefixes []string
+
+	mu    sync.Mutex
+	etags map[string]etag
+}
+
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// New serves fsys. Unknown paths under apiPrefixes, like "/v1/", get a JSON
+// 404 instead of the dashboard.
+func New(fsys fs.FS, apiPrefixes ...string) *Handler {
+	return &Handler{fsys: fsys, apiPrefixes: apiPrefixes, etags: map[string]etag{}}
+}
+
+// Index serves index.html. It is revalidated on every load so a deploy is
+// picked up at once.
+func (h *Handler) Index(c *gin.Context) {
+	h.serve(c, indexFile, revalidateCache)
+}
+
+// Static serves /static/*filepath. Files with a content hash in their name or
+// a ?v= version in their URL are cached for a year; others are revalidated
+// against their ETag. A missing file is a 404, never index.html.
+func (h *Handler) Static(c *gin.Context) {
+	name := path.Join(staticDir, path.Clean("/"+c.Param("filepath")))
+	cache := revalidateCache
+	if hashedName.MatchString(name) || c.Query("v") != "" {
+		cache = immutableCache
+	}
+	h.serve(c, name, cache)
+}
+
+// NoRoute answers unmatched requests. GETs for paths that look like client
+// routes (no API prefix, no file extension) get index.html so deep links work;
+// everything else gets the JSON 404 the API uses.
+func (h *Handler) NoRoute(c *gin.Context) {
+	p := c.Request.URL.Path
+	if (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) &&
+		!h.isAPI(p) && path.Ext(p) == "" {
+		h.Index(c)
+		return
+	}
+	notFound(c)
+}
+
+func (h *Handler) isAPI(p string) bool {
+	for _, prefix := range h.apiPrefixes {
+		if p == strings.TrimSuffix(prefix, "/") || strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) serve(c *gin.Context, name, cache string) {
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		notFound(c)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		notFound(c)
+		return
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "file is not seekable"})
+		return
+	}
+	tag, err := h.etag(name, info, rs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", cache)
+	c.Header("ETag", tag)
+	// ServeContent answers If-None-Match, Range and HEAD.
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), rs)
+}
+
+// etag returns a content hash of name, recomputed only when the file's size
+// or modification time changes (embedded files never do).
+func (h *Handler) etag(name string, info fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	h.mu.Lock()
+	e, ok := h.etags[name]
+	h.mu.Unlock()
+	if ok && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+		return e.value, nil
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	e = etag{modTime: info.ModTime(), size: info.Size(), value: `"` + hex.EncodeToString(sum.Sum(nil)[:8]) + `"`}
+	h.mu.Lock()
+	h.etags[name] = e
+	h.mu.Unlock()
+	return e.value, nil
+}
+
+func notFound(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+}
+
+// ErrNoIndex is returned by Check when the file system has no index.html.
+var ErrNoIndex = errors.New("webui: index.html not found")
+
+// Check reports whether fsys looks like a web directory, so a wrong WEB_DIR
+// is noticed at startup rather than on the first page load.
+func Check(fsys fs.FS) error {
+	if _, err := fs.Stat(fsys, indexFile); err != nil {
+		return ErrNoIndex
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/anomaly"
+	"attendance/internal/attendance"
+)
+
+// Failed matches add up per device until a processed check-in resets them;
+// the outcome that reaches the threshold flags the device and raises one
+// alert. Outcomes that say nothing about the face, such as a poor-quality
+// image, are not counted.
+func TestTrackOutcome(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	d := Deps{
+		Repo:     attendance.NewRepository(db, 0),
+		Failures: anomaly.NewTracker(client, 3, time.Minute),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE devices SET suspicious_at = NOW\(\)`).WithArgs("kiosk-1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO device_alerts`).WithArgs("kiosk-1", attendance.AlertRepeatedFailures, 3).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ctx := context.Background()
+	for _, status := range []string{
+		attendance.StatusUnmatched,
+		attendance.StatusFailed,
+		attendance.StatusProcessed, // resets the two above
+		attendance.StatusMismatch,
+		attendance.StatusPoorQuality,
+		attendance.StatusUnmatched,
+		attendance.StatusFailed, // third in a row: flagged
+		attendance.StatusUnmatched,
+	} {
+		trackOutcome(ctx, d, "kiosk-1", status)
+	}
+	// Another device keeps a count of its own.
+	trackOutcome(ctx, d, "kiosk-2", attendance.StatusUnmatched)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+	if got, _ := mr.Get("attendance:failures:kiosk-1"); got != "4" {
+		t.Errorf("kiosk-1 count = %q, want 4", got)
+	}
+	if got, _ := mr.Get("attendance:failures:kiosk-2"); got != "1" {
+		t.Errorf("kiosk-2 count = %q, want 1", got)
+	}
+}
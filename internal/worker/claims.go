@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+)
+
+var duplicatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_duplicate_messages_total",
+	Help: "Check-in messages skipped as duplicates, by reason (in_progress, processed, terminal).",
+}, []string{"reason"})
+
+const (
+	processingPrefix = "attendance:checkin:processing:"
+	processedPrefix  = "attendance:checkin:processed:"
+)
+
+// releaseScript deletes a lease only if it still holds our token, so a worker
+// whose lease expired cannot drop the one another worker took over.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Claims makes check-in processing idempotent across duplicate queue
+// messages, such as an API publish retried after a timeout that had in fact
+// succeeded. A worker takes a lease on the event id before processing it and
+// leaves a processed marker once the event is settled; a second message for
+// the same id finds one or the other and is skipped.
+type Claims struct {
+	client *redis.Client
+	// lease bounds how long a crashed worker blocks the event; the reconciler
+	// requeues it afterwards.
+	lease time.Duration
+	// keep is how long the processed marker outlives the event's processing.
+	keep time.Duration
+}
+
+// NewClaims returns claims stored in client. It returns nil when client is nil
+// or lease is not positive, which disables the check; a nil *Claims is safe
+// to use and lets every message through.
+func NewClaims(client *redis.Client, lease, keep time.Duration) *Claims {
+	if client == nil || lease <= 0 {
+		return nil
+	}
+	if keep <= 0 {
+		keep = 24 * time.Hour
+	}
+	return &Claims{client: client, lease: lease, keep: keep}
+}
+
+// Acquire takes the processing lease for id. It returns the lease token, or
+// the reason the message is a duplicate. Redis errors let the message through,
+// since the event's status still guards against double processing.
+func (c *Claims) Acquire(ctx context.Context, id string) (token, duplicate string) {
+	if c == nil {
+		return "", ""
+	}
+	n, err := c.client.Exists(ctx, processedPrefix+id).Result()
+	if err != nil {
+		log.Printf("event %s: check processed marker failed: %v", id, err)
+		return "", ""
+	}
+	if n > 0 {
+		return "", "processed"
+	}
+	token = uuid.NewString()
+	ok, err := c.client.SetNX(ctx, processingPrefix+id, token, c.lease).Result()
+	if err != nil {
+		log.Printf("event %s: take processing lease failed: %v", id, err)
+		return "", ""
+	}
+	if !ok {
+		return "", "in_progress"
+	}
+	return token, ""
+}
+
+// Release drops the lease taken with token. Events left pending (no image
+// yet, a retryable error) are released without Done so a later message for
+// them is processed.
+func (c *Claims) Release(ctx context.Context, id, token string) {
+	if c == nil || token == "" {
+		return
+	}
+	if err := releaseScript.Run(ctx, c.client, []string{processingPrefix + id}, token).Err(); err != nil {
+		log.Printf("event %s: release processing lease failed: %v", id, err)
+	}
+}
+
+// Done records that id reached a terminal status.
+func (c *Claims) Done(ctx context.Context, id string) {
+	if c == nil {
+		return
+	}
+	if err := c.client.Set(ctx, processedPrefix+id, time.Now().UTC().Format(time.RFC3339), c.keep).Err(); err != nil {
+		log.Printf("event %s: set processed marker failed: %v", id, err)
+	}
+}
+
+// Forget removes the processed marker so an event reset to pending by an
+// admin is processed again.
+func (c *Claims) Forget(ctx context.Context, id string) error {
+	if c == nil {
+		return nil
+	}
+	return c.client.Del(ctx, processedPrefix+id).Err()
+}
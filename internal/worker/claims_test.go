@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/testdb"
+)
+
+func newTestClaims(t *testing.T) (*Claims, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewClaims(client, time.Minute, time.Hour), mr
+}
+
+func TestClaims(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClaims(t)
+
+	token, dup := c.Acquire(ctx, "evt-1")
+	if token == "" || dup != "" {
+		t.Fatalf("first Acquire = %q, %q; want a token", token, dup)
+	}
+	if _, dup := c.Acquire(ctx, "evt-1"); dup != "in_progress" {
+		t.Fatalf("Acquire while leased = %q, want in_progress", dup)
+	}
+	// Another event is independent.
+	if other, dup := c.Acquire(ctx, "evt-2"); other == "" || dup != "" {
+		t.Fatalf("Acquire of another event = %q, %q", other, dup)
+	}
+
+	// A stale token does not drop the current lease.
+	c.Release(ctx, "evt-1", "not-the-token")
+	if _, dup := c.Acquire(ctx, "evt-1"); dup != "in_progress" {
+		t.Fatalf("Acquire after a stale Release = %q, want in_progress", dup)
+	}
+
+	// Left pending: released without Done, the next message is processed.
+	c.Release(ctx, "evt-1", token)
+	token, dup = c.Acquire(ctx, "evt-1")
+	if token == "" || dup != "" {
+		t.Fatalf("Acquire after Release = %q, %q; want a token", token, dup)
+	}
+
+	c.Done(ctx, "evt-1")
+	c.Release(ctx, "evt-1", token)
+	if _, dup := c.Acquire(ctx, "evt-1"); dup != "processed" {
+		t.Fatalf("Acquire after Done = %q, want processed", dup)
+	}
+
+	if err := c.Forget(ctx, "evt-1"); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if token, dup := c.Acquire(ctx, "evt-1"); token == "" || dup != "" {
+		t.Fatalf("Acquire after Forget = %q, %q; want a token", token, dup)
+	}
+
+	// A crashed worker's lease expires and the event can be taken again.
+	mr.FastForward(2 * time.Minute)
+	if token, dup := c.Acquire(ctx, "evt-2"); token == "" || dup != "" {
+		t.Fatalf("Acquire after the lease expired = %q, %q; want a token", token, dup)
+	}
+}
+
+func TestNilClaimsLetEverythingThrough(t *testing.T) {
+	var c *Claims
+	ctx := context.Background()
+	for range 2 {
+		if token, dup := c.Acquire(ctx, "evt-1"); token != "" || dup != "" {
+			t.Fatalf("nil Acquire = %q, %q", token, dup)
+		}
+	}
+	c.Release(ctx, "evt-1", "")
+	c.Done(ctx, "evt-1")
+	if err := c.Forget(ctx, "evt-1"); err != nil {
+		t.Fatalf("nil Forget: %v", err)
+	}
+	if NewClaims(nil, time.Minute, 0) != nil {
+		t.Fatal("NewClaims without a client is not nil")
+	}
+}
+
+// workerChanges returns the status changes the worker made to id.
+func workerChanges(t *testing.T, repo *attendance.Repository, id string) []attendance.StatusChange {
+	t.Helper()
+	history, err := repo.ListStatusHistory(context.Background(), id)
+	if err != nil {
+		t.Fatalf("ListStatusHistory: %v", err)
+	}
+	var res []attendance.StatusChange
+	for _, c := range history {
+		if c.Actor == attendance.ActorWorker {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func TestProcessEventDuplicateDelivery(t *testing.T) {
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ctx := context.Background()
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpsertEmployee(ctx, "emp-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	evt, err := attendance.NewService(repo, time.Minute).CheckIn(ctx, "emp-1", "kiosk-1", "", "https://img.example/a.jpg", time.Time{})
+	if err != nil {
+		t.Fatalf("check in: %v", err)
+	}
+	claims, _ := newTestClaims(t)
+	d := Deps{Repo: repo, Face: faceclient.New("", true), Claims: claims}
+
+	// The same message delivered several times at once, then again late.
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ProcessEvent(ctx, d, evt.ID); err != nil {
+				t.Errorf("ProcessEvent: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ProcessEvent(ctx, d, evt.ID); err != nil {
+		t.Fatalf("late duplicate: %v", err)
+	}
+	if changes := workerChanges(t, repo, evt.ID); len(changes) != 1 || changes[0].NewStatus != attendance.StatusProcessed {
+		t.Fatalf("worker changes after duplicates = %+v, want one to processed", changes)
+	}
+
+	// An admin reprocess resets the event; while the processed marker
+	// stands, a message for it is still skipped.
+	if err := repo.ResetEventStatus(ctx, evt.ID, "admin"); err != nil {
+		t.Fatalf("ResetEventStatus: %v", err)
+	}
+	if err := ProcessEvent(ctx, d, evt.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.GetEvent(ctx, evt.ID); got.Status != attendance.StatusPending {
+		t.Fatalf("status before Forget = %s, want pending", got.Status)
+	}
+
+	// Forget clears the marker and the event is processed again, once.
+	if err := claims.Forget(ctx, evt.ID); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := ProcessEvent(ctx, d, evt.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if changes := workerChanges(t, repo, evt.ID); len(changes) != 2 {
+		t.Fatalf("worker changes after reprocess = %+v, want 2", changes)
+	}
+}
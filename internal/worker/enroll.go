@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/notify"
+	"attendance/internal/storage"
+)
+
+// ErrFaceEnroll wraps failures to reach or use the face service during enrollment.
+var ErrFaceEnroll = errors.New("face enrollment failed")
+
+// EnrollJob is the body of an "enroll" message on the enrollments queue.
+type EnrollJob struct {
+	EmployeeID string `json:"employee_id"`
+	ImageURL   string `json:"image_url"`
+	Name       string `json:"name,omitempty"`
+}
+
+// EnrollFace registers an employee's face with the face service, marks them
+// enrolled, and stores the embedding and the model that produced it for
+// local verification. The face service
+// fetches the image through a URL signed by images (nil uses the stored URL);
+// the stored URL is what is kept as the photo. A result with Success=false is
+// returned without error so callers can surface the message.
+func EnrollFace(ctx context.Context, repo *attendance.Repository, face *faceclient.Client, images *storage.Signer, job EnrollJob) (*faceclient.EnrollResult, error) {
+	fetchURL := images.URL(job.ImageURL)
+	result, err := face.Enroll(ctx, job.EmployeeID, fetchURL, job.Name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFaceEnroll, err)
+	}
+	if !result.Success {
+		return result, nil
+	}
+	if err := repo.SetEmployeeFaceEnrolled(ctx, job.EmployeeID, true); err != nil {
+		return nil, err
+	}
+	if err := repo.SetEmployeePhotoURL(ctx, job.EmployeeID, job.ImageURL); err != nil {
+		log.Printf("store enrollment photo for %s failed: %v", job.EmployeeID, err)
+	}
+	// Check-ins processed under another model are flagged for re-enrollment.
+	if model, err := face.Model(ctx); err != nil {
+		log.Printf("store enrollment model for %s failed: %v", job.EmployeeID, err)
+	} else if err := repo.SetEmployeeFaceModel(ctx, job.EmployeeID, model.ID()); err != nil {
+		log.Printf("store enrollment model for %s failed: %v", job.EmployeeID, err)
+	}
+	// Keep a copy of the embedding so check-ins can be verified locally
+	// when the face service is down.
+	if emb, err := face.EmbedWithScore(ctx, fetchURL); err != nil {
+		log.Printf("store enrollment embedding for %s failed: %v", job.EmployeeID, err)
+	} else if err := repo.SetEmployeeEmbedding(ctx, job.EmployeeID, emb.Embedding); err != nil {
+		log.Printf("store enrollment embedding for %s failed: %v", job.EmployeeID, err)
+	}
+	return result, nil
+}
+
+// processEnrollment handles an "enroll" message. Only a face service
+// failure is returned, so the enrollment is retried where the backend allows.
+func processEnrollment(ctx context.Context, d Deps, body []byte) error {
+	var job EnrollJob
+	if err := json.Unmarshal(body, &job); err != nil || job.EmployeeID == "" || job.ImageURL == "" {
+		log.Printf("invalid enroll message %q: %v", body, err)
+		return nil
+	}
+	result, err := EnrollFace(ctx, d.Repo, d.Face, d.ImageURLs, job)
+	switch {
+	case err != nil:
+		log.Printf("enrollment of %s failed: %v", job.EmployeeID, err)
+		return err
+	case !result.Success:
+		log.Printf("enrollment of %s rejected: %s", job.EmployeeID, result.Message)
+	default:
+		log.Printf("employee %s enrolled", job.EmployeeID)
+		d.Notifier.NotifyEnrolled(d.NotifyTo, notify.EnrollmentData{
+			EmployeeID: job.EmployeeID,
+			Name:       job.Name,
+			PhotoURL:   job.ImageURL,
+			EnrolledAt: time.Now().UTC(),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+)
+
+// failureReason categorizes a face-service error as one of the attendance
+// Failure reasons, or "" when it fits none. Transport errors and gateway
+// statuses say whether the service was down or slow; for a rejected image the
+// reason is read from the detail of the service's answer.
+func failureReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return attendance.FailureTimeout
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		if ue.Timeout() {
+			return attendance.FailureTimeout
+		}
+		return attendance.FailureServiceUnavailable
+	}
+	if errors.Is(err, faceclient.ErrNoFace) {
+		return attendance.FailureNoFace
+	}
+	var se *faceclient.ServiceError
+	if !errors.As(err, &se) {
+		return ""
+	}
+	switch se.StatusCode {
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return attendance.FailureTimeout
+	case http.StatusTooManyRequests:
+		return attendance.FailureServiceUnavailable
+	}
+	detail := strings.ToLower(se.Detail)
+	switch {
+	case strings.Contains(detail, "multiple faces"), strings.Contains(detail, "more than one face"):
+		return attendance.FailureMultipleFaces
+	case strings.Contains(detail, "no face"):
+		return attendance.FailureNoFace
+	case strings.Contains(detail, "spoof"), strings.Contains(detail, "liveness"):
+		return attendance.FailureSpoof
+	case strings.Contains(detail, "quality"), strings.Contains(detail, "blur"),
+		strings.Contains(detail, "too small"), strings.Contains(detail, "too dark"):
+		return attendance.FailureLowQuality
+	case se.StatusCode >= http.StatusInternalServerError:
+		return attendance.FailureServiceUnavailable
+	}
+	return ""
+}
+
+// statusReason is the failure reason a status implies by itself.
+func statusReason(status string) string {
+	switch status {
+	case attendance.StatusPoorQuality:
+		return attendance.FailureLowQuality
+	case attendance.StatusRejectedSpoof:
+		return attendance.FailureSpoof
+	case attendance.StatusUnmatched, attendance.StatusMismatch:
+		return attendance.FailureMismatch
+	}
+	return ""
+}
+
+// setFailed finishes an event whose face-service call failed with err:
+// degraded when the service could not be reached, poor_quality when it
+// rejected the image as blurry, too small or too dark, like the worker's own
+// quality thresholds, and failed otherwise, with the reason err is
+// categorized as.
+func setFailed(ctx context.Context, d Deps, evt attendance.Event, err error, score *float64) bool {
+	reason := failureReason(err)
+	status := attendance.StatusFailed
+	switch {
+	case faceclient.IsUnavailable(err):
+		status = attendance.StatusDegraded
+	case reason == attendance.FailureLowQuality:
+		status = attendance.StatusPoorQuality
+	}
+	return setOutcome(ctx, d, evt, Outcome{Status: status, MatchScore: score, FailureReason: reason})
+}
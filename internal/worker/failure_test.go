@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+)
+
+// timeoutErr is a net.Error that timed out.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestFailureReason(t *testing.T) {
+	service := func(code int, detail string) error {
+		return fmt.Errorf("embed: %w", &faceclient.ServiceError{StatusCode: code, Status: http.StatusText(code), Detail: detail})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"deadline", fmt.Errorf("embed: %w", context.DeadlineExceeded), attendance.FailureTimeout},
+		{"transport timeout", &url.Error{Op: "Post", URL: "http://face/embed", Err: timeoutErr{}}, attendance.FailureTimeout},
+		{"connection refused", fmt.Errorf("face service request failed: %w", &url.Error{Op: "Post", URL: "http://face/embed", Err: errors.New("connection refused")}), attendance.FailureServiceUnavailable},
+		{"empty embedding", faceclient.ErrNoFace, attendance.FailureNoFace},
+		{"408", service(http.StatusRequestTimeout, ""), attendance.FailureTimeout},
+		{"504", service(http.StatusGatewayTimeout, "upstream timed out"), attendance.FailureTimeout},
+		{"429", service(http.StatusTooManyRequests, "slow down"), attendance.FailureServiceUnavailable},
+		{"no face", service(http.StatusBadRequest, "No face detected in image"), attendance.FailureNoFace},
+		{"multiple faces", service(http.StatusUnprocessableEntity, "Multiple faces detected"), attendance.FailureMultipleFaces},
+		{"more than one face", service(http.StatusBadRequest, "more than one face in frame"), attendance.FailureMultipleFaces},
+		{"spoof", service(http.StatusBadRequest, "Spoof attempt detected"), attendance.FailureSpoof},
+		{"liveness", service(http.StatusBadRequest, "liveness check failed"), attendance.FailureSpoof},
+		{"quality", service(http.StatusBadRequest, "Image quality too low"), attendance.FailureLowQuality},
+		{"blur", service(http.StatusBadRequest, "image is blurry"), attendance.FailureLowQuality},
+		{"too small", service(http.StatusBadRequest, "face too small"), attendance.FailureLowQuality},
+		{"too dark", service(http.StatusBadRequest, "image too dark"), attendance.FailureLowQuality},
+		{"detail wins over 5xx", service(http.StatusInternalServerError, "no face found"), attendance.FailureNoFace},
+		{"500", service(http.StatusInternalServerError, "Traceback ..."), attendance.FailureServiceUnavailable},
+		{"503", service(http.StatusServiceUnavailable, ""), attendance.FailureServiceUnavailable},
+		{"unexplained 400", service(http.StatusBadRequest, "bad request"), ""},
+		{"other error", errors.New("image url required"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureReason(tt.err); got != tt.want {
+				t.Errorf("failureReason(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// The errors the face client really returns are categorized the same way.
+func TestFailureReasonFromClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The case is the path prefix in front of the client's /embed.
+		switch strings.TrimSuffix(r.URL.Path, "/embed") {
+		case "/no-face":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"detail": "No face detected in image"}`)
+		case "/empty":
+			fmt.Fprint(w, `{"embedding": [], "faces_detected": 0}`)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, "internal error")
+		}
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name, baseURL string
+		timeout       time.Duration
+		want          string
+	}{
+		{"no-face", srv.URL + "/no-face", time.Second, attendance.FailureNoFace},
+		{"empty", srv.URL + "/empty", time.Second, attendance.FailureNoFace},
+		{"slow", srv.URL + "/slow", 50 * time.Millisecond, attendance.FailureTimeout},
+		{"crash", srv.URL, time.Second, attendance.FailureServiceUnavailable},
+		{"down", down.URL, time.Second, attendance.FailureServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := faceclient.New(tt.baseURL, false)
+			c.HTTP.Timeout = tt.timeout
+			_, err := c.EmbedWithScore(context.Background(), "https://img.example/a.jpg")
+			if err == nil {
+				t.Fatal("EmbedWithScore succeeded")
+			}
+			if got := failureReason(err); got != tt.want {
+				t.Errorf("failureReason(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusReason(t *testing.T) {
+	tests := map[string]string{
+		attendance.StatusPoorQuality:   attendance.FailureLowQuality,
+		attendance.StatusRejectedSpoof: attendance.FailureSpoof,
+		attendance.StatusUnmatched:     attendance.FailureMismatch,
+		attendance.StatusMismatch:      attendance.FailureMismatch,
+		attendance.StatusProcessed:     "",
+		attendance.StatusFailed:        "",
+		attendance.StatusDegraded:      "",
+	}
+	for status, want := range tests {
+		if got := statusReason(status); got != want {
+			t.Errorf("statusReason(%s) = %q, want %q", status, got, want)
+		}
+	}
+}
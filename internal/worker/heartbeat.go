@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"attendance/internal/version"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const heartbeatPrefix = "attendance:worker:heartbeat:"
+
+// HeartbeatInterval is how often a worker refreshes its heartbeat; a worker
+// missing three in a row disappears from ListWorkers.
+const HeartbeatInterval = 15 * time.Second
+
+// WorkerStatus is what a worker reports in its heartbeat.
+type WorkerStatus struct {
+	Name string `json:"name"`
+	version.Info
+	StartedAt time.Time `json:"started_at"`
+	SeenAt    time.Time `json:"seen_at"`
+}
+
+// Heartbeat writes the worker's name and build to Redis every
+// HeartbeatInterval until ctx is cancelled, then removes it.
+func Heartbeat(ctx context.Context, client *redis.Client, name string) {
+	key := heartbeatPrefix + name
+	status := WorkerStatus{Name: name, Info: version.Get(), StartedAt: time.Now().UTC()}
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		status.SeenAt = time.Now().UTC()
+		body, _ := json.Marshal(status)
+		if err := client.Set(ctx, key, body, 3*HeartbeatInterval).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("worker heartbeat failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			client.Del(context.WithoutCancel(ctx), key)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListWorkers returns the workers with a live heartbeat, by name.
+func ListWorkers(ctx context.Context, client *redis.Client) ([]WorkerStatus, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, heartbeatPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	workers := []WorkerStatus{}
+	if len(keys) == 0 {
+		return workers, nil
+	}
+	values, err := client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue // expired between SCAN and MGET
+		}
+		var w WorkerStatus
+		if err := json.Unmarshal([]byte(s), &w); err != nil {
+			continue
+		}
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].Name < workers[j].Name })
+	return workers, nil
+}
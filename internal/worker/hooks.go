@@ -0,0 +1,191 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+	"attendance/internal/config"
+	"attendance/internal/notifybus"
+	"attendance/internal/push"
+)
+
+var (
+	hookRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_hook_runs_total",
+		Help: "Post-processing hook runs, by hook and result (ok, error, timeout, panic).",
+	}, []string{"hook", "result"})
+	hookDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_hook_duration_seconds",
+		Help:    "Time spent in each post-processing hook.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"hook"})
+)
+
+// Outcome is how processing finalized a check-in.
+type Outcome struct {
+	Status     string
+	MatchScore *float64
+	// FailureReason is why the check-in was not checked in, one of the
+	// attendance Failure reasons, or "" when it was or the cause is unknown.
+	FailureReason string
+}
+
+// Hook is custom logic run after a check-in reaches its final status, such as
+// writing it to an ERP. The event is as it was before the update; the
+// outcome holds the new status. A hook's error is logged and counted but
+// changes nothing else.
+//
+// A fork adds a hook by implementing PostProcess (or wrapping a function in
+// HookFunc) and registering it in HooksFromConfig with a name for its
+// metrics and a timeout:
+//
+//	hooks.Register("erp", erp.NewExporter(cfg.ERPURL), 10*time.Second)
+type Hook interface {
+	PostProcess(ctx context.Context, evt attendance.Event, out Outcome) error
+}
+
+// HookFunc adapts a function to Hook.
+type HookFunc func(ctx context.Context, evt attendance.Event, out Outcome) error
+
+// PostProcess calls f.
+func (f HookFunc) PostProcess(ctx context.Context, evt attendance.Event, out Outcome) error {
+	return f(ctx, evt, out)
+}
+
+type registeredHook struct {
+	name    string
+	hook    Hook
+	timeout time.Duration
+}
+
+// Hooks runs registered hooks after each finalized check-in. A nil *Hooks
+// runs nothing.
+type Hooks struct {
+	hooks []registeredHook
+}
+
+// DefaultHookTimeout bounds a hook registered without a timeout.
+const DefaultHookTimeout = 5 * time.Second
+
+// Register adds hook under name, which labels its metrics and log lines.
+// Each run gets timeout (DefaultHookTimeout when not positive).
+func (h *Hooks) Register(name string, hook Hook, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	h.hooks = append(h.hooks, registeredHook{name: name, hook: hook, timeout: timeout})
+}
+
+// Run calls every hook concurrently and returns when each has finished or
+// hit its timeout. A failing, slow or panicking hook does not affect the
+// others; one that ignores its context is left running in the background.
+func (h *Hooks) Run(ctx context.Context, evt attendance.Event, out Outcome) {
+	if h == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, rh := range h.hooks {
+		wg.Add(1)
+		go func(rh registeredHook) {
+			defer wg.Done()
+			rh.run(ctx, evt, out)
+		}(rh)
+	}
+	wg.Wait()
+}
+
+func (rh registeredHook) run(ctx context.Context, evt attendance.Event, out Outcome) {
+	ctx, cancel := context.WithTimeout(ctx, rh.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%w: %v", errHookPanic, r)
+			}
+		}()
+		done <- rh.hook.PostProcess(ctx, evt, out)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	hookDuration.WithLabelValues(rh.name).Observe(time.Since(start).Seconds())
+
+	result := "ok"
+	switch {
+	case errors.Is(err, errHookPanic):
+		result = "panic"
+	case errors.Is(err, context.DeadlineExceeded):
+		result = "timeout"
+	case err != nil:
+		result = "error"
+	}
+	hookRunsTotal.WithLabelValues(rh.name, result).Inc()
+	if err != nil {
+		log.Printf("event %s: hook %s failed: %v", evt.ID, rh.name, err)
+	}
+}
+
+var errHookPanic = errors.New("hook panicked")
+
+// pushHookTimeout bounds the push hook, which only queues the notification.
+const pushHookTimeout = time.Second
+
+// PushHook sends the final status to the device's companion apps.
+type PushHook struct {
+	Pusher *push.Pusher
+}
+
+// PostProcess queues the push notification; delivery happens in the background.
+func (p PushHook) PostProcess(_ context.Context, evt attendance.Event, out Outcome) error {
+	p.Pusher.Notify(evt.DeviceID, evt.ID, out.Status)
+	return nil
+}
+
+// notifyHookTimeout bounds the notify hook's publish.
+const notifyHookTimeout = 2 * time.Second
+
+// NotifyHook announces the final status on the notification bus, for live
+// dashboards.
+type NotifyHook struct {
+	Bus notifybus.Bus
+}
+
+// PostProcess publishes the event with its new status.
+func (n NotifyHook) PostProcess(ctx context.Context, evt attendance.Event, out Outcome) error {
+	return notifybus.PublishEvent(ctx, n.Bus, notifybus.EventUpdate{
+		ID: evt.ID, Status: out.Status, UserID: evt.UserID, DeviceID: evt.DeviceID, When: evt.When, MatchScore: out.MatchScore,
+		FailureReason: out.FailureReason,
+	})
+}
+
+// HooksFromConfig returns the built-in hooks: push notifications through
+// pusher, announcements on bus, and webhook delivery when WEBHOOK_URL is set,
+// with its attempts stored in deliveries.
+func HooksFromConfig(cfg config.App, pusher *push.Pusher, bus notifybus.Bus, deliveries DeliveryRecorder) *Hooks {
+	hooks := &Hooks{}
+	if pusher != nil {
+		hooks.Register("push", PushHook{Pusher: pusher}, pushHookTimeout)
+	}
+	if bus != nil {
+		hooks.Register("notify", NotifyHook{Bus: bus}, notifyHookTimeout)
+	}
+	if cfg.WebhookURL != "" {
+		webhook := NewWebhook(cfg.WebhookURL, cfg.WebhookSecret)
+		webhook.Deliveries = deliveries
+		hooks.Register("webhook", webhook, cfg.WebhookTimeout)
+	}
+	return hooks
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"context"
+	"log"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceaudit"
+	"attendance/internal/faceclient"
+	"attendance/internal/metrics"
+	"attendance/internal/vectors"
+)
+
+// pickImage embeds every image of a multi-image check-in and keeps the best:
+// one that passes the quality thresholds over one that does not, then the
+// closest to the enrolled face, then the best quality. The pick becomes the
+// event's image and every image's scores are stored with it. When no image
+// could be embedded the last error is returned, an unavailable face service
+// in preference to others so the event is retried.
+func pickImage(ctx context.Context, d Deps, face *faceaudit.Client, evt *attendance.Event) (*faceclient.EmbedResult, error) {
+	var enrolled []float32
+	if !d.Verify {
+		var err error
+		if enrolled, err = d.Repo.EmployeeEmbedding(ctx, evt.UserID); err != nil {
+			log.Printf("event %s: load enrolled embedding failed: %v", evt.ID, err)
+		}
+	}
+
+	scores := attendance.ImageScores{Winner: -1, Images: make([]attendance.ImageScore, len(evt.ImageURLs))}
+	results := make([]*faceclient.EmbedResult, len(evt.ImageURLs))
+	var lastErr error
+	for i, u := range evt.ImageURLs {
+		s := &scores.Images[i]
+		s.Index = i
+		res, err := face.EmbedWithScore(ctx, d.ImageURLs.URL(u))
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("event %s: face embed of image %d failed: %v", evt.ID, i, err)
+			s.Error = err.Error()
+			if lastErr == nil || !faceclient.IsUnavailable(lastErr) {
+				lastErr = err
+			}
+			continue
+		}
+		results[i] = res
+		if res.Quality != nil {
+			q := res.Quality.Score
+			s.Quality = &q
+			metrics.ObserveQualityScore(q)
+		}
+		s.QualityOK = len(d.Quality.Evaluate(res.Quality)) == 0
+		if len(enrolled) > 0 {
+			if sim, err := vectors.Cosine(res.Embedding, enrolled); err == nil {
+				s.Similarity = &sim
+			}
+		}
+		if scores.Winner < 0 || betterImage(*s, scores.Images[scores.Winner]) {
+			scores.Winner = i
+		}
+	}
+	if scores.Winner < 0 {
+		return nil, lastErr
+	}
+
+	evt.ImageURL = evt.ImageURLs[scores.Winner]
+	log.Printf("event %s: picked image %d of %d", evt.ID, scores.Winner, len(evt.ImageURLs))
+	if err := d.Repo.SetEventImageChoice(ctx, evt.ID, evt.ImageURL, scores); err != nil {
+		log.Printf("event %s: store image choice failed: %v", evt.ID, err)
+	}
+	return results[scores.Winner], nil
+}
+
+// betterImage reports whether a ranks above b.
+func betterImage(a, b attendance.ImageScore) bool {
+	if a.QualityOK != b.QualityOK {
+		return a.QualityOK
+	}
+	if a.Similarity != nil && b.Similarity != nil && *a.Similarity != *b.Similarity {
+		return *a.Similarity > *b.Similarity
+	}
+	return orZero(a.Quality) > orZero(b.Quality)
+}
+
+func orZero(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/testdb"
+)
+
+// Each quality gate finishes a check-in as poor_quality with the low_quality
+// reason, whether the worker's thresholds or the face service rejected the
+// image; images within the thresholds are processed.
+func TestQualityGatingOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		quality string // the face service's quality JSON, or an error detail after "reject:"
+		want    Outcome
+	}{
+		{"good", `{"blur": 0.1, "face_size": 120, "is_frontal": true}`, Outcome{Status: attendance.StatusProcessed}},
+		{"nothing reported", `null`, Outcome{Status: attendance.StatusProcessed}},
+		{"blurry", `{"blur": 0.8, "face_size": 120, "is_frontal": true}`, Outcome{Status: attendance.StatusPoorQuality, FailureReason: attendance.FailureLowQuality}},
+		{"blur at the limit", `{"blur": 0.5, "face_size": 120, "is_frontal": true}`, Outcome{Status: attendance.StatusProcessed}},
+		{"too small", `{"blur": 0.1, "face_size": 40, "is_frontal": true}`, Outcome{Status: attendance.StatusPoorQuality, FailureReason: attendance.FailureLowQuality}},
+		{"size at the limit", `{"blur": 0.1, "face_size": 80, "is_frontal": true}`, Outcome{Status: attendance.StatusProcessed}},
+		{"not frontal", `{"blur": 0.1, "face_size": 120, "is_frontal": false}`, Outcome{Status: attendance.StatusPoorQuality, FailureReason: attendance.FailureLowQuality}},
+		{"too dark", `reject:Image too dark`, Outcome{Status: attendance.StatusPoorQuality, FailureReason: attendance.FailureLowQuality}},
+		{"blurry to the face service", `reject:Image is blurry`, Outcome{Status: attendance.StatusPoorQuality, FailureReason: attendance.FailureLowQuality}},
+		{"no face", `reject:No face detected`, Outcome{Status: attendance.StatusFailed, FailureReason: attendance.FailureNoFace}},
+	}
+
+	// The face service answers each image with the quality its case names.
+	var mu sync.Mutex
+	quality := map[string]string{}
+	face := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embed" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			ImageURL string `json:"image_url"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		q := quality[req.ImageURL]
+		mu.Unlock()
+		if detail, ok := strings.CutPrefix(q, "reject:"); ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"detail": %q}`, detail)
+			return
+		}
+		fmt.Fprintf(w, `{"embedding": [0.6, 0.8], "score": 0.97, "faces_detected": 1, "quality": %s}`, q)
+	}))
+	defer face.Close()
+
+	repo := attendance.NewRepository(testdb.Open(t), 0)
+	ctx := context.Background()
+	if _, err := repo.RegisterDevice(ctx, "kiosk-1", "Lobby"); err != nil {
+		t.Fatal(err)
+	}
+	svc := attendance.NewService(repo, time.Minute)
+
+	outcomes := map[string]Outcome{}
+	hooks := &Hooks{}
+	hooks.Register("record", HookFunc(func(_ context.Context, evt attendance.Event, out Outcome) error {
+		mu.Lock()
+		defer mu.Unlock()
+		outcomes[evt.ID] = out
+		return nil
+	}), 0)
+	d := Deps{
+		Repo:    repo,
+		Face:    faceclient.New(face.URL, false),
+		Quality: attendance.QualityThresholds{MaxBlur: 0.5, MinFaceSize: 80, RequireFrontal: true},
+		Hooks:   hooks,
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, image := fmt.Sprintf("emp-%d", i), fmt.Sprintf("https://img.example/%d.jpg", i)
+			mu.Lock()
+			quality[image] = tt.quality
+			mu.Unlock()
+			if err := repo.UpsertEmployee(ctx, user, nil); err != nil {
+				t.Fatal(err)
+			}
+			evt, err := svc.CheckIn(ctx, user, "kiosk-1", "", image, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ProcessEvent(ctx, d, evt.ID); err != nil {
+				t.Fatalf("ProcessEvent: %v", err)
+			}
+			mu.Lock()
+			got, ok := outcomes[evt.ID]
+			mu.Unlock()
+			if !ok || got.Status != tt.want.Status || got.FailureReason != tt.want.FailureReason {
+				t.Errorf("outcome = %+v (recorded %v), want status %s, reason %q", got, ok, tt.want.Status, tt.want.FailureReason)
+			}
+			stored, err := repo.GetEvent(ctx, evt.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.want.Status {
+				t.Errorf("stored status = %s, want %s", stored.Status, tt.want.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+	"attendance/internal/queue"
+)
+
+var reconciledTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "worker_reconciled_events_total",
+	Help: "Stuck pending events re-enqueued by the reconciler.",
+})
+
+// Reconciler re-enqueues events left pending because their queue message was
+// lost (a Redis flush, a crash before publish).
+type Reconciler struct {
+	Repo  *attendance.Repository
+	Queue queue.Queue
+	// StaleAfter is how long an event may stay pending before it is requeued,
+	// and how long before it is requeued again.
+	StaleAfter time.Duration
+	BatchSize  int
+}
+
+// Run requeues stale pending events in batches and returns how many it recovered.
+func (r Reconciler) Run(ctx context.Context) (int, error) {
+	if r.BatchSize <= 0 {
+		r.BatchSize = 100
+	}
+	recovered := 0
+	for {
+		ids, err := r.Repo.ListStaleEvents(ctx, attendance.StatusPending, r.StaleAfter, r.BatchSize)
+		if err != nil {
+			return recovered, err
+		}
+		for _, id := range ids {
+			if err := r.Queue.Publish(ctx, queue.Checkins, queue.Message{Type: "checkin", Body: []byte(id), Key: id}); err != nil {
+				// The claim expires after StaleAfter, so the next pass retries it.
+				return recovered, err
+			}
+			recovered++
+			reconciledTotal.Inc()
+		}
+		if len(ids) < r.BatchSize {
+			return recovered, nil
+		}
+	}
+}
+
+// Schedule runs a pass now and then every interval until ctx is cancelled.
+func (r Reconciler) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := r.Run(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("reconcile: pass failed after %d events: %v", n, err)
+		} else if n > 0 {
+			log.Printf("reconcile: re-enqueued %d stuck pending events", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
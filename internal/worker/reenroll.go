@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/attendance"
+	"attendance/internal/faceclient"
+	"attendance/internal/jobs"
+	"attendance/internal/queue"
+)
+
+// JobFaceReenroll is the job type that re-enrolls every face enrolled with
+// another model than the one the face service runs.
+const JobFaceReenroll = "face.reenroll"
+
+// reenrollBatch is how many employees a re-enrollment job loads at a time.
+const reenrollBatch = 50
+
+var reenrolledTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_reenrollments_total",
+	Help: "Faces re-enrolled by re-enrollment jobs, by result (enrolled, rejected, error).",
+}, []string{"result"})
+
+// JobMessage is the message that tells a worker job id is waiting, so its
+// dispatcher claims it without waiting for the next poll. It goes on the
+// enrollments queue, behind check-ins like other bulk work.
+func JobMessage(id string) queue.Message {
+	return queue.Message{Type: "job", Body: []byte(id), Key: id}
+}
+
+// Reenroll returns the handler for JobFaceReenroll jobs. It enrolls the
+// stored photo of every employee enrolled with another model than the face
+// service now runs, at most d.ReenrollRate a second. Employees are handled in employee_id order and the job's
+// ResumeAfter advances past each, so a resumed or restarted job continues
+// where it stopped, and employees already on the current model are never
+// selected. An employee whose photo is missing or rejected counts as failed
+// and keeps its old enrollment; the face service being unreachable fails the
+// job, which an admin can resume.
+func Reenroll(d Deps) jobs.Handler {
+	return func(ctx context.Context, run *jobs.Run) error {
+		return reenrollAll(ctx, d, run)
+	}
+}
+
+func reenrollAll(ctx context.Context, d Deps, run *jobs.Run) error {
+	model, err := d.Face.Info(ctx)
+	if err != nil {
+		return err
+	}
+	remaining, err := d.Repo.CountReenrollCandidates(ctx, model.ID(), run.ResumeAfter)
+	if err != nil {
+		return err
+	}
+	run.Total = run.Done + run.Failed + remaining
+	if err := run.Progress(ctx); err != nil {
+		return err
+	}
+
+	var tick <-chan time.Time
+	if interval := time.Duration(float64(time.Second) / d.ReenrollRate); d.ReenrollRate > 0 && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		batch, err := d.Repo.ReenrollCandidates(ctx, model.ID(), run.ResumeAfter, reenrollBatch)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, c := range batch {
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-tick:
+				}
+			}
+			if err := reenroll(ctx, d, c); err != nil {
+				if faceclient.IsUnavailable(err) {
+					return err
+				}
+				run.Failed++
+			} else {
+				run.Done++
+			}
+			run.ResumeAfter = c.EmployeeID
+			if err := run.Progress(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reenroll enrolls one employee's stored photo again.
+func reenroll(ctx context.Context, d Deps, c attendance.ReenrollCandidate) error {
+	if c.PhotoURL == nil || *c.PhotoURL == "" {
+		log.Printf("re-enroll %s: no stored photo", c.EmployeeID)
+		reenrolledTotal.WithLabelValues("rejected").Inc()
+		return errors.New("no stored photo")
+	}
+	job := EnrollJob{EmployeeID: c.EmployeeID, ImageURL: *c.PhotoURL}
+	if c.Name != nil {
+		job.Name = *c.Name
+	}
+	result, err := EnrollFace(ctx, d.Repo, d.Face, d.ImageURLs, job)
+	switch {
+	case err != nil:
+		log.Printf("re-enroll %s failed: %v", c.EmployeeID, err)
+		reenrolledTotal.WithLabelValues("error").Inc()
+		return err
+	case !result.Success:
+		log.Printf("re-enroll %s rejected: %s", c.EmployeeID, result.Message)
+		reenrolledTotal.WithLabelValues("rejected").Inc()
+		return errors.New(result.Message)
+	}
+	reenrolledTotal.WithLabelValues("enrolled").Inc()
+	return nil
+}
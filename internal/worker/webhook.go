@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"attendance/internal/attendance"
+)
+
+// Webhook posts each finalized check-in as JSON to a customer endpoint. With
+// a secret, the body is signed with HMAC-SHA256 in the X-Signature header
+// ("sha256=<hex>") so the receiver can check where it came from.
+type Webhook struct {
+	URL    string
+	Secret string
+	HTTP   *http.Client
+	// Deliveries stores every attempt for the event timeline; nil stores
+	// none.
+	Deliveries DeliveryRecorder
+}
+
+// DeliveryRecorder stores webhook delivery attempts.
+type DeliveryRecorder interface {
+	RecordWebhookDelivery(ctx context.Context, d attendance.WebhookDelivery) error
+}
+
+// NewWebhook returns a webhook hook posting to url.
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{URL: url, Secret: secret, HTTP: &http.Client{}}
+}
+
+// webhookPayload is the body the webhook receives.
+type webhookPayload struct {
+	Type       string    `json:"type"`
+	EventID    string    `json:"event_id"`
+	UserID     string    `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Status     string    `json:"status"`
+	MatchScore *float64  `json:"match_score"`
+	AuthMethod string    `json:"auth_method,omitempty"`
+	// FailureReason says why the check-in did not check in, when known.
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// PostProcess delivers the event once; a non-2xx answer is an error. The
+// hook's timeout bounds the request. The attempt is recorded either way.
+func (w *Webhook) PostProcess(ctx context.Context, evt attendance.Event, out Outcome) error {
+	start := time.Now()
+	status, err := w.deliver(ctx, evt, out)
+	w.record(ctx, evt.ID, status, err, start)
+	return err
+}
+
+// deliver posts the event and returns the answer's status code, zero when
+// none came back.
+func (w *Webhook) deliver(ctx context.Context, evt attendance.Event, out Outcome) (int, error) {
+	body, err := json.Marshal(webhookPayload{
+		Type:          "checkin.finalized",
+		EventID:       evt.ID,
+		UserID:        evt.UserID,
+		DeviceID:      evt.DeviceID,
+		OccurredAt:    evt.When.UTC(),
+		Status:        out.Status,
+		MatchScore:    out.MatchScore,
+		AuthMethod:    evt.AuthMethod,
+		FailureReason: out.FailureReason,
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// record stores the attempt. It outlives the hook's timeout, which may be
+// what ended the attempt.
+func (w *Webhook) record(ctx context.Context, eventID string, status int, err error, start time.Time) {
+	if w.Deliveries == nil {
+		return
+	}
+	d := attendance.WebhookDelivery{EventID: eventID, URL: w.URL, Duration: time.Since(start), CreatedAt: start.UTC()}
+	if status != 0 {
+		d.StatusCode = &status
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if err := w.Deliveries.RecordWebhookDelivery(context.WithoutCancel(ctx), d); err != nil {
+		log.Printf("event %s: record webhook delivery failed: %v", eventID, err)
+	}
+}
@@ -0,0 +1,451 @@
+// Package worker runs the check-in processing loop shared by cmd/worker and
+// the API's in-process mode.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"attendance/internal/anomaly"
+	"attendance/internal/attendance"
+	"attendance/internal/cache"
+	"attendance/internal/faceaudit"
+	"attendance/internal/faceclient"
+	"attendance/internal/jobs"
+	"attendance/internal/metrics"
+	"attendance/internal/notify"
+	"attendance/internal/queue"
+	"attendance/internal/settings"
+	"attendance/internal/storage"
+	"attendance/internal/vectors"
+)
+
+var processedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_messages_processed_total",
+	Help: "Check-in messages consumed by the worker, by resulting status.",
+}, []string{"status"})
+
+var verificationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_verifications_total",
+	Help: "Check-in identity verifications, by result (verified, mismatch, unenrolled, error).",
+}, []string{"result"})
+
+var modelMismatchTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "worker_model_mismatch_total",
+	Help: "Check-ins processed under a different face model than the user was enrolled with.",
+})
+
+// Deps are the collaborators the worker loop needs.
+type Deps struct {
+	Repo    *attendance.Repository
+	Face    *faceclient.Client
+	Queue   queue.Queue
+	Quality attendance.QualityThresholds
+	// MatchThreshold is the minimum cosine similarity between the check-in and
+	// the enrolled embedding; events below it become unmatched.
+	MatchThreshold float64
+	// Verify has the face service verify the image against the claimed user;
+	// only a verified match at or above MatchThreshold is processed.
+	Verify bool
+	// RequireLiveness rejects images that fail the face service's
+	// anti-spoofing check as rejected_spoof.
+	RequireLiveness bool
+	// Settings, when set, supplies MatchThreshold, Quality and
+	// RequireLiveness for each check-in, so admins can change them at
+	// runtime.
+	Settings *settings.Provider
+	// Failures counts failed matches per device; nil disables anomaly detection.
+	Failures *anomaly.Tracker
+	// Shifts looks up users' shifts to record lateness; nil skips it.
+	Shifts *attendance.ShiftCache
+	// Notifier emails NotifyTo when a queued enrollment succeeds; nil skips it.
+	Notifier *notify.Notifier
+	NotifyTo []string
+	// Cache is invalidated when an event's status changes; nil skips it.
+	Cache *cache.Events
+	// Claims skips duplicate messages for the same check-in; nil relies on
+	// the event status alone.
+	Claims *Claims
+	// FaceAudit records the face-service calls made for each check-in; nil
+	// skips it.
+	FaceAudit *faceaudit.Recorder
+	// Hooks run after an event reaches its final status, e.g. push
+	// notifications and webhooks; nil runs none.
+	Hooks *Hooks
+	// ImageURLs signs stored image URLs before they go to the face service,
+	// for stores that keep images private; nil passes them as stored.
+	ImageURLs *storage.Signer
+	// ReenrollRate caps the face-service enrollments a re-enrollment job
+	// makes per second; zero does not limit them.
+	ReenrollRate float64
+	// Jobs is woken by "job" messages; nil leaves jobs to be found when
+	// some dispatcher next polls.
+	Jobs *jobs.Dispatcher
+}
+
+// Run consumes queue messages, calls the face service, and updates events.
+// It returns once ctx is cancelled and the queue has stopped delivering; a
+// message already being processed is allowed to finish.
+func Run(ctx context.Context, d Deps) error {
+	// Check face service health on startup
+	if !d.Face.Skip {
+		if m, err := d.Face.Model(ctx); err != nil {
+			log.Printf("WARNING: Face service not available: %v", err)
+			log.Println("Worker will retry face processing when events arrive")
+		} else {
+			log.Printf("Face service connected, model %s", m.ID())
+		}
+	}
+
+	// Check-ins come first so enrollment batches never delay them.
+	messages, err := d.Queue.Consume(ctx, queue.Priority...)
+	if err != nil {
+		return fmt.Errorf("queue consume init failed: %w", err)
+	}
+
+	log.Println("worker started, waiting for messages...")
+	for msg := range messages {
+		// In-flight work must not be cut short by shutdown.
+		workCtx := queue.MessageContext(context.WithoutCancel(ctx), msg)
+		var err error
+		switch msg.Type {
+		case "checkin":
+			err = ProcessEvent(workCtx, d, string(msg.Body))
+		case "enroll":
+			err = processEnrollment(workCtx, d, msg.Body)
+		case "job":
+			// The dispatcher claims and runs jobs from the jobs table; the
+			// message only saves it waiting for its next poll.
+			d.Jobs.Wake()
+		default:
+			_ = msg.Ack(workCtx)
+			continue
+		}
+		// A nacked message is redelivered by backends that support it.
+		if err != nil {
+			log.Printf("%s message %s failed (request %s), nacking: %v", msg.Type, msg.Key, msg.Metadata[queue.MetaRequestID], err)
+			_ = msg.Nack(workCtx)
+		} else {
+			_ = msg.Ack(workCtx)
+		}
+
+		time.Sleep(10 * time.Millisecond) // Small delay between processing
+	}
+
+	log.Println("worker stopped")
+	return nil
+}
+
+// ProcessEvent runs the face pipeline for check-in id unless another worker
+// holds it or already finished it. The worker calls it for each queued
+// check-in; with SYNC_FACE_PROCESSING the API calls it inline under a
+// deadline. When ctx ends before the outcome is stored, the event is left
+// pending and ctx's error returned, so the check-in can still be queued.
+func ProcessEvent(ctx context.Context, d Deps, id string) error {
+	token, duplicate := d.Claims.Acquire(ctx, id)
+	if duplicate != "" {
+		duplicatesTotal.WithLabelValues(duplicate).Inc()
+		log.Printf("event %s: duplicate message (%s), skipping", id, duplicate)
+		return nil
+	}
+	// Released even when ctx has expired, or the queued retry would be
+	// skipped as leased.
+	defer d.Claims.Release(context.WithoutCancel(ctx), id, token)
+	return processCheckin(ctx, d, id)
+}
+
+// processCheckin runs one check-in to a terminal status. It returns an error
+// only when the event could not be loaded for a reason worth retrying, or
+// when ctx ended first.
+func processCheckin(ctx context.Context, d Deps, id string) error {
+	log.Printf("processing event %s", id)
+	if d.Settings != nil {
+		s := d.Settings.Current(ctx)
+		d.MatchThreshold, d.Quality, d.RequireLiveness = s.MatchThreshold, s.Quality, s.RequireLiveness
+	}
+
+	evt, err := d.Repo.GetEvent(ctx, id)
+	if err != nil {
+		log.Printf("fetch event %s failed: %v", id, err)
+		if errors.Is(err, attendance.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if evt.Status != attendance.StatusPending {
+		log.Printf("event %s already %s, skipping duplicate message", id, evt.Status)
+		duplicatesTotal.WithLabelValues("terminal").Inc()
+		d.Claims.Done(ctx, id)
+		return nil
+	}
+	if evt.ImageURL == "" {
+		// The kiosk may still attach the photo with PATCH /v1/checkins/:id,
+		// which queues the event again.
+		log.Printf("event %s has no image yet, leaving it pending", id)
+		return nil
+	}
+
+	// A previous attempt may already have an embedding; reuse it so a retry
+	// does not depend on the face service.
+	embedding, err := d.Repo.EventEmbedding(ctx, id)
+	if err != nil {
+		log.Printf("event %s: load cached embedding failed: %v", id, err)
+	}
+	face := faceaudit.Wrap(d.Face, d.FaceAudit, id, d.MatchThreshold)
+	quality := evt.Quality
+	var score *float64
+	if len(embedding) > 0 {
+		log.Printf("event %s: using cached embedding", id)
+	} else {
+		var result *faceclient.EmbedResult
+		if len(evt.ImageURLs) > 1 {
+			result, err = pickImage(ctx, d, face, &evt)
+		} else {
+			result, err = face.EmbedWithScore(ctx, d.ImageURLs.URL(evt.ImageURL))
+		}
+		if err != nil && ctx.Err() != nil {
+			// Out of time, not a face-service outcome: leave it pending.
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("face embed failed for %s: %v", id, err)
+			setFailed(ctx, d, evt, err, nil)
+			return nil
+		}
+
+		// Use actual detection confidence from face service
+		score = &result.Score
+		log.Printf("event %s: detected %d face(s), confidence: %.2f", id, result.FacesDetected, result.Score)
+
+		embedding, quality = result.Embedding, result.Quality
+		if quality != nil && len(evt.ImageURLs) <= 1 {
+			metrics.ObserveQualityScore(quality.Score)
+		}
+		if err := d.Repo.SetEventQuality(ctx, id, quality); err != nil {
+			log.Printf("event %s: store quality failed: %v", id, err)
+		}
+		if err := d.Repo.SetEventEmbedding(ctx, id, embedding); err != nil {
+			log.Printf("event %s: cache embedding failed: %v", id, err)
+		}
+	}
+
+	recordModel(ctx, d, evt)
+
+	if issues := d.Quality.Evaluate(quality); len(issues) > 0 {
+		log.Printf("event %s: poor image quality: %v", id, issues)
+		setStatus(ctx, d, evt, attendance.StatusPoorQuality, score)
+		return nil
+	}
+
+	if d.RequireLiveness {
+		if settled, err := checkLiveness(ctx, d, face, evt, score); settled {
+			return err
+		}
+	}
+
+	if d.Verify {
+		return verifyIdentity(ctx, d, face, evt)
+	}
+
+	// 1:1 verification against the enrolled embedding, computed locally on
+	// every event: the face service only embeds the image. Users without an
+	// enrolled embedding are processed on detection alone.
+	enrolled, err := d.Repo.EmployeeEmbedding(ctx, evt.UserID)
+	if err != nil {
+		log.Printf("event %s: load enrolled embedding failed: %v", id, err)
+	}
+	if len(enrolled) > 0 {
+		start := time.Now()
+		sim, err := vectors.Cosine(embedding, enrolled)
+		face.Compared(evt.UserID, sim, time.Since(start), err)
+		if err != nil {
+			log.Printf("event %s: compare with enrollment failed: %v", id, err)
+			setStatus(ctx, d, evt, attendance.StatusFailed, score)
+			return nil
+		}
+		metrics.ObserveMatchScore(sim)
+		score = &sim
+		if sim < d.MatchThreshold {
+			log.Printf("event %s: similarity %.2f below threshold %.2f", id, sim, d.MatchThreshold)
+			setStatus(ctx, d, evt, attendance.StatusUnmatched, score)
+			return nil
+		}
+	}
+
+	// Mark as processed with the match (or detection) score
+	if setStatus(ctx, d, evt, attendance.StatusProcessed, score) {
+		log.Printf("event %s processed successfully", id)
+	}
+	return nil
+}
+
+// recordModel stores the face model the check-in is processed under and
+// flags it when the user was enrolled under another, whose embeddings it
+// cannot be reliably compared with. The check-in is still processed; admins
+// see the mismatch and re-enroll. Nothing is recorded if the face service
+// cannot say which model it runs.
+func recordModel(ctx context.Context, d Deps, evt attendance.Event) {
+	model, err := d.Face.Model(ctx)
+	if err != nil {
+		log.Printf("event %s: face model unknown: %v", evt.ID, err)
+		return
+	}
+	enrolled, err := d.Repo.EmployeeFaceModel(ctx, evt.UserID)
+	if err != nil {
+		log.Printf("event %s: load enrollment model failed: %v", evt.ID, err)
+	}
+	mismatch := enrolled != "" && enrolled != model.ID()
+	if mismatch {
+		modelMismatchTotal.Inc()
+		log.Printf("WARNING: event %s: user %s was enrolled with model %s but the face service runs %s; re-enroll them", evt.ID, evt.UserID, enrolled, model.ID())
+	}
+	if err := d.Repo.SetEventFaceModel(ctx, evt.ID, model.ID(), mismatch); err != nil {
+		log.Printf("event %s: store face model failed: %v", evt.ID, err)
+	}
+}
+
+// checkLiveness runs the face service's anti-spoofing check on the
+// check-in image. A spoof becomes rejected_spoof and a failed check degraded
+// or failed; settled reports whether the event was finished (or, with ctx's
+// error, left pending) rather than passing.
+func checkLiveness(ctx context.Context, d Deps, face *faceaudit.Client, evt attendance.Event, score *float64) (settled bool, err error) {
+	res, err := face.Liveness(ctx, d.ImageURLs.URL(evt.ImageURL))
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return true, ctx.Err()
+	case err != nil:
+		log.Printf("event %s: liveness check failed: %v", evt.ID, err)
+		setFailed(ctx, d, evt, err, nil)
+		return true, nil
+	case !res.IsLive:
+		log.Printf("event %s: rejected as a spoof (liveness confidence %.2f)", evt.ID, res.Confidence)
+		setStatus(ctx, d, evt, attendance.StatusRejectedSpoof, score)
+		return true, nil
+	}
+	return false, nil
+}
+
+// verifyIdentity asks the face service whether the check-in image is the
+// claimed user and finishes the event as processed, mismatch or unenrolled.
+// It returns ctx's error, leaving the event pending, if ctx ends during the call.
+func verifyIdentity(ctx context.Context, d Deps, face *faceaudit.Client, evt attendance.Event) error {
+	res, err := face.Verify(ctx, evt.UserID, d.ImageURLs.URL(evt.ImageURL))
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(err, faceclient.ErrNotEnrolled):
+		log.Printf("event %s: user %s is not enrolled, leaving for admin review", evt.ID, evt.UserID)
+		verificationsTotal.WithLabelValues("unenrolled").Inc()
+		setStatus(ctx, d, evt, attendance.StatusUnenrolled, nil)
+		return nil
+	case err != nil:
+		log.Printf("event %s: verify failed: %v", evt.ID, err)
+		verificationsTotal.WithLabelValues("error").Inc()
+		setFailed(ctx, d, evt, err, nil)
+		return nil
+	}
+	sim := res.Similarity
+	metrics.ObserveMatchScore(sim)
+	if !res.Verified || sim < d.MatchThreshold {
+		log.Printf("event %s: not verified as %s (similarity %.2f, threshold %.2f)", evt.ID, evt.UserID, sim, d.MatchThreshold)
+		verificationsTotal.WithLabelValues("mismatch").Inc()
+		setStatus(ctx, d, evt, attendance.StatusMismatch, &sim)
+		return nil
+	}
+	verificationsTotal.WithLabelValues("verified").Inc()
+	if setStatus(ctx, d, evt, attendance.StatusProcessed, &sim) {
+		log.Printf("event %s verified as %s (similarity %.2f)", evt.ID, evt.UserID, sim)
+	}
+	return nil
+}
+
+// setStatus applies a terminal status with the failure reason it implies.
+func setStatus(ctx context.Context, d Deps, evt attendance.Event, status string, score *float64) bool {
+	return setOutcome(ctx, d, evt, Outcome{Status: status, MatchScore: score, FailureReason: statusReason(status)})
+}
+
+// setOutcome applies a terminal status, logging and skipping rejected transitions.
+func setOutcome(ctx context.Context, d Deps, evt attendance.Event, out Outcome) bool {
+	id, status, score := evt.ID, out.Status, out.MatchScore
+	err := d.Repo.UpdateEventStatus(ctx, id, status, score, out.FailureReason)
+	if err == nil {
+		processedTotal.WithLabelValues(status).Inc()
+		metrics.EventFinalized(status)
+		trackOutcome(ctx, d, evt.DeviceID, status)
+		if status == attendance.StatusProcessed {
+			RecordLateness(ctx, d, evt)
+		}
+		d.Cache.Invalidate(ctx)
+		d.Claims.Done(ctx, id)
+		d.Hooks.Run(ctx, evt, out)
+	}
+	switch {
+	case errors.Is(err, attendance.ErrInvalidTransition):
+		// Someone else settled the event first.
+		log.Printf("event %s: status %s rejected, skipping: %v", id, status, err)
+		d.Claims.Done(ctx, id)
+		return false
+	case err != nil:
+		log.Printf("event %s: update status %s failed: %v", id, status, err)
+		return false
+	}
+	return true
+}
+
+// RecordLateness stores how late a processed check-in was for the user's
+// shift. Users without a shift, and check-ins outside it, are left without
+// lateness. The API calls it for PIN check-ins, which skip the worker.
+func RecordLateness(ctx context.Context, d Deps, evt attendance.Event) {
+	if d.Shifts == nil {
+		return
+	}
+	shift, ok, err := d.Shifts.ForUser(ctx, evt.UserID)
+	if err != nil {
+		log.Printf("event %s: load shift failed: %v", evt.ID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	late, ok := shift.Lateness(evt.When)
+	if !ok {
+		return
+	}
+	if err := d.Repo.SetEventLateness(ctx, evt.ID, late); err != nil {
+		log.Printf("event %s: store lateness failed: %v", evt.ID, err)
+	}
+}
+
+// trackOutcome feeds the device's failed-match counter: unmatched, mismatched
+// and failed check-ins count toward the threshold, a processed one resets it.
+// Reaching the threshold flags the device and raises an alert.
+func trackOutcome(ctx context.Context, d Deps, deviceID, status string) {
+	if d.Failures == nil {
+		return
+	}
+	switch status {
+	case attendance.StatusProcessed:
+		if err := d.Failures.Reset(ctx, deviceID); err != nil {
+			log.Printf("device %s: reset failure count failed: %v", deviceID, err)
+		}
+	case attendance.StatusUnmatched, attendance.StatusMismatch, attendance.StatusFailed:
+		n, crossed, err := d.Failures.RecordFailure(ctx, deviceID)
+		if err != nil {
+			log.Printf("device %s: record failure failed: %v", deviceID, err)
+			return
+		}
+		if !crossed {
+			return
+		}
+		log.Printf("device %s: %d failed matches, flagging as suspicious", deviceID, n)
+		if err := d.Repo.FlagDeviceSuspicious(ctx, deviceID, int(n)); err != nil {
+			log.Printf("device %s: flag suspicious failed: %v", deviceID, err)
+		}
+	}
+}
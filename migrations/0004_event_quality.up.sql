@@ -0,0 +1,2 @@
+-- Face quality metrics reported for each check-in image
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS quality JSONB;
@@ -0,0 +1,2 @@
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS embedding;
+ALTER TABLE employees DROP COLUMN IF EXISTS face_embedding;
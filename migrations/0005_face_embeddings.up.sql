@@ -0,0 +1,4 @@
+-- Persist face embeddings so 1:1 verification can run without the face service.
+-- REAL[] keeps this portable; deployments with pgvector can cast to vector.
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS face_embedding REAL[];
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS embedding REAL[];
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS metadata;
+ALTER TABLE devices DROP COLUMN IF EXISTS app_version;
+ALTER TABLE devices DROP COLUMN IF EXISTS last_seen_at;
@@ -0,0 +1,4 @@
+-- Kiosk heartbeat: liveness, firmware version and battery/storage metadata
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS app_version TEXT;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS metadata JSONB;
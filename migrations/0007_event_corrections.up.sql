@@ -0,0 +1,14 @@
+-- Admin corrections to attendance events. The event row holds the corrected
+-- value; every change keeps the original here so nothing is silently rewritten.
+CREATE TABLE IF NOT EXISTS event_corrections (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id UUID NOT NULL REFERENCES attendance_events(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    reason TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_corrections_event ON event_corrections(event_id, created_at);
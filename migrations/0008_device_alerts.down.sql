@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS device_alerts;
+ALTER TABLE devices DROP COLUMN IF EXISTS suspicious_at;
@@ -0,0 +1,14 @@
+-- Devices flagged after repeated failed face matches, and the alerts raised for them
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS suspicious_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS device_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    device_id TEXT NOT NULL REFERENCES devices(device_id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_alerts_device ON device_alerts(device_id, created_at DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE employees DROP COLUMN IF EXISTS photo_url;
+ALTER TABLE devices DROP COLUMN IF EXISTS name;
@@ -0,0 +1,4 @@
+-- Display fields for event expansion: a device's friendly name and the photo
+-- an employee was enrolled with
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS name TEXT;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS photo_url TEXT;
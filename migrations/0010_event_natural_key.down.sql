@@ -0,0 +1 @@
+DROP INDEX IF EXISTS uq_attendance_events_natural;
@@ -0,0 +1,4 @@
+-- Natural key for attendance events, so historical imports can skip rows
+-- that are already present with ON CONFLICT DO NOTHING
+CREATE UNIQUE INDEX IF NOT EXISTS uq_attendance_events_natural
+    ON attendance_events(user_id, device_id, occurred_at);
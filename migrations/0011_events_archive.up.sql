@@ -0,0 +1,11 @@
+-- Events past EVENT_RETENTION are moved here by the retention job. The row is
+-- kept as JSON so later changes to attendance_events do not break archiving.
+CREATE TABLE IF NOT EXISTS attendance_events_archive (
+    id UUID PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    event JSONB NOT NULL,
+    corrections JSONB,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_events_archive_occurred ON attendance_events_archive(occurred_at);
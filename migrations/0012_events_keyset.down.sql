@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_attendance_events_occurred_id;
@@ -0,0 +1,2 @@
+-- Supports keyset pagination on (occurred_at, id) for GET /v2/events
+CREATE INDEX IF NOT EXISTS idx_attendance_events_occurred_id ON attendance_events(occurred_at DESC, id DESC);
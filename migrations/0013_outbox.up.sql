@@ -0,0 +1,17 @@
+-- Messages written in the same transaction as the row they announce. The
+-- outbox relay publishes rows that the API's direct publish did not confirm.
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    queue TEXT NOT NULL,
+    type TEXT NOT NULL,
+    msg_key TEXT NOT NULL DEFAULT '',
+    body BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_pending_key ON outbox(msg_key) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_dispatched ON outbox(dispatched_at) WHERE dispatched_at IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS late_minutes;
+DROP TABLE IF EXISTS user_shifts;
+DROP TABLE IF EXISTS shifts;
@@ -0,0 +1,24 @@
+-- Shift schedules. start_time/end_time are wall-clock times in the shift's
+-- timezone; an end before the start means the shift ends the next day.
+-- days is a bitmask of weekdays, bit 0 = Sunday.
+CREATE TABLE IF NOT EXISTS shifts (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    days SMALLINT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One shift per user; user_id matches attendance_events.user_id.
+CREATE TABLE IF NOT EXISTS user_shifts (
+    user_id TEXT PRIMARY KEY,
+    shift_id BIGINT NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_shifts_shift ON user_shifts(shift_id);
+
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS late_minutes INT;
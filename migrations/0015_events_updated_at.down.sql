@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_attendance_events_touch ON attendance_events;
+DROP FUNCTION IF EXISTS attendance_events_touch();
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS updated_at;
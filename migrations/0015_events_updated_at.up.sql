@@ -0,0 +1,15 @@
+-- updated_at changes on every UPDATE (status, corrections, lateness), so
+-- list fingerprints see changes to existing events and not only inserts.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE OR REPLACE FUNCTION attendance_events_touch() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = clock_timestamp();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_attendance_events_touch ON attendance_events;
+CREATE TRIGGER trg_attendance_events_touch
+    BEFORE UPDATE ON attendance_events
+    FOR EACH ROW EXECUTE FUNCTION attendance_events_touch();
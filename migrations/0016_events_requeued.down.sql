@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attendance_events_status_created;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS requeued_at;
@@ -0,0 +1,6 @@
+-- requeued_at is stamped when the reconciler re-enqueues a stuck pending
+-- event, so concurrent workers claim disjoint events and an event is not
+-- requeued again until it has been stale for another full threshold.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS requeued_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_events_status_created ON attendance_events(status, created_at);
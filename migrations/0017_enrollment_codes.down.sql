@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS enrollment_batch_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS enrollment_code_id;
+DROP TABLE IF EXISTS enrollment_codes;
@@ -0,0 +1,19 @@
+-- One-time enrollment codes generated in batches by an admin. Only a SHA-256
+-- hash of each code is stored; a device presents the code once when it
+-- registers, and the device row records which code and batch created it.
+CREATE TABLE IF NOT EXISTS enrollment_codes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code_hash TEXT NOT NULL UNIQUE,
+    batch_id UUID NOT NULL,
+    label TEXT,
+    created_by TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    used_by_device TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollment_codes_batch ON enrollment_codes(batch_id);
+
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS enrollment_code_id UUID REFERENCES enrollment_codes(id);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS enrollment_batch_id UUID;
@@ -0,0 +1,17 @@
+-- Face-service calls made by the worker per check-in, kept as evidence for
+-- disputed matches and purged by the retention job.
+CREATE TABLE IF NOT EXISTS face_audit (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL,
+    operation TEXT NOT NULL,
+    endpoint TEXT NOT NULL,
+    request JSONB,
+    response JSONB,
+    duration_ms DOUBLE PRECISION NOT NULL,
+    error TEXT,
+    gallery_enrolled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_face_audit_event ON face_audit(event_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_face_audit_created ON face_audit(created_at);
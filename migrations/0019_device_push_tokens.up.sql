@@ -0,0 +1,10 @@
+-- Push tokens of companion apps, notified when a device's check-ins finish.
+CREATE TABLE IF NOT EXISTS device_push_tokens (
+    token TEXT PRIMARY KEY,
+    device_id TEXT NOT NULL REFERENCES devices(device_id) ON DELETE CASCADE,
+    platform TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_push_tokens_device ON device_push_tokens(device_id);
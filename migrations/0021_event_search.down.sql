@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_attendance_events_user_occurred;
+DROP INDEX IF EXISTS idx_devices_name_trgm;
+DROP INDEX IF EXISTS idx_employees_name_trgm;
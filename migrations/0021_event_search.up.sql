@@ -0,0 +1,7 @@
+-- Trigram indexes for GET /v1/events/search, which matches employee and
+-- device names with ILIKE and ranks them by similarity().
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_employees_name_trgm ON employees USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_devices_name_trgm ON devices USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_attendance_events_user_occurred ON attendance_events(user_id, occurred_at DESC);
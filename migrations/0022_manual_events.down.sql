@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_attendance_events_awaiting_approval;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS rejection_reason;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS requested_by;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS justification;
@@ -0,0 +1,11 @@
+-- Manual attendance records entered by an admin. They wait in status
+-- 'awaiting_approval' until a different admin approves ('processed') or
+-- rejects ('rejected') them; the columns keep who asked, why, and the review.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS justification TEXT;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS requested_by TEXT;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS reviewed_by TEXT;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMPTZ;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS rejection_reason TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_events_awaiting_approval
+    ON attendance_events(created_at) WHERE status = 'awaiting_approval';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS anomalies;
+ALTER TABLE devices DROP COLUMN IF EXISTS longitude;
+ALTER TABLE devices DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,23 @@
+-- Geofence centers of devices, used with coordinates in event locations to
+-- spot impossible travel.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+
+-- Findings of the nightly anomaly analysis (worker -analyze). An event is
+-- flagged at most once per kind; an admin acknowledges or dismisses it.
+CREATE TABLE IF NOT EXISTS anomalies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    event_id UUID NOT NULL REFERENCES attendance_events(id) ON DELETE CASCADE,
+    other_event_id UUID REFERENCES attendance_events(id) ON DELETE CASCADE,
+    other_user_id TEXT,
+    details JSONB,
+    status TEXT NOT NULL DEFAULT 'open',
+    reviewed_by TEXT,
+    reviewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_anomalies_status ON anomalies(status, created_at DESC);
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS reprovision_allowed;
+ALTER TABLE devices DROP COLUMN IF EXISTS disabled_by;
+ALTER TABLE devices DROP COLUMN IF EXISTS disabled_at;
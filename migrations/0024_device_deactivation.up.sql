@@ -0,0 +1,5 @@
+-- Deactivated devices (DELETE /v1/devices/:device_id) keep their row and
+-- history but may not register again until an admin allows reprovisioning.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS disabled_by TEXT;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS reprovision_allowed BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS pin_links;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS auth_method;
+ALTER TABLE employees DROP COLUMN IF EXISTS pin_locked_at;
+ALTER TABLE employees DROP COLUMN IF EXISTS pin_failed_attempts;
+ALTER TABLE employees DROP COLUMN IF EXISTS pin_hash;
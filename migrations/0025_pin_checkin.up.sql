@@ -0,0 +1,23 @@
+-- PIN check-in for users who opt out of face capture. employees keep a bcrypt
+-- hash of the PIN and a count of consecutive wrong PINs; reaching the limit
+-- sets pin_locked_at until an admin or a one-time link sets a new PIN.
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS pin_hash TEXT;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS pin_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS pin_locked_at TIMESTAMPTZ;
+
+-- How the user proved who they were: 'face' (the photo is matched by the
+-- worker) or 'pin' (verified by the API; the event is stored processed).
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS auth_method TEXT NOT NULL DEFAULT 'face';
+
+-- One-time links that let an employee choose their own PIN. Only the SHA-256
+-- of the token is stored.
+CREATE TABLE IF NOT EXISTS pin_links (
+    token_hash TEXT PRIMARY KEY,
+    employee_id TEXT NOT NULL REFERENCES employees(employee_id) ON DELETE CASCADE,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_pin_links_employee ON pin_links(employee_id);
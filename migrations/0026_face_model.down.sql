@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_employees_face_model;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS model_mismatch;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS face_model;
+ALTER TABLE employees DROP COLUMN IF EXISTS face_model;
@@ -0,0 +1,9 @@
+-- The face-service embedding model ("name@version") each face was enrolled
+-- with and each check-in was processed under. Embeddings from different models
+-- cannot be compared, so a check-in whose model differs from the enrollment's
+-- sets model_mismatch; it is a warning for admins, not a failure.
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS face_model TEXT;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS face_model TEXT;
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS model_mismatch BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_employees_face_model ON employees(face_model) WHERE face_enrolled;
@@ -0,0 +1,23 @@
+-- Long-running admin jobs, such as re-enrolling faces after a model upgrade,
+-- processed by the worker and polled through GET /v1/admin/jobs/:id.
+-- resume_after is the last item finished, so a job picks up where it left
+-- off after a pause or a crash; heartbeat_at is refreshed as it progresses.
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    params JSONB NOT NULL DEFAULT '{}',
+    total INTEGER NOT NULL DEFAULT 0,
+    done INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    resume_after TEXT NOT NULL DEFAULT '',
+    error TEXT,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    heartbeat_at TIMESTAMPTZ,
+    requeued_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, type);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_jobs_created;
+DROP INDEX IF EXISTS idx_jobs_queued;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS requeued_at TIMESTAMPTZ;
+ALTER TABLE jobs DROP COLUMN IF EXISTS result;
@@ -0,0 +1,8 @@
+-- Jobs are claimed from the table by the worker's dispatcher, which queues
+-- abandoned ones again itself, so requeued_at is no longer needed. result
+-- holds what a job reported when it finished, e.g. a retention pass's counts.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS result JSONB;
+ALTER TABLE jobs DROP COLUMN IF EXISTS requeued_at;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_created ON jobs(created_at DESC);
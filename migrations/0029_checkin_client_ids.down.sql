@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_events_device_client_id;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS client_id;
@@ -0,0 +1,7 @@
+-- Check-ins submitted in offline batches carry an id generated by the kiosk,
+-- so a batch that is sent again (after a lost response, say) finds the events
+-- it already created instead of adding them twice.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS client_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_events_device_client_id
+    ON attendance_events(device_id, client_id) WHERE client_id IS NOT NULL;
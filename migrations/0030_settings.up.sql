@@ -0,0 +1,8 @@
+-- Runtime settings changed through the admin API. A row overrides the
+-- default from the environment until it is deleted (reset).
+CREATE TABLE IF NOT EXISTS settings (
+    key        TEXT PRIMARY KEY,
+    value      JSONB NOT NULL,
+    updated_by TEXT,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN IF EXISTS clock_skew_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS clock_skew_samples;
+ALTER TABLE devices DROP COLUMN IF EXISTS clock_skew_seconds;
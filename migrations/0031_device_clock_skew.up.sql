@@ -0,0 +1,6 @@
+-- Kiosk clocks drift. Each client timestamp a device sends is compared with
+-- server time and folded into a rolling average of how far ahead (positive)
+-- or behind its clock runs, which corrects the times of its check-ins.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS clock_skew_seconds DOUBLE PRECISION;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS clock_skew_samples INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS clock_skew_at TIMESTAMPTZ;
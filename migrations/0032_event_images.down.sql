@@ -0,0 +1,2 @@
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS image_scores;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS image_urls;
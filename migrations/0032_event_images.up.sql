@@ -0,0 +1,4 @@
+-- A check-in may carry up to three frames. image_urls keeps all of them and
+-- image_scores how each fared; image_url is the one the worker picked.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS image_urls TEXT[];
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS image_scores JSONB;
@@ -0,0 +1,9 @@
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS department TEXT;
+
+UPDATE employees e SET department = d.name
+FROM departments d
+WHERE d.id = e.department_id;
+
+DROP INDEX IF EXISTS idx_employees_department;
+ALTER TABLE employees DROP COLUMN IF EXISTS department_id;
+DROP TABLE IF EXISTS departments;
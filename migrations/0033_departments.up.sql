@@ -0,0 +1,28 @@
+-- Departments form a tree through parent_id. Employees belong to at most
+-- one; the free-text employees.department column becomes a reference, with
+-- each distinct existing value turned into a department of that name.
+CREATE TABLE IF NOT EXISTS departments (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    parent_id BIGINT REFERENCES departments(id) ON DELETE RESTRICT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (parent_id <> id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_departments_parent ON departments(parent_id);
+
+INSERT INTO departments (name)
+SELECT DISTINCT btrim(department) FROM employees
+WHERE department IS NOT NULL AND btrim(department) <> ''
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS department_id BIGINT REFERENCES departments(id) ON DELETE SET NULL;
+
+UPDATE employees e SET department_id = d.id
+FROM departments d
+WHERE d.name = btrim(e.department);
+
+ALTER TABLE employees DROP COLUMN IF EXISTS department;
+
+CREATE INDEX IF NOT EXISTS idx_employees_department ON employees(department_id);
@@ -0,0 +1,25 @@
+-- Every status an event moves through, written in the same transaction as
+-- the change, and every webhook delivery attempt made for it. Together with
+-- corrections and face_audit they make up the event's timeline.
+CREATE TABLE IF NOT EXISTS event_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL REFERENCES attendance_events(id) ON DELETE CASCADE,
+    old_status TEXT NOT NULL,
+    new_status TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_status_history_event ON event_status_history(event_id, created_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL REFERENCES attendance_events(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    duration_ms DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(event_id, created_at);
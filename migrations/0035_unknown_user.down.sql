@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_events_unknown_user;
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS unknown_user;
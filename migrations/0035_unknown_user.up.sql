@@ -0,0 +1,8 @@
+-- Check-ins for a user_id no employee has are flagged, so reports can tell
+-- them apart. Existing events are flagged against today's employees.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS unknown_user BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE attendance_events ev SET unknown_user = TRUE
+WHERE NOT EXISTS (SELECT 1 FROM employees e WHERE e.employee_id = ev.user_id);
+
+CREATE INDEX IF NOT EXISTS idx_events_unknown_user ON attendance_events(user_id) WHERE unknown_user;
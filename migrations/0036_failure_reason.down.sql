@@ -0,0 +1 @@
+ALTER TABLE attendance_events DROP COLUMN IF EXISTS failure_reason;
@@ -0,0 +1,3 @@
+-- Why face processing did not check an event in (no_face, timeout, ...), for
+-- kiosks to show the user. NULL for processed events and unknown causes.
+ALTER TABLE attendance_events ADD COLUMN IF NOT EXISTS failure_reason TEXT;
@@ -0,0 +1,4 @@
+-- attempt counts the times a job was claimed. A dispatcher writes to a job
+-- only while the attempt it claimed is current, so one whose lease expired
+-- cannot overwrite the job after another dispatcher took it over.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 0;
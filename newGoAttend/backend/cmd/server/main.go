@@ -1,32 +1,56 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	cld "github.com/darshan/goattend/internal/cloudinary"
 	"github.com/darshan/goattend/internal/config"
 	"github.com/darshan/goattend/internal/faceclient"
 	"github.com/darshan/goattend/internal/handler"
+	"github.com/darshan/goattend/internal/live"
+	"github.com/darshan/goattend/internal/middleware"
 	"github.com/darshan/goattend/internal/store"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// JSON logs; the standard log package writes through this handler too.
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
 	cfg := config.Load()
 
 	// Database
-	db, err := store.New(cfg.DBPath)
+	var db *store.Store
+	var err error
+	switch cfg.DBDriver {
+	case "sqlite":
+		db, err = store.New(cfg.DBPath)
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			log.Fatal("database: DB_DRIVER=postgres needs DATABASE_URL")
+		}
+		db, err = store.NewPostgres(cfg.DatabaseURL)
+	default:
+		log.Fatalf("database: DB_DRIVER must be sqlite or postgres, not %q", cfg.DBDriver)
+	}
 	if err != nil {
 		log.Fatalf("database: %v", err)
 	}
+	log.Printf("Database: %s", cfg.DBDriver)
 	defer db.Close()
 
 	// Cloudinary (optional)
 	var cloud *cld.Client
 	if cfg.CloudinaryURL != "" {
-		cloud, err = cld.New(cfg.CloudinaryURL)
+		cloud, err = cld.New(cfg.CloudinaryURL, cfg.CloudinaryUploadPreset, cfg.CloudinaryTimeout)
 		if err != nil {
 			log.Printf("WARNING: cloudinary disabled: %v", err)
 		} else {
@@ -40,46 +64,96 @@ func main() {
 	fc := faceclient.New(cfg.FaceServiceURL)
 	log.Printf("Face service: %s", cfg.FaceServiceURL)
 
-	h := handler.New(db, cloud, fc)
+	hub := live.NewHub()
+	h := handler.New(db, cloud, fc, cfg.UploadDir, hub, cfg.LowConfidenceDistance)
 
 	// Router
-	r := gin.Default()
+	r := gin.New()
+	// Rate limits key on the client IP, so only listed proxies may set it.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES: %v", err)
+	}
+	r.Use(gin.Recovery())
+	r.Use(middleware.RequestLog(slog.Default(), "/static/", "/uploads/", "/favicon.ico"))
 
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		AllowCredentials: true,
-	}))
+	corsPolicy, desc := middleware.CORS(cfg.CORSOrigins, gin.Mode() == gin.ReleaseMode)
+	if corsPolicy != nil {
+		r.Use(corsPolicy)
+	}
+	log.Printf("CORS: %s", desc)
 
 	// Serve frontend
 	r.Static("/static", cfg.FrontendDir)
+	r.Static("/uploads", cfg.UploadDir)
 	r.StaticFile("/", cfg.FrontendDir+"/index.html")
 	r.StaticFile("/register", cfg.FrontendDir+"/pages/register.html")
 	r.StaticFile("/attendance", cfg.FrontendDir+"/pages/attendance.html")
 	r.StaticFile("/students", cfg.FrontendDir+"/pages/students.html")
 
+	// List responses above 1 KiB are gzip/deflate encoded when accepted
+	compress := middleware.Compress(1024)
+
+	// Per-IP limits: one budget for the whole API, and a stricter one plus a
+	// cool-down after repeated misses for face login, which costs a face
+	// service call and is open to anyone.
+	apiLimit := middleware.NewTokenBucket(cfg.RateLimitPerMin, cfg.RateLimitPerMin)
+	faceLimit := middleware.NewTokenBucket(cfg.FaceLoginBurst, cfg.FaceLoginPerMin)
+	faceCooldown := middleware.NewFailureCooldown(cfg.FaceLoginMaxFailures, cfg.FaceLoginCooldown)
+
 	// API routes
-	api := r.Group("/api")
+	api := r.Group("/api", apiLimit.Handler())
 	{
 		api.GET("/healthz", h.Healthz)
 
-		// Register student (multipart: name, email, student_id, department, photo)
+		// Register student (multipart: name, email, student_id, department, photo or photo1..photo3)
 		api.POST("/students", h.RegisterStudent)
-		api.GET("/students", h.ListStudents)
+		api.GET("/students", compress, h.ListStudents)
 		api.GET("/students/:id", h.GetStudent)
+		api.POST("/students/:id/photos", h.AddPhotos)
+		api.POST("/students/:id/reregister-face", h.ReregisterFace)
+		api.POST("/students/reregister-all", h.ReregisterAll)
 
 		// Face login = mark attendance
-		api.POST("/face-login", h.FaceLogin)
-		api.GET("/attendance", h.ListAttendance)
+		api.POST("/face-login", faceLimit.Handler(), faceCooldown.Handler(), h.FaceLogin)
+		api.GET("/attendance", compress, h.ListAttendance)
+		api.GET("/attendance/export", h.ExportAttendance)
+		// Matches near the face threshold, for an admin to double-check
+		api.GET("/attendance/low-confidence", compress, h.ListLowConfidence)
+
+		// Class periods; face login marks attendance in the active one
+		api.POST("/sessions", h.CreateSession)
+		api.GET("/sessions", h.ListSessions)
+		api.GET("/sessions/:id", h.GetSession)
+		api.PUT("/sessions/:id", h.UpdateSession)
+		api.DELETE("/sessions/:id", h.DeleteSession)
+		api.GET("/sessions/:id/roster", compress, h.SessionRoster)
+
+		// Live feed of new attendance for the kiosk screen
+		api.GET("/ws", h.LiveAttendance)
 	}
 
 	r.NoRoute(func(c *gin.Context) {
 		c.File(cfg.FrontendDir + "/index.html")
 	})
 
-	log.Printf("Server starting on : http://localhost:%s", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, r); err != nil {
-		log.Fatalf("server: %v", err)
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r}
+	go func() {
+		log.Printf("Server starting on : http://localhost:%s", cfg.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server: %v", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+	log.Println("shutting down")
+
+	// WebSocket connections are hijacked, so Shutdown does not wait for them.
+	hub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
 	}
 }
@@ -2,17 +2,49 @@ package faceclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/darshan/goattend/internal/reqlog"
+)
+
+var (
+	// ErrUnavailable means the face service could not be reached.
+	ErrUnavailable = errors.New("face service unreachable")
+	// ErrNoFace means the service found no face in the photo.
+	ErrNoFace = errors.New("no face found")
 )
 
+// ServiceError is an error response from the face service. It matches
+// ErrNoFace via errors.Is when the service reports no detectable face.
+type ServiceError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("face service error %d: %s", e.StatusCode, e.Detail)
+}
+
+func (e *ServiceError) Is(target error) bool {
+	if target != ErrNoFace {
+		return false
+	}
+	d := strings.ToLower(e.Detail)
+	return strings.Contains(d, "no face") || strings.Contains(d, "face detection failed")
+}
+
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	timeout    time.Duration // per attempt
 }
 
 type RegisterResult struct {
@@ -20,6 +52,13 @@ type RegisterResult struct {
 	StudentID string `json:"student_id"`
 }
 
+// HealthResult is the face service's /health response.
+type HealthResult struct {
+	Status          string `json:"status"`
+	RegisteredFaces int    `json:"registered_faces"`
+	Model           string `json:"model"`
+}
+
 type RecognizeResult struct {
 	Matched   bool    `json:"matched"`
 	StudentID string  `json:"student_id,omitempty"`
@@ -29,63 +68,151 @@ type RecognizeResult struct {
 func New(baseURL string) *Client {
 	return &Client{
 		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: &http.Client{},
+		timeout:    30 * time.Second,
 	}
 }
 
-func (c *Client) Register(studentID string, photoData io.Reader, filename string) (*RegisterResult, error) {
-	var buf bytes.Buffer
-	w := multipart.NewWriter(&buf)
-	w.WriteField("student_id", studentID)
-	fw, err := w.CreateFormFile("photo", filename)
-	if err != nil {
+// Register sets the student's primary reference photo, replacing any previous one.
+func (c *Client) Register(ctx context.Context, studentID string, photoData io.Reader, filename string) (*RegisterResult, error) {
+	return c.RegisterReference(ctx, studentID, "", photoData, filename)
+}
+
+// RegisterReference adds a photo to the student's gallery under reference, so
+// recognition can match against several photos of the same student. An empty
+// reference is the primary photo.
+func (c *Client) RegisterReference(ctx context.Context, studentID, reference string, photoData io.Reader, filename string) (*RegisterResult, error) {
+	fields := map[string]string{"student_id": studentID}
+	if reference != "" {
+		fields["reference"] = reference
+	}
+	var result RegisterResult
+	if err := c.postPhoto(ctx, "/register", fields, photoData, filename, &result); err != nil {
 		return nil, err
 	}
-	if _, err := io.Copy(fw, photoData); err != nil {
+	return &result, nil
+}
+
+func (c *Client) Recognize(ctx context.Context, photoData io.Reader, filename string) (*RecognizeResult, error) {
+	var result RecognizeResult
+	if err := c.postPhoto(ctx, "/recognize", nil, photoData, filename, &result); err != nil {
 		return nil, err
 	}
-	w.Close()
+	return &result, nil
+}
 
-	resp, err := c.httpClient.Post(c.baseURL+"/register", w.FormDataContentType(), &buf)
+// Health calls the service's /health endpoint once, without retrying, so the
+// caller's context alone decides how long it may take. Connection failures
+// wrap ErrUnavailable.
+func (c *Client) Health(ctx context.Context) (*HealthResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/health", nil)
 	if err != nil {
-		return nil, fmt.Errorf("face service register: %w", err)
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %d: %s", resp.StatusCode, string(body))
+		return nil, decodeError(resp)
+	}
+	var result HealthResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode face service response: %w", err)
 	}
-
-	var result RegisterResult
-	json.NewDecoder(resp.Body).Decode(&result)
 	return &result, nil
 }
 
-func (c *Client) Recognize(photoData io.Reader, filename string) (*RecognizeResult, error) {
+// postPhoto sends a multipart photo upload and decodes the JSON response into
+// out. Connection failures are retried once; each attempt gets c.timeout.
+func (c *Client) postPhoto(ctx context.Context, path string, fields map[string]string, photoData io.Reader, filename string, out any) error {
 	var buf bytes.Buffer
 	w := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
 	fw, err := w.CreateFormFile("photo", filename)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if _, err := io.Copy(fw, photoData); err != nil {
-		return nil, err
+		return err
 	}
 	w.Close()
+	body := buf.Bytes()
 
-	resp, err := c.httpClient.Post(c.baseURL+"/recognize", w.FormDataContentType(), &buf)
-	if err != nil {
-		return nil, fmt.Errorf("face service recognize: %w", err)
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w: %v", ErrUnavailable, lastErr)
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		start := time.Now()
+		resp, err := c.do(ctx, path, w.FormDataContentType(), body)
+		if err != nil {
+			reqlog.From(ctx).Warn("face service call failed",
+				"path", path, "attempt", attempt+1, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		defer resp.Body.Close()
+		reqlog.From(ctx).Info("face service call",
+			"path", path, "status", resp.StatusCode, "latency_ms", time.Since(start).Milliseconds())
+
+		if resp.StatusCode != http.StatusOK {
+			return decodeError(resp)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decode face service response: %w", err)
+		}
+		return nil
 	}
-	defer resp.Body.Close()
+	return fmt.Errorf("%w: %v", ErrUnavailable, lastErr)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("face service error %d: %s", resp.StatusCode, string(body))
+func (c *Client) do(ctx context.Context, path, contentType string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
 	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
 
-	var result RecognizeResult
-	json.NewDecoder(resp.Body).Decode(&result)
-	return &result, nil
+// cancelOnClose releases the per-attempt context once the body is consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// decodeError turns a non-200 response into a *ServiceError, using the
+// FastAPI {"detail": "..."} body when present.
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	e := &ServiceError{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(body))}
+	var out struct {
+		Detail string `json:"detail"`
+	}
+	if json.Unmarshal(body, &out) == nil && out.Detail != "" {
+		e.Detail = out.Detail
+	}
+	return e
 }
@@ -0,0 +1,156 @@
+package faceclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegisterReference(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, h, err := r.FormFile("photo")
+		if err != nil || r.URL.Path != "/register" {
+			t.Errorf("%s: photo %v", r.URL.Path, err)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		if string(data) != "jpeg" || h.Filename != "a.jpg" || r.FormValue("reference") != "ref-1" {
+			t.Errorf("photo %q %q, reference %q", data, h.Filename, r.FormValue("reference"))
+		}
+		fmt.Fprintf(w, `{"status": "registered", "student_id": %q}`, r.FormValue("student_id"))
+	}))
+	defer srv.Close()
+
+	res, err := New(srv.URL).RegisterReference(context.Background(), "st-1", "ref-1", strings.NewReader("jpeg"), "a.jpg")
+	if err != nil || res.StudentID != "st-1" || res.Status != "registered" {
+		t.Fatalf("RegisterReference = %+v, %v", res, err)
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		noFace   bool
+		wantText string
+	}{
+		{"no face", http.StatusBadRequest, `{"detail": "No face detected in image"}`, true, "No face detected in image"},
+		{"detection failed", http.StatusUnprocessableEntity, `{"detail": "Face detection failed"}`, true, "Face detection failed"},
+		{"crash", http.StatusInternalServerError, "Internal Server Error\n", false, "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			_, err := New(srv.URL).Recognize(context.Background(), strings.NewReader("jpeg"), "a.jpg")
+			var se *ServiceError
+			if !errors.As(err, &se) || se.StatusCode != tt.status || se.Detail != tt.wantText {
+				t.Fatalf("Recognize = %v, want ServiceError %d %q", err, tt.status, tt.wantText)
+			}
+			if errors.Is(err, ErrNoFace) != tt.noFace || errors.Is(err, ErrUnavailable) {
+				t.Errorf("Recognize = %v: is no face %v, want %v", err, errors.Is(err, ErrNoFace), tt.noFace)
+			}
+			// The service answered, so the call is not retried.
+			if n := calls.Load(); n != 1 {
+				t.Errorf("%d calls, want 1", n)
+			}
+		})
+	}
+}
+
+// A dropped connection is retried once; a second one is ErrUnavailable.
+func TestRetryOnConnectionError(t *testing.T) {
+	for _, drops := range []int32{1, 2} {
+		t.Run(fmt.Sprint(drops, " dropped"), func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= drops {
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				fmt.Fprint(w, `{"matched": true, "student_id": "st-1", "distance": 0.25}`)
+			}))
+			defer srv.Close()
+
+			res, err := New(srv.URL).Recognize(context.Background(), strings.NewReader("jpeg"), "a.jpg")
+			if drops == 1 {
+				if err != nil || !res.Matched || res.StudentID != "st-1" || res.Distance != 0.25 {
+					t.Fatalf("Recognize = %+v, %v; want the retried match", res, err)
+				}
+			} else if !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("Recognize = %v, want ErrUnavailable", err)
+			}
+			if n := calls.Load(); n != 2 {
+				t.Errorf("%d calls, want 2", n)
+			}
+		})
+	}
+}
+
+// A hung service costs each attempt its timeout, not the caller's whole budget.
+func TestPerAttemptTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := New(srv.URL)
+	c.timeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err := c.Recognize(context.Background(), strings.NewReader("jpeg"), "a.jpg")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Recognize = %v, want ErrUnavailable", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Recognize took %v", d)
+	}
+}
+
+// Cancelling the caller's context stops the retry.
+func TestCancelStopsRetry(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if _, err := New(srv.URL).Register(ctx, "st-1", strings.NewReader("jpeg"), "a.jpg"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Register = %v, want ErrUnavailable", err)
+	}
+	if d := time.Since(start); d >= 200*time.Millisecond {
+		t.Errorf("Register waited %v for a retry after cancellation", d)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status": "ok", "registered_faces": 3, "model": "Facenet512"}`)
+	}))
+	res, err := New(srv.URL).Health(context.Background())
+	if err != nil || res.RegisteredFaces != 3 || res.Model != "Facenet512" {
+		t.Errorf("Health = %+v, %v", res, err)
+	}
+	srv.Close()
+	if _, err := New(srv.URL).Health(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Health of a stopped service = %v, want ErrUnavailable", err)
+	}
+}
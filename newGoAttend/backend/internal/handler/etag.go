@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/darshan/goattend/internal/reqlog"
+	"github.com/gin-gonic/gin"
+)
+
+// notModified sets an ETag derived from the table's version and the request
+// parameters that shape the response. It answers 304 and returns true when
+// the client's If-None-Match already has it, so polling clients skip the
+// list query and the JSON encoding.
+func (h *Handler) notModified(c *gin.Context, table string, params ...any) bool {
+	version, err := h.store.Version(table)
+	if err != nil {
+		reqlog.From(c.Request.Context()).Warn("etag: read table version", "table", table, "error", err.Error())
+		return false
+	}
+	tag := fmt.Sprintf("%s-%d", table, version)
+	for _, p := range params {
+		tag += fmt.Sprintf("-%v", p)
+	}
+	etag := `"` + tag + `"`
+	c.Header("ETag", etag)
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagMatches implements the weak comparison If-None-Match uses.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
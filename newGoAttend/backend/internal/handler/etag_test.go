@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/store"
+)
+
+// getTag sends GET path with If-None-Match set to ifNoneMatch, if any.
+func getTag(r http.Handler, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// A repeated list request with the ETag it was given is a 304 without a
+// body; a write to the table, including an update of an existing row, or
+// other parameters give a fresh 200 and a new tag.
+func TestListETag(t *testing.T) {
+	s, err := store.New(filepath.Join(t.TempDir(), "goattend.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	st := &model.Student{Name: "Ada", Email: "ada@example.edu", StudentID: "S001", Department: "CS"}
+	if err := s.CreateStudent(st); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.MarkAttendance(st.ID, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(t, s, nil, "")
+
+	tests := []struct {
+		name, path, otherParams string
+		write                   func() error
+	}{
+		{"students after an update", "/api/students", "/api/students?q=ada", func() error { return s.SetFaceRegistered(st.ID, true) }},
+		{"attendance after a student update", "/api/attendance", "/api/attendance?limit=5", func() error { return s.UpdateStudentPhoto(st.ID, "https://img.example/ada.jpg") }},
+		{"attendance after an insert", "/api/attendance", "/api/attendance?session=none", func() error {
+			other := &model.Student{Name: "Alan", Email: "alan@example.edu", StudentID: "S002"}
+			if err := s.CreateStudent(other); err != nil {
+				return err
+			}
+			_, _, err := s.MarkAttendance(other.ID, "", nil)
+			return err
+		}},
+		{"low confidence after a student update", "/api/attendance/low-confidence", "/api/attendance/low-confidence?limit=5", func() error {
+			return s.SetFaceRegistered(st.ID, false)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			miss := getTag(r, tt.path, "")
+			etag := miss.Header().Get("ETag")
+			if miss.Code != http.StatusOK || etag == "" {
+				t.Fatalf("GET %s = %d with ETag %q", tt.path, miss.Code, etag)
+			}
+			for _, header := range []string{etag, "W/" + etag, `"stale", ` + etag, "*"} {
+				hit := getTag(r, tt.path, header)
+				if hit.Code != http.StatusNotModified || hit.Body.Len() != 0 || hit.Header().Get("ETag") != etag {
+					t.Errorf("If-None-Match %s = %d %q with ETag %q, want an empty 304", header, hit.Code, hit.Body, hit.Header().Get("ETag"))
+				}
+			}
+			if other := getTag(r, tt.otherParams, etag); other.Code != http.StatusOK || other.Header().Get("ETag") == etag {
+				t.Errorf("GET %s with the ETag of %s = %d, want 200 and its own tag", tt.otherParams, tt.path, other.Code)
+			}
+
+			if err := tt.write(); err != nil {
+				t.Fatal(err)
+			}
+			changed := getTag(r, tt.path, etag)
+			if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+				t.Errorf("GET %s after a write = %d with ETag %q, want 200 and a new tag", tt.path, changed.Code, changed.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+// versionDown is a store whose table versions cannot be read.
+type versionDown struct{ *store.Memory }
+
+func (versionDown) Version(string) (int64, error) { return 0, errors.New("database is locked") }
+
+// Without a version the list is served in full and untagged, rather than
+// with a tag that might never change.
+func TestListETagVersionUnavailable(t *testing.T) {
+	r := newTestRouter(t, versionDown{store.NewMemory()}, nil, "")
+	rec := getTag(r, "/api/students", "*")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+		t.Errorf("GET = %d with ETag %q, want 200 without one", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"students-3-50"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"students-2-50", ` + etag, true},
+		{" * ", true},
+		{`"students-3-5"`, false},
+		{"students-3-50", false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
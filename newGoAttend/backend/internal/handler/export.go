@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/reqlog"
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// ---------- Attendance Export ----------
+
+const (
+	// maxExportDays caps the range one export may cover.
+	maxExportDays = 366
+	// defaultExportDays is the range exported when from is omitted.
+	defaultExportDays = 30
+
+	exportDayLayout  = "2006-01-02"
+	exportTimeLayout = "2006-01-02 15:04:05"
+	xlsxContentType  = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	summarySheet     = "Summary"
+)
+
+// studentTotals accumulates the summary sheet row for one student.
+type studentTotals struct {
+	row         model.AttendanceExportRow
+	count       int
+	first, last time.Time
+}
+
+// ExportAttendance streams attendance between from and to (YYYY-MM-DD, both
+// inclusive, server local time) as an xlsx workbook or, with format=csv, a
+// CSV file. The workbook has a per-student Summary sheet and one sheet of
+// records per department. to defaults to today and from to 30 days earlier;
+// session=<id> exports only that session's records.
+func (h *Handler) ExportAttendance(c *gin.Context) {
+	from, to, err := exportRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.DefaultQuery("format", "xlsx")
+	if format != "xlsx" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be xlsx or csv"})
+		return
+	}
+	// to is the exclusive end, so the last day in the name is the one before it.
+	filename := fmt.Sprintf("attendance_%s_%s.%s",
+		from.Format(exportDayLayout), to.AddDate(0, 0, -1).Format(exportDayLayout), format)
+
+	sessionID := c.Query("session")
+	if format == "csv" {
+		h.exportCSV(c, from, to, sessionID, filename)
+		return
+	}
+	h.exportXLSX(c, from, to, sessionID, filename)
+}
+
+// exportRange parses the from/to query values into [from, to) local-time
+// bounds and rejects reversed or oversized ranges.
+func exportRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	last := today
+	if toStr != "" {
+		t, err := time.ParseInLocation(exportDayLayout, toStr, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date in YYYY-MM-DD format")
+		}
+		last = t
+	}
+	from := last.AddDate(0, 0, -(defaultExportDays - 1))
+	if fromStr != "" {
+		t, err := time.ParseInLocation(exportDayLayout, fromStr, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date in YYYY-MM-DD format")
+		}
+		from = t
+	}
+	if last.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	to := last.AddDate(0, 0, 1)
+	if to.After(from.AddDate(0, 0, maxExportDays)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("export range is limited to %d days; split it into smaller ranges", maxExportDays)
+	}
+	return from, to, nil
+}
+
+func (h *Handler) exportCSV(c *gin.Context, from, to time.Time, sessionID, filename string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"student_id", "name", "department", "timestamp", "status"})
+	err := h.store.EachAttendance(from, to, sessionID, func(r model.AttendanceExportRow) error {
+		return w.Write([]string{r.StudentID, r.Name, r.Department, r.Timestamp.Local().Format(exportTimeLayout), r.Status})
+	})
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		// The status is already sent; the client sees a truncated file.
+		reqlog.From(c.Request.Context()).Error("export csv", "error", err.Error())
+	}
+}
+
+func (h *Handler) exportXLSX(c *gin.Context, from, to time.Time, sessionID, filename string) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := h.buildWorkbook(f, from, to, sessionID); err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Type", xlsxContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	if err := f.Write(c.Writer); err != nil {
+		reqlog.From(c.Request.Context()).Error("export xlsx", "error", err.Error())
+	}
+}
+
+// buildWorkbook fills f with one sheet per department, in the order the store
+// returns them, and then the Summary sheet. Sheets are written with stream
+// writers, which spill rows to temporary files instead of holding them.
+func (h *Handler) buildWorkbook(f *excelize.File, from, to time.Time, sessionID string) error {
+	if err := f.SetSheetName("Sheet1", summarySheet); err != nil {
+		return err
+	}
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: strPtr("yyyy-mm-dd hh:mm:ss")})
+	if err != nil {
+		return err
+	}
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{strings.ToLower(summarySheet): true}
+	totals := map[string]*studentTotals{}
+	var (
+		sw      *excelize.StreamWriter
+		dept    string
+		row     int
+		started bool
+	)
+	err = h.store.EachAttendance(from, to, sessionID, func(r model.AttendanceExportRow) error {
+		if !started || r.Department != dept {
+			if sw != nil {
+				if err := sw.Flush(); err != nil {
+					return err
+				}
+			}
+			started, dept, row = true, r.Department, 1
+			name := sheetName(r.Department, used)
+			if _, err := f.NewSheet(name); err != nil {
+				return err
+			}
+			var err error
+			if sw, err = f.NewStreamWriter(name); err != nil {
+				return err
+			}
+			sw.SetColWidth(1, 1, 14)
+			sw.SetColWidth(2, 2, 28)
+			sw.SetColWidth(3, 3, 20)
+			if err := sw.SetRow("A1", headerRow(header, "Student ID", "Name", "Timestamp", "Status")); err != nil {
+				return err
+			}
+		}
+		row++
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		if err := sw.SetRow(cell, []any{
+			r.StudentID,
+			r.Name,
+			excelize.Cell{StyleID: dateStyle, Value: excelTime(r.Timestamp)},
+			r.Status,
+		}); err != nil {
+			return err
+		}
+
+		t := totals[r.StudentID]
+		if t == nil {
+			t = &studentTotals{row: r, first: r.Timestamp}
+			totals[r.StudentID] = t
+		}
+		t.count++
+		t.last = r.Timestamp
+		if r.Timestamp.Before(t.first) {
+			t.first = r.Timestamp
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if sw != nil {
+		if err := sw.Flush(); err != nil {
+			return err
+		}
+	}
+	return writeSummary(f, totals, header, dateStyle)
+}
+
+func writeSummary(f *excelize.File, totals map[string]*studentTotals, header, dateStyle int) error {
+	students := make([]*studentTotals, 0, len(totals))
+	for _, t := range totals {
+		students = append(students, t)
+	}
+	sort.Slice(students, func(i, j int) bool {
+		if students[i].row.Department != students[j].row.Department {
+			return students[i].row.Department < students[j].row.Department
+		}
+		return students[i].row.StudentID < students[j].row.StudentID
+	})
+
+	sw, err := f.NewStreamWriter(summarySheet)
+	if err != nil {
+		return err
+	}
+	sw.SetColWidth(1, 1, 14)
+	sw.SetColWidth(2, 3, 28)
+	sw.SetColWidth(5, 6, 20)
+	if err := sw.SetRow("A1", headerRow(header, "Student ID", "Name", "Department", "Records", "First", "Last")); err != nil {
+		return err
+	}
+	for i, t := range students {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := sw.SetRow(cell, []any{
+			t.row.StudentID,
+			t.row.Name,
+			t.row.Department,
+			t.count,
+			excelize.Cell{StyleID: dateStyle, Value: excelTime(t.first)},
+			excelize.Cell{StyleID: dateStyle, Value: excelTime(t.last)},
+		}); err != nil {
+			return err
+		}
+	}
+	return sw.Flush()
+}
+
+func headerRow(style int, titles ...string) []any {
+	row := make([]any, len(titles))
+	for i, t := range titles {
+		row[i] = excelize.Cell{StyleID: style, Value: t}
+	}
+	return row
+}
+
+// excelTime re-expresses t's local wall clock in UTC: spreadsheet dates carry
+// no zone, and excelize converts instants as if they were UTC.
+func excelTime(t time.Time) time.Time {
+	l := t.Local()
+	return time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), l.Second(), 0, time.UTC)
+}
+
+// sheetName turns a department into a valid, unused worksheet name: at most
+// 31 characters, none of []:*?/\, and unique ignoring case.
+func sheetName(dept string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(dept))
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "No department"
+	}
+	name = truncateRunes(name, 31)
+	base := name
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		name = truncateRunes(base, 31-len(suffix)) + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+func strPtr(s string) *string { return &s }
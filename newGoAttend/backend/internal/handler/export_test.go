@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// newExportRouter serves the export of a store holding one attendance record
+// for each of two CS students and one Math student.
+func newExportRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	s := store.NewMemory()
+	for _, st := range []model.Student{
+		{Name: "Ada", Email: "ada@example.edu", StudentID: "S001", Department: "CS"},
+		{Name: "Alan", Email: "alan@example.edu", StudentID: "S002", Department: "CS"},
+		{Name: "Emmy", Email: "emmy@example.edu", StudentID: "S003", Department: "Math"},
+	} {
+		if err := s.CreateStudent(&st); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.MarkAttendance(st.ID, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/attendance/export", New(s, nil, nil, "", nil, 0.5).ExportAttendance)
+	return r
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestExportXLSX(t *testing.T) {
+	rec := get(newExportRouter(t), "/api/attendance/export")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != xlsxContentType {
+		t.Fatalf("export = %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, ".xlsx") {
+		t.Errorf("Content-Disposition = %q, want an xlsx file name", cd)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got, want := f.GetSheetList(), []string{summarySheet, "CS", "Math"}; !slices.Equal(got, want) {
+		t.Fatalf("sheets = %q, want %q", got, want)
+	}
+	// Each sheet has a header row above its records.
+	for sheet, want := range map[string]int{summarySheet: 4, "CS": 3, "Math": 2} {
+		rows, err := f.GetRows(sheet)
+		if err != nil || len(rows) != want {
+			t.Errorf("%s has %d rows (%v), want %d", sheet, len(rows), err, want)
+		}
+	}
+	if rows, _ := f.GetRows(summarySheet); len(rows) == 4 && (rows[3][0] != "S003" || rows[3][3] != "1") {
+		t.Errorf("last summary row = %q, want S003 with 1 record", rows[3])
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	rec := get(newExportRouter(t), "/api/attendance/export?format=csv&session=")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(rows) != 4 || rows[0][0] != "student_id" {
+		t.Fatalf("csv = %q, %v; want a header and 3 records", rows, err)
+	}
+}
+
+func TestExportBadRequests(t *testing.T) {
+	r := newExportRouter(t)
+	for _, q := range []string{
+		"?format=pdf",
+		"?from=2025-02-30",
+		"?to=yesterday",
+		"?from=2025-03-02&to=2025-03-01",
+		"?from=2023-01-01&to=2025-01-01",
+	} {
+		if rec := get(r, "/api/attendance/export"+q); rec.Code != http.StatusBadRequest {
+			t.Errorf("export%s = %d, want 400", q, rec.Code)
+		}
+	}
+	// The cap is inclusive of both ends.
+	if rec := get(r, "/api/attendance/export?format=csv&from=2024-01-01&to=2024-12-31"); rec.Code != http.StatusOK {
+		t.Errorf("export of 366 days = %d, want 200", rec.Code)
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	used := map[string]bool{"summary": true}
+	tests := []struct{ dept, want string }{
+		{"CS", "CS"},
+		{"cs", "cs (2)"},
+		{"", "No department"},
+		{"R&D: labs/ops", "R&D- labs-ops"},
+		{"'quoted'", "quoted"},
+		{"Summary", "Summary (2)"},
+		{strings.Repeat("x", 40), strings.Repeat("x", 31)},
+		{strings.Repeat("x", 40), strings.Repeat("x", 27) + " (2)"},
+	}
+	for _, tt := range tests {
+		if got := sheetName(tt.dept, used); got != tt.want {
+			t.Errorf("sheetName(%q) = %q, want %q", tt.dept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/darshan/goattend/internal/faceclient"
+	"github.com/darshan/goattend/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// localPhotoPrefix is the URL path under which locally stored photos are served.
+const localPhotoPrefix = "/uploads/"
+
+var errNoPhoto = errors.New("student has no stored photo")
+
+// ---------- Re-register Faces ----------
+
+type reregisterResult struct {
+	ID             string `json:"id"`
+	StudentID      string `json:"student_id"`
+	FaceRegistered bool   `json:"face_registered"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ReregisterFace sends a student's stored photo to the face service again.
+func (h *Handler) ReregisterFace(c *gin.Context) {
+	if h.faceClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "face service not configured"})
+		return
+	}
+	student, err := h.store.GetStudentByID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if student == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "student not found"})
+		return
+	}
+
+	res := h.reregister(c.Request.Context(), student)
+	status := http.StatusOK
+	if !res.FaceRegistered {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, res)
+}
+
+// ReregisterAll retries face registration for every student with
+// face_registered=false and reports the outcome per student.
+func (h *Handler) ReregisterAll(c *gin.Context) {
+	if h.faceClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "face service not configured"})
+		return
+	}
+	students, err := h.store.ListStudentsWithoutFace()
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := []reregisterResult{}
+	succeeded := 0
+	for i := range students {
+		if c.Request.Context().Err() != nil {
+			break
+		}
+		res := h.reregister(c.Request.Context(), &students[i])
+		if res.FaceRegistered {
+			succeeded++
+		}
+		results = append(results, res)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
+
+func (h *Handler) reregister(ctx context.Context, st *model.Student) reregisterResult {
+	res := reregisterResult{ID: st.ID, StudentID: st.StudentID}
+	data, filename, err := h.loadPhoto(ctx, st.PhotoURL)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if _, err := h.faceClient.Register(ctx, st.ID, bytes.NewReader(data), filename); err != nil {
+		res.Error = describeFaceError(err)
+		return res
+	}
+	if err := h.store.SetFaceRegistered(st.ID, true); err != nil {
+		res.Error = "face registered but not recorded: " + err.Error()
+		return res
+	}
+	res.FaceRegistered = true
+	return res
+}
+
+// describeFaceError summarises a face service error for clients and logs.
+func describeFaceError(err error) string {
+	switch {
+	case errors.Is(err, faceclient.ErrNoFace):
+		return "no face found in photo"
+	case errors.Is(err, faceclient.ErrUnavailable):
+		return "face service unavailable"
+	default:
+		return err.Error()
+	}
+}
+
+// loadPhoto fetches a stored photo from Cloudinary (http/https URL) or from
+// the local upload directory.
+func (h *Handler) loadPhoto(ctx context.Context, photoURL string) ([]byte, string, error) {
+	if photoURL == "" {
+		return nil, "", errNoPhoto
+	}
+	if strings.HasPrefix(photoURL, "http://") || strings.HasPrefix(photoURL, "https://") {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, photoURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, "", fmt.Errorf("download photo: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("download photo: %s", resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", fmt.Errorf("download photo: %w", err)
+		}
+		return data, path.Base(req.URL.Path), nil
+	}
+
+	name := filepath.Base(strings.TrimPrefix(photoURL, localPhotoPrefix))
+	data, err := os.ReadFile(filepath.Join(h.uploadDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("%w: %s is missing", errNoPhoto, photoURL)
+	}
+	return data, name, err
+}
+
+// savePhotoLocally stores a photo under the upload directory as name plus the
+// file's extension and returns the URL it is served at. Used when Cloudinary
+// is not configured.
+func (h *Handler) savePhotoLocally(name, filename string, data []byte) (string, error) {
+	if err := os.MkdirAll(h.uploadDir, 0o755); err != nil {
+		return "", err
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		ext = ".jpg"
+	}
+	name += ext
+	if err := os.WriteFile(filepath.Join(h.uploadDir, name), data, 0o644); err != nil {
+		return "", err
+	}
+	return localPhotoPrefix + name, nil
+}
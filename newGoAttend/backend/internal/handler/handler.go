@@ -2,32 +2,116 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/darshan/goattend/internal/cloudinary"
 	"github.com/darshan/goattend/internal/faceclient"
+	"github.com/darshan/goattend/internal/live"
 	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/reqlog"
 	"github.com/darshan/goattend/internal/store"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Store is the persistence the handlers need. *store.Store implements it;
+// store.Memory is an in-memory version for handler tests.
+type Store interface {
+	CreateStudent(st *model.Student) error
+	ListStudents(f store.StudentFilter) ([]model.Student, int, error)
+	ListStudentsWithoutFace() ([]model.Student, error)
+	GetStudentByID(id string) (*model.Student, error)
+	UpdateStudentPhoto(id, photoURL string) error
+	DeleteStudent(id string) error
+	AddStudentPhoto(studentID, url string) (*model.StudentPhoto, error)
+	ListStudentPhotos(studentID string) ([]model.StudentPhoto, error)
+	SetFaceRegistered(id string, registered bool) error
+	MarkAttendance(studentID, sessionID string, distance *float64) (*model.AttendanceRecord, bool, error)
+	ListAttendance(limit int, sessionID string) ([]model.AttendanceRecord, error)
+	ListLowConfidence(minDistance float64, limit int) ([]model.AttendanceRecord, error)
+	EachAttendance(from, to time.Time, sessionID string, fn func(model.AttendanceExportRow) error) error
+	CreateSession(sess *model.Session) error
+	UpdateSession(sess *model.Session) error
+	DeleteSession(id string) error
+	GetSession(id string) (*model.Session, error)
+	ListSessions(date string) ([]model.Session, error)
+	ActiveSession(department string, at time.Time) (*model.Session, error)
+	SessionRoster(sess *model.Session) ([]model.RosterEntry, error)
+	Version(table string) (int64, error)
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ Store = (*store.Store)(nil)
+	_ Store = (*store.Memory)(nil)
 )
 
 type Handler struct {
-	store      *store.Store
+	store      Store
 	cloud      *cloudinary.Client // nil if Cloudinary not configured
 	faceClient *faceclient.Client
+	uploadDir  string    // local photo storage when Cloudinary is not configured
+	hub        *live.Hub // WebSocket broadcasts of new attendance; nil disables them
+	// lowConfidence is the match distance at or above which attendance is
+	// flagged for review.
+	lowConfidence float64
+}
+
+func New(s Store, cloud *cloudinary.Client, faceClient *faceclient.Client, uploadDir string, hub *live.Hub, lowConfidence float64) *Handler {
+	return &Handler{store: s, cloud: cloud, faceClient: faceClient, uploadDir: uploadDir, hub: hub, lowConfidence: lowConfidence}
 }
 
-func New(s *store.Store, cloud *cloudinary.Client, faceClient *faceclient.Client) *Handler {
-	return &Handler{store: s, cloud: cloud, faceClient: faceClient}
+// flag marks a record whose match distance is near the threshold.
+func (h *Handler) flag(rec *model.AttendanceRecord) {
+	rec.LowConfidence = rec.Distance != nil && *rec.Distance >= h.lowConfidence
 }
 
 // ---------- Health ----------
 
+// healthTimeout bounds each dependency probe so a hung face service cannot
+// stall the health check.
+const healthTimeout = time.Second
+
+// Healthz reports each dependency. A database failure answers 503; an
+// unreachable face service only marks the response "degraded", since the
+// server still serves lists and pages.
 func (h *Handler) Healthz(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	status, code := "ok", http.StatusOK
+	checks := gin.H{}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+	err := h.store.Ping(ctx)
+	cancel()
+	if err != nil {
+		checks["database"] = gin.H{"status": "down", "error": err.Error()}
+		status, code = "down", http.StatusServiceUnavailable
+	} else {
+		checks["database"] = gin.H{"status": "ok"}
+	}
+
+	ctx, cancel = context.WithTimeout(c.Request.Context(), healthTimeout)
+	fh, err := h.faceClient.Health(ctx)
+	cancel()
+	if err != nil {
+		checks["face_service"] = gin.H{"status": "down", "error": err.Error()}
+		if code == http.StatusOK {
+			status = "degraded"
+		}
+	} else {
+		checks["face_service"] = gin.H{"status": "ok", "registered_faces": fh.RegisteredFaces, "model": fh.Model}
+	}
+
+	// Without Cloudinary photos go to UPLOAD_DIR, so this is informational.
+	checks["cloudinary"] = gin.H{"configured": h.cloud != nil}
+
+	c.JSON(code, gin.H{"status": status, "checks": checks})
 }
 
 // ---------- Register Student ----------
@@ -39,8 +123,10 @@ type registerRequest struct {
 	Department string `form:"department"`
 }
 
-// RegisterStudent handles registration: saves student info + uploads photo to Cloudinary + registers face.
-// Expects multipart form with fields: name, email, student_id, department, photo (file).
+// RegisterStudent handles registration: saves student info, stores up to three
+// photos (Cloudinary or local) and registers each with the face service.
+// Expects multipart form with fields: name, email, student_id, department and
+// photo files in "photo", "photo1".."photo3" or repeated "photos".
 func (h *Handler) RegisterStudent(c *gin.Context) {
 	var req registerRequest
 	if err := c.ShouldBind(&req); err != nil {
@@ -48,52 +134,88 @@ func (h *Handler) RegisterStudent(c *gin.Context) {
 		return
 	}
 
-	// Read photo file
-	file, header, err := c.Request.FormFile("photo")
+	// Read photos into memory (needed for both storage and face service)
+	photos, err := readPhotos(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "photo file is required"})
-		return
-	}
-	defer file.Close()
-
-	// Read photo bytes into memory (needed for both Cloudinary and face service)
-	photoBytes, err := io.ReadAll(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read photo"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 1. Upload photo to Cloudinary
-	var photoURL string
-	if h.cloud != nil {
-		result, err := h.cloud.Upload(bytes.NewReader(photoBytes), header.Filename, "goattend/students")
-		if err != nil {
-			log.Printf("cloudinary upload error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload photo"})
-			return
-		}
-		photoURL = result.SecureURL
-	}
+	ctx := c.Request.Context()
+	logger := reqlog.From(ctx)
 
-	// 2. Save student to DB
+	// 1. Save student to DB
 	st := &model.Student{
 		Name:       req.Name,
 		Email:      req.Email,
 		StudentID:  req.StudentID,
 		Department: req.Department,
-		PhotoURL:   photoURL,
 	}
 	if err := h.store.CreateStudent(st); err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "student already exists: " + err.Error()})
+		if errors.Is(err, store.ErrDuplicateStudent) {
+			c.JSON(http.StatusConflict, gin.H{"error": "student already exists"})
+			return
+		}
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save student"})
 		return
 	}
 
-	// 3. Register face with face service (using DB id as identifier)
-	if h.faceClient != nil {
-		_, err := h.faceClient.Register(st.ID, bytes.NewReader(photoBytes), header.Filename)
+	// 2. Store photos; the first one stored becomes the primary photo_url and
+	// the rest go to student_photos. If none can be stored the student is removed.
+	type stored struct {
+		photo
+		reference string // face gallery reference; "" for the primary photo
+	}
+	var saved []stored
+	var lastErr error
+	for _, p := range photos {
+		name := st.ID
+		if len(saved) > 0 {
+			name += "_" + uuid.New().String()
+		}
+		url, err := h.storePhoto(ctx, name, p)
+		if err != nil {
+			logger.Error("store photo", "student", st.ID, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		if len(saved) == 0 {
+			if err := h.store.UpdateStudentPhoto(st.ID, url); err != nil {
+				lastErr = err
+				continue
+			}
+			st.PhotoURL = url
+			saved = append(saved, stored{photo: p})
+			continue
+		}
+		rec, err := h.store.AddStudentPhoto(st.ID, url)
 		if err != nil {
-			log.Printf("face service register error: %v", err)
-			// Don't fail registration — face can be re-registered later
+			logger.Error("record photo", "student", st.ID, "error", err.Error())
+			continue
+		}
+		saved = append(saved, stored{photo: p, reference: rec.ID})
+	}
+	if len(saved) == 0 {
+		if err := h.store.DeleteStudent(st.ID); err != nil {
+			logger.Error("roll back student", "student", st.ID, "error", err.Error())
+		}
+		c.Error(lastErr)
+		c.JSON(http.StatusBadGateway, gin.H{"error": uploadErrorMessage(lastErr)})
+		return
+	}
+
+	// 3. Register faces with face service (using DB id as identifier).
+	// Failures don't fail registration; face_registered stays false so the
+	// face can be re-registered later.
+	for _, p := range saved {
+		if h.registerPhoto(ctx, st.ID, p.reference, p.photo) {
+			st.FaceRegistered = true
+		}
+	}
+	if st.FaceRegistered {
+		if err := h.store.SetFaceRegistered(st.ID, true); err != nil {
+			logger.Error("record face registration", "student", st.ID, "error", err.Error())
 		}
 	}
 
@@ -124,10 +246,17 @@ func (h *Handler) FaceLogin(c *gin.Context) {
 		return
 	}
 
-	result, err := h.faceClient.Recognize(bytes.NewReader(photoBytes), header.Filename)
+	result, err := h.faceClient.Recognize(c.Request.Context(), bytes.NewReader(photoBytes), header.Filename)
 	if err != nil {
-		log.Printf("face recognize error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "face recognition failed"})
+		c.Error(err)
+		switch {
+		case errors.Is(err, faceclient.ErrNoFace):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no face found in photo"})
+		case errors.Is(err, faceclient.ErrUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "face service unavailable"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "face recognition failed"})
+		}
 		return
 	}
 
@@ -146,39 +275,98 @@ func (h *Handler) FaceLogin(c *gin.Context) {
 		return
 	}
 
-	// Mark attendance
-	rec, err := h.store.MarkAttendance(student.ID)
+	// Mark attendance in the student's current session, if any, keeping the
+	// distance so doubtful matches can be audited
+	session, err := h.store.ActiveSession(student.Department, time.Now())
 	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark attendance"})
+		return
+	}
+	sessionID := ""
+	if session != nil {
+		sessionID = session.ID
+	}
+	distance := result.Distance
+	rec, created, err := h.store.MarkAttendance(student.ID, sessionID, &distance)
+	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to mark attendance"})
 		return
 	}
 
 	rec.Name = student.Name
+	h.flag(rec)
+	if created {
+		h.hub.Publish(gin.H{"type": "attendance", "attendance": rec, "student": student})
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"matched":    true,
-		"student":    student,
-		"attendance": rec,
+		"matched":        true,
+		"student":        student,
+		"attendance":     rec,
+		"session":        session,
+		"already_marked": !created,
 	})
 }
 
+// LiveAttendance upgrades to a WebSocket that receives a message for every
+// new attendance record: {"type": "attendance", "attendance": ..., "student": ...}.
+func (h *Handler) LiveAttendance(c *gin.Context) {
+	if h.hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "live updates disabled"})
+		return
+	}
+	h.hub.ServeHTTP(c.Writer, c.Request)
+}
+
 // ---------- List Endpoints ----------
 
+// Student list page sizes.
+const (
+	defaultStudentPage = 50
+	maxStudentPage     = 200
+)
+
+// ListStudents returns a page of students, newest first, in an envelope with
+// the total number of matches. q searches name, email and student ID;
+// department filters exactly; limit (default 50, at most 200) and offset page.
 func (h *Handler) ListStudents(c *gin.Context) {
-	students, err := h.store.ListStudents()
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultStudentPage)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+	f := store.StudentFilter{
+		Query:      strings.TrimSpace(c.Query("q")),
+		Department: c.Query("department"),
+		Limit:      min(limit, maxStudentPage),
+		Offset:     offset,
+	}
+	if h.notModified(c, store.TableStudents, f.Limit, f.Offset, url.QueryEscape(f.Query), url.QueryEscape(f.Department)) {
+		return
+	}
+	students, total, err := h.store.ListStudents(f)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	if students == nil {
 		students = []model.Student{}
 	}
-	c.JSON(http.StatusOK, students)
+	c.JSON(http.StatusOK, gin.H{"students": students, "total": total, "limit": f.Limit, "offset": f.Offset})
 }
 
 func (h *Handler) GetStudent(c *gin.Context) {
 	id := c.Param("id")
 	student, err := h.store.GetStudentByID(id)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -189,15 +377,47 @@ func (h *Handler) GetStudent(c *gin.Context) {
 	c.JSON(http.StatusOK, student)
 }
 
+// ListAttendance returns the latest records, only those of ?session=<id>
+// when given.
 func (h *Handler) ListAttendance(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	records, err := h.store.ListAttendance(limit)
+	sessionID := c.Query("session")
+	if h.notModified(c, store.TableAttendance, limit, url.QueryEscape(sessionID)) {
+		return
+	}
+	records, err := h.store.ListAttendance(limit, sessionID)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if records == nil {
+		records = []model.AttendanceRecord{}
+	}
+	for i := range records {
+		h.flag(&records[i])
+	}
+	c.JSON(http.StatusOK, records)
+}
+
+// ListLowConfidence returns attendance whose match distance was near the
+// face service's threshold, least certain first, for an admin to review.
+func (h *Handler) ListLowConfidence(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if h.notModified(c, store.TableAttendance, "low", limit) {
+		return
+	}
+	records, err := h.store.ListLowConfidence(h.lowConfidence, limit)
 	if err != nil {
+		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	if records == nil {
 		records = []model.AttendanceRecord{}
 	}
+	for i := range records {
+		h.flag(&records[i])
+	}
 	c.JSON(http.StatusOK, records)
 }
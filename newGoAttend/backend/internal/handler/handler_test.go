@@ -0,0 +1,460 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darshan/goattend/internal/cloudinary"
+	"github.com/darshan/goattend/internal/faceclient"
+	"github.com/darshan/goattend/internal/live"
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// ghostFace is a photo the fake face service matches to a student the
+// database does not know.
+const ghostFace = "ghost"
+
+// faceService is a fake face service that recognizes the exact photo bytes it
+// registered. A photo reading "no face" is refused like an empty frame.
+type faceService struct {
+	*httptest.Server
+	mu    sync.Mutex
+	faces map[string]string // photo content -> student ID
+}
+
+func newFaceService(t *testing.T) *faceService {
+	t.Helper()
+	fs := &faceService{faces: map[string]string{}}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+	t.Cleanup(fs.Close)
+	return fs
+}
+
+func (fs *faceService) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/health" {
+		fs.mu.Lock()
+		n := len(fs.faces)
+		fs.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "registered_faces": n, "model": "fake"})
+		return
+	}
+	f, _, err := r.FormFile("photo")
+	if err != nil {
+		http.Error(w, `{"detail": "photo required"}`, http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(f)
+	if string(data) == "no face" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"detail": "No face detected in image"}`)
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	switch r.URL.Path {
+	case "/register":
+		fs.faces[string(data)] = r.FormValue("student_id")
+		json.NewEncoder(w).Encode(map[string]any{"status": "registered", "student_id": r.FormValue("student_id")})
+	case "/recognize":
+		id, ok := fs.faces[string(data)]
+		if string(data) == ghostFace {
+			id, ok = "no-such-student", true
+		}
+		json.NewEncoder(w).Encode(map[string]any{"matched": ok, "student_id": id, "distance": 0.3})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestRouter serves the handler routes of cmd/server over s, with photos
+// stored under uploadDir. A nil face service is an unreachable one.
+func newTestRouter(t *testing.T, s Store, fs *faceService, uploadDir string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	faceURL := "http://127.0.0.1:1"
+	if fs != nil {
+		faceURL = fs.URL
+	}
+	h := New(s, nil, faceclient.New(faceURL), uploadDir, nil, 0.5)
+	r := gin.New()
+	api := r.Group("/api")
+	api.GET("/healthz", h.Healthz)
+	api.POST("/students", h.RegisterStudent)
+	api.GET("/students", h.ListStudents)
+	api.GET("/students/:id", h.GetStudent)
+	api.POST("/students/:id/photos", h.AddPhotos)
+	api.POST("/students/:id/reregister-face", h.ReregisterFace)
+	api.POST("/students/reregister-all", h.ReregisterAll)
+	api.POST("/face-login", h.FaceLogin)
+	api.GET("/attendance", h.ListAttendance)
+	api.GET("/attendance/low-confidence", h.ListLowConfidence)
+	api.POST("/sessions", h.CreateSession)
+	api.GET("/sessions", h.ListSessions)
+	api.GET("/sessions/:id", h.GetSession)
+	api.PUT("/sessions/:id", h.UpdateSession)
+	api.DELETE("/sessions/:id", h.DeleteSession)
+	api.GET("/sessions/:id/roster", h.SessionRoster)
+	return r
+}
+
+// form builds a multipart body of fields and, unless empty, a "photo" file.
+func form(t *testing.T, fields map[string]string, photo string) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if photo != "" {
+		fw, err := mw.CreateFormFile("photo", "face.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, photo)
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+// serve sends a request to r and decodes the JSON response into a map.
+func serve(t *testing.T, r http.Handler, method, path string, body io.Reader, contentType string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	var out map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	return rec.Code, out
+}
+
+// register posts a student with photo and returns the response.
+func register(t *testing.T, r http.Handler, name, email, studentID, photo string) (int, map[string]any) {
+	t.Helper()
+	body, ct := form(t, map[string]string{"name": name, "email": email, "student_id": studentID, "department": "CS"}, photo)
+	return serve(t, r, http.MethodPost, "/api/students", body, ct)
+}
+
+func TestRegisterStudent(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRouter(t, store.NewMemory(), newFaceService(t), dir)
+
+	code, st := register(t, r, "Ada", "ada@example.edu", "S001", "ada")
+	if code != http.StatusCreated {
+		t.Fatalf("register = %d %v, want 201", code, st)
+	}
+	if st["face_registered"] != true {
+		t.Errorf("face_registered = %v, want true", st["face_registered"])
+	}
+	photoURL, _ := st["photo_url"].(string)
+	if data, err := os.ReadFile(filepath.Join(dir, strings.TrimPrefix(photoURL, localPhotoPrefix))); err != nil || string(data) != "ada" {
+		t.Errorf("photo at %q = %q, %v; want the uploaded photo", photoURL, data, err)
+	}
+
+	tests := []struct {
+		name       string
+		fields     map[string]string
+		photo      string
+		wantStatus int
+	}{
+		{"duplicate email", map[string]string{"name": "Ada", "email": "ada@example.edu", "student_id": "S002"}, "ada2", http.StatusConflict},
+		{"duplicate student id", map[string]string{"name": "Bob", "email": "bob@example.edu", "student_id": "S001"}, "bob", http.StatusConflict},
+		{"missing name", map[string]string{"email": "c@example.edu", "student_id": "S003"}, "c", http.StatusBadRequest},
+		{"bad email", map[string]string{"name": "C", "email": "nope", "student_id": "S003"}, "c", http.StatusBadRequest},
+		{"missing photo", map[string]string{"name": "C", "email": "c@example.edu", "student_id": "S003"}, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, ct := form(t, tt.fields, tt.photo)
+			if code, out := serve(t, r, http.MethodPost, "/api/students", body, ct); code != tt.wantStatus {
+				t.Errorf("register = %d %v, want %d", code, out, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// A registration while the face service is down keeps the student, with
+// face_registered false so the face can be registered again later.
+func TestRegisterStudentFaceServiceDown(t *testing.T) {
+	s := store.NewMemory()
+	r := newTestRouter(t, s, nil, t.TempDir())
+	code, st := register(t, r, "Ada", "ada@example.edu", "S001", "ada")
+	if code != http.StatusCreated || st["face_registered"] != false {
+		t.Fatalf("register = %d %v, want 201 with face_registered false", code, st)
+	}
+	if missing, err := s.ListStudentsWithoutFace(); err != nil || len(missing) != 1 {
+		t.Errorf("students without a face = %v, %v; want the new student", missing, err)
+	}
+}
+
+// Students registered while the face service was down are registered again
+// from their stored photos once it is back.
+func TestReregisterAll(t *testing.T) {
+	s, dir := store.NewMemory(), t.TempDir()
+	down := newTestRouter(t, s, nil, dir)
+	for _, st := range []struct{ name, email, sid string }{
+		{"Ada", "ada@example.edu", "S001"},
+		{"Alan", "alan@example.edu", "S002"},
+	} {
+		if code, out := register(t, down, st.name, st.email, st.sid, st.name); code != http.StatusCreated {
+			t.Fatalf("register = %d %v", code, out)
+		}
+	}
+	if code, out := serve(t, down, http.MethodPost, "/api/students/reregister-all", nil, ""); code != http.StatusOK || out["failed"] != 2.0 {
+		t.Fatalf("reregister-all while down = %d %v, want 2 failed", code, out)
+	}
+
+	fs := newFaceService(t)
+	up := newTestRouter(t, s, fs, dir)
+	code, out := serve(t, up, http.MethodPost, "/api/students/reregister-all", nil, "")
+	if code != http.StatusOK || out["succeeded"] != 2.0 || out["failed"] != 0.0 {
+		t.Fatalf("reregister-all = %d %v, want 2 succeeded", code, out)
+	}
+	if missing, err := s.ListStudentsWithoutFace(); err != nil || len(missing) != 0 {
+		t.Errorf("students without a face = %v, %v; want none", missing, err)
+	}
+	// The gallery now recognizes the stored photos.
+	body, ct := form(t, nil, "Ada")
+	if code, out := serve(t, up, http.MethodPost, "/api/face-login", body, ct); code != http.StatusOK {
+		t.Errorf("login = %d %v, want 200", code, out)
+	}
+	if code, out := serve(t, up, http.MethodPost, "/api/students/missing/reregister-face", nil, ""); code != http.StatusNotFound {
+		t.Errorf("reregister missing = %d %v, want 404", code, out)
+	}
+}
+
+func TestFaceLogin(t *testing.T) {
+	r := newTestRouter(t, store.NewMemory(), newFaceService(t), t.TempDir())
+	if code, st := register(t, r, "Ada", "ada@example.edu", "S001", "ada"); code != http.StatusCreated {
+		t.Fatalf("register = %d %v", code, st)
+	}
+
+	login := func(photo string) (int, map[string]any) {
+		body, ct := form(t, nil, photo)
+		return serve(t, r, http.MethodPost, "/api/face-login", body, ct)
+	}
+	code, out := login("ada")
+	if code != http.StatusOK || out["matched"] != true || out["already_marked"] != false {
+		t.Fatalf("first login = %d %v, want 200, matched and not already marked", code, out)
+	}
+	first, _ := out["attendance"].(map[string]any)
+	code, out = login("ada")
+	second, _ := out["attendance"].(map[string]any)
+	if code != http.StatusOK || out["already_marked"] != true || second["id"] != first["id"] {
+		t.Errorf("second login = %d %v, want the first record already marked", code, out)
+	}
+
+	tests := []struct {
+		name       string
+		photo      string
+		wantStatus int
+	}{
+		{"unknown face", "someone else", http.StatusUnauthorized},
+		{"no face", "no face", http.StatusUnprocessableEntity},
+		{"student gone from the database", ghostFace, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, out := login(tt.photo); code != tt.wantStatus {
+				t.Errorf("login = %d %v, want %d", code, out, tt.wantStatus)
+			}
+		})
+	}
+	t.Run("without a photo", func(t *testing.T) {
+		body, ct := form(t, map[string]string{"x": "y"}, "")
+		if code, out := serve(t, r, http.MethodPost, "/api/face-login", body, ct); code != http.StatusBadRequest {
+			t.Errorf("login = %d %v, want 400", code, out)
+		}
+	})
+	t.Run("face service down", func(t *testing.T) {
+		down := newTestRouter(t, store.NewMemory(), nil, t.TempDir())
+		body, ct := form(t, nil, "ada")
+		if code, out := serve(t, down, http.MethodPost, "/api/face-login", body, ct); code != http.StatusServiceUnavailable {
+			t.Errorf("login = %d %v, want 503", code, out)
+		}
+	})
+}
+
+func TestListAndGetStudents(t *testing.T) {
+	r := newTestRouter(t, store.NewMemory(), newFaceService(t), t.TempDir())
+	var ids []string
+	for _, s := range []struct{ name, email, sid string }{
+		{"Ada Lovelace", "ada@example.edu", "S001"},
+		{"Alan Turing", "alan@example.edu", "S002"},
+		{"Grace Hopper", "grace@example.edu", "S003"},
+	} {
+		code, st := register(t, r, s.name, s.email, s.sid, s.name)
+		if code != http.StatusCreated {
+			t.Fatalf("register %s = %d %v", s.name, code, st)
+		}
+		ids = append(ids, st["id"].(string))
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantTotal  float64
+		wantPage   int
+	}{
+		{"", http.StatusOK, 3, 3},
+		{"?limit=2", http.StatusOK, 3, 2},
+		{"?limit=2&offset=2", http.StatusOK, 3, 1},
+		{"?q=turing", http.StatusOK, 1, 1},
+		{"?q=S003", http.StatusOK, 1, 1},
+		{"?limit=500", http.StatusOK, 3, 3},
+		{"?limit=0", http.StatusBadRequest, 0, 0},
+		{"?limit=ten", http.StatusBadRequest, 0, 0},
+		{"?offset=-1", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			code, out := serve(t, r, http.MethodGet, "/api/students"+tt.query, nil, "")
+			if code != tt.wantStatus {
+				t.Fatalf("list = %d %v, want %d", code, out, tt.wantStatus)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			page, _ := out["students"].([]any)
+			if out["total"] != tt.wantTotal || len(page) != tt.wantPage {
+				t.Errorf("list = total %v, %d students; want %v, %d", out["total"], len(page), tt.wantTotal, tt.wantPage)
+			}
+			// Pages default to 50 students and are capped at 200.
+			if limit := out["limit"].(float64); tt.query == "" && limit != defaultStudentPage || limit > maxStudentPage {
+				t.Errorf("limit = %v", limit)
+			}
+		})
+	}
+
+	if code, st := serve(t, r, http.MethodGet, "/api/students/"+ids[0], nil, ""); code != http.StatusOK || st["student_id"] != "S001" {
+		t.Errorf("get = %d %v, want S001", code, st)
+	}
+	if code, out := serve(t, r, http.MethodGet, "/api/students/missing", nil, ""); code != http.StatusNotFound {
+		t.Errorf("get missing = %d %v, want 404", code, out)
+	}
+}
+
+func TestUploadErrorMessage(t *testing.T) {
+	err := fmt.Errorf("store photo: %w", &cloudinary.APIError{StatusCode: 400, Message: "Invalid Signature"})
+	if got, want := uploadErrorMessage(err), "failed to upload photo: Invalid Signature"; got != want {
+		t.Errorf("uploadErrorMessage = %q, want %q", got, want)
+	}
+	if got, want := uploadErrorMessage(errors.New("disk full")), "failed to upload photo"; got != want {
+		t.Errorf("uploadErrorMessage = %q, want %q", got, want)
+	}
+}
+
+// A face login that marks attendance is pushed to the live screen once; the
+// repeat login that finds it already marked is not.
+func TestFaceLoginBroadcast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := live.NewHub()
+	defer hub.Close()
+	h := New(store.NewMemory(), nil, faceclient.New(newFaceService(t).URL), t.TempDir(), hub, 0.5)
+	r := gin.New()
+	r.POST("/api/students", h.RegisterStudent)
+	r.POST("/api/face-login", h.FaceLogin)
+	r.GET("/api/ws", h.LiveAttendance)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	if code, out := register(t, r, "Ada", "ada@example.edu", "S001", "ada"); code != http.StatusCreated {
+		t.Fatalf("register = %d %v", code, out)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The hub registers the client just after the upgrade; probe until it
+	// receives messages.
+	for {
+		hub.Publish(map[string]string{"type": "probe"})
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		var probe map[string]any
+		if conn.ReadJSON(&probe) == nil {
+			break
+		}
+	}
+
+	read := func() map[string]any {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			return nil
+		}
+		return msg
+	}
+	for i := 0; i < 2; i++ {
+		body, ct := form(t, nil, "ada")
+		if code, out := serve(t, r, http.MethodPost, "/api/face-login", body, ct); code != http.StatusOK {
+			t.Fatalf("login = %d %v", code, out)
+		}
+	}
+	msg := read()
+	student, _ := msg["student"].(map[string]any)
+	if msg["type"] != "attendance" || student["student_id"] != "S001" {
+		t.Errorf("broadcast = %v, want Ada's attendance", msg)
+	}
+	if extra := read(); extra != nil {
+		t.Errorf("repeat login broadcast %v", extra)
+	}
+}
+
+// Attendance lists carry the match distance and flag doubtful matches; the
+// low-confidence list holds only those, least certain first.
+func TestAttendanceConfidence(t *testing.T) {
+	s := store.NewMemory()
+	for i, d := range []float64{0.3, 0.55, 0.5} {
+		st := &model.Student{Name: fmt.Sprint("S", i), Email: fmt.Sprintf("s%d@example.edu", i), StudentID: fmt.Sprint(i)}
+		if err := s.CreateStudent(st); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := s.MarkAttendance(st.ID, "", &d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := newTestRouter(t, s, nil, "")
+
+	list := func(path string) []map[string]any {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var out []map[string]any
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil {
+			t.Fatalf("GET %s = %d %s", path, rec.Code, rec.Body)
+		}
+		return out
+	}
+	flagged := map[float64]bool{}
+	for _, rec := range list("/api/attendance") {
+		d, _ := rec["distance"].(float64)
+		flagged[d] = rec["low_confidence"] == true
+	}
+	if want := map[float64]bool{0.3: false, 0.55: true, 0.5: true}; fmt.Sprint(flagged) != fmt.Sprint(want) {
+		t.Errorf("attendance flags = %v, want %v", flagged, want)
+	}
+	var got []any
+	for _, rec := range list("/api/attendance/low-confidence") {
+		got = append(got, rec["distance"], rec["low_confidence"])
+	}
+	if fmt.Sprint(got) != "[0.55 true 0.5 true]" {
+		t.Errorf("low-confidence = %v, want 0.55 then 0.5, both flagged", got)
+	}
+}
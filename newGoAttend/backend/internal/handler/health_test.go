@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darshan/goattend/internal/faceclient"
+	"github.com/darshan/goattend/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// downStore is a store whose database cannot be reached.
+type downStore struct{ *store.Memory }
+
+func (downStore) Ping(context.Context) error { return errors.New("connection refused") }
+
+func TestHealthz(t *testing.T) {
+	// The stub face service answers while up is set and fails otherwise.
+	var up atomic.Bool
+	face := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.Error(w, `{"detail": "model not loaded"}`, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status": "ok", "registered_faces": 7, "model": "Facenet512"}`)
+	}))
+	defer face.Close()
+	gin.SetMode(gin.TestMode)
+	healthz := func(s Store) (int, map[string]any) {
+		r := gin.New()
+		r.GET("/api/healthz", New(s, nil, faceclient.New(face.URL), "", nil, 0.5).Healthz)
+		return serve(t, r, http.MethodGet, "/api/healthz", nil, "")
+	}
+	check := func(out map[string]any, dep string) map[string]any {
+		checks, _ := out["checks"].(map[string]any)
+		c, _ := checks[dep].(map[string]any)
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		s          Store
+		faceUp     bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"all up", store.NewMemory(), true, http.StatusOK, "ok"},
+		{"face service down", store.NewMemory(), false, http.StatusOK, "degraded"},
+		{"database down", downStore{store.NewMemory()}, true, http.StatusServiceUnavailable, "down"},
+		{"both down", downStore{store.NewMemory()}, false, http.StatusServiceUnavailable, "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up.Store(tt.faceUp)
+			code, out := healthz(tt.s)
+			if code != tt.wantCode || out["status"] != tt.wantStatus {
+				t.Fatalf("healthz = %d %v, want %d %s", code, out, tt.wantCode, tt.wantStatus)
+			}
+			faceStatus := "down"
+			if tt.faceUp {
+				faceStatus = "ok"
+				if n := check(out, "face_service")["registered_faces"]; n != 7.0 {
+					t.Errorf("registered_faces = %v, want 7", n)
+				}
+			}
+			if got := check(out, "face_service")["status"]; got != faceStatus {
+				t.Errorf("face_service = %v, want %s", got, faceStatus)
+			}
+			if got := check(out, "cloudinary")["configured"]; got != false {
+				t.Errorf("cloudinary configured = %v, want false", got)
+			}
+		})
+	}
+}
+
+// A hung face service costs the health check at most healthTimeout.
+func TestHealthzHungFaceService(t *testing.T) {
+	release := make(chan struct{})
+	face := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer face.Close()
+	defer close(release)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/healthz", New(store.NewMemory(), nil, faceclient.New(face.URL), "", nil, 0.5).Healthz)
+	start := time.Now()
+	code, out := serve(t, r, http.MethodGet, "/api/healthz", nil, "")
+	if code != http.StatusOK || out["status"] != "degraded" {
+		t.Errorf("healthz = %d %v, want 200 degraded", code, out)
+	}
+	if d := time.Since(start); d > healthTimeout+time.Second {
+		t.Errorf("healthz took %v", d)
+	}
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/darshan/goattend/internal/cloudinary"
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/reqlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxPhotos is the most photos accepted per registration or append request.
+const maxPhotos = 3
+
+type photo struct {
+	filename string
+	data     []byte
+}
+
+// readPhotos collects the uploaded photos from multipart fields "photo",
+// "photo1".."photo3" and repeated "photos", in that order.
+func readPhotos(c *gin.Context) ([]photo, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, errors.New("multipart form with at least one photo is required")
+	}
+	fields := []string{"photo"}
+	for i := 1; i <= maxPhotos; i++ {
+		fields = append(fields, fmt.Sprintf("photo%d", i))
+	}
+	fields = append(fields, "photos")
+
+	var photos []photo
+	for _, field := range fields {
+		for _, fh := range form.File[field] {
+			if len(photos) == maxPhotos {
+				return nil, fmt.Errorf("at most %d photos are allowed", maxPhotos)
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", fh.Filename, err)
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", fh.Filename, err)
+			}
+			photos = append(photos, photo{filename: fh.Filename, data: data})
+		}
+	}
+	if len(photos) == 0 {
+		return nil, errors.New("photo file is required")
+	}
+	return photos, nil
+}
+
+// storePhoto uploads a photo to Cloudinary, or saves it under the upload
+// directory as name when Cloudinary is not configured.
+func (h *Handler) storePhoto(ctx context.Context, name string, p photo) (string, error) {
+	if h.cloud != nil {
+		start := time.Now()
+		result, err := h.cloud.Upload(ctx, bytes.NewReader(p.data), p.filename, "goattend/students")
+		if err != nil {
+			reqlog.From(ctx).Warn("cloudinary upload failed",
+				"file", p.filename, "latency_ms", time.Since(start).Milliseconds(), "error", err.Error())
+			return "", err
+		}
+		reqlog.From(ctx).Info("cloudinary upload",
+			"file", p.filename, "public_id", result.PublicID, "latency_ms", time.Since(start).Milliseconds())
+		return result.SecureURL, nil
+	}
+	if h.uploadDir == "" {
+		return "", nil
+	}
+	return h.savePhotoLocally(name, p.filename, p.data)
+}
+
+// registerPhoto adds a photo to the student's face gallery and reports success.
+func (h *Handler) registerPhoto(ctx context.Context, studentID, reference string, p photo) bool {
+	if h.faceClient == nil {
+		return false
+	}
+	if _, err := h.faceClient.RegisterReference(ctx, studentID, reference, bytes.NewReader(p.data), p.filename); err != nil {
+		reqlog.From(ctx).Warn("face register failed",
+			"student", studentID, "reference", reference, "error", describeFaceError(err))
+		return false
+	}
+	return true
+}
+
+// uploadErrorMessage turns a storage error into a client-facing message.
+func uploadErrorMessage(err error) string {
+	var apiErr *cloudinary.APIError
+	if errors.As(err, &apiErr) {
+		return "failed to upload photo: " + apiErr.Message
+	}
+	return "failed to upload photo"
+}
+
+// ---------- Append Photos ----------
+
+// AddPhotos stores more reference photos for an existing student and adds
+// them to the face gallery.
+func (h *Handler) AddPhotos(c *gin.Context) {
+	student, err := h.store.GetStudentByID(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if student == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "student not found"})
+		return
+	}
+	photos, err := readPhotos(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	logger := reqlog.From(ctx)
+	added := []model.StudentPhoto{}
+	var lastErr error
+	for _, p := range photos {
+		url, err := h.storePhoto(ctx, student.ID+"_"+uuid.New().String(), p)
+		if err != nil {
+			logger.Error("store photo", "student", student.ID, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		rec, err := h.store.AddStudentPhoto(student.ID, url)
+		if err != nil {
+			logger.Error("record photo", "student", student.ID, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		if h.registerPhoto(ctx, student.ID, rec.ID, p) && !student.FaceRegistered {
+			student.FaceRegistered = true
+			if err := h.store.SetFaceRegistered(student.ID, true); err != nil {
+				logger.Error("record face registration", "student", student.ID, "error", err.Error())
+			}
+		}
+		added = append(added, *rec)
+	}
+	if len(added) == 0 {
+		c.Error(lastErr)
+		c.JSON(http.StatusBadGateway, gin.H{"error": uploadErrorMessage(lastErr)})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"student": student, "photos": added})
+}
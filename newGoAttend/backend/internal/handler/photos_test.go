@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darshan/goattend/internal/store"
+)
+
+// filePart is one file of a multipart form.
+type filePart struct{ field, content string }
+
+// multiForm builds a multipart body of fields and files.
+func multiForm(t *testing.T, fields map[string]string, files ...filePart) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for _, f := range files {
+		fw, err := mw.CreateFormFile(f.field, f.content+".jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, f.content)
+	}
+	mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+var ada = map[string]string{"name": "Ada", "email": "ada@example.edu", "student_id": "S001", "department": "CS"}
+
+func TestRegisterSeveralPhotos(t *testing.T) {
+	s := store.NewMemory()
+	r := newTestRouter(t, s, newFaceService(t), t.TempDir())
+
+	body, ct := multiForm(t, ada, filePart{"photo1", "front"}, filePart{"photos", "glasses"}, filePart{"photos", "dim"})
+	code, st := serve(t, r, http.MethodPost, "/api/students", body, ct)
+	if code != http.StatusCreated || st["face_registered"] != true {
+		t.Fatalf("register = %d %v, want 201 with face_registered", code, st)
+	}
+	// The first photo is the primary one; the others are extra references.
+	extra, err := s.ListStudentPhotos(st["id"].(string))
+	if err != nil || len(extra) != 2 {
+		t.Fatalf("student photos = %v, %v; want 2", extra, err)
+	}
+	// Every photo was added to the face gallery.
+	for _, p := range []string{"front", "glasses", "dim"} {
+		body, ct := form(t, nil, p)
+		if code, out := serve(t, r, http.MethodPost, "/api/face-login", body, ct); code != http.StatusOK {
+			t.Errorf("login with %s = %d %v, want 200", p, code, out)
+		}
+	}
+}
+
+func TestRegisterTooManyPhotos(t *testing.T) {
+	s := store.NewMemory()
+	r := newTestRouter(t, s, newFaceService(t), t.TempDir())
+	body, ct := multiForm(t, ada, filePart{"photo", "a"}, filePart{"photo1", "b"}, filePart{"photo2", "c"}, filePart{"photo3", "d"})
+	if code, out := serve(t, r, http.MethodPost, "/api/students", body, ct); code != http.StatusBadRequest {
+		t.Fatalf("register with 4 photos = %d %v, want 400", code, out)
+	}
+	if _, total, _ := s.ListStudents(store.StudentFilter{}); total != 0 {
+		t.Errorf("%d students saved, want none", total)
+	}
+}
+
+// When no photo can be stored the student row is removed again.
+func TestRegisterRollsBackWhenUploadsFail(t *testing.T) {
+	// An upload "directory" that is a file makes every local save fail.
+	notDir := filepath.Join(t.TempDir(), "uploads")
+	if err := os.WriteFile(notDir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := store.NewMemory()
+	r := newTestRouter(t, s, newFaceService(t), notDir)
+	body, ct := multiForm(t, ada, filePart{"photo1", "a"}, filePart{"photo2", "b"})
+	if code, out := serve(t, r, http.MethodPost, "/api/students", body, ct); code != http.StatusBadGateway {
+		t.Fatalf("register = %d %v, want 502", code, out)
+	}
+	if _, total, _ := s.ListStudents(store.StudentFilter{}); total != 0 {
+		t.Errorf("%d students left behind, want none", total)
+	}
+}
+
+func TestAddPhotos(t *testing.T) {
+	s := store.NewMemory()
+	r := newTestRouter(t, s, newFaceService(t), t.TempDir())
+	code, st := register(t, r, "Ada", "ada@example.edu", "S001", "front")
+	if code != http.StatusCreated {
+		t.Fatalf("register = %d %v", code, st)
+	}
+	id := st["id"].(string)
+
+	body, ct := multiForm(t, nil, filePart{"photos", "side"}, filePart{"photos", "hat"})
+	code, out := serve(t, r, http.MethodPost, "/api/students/"+id+"/photos", body, ct)
+	if added, _ := out["photos"].([]any); code != http.StatusCreated || len(added) != 2 {
+		t.Fatalf("add photos = %d %v, want 2 added", code, out)
+	}
+	if extra, err := s.ListStudentPhotos(id); err != nil || len(extra) != 2 {
+		t.Errorf("student photos = %v, %v; want 2", extra, err)
+	}
+	body, ct = form(t, nil, "hat")
+	if code, out := serve(t, r, http.MethodPost, "/api/face-login", body, ct); code != http.StatusOK {
+		t.Errorf("login with an added photo = %d %v, want 200", code, out)
+	}
+
+	body, ct = multiForm(t, nil, filePart{"photos", "x"})
+	if code, out := serve(t, r, http.MethodPost, "/api/students/missing/photos", body, ct); code != http.StatusNotFound {
+		t.Errorf("add photos to a missing student = %d %v, want 404", code, out)
+	}
+	body, ct = multiForm(t, map[string]string{"x": "y"})
+	if code, out := serve(t, r, http.MethodPost, "/api/students/"+id+"/photos", body, ct); code != http.StatusBadRequest {
+		t.Errorf("add no photos = %d %v, want 400", code, out)
+	}
+}
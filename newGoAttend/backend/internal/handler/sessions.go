@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/darshan/goattend/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// ---------- Sessions ----------
+
+type sessionRequest struct {
+	Name       string `json:"name" binding:"required"`
+	Date       string `json:"date" binding:"required"`
+	StartTime  string `json:"start_time" binding:"required"`
+	EndTime    string `json:"end_time" binding:"required"`
+	Department string `json:"department"`
+}
+
+// session validates the request and returns it as a session with the times
+// normalized to HH:MM.
+func (r sessionRequest) session() (*model.Session, error) {
+	if strings.TrimSpace(r.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	if _, err := time.Parse(store.SessionDateLayout, r.Date); err != nil {
+		return nil, errors.New("date must be a date in YYYY-MM-DD format")
+	}
+	start, err := time.Parse(store.SessionTimeLayout, r.StartTime)
+	if err != nil {
+		return nil, errors.New("start_time must be a time in HH:MM format")
+	}
+	end, err := time.Parse(store.SessionTimeLayout, r.EndTime)
+	if err != nil {
+		return nil, errors.New("end_time must be a time in HH:MM format")
+	}
+	if !start.Before(end) {
+		return nil, errors.New("start_time must be before end_time")
+	}
+	return &model.Session{
+		Name:       strings.TrimSpace(r.Name),
+		Date:       r.Date,
+		StartTime:  start.Format(store.SessionTimeLayout),
+		EndTime:    end.Format(store.SessionTimeLayout),
+		Department: strings.TrimSpace(r.Department),
+	}, nil
+}
+
+// bindSession reads and validates a session from the JSON body, answering
+// 400 and returning nil when it is invalid.
+func bindSession(c *gin.Context) *model.Session {
+	var req sessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	sess, err := req.session()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	}
+	return sess
+}
+
+// sessionError answers a failed session write.
+func sessionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrSessionOverlap):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, store.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save session"})
+	}
+}
+
+// CreateSession adds a class period. Sessions on the same date whose times
+// overlap are rejected with 409 when they share a department or either is
+// open to all departments.
+func (h *Handler) CreateSession(c *gin.Context) {
+	sess := bindSession(c)
+	if sess == nil {
+		return
+	}
+	if err := h.store.CreateSession(sess); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, sess)
+}
+
+// ListSessions returns sessions in time order, filtered to ?date=YYYY-MM-DD
+// when given.
+func (h *Handler) ListSessions(c *gin.Context) {
+	date := c.Query("date")
+	if date != "" {
+		if _, err := time.Parse(store.SessionDateLayout, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a date in YYYY-MM-DD format"})
+			return
+		}
+	}
+	sessions, err := h.store.ListSessions(date)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sessions == nil {
+		sessions = []model.Session{}
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (h *Handler) GetSession(c *gin.Context) {
+	sess, err := h.store.GetSession(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sess == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, sess)
+}
+
+// UpdateSession replaces a session's name, date, times and department.
+func (h *Handler) UpdateSession(c *gin.Context) {
+	sess := bindSession(c)
+	if sess == nil {
+		return
+	}
+	sess.ID = c.Param("id")
+	if err := h.store.UpdateSession(sess); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sess)
+}
+
+// DeleteSession removes a session; attendance marked in it is kept.
+func (h *Handler) DeleteSession(c *gin.Context) {
+	if err := h.store.DeleteSession(c.Param("id")); err != nil {
+		sessionError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SessionRoster lists who was present and who was absent in a session. The
+// expected students are those of the session's department, or everyone for a
+// session open to all.
+func (h *Handler) SessionRoster(c *gin.Context) {
+	sess, err := h.store.GetSession(c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sess == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	roster, err := h.store.SessionRoster(sess)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	present, absent := []model.RosterEntry{}, []model.RosterEntry{}
+	for _, e := range roster {
+		if e.Present {
+			present = append(present, e)
+		} else {
+			absent = append(absent, e)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"session": sess, "present": present, "absent": absent})
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/darshan/goattend/internal/store"
+)
+
+// sendJSON sends v as a JSON body.
+func sendJSON(t *testing.T, r http.Handler, method, path string, v any) (int, map[string]any) {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serve(t, r, method, path, bytes.NewReader(body), "application/json")
+}
+
+func TestSessionCRUD(t *testing.T) {
+	r := newTestRouter(t, store.NewMemory(), nil, "")
+	session := func(name, start, end, dept string) map[string]string {
+		return map[string]string{"name": name, "date": "2025-03-03", "start_time": start, "end_time": end, "department": dept}
+	}
+
+	code, algo := sendJSON(t, r, http.MethodPost, "/api/sessions", session("Algorithms", "9:00", "10:00", "CS"))
+	if code != http.StatusCreated || algo["start_time"] != "09:00" {
+		t.Fatalf("create = %d %v, want 201 with the time normalized", code, algo)
+	}
+	id := algo["id"].(string)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       map[string]string
+		wantStatus int
+	}{
+		{"overlapping", http.MethodPost, "/api/sessions", session("Databases", "09:30", "10:30", "CS"), http.StatusConflict},
+		{"overlapping an open session", http.MethodPost, "/api/sessions", session("Assembly", "09:30", "10:30", ""), http.StatusConflict},
+		{"other department", http.MethodPost, "/api/sessions", session("Algebra", "09:00", "10:00", "Math"), http.StatusCreated},
+		{"back to back", http.MethodPost, "/api/sessions", session("Compilers", "10:00", "11:00", "CS"), http.StatusCreated},
+		{"ends before it starts", http.MethodPost, "/api/sessions", session("Backwards", "11:00", "10:00", "CS"), http.StatusBadRequest},
+		{"bad date", http.MethodPost, "/api/sessions", map[string]string{"name": "X", "date": "03/03/2025", "start_time": "09:00", "end_time": "10:00"}, http.StatusBadRequest},
+		{"bad time", http.MethodPost, "/api/sessions", session("X", "9am", "10:00", "CS"), http.StatusBadRequest},
+		{"no name", http.MethodPost, "/api/sessions", session(" ", "12:00", "13:00", "CS"), http.StatusBadRequest},
+		{"update", http.MethodPut, "/api/sessions/" + id, session("Algorithms I", "08:30", "10:00", "CS"), http.StatusOK},
+		{"update onto another", http.MethodPut, "/api/sessions/" + id, session("Algorithms I", "08:30", "10:30", "CS"), http.StatusConflict},
+		{"update missing", http.MethodPut, "/api/sessions/missing", session("X", "12:00", "13:00", "CS"), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, out := sendJSON(t, r, tt.method, tt.path, tt.body); code != tt.wantStatus {
+				t.Errorf("%s %s = %d %v, want %d", tt.method, tt.path, code, out, tt.wantStatus)
+			}
+		})
+	}
+
+	if code, got := serve(t, r, http.MethodGet, "/api/sessions/"+id, nil, ""); code != http.StatusOK || got["name"] != "Algorithms I" {
+		t.Errorf("get = %d %v, want the updated session", code, got)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sessions?date=2025-03-03", nil))
+	var list []map[string]any
+	if json.Unmarshal(rec.Body.Bytes(), &list); len(list) != 3 || list[0]["id"] != id {
+		t.Errorf("list = %d %s, want 3 sessions in time order", rec.Code, rec.Body)
+	}
+	if code, _ := serve(t, r, http.MethodGet, "/api/sessions?date=tomorrow", nil, ""); code != http.StatusBadRequest {
+		t.Errorf("list with a bad date = %d, want 400", code)
+	}
+	if code, _ := serve(t, r, http.MethodDelete, "/api/sessions/"+id, nil, ""); code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", code)
+	}
+	for _, path := range []string{"/api/sessions/" + id, "/api/sessions/" + id + "/roster"} {
+		if code, _ := serve(t, r, http.MethodGet, path, nil, ""); code != http.StatusNotFound {
+			t.Errorf("GET %s after delete = %d, want 404", path, code)
+		}
+	}
+	if code, _ := serve(t, r, http.MethodDelete, "/api/sessions/"+id, nil, ""); code != http.StatusNotFound {
+		t.Errorf("second delete = %d, want 404", code)
+	}
+}
+
+// A face login during a session marks attendance in it, once per session,
+// and the roster shows who came.
+func TestFaceLoginInSession(t *testing.T) {
+	now := time.Now()
+	if now.Format(store.SessionTimeLayout) == "23:59" {
+		t.Skip("no session fits before midnight")
+	}
+	r := newTestRouter(t, store.NewMemory(), newFaceService(t), t.TempDir())
+	for _, st := range []struct{ name, email, sid string }{
+		{"Ada", "ada@example.edu", "S001"},
+		{"Alan", "alan@example.edu", "S002"},
+	} {
+		if code, out := register(t, r, st.name, st.email, st.sid, st.name); code != http.StatusCreated {
+			t.Fatalf("register = %d %v", code, out)
+		}
+	}
+	code, sess := sendJSON(t, r, http.MethodPost, "/api/sessions", map[string]string{
+		"name": "All day", "date": now.Format(store.SessionDateLayout), "start_time": "00:00", "end_time": "23:59", "department": "CS",
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("create session = %d %v", code, sess)
+	}
+	id := sess["id"].(string)
+
+	for i, wantMarked := range []bool{false, true} {
+		body, ct := form(t, nil, "Ada")
+		code, out := serve(t, r, http.MethodPost, "/api/face-login", body, ct)
+		got, _ := out["session"].(map[string]any)
+		att, _ := out["attendance"].(map[string]any)
+		if code != http.StatusOK || got["id"] != id || att["session_id"] != id || out["already_marked"] != wantMarked {
+			t.Errorf("login %d = %d %v, want attendance in session %s, already marked %v", i+1, code, out, id, wantMarked)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/attendance?session="+id, nil))
+	var records []map[string]any
+	if json.Unmarshal(rec.Body.Bytes(), &records); len(records) != 1 {
+		t.Errorf("attendance in the session = %s, want 1 record", rec.Body)
+	}
+
+	code, roster := serve(t, r, http.MethodGet, "/api/sessions/"+id+"/roster", nil, "")
+	present, _ := roster["present"].([]any)
+	absent, _ := roster["absent"].([]any)
+	if code != http.StatusOK || len(present) != 1 || len(absent) != 1 {
+		t.Fatalf("roster = %d %v, want Ada present and Alan absent", code, roster)
+	}
+	if who := absent[0].(map[string]any)["student"].(map[string]any)["name"]; who != "Alan" {
+		t.Errorf("absent = %v, want Alan", who)
+	}
+}
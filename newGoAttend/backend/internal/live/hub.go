@@ -0,0 +1,172 @@
+// Package live pushes attendance updates to browsers over WebSocket.
+package live
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds a single write to a client.
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is dropped.
+	pongWait = 60 * time.Second
+	// pingPeriod must be shorter than pongWait.
+	pingPeriod = pongWait * 9 / 10
+	// sendBuffer is how many messages may queue for a client; a client that
+	// falls further behind is disconnected.
+	sendBuffer = 16
+)
+
+// Hub fans published messages out to every connected client.
+type Hub struct {
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+}
+
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+	once sync.Once
+}
+
+// NewHub returns an empty hub. The upgrader's default origin check only
+// accepts pages served from this host.
+func NewHub() *Hub {
+	return &Hub{clients: map[*client]struct{}{}}
+}
+
+// ServeHTTP upgrades the request and streams published messages to it
+// until the client goes away or the hub is closed.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the request.
+		return
+	}
+	cl := &client{conn: conn, send: make(chan []byte, sendBuffer)}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	h.clients[cl] = struct{}{}
+	h.mu.Unlock()
+
+	go h.writeLoop(cl)
+	h.readLoop(cl)
+}
+
+// Publish sends v, encoded as JSON, to every client without blocking. Clients
+// whose buffer is full are disconnected.
+func (h *Hub) Publish(v any) {
+	if h == nil {
+		return
+	}
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("live: encode message: %v", err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for cl := range h.clients {
+		select {
+		case cl.send <- msg:
+		default:
+			log.Printf("live: dropping slow client %s", cl.conn.RemoteAddr())
+			h.removeLocked(cl)
+		}
+	}
+}
+
+// Close disconnects every client and refuses new ones. Hijacked WebSocket
+// connections are not closed by http.Server.Shutdown, so call this first.
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for cl := range h.clients {
+		h.removeLocked(cl)
+	}
+}
+
+// removeLocked unregisters cl and closes its send channel, which makes the
+// write loop send a close frame and shut the connection. h.mu must be held.
+func (h *Hub) removeLocked(cl *client) {
+	if _, ok := h.clients[cl]; !ok {
+		return
+	}
+	delete(h.clients, cl)
+	cl.once.Do(func() { close(cl.send) })
+}
+
+func (h *Hub) remove(cl *client) {
+	h.mu.Lock()
+	h.removeLocked(cl)
+	h.mu.Unlock()
+}
+
+// readLoop discards client messages and handles pongs; it returns when the
+// connection fails or stays silent past pongWait.
+func (h *Hub) readLoop(cl *client) {
+	defer func() {
+		h.remove(cl)
+		cl.conn.Close()
+	}()
+	cl.conn.SetReadLimit(512)
+	cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := cl.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writeLoop delivers queued messages and pings until the send channel closes.
+func (h *Hub) writeLoop(cl *client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		cl.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				cl.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := cl.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				h.remove(cl)
+				return
+			}
+		case <-ticker.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				h.remove(cl)
+				return
+			}
+		}
+	}
+}
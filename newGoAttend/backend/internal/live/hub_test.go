@@ -0,0 +1,122 @@
+package live
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dial connects a WebSocket client to srv.
+func dial(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitClients waits until h has n clients.
+func waitClients(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		h.mu.Lock()
+		got := len(h.clients)
+		h.mu.Unlock()
+		if got == n {
+			return
+		}
+	}
+	t.Fatalf("hub never reached %d clients", n)
+}
+
+func TestPublish(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer h.Close()
+
+	a, b := dial(t, srv), dial(t, srv)
+	waitClients(t, h, 2)
+	h.Publish(map[string]string{"type": "attendance", "name": "Ada"})
+	for _, conn := range []*websocket.Conn{a, b} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg map[string]string
+		if err := conn.ReadJSON(&msg); err != nil || msg["name"] != "Ada" {
+			t.Errorf("read = %v, %v; want the broadcast", msg, err)
+		}
+	}
+
+	// A client that hangs up is forgotten.
+	a.Close()
+	waitClients(t, h, 1)
+}
+
+// A client that falls sendBuffer messages behind is disconnected rather
+// than blocking Publish.
+func TestSlowClientDropped(t *testing.T) {
+	h := NewHub()
+	// Register the client without a write loop, so nothing drains its buffer.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		cl := &client{conn: conn, send: make(chan []byte, sendBuffer)}
+		h.mu.Lock()
+		h.clients[cl] = struct{}{}
+		h.mu.Unlock()
+	}))
+	defer srv.Close()
+	dial(t, srv)
+	waitClients(t, h, 1)
+
+	done := make(chan struct{})
+	go func() {
+		for range sendBuffer + 1 {
+			h.Publish("tick")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Publish blocked on a slow client")
+	}
+	waitClients(t, h, 0)
+}
+
+func TestClose(t *testing.T) {
+	h := NewHub()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn := dial(t, srv)
+	waitClients(t, h, 1)
+	h.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var ce *websocket.CloseError
+	if _, _, err := conn.ReadMessage(); !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+		t.Errorf("read after Close = %v, want a going-away close frame", err)
+	}
+
+	// Clients arriving after Close are turned away.
+	late := dial(t, srv)
+	late.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := late.ReadMessage(); !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+		t.Errorf("read on a late client = %v, want a going-away close frame", err)
+	}
+	waitClients(t, h, 0)
+}
+
+func TestNilHub(t *testing.T) {
+	var h *Hub
+	h.Publish("ignored")
+	h.Close()
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FailureCooldown makes a client wait after too many consecutive failed
+// attempts, e.g. face logins that match nobody. A response of 401 or 422
+// counts as a failure and any 2xx response clears the count; other statuses
+// leave it alone.
+type FailureCooldown struct {
+	maxFailures int
+	cooldown    time.Duration
+	now         func() time.Time
+	mu          sync.Mutex
+	clients     map[string]*failures
+	lastSweep   time.Time
+}
+
+type failures struct {
+	count int
+	until time.Time // end of the current cool-down
+	seen  time.Time
+}
+
+// NewFailureCooldown returns a tracker that blocks a client for cooldown
+// after maxFailures consecutive failures. It returns nil, which blocks
+// nothing, when either is not positive.
+func NewFailureCooldown(maxFailures int, cooldown time.Duration) *FailureCooldown {
+	if maxFailures <= 0 || cooldown <= 0 {
+		return nil
+	}
+	return &FailureCooldown{
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		now:         time.Now,
+		clients:     make(map[string]*failures),
+	}
+}
+
+// Handler answers 429 with Retry-After while the client is cooling down, and
+// otherwise records the outcome of the request.
+func (f *FailureCooldown) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if f == nil {
+			c.Next()
+			return
+		}
+		key := clientKey(c)
+		if wait := f.blocked(key); wait > 0 {
+			tooManyRequests(c, wait, "too many failed attempts, try again later")
+			return
+		}
+		c.Next()
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized || status == http.StatusUnprocessableEntity:
+			f.fail(key)
+		case status >= 200 && status < 300:
+			f.reset(key)
+		}
+	}
+}
+
+// blocked returns how much of the client's cool-down is left.
+func (f *FailureCooldown) blocked(key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if e, ok := f.clients[key]; ok {
+		return e.until.Sub(f.now())
+	}
+	return 0
+}
+
+// fail counts a failure, starting a cool-down on the maxFailures-th in a row.
+func (f *FailureCooldown) fail(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	f.sweepLocked(now)
+	e, ok := f.clients[key]
+	if !ok {
+		if len(f.clients) >= limiterMaxEntries {
+			return
+		}
+		e = &failures{}
+		f.clients[key] = e
+	}
+	e.seen = now
+	e.count++
+	if e.count >= f.maxFailures {
+		e.count = 0
+		e.until = now.Add(f.cooldown)
+	}
+}
+
+func (f *FailureCooldown) reset(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clients, key)
+}
+
+// sweepLocked forgets clients idle longer than limiterIdleTTL and past their
+// cool-down, at most once a minute.
+func (f *FailureCooldown) sweepLocked(now time.Time) {
+	if now.Sub(f.lastSweep) < time.Minute {
+		return
+	}
+	f.lastSweep = now
+	for key, e := range f.clients {
+		if now.Sub(e.seen) >= limiterIdleTTL && !now.Before(e.until) {
+			delete(f.clients, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORS returns the cross-origin middleware for origins together with a
+// description of the effective policy for the startup log.
+//
+// An explicit origin list is allowed with credentials. A "*" entry allows
+// every origin but never with credentials, since browsers refuse that
+// combination and it would let any site act as the user. With no origins,
+// production (release) allows none and the returned handler is nil: the
+// frontend is served from this host and needs no CORS headers. Outside
+// production any http://localhost or 127.0.0.1 port is allowed, for
+// frontends run from a dev server.
+func CORS(origins []string, release bool) (gin.HandlerFunc, string) {
+	cfg := cors.Config{
+		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "If-None-Match"},
+		MaxAge:       12 * time.Hour,
+	}
+	var policy string
+	switch {
+	case len(origins) == 0 && release:
+		return nil, "same-origin only"
+	case len(origins) == 0:
+		cfg.AllowOriginFunc = isLocalhost
+		cfg.AllowCredentials = true
+		policy = "localhost origins on any port, with credentials"
+	case contains(origins, "*"):
+		cfg.AllowAllOrigins = true
+		policy = "any origin, without credentials"
+	default:
+		cfg.AllowOrigins = origins
+		cfg.AllowCredentials = true
+		policy = strings.Join(origins, ", ") + ", with credentials"
+	}
+	return skipSameOrigin(cors.New(cfg)), policy
+}
+
+// skipSameOrigin runs next only for cross-origin requests. Browsers send an
+// Origin header on same-origin POSTs too, and the cors handler would reject
+// those from a host missing from the list, such as a kiosk opened by IP.
+func skipSameOrigin(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if u, err := url.Parse(origin); origin != "" && err == nil && u.Host == c.Request.Host {
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
+
+func isLocalhost(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "http" {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
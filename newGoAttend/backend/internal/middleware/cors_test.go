@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name        string
+		origins     []string
+		release     bool
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllow   string // Access-Control-Allow-Origin
+		wantCreds   bool
+		wantMethods bool // preflight answered with Access-Control-Allow-Methods
+	}{
+		{"listed origin", []string{"https://admin.example.edu"}, true, "GET", "https://admin.example.edu", 200, "https://admin.example.edu", true, false},
+		{"listed origin preflight", []string{"https://admin.example.edu"}, true, "OPTIONS", "https://admin.example.edu", 204, "https://admin.example.edu", true, true},
+		{"unlisted origin", []string{"https://admin.example.edu"}, true, "GET", "https://evil.example", 403, "", false, false},
+		{"unlisted origin preflight", []string{"https://admin.example.edu"}, true, "OPTIONS", "https://evil.example", 403, "", false, false},
+		{"wildcard", []string{"*"}, true, "GET", "https://anywhere.example", 200, "*", false, false},
+		{"wildcard preflight", []string{"https://a.example", "*"}, true, "OPTIONS", "https://anywhere.example", 204, "*", false, true},
+		{"dev localhost", nil, false, "OPTIONS", "http://localhost:5173", 204, "http://localhost:5173", true, true},
+		{"dev loopback", nil, false, "GET", "http://127.0.0.1:3000", 200, "http://127.0.0.1:3000", true, false},
+		{"dev https localhost", nil, false, "GET", "https://localhost:5173", 403, "", false, false},
+		{"dev other host", nil, false, "GET", "http://192.168.1.20:5173", 403, "", false, false},
+		{"same origin", []string{"https://admin.example.edu"}, true, "POST", "http://kiosk.local", 200, "", false, false},
+		{"no origin", []string{"https://admin.example.edu"}, true, "GET", "", 200, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, policy := CORS(tt.origins, tt.release)
+			if mw == nil || policy == "" {
+				t.Fatalf("CORS(%q, %v) = %v, %q", tt.origins, tt.release, mw, policy)
+			}
+			r := gin.New()
+			r.Use(mw)
+			r.Any("/api/students", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "http://kiosk.local/api/students", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCreds)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods present = %v, want %v", got, tt.wantMethods)
+			}
+		})
+	}
+}
+
+// In production with no origins configured no CORS headers are sent at all.
+func TestCORSSameOriginOnly(t *testing.T) {
+	if mw, policy := CORS(nil, true); mw != nil || policy != "same-origin only" {
+		t.Errorf("CORS(nil, release) = %v, %q; want no middleware", mw, policy)
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Client tracking bounds shared by the limiters below.
+const (
+	// limiterIdleTTL drops clients not seen for this long.
+	limiterIdleTTL = 10 * time.Minute
+	// limiterMaxEntries caps the tracked clients; the least recently seen is
+	// dropped first.
+	limiterMaxEntries = 100000
+)
+
+// TokenBucket is an in-memory per-IP rate limiter: each client may burst up
+// to capacity requests and then gets perMinute a minute. It is a port of the
+// attendance API's SimpleTokenBucket.
+type TokenBucket struct {
+	capacity int
+	rate     int
+	now      func() time.Time
+	mu       sync.Mutex
+	state    map[string]*list.Element
+	lru      *list.List // front = most recently seen
+}
+
+type bucket struct {
+	key    string
+	tokens int
+	last   time.Time // last refill
+	seen   time.Time // last access
+}
+
+// NewTokenBucket returns a limiter allowing perMinute requests a minute per
+// client with bursts of capacity (perMinute when not positive). It returns
+// nil when perMinute is not positive, which disables limiting.
+func NewTokenBucket(capacity, perMinute int) *TokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	if capacity <= 0 {
+		capacity = perMinute
+	}
+	return &TokenBucket{
+		capacity: capacity,
+		rate:     perMinute,
+		now:      time.Now,
+		state:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Handler answers 429 with a Retry-After header once the client's bucket is
+// empty. A nil limiter lets everything through.
+func (l *TokenBucket) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil {
+			c.Next()
+			return
+		}
+		if ok, wait := l.allow(clientKey(c)); !ok {
+			tooManyRequests(c, wait, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// allow spends a token for key, or reports how long until one is available.
+func (l *TokenBucket) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.evictLocked(now)
+
+	el, ok := l.state[key]
+	if !ok {
+		b := &bucket{key: key, tokens: l.capacity - 1, last: now, seen: now}
+		l.state[key] = l.lru.PushFront(b)
+		for len(l.state) > limiterMaxEntries {
+			l.removeLocked(l.lru.Back())
+		}
+		return true, 0
+	}
+	l.lru.MoveToFront(el)
+	b := el.Value.(*bucket)
+	b.seen = now
+	refill := int(now.Sub(b.last).Minutes() * float64(l.rate))
+	if refill > 0 {
+		b.tokens = min(b.tokens+refill, l.capacity)
+		b.last = now
+	}
+	if b.tokens <= 0 {
+		// Tokens are added whole, the first one a full interval after last.
+		return false, b.last.Add(time.Minute / time.Duration(l.rate)).Sub(now)
+	}
+	b.tokens--
+	return true, 0
+}
+
+// evictLocked drops buckets idle longer than limiterIdleTTL, oldest first.
+func (l *TokenBucket) evictLocked(now time.Time) {
+	for el := l.lru.Back(); el != nil; el = l.lru.Back() {
+		if now.Sub(el.Value.(*bucket).seen) < limiterIdleTTL {
+			break
+		}
+		l.removeLocked(el)
+	}
+}
+
+func (l *TokenBucket) removeLocked(el *list.Element) {
+	l.lru.Remove(el)
+	delete(l.state, el.Value.(*bucket).key)
+}
+
+func clientKey(c *gin.Context) string {
+	if ip := c.ClientIP(); ip != "" {
+		return ip
+	}
+	return "unknown"
+}
+
+// tooManyRequests aborts with 429, telling the client to wait at least a
+// whole second.
+func tooManyRequests(c *gin.Context, wait time.Duration, msg string) {
+	secs := max(1, int(math.Ceil(wait.Seconds())))
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": msg, "retry_after": secs})
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clock is a fake time source the tests move by hand.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// limited serves status from a router guarded by mw.
+func limited(mw gin.HandlerFunc, status *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/face-login", mw, func(c *gin.Context) { c.Status(*status) })
+	return r
+}
+
+// call sends one request from ip and returns the status and Retry-After.
+func call(r http.Handler, ip string) (int, string) {
+	req := httptest.NewRequest(http.MethodPost, "/api/face-login", nil)
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Code, rec.Header().Get("Retry-After")
+}
+
+func TestTokenBucket(t *testing.T) {
+	clk := &clock{t: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)}
+	l := NewTokenBucket(3, 6) // bursts of 3, then one every 10s
+	l.now = clk.now
+	ok := http.StatusOK
+	r := limited(l.Handler(), &ok)
+
+	for i := range 3 {
+		if code, _ := call(r, "10.0.0.1"); code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200 within the burst", i+1, code)
+		}
+	}
+	if code, retry := call(r, "10.0.0.1"); code != http.StatusTooManyRequests || retry != "10" {
+		t.Fatalf("over the burst = %d, Retry-After %q; want 429 after 10s", code, retry)
+	}
+	// Another client has its own bucket.
+	if code, _ := call(r, "10.0.0.2"); code != http.StatusOK {
+		t.Errorf("second client = %d, want 200", code)
+	}
+
+	clk.advance(4 * time.Second)
+	if code, retry := call(r, "10.0.0.1"); code != http.StatusTooManyRequests || retry != "6" {
+		t.Errorf("after 4s = %d, Retry-After %q; want 429 after 6s", code, retry)
+	}
+	clk.advance(6 * time.Second)
+	if code, _ := call(r, "10.0.0.1"); code != http.StatusOK {
+		t.Errorf("after 10s = %d, want one refilled token", code)
+	}
+	if code, _ := call(r, "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("second request after 10s = %d, want 429", code)
+	}
+	// A long pause refills up to the burst, not beyond it.
+	clk.advance(time.Hour)
+	for i := range 4 {
+		want := http.StatusOK
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if code, _ := call(r, "10.0.0.1"); code != want {
+			t.Errorf("request %d after an hour = %d, want %d", i+1, code, want)
+		}
+	}
+}
+
+func TestTokenBucketEvictsIdleClients(t *testing.T) {
+	clk := &clock{t: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)}
+	l := NewTokenBucket(1, 1)
+	l.now = clk.now
+	l.allow("a")
+	l.allow("b")
+	clk.advance(limiterIdleTTL)
+	l.allow("b")
+	if _, ok := l.state["a"]; ok || len(l.state) != 1 {
+		t.Errorf("tracked clients = %d, want only the recent one", len(l.state))
+	}
+}
+
+func TestTokenBucketDisabled(t *testing.T) {
+	l := NewTokenBucket(0, 0)
+	if l != nil {
+		t.Fatal("NewTokenBucket(0, 0) is not nil")
+	}
+	ok := http.StatusOK
+	r := limited(l.Handler(), &ok)
+	for range 100 {
+		if code, _ := call(r, "10.0.0.1"); code != http.StatusOK {
+			t.Fatalf("disabled limiter answered %d", code)
+		}
+	}
+}
+
+func TestFailureCooldown(t *testing.T) {
+	clk := &clock{t: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)}
+	f := NewFailureCooldown(3, time.Minute)
+	f.now = clk.now
+	status := http.StatusUnauthorized
+	r := limited(f.Handler(), &status)
+
+	// Two failures, then a success, clear the count.
+	call(r, "10.0.0.1")
+	call(r, "10.0.0.1")
+	status = http.StatusOK
+	call(r, "10.0.0.1")
+	status = http.StatusUnauthorized
+	call(r, "10.0.0.1")
+	call(r, "10.0.0.1")
+	if code, _ := call(r, "10.0.0.1"); code != http.StatusUnauthorized {
+		t.Fatalf("third failure after a success = %d, want it to reach the handler", code)
+	}
+	if code, retry := call(r, "10.0.0.1"); code != http.StatusTooManyRequests || retry != "60" {
+		t.Fatalf("during the cool-down = %d, Retry-After %q; want 429 after 60s", code, retry)
+	}
+	if code, _ := call(r, "10.0.0.2"); code != http.StatusUnauthorized {
+		t.Errorf("other client = %d, want it unaffected", code)
+	}
+
+	clk.advance(45 * time.Second)
+	if code, retry := call(r, "10.0.0.1"); code != http.StatusTooManyRequests || retry != "15" {
+		t.Errorf("45s in = %d, Retry-After %q; want 429 after 15s", code, retry)
+	}
+	clk.advance(15 * time.Second)
+	// Unprocessable photos count too; server errors neither count nor clear.
+	for _, s := range []int{http.StatusUnprocessableEntity, http.StatusServiceUnavailable, http.StatusUnprocessableEntity, http.StatusUnauthorized} {
+		status = s
+		if code, _ := call(r, "10.0.0.1"); code != s {
+			t.Fatalf("after the cool-down = %d, want %d", code, s)
+		}
+	}
+	if code, _ := call(r, "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("after three more failures = %d, want 429", code)
+	}
+}
+
+func TestFailureCooldownDisabled(t *testing.T) {
+	if NewFailureCooldown(0, time.Minute) != nil || NewFailureCooldown(3, 0) != nil {
+		t.Error("a cool-down without failures or duration is not nil")
+	}
+}
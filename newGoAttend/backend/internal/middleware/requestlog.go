@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/darshan/goattend/internal/reqlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the response header carrying the request id.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLog gives every request a UUID, stores it in the request context for
+// reqlog.From and in the X-Request-ID response header, and writes one JSON log
+// line per request with the method, path, status, latency and any errors the
+// handler attached with c.Error. Paths under skipPrefixes, such as static
+// assets, get an id but are not logged.
+func RequestLog(logger *slog.Logger, skipPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := uuid.NewString()
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(reqlog.NewContext(c.Request.Context(), id))
+
+		c.Next()
+
+		path := c.Request.URL.Path
+		for _, p := range skipPrefixes {
+			if strings.HasPrefix(path, p) {
+				return
+			}
+		}
+		attrs := []any{
+			slog.String("request_id", id),
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		level := slog.LevelInfo
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", strings.Join(c.Errors.Errors(), "; ")))
+		}
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/darshan/goattend/internal/reqlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// logLines decodes the JSON log lines in buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if l == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("log line %q: %v", l, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	// Handlers and clients log through reqlog.From, which uses the default logger.
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestLog(logger, "/assets/"))
+	r.POST("/api/students", func(c *gin.Context) {
+		reqlog.From(c.Request.Context()).Warn("cloudinary upload failed")
+		c.Error(errors.New("upload: bad gateway"))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+	})
+	r.GET("/assets/app.js", func(c *gin.Context) { c.String(http.StatusOK, "js") })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/students", nil))
+	id := rec.Header().Get(RequestIDHeader)
+	if _, err := uuid.Parse(id); err != nil {
+		t.Fatalf("%s = %q, want a UUID", RequestIDHeader, id)
+	}
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("%d log lines, want the handler's and the request's: %s", len(lines), buf.String())
+	}
+	if lines[0]["msg"] != "cloudinary upload failed" || lines[0]["request_id"] != id {
+		t.Errorf("handler line = %v, want request_id %s", lines[0], id)
+	}
+	req := lines[1]
+	for k, want := range map[string]any{
+		"msg": "request", "level": "ERROR", "request_id": id, "method": "POST",
+		"path": "/api/students", "status": 500.0, "error": "upload: bad gateway",
+	} {
+		if req[k] != want {
+			t.Errorf("request line %s = %v, want %v", k, req[k], want)
+		}
+	}
+	if _, ok := req["latency_ms"].(float64); !ok {
+		t.Errorf("request line has no latency: %v", req)
+	}
+
+	// Static assets get an id but no log line.
+	buf.Reset()
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/app.js", nil))
+	if rec.Header().Get(RequestIDHeader) == "" || buf.Len() != 0 {
+		t.Errorf("asset: id %q, log %q; want an id and no log", rec.Header().Get(RequestIDHeader), buf.String())
+	}
+	// Each request gets its own id.
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, httptest.NewRequest(http.MethodGet, "/assets/app.js", nil))
+	if rec2.Header().Get(RequestIDHeader) == rec.Header().Get(RequestIDHeader) {
+		t.Error("two requests share an id")
+	}
+}
@@ -4,13 +4,23 @@ import "time"
 
 // Student represents a registered student.
 type Student struct {
-	ID         string    `json:"id"`
-	Name       string    `json:"name"`
-	Email      string    `json:"email"`
-	StudentID  string    `json:"student_id"`
-	Department string    `json:"department"`
-	PhotoURL   string    `json:"photo_url,omitempty"` // Cloudinary URL
-	CreatedAt  time.Time `json:"created_at"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	StudentID  string `json:"student_id"`
+	Department string `json:"department"`
+	PhotoURL   string `json:"photo_url,omitempty"` // Cloudinary URL
+	// FaceRegistered is false when the face service registration failed
+	FaceRegistered bool      `json:"face_registered"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// StudentPhoto is an additional reference photo beyond Student.PhotoURL.
+type StudentPhoto struct {
+	ID        string    `json:"id"`
+	StudentID string    `json:"student_id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // AttendanceRecord represents a single attendance log entry.
@@ -20,4 +30,41 @@ type AttendanceRecord struct {
 	Name      string    `json:"name,omitempty"` // joined from students
 	Timestamp time.Time `json:"timestamp"`
 	Status    string    `json:"status"` // "present"
+	// SessionID is the class period the record was marked in, if one was active.
+	SessionID string `json:"session_id,omitempty"`
+	// Distance is the face match distance (lower is closer); nil for records
+	// marked before distances were stored.
+	Distance *float64 `json:"distance,omitempty"`
+	// LowConfidence is set when Distance is near the face service's match
+	// threshold, so an admin should check the match.
+	LowConfidence bool `json:"low_confidence,omitempty"`
+}
+
+// AttendanceExportRow is an attendance record joined with the student fields
+// that exports list.
+type AttendanceExportRow struct {
+	StudentID  string // the student's own id (roll number)
+	Name       string
+	Department string
+	Timestamp  time.Time
+	Status     string
+}
+
+// Session is a class period. Date and times are server local wall-clock
+// values (YYYY-MM-DD and HH:MM); an empty Department is open to every student.
+type Session struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Date       string    `json:"date"`
+	StartTime  string    `json:"start_time"`
+	EndTime    string    `json:"end_time"`
+	Department string    `json:"department"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RosterEntry is one expected student of a session and whether they came.
+type RosterEntry struct {
+	Student  Student    `json:"student"`
+	Present  bool       `json:"present"`
+	MarkedAt *time.Time `json:"marked_at,omitempty"`
 }
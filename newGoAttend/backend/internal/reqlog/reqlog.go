@@ -0,0 +1,30 @@
+// Package reqlog carries a request id through a context so that log lines
+// written while serving one request, including those from the Cloudinary and
+// face service clients, can be tied together.
+package reqlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+type idKey struct{}
+
+// NewContext returns a context carrying the request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// ID returns the request id in ctx, or "" outside a request.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// From returns the default logger, tagged with ctx's request id if it has one.
+func From(ctx context.Context) *slog.Logger {
+	if id := ID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
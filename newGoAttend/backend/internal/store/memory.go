@@ -0,0 +1,403 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/google/uuid"
+)
+
+// Memory is an in-memory store with the same behaviour as Store, for handler
+// tests that should not need a sqlite file.
+type Memory struct {
+	mu         sync.Mutex
+	students   map[string]model.Student
+	photos     []model.StudentPhoto
+	attendance []model.AttendanceRecord
+	sessions   map[string]model.Session
+	versions   map[string]int64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		students: make(map[string]model.Student),
+		sessions: make(map[string]model.Session),
+		versions: make(map[string]int64),
+	}
+}
+
+func (m *Memory) Ping(ctx context.Context) error { return nil }
+
+func (m *Memory) Version(table string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.versions[table], nil
+}
+
+// bumpStudents mirrors the students triggers; call it with m.mu held.
+func (m *Memory) bumpStudents() {
+	m.versions[TableStudents]++
+	m.versions[TableAttendance]++
+}
+
+func (m *Memory) CreateStudent(st *model.Student) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.students {
+		if existing.Email == st.Email || existing.StudentID == st.StudentID {
+			return ErrDuplicateStudent
+		}
+	}
+	st.ID = uuid.New().String()
+	st.CreatedAt = time.Now().UTC()
+	m.students[st.ID] = *st
+	m.bumpStudents()
+	return nil
+}
+
+func (m *Memory) ListStudents(f StudentFilter) ([]model.Student, int, error) {
+	q := strings.ToLower(f.Query)
+	matches := m.filterStudents(func(st model.Student) bool {
+		if f.Department != "" && st.Department != f.Department {
+			return false
+		}
+		return q == "" || strings.Contains(strings.ToLower(st.Name), q) ||
+			strings.Contains(strings.ToLower(st.Email), q) || strings.Contains(strings.ToLower(st.StudentID), q)
+	}, false)
+	total := len(matches)
+	start := min(max(f.Offset, 0), total)
+	end := total
+	if f.Limit > 0 {
+		end = min(start+f.Limit, total)
+	}
+	return matches[start:end], total, nil
+}
+
+func (m *Memory) ListStudentsWithoutFace() ([]model.Student, error) {
+	return m.filterStudents(func(st model.Student) bool { return !st.FaceRegistered }, true), nil
+}
+
+// filterStudents returns matching students ordered by created_at.
+func (m *Memory) filterStudents(keep func(model.Student) bool, oldestFirst bool) []model.Student {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.Student
+	for _, st := range m.students {
+		if keep(st) {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if oldestFirst {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+func (m *Memory) GetStudentByID(id string) (*model.Student, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.students[id]
+	if !ok {
+		return nil, nil
+	}
+	return &st, nil
+}
+
+func (m *Memory) UpdateStudentPhoto(id, photoURL string) error {
+	return m.update(id, func(st *model.Student) { st.PhotoURL = photoURL })
+}
+
+func (m *Memory) SetFaceRegistered(id string, registered bool) error {
+	return m.update(id, func(st *model.Student) { st.FaceRegistered = registered })
+}
+
+// update applies fn to a student; like an UPDATE, a missing id is not an error.
+func (m *Memory) update(id string, fn func(*model.Student)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st, ok := m.students[id]; ok {
+		fn(&st)
+		m.students[id] = st
+		m.bumpStudents()
+	}
+	return nil
+}
+
+func (m *Memory) DeleteStudent(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.students[id]; ok {
+		delete(m.students, id)
+		m.bumpStudents()
+	}
+	kept := m.photos[:0]
+	for _, p := range m.photos {
+		if p.StudentID != id {
+			kept = append(kept, p)
+		}
+	}
+	m.photos = kept
+	return nil
+}
+
+func (m *Memory) AddStudentPhoto(studentID, url string) (*model.StudentPhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := model.StudentPhoto{ID: uuid.New().String(), StudentID: studentID, URL: url, CreatedAt: time.Now().UTC()}
+	m.photos = append(m.photos, p)
+	return &p, nil
+}
+
+func (m *Memory) ListStudentPhotos(studentID string) ([]model.StudentPhoto, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.StudentPhoto
+	for _, p := range m.photos {
+		if p.StudentID == studentID {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) MarkAttendance(studentID, sessionID string, distance *float64) (*model.AttendanceRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	for i := len(m.attendance) - 1; i >= 0; i-- {
+		rec := m.attendance[i]
+		if rec.StudentID != studentID {
+			continue
+		}
+		if sessionID != "" && rec.SessionID == sessionID ||
+			sessionID == "" && !rec.Timestamp.Before(now.Add(-AttendanceDedupWindow)) {
+			return &rec, false, nil
+		}
+	}
+	rec := model.AttendanceRecord{
+		ID:        uuid.New().String(),
+		StudentID: studentID,
+		Timestamp: now,
+		Status:    "present",
+		SessionID: sessionID,
+		Distance:  distance,
+	}
+	m.attendance = append(m.attendance, rec)
+	m.versions[TableAttendance]++
+	return &rec, true, nil
+}
+
+func (m *Memory) ListAttendance(limit int, sessionID string) ([]model.AttendanceRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.AttendanceRecord
+	for i := len(m.attendance) - 1; i >= 0 && len(out) < limit; i-- {
+		rec := m.attendance[i]
+		st, ok := m.students[rec.StudentID]
+		if !ok || sessionID != "" && rec.SessionID != sessionID {
+			continue // matches the JOIN in Store.ListAttendance
+		}
+		rec.Name = st.Name
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func (m *Memory) ListLowConfidence(minDistance float64, limit int) ([]model.AttendanceRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.AttendanceRecord
+	for i := len(m.attendance) - 1; i >= 0; i-- {
+		rec := m.attendance[i]
+		st, ok := m.students[rec.StudentID]
+		if !ok || rec.Distance == nil || *rec.Distance < minDistance {
+			continue
+		}
+		rec.Name = st.Name
+		out = append(out, rec)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return *out[i].Distance > *out[j].Distance })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) EachAttendance(from, to time.Time, sessionID string, fn func(model.AttendanceExportRow) error) error {
+	m.mu.Lock()
+	var rows []model.AttendanceExportRow
+	for _, rec := range m.attendance {
+		st, ok := m.students[rec.StudentID]
+		if !ok || rec.Timestamp.Before(from) || !rec.Timestamp.Before(to) ||
+			sessionID != "" && rec.SessionID != sessionID {
+			continue
+		}
+		rows = append(rows, model.AttendanceExportRow{
+			StudentID:  st.StudentID,
+			Name:       st.Name,
+			Department: st.Department,
+			Timestamp:  rec.Timestamp,
+			Status:     rec.Status,
+		})
+	}
+	m.mu.Unlock()
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Department != rows[j].Department {
+			return rows[i].Department < rows[j].Department
+		}
+		return rows[i].Timestamp.Before(rows[j].Timestamp)
+	})
+	for _, r := range rows {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateSession(sess *model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess.ID = uuid.New().String()
+	sess.CreatedAt = time.Now().UTC()
+	if m.overlaps(*sess) {
+		return ErrSessionOverlap
+	}
+	m.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (m *Memory) UpdateSession(sess *model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.sessions[sess.ID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	sess.CreatedAt = old.CreatedAt
+	if m.overlaps(*sess) {
+		return ErrSessionOverlap
+	}
+	m.sessions[sess.ID] = *sess
+	return nil
+}
+
+// overlaps mirrors checkOverlap; call it with m.mu held.
+func (m *Memory) overlaps(sess model.Session) bool {
+	for id, other := range m.sessions {
+		if id != sess.ID && sessionsOverlap(sess, other) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, id)
+	for i := range m.attendance {
+		if m.attendance[i].SessionID == id {
+			m.attendance[i].SessionID = ""
+			m.versions[TableAttendance]++
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetSession(id string) (*model.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &sess, nil
+}
+
+func (m *Memory) ListSessions(date string) ([]model.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.Session
+	for _, sess := range m.sessions {
+		if date == "" || sess.Date == date {
+			out = append(out, sess)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.StartTime != b.StartTime {
+			return a.StartTime < b.StartTime
+		}
+		return a.Department < b.Department
+	})
+	return out, nil
+}
+
+func (m *Memory) ActiveSession(department string, at time.Time) (*model.Session, error) {
+	at = at.Local()
+	date, clock := at.Format(SessionDateLayout), at.Format(SessionTimeLayout)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found *model.Session
+	for _, sess := range m.sessions {
+		if sess.Date != date || sess.StartTime > clock || sess.EndTime <= clock {
+			continue
+		}
+		if sess.Department != department && sess.Department != "" {
+			continue
+		}
+		if found == nil || sess.Department > found.Department {
+			found = &sess
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) SessionRoster(sess *model.Session) ([]model.RosterEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	marked := map[string]time.Time{}
+	for _, rec := range m.attendance {
+		if rec.SessionID == sess.ID {
+			marked[rec.StudentID] = rec.Timestamp
+		}
+	}
+	var out []model.RosterEntry
+	for _, st := range m.students {
+		if sess.Department != "" && st.Department != sess.Department {
+			continue
+		}
+		e := model.RosterEntry{Student: st}
+		if t, ok := marked[st.ID]; ok {
+			e.Present, e.MarkedAt = true, &t
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Student.Name != out[j].Student.Name {
+			return out[i].Student.Name < out[j].Student.Name
+		}
+		return out[i].Student.StudentID < out[j].Student.StudentID
+	})
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// writeLock is the advisory lock key every Postgres write transaction holds,
+// so they run one at a time like SQLite's.
+const writeLock int64 = 0x60a77e4d
+
+// NewPostgres connects to the Postgres database at url (a postgres:// URL or
+// key=value DSN) and brings its schema up to date. Unlike the SQLite file it
+// can be shared by several replicas.
+func NewPostgres(url string) (*Store, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+	if err := migratePostgres(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return &Store{db: db, q: conn{db, true}, postgres: true}, nil
+}
+
+// migratePostgres creates the same schema as migrateSQLite. Every statement
+// is idempotent, and columns added to SQLite later are added here with ADD
+// COLUMN IF NOT EXISTS. The script runs as one transaction, and its advisory
+// lock keeps replicas starting together from migrating at the same time.
+func migratePostgres(db *sql.DB) error {
+	schema := `
+	SELECT pg_advisory_xact_lock(1);
+
+	CREATE TABLE IF NOT EXISTS students (
+		id              TEXT PRIMARY KEY,
+		name            TEXT NOT NULL,
+		email           TEXT UNIQUE NOT NULL,
+		student_id      TEXT UNIQUE NOT NULL,
+		department      TEXT NOT NULL DEFAULT '',
+		photo_url       TEXT NOT NULL DEFAULT '',
+		face_registered BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Class periods; date and times are local wall-clock text so they sort.
+	CREATE TABLE IF NOT EXISTS sessions (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		date        TEXT NOT NULL,
+		start_time  TEXT NOT NULL,
+		end_time    TEXT NOT NULL,
+		department  TEXT NOT NULL DEFAULT '',
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_date ON sessions(date, start_time);
+
+	CREATE TABLE IF NOT EXISTS attendance (
+		id          TEXT PRIMARY KEY,
+		student_id  TEXT NOT NULL REFERENCES students(id),
+		timestamp   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		status      TEXT NOT NULL DEFAULT 'present',
+		distance    DOUBLE PRECISION,
+		session_id  TEXT REFERENCES sessions(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_students_name       ON students(name);
+	CREATE INDEX IF NOT EXISTS idx_students_department ON students(department);
+
+	CREATE INDEX IF NOT EXISTS idx_attendance_student  ON attendance(student_id);
+	CREATE INDEX IF NOT EXISTS idx_attendance_time     ON attendance(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_attendance_distance ON attendance(distance);
+	CREATE INDEX IF NOT EXISTS idx_attendance_session  ON attendance(session_id, student_id);
+
+	CREATE TABLE IF NOT EXISTS student_photos (
+		id          TEXT PRIMARY KEY,
+		student_id  TEXT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+		url         TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_student_photos_student ON student_photos(student_id);
+
+	-- See migrateSQLite. The trigger arguments name the versions to bump.
+	CREATE TABLE IF NOT EXISTS table_versions (
+		name     TEXT PRIMARY KEY,
+		version  BIGINT NOT NULL DEFAULT 0
+	);
+	INSERT INTO table_versions (name) VALUES ('students'), ('attendance') ON CONFLICT DO NOTHING;
+
+	CREATE OR REPLACE FUNCTION bump_table_versions() RETURNS trigger AS $$
+	BEGIN
+		UPDATE table_versions SET version = version + 1 WHERE name = ANY (TG_ARGV);
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS students_version ON students;
+	CREATE TRIGGER students_version AFTER INSERT OR UPDATE OR DELETE ON students
+	FOR EACH STATEMENT EXECUTE FUNCTION bump_table_versions('students', 'attendance');
+	DROP TRIGGER IF EXISTS attendance_version ON attendance;
+	CREATE TRIGGER attendance_version AFTER INSERT OR UPDATE OR DELETE ON attendance
+	FOR EACH STATEMENT EXECUTE FUNCTION bump_table_versions('attendance');
+	`
+	_, err := db.Exec(schema)
+	return err
+}
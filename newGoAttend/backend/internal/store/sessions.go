@@ -0,0 +1,204 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrSessionOverlap is returned when a session's time range overlaps
+	// another session on the same day that the same students could attend.
+	ErrSessionOverlap = errors.New("session overlaps another session")
+	// ErrSessionNotFound is returned when updating or deleting a missing session.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Session date and time layouts; both sort lexically in time order.
+const (
+	SessionDateLayout = "2006-01-02"
+	SessionTimeLayout = "15:04"
+)
+
+// sessionsOverlap reports whether two sessions could claim the same student
+// at the same time: same date, intersecting times, and the same department
+// or one of them open to all. Keeping these apart means at most one session
+// is active for any student.
+func sessionsOverlap(a, b model.Session) bool {
+	return a.Date == b.Date && a.StartTime < b.EndTime && b.StartTime < a.EndTime &&
+		(a.Department == b.Department || a.Department == "" || b.Department == "")
+}
+
+const sessionColumns = `id, name, date, start_time, end_time, department, created_at`
+
+func scanSession(row interface{ Scan(...any) error }) (model.Session, error) {
+	var s model.Session
+	err := row.Scan(&s.ID, &s.Name, &s.Date, &s.StartTime, &s.EndTime, &s.Department, &s.CreatedAt)
+	return s, err
+}
+
+// checkOverlap returns ErrSessionOverlap if sess overlaps a session other
+// than itself.
+func checkOverlap(tx conn, sess *model.Session) error {
+	var n int
+	err := tx.QueryRow(
+		`SELECT COUNT(*) FROM sessions
+		 WHERE date = ? AND id <> ? AND start_time < ? AND end_time > ?
+		   AND (department = ? OR department = '' OR ? = '')`,
+		sess.Date, sess.ID, sess.EndTime, sess.StartTime, sess.Department, sess.Department,
+	).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrSessionOverlap
+	}
+	return nil
+}
+
+// CreateSession inserts a session, returning ErrSessionOverlap if it clashes
+// with an existing one.
+func (s *Store) CreateSession(sess *model.Session) error {
+	sess.ID = uuid.New().String()
+	sess.CreatedAt = time.Now().UTC()
+	return s.withTx(func(tx conn) error {
+		if err := checkOverlap(tx, sess); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			sess.ID, sess.Name, sess.Date, sess.StartTime, sess.EndTime, sess.Department, sess.CreatedAt,
+		)
+		return err
+	})
+}
+
+// UpdateSession replaces a session's fields, keeping its ID and created_at.
+func (s *Store) UpdateSession(sess *model.Session) error {
+	return s.withTx(func(tx conn) error {
+		err := tx.QueryRow(`SELECT created_at FROM sessions WHERE id = ?`, sess.ID).Scan(&sess.CreatedAt)
+		if err == sql.ErrNoRows {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkOverlap(tx, sess); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`UPDATE sessions SET name = ?, date = ?, start_time = ?, end_time = ?, department = ? WHERE id = ?`,
+			sess.Name, sess.Date, sess.StartTime, sess.EndTime, sess.Department, sess.ID,
+		)
+		return err
+	})
+}
+
+// DeleteSession removes a session. Its attendance records are kept but no
+// longer belong to a session.
+func (s *Store) DeleteSession(id string) error {
+	return s.withTx(func(tx conn) error {
+		if _, err := tx.Exec(`UPDATE attendance SET session_id = NULL WHERE session_id = ?`, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrSessionNotFound
+		}
+		return nil
+	})
+}
+
+func (s *Store) GetSession(id string) (*model.Session, error) {
+	sess, err := scanSession(s.q.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// ListSessions returns sessions in time order, only those on date
+// (YYYY-MM-DD) when it is not empty.
+func (s *Store) ListSessions(date string) ([]model.Session, error) {
+	rows, err := s.q.Query(
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE ? = '' OR date = ?
+		 ORDER BY date, start_time, department`, date, date,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		sess, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// ActiveSession returns the session a student of department is in at the
+// local time at, or nil if there is none. A session runs from its start time
+// up to, but not including, its end time.
+func (s *Store) ActiveSession(department string, at time.Time) (*model.Session, error) {
+	at = at.Local()
+	sess, err := scanSession(s.q.QueryRow(
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE date = ? AND start_time <= ? AND end_time > ? AND (department = ? OR department = '')
+		 ORDER BY department DESC LIMIT 1`,
+		at.Format(SessionDateLayout), at.Format(SessionTimeLayout), at.Format(SessionTimeLayout), department,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// SessionRoster lists the students expected at a session, by name, with
+// whether each was marked present in it.
+func (s *Store) SessionRoster(sess *model.Session) ([]model.RosterEntry, error) {
+	rows, err := s.q.Query(
+		`SELECT s.id, s.name, s.email, s.student_id, s.department, s.photo_url, s.face_registered, s.created_at, a.timestamp
+		 FROM students s
+		 LEFT JOIN attendance a ON a.student_id = s.id AND a.session_id = ?
+		 WHERE ? = '' OR s.department = ?
+		 ORDER BY s.name, s.student_id`, sess.ID, sess.Department, sess.Department,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roster []model.RosterEntry
+	for rows.Next() {
+		var (
+			e      model.RosterEntry
+			st     = &e.Student
+			marked sql.NullTime
+		)
+		if err := rows.Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.FaceRegistered, &st.CreatedAt, &marked); err != nil {
+			return nil, err
+		}
+		if marked.Valid {
+			e.Present, e.MarkedAt = true, &marked.Time
+		}
+		roster = append(roster, e)
+	}
+	return roster, rows.Err()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+)
+
+func TestSessionsOverlap(t *testing.T) {
+	sess := func(date, start, end, dept string) model.Session {
+		return model.Session{Date: date, StartTime: start, EndTime: end, Department: dept}
+	}
+	base := sess("2025-03-03", "09:00", "10:00", "CS")
+	tests := []struct {
+		name  string
+		other model.Session
+		want  bool
+	}{
+		{"same times", sess("2025-03-03", "09:00", "10:00", "CS"), true},
+		{"starts inside", sess("2025-03-03", "09:30", "10:30", "CS"), true},
+		{"contains it", sess("2025-03-03", "08:00", "11:00", "CS"), true},
+		{"open to all", sess("2025-03-03", "09:30", "10:30", ""), true},
+		{"ends as it starts", sess("2025-03-03", "08:00", "09:00", "CS"), false},
+		{"starts as it ends", sess("2025-03-03", "10:00", "11:00", "CS"), false},
+		{"other department", sess("2025-03-03", "09:00", "10:00", "Math"), false},
+		{"other day", sess("2025-03-04", "09:00", "10:00", "CS"), false},
+	}
+	for _, tt := range tests {
+		if got := sessionsOverlap(base, tt.other); got != tt.want {
+			t.Errorf("%s: sessionsOverlap = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := sessionsOverlap(tt.other, base); got != tt.want {
+			t.Errorf("%s: sessionsOverlap reversed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionWrites(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		cs := &model.Session{Name: "Algorithms", Date: "2025-03-03", StartTime: "09:00", EndTime: "10:00", Department: "CS"}
+		if err := s.CreateSession(cs); err != nil || cs.ID == "" {
+			t.Fatalf("CreateSession = %v, id %q", err, cs.ID)
+		}
+		math := &model.Session{Name: "Algebra", Date: "2025-03-03", StartTime: "09:00", EndTime: "10:00", Department: "Math"}
+		if err := s.CreateSession(math); err != nil {
+			t.Fatalf("session of another department: %v", err)
+		}
+		for _, clash := range []*model.Session{
+			{Name: "Databases", Date: "2025-03-03", StartTime: "09:30", EndTime: "11:00", Department: "CS"},
+			{Name: "Assembly", Date: "2025-03-03", StartTime: "08:00", EndTime: "09:01"},
+		} {
+			if err := s.CreateSession(clash); !errors.Is(err, ErrSessionOverlap) {
+				t.Errorf("CreateSession(%s) = %v, want ErrSessionOverlap", clash.Name, err)
+			}
+		}
+
+		// A session may keep its own slot when updated but not move onto another.
+		cs.Name = "Algorithms I"
+		if err := s.UpdateSession(cs); err != nil {
+			t.Errorf("UpdateSession in place: %v", err)
+		}
+		moved := *math
+		moved.Department = ""
+		if err := s.UpdateSession(&moved); !errors.Is(err, ErrSessionOverlap) {
+			t.Errorf("UpdateSession onto CS = %v, want ErrSessionOverlap", err)
+		}
+		if err := s.UpdateSession(&model.Session{ID: "missing", Date: "2025-03-04", StartTime: "09:00", EndTime: "10:00"}); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("UpdateSession missing = %v, want ErrSessionNotFound", err)
+		}
+		if err := s.DeleteSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("DeleteSession missing = %v, want ErrSessionNotFound", err)
+		}
+	})
+}
+
+func TestActiveSessionAndRoster(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		at := func(hhmm string) time.Time {
+			tm, _ := time.ParseInLocation("2006-01-02 15:04", "2025-03-03 "+hhmm, time.Local)
+			return tm
+		}
+		first := &model.Session{Name: "Algorithms", Date: "2025-03-03", StartTime: "09:00", EndTime: "10:00", Department: "CS"}
+		second := &model.Session{Name: "Assembly", Date: "2025-03-03", StartTime: "10:00", EndTime: "11:00"}
+		for _, sess := range []*model.Session{first, second} {
+			if err := s.CreateSession(sess); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tests := []struct {
+			dept, at string
+			want     string // session name, "" for none
+		}{
+			{"CS", "08:59", ""},
+			{"CS", "09:00", "Algorithms"},
+			{"CS", "09:59", "Algorithms"},
+			{"Math", "09:30", ""},
+			{"CS", "10:00", "Assembly"},
+			{"Math", "10:30", "Assembly"},
+			{"CS", "11:00", ""},
+		}
+		for _, tt := range tests {
+			sess, err := s.ActiveSession(tt.dept, at(tt.at))
+			got := ""
+			if sess != nil {
+				got = sess.Name
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ActiveSession(%s, %s) = %q, %v; want %q", tt.dept, tt.at, got, err, tt.want)
+			}
+		}
+
+		students := map[string]*model.Student{}
+		for _, st := range []*model.Student{
+			{Name: "Ada", Email: "ada@example.edu", StudentID: "S001", Department: "CS"},
+			{Name: "Alan", Email: "alan@example.edu", StudentID: "S002", Department: "CS"},
+			{Name: "Emmy", Email: "emmy@example.edu", StudentID: "S003", Department: "Math"},
+		} {
+			if err := s.CreateStudent(st); err != nil {
+				t.Fatal(err)
+			}
+			students[st.Name] = st
+		}
+		// Attendance is kept once per session, not once per dedup window.
+		for _, mark := range []struct {
+			student, session string
+			created          bool
+		}{
+			{"Ada", first.ID, true},
+			{"Ada", first.ID, false},
+			{"Ada", second.ID, true},
+			{"Emmy", second.ID, true},
+		} {
+			if _, created, err := s.MarkAttendance(students[mark.student].ID, mark.session, nil); err != nil || created != mark.created {
+				t.Errorf("MarkAttendance(%s) = created %v, %v; want %v", mark.student, created, err, mark.created)
+			}
+		}
+		if recs, err := s.ListAttendance(10, second.ID); err != nil || len(recs) != 2 {
+			t.Errorf("attendance of the second session = %d records, %v; want 2", len(recs), err)
+		}
+
+		roster := func(sess *model.Session) map[string]bool {
+			entries, err := s.SessionRoster(sess)
+			if err != nil {
+				t.Fatal(err)
+			}
+			present := map[string]bool{}
+			for _, e := range entries {
+				present[e.Student.Name] = e.Present
+				if e.Present != (e.MarkedAt != nil) {
+					t.Errorf("%s: present %v, marked at %v", e.Student.Name, e.Present, e.MarkedAt)
+				}
+			}
+			return present
+		}
+		// The CS session expects CS students; the open one expects everyone.
+		if got, want := roster(first), map[string]bool{"Ada": true, "Alan": false}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("roster of %s = %v, want %v", first.Name, got, want)
+		}
+		if got, want := roster(second), map[string]bool{"Ada": true, "Alan": false, "Emmy": true}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("roster of %s = %v, want %v", second.Name, got, want)
+		}
+
+		// Deleting a session keeps its attendance, outside any session.
+		if err := s.DeleteSession(first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if recs, _ := s.ListAttendance(10, ""); len(recs) != 3 {
+			t.Errorf("%d records after deleting a session, want 3", len(recs))
+		}
+		if recs, _ := s.ListAttendance(10, first.ID); len(recs) != 0 {
+			t.Errorf("%d records still in the deleted session", len(recs))
+		}
+	})
+}
@@ -1,10 +1,15 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/darshan/goattend/internal/model"
@@ -12,29 +17,50 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// ErrDuplicateStudent is returned when the email or student ID is already registered.
+var ErrDuplicateStudent = errors.New("student already exists")
+
+// Tables whose Version can be queried.
+const (
+	TableStudents   = "students"
+	TableAttendance = "attendance"
+)
+
+// AttendanceDedupWindow is how long after marking attendance a repeat face
+// login returns the existing record instead of creating another.
+const AttendanceDedupWindow = 5 * time.Minute
+
+// Store is the database store. Queries are written for SQLite with ?
+// placeholders; on Postgres they are rebound to $n.
 type Store struct {
-	db *sql.DB
+	db       *sql.DB
+	q        conn // db, rebinding placeholders
+	postgres bool
 }
 
+// New opens (creating if needed) the SQLite database at dbPath.
 func New(dbPath string) (*Store, error) {
 	if dir := filepath.Dir(dbPath); dir != "." {
 		os.MkdirAll(dir, 0o755)
 	}
 
-	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	// _txlock=immediate makes every transaction BEGIN IMMEDIATE, taking the
+	// write lock up front so concurrent writers wait on busy_timeout instead
+	// of failing with "database is locked" when upgrading a read lock.
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
-	if err := migrate(db); err != nil {
+	if err := migrateSQLite(db); err != nil {
 		return nil, fmt.Errorf("migrate: %w", err)
 	}
-	return &Store{db: db}, nil
+	return &Store{db: db, q: conn{db, false}}, nil
 }
 
-func migrate(db *sql.DB) error {
+func migrateSQLite(db *sql.DB) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS students (
 		id          TEXT PRIMARY KEY,
@@ -53,30 +79,278 @@ func migrate(db *sql.DB) error {
 		status      TEXT NOT NULL DEFAULT 'present'
 	);
 
+	CREATE INDEX IF NOT EXISTS idx_students_name       ON students(name);
+	CREATE INDEX IF NOT EXISTS idx_students_department ON students(department);
+
 	CREATE INDEX IF NOT EXISTS idx_attendance_student ON attendance(student_id);
 	CREATE INDEX IF NOT EXISTS idx_attendance_time    ON attendance(timestamp);
+
+	CREATE TABLE IF NOT EXISTS student_photos (
+		id          TEXT PRIMARY KEY,
+		student_id  TEXT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+		url         TEXT NOT NULL,
+		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_student_photos_student ON student_photos(student_id);
+
+	-- Class periods; date and times are local wall-clock text so they sort.
+	CREATE TABLE IF NOT EXISTS sessions (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		date        TEXT NOT NULL,
+		start_time  TEXT NOT NULL,
+		end_time    TEXT NOT NULL,
+		department  TEXT NOT NULL DEFAULT '',
+		created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_date ON sessions(date, start_time);
+
+	-- Bumped by triggers on every write so list ETags change on updates and
+	-- deletes, not only inserts. Student changes also bump attendance, whose
+	-- list shows student names.
+	CREATE TABLE IF NOT EXISTS table_versions (
+		name     TEXT PRIMARY KEY,
+		version  INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT OR IGNORE INTO table_versions (name) VALUES ('students'), ('attendance');
+
+	CREATE TRIGGER IF NOT EXISTS students_version_insert AFTER INSERT ON students
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name IN ('students', 'attendance'); END;
+	CREATE TRIGGER IF NOT EXISTS students_version_update AFTER UPDATE ON students
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name IN ('students', 'attendance'); END;
+	CREATE TRIGGER IF NOT EXISTS students_version_delete AFTER DELETE ON students
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name IN ('students', 'attendance'); END;
+	CREATE TRIGGER IF NOT EXISTS attendance_version_insert AFTER INSERT ON attendance
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name = 'attendance'; END;
+	CREATE TRIGGER IF NOT EXISTS attendance_version_update AFTER UPDATE ON attendance
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name = 'attendance'; END;
+	CREATE TRIGGER IF NOT EXISTS attendance_version_delete AFTER DELETE ON attendance
+	BEGIN UPDATE table_versions SET version = version + 1 WHERE name = 'attendance'; END;
 	`
-	_, err := db.Exec(schema)
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
+	if err := addColumn(db, "students", "face_registered", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "attendance", "distance", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "attendance", "session_id", "TEXT REFERENCES sessions(id)"); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_attendance_distance ON attendance(distance);
+	CREATE INDEX IF NOT EXISTS idx_attendance_session  ON attendance(session_id, student_id);
+	`)
+	return err
+}
+
+// addColumn adds a column to an existing table unless it is already there;
+// SQLite has no ADD COLUMN IF NOT EXISTS.
+func addColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
 	return err
 }
 
+// queryer is what *sql.DB and *sql.Tx share.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// conn runs queries written with ? placeholders, rebinding them to $n for
+// Postgres.
+type conn struct {
+	queryer
+	postgres bool
+}
+
+func (c conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.queryer.Exec(c.rebind(query), args...)
+}
+
+func (c conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.queryer.Query(c.rebind(query), args...)
+}
+
+func (c conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.queryer.QueryRow(c.rebind(query), args...)
+}
+
+// rebind numbers the ? placeholders in query for Postgres. Queries never
+// have a ? inside a string literal.
+func (c conn) rebind(query string) string {
+	if !c.postgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 func (s *Store) Close() error { return s.db.Close() }
 
+// Ping checks that the database can still be queried.
+func (s *Store) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+
+// Version returns a counter that changes whenever the table's list output
+// could change, for use as a cheap ETag source.
+func (s *Store) Version(table string) (int64, error) {
+	var v int64
+	err := s.q.QueryRow(`SELECT version FROM table_versions WHERE name = ?`, table).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return v, err
+}
+
+// withTx runs fn in a transaction, committing if it returns nil. Write
+// transactions are serialized on both drivers, so check-then-insert code
+// such as the duplicate and overlap checks cannot race: SQLite opens them
+// with BEGIN IMMEDIATE, and on Postgres each takes writeLock first.
+func (s *Store) withTx(fn func(tx conn) error) error {
+	db, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	tx := conn{db, s.postgres}
+	if s.postgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, writeLock); err != nil {
+			db.Rollback()
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		db.Rollback()
+		return err
+	}
+	return db.Commit()
+}
+
 // -------- Students --------
 
+// CreateStudent inserts a student, returning ErrDuplicateStudent if the email
+// or student ID is taken.
 func (s *Store) CreateStudent(st *model.Student) error {
 	st.ID = uuid.New().String()
 	st.CreatedAt = time.Now().UTC()
-	_, err := s.db.Exec(
-		`INSERT INTO students (id, name, email, student_id, department, photo_url, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		st.ID, st.Name, st.Email, st.StudentID, st.Department, st.PhotoURL, st.CreatedAt,
+	return s.withTx(func(tx conn) error {
+		var n int
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FROM students WHERE email = ? OR student_id = ?`, st.Email, st.StudentID,
+		).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrDuplicateStudent
+		}
+		_, err := tx.Exec(
+			`INSERT INTO students (id, name, email, student_id, department, photo_url, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			st.ID, st.Name, st.Email, st.StudentID, st.Department, st.PhotoURL, st.CreatedAt,
+		)
+		return err
+	})
+}
+
+// StudentFilter selects a page of students. Query matches name, email or
+// student ID as a case-insensitive substring; Department must match exactly.
+// Empty fields do not filter, and a non-positive Limit returns every match.
+type StudentFilter struct {
+	Query      string
+	Department string
+	Limit      int
+	Offset     int
+}
+
+// likePattern turns q into a LIKE pattern matching it anywhere, with LIKE's
+// wildcards in q taken literally (ESCAPE '\').
+func likePattern(q string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(q) + "%"
+}
+
+// ListStudents returns a page of the students matching f, newest first, and
+// how many match in total.
+func (s *Store) ListStudents(f StudentFilter) ([]model.Student, int, error) {
+	var where []string
+	var args []any
+	if f.Query != "" {
+		p := likePattern(f.Query)
+		// SQLite's LIKE ignores ASCII case but Postgres's does not.
+		where = append(where, `(LOWER(name) LIKE LOWER(?) ESCAPE '\' OR LOWER(email) LIKE LOWER(?) ESCAPE '\' OR LOWER(student_id) LIKE LOWER(?) ESCAPE '\')`)
+		args = append(args, p, p, p)
+	}
+	if f.Department != "" {
+		where = append(where, `department = ?`)
+		args = append(args, f.Department)
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.q.QueryRow(`SELECT COUNT(*) FROM students`+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32 // no limit; SQLite has no LIMIT ALL
+	}
+	rows, err := s.q.Query(
+		`SELECT id, name, email, student_id, department, photo_url, face_registered, created_at FROM students`+cond+
+			` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		append(args, limit, max(f.Offset, 0))...,
 	)
-	return err
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var students []model.Student
+	for rows.Next() {
+		var st model.Student
+		if err := rows.Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.FaceRegistered, &st.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		students = append(students, st)
+	}
+	return students, total, rows.Err()
 }
 
-func (s *Store) ListStudents() ([]model.Student, error) {
-	rows, err := s.db.Query(`SELECT id, name, email, student_id, department, photo_url, created_at FROM students ORDER BY created_at DESC`)
+// ListStudentsWithoutFace returns students whose face never reached the face service.
+func (s *Store) ListStudentsWithoutFace() ([]model.Student, error) {
+	rows, err := s.q.Query(`SELECT id, name, email, student_id, department, photo_url, face_registered, created_at FROM students WHERE NOT face_registered ORDER BY created_at`)
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +359,7 @@ func (s *Store) ListStudents() ([]model.Student, error) {
 	var students []model.Student
 	for rows.Next() {
 		var st model.Student
-		if err := rows.Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.CreatedAt); err != nil {
+		if err := rows.Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.FaceRegistered, &st.CreatedAt); err != nil {
 			return nil, err
 		}
 		students = append(students, st)
@@ -95,9 +369,9 @@ func (s *Store) ListStudents() ([]model.Student, error) {
 
 func (s *Store) GetStudentByID(id string) (*model.Student, error) {
 	var st model.Student
-	err := s.db.QueryRow(
-		`SELECT id, name, email, student_id, department, photo_url, created_at FROM students WHERE id = ?`, id,
-	).Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.CreatedAt)
+	err := s.q.QueryRow(
+		`SELECT id, name, email, student_id, department, photo_url, face_registered, created_at FROM students WHERE id = ?`, id,
+	).Scan(&st.ID, &st.Name, &st.Email, &st.StudentID, &st.Department, &st.PhotoURL, &st.FaceRegistered, &st.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -105,37 +379,147 @@ func (s *Store) GetStudentByID(id string) (*model.Student, error) {
 }
 
 func (s *Store) UpdateStudentPhoto(id, photoURL string) error {
-	_, err := s.db.Exec(`UPDATE students SET photo_url = ? WHERE id = ?`, photoURL, id)
+	_, err := s.q.Exec(`UPDATE students SET photo_url = ? WHERE id = ?`, photoURL, id)
 	return err
 }
 
-// -------- Attendance --------
+// DeleteStudent removes a student and their additional photos.
+func (s *Store) DeleteStudent(id string) error {
+	return s.withTx(func(tx conn) error {
+		if _, err := tx.Exec(`DELETE FROM student_photos WHERE student_id = ?`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM students WHERE id = ?`, id)
+		return err
+	})
+}
 
-func (s *Store) MarkAttendance(studentID string) (*model.AttendanceRecord, error) {
-	rec := &model.AttendanceRecord{
+// AddStudentPhoto records an additional reference photo for a student.
+func (s *Store) AddStudentPhoto(studentID, url string) (*model.StudentPhoto, error) {
+	p := &model.StudentPhoto{
 		ID:        uuid.New().String(),
 		StudentID: studentID,
-		Timestamp: time.Now().UTC(),
-		Status:    "present",
+		URL:       url,
+		CreatedAt: time.Now().UTC(),
 	}
-	_, err := s.db.Exec(
-		`INSERT INTO attendance (id, student_id, timestamp, status) VALUES (?, ?, ?, ?)`,
-		rec.ID, rec.StudentID, rec.Timestamp, rec.Status,
+	_, err := s.q.Exec(
+		`INSERT INTO student_photos (id, student_id, url, created_at) VALUES (?, ?, ?, ?)`,
+		p.ID, p.StudentID, p.URL, p.CreatedAt,
 	)
-	return rec, err
+	return p, err
 }
 
-func (s *Store) ListAttendance(limit int) ([]model.AttendanceRecord, error) {
+// ListStudentPhotos returns a student's additional photos, oldest first.
+func (s *Store) ListStudentPhotos(studentID string) ([]model.StudentPhoto, error) {
+	rows, err := s.q.Query(
+		`SELECT id, student_id, url, created_at FROM student_photos WHERE student_id = ? ORDER BY created_at`, studentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var photos []model.StudentPhoto
+	for rows.Next() {
+		var p model.StudentPhoto
+		if err := rows.Scan(&p.ID, &p.StudentID, &p.URL, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// SetFaceRegistered records whether the student's face reached the face service.
+func (s *Store) SetFaceRegistered(id string, registered bool) error {
+	_, err := s.q.Exec(`UPDATE students SET face_registered = ? WHERE id = ?`, registered, id)
+	return err
+}
+
+// -------- Attendance --------
+
+// MarkAttendance records a student as present in sessionID (empty when no
+// session is active) with the face match distance, which may be nil. If they
+// were already marked in that session, or without a session within
+// AttendanceDedupWindow, the existing record is returned and created is false.
+func (s *Store) MarkAttendance(studentID, sessionID string, distance *float64) (rec *model.AttendanceRecord, created bool, err error) {
+	now := time.Now().UTC()
+	err = s.withTx(func(tx conn) error {
+		var existing model.AttendanceRecord
+		query, args := `SELECT id, student_id, timestamp, status, COALESCE(session_id, ''), distance FROM attendance
+			 WHERE student_id = ? AND timestamp >= ?
+			 ORDER BY timestamp DESC LIMIT 1`, []any{studentID, now.Add(-AttendanceDedupWindow)}
+		if sessionID != "" {
+			query, args = `SELECT id, student_id, timestamp, status, session_id, distance FROM attendance
+			 WHERE student_id = ? AND session_id = ?
+			 ORDER BY timestamp DESC LIMIT 1`, []any{studentID, sessionID}
+		}
+		err := tx.QueryRow(query, args...).Scan(
+			&existing.ID, &existing.StudentID, &existing.Timestamp, &existing.Status, &existing.SessionID, &existing.Distance)
+		if err == nil {
+			rec = &existing
+			return nil
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		rec = &model.AttendanceRecord{
+			ID:        uuid.New().String(),
+			StudentID: studentID,
+			Timestamp: now,
+			Status:    "present",
+			SessionID: sessionID,
+			Distance:  distance,
+		}
+		created = true
+		_, err = tx.Exec(
+			`INSERT INTO attendance (id, student_id, timestamp, status, session_id, distance) VALUES (?, ?, ?, ?, NULLIF(?, ''), ?)`,
+			rec.ID, rec.StudentID, rec.Timestamp, rec.Status, rec.SessionID, rec.Distance,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return rec, created, nil
+}
+
+// ListAttendance returns the latest limit records, newest first, only those
+// of sessionID when it is not empty.
+func (s *Store) ListAttendance(limit int, sessionID string) ([]model.AttendanceRecord, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := s.db.Query(
-		`SELECT a.id, a.student_id, s.name, a.timestamp, a.status
+	return s.queryAttendance(
+		`SELECT a.id, a.student_id, s.name, a.timestamp, a.status, COALESCE(a.session_id, ''), a.distance
 		 FROM attendance a
 		 JOIN students s ON s.id = a.student_id
+		 WHERE ? = '' OR a.session_id = ?
 		 ORDER BY a.timestamp DESC
-		 LIMIT ?`, limit,
+		 LIMIT ?`, sessionID, sessionID, limit,
+	)
+}
+
+// ListLowConfidence returns up to limit records whose match distance is at
+// least minDistance, furthest from a clean match first. Records without a
+// distance are never included.
+func (s *Store) ListLowConfidence(minDistance float64, limit int) ([]model.AttendanceRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.queryAttendance(
+		`SELECT a.id, a.student_id, s.name, a.timestamp, a.status, COALESCE(a.session_id, ''), a.distance
+		 FROM attendance a
+		 JOIN students s ON s.id = a.student_id
+		 WHERE a.distance >= ?
+		 ORDER BY a.distance DESC, a.timestamp DESC
+		 LIMIT ?`, minDistance, limit,
 	)
+}
+
+func (s *Store) queryAttendance(query string, args ...any) ([]model.AttendanceRecord, error) {
+	rows, err := s.q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -144,10 +528,38 @@ func (s *Store) ListAttendance(limit int) ([]model.AttendanceRecord, error) {
 	var records []model.AttendanceRecord
 	for rows.Next() {
 		var r model.AttendanceRecord
-		if err := rows.Scan(&r.ID, &r.StudentID, &r.Name, &r.Timestamp, &r.Status); err != nil {
+		if err := rows.Scan(&r.ID, &r.StudentID, &r.Name, &r.Timestamp, &r.Status, &r.SessionID, &r.Distance); err != nil {
 			return nil, err
 		}
 		records = append(records, r)
 	}
 	return records, rows.Err()
 }
+
+// EachAttendance calls fn for every attendance record with from <= timestamp
+// < to, only those of sessionID when it is not empty, ordered by department
+// and then time, reading rows from the cursor one at a time. An error from fn
+// stops the iteration and is returned.
+func (s *Store) EachAttendance(from, to time.Time, sessionID string, fn func(model.AttendanceExportRow) error) error {
+	rows, err := s.q.Query(
+		`SELECT s.student_id, s.name, s.department, a.timestamp, a.status
+		 FROM attendance a
+		 JOIN students s ON s.id = a.student_id
+		 WHERE a.timestamp >= ? AND a.timestamp < ? AND (? = '' OR a.session_id = ?)
+		 ORDER BY s.department, a.timestamp`, from.UTC(), to.UTC(), sessionID, sessionID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r model.AttendanceExportRow
+		if err := rows.Scan(&r.StudentID, &r.Name, &r.Department, &r.Timestamp, &r.Status); err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,378 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/darshan/goattend/internal/model"
+)
+
+// newSQLite opens a fresh SQLite store in a temporary directory.
+func newSQLite(t *testing.T) *Store {
+	t.Helper()
+	return newSQLiteAt(t, filepath.Join(t.TempDir(), "goattend.db"))
+}
+
+// newSQLiteAt opens the SQLite store at path, closing it when t ends.
+func newSQLiteAt(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// writer is what the tests run against both Store and Memory need.
+type writer interface {
+	CreateStudent(st *model.Student) error
+	ListStudents(f StudentFilter) ([]model.Student, int, error)
+	MarkAttendance(studentID, sessionID string, distance *float64) (*model.AttendanceRecord, bool, error)
+	ListAttendance(limit int, sessionID string) ([]model.AttendanceRecord, error)
+	ListLowConfidence(minDistance float64, limit int) ([]model.AttendanceRecord, error)
+	CreateSession(sess *model.Session) error
+	UpdateSession(sess *model.Session) error
+	DeleteSession(id string) error
+	ActiveSession(department string, at time.Time) (*model.Session, error)
+	SessionRoster(sess *model.Session) ([]model.RosterEntry, error)
+}
+
+// backend opens an empty store for a test.
+type backend struct {
+	name string
+	open func(t *testing.T) writer
+}
+
+// backends are the stores the contract tests run against. The integration
+// build adds Postgres.
+var backends = []backend{
+	{"sqlite", func(t *testing.T) writer { return newSQLite(t) }},
+	{"memory", func(*testing.T) writer { return NewMemory() }},
+}
+
+// stores runs test against every backend.
+func stores(t *testing.T, test func(t *testing.T, s writer)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) { test(t, b.open(t)) })
+	}
+}
+
+// parallel runs fn from n goroutines at once and returns their errors.
+func parallel(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+func TestConcurrentCreateStudent(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		errs := parallel(10, func(i int) error {
+			return s.CreateStudent(&model.Student{
+				Name:      fmt.Sprintf("Student %d", i),
+				Email:     fmt.Sprintf("s%d@example.edu", i),
+				StudentID: fmt.Sprintf("S%03d", i),
+			})
+		})
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("student %d: %v", i, err)
+			}
+		}
+		if _, total, err := s.ListStudents(StudentFilter{}); err != nil || total != 10 {
+			t.Fatalf("ListStudents = %d students, %v; want 10", total, err)
+		}
+	})
+}
+
+// Simultaneous registrations of the same student: the duplicate check and the
+// insert share a transaction, so exactly one wins.
+func TestConcurrentDuplicateStudent(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		errs := parallel(10, func(i int) error {
+			return s.CreateStudent(&model.Student{Name: "Ada", Email: "ada@example.edu", StudentID: fmt.Sprintf("S%03d", i)})
+		})
+		created := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				created++
+			case !errors.Is(err, ErrDuplicateStudent):
+				t.Errorf("CreateStudent = %v, want nil or ErrDuplicateStudent", err)
+			}
+		}
+		if created != 1 {
+			t.Fatalf("%d registrations succeeded, want 1", created)
+		}
+	})
+}
+
+// Simultaneous face logins of one student mark attendance once.
+func TestConcurrentMarkAttendance(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		st := &model.Student{Name: "Ada", Email: "ada@example.edu", StudentID: "S001"}
+		if err := s.CreateStudent(st); err != nil {
+			t.Fatal(err)
+		}
+		var mu sync.Mutex
+		ids := map[string]bool{}
+		created := 0
+		errs := parallel(10, func(int) error {
+			d := 0.3
+			rec, ok, err := s.MarkAttendance(st.ID, "", &d)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ids[rec.ID] = true
+			if ok {
+				created++
+			}
+			return nil
+		})
+		for _, err := range errs {
+			if err != nil {
+				t.Errorf("MarkAttendance: %v", err)
+			}
+		}
+		if created != 1 || len(ids) != 1 {
+			t.Fatalf("%d records created, %d distinct returned; want 1 and 1", created, len(ids))
+		}
+	})
+}
+
+func TestListStudentsFilter(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		// Created oldest first; lists are newest first.
+		for _, st := range []model.Student{
+			{Name: "Ada Lovelace", Email: "ada@example.edu", StudentID: "CS-001", Department: "CS"},
+			{Name: "Alan Turing", Email: "alan@example.edu", StudentID: "CS-002", Department: "CS"},
+			{Name: "Emmy Noether", Email: "emmy@example.edu", StudentID: "MA-001", Department: "Math"},
+			{Name: "100% Percy", Email: "percy_p@example.edu", StudentID: "MA-002", Department: "Math"},
+			{Name: "Grace Hopper", Email: "grace@navy.example", StudentID: "CS-003", Department: "CS"},
+		} {
+			if err := s.CreateStudent(&st); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tests := []struct {
+			name      string
+			f         StudentFilter
+			wantTotal int
+			want      []string // student IDs of the page
+		}{
+			{"all", StudentFilter{}, 5, []string{"CS-003", "MA-002", "MA-001", "CS-002", "CS-001"}},
+			{"first page", StudentFilter{Limit: 2}, 5, []string{"CS-003", "MA-002"}},
+			{"middle page", StudentFilter{Limit: 2, Offset: 2}, 5, []string{"MA-001", "CS-002"}},
+			{"last page", StudentFilter{Limit: 2, Offset: 4}, 5, []string{"CS-001"}},
+			{"past the end", StudentFilter{Limit: 2, Offset: 10}, 5, nil},
+			{"name, any case", StudentFilter{Query: "TURING"}, 1, []string{"CS-002"}},
+			{"email", StudentFilter{Query: "navy"}, 1, []string{"CS-003"}},
+			{"student id", StudentFilter{Query: "ma-00"}, 2, []string{"MA-002", "MA-001"}},
+			{"percent is literal", StudentFilter{Query: "0%"}, 1, []string{"MA-002"}},
+			{"underscore is literal", StudentFilter{Query: "y_p"}, 1, []string{"MA-002"}},
+			{"department", StudentFilter{Department: "CS", Limit: 2}, 3, []string{"CS-003", "CS-002"}},
+			{"department is exact", StudentFilter{Department: "cs"}, 0, nil},
+			{"query and department", StudentFilter{Query: "e", Department: "Math", Limit: 1, Offset: 1}, 2, []string{"MA-001"}},
+			{"query in another department", StudentFilter{Query: "emmy", Department: "CS"}, 0, nil},
+			{"no match", StudentFilter{Query: "nobody"}, 0, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, total, err := s.ListStudents(tt.f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, st := range page {
+					got = append(got, st.StudentID)
+				}
+				if total != tt.wantTotal || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("ListStudents(%+v) = %v of %d, want %v of %d", tt.f, got, total, tt.want, tt.wantTotal)
+				}
+			})
+		}
+	})
+}
+
+// Name search and department filtering are served by indexes.
+func TestStudentIndexes(t *testing.T) {
+	s := newSQLite(t)
+	for _, idx := range []string{"idx_students_name", "idx_students_department"} {
+		var n int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, idx).Scan(&n); err != nil || n != 1 {
+			t.Errorf("index %s: %d, %v", idx, n, err)
+		}
+	}
+}
+
+// A database created before attendance kept match distances gains the new
+// columns on open, and its old records read back without a distance.
+func TestMigrateExistingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "goattend.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`
+	CREATE TABLE students (
+		id TEXT PRIMARY KEY, name TEXT NOT NULL, email TEXT UNIQUE NOT NULL,
+		student_id TEXT UNIQUE NOT NULL, department TEXT NOT NULL DEFAULT '',
+		photo_url TEXT NOT NULL DEFAULT '', created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE attendance (
+		id TEXT PRIMARY KEY, student_id TEXT NOT NULL REFERENCES students(id),
+		timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, status TEXT NOT NULL DEFAULT 'present'
+	);
+	INSERT INTO students (id, name, email, student_id) VALUES ('st-1', 'Ada', 'ada@example.edu', 'S001');
+	INSERT INTO attendance (id, student_id, timestamp) VALUES ('att-1', 'st-1', '2024-09-02 09:00:00');
+	`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 { // migrating twice is harmless
+		s, err := New(path)
+		if err != nil {
+			t.Fatalf("open existing database: %v", err)
+		}
+		s.Close()
+	}
+	s := newSQLiteAt(t, path)
+	recs, err := s.ListAttendance(10, "")
+	if err != nil || len(recs) != 1 || recs[0].ID != "att-1" || recs[0].Distance != nil || recs[0].Name != "Ada" {
+		t.Fatalf("ListAttendance = %+v, %v; want the old record without a distance", recs, err)
+	}
+	st, err := s.GetStudentByID("st-1")
+	if err != nil || st == nil || st.FaceRegistered {
+		t.Errorf("old student = %+v, %v; want face_registered false", st, err)
+	}
+	d := 0.58
+	if _, _, err := s.MarkAttendance("st-1", "", &d); err != nil {
+		t.Fatal(err)
+	}
+	low, err := s.ListLowConfidence(0.5, 10)
+	if err != nil || len(low) != 1 || low[0].Distance == nil || *low[0].Distance != d {
+		t.Errorf("ListLowConfidence = %+v, %v; want the new record", low, err)
+	}
+}
+
+// Records at or above the threshold are listed, least certain first.
+func TestListLowConfidence(t *testing.T) {
+	stores(t, func(t *testing.T, s writer) {
+		for i, d := range []float64{0.2, 0.55, 0.5, 0.62, 0.49} {
+			st := &model.Student{Name: "S", Email: fmt.Sprintf("s%d@example.edu", i), StudentID: fmt.Sprint(i)}
+			if err := s.CreateStudent(st); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := s.MarkAttendance(st.ID, "", &d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		recs, err := s.ListLowConfidence(0.5, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []float64
+		for _, r := range recs {
+			got = append(got, *r.Distance)
+		}
+		if fmt.Sprint(got) != "[0.62 0.55 0.5]" {
+			t.Errorf("distances = %v, want [0.62 0.55 0.5]", got)
+		}
+		if recs, _ := s.ListLowConfidence(0.5, 2); len(recs) != 2 {
+			t.Errorf("limit 2 returned %d records", len(recs))
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	const query = `SELECT id FROM students WHERE department = ? AND name LIKE ? LIMIT ?`
+	if got := (conn{postgres: false}).rebind(query); got != query {
+		t.Errorf("SQLite rebind = %q, want the query unchanged", got)
+	}
+	want := `SELECT id FROM students WHERE department = $1 AND name LIKE $2 LIMIT $3`
+	if got := (conn{postgres: true}).rebind(query); got != want {
+		t.Errorf("Postgres rebind = %q, want %q", got, want)
+	}
+}
+
+// versioned is what TestVersionChangesOnWrite needs beyond writer.
+type versioned interface {
+	writer
+	Version(table string) (int64, error)
+	SetFaceRegistered(id string, registered bool) error
+	UpdateStudentPhoto(id, photoURL string) error
+}
+
+// versionStep is a write and the table versions it should change.
+type versionStep struct {
+	name                  string
+	write                 func() error
+	students, attendances bool
+}
+
+// Every write that could change a list changes its table's version, updates
+// as well as inserts; attendance lists show student names, so student writes
+// change both.
+func TestVersionChangesOnWrite(t *testing.T) {
+	stores(t, func(t *testing.T, w writer) {
+		s := w.(versioned)
+		versions := func() [2]int64 {
+			t.Helper()
+			var v [2]int64
+			for i, table := range []string{TableStudents, TableAttendance} {
+				var err error
+				if v[i], err = s.Version(table); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return v
+		}
+		st := &model.Student{Name: "Ada", Email: "ada@example.edu", StudentID: "S001"}
+		steps := []versionStep{
+			{"create student", func() error { return s.CreateStudent(st) }, true, true},
+			{"update student", func() error { return s.SetFaceRegistered(st.ID, true) }, true, true},
+			{"update photo", func() error { return s.UpdateStudentPhoto(st.ID, "https://img.example/ada.jpg") }, true, true},
+			{"mark attendance", func() error { _, _, err := s.MarkAttendance(st.ID, "", nil); return err }, false, true},
+			{"repeat attendance", func() error { _, _, err := s.MarkAttendance(st.ID, "", nil); return err }, false, false},
+		}
+		if db, ok := s.(*Store); ok {
+			steps = append(steps, versionStep{"update attendance status", func() error {
+				_, err := db.q.Exec(`UPDATE attendance SET status = 'late' WHERE student_id = ?`, st.ID)
+				return err
+			}, false, true})
+		}
+		for _, step := range steps {
+			before := versions()
+			if err := step.write(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			after := versions()
+			if changed := after[0] != before[0]; changed != step.students {
+				t.Errorf("%s: students version changed = %v, want %v", step.name, changed, step.students)
+			}
+			if changed := after[1] != before[1]; changed != step.attendances {
+				t.Errorf("%s: attendance version changed = %v, want %v", step.name, changed, step.attendances)
+			}
+		}
+	})
+}
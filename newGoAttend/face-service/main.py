@@ -23,7 +23,8 @@ app.add_middleware(
     allow_headers=["*"],
 )
 
-# Store registered face images: faces/<student_id>.jpg
+# Store registered face images: faces/<student_id>.jpg, plus
+# faces/<student_id>__<reference>.jpg for additional reference photos
 FACES_DIR = Path(os.getenv("FACES_DIR", "./faces"))
 FACES_DIR.mkdir(parents=True, exist_ok=True)
 
@@ -43,8 +44,13 @@ def health():
 async def register_face(
     student_id: str = Form(...),
     photo: UploadFile = File(...),
+    reference: str = Form(""),
 ):
-    """Save face image for a student. Validates that a face is detectable."""
+    """Save face image for a student. Validates that a face is detectable.
+
+    An optional reference stores the photo alongside the student's others
+    instead of replacing the primary one.
+    """
     tmp_path = f"/tmp/{uuid.uuid4()}.jpg"
     with open(tmp_path, "wb") as f:
         shutil.copyfileobj(photo.file, f)
@@ -63,8 +69,9 @@ async def register_face(
         os.remove(tmp_path)
         raise HTTPException(status_code=400, detail=f"Face detection failed: {e}")
 
-    # Save as <student_id>.jpg
-    dest = FACES_DIR / f"{student_id}.jpg"
+    # Save as <student_id>.jpg or <student_id>__<reference>.jpg
+    name = f"{student_id}__{Path(reference).name}" if reference else student_id
+    dest = FACES_DIR / f"{name}.jpg"
     shutil.move(tmp_path, str(dest))
 
     return {"status": "registered", "student_id": student_id}
@@ -110,7 +117,7 @@ async def recognize_face(
             distance = result["distance"]
             if distance < best_distance:
                 best_distance = distance
-                best_match = face_path.stem  # student_id (the DB uuid)
+                best_match = face_path.stem.split("__")[0]  # student_id (the DB uuid)
         except Exception:
             continue
 
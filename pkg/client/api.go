@@ -0,0 +1,289 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Registration is the body of RegisterDevice.
+type Registration struct {
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name,omitempty"`
+	// EnrollmentCode is required when the server sets REQUIRE_ENROLLMENT_CODE.
+	EnrollmentCode string `json:"enrollment_code,omitempty"`
+}
+
+// RegisterDevice registers a device and keeps the TokenPair it is issued.
+// A device id already in use answers ErrDuplicate.
+func (c *Client) RegisterDevice(ctx context.Context, reg Registration) (TokenPair, error) {
+	var resp tokenResponse
+	if err := c.send(ctx, http.MethodPost, "/v1/devices/register", nil, jsonBody(reg), "", &resp); err != nil {
+		return TokenPair{}, err
+	}
+	p := resp.pair()
+	c.storeTokens(p)
+	return p, nil
+}
+
+// CheckIn is the body of a check-in. Send ImageURL or UploadToken, not both;
+// a server with BIND_UPLOADS accepts only the token.
+type CheckIn struct {
+	UserID      string `json:"user_id"`
+	DeviceID    string `json:"device_id"`
+	Location    string `json:"location,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	UploadToken string `json:"upload_token,omitempty"`
+	// ImageURLs or UploadTokens send up to three frames instead of one; the
+	// server keeps the best.
+	ImageURLs    []string `json:"image_urls,omitempty"`
+	UploadTokens []string `json:"upload_tokens,omitempty"`
+	// ClientTimestamp is when the check-in happened on the device, for
+	// check-ins sent late.
+	ClientTimestamp *time.Time `json:"client_timestamp,omitempty"`
+	// AuthMethod is "face" (the default) or "pin".
+	AuthMethod string `json:"auth_method,omitempty"`
+	PIN        string `json:"pin,omitempty"`
+}
+
+// CheckInResult is the server's answer to a check-in.
+type CheckInResult struct {
+	EventID    string    `json:"event_id"`
+	When       time.Time `json:"when"`
+	Status     string    `json:"status"`
+	MatchScore *float64  `json:"match_score"`
+	AuthMethod string    `json:"auth_method"`
+	Duplicate  bool      `json:"duplicate"`
+	// Provisional is set when the server spooled the check-in while its
+	// database was down; EventID is the id it will be stored under.
+	Provisional bool `json:"provisional"`
+}
+
+// CheckIn submits a check-in. A duplicate of a recent check-in returns the
+// earlier event's result together with an error matching ErrDuplicate.
+func (c *Client) CheckIn(ctx context.Context, in CheckIn) (*CheckInResult, error) {
+	var res CheckInResult
+	err := c.call(ctx, http.MethodPost, "/v1/checkins", nil, jsonBody(in), &res)
+	if errors.Is(err, ErrDuplicate) && res.EventID != "" {
+		return &res, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Upload is a stored image.
+type Upload struct {
+	URL         string `json:"url"`
+	OriginalURL string `json:"original_url"`
+	PublicID    string `json:"public_id"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Bytes       int    `json:"bytes"`
+	// FacesDetected is set when the server checks uploads for a face.
+	FacesDetected *int `json:"faces_detected,omitempty"`
+	// UploadToken binds the image to this device for one check-in; pass it
+	// as CheckIn.UploadToken within UploadTokenExpiresIn seconds.
+	UploadToken          string `json:"upload_token,omitempty"`
+	UploadTokenExpiresIn int    `json:"upload_token_expires_in,omitempty"`
+}
+
+// UploadImage uploads an image read from r. filename is sent as given; the
+// content type is sniffed from the data.
+func (c *Client) UploadImage(ctx context.Context, filename string, r io.Reader) (*Upload, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("client: read image: %w", err)
+	}
+	form := func() (*body, error) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+		h.Set("Content-Type", http.DetectContentType(data))
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, fmt.Errorf("client: encode image: %w", err)
+		}
+		if _, err := part.Write(data); err != nil {
+			return nil, fmt.Errorf("client: encode image: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("client: encode image: %w", err)
+		}
+		return &body{contentType: w.FormDataContentType(), data: buf.Bytes()}, nil
+	}
+	var up Upload
+	if err := c.call(ctx, http.MethodPost, "/v1/upload", nil, form, &up); err != nil {
+		return nil, err
+	}
+	return &up, nil
+}
+
+// FaceQuality is the image quality the face service measured.
+type FaceQuality struct {
+	Score     float64 `json:"score"`
+	Blur      float64 `json:"blur"`
+	PoseYaw   float64 `json:"pose_yaw"`
+	PosePitch float64 `json:"pose_pitch"`
+	PoseRoll  float64 `json:"pose_roll"`
+	FaceSize  int     `json:"face_size"`
+	IsFrontal bool    `json:"is_frontal"`
+}
+
+// ImageScore is how one frame of a multi-image check-in fared.
+type ImageScore struct {
+	Index      int      `json:"index"`
+	Quality    *float64 `json:"quality,omitempty"`
+	QualityOK  bool     `json:"quality_ok"`
+	Similarity *float64 `json:"similarity,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ImageScores are the frames of a multi-image check-in and the one picked.
+type ImageScores struct {
+	Winner int          `json:"winner"`
+	Images []ImageScore `json:"images"`
+}
+
+// Event is an attendance event. The API sends its fields under their Go
+// names, which is why they carry no tags.
+type Event struct {
+	ID            string
+	UserID        string
+	DeviceID      string
+	When          time.Time
+	Location      string
+	ImageURL      string
+	Status        string
+	MatchScore    *float64
+	CreatedAt     time.Time
+	Quality       *FaceQuality
+	LateMinutes   *int
+	AuthMethod    string
+	FaceModel     *string
+	ModelMismatch bool
+	ClientID      *string
+	ImageScores   *ImageScores
+	UnknownUser   bool
+	// FailureReason says why the event did not check in, e.g. "no_face" or
+	// "timeout"; nil when it did or the cause is unknown.
+	FailureReason *string
+}
+
+// QualityIssue is a quality rule an event's image failed, with a hint on
+// how to retake it.
+type QualityIssue struct {
+	Code string `json:"code"`
+	Hint string `json:"hint"`
+}
+
+// Correction is an admin change to an event.
+type Correction struct {
+	ID        string    `json:"id"`
+	EventID   string    `json:"event_id"`
+	Field     string    `json:"field"`
+	OldValue  *string   `json:"old_value"`
+	NewValue  *string   `json:"new_value"`
+	Reason    string    `json:"reason"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EventDetail is an event with its localized status, quality breakdown and
+// corrections.
+type EventDetail struct {
+	Event         Event          `json:"event"`
+	StatusLabel   string         `json:"status_label"`
+	QualityIssues []QualityIssue `json:"quality_issues"`
+	Corrections   []Correction   `json:"corrections"`
+	// FailureMessage tells the user what to do about Event.FailureReason, in
+	// the language of the request.
+	FailureMessage string `json:"failure_message,omitempty"`
+}
+
+// GetEvent returns one event; an unknown id answers ErrNotFound.
+func (c *Client) GetEvent(ctx context.Context, id string) (*EventDetail, error) {
+	var d EventDetail
+	if err := c.call(ctx, http.MethodGet, "/v1/events/"+url.PathEscape(id), nil, nil, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// EventFilter narrows ListEvents. Zero fields are left to the server's
+// defaults: all devices and users, 50 events from the newest.
+type EventFilter struct {
+	DeviceID string
+	UserID   string
+	Limit    int
+	Offset   int
+}
+
+// ListEvents returns events, newest first.
+func (c *Client) ListEvents(ctx context.Context, f EventFilter) ([]Event, error) {
+	q := url.Values{}
+	if f.DeviceID != "" {
+		q.Set("device_id", f.DeviceID)
+	}
+	if f.UserID != "" {
+		q.Set("user_id", f.UserID)
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+	if f.Offset > 0 {
+		q.Set("offset", strconv.Itoa(f.Offset))
+	}
+	var resp struct {
+		Events []Event `json:"events"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/v1/events", q, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Events, nil
+}
+
+// Employee is an employee as the API lists it.
+type Employee struct {
+	ID           string     `json:"id"`
+	EmployeeID   string     `json:"employee_id"`
+	Name         *string    `json:"name,omitempty"`
+	Email        *string    `json:"email,omitempty"`
+	DepartmentID *int64     `json:"department_id,omitempty"`
+	Department   *string    `json:"department,omitempty"`
+	FaceEnrolled bool       `json:"face_enrolled"`
+	EnrolledAt   *time.Time `json:"enrolled_at,omitempty"`
+	PhotoURL     *string    `json:"photo_url,omitempty"`
+	FaceModel    *string    `json:"face_model,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ListEmployees returns all employees.
+func (c *Client) ListEmployees(ctx context.Context) ([]Employee, error) {
+	var resp struct {
+		Employees []Employee `json:"employees"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/v1/employees", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Employees, nil
+}
+
+// GetEmployee returns one employee by id; an unknown id answers ErrNotFound.
+func (c *Client) GetEmployee(ctx context.Context, id string) (*Employee, error) {
+	var emp Employee
+	if err := c.call(ctx, http.MethodGet, "/v1/employees/"+url.PathEscape(id), nil, nil, &emp); err != nil {
+		return nil, err
+	}
+	return &emp, nil
+}
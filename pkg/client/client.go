@@ -0,0 +1,280 @@
+// Package client is a Go client for the attendance HTTP API, for kiosks and
+// integrations written in Go.
+//
+// A Client holds the device's TokenPair and rotates it shortly before the
+// access token expires, so callers only register once and persist the pair
+// they are handed through OnTokens. Failed requests return an *Error whose
+// Code is one of the API's stable error codes; compare it with errors.Is
+// against ErrDuplicate, ErrNotFound and the other sentinels.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each request when WithTimeout is not given.
+const DefaultTimeout = 15 * time.Second
+
+// DefaultRefreshBefore is how long before expiry the access token is rotated.
+const DefaultRefreshBefore = time.Minute
+
+// TokenPair is the access and refresh token a device is issued on
+// registration, and again on every rotation.
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Valid reports whether the access token is set and has not expired at now.
+func (p TokenPair) Valid(now time.Time) bool {
+	return p.AccessToken != "" && now.Before(p.ExpiresAt)
+}
+
+// Client calls the attendance API. It is safe for concurrent use.
+type Client struct {
+	baseURL       *url.URL
+	http          *http.Client
+	timeout       time.Duration
+	refreshBefore time.Duration
+	onTokens      func(TokenPair)
+	now           func() time.Time
+
+	mu     sync.Mutex
+	tokens TokenPair
+	// refreshing serializes rotations: a refresh token is spent once, so
+	// concurrent callers wait for one rotation instead of racing.
+	refreshing sync.Mutex
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client requests are sent with.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithTimeout bounds each request, on top of any deadline of its context.
+// Zero leaves requests bounded by their context alone.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithTokens starts the client with a stored TokenPair.
+func WithTokens(p TokenPair) Option {
+	return func(c *Client) { c.tokens = p }
+}
+
+// WithRefreshBefore sets how long before expiry the access token is rotated.
+func WithRefreshBefore(d time.Duration) Option {
+	return func(c *Client) { c.refreshBefore = d }
+}
+
+// OnTokens registers fn to be called with every new TokenPair, so it can be
+// stored. The old refresh token is revoked by then.
+func OnTokens(fn func(TokenPair)) Option {
+	return func(c *Client) { c.onTokens = fn }
+}
+
+// New returns a Client for the API at baseURL, e.g. "https://attendance.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http(s) URL", baseURL)
+	}
+	c := &Client{
+		baseURL:       u,
+		http:          http.DefaultClient,
+		timeout:       DefaultTimeout,
+		refreshBefore: DefaultRefreshBefore,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Tokens returns the current TokenPair.
+func (c *Client) Tokens() TokenPair {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the current TokenPair.
+func (c *Client) SetTokens(p TokenPair) {
+	c.mu.Lock()
+	c.tokens = p
+	c.mu.Unlock()
+}
+
+func (c *Client) storeTokens(p TokenPair) {
+	c.SetTokens(p)
+	if c.onTokens != nil {
+		c.onTokens(p)
+	}
+}
+
+// tokenResponse is the body of registration and rotation; expires_at is in
+// Unix seconds.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+func (r tokenResponse) pair() TokenPair {
+	return TokenPair{AccessToken: r.AccessToken, RefreshToken: r.RefreshToken, ExpiresAt: time.Unix(r.ExpiresAt, 0)}
+}
+
+// Refresh rotates the TokenPair: the live access token and the refresh token
+// buy a new pair, and the old refresh token is revoked. Once the access token
+// has expired the device must register again.
+func (c *Client) Refresh(ctx context.Context) (TokenPair, error) {
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	return c.rotate(ctx)
+}
+
+func (c *Client) rotate(ctx context.Context) (TokenPair, error) {
+	cur := c.Tokens()
+	if cur.RefreshToken == "" {
+		return TokenPair{}, ErrNoTokens
+	}
+	if !cur.Valid(c.now()) {
+		return TokenPair{}, ErrTokenExpired
+	}
+	var resp tokenResponse
+	body := map[string]string{"refresh_token": cur.RefreshToken}
+	if err := c.send(ctx, http.MethodPost, "/v1/auth/rotate", nil, jsonBody(body), cur.AccessToken, &resp); err != nil {
+		return TokenPair{}, err
+	}
+	p := resp.pair()
+	c.storeTokens(p)
+	return p, nil
+}
+
+// accessToken returns an access token good for the next request, rotating
+// the pair first when it is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	cur := c.Tokens()
+	if cur.AccessToken == "" {
+		return "", ErrNoTokens
+	}
+	if c.now().Add(c.refreshBefore).Before(cur.ExpiresAt) || cur.RefreshToken == "" {
+		return cur.AccessToken, nil
+	}
+	c.refreshing.Lock()
+	defer c.refreshing.Unlock()
+	// Another caller may have rotated while this one waited.
+	if now := c.Tokens(); now.AccessToken != cur.AccessToken {
+		return now.AccessToken, nil
+	}
+	p, err := c.rotate(ctx)
+	if err != nil {
+		// A token that has not expired yet still works for this request.
+		if cur.Valid(c.now()) && !errors.Is(err, ErrTokenRevoked) {
+			return cur.AccessToken, nil
+		}
+		return "", err
+	}
+	return p.AccessToken, nil
+}
+
+// body is a request body with its content type.
+type body struct {
+	contentType string
+	data        []byte
+}
+
+func jsonBody(v any) func() (*body, error) {
+	return func() (*body, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("client: encode request: %w", err)
+		}
+		return &body{contentType: "application/json", data: data}, nil
+	}
+}
+
+// call sends an authenticated request and decodes the response into out.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, in func() (*body, error), out any) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, query, in, token, out)
+}
+
+// send makes one request. A non-2xx response is returned as an *Error, with
+// the body decoded into out as well, since some errors carry data.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in func() (*body, error), token string, out any) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var reqBody io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := in()
+		if err != nil {
+			return err
+		}
+		reqBody, contentType = bytes.NewReader(b.data), b.contentType
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return fmt.Errorf("client: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("client: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("client: %s %s: read response: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := newError(resp, data)
+		if out != nil && len(data) > 0 {
+			_ = json.Unmarshal(data, out)
+		}
+		return apiErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("client: %s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a non-2xx response from the API.
+type Error struct {
+	// Status is the HTTP status code.
+	Status int
+	// Code is the stable error code of the body, e.g. "duplicate". Responses
+	// without one get a code derived from Status: "validation" for 400,
+	// "unauthorized" for 401, "forbidden" for 403, "not_found" for 404,
+	// "rate_limited" for 429, "unavailable" for 503 and "internal" otherwise.
+	Code string
+	// Message is the localized message for Code; Detail is the English error.
+	Message string
+	Detail  string
+	// RetryAfter is the Retry-After of a 429 or 503, zero when absent.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Message
+	}
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	return "attendance api: " + strconv.Itoa(e.Status) + " " + e.Code + ": " + msg
+}
+
+// Is matches a sentinel *Error by its Code, so errors.Is(err, ErrDuplicate)
+// holds for any duplicate response.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == 0 && t.Code == e.Code
+}
+
+// Sentinels for the API's stable error codes, for use with errors.Is.
+var (
+	ErrDuplicate         = &Error{Code: "duplicate"}
+	ErrInvalidTransition = &Error{Code: "invalid_transition"}
+	ErrDeviceDisabled    = &Error{Code: "device_disabled"}
+	ErrDeviceMismatch    = &Error{Code: "device_mismatch"}
+	ErrEnrollmentCode    = &Error{Code: "enrollment_code"}
+	ErrTokenRevoked      = &Error{Code: "token_revoked"}
+	ErrSelfApproval      = &Error{Code: "self_approval"}
+	ErrPINRejected       = &Error{Code: "pin_rejected"}
+	ErrPINLocked         = &Error{Code: "pin_locked"}
+	ErrPINRateLimited    = &Error{Code: "pin_rate_limited"}
+	ErrTooOld            = &Error{Code: "too_old"}
+	ErrUploadToken       = &Error{Code: "upload_token"}
+	ErrUnknownUser       = &Error{Code: "unknown_user"}
+	ErrImageRejected     = &Error{Code: "image_rejected"}
+	ErrNoFace            = &Error{Code: "no_face"}
+	ErrQueueSaturated    = &Error{Code: "queue_saturated"}
+	ErrJobActive         = &Error{Code: "job_active"}
+	ErrJobState          = &Error{Code: "job_state"}
+	ErrValidation        = &Error{Code: "validation"}
+	ErrUnauthorized      = &Error{Code: "unauthorized"}
+	ErrForbidden         = &Error{Code: "forbidden"}
+	ErrNotFound          = &Error{Code: "not_found"}
+	ErrRateLimited       = &Error{Code: "rate_limited"}
+	ErrUnavailable       = &Error{Code: "unavailable"}
+	ErrInternal          = &Error{Code: "internal"}
+)
+
+var (
+	// ErrNoTokens is returned by calls that need a token before the client
+	// has one; register the device or start it WithTokens.
+	ErrNoTokens = errors.New("client: no tokens; register the device first")
+	// ErrTokenExpired is returned by Refresh once the access token has
+	// expired; rotation needs a live one, so the device must register again.
+	ErrTokenExpired = errors.New("client: access token expired")
+)
+
+// newError builds the *Error of a non-2xx response with body data.
+func newError(resp *http.Response, data []byte) *Error {
+	var b struct {
+		Error   string `json:"error"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &b) != nil {
+		b.Error = strings.TrimSpace(string(data))
+	}
+	e := &Error{Status: resp.StatusCode, Code: b.Code, Message: b.Message, Detail: b.Error}
+	if e.Code == "" {
+		e.Code = statusCode(resp.StatusCode)
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "validation"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	}
+	return "internal"
+}
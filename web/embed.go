@@ -0,0 +1,16 @@
+//go:build embedweb
+
+// Package web holds the dashboard's static files. Built with -tags embedweb,
+// it embeds them so the API binary serves the dashboard without WEB_DIR.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed index.html static
+var files embed.FS
+
+// Embedded is the embedded dashboard.
+var Embedded fs.FS = files
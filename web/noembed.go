@@ -0,0 +1,10 @@
+//go:build !embedweb
+
+// Package web holds the dashboard's static files. Built with -tags embedweb,
+// it embeds them so the API binary serves the dashboard without WEB_DIR.
+package web
+
+import "io/fs"
+
+// Embedded is nil without the embedweb build tag; the API reads WEB_DIR.
+var Embedded fs.FS
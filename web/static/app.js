@@ -483,6 +483,10 @@ async function submitCheckin() {
                 showToast('Session expired. Please login again.', 'error');
                 return;
             }
+            if (res.status === 409 && data.event_id) {
+                showResult(resultEl, `Already checked in. Event ID: ${data.event_id.slice(0, 8)}...`, 'success');
+                return;
+            }
             showResult(resultEl, data.error || 'Check-in failed', 'error');
             return;
         }